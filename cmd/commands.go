@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"salutations/internal/cogs"
+
+	"go.uber.org/zap"
+)
+
+func registerCommands(ctx context.Context, app *app, args []string) error {
+	flags := flag.NewFlagSet("register-commands", flag.ExitOnError)
+	guildID := flags.String("guild", os.Getenv("DEV_GUILD_ID"), "register commands to this guild instead of globally")
+	remove := flags.Bool("remove", false, "remove every command instead of registering them")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	session, err := app.newSession()
+	if err != nil {
+		return fmt.Errorf("bot could not be booted: %w", err)
+	}
+
+	// Without a gateway connection the application is never populated by Ready, so it has to be fetched
+	application, err := session.Application("@me")
+	if err != nil {
+		return fmt.Errorf("error fetching discord application: %w", err)
+	}
+
+	session.State.Application = application
+
+	if *remove {
+		if err := cogs.RemoveCommands(session, *guildID); err != nil {
+			return err
+		}
+
+		app.logger.Info("application commands removed", zap.String("guild_id", *guildID))
+
+		return nil
+	}
+
+	cogList, err := app.newCogs()
+	if err != nil {
+		return err
+	}
+
+	changed, err := cogs.RegisterCommands(session, *guildID, cogList...)
+	if err != nil {
+		return err
+	}
+
+	app.logger.Info("application commands synced", zap.Bool("changed", changed), zap.String("guild_id", *guildID))
+
+	return nil
+}
+
+func validateConfig(ctx context.Context, app *app, _ []string) error {
+	session, err := app.newSession()
+	if err != nil {
+		return fmt.Errorf("bot could not be booted: %w", err)
+	}
+
+	if err := app.selfCheck(ctx, session); err != nil {
+		return err
+	}
+
+	app.logger.Info("configuration is valid")
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"salutations/internal/greeter"
+
+	"cloud.google.com/go/firestore"
+)
+
+// deployment is the gcp project an environment runs against, along with the firestore database and storage bucket in it.
+type deployment struct {
+	ProjectID  string `json:"project_id,omitempty"`
+	DatabaseID string `json:"database_id,omitempty"`
+	Bucket     string `json:"bucket,omitempty"`
+	// Regions override any of the above for instances running in that region, such as a database kept close to them
+	Regions map[string]deployment `json:"regions,omitempty"`
+}
+
+// defaultDeployment is what every environment ran against before deployments were configurable.
+var defaultDeployment = deployment{
+	ProjectID:  PROJECT_ID,
+	DatabaseID: firestore.DefaultDatabaseID,
+	Bucket:     greeter.BucketName,
+}
+
+// overlay fills in the fields other sets, leaving the rest as they were.
+func (d deployment) overlay(other deployment) deployment {
+	if other.ProjectID != "" {
+		d.ProjectID = other.ProjectID
+	}
+
+	if other.DatabaseID != "" {
+		d.DatabaseID = other.DatabaseID
+	}
+
+	if other.Bucket != "" {
+		d.Bucket = other.Bucket
+	}
+
+	return d
+}
+
+// getDeployment resolves the deployment for env and REGION. DEPLOYMENTS_FILE is a json file of deployments keyed by
+// environment, environments it leaves out use the default project, database and bucket. GCP_PROJECT_ID,
+// FIRESTORE_DATABASE and STORAGE_BUCKET take precedence over the file for one off overrides.
+func getDeployment(env string) (deployment, error) {
+	resolved := defaultDeployment
+
+	if path := os.Getenv("DEPLOYMENTS_FILE"); path != "" {
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return deployment{}, fmt.Errorf("error reading deployments file: %w", err)
+		}
+
+		var deployments map[string]deployment
+		if err := json.Unmarshal(contents, &deployments); err != nil {
+			return deployment{}, fmt.Errorf("error parsing deployments file: %w", err)
+		}
+
+		configured, ok := deployments[env]
+		if ok {
+			resolved = resolved.overlay(configured)
+		}
+
+		if region := os.Getenv("REGION"); region != "" && ok {
+			resolved = resolved.overlay(configured.Regions[region])
+		}
+	}
+
+	resolved = resolved.overlay(deployment{
+		ProjectID:  os.Getenv("GCP_PROJECT_ID"),
+		DatabaseID: os.Getenv("FIRESTORE_DATABASE"),
+		Bucket:     os.Getenv("STORAGE_BUCKET"),
+	})
+	resolved.Regions = nil
+
+	return resolved, nil
+}
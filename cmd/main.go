@@ -2,121 +2,674 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
-	"os/signal"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
+	"salutations/internal/admin"
+	"salutations/internal/analytics"
+	"salutations/internal/botinfo"
+	"salutations/internal/cogs"
+	"salutations/internal/encodequeue"
 	firebaseAdapter "salutations/internal/firebase"
 	"salutations/internal/greeter"
+	"salutations/internal/lease"
+	"salutations/internal/lifecycle"
+	"salutations/internal/logging"
+	"salutations/internal/presence"
+	"salutations/internal/reporting"
+	"salutations/internal/scheduler"
+	"salutations/internal/screening"
+	"salutations/internal/selfcheck"
+	"salutations/internal/settings"
 	gcp "salutations/pkg/gcp"
+	"salutations/pkg/secrets"
+	util "salutations/pkg/util"
 
+	"cloud.google.com/go/firestore"
 	"cloud.google.com/go/storage"
 	firebase "firebase.google.com/go"
 	"github.com/bwmarrin/discordgo"
+	"github.com/google/uuid"
 	youtube "github.com/kkdai/youtube/v2"
 	"go.uber.org/zap"
+	"golang.org/x/oauth2/google"
 	"google.golang.org/api/option"
 )
 
-func getLogger(env string) *zap.Logger {
-	if strings.ToUpper(env) == "PROD" {
-		return zap.Must(zap.NewProduction())
-	} else {
-		return zap.Must(zap.NewDevelopment())
+// getLoggingConfig reads LOG_LEVEL and LOG_FORMAT, falling back to verbose console logs outside of production.
+func getLoggingConfig(env string) logging.Config {
+	config := logging.Config{
+		Level:  os.Getenv("LOG_LEVEL"),
+		Format: os.Getenv("LOG_FORMAT"),
+	}
+
+	if strings.ToUpper(env) != "PROD" {
+		if config.Level == "" {
+			config.Level = "debug"
+		}
+
+		if config.Format == "" {
+			config.Format = "console"
+		}
 	}
+
+	return config
 }
 
-func main() {
-	const PROJECT_ID = "twitterbot-e7ab0"
+func getOwnerIDs() []string {
+	ownerIDs := []string{}
 
-	env := os.Getenv("ENV")
+	for _, ownerID := range strings.Split(os.Getenv("OWNER_IDS"), ",") {
+		if ownerID = strings.TrimSpace(ownerID); ownerID != "" {
+			ownerIDs = append(ownerIDs, ownerID)
+		}
+	}
 
-	logger := getLogger(env)
+	return ownerIDs
+}
 
-	defer func() {
-		if err := logger.Sync(); err != nil {
-			panic(fmt.Errorf("error syncing logger %w", err))
+// getPresenceConfig reads PRESENCE_STATUSES, the statuses every guild sees separated by |, and PRESENCE_ROTATION, how
+// long each is shown for such as 10m. Either left unset uses the presence package's defaults.
+func getPresenceConfig() (presence.Config, error) {
+	config := presence.Config{}
+
+	for _, status := range strings.Split(os.Getenv("PRESENCE_STATUSES"), "|") {
+		if status = strings.TrimSpace(status); status != "" {
+			config.Statuses = append(config.Statuses, status)
+		}
+	}
+
+	if rotation := os.Getenv("PRESENCE_ROTATION"); rotation != "" {
+		parsed, err := time.ParseDuration(rotation)
+		if err != nil {
+			return presence.Config{}, err
 		}
-	}()
 
-	discordToken := os.Getenv("MELODY_DISCORD_TOKEN")
-	httpClient := http.Client{
-		Timeout: time.Second * 5,
+		config.Rotation = parsed
 	}
 
-	bot, err := discordgo.New("Bot " + discordToken)
-	bot.Client = &httpClient
+	return config, nil
+}
+
+// getReporter enables Sentry when SENTRY_DSN is set and Google Error Reporting when ERROR_REPORTING_SERVICE is set.
+func getReporter(ctx context.Context, env string, creds *google.Credentials, logger *zap.Logger) (reporting.Reporter, error) {
+	reporters := []reporting.Reporter{}
 
+	if dsn := os.Getenv("SENTRY_DSN"); dsn != "" {
+		sentryReporter, err := reporting.NewSentryReporter(dsn, env)
+		if err != nil {
+			return nil, err
+		}
+
+		reporters = append(reporters, sentryReporter)
+	}
+
+	if serviceName := os.Getenv("ERROR_REPORTING_SERVICE"); serviceName != "" {
+		googleReporter, err := reporting.NewGoogleReporter(ctx, creds.ProjectID, serviceName, logger, option.WithCredentials(creds))
+		if err != nil {
+			return nil, err
+		}
+
+		reporters = append(reporters, googleReporter)
+	}
+
+	return reporting.NewMultiReporter(reporters...), nil
+}
+
+// getSecretsProvider resolves secrets from Google Secret Manager when SECRETS_PROJECT_ID is set,
+// falling back to environment variables for anything that isn't stored there.
+func getSecretsProvider(ctx context.Context) (secrets.Provider, error) {
+	projectID := os.Getenv("SECRETS_PROJECT_ID")
+	if projectID == "" {
+		return secrets.EnvProvider{}, nil
+	}
+
+	secretManager, err := secrets.NewGoogleSecretManagerProvider(ctx, projectID)
 	if err != nil {
-		logger.Fatal("bot could not be booted", zap.Error(err))
+		return nil, err
 	}
 
-	bot.Identify.Intents = discordgo.IntentsAll
-	bot.StateEnabled = true
-	bot.Identify.Presence = discordgo.GatewayStatusUpdate{
-		Game: discordgo.Activity{
-			Name: "/help",
-			Type: discordgo.ActivityTypeGame,
-		},
+	return secrets.NewCachingProvider(secrets.NewFallbackProvider(secretManager, secrets.EnvProvider{}), time.Hour), nil
+}
+
+func getCredentials(ctx context.Context, provider secrets.Provider, logger *zap.Logger) (*google.Credentials, error) {
+	var credentialsJSON []byte
+
+	secret, err := provider.Get(ctx, "GCP_SERVICE_ACCOUNT_JSON")
+	if err == nil {
+		credentialsJSON = []byte(secret)
+	} else if !errors.Is(err, secrets.ErrSecretNotFound) {
+		return nil, fmt.Errorf("error resolving service account secret: %w", err)
 	}
-	bot.AddHandler(func(session *discordgo.Session, _ *discordgo.Ready) {
-		ctx := context.Background()
 
-		firebaseAdapter, err := NewFirebaseAdapter(ctx, PROJECT_ID, logger)
+	creds, source, err := gcp.FindCredentials(ctx, credentialsJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("using gcp credentials", zap.String("source", string(source)), zap.String("project_id", creds.ProjectID))
+
+	return creds, nil
+}
+
+const PROJECT_ID = "twitterbot-e7ab0"
+
+// version is set at build time with -ldflags "-X main.version=<version>"
+var version = "dev"
+
+type command struct {
+	description string
+	run         func(ctx context.Context, app *app, args []string) error
+}
+
+var commands = map[string]command{
+	"serve":             {description: "connect to the discord gateway and start greeting members (default)", run: serve},
+	"register-commands": {description: "sync application commands without connecting to the gateway", run: registerCommands},
+	"validate-config":   {description: "run the startup self check and exit", run: validateConfig},
+	"migrate":           {description: "normalize legacy voiceline records in firestore", run: migrate},
+	"export":            {description: "export voiceline and blacklist documents as json", run: export},
+	"gc-orphans":        {description: "find and delete stored voicelines no document references", run: gcOrphans},
+	"import":            {description: "import voicelines from another greeter bot's export", run: importExport},
+}
+
+// app holds the dependencies shared by every subcommand.
+type app struct {
+	env             string
+	logger          *zap.Logger
+	logLevel        zap.AtomicLevel
+	secrets         secrets.Provider
+	creds           *google.Credentials
+	reporter        reporting.Reporter
+	firebaseAdapter *firebaseAdapter.FirebaseAdapter
+	encodes         *encodequeue.Queue
+	bucket          string
+	// documents reads voicelines and preferences through a cache, everything that writes them should go through it too
+	// so the cache doesn't serve what they replaced
+	documents *firebaseAdapter.DocumentCache
+	// jobs only runs anything once cogs register their jobs, which happens when serve connects
+	jobs *scheduler.Scheduler
+	// usage counts slash commands once serve routes them, other subcommands never record any
+	usage        *analytics.Recorder
+	discordToken string
+	// discordAPIClient makes the session's REST calls and discordCDNClient downloads attachments, both go through
+	// discordProxy when one is configured
+	discordAPIClient *http.Client
+	discordCDNClient *http.Client
+	discordProxy     *url.URL
+	startedAt        time.Time
+}
+
+func newApp(ctx context.Context, env string, logger *zap.Logger, logLevel zap.AtomicLevel) (*app, error) {
+	secretsProvider, err := getSecretsProvider(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error creating secrets provider: %w", err)
+	}
+
+	creds, err := getCredentials(ctx, secretsProvider, logger)
+	if err != nil {
+		return nil, fmt.Errorf("error getting gcp credentials: %w", err)
+	}
+
+	reporter, err := getReporter(ctx, env, creds, logger)
+	if err != nil {
+		return nil, fmt.Errorf("error creating error reporter: %w", err)
+	}
+
+	// A missing token is reported by the self check alongside any other configuration problems
+	discordToken, err := secretsProvider.Get(ctx, "MELODY_DISCORD_TOKEN")
+	if err != nil && !errors.Is(err, secrets.ErrSecretNotFound) {
+		return nil, fmt.Errorf("error resolving discord token: %w", err)
+	}
+
+	target, err := getDeployment(env)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("using deployment", zap.String("env", env), zap.String("project_id", target.ProjectID), zap.String("database_id", target.DatabaseID), zap.String("bucket", target.Bucket))
+
+	slowCallThreshold, err := getFirebaseSlowCallThreshold()
+	if err != nil {
+		return nil, fmt.Errorf("invalid FIREBASE_SLOW_CALL_THRESHOLD: %w", err)
+	}
+
+	firebaseAdapter, err := NewFirebaseAdapter(ctx, target, creds, firebaseAdapter.NewMetrics(logger, slowCallThreshold), logger)
+	if err != nil {
+		return nil, fmt.Errorf("error instantiating firebase adapter: %w", err)
+	}
+
+	documents, err := newDocumentCache(firebaseAdapter)
+	if err != nil {
+		return nil, err
+	}
+
+	discordAPIConfig, discordCDNConfig, err := getDiscordHTTPConfigs()
+	if err != nil {
+		return nil, err
+	}
+
+	encodeConcurrency, err := getEncodeConcurrency()
+	if err != nil {
+		return nil, fmt.Errorf("invalid ENCODE_CONCURRENCY: %w", err)
+	}
+
+	return &app{
+		env:              env,
+		logger:           logger,
+		logLevel:         logLevel,
+		secrets:          secretsProvider,
+		creds:            creds,
+		reporter:         reporter,
+		firebaseAdapter:  firebaseAdapter,
+		documents:        documents,
+		jobs:             scheduler.NewScheduler(logger, firebaseAdapter, reporter, util.RealClock, util.NewRand(time.Now().UnixNano())),
+		encodes:          encodequeue.New(encodeConcurrency, util.RealClock),
+		usage:            analytics.NewRecorder(logger, firebaseAdapter, util.RealClock),
+		bucket:           target.Bucket,
+		discordToken:     discordToken,
+		discordAPIClient: util.NewHTTPClient(discordAPIConfig),
+		discordCDNClient: util.NewHTTPClient(discordCDNConfig),
+		discordProxy:     discordAPIConfig.Proxy,
+		startedAt:        time.Now(),
+	}, nil
+}
+
+func (a *app) close() {
+	a.jobs.Stop()
+
+	if err := a.reporter.Close(); err != nil {
+		a.logger.Warn("couldn't flush error reporter", zap.Error(err))
+	}
+}
+
+func (a *app) newSession() (*discordgo.Session, error) {
+	bot, err := discordgo.New("Bot " + a.discordToken)
+	if err != nil {
+		return nil, err
+	}
+
+	bot.Client = a.discordAPIClient
+
+	// The gateway goes through the same proxy as REST calls, the default dialer is shared so it's copied first
+	if a.discordProxy != nil {
+		dialer := *bot.Dialer
+		dialer.Proxy = http.ProxyURL(a.discordProxy)
+		bot.Dialer = &dialer
+	}
+
+	return bot, nil
+}
+
+func (a *app) selfCheck(ctx context.Context, session *discordgo.Session) error {
+	return selfcheck.Run(ctx, a.logger, time.Second*10,
+		selfcheck.RequiredValues(map[string]string{"MELODY_DISCORD_TOKEN": a.discordToken}),
+		selfcheck.DiscordToken(session),
+		selfcheck.Firestore(a.firebaseAdapter, greeter.BlacklistCollection),
+		selfcheck.Bucket(a.firebaseAdapter, a.bucket),
+		selfcheck.FFmpeg(),
+	)
+}
+
+// getDiscordHTTPConfigs reads how Discord is talked to, REST calls and cdn downloads each have their own client so a
+// slow download never holds up a REST call. DISCORD_API_TIMEOUT and DISCORD_CDN_TIMEOUT bound whole requests and
+// DISCORD_API_HEADER_TIMEOUT and DISCORD_CDN_HEADER_TIMEOUT the wait for a response, durations such as 30s where 0 is
+// unbounded. DISCORD_MAX_IDLE_CONNS_PER_HOST sizes both connection pools and DISCORD_PROXY_URL sends REST, cdn and
+// gateway traffic through a proxy. Anything unset keeps util's defaults.
+func getDiscordHTTPConfigs() (util.HTTPClientConfig, util.HTTPClientConfig, error) {
+	api, cdn := util.DefaultAPIClientConfig, util.DefaultDownloadClientConfig
+
+	durations := map[string]*time.Duration{
+		"DISCORD_API_TIMEOUT":        &api.Timeout,
+		"DISCORD_API_HEADER_TIMEOUT": &api.ResponseHeaderTimeout,
+		"DISCORD_CDN_TIMEOUT":        &cdn.Timeout,
+		"DISCORD_CDN_HEADER_TIMEOUT": &cdn.ResponseHeaderTimeout,
+	}
+
+	for name, duration := range durations {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+
+		parsed, err := time.ParseDuration(value)
 		if err != nil {
-			panic(fmt.Sprintf("error instantiating firebase adapter: %v", err))
+			return util.HTTPClientConfig{}, util.HTTPClientConfig{}, fmt.Errorf("invalid %s: %w", name, err)
 		}
 
-		greeterCog, err := greeter.NewGreeterRunner(logger, &youtube.Client{}, firebaseAdapter)
+		*duration = parsed
+	}
+
+	if value := os.Getenv("DISCORD_MAX_IDLE_CONNS_PER_HOST"); value != "" {
+		conns, err := strconv.Atoi(value)
 		if err != nil {
-			panic(fmt.Sprintf("unable to instantiate greeter cog, %v", err))
+			return util.HTTPClientConfig{}, util.HTTPClientConfig{}, fmt.Errorf("invalid DISCORD_MAX_IDLE_CONNS_PER_HOST: %w", err)
 		}
 
-		if err = greeterCog.RegisterCommands(session); err != nil {
-			panic(fmt.Sprintf("error unable to register greeter commands: %v", err))
+		api.MaxIdleConnsPerHost, cdn.MaxIdleConnsPerHost = conns, conns
+	}
+
+	if value := os.Getenv("DISCORD_PROXY_URL"); value != "" {
+		proxy, err := url.Parse(value)
+		if err != nil {
+			return util.HTTPClientConfig{}, util.HTTPClientConfig{}, fmt.Errorf("invalid DISCORD_PROXY_URL: %w", err)
 		}
 
-		logger.Info("Bot has connected")
-	})
+		api.Proxy, cdn.Proxy = proxy, proxy
+	}
+
+	return api, cdn, nil
+}
 
-	if err := bot.Open(); err != nil {
-		logger.Fatal("error opening connection", zap.Error(err))
+// getGuildDataRetention reads GUILD_DATA_RETENTION, a duration such as 720h, where 0 keeps removed guilds' data forever.
+func getGuildDataRetention() (time.Duration, error) {
+	retention := os.Getenv("GUILD_DATA_RETENTION")
+	if retention == "" {
+		return time.Hour * 24 * 30, nil
 	}
 
-	defer func() {
-		if err := bot.Close(); err != nil {
-			logger.Warn("couldn't close bot", zap.Error(err))
+	return time.ParseDuration(retention)
+}
+
+// getUploadConcurrency reads UPLOAD_CONCURRENCY, how many clips of a zip upload are processed at once, zero
+// leaves the greeter's default.
+func getUploadConcurrency() (int, error) {
+	concurrency := os.Getenv("UPLOAD_CONCURRENCY")
+	if concurrency == "" {
+		return 0, nil
+	}
+
+	return strconv.Atoi(concurrency)
+}
+
+// getUnplayedMonths reads UNPLAYED_VOICELINE_MONTHS, how many months a voiceline goes without playing before its member
+// is asked to archive it, zero uses the greeter's default.
+func getUnplayedMonths() (int, error) {
+	months := os.Getenv("UNPLAYED_VOICELINE_MONTHS")
+	if months == "" {
+		return 0, nil
+	}
+
+	return strconv.Atoi(months)
+}
+
+// getEncodeConcurrency reads ENCODE_CONCURRENCY, how many greetings are encoded at once across every guild, zero
+// sizes it to the number of CPUs.
+func getEncodeConcurrency() (int, error) {
+	concurrency := os.Getenv("ENCODE_CONCURRENCY")
+	if concurrency == "" {
+		return 0, nil
+	}
+
+	return strconv.Atoi(concurrency)
+}
+
+// getFirebaseSlowCallThreshold reads FIREBASE_SLOW_CALL_THRESHOLD, a duration such as 250ms above which firestore and
+// storage calls are logged, zero leaves the adapter's default.
+func getFirebaseSlowCallThreshold() (time.Duration, error) {
+	threshold := os.Getenv("FIREBASE_SLOW_CALL_THRESHOLD")
+	if threshold == "" {
+		return 0, nil
+	}
+
+	return time.ParseDuration(threshold)
+}
+
+// getDocumentCacheTTLs reads DOCUMENT_CACHE_TTLS, comma separated collection=duration pairs such as
+// "welcomeIntros=1m,byeOutros=1m" setting how long the greeter caches each collection's documents. A duration of 0
+// turns caching off for that collection, collections left out keep their default.
+func newDocumentCache(adapter firebaseAdapter.Firebase) (*firebaseAdapter.DocumentCache, error) {
+	ttls, err := getDocumentCacheTTLs()
+	if err != nil {
+		return nil, fmt.Errorf("invalid DOCUMENT_CACHE_TTLS: %w", err)
+	}
+
+	return firebaseAdapter.NewDocumentCache(adapter, util.RealClock, ttls), nil
+}
+
+func getDocumentCacheTTLs() (map[string]time.Duration, error) {
+	ttls := map[string]time.Duration{
+		greeter.WelcomeCollection:           time.Minute,
+		greeter.OutroCollection:             time.Minute,
+		greeter.MemberPreferencesCollection: time.Minute,
+	}
+
+	config := os.Getenv("DOCUMENT_CACHE_TTLS")
+	if config == "" {
+		return ttls, nil
+	}
+
+	for _, pair := range strings.Split(config, ",") {
+		collection, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("expected collection=duration, got %q", pair)
 		}
-	}()
 
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, os.Interrupt)
-	<-stop
+		ttl, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration for %s: %w", collection, err)
+		}
+
+		if ttl <= 0 {
+			delete(ttls, collection)
+			continue
+		}
+
+		ttls[collection] = ttl
+	}
+
+	return ttls, nil
+}
+
+// getScreener screens uploads with the moderation api at MODERATION_API_URL when it's set, otherwise every upload is allowed.
+func getScreener() screening.Screener {
+	if endpoint := os.Getenv("MODERATION_API_URL"); endpoint != "" {
+		return screening.NewAPIScreener(endpoint, os.Getenv("MODERATION_API_TOKEN"))
+	}
+
+	return screening.NewNoopScreener()
 }
 
-func NewFirebaseAdapter(ctx context.Context, projectID string, logger *zap.Logger) (*firebaseAdapter.FirebaseAdapter, error) {
-	creds, err := gcp.GetCredentials()
+// getTranscriber transcribes uploads with the speech to text api at TRANSCRIPTION_API_URL when it's set, otherwise
+// uploads aren't transcribed.
+func getTranscriber() screening.Transcriber {
+	if endpoint := os.Getenv("TRANSCRIPTION_API_URL"); endpoint != "" {
+		return screening.NewAPITranscriber(endpoint, os.Getenv("TRANSCRIPTION_API_TOKEN"))
+	}
+
+	return nil
+}
+
+// getPlaybackLease reads PLAYBACK_LEASE_SCOPE, global or guild, to have instances take a lease before greeting so
+// only one of them plays greetings during blue/green deploys. Leases aren't used when it's unset.
+func (a *app) getPlaybackLease() (*lease.Manager, error) {
+	scope := os.Getenv("PLAYBACK_LEASE_SCOPE")
+	if scope == "" {
+		return nil, nil
+	}
+
+	leaseScope, err := lease.ParseScope(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return lease.NewManager(a.logger, a.firebaseAdapter, util.RealClock, "playback", hostname+"-"+uuid.NewString(), time.Second*30, leaseScope)
+}
+
+func (a *app) newCogs(greeterOpts ...greeter.Option) ([]cogs.Cogs, error) {
+	settingsStore := settings.NewStore(a.firebaseAdapter, util.RealClock)
+
+	uploadConcurrency, err := getUploadConcurrency()
+	if err != nil {
+		return nil, fmt.Errorf("invalid UPLOAD_CONCURRENCY: %w", err)
+	}
+
+	unplayedMonths, err := getUnplayedMonths()
+	if err != nil {
+		return nil, fmt.Errorf("invalid UNPLAYED_VOICELINE_MONTHS: %w", err)
+	}
+
+	greeterOpts = append([]greeter.Option{
+		greeter.WithGuildSettings(settingsStore),
+		greeter.WithScreener(getScreener()),
+		greeter.WithTranscriber(getTranscriber()),
+		greeter.WithScheduler(a.jobs),
+		greeter.WithUploadConcurrency(uploadConcurrency),
+		greeter.WithUnplayedMonths(unplayedMonths),
+		greeter.WithOwnerIDs(getOwnerIDs()),
+		greeter.WithEncodeQueue(a.encodes),
+		greeter.WithBucket(a.bucket),
+		greeter.WithDownloadClient(a.discordCDNClient),
+	}, greeterOpts...)
+
+	// Voicelines and preferences are read on every voice event, so the greeter reads them through a cache
+	greeterCog, err := greeter.NewGreeterRunner(a.logger, &youtube.Client{}, a.documents, a.reporter, greeterOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to instantiate greeter cog: %w", err)
+	}
+
+	adminCog, err := admin.NewAdminRunner(a.logger, a.logLevel, getOwnerIDs())
+	if err != nil {
+		return nil, fmt.Errorf("unable to instantiate admin cog: %w", err)
+	}
+
+	adminCog.AddCachePurger("greeter", greeterCog)
+	adminCog.AddCachePurger("documents", a.documents)
+	adminCog.AddReloader("guild settings", settingsStore)
+	adminCog.SetUsageSummarizer(a.usage)
+
+	botInfoCog, err := botinfo.NewBotInfoRunner(a.logger, a.startedAt, version, greeterCog)
+	if err != nil {
+		return nil, fmt.Errorf("unable to instantiate bot info cog: %w", err)
+	}
+
+	retention, err := getGuildDataRetention()
 	if err != nil {
-		return nil, fmt.Errorf("error getting gcp credentials  %w", err)
+		return nil, fmt.Errorf("invalid GUILD_DATA_RETENTION: %w", err)
+	}
+
+	lifecycleCog, err := lifecycle.NewLifecycleRunner(a.logger, a.documents, settingsStore, a.bucket, util.RealClock, a.jobs, retention)
+	if err != nil {
+		return nil, fmt.Errorf("unable to instantiate lifecycle cog: %w", err)
+	}
+
+	presenceConfig, err := getPresenceConfig()
+	if err != nil {
+		return nil, fmt.Errorf("invalid presence configuration: %w", err)
+	}
+
+	presenceCog, err := presence.NewPresenceRunner(a.logger, settingsStore, a.jobs, presenceConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to instantiate presence cog: %w", err)
+	}
+
+	return []cogs.Cogs{greeterCog, adminCog, botInfoCog, lifecycleCog, presenceCog}, nil
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s <command> [flags]\n\ncommands:\n", os.Args[0])
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-18s %s\n", name, commands[name].description)
+	}
+}
+
+func main() {
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
 	}
 
-	app, err := firebase.NewApp(ctx, &firebase.Config{ProjectID: projectID}, option.WithCredentialsJSON(creds))
+	cmd, ok := commands[name]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	if err := run(cmd, args); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		os.Exit(1)
+	}
+}
+
+func run(cmd command, args []string) error {
+	env := os.Getenv("ENV")
+
+	logger, logLevel, err := logging.NewLogger(getLoggingConfig(env))
 	if err != nil {
-		return nil, fmt.Errorf("error creating new firebase client %w", err)
+		return fmt.Errorf("error creating logger %w", err)
 	}
 
-	fsClient, err := app.Firestore(ctx)
+	defer func() {
+		_ = logger.Sync()
+	}()
+
+	ctx := context.Background()
+
+	application, err := newApp(ctx, env, logger, logLevel)
 	if err != nil {
-		return nil, fmt.Errorf("error creating new firestore client %w", err)
+		return err
 	}
 
-	storageClient, err := storage.NewClient(ctx, option.WithCredentialsJSON(creds))
+	defer application.close()
+
+	return cmd.run(ctx, application, args)
+}
+
+func NewFirebaseAdapter(ctx context.Context, target deployment, creds *google.Credentials, metrics *firebaseAdapter.Metrics, logger *zap.Logger) (*firebaseAdapter.FirebaseAdapter, error) {
+	var fsClient *firestore.Client
+
+	// The firebase sdk only connects to the default database, named databases need a client of their own
+	if target.DatabaseID == firestore.DefaultDatabaseID {
+		app, err := firebase.NewApp(ctx, &firebase.Config{ProjectID: target.ProjectID}, option.WithCredentials(creds))
+		if err != nil {
+			return nil, fmt.Errorf("error creating new firebase client %w", err)
+		}
+
+		if fsClient, err = app.Firestore(ctx); err != nil {
+			return nil, fmt.Errorf("error creating new firestore client %w", err)
+		}
+	} else {
+		var err error
+		if fsClient, err = firestore.NewClientWithDatabase(ctx, target.ProjectID, target.DatabaseID, option.WithCredentials(creds)); err != nil {
+			return nil, fmt.Errorf("error creating new firestore client for database %s %w", target.DatabaseID, err)
+		}
+	}
+
+	storageClient, err := storage.NewClient(ctx, option.WithCredentials(creds))
 	if err != nil {
 		return nil, fmt.Errorf("error creating new storage client %w", err)
 	}
 
-	return firebaseAdapter.NewFirebaseHelper(fsClient, storageClient, logger), nil
+	var urlSigner firebaseAdapter.URLSigner
+
+	// Workload identity and metadata server credentials carry no private key, so urls are signed through IAM instead
+	if strings.ToLower(os.Getenv("URL_SIGNING_MODE")) == "iam" {
+		iamSigner, err := firebaseAdapter.NewIAMSigner(ctx, os.Getenv("URL_SIGNING_SERVICE_ACCOUNT"), option.WithCredentials(creds))
+		if err != nil {
+			return nil, fmt.Errorf("error creating iam url signer %w", err)
+		}
+
+		urlSigner = iamSigner
+	}
+
+	return firebaseAdapter.NewFirebaseHelper(fsClient, storageClient, urlSigner, metrics, logger), nil
 }
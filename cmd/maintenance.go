@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"salutations/internal/greeter"
+	"salutations/internal/settings"
+	util "salutations/pkg/util"
+
+	youtube "github.com/kkdai/youtube/v2"
+	"go.uber.org/zap"
+)
+
+// legacyTimeLayout is the format time.Time.String() produced for records written by older single file uploads.
+const legacyTimeLayout = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+var voicelineCollections = map[string]string{
+	greeter.WelcomeCollection: greeter.IntroArrayKey,
+	greeter.OutroCollection:   greeter.OutroArrayKey,
+}
+
+func parseLegacyTime(value string) (time.Time, error) {
+	// Monotonic clock readings are appended as " m=+0.000000001" and can't be parsed
+	if index := strings.Index(value, " m="); index != -1 {
+		value = value[:index]
+	}
+
+	return time.Parse(legacyTimeLayout, value)
+}
+
+func migrate(ctx context.Context, app *app, args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "log the records that would be migrated without writing them")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	for collection, audioListKey := range voicelineCollections {
+		documents, err := app.firebaseAdapter.GetDocumentsFromCollection(ctx, collection)
+		if err != nil {
+			return err
+		}
+
+		for documentID, document := range documents {
+			tracks, ok := document[audioListKey].([]interface{})
+			if !ok {
+				continue
+			}
+
+			migrated := 0
+
+			for _, track := range tracks {
+				record, ok := track.(map[string]interface{})
+				if !ok {
+					continue
+				}
+
+				createdAt, ok := record["created_at"].(string)
+				if !ok {
+					continue
+				}
+
+				parsed, err := parseLegacyTime(createdAt)
+				if err != nil {
+					app.logger.Warn("couldn't parse legacy created_at", zap.Error(err), zap.String("collection", collection), zap.String("document", documentID), zap.Any("track_name", record["track_name"]))
+					continue
+				}
+
+				record["created_at"] = parsed
+				migrated++
+			}
+
+			if migrated == 0 {
+				continue
+			}
+
+			app.logger.Info("migrating voiceline records", zap.String("collection", collection), zap.String("document", documentID), zap.Int("records", migrated), zap.Bool("dry_run", *dryRun))
+
+			if *dryRun {
+				continue
+			}
+
+			if err := app.documents.UpdateDocument(ctx, collection, documentID, map[string]interface{}{audioListKey: tracks}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func export(ctx context.Context, app *app, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	collections := flags.String("collection", strings.Join([]string{greeter.WelcomeCollection, greeter.OutroCollection, greeter.BlacklistCollection}, ","), "comma separated collections to export")
+	out := flags.String("out", "", "file to write the export to, defaults to stdout")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	documentsByCollection := map[string]map[string]map[string]interface{}{}
+
+	for _, collection := range strings.Split(*collections, ",") {
+		collection = strings.TrimSpace(collection)
+		if collection == "" {
+			continue
+		}
+
+		documents, err := app.firebaseAdapter.GetDocumentsFromCollection(ctx, collection)
+		if err != nil {
+			return err
+		}
+
+		documentsByCollection[collection] = documents
+	}
+
+	var writer io.Writer = os.Stdout
+
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("error creating export file: %w", err)
+		}
+
+		defer file.Close()
+
+		writer = file
+	}
+
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+
+	if err := encoder.Encode(documentsByCollection); err != nil {
+		return fmt.Errorf("error encoding export: %w", err)
+	}
+
+	return nil
+}
+
+func gcOrphans(ctx context.Context, app *app, args []string) error {
+	flags := flag.NewFlagSet("gc-orphans", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", true, "log orphaned objects without deleting them")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	referenced := map[string]bool{}
+
+	for collection, audioListKey := range voicelineCollections {
+		documents, err := app.firebaseAdapter.GetDocumentsFromCollection(ctx, collection)
+		if err != nil {
+			return err
+		}
+
+		for _, document := range documents {
+			tracks, ok := document[audioListKey].([]interface{})
+			if !ok {
+				continue
+			}
+
+			for _, track := range tracks {
+				if record, ok := track.(map[string]interface{}); ok {
+					if trackName, ok := record["track_name"].(string); ok {
+						referenced[trackName] = true
+					}
+				}
+			}
+		}
+	}
+
+	objects, err := app.firebaseAdapter.ListFilesInStorage(ctx, app.bucket, "voicelines/")
+	if err != nil {
+		return err
+	}
+
+	orphans := 0
+
+	for _, object := range objects {
+		trackName := strings.TrimPrefix(object, "voicelines/")
+		if trackName == "" || referenced[trackName] {
+			continue
+		}
+
+		orphans++
+
+		app.logger.Info("orphaned voiceline", zap.String("object", object), zap.Bool("dry_run", *dryRun))
+
+		if *dryRun {
+			continue
+		}
+
+		if err := app.firebaseAdapter.DeleteFileFromStorage(ctx, app.bucket, object); err != nil {
+			return err
+		}
+	}
+
+	app.logger.Info("orphan collection finished", zap.Int("objects", len(objects)), zap.Int("orphans", orphans), zap.Bool("dry_run", *dryRun))
+
+	return nil
+}
+
+func importExport(ctx context.Context, app *app, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	format := flags.String("format", string(greeter.FolderZipMigration), "layout of the export, folder-zip or json")
+	source := flags.String("source", "", "the export to import, a zip for folder-zip or a json file")
+	guildID := flags.String("guild", "", "server whose content screening and loudness limit apply to the imported clips")
+	defaultType := flags.String("type", "intro", "intro or outro, what clips the export doesn't say the type of are imported as")
+	addedBy := flags.String("added-by", "import", "recorded as who added the imported voicelines")
+	dryRun := flags.Bool("dry-run", false, "log the clips that would be imported without importing them")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *source == "" {
+		return fmt.Errorf("-source is required")
+	}
+
+	uploadConcurrency, err := getUploadConcurrency()
+	if err != nil {
+		return fmt.Errorf("invalid UPLOAD_CONCURRENCY: %w", err)
+	}
+
+	// Imports go through the same screening and storage as uploads, the greeter is never connected to discord
+	greeterRunner, err := greeter.NewGreeterRunner(app.logger, &youtube.Client{}, app.documents, app.reporter,
+		greeter.WithGuildSettings(settings.NewStore(app.firebaseAdapter, util.RealClock)),
+		greeter.WithScreener(getScreener()),
+		greeter.WithTranscriber(getTranscriber()),
+		greeter.WithUploadConcurrency(uploadConcurrency),
+		greeter.WithEncodeQueue(app.encodes),
+		greeter.WithBucket(app.bucket),
+	)
+	if err != nil {
+		return fmt.Errorf("unable to instantiate greeter: %w", err)
+	}
+
+	workspace, err := util.NewWorkspace("import-")
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := workspace.Close(); err != nil {
+			app.logger.Warn("error trying to delete import workspace", zap.Error(err), zap.String("directory", workspace.Dir()))
+		}
+	}()
+
+	result, err := greeterRunner.Migrate(ctx, workspace.Dir(), greeter.MigrationRequest{
+		GuildID:     *guildID,
+		AddedBy:     *addedBy,
+		Format:      greeter.MigrationFormat(*format),
+		Path:        *source,
+		DefaultType: *defaultType,
+		DryRun:      *dryRun,
+	})
+	if err != nil {
+		return err
+	}
+
+	if *dryRun {
+		for _, clip := range result.Found {
+			app.logger.Info("would import voiceline", zap.String("source", clip.Source), zap.String("user_id", clip.MemberID), zap.String("type", clip.AudioType))
+		}
+	}
+
+	for _, skipped := range result.Skipped {
+		app.logger.Warn("skipped voiceline", zap.String("source", skipped.Name), zap.Error(skipped.Err))
+	}
+
+	for _, failed := range result.Failed {
+		app.logger.Error("couldn't import voiceline", zap.String("source", failed.Name), zap.Error(failed.Err))
+	}
+
+	for trackName, reason := range result.Flagged {
+		app.logger.Warn("imported voiceline flagged by content screening", zap.String("track_name", trackName), zap.String("reason", reason))
+	}
+
+	app.logger.Info("import finished", zap.Int("found", len(result.Found)), zap.Int("imported", len(result.Imported)), zap.Int("skipped", len(result.Skipped)), zap.Int("failed", len(result.Failed)), zap.Bool("dry_run", *dryRun))
+
+	if len(result.Failed) > 0 {
+		return fmt.Errorf("%d voiceline(s) couldn't be imported, the log names which", len(result.Failed))
+	}
+
+	return nil
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"salutations/internal/analytics"
+	"salutations/internal/cogs"
+	"salutations/internal/encodequeue"
+	firebaseAdapter "salutations/internal/firebase"
+	"salutations/internal/greeter"
+	"salutations/internal/logging"
+	"salutations/internal/middleware"
+	"salutations/internal/presence"
+	"salutations/internal/router"
+	"salutations/internal/scheduler"
+	util "salutations/pkg/util"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+)
+
+func serve(ctx context.Context, app *app, args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	// When set, commands are registered to this guild only so that changes propagate instantly during development
+	devGuildID := flags.String("dev-guild", os.Getenv("DEV_GUILD_ID"), "register commands to this guild only and remove them on shutdown")
+	adminAddr := flags.String("admin-addr", os.Getenv("ADMIN_HTTP_ADDR"), "address to serve the runtime log level and job stats endpoints on")
+	// Lets config and data changes be tried against production servers without the bot ever speaking
+	dryRun := flags.Bool("dry-run", os.Getenv("DRY_RUN") == "true", "select and download voicelines without joining voice or playing them")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	logger := app.logger
+
+	// The log level can be changed at runtime through GET/PUT /loglevel, and job, encode queue, firebase call and command
+	// usage stats read from GET /jobs, GET /encodes, GET /firebase and GET /usage, when an address is configured
+	if *adminAddr != "" {
+		adminHandler := http.NewServeMux()
+		adminHandler.Handle("/loglevel", logging.LevelHandler(app.logLevel))
+		adminHandler.Handle("/jobs", scheduler.StatsHandler(app.jobs))
+		adminHandler.Handle("/encodes", encodequeue.StatsHandler(app.encodes))
+		adminHandler.Handle("/firebase", firebaseAdapter.MetricsHandler(app.firebaseAdapter.Metrics()))
+		adminHandler.Handle("/usage", analytics.StatsHandler(app.usage))
+
+		adminServer := &http.Server{
+			Addr:              *adminAddr,
+			Handler:           adminHandler,
+			ReadHeaderTimeout: time.Second * 5,
+		}
+
+		go func() {
+			if err := adminServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("admin http server stopped", zap.Error(err))
+			}
+		}()
+
+		defer func() {
+			if err := adminServer.Close(); err != nil {
+				logger.Warn("couldn't close admin http server", zap.Error(err))
+			}
+		}()
+	}
+
+	bot, err := app.newSession()
+	if err != nil {
+		return fmt.Errorf("bot could not be booted: %w", err)
+	}
+
+	if err := app.selfCheck(ctx, bot); err != nil {
+		return fmt.Errorf("startup self check failed: %w", err)
+	}
+
+	bot.Identify.Intents = discordgo.IntentsAll
+	bot.StateEnabled = true
+
+	presenceConfig, err := getPresenceConfig()
+	if err != nil {
+		return fmt.Errorf("invalid presence configuration: %w", err)
+	}
+
+	// The presence cog rotates through the other statuses once connected
+	bot.Identify.Presence = presence.Identify(presenceConfig)
+
+	interactionRouter := router.NewRouter(logger,
+		middleware.Logger(logger),
+		middleware.Usage(app.usage),
+		middleware.ErrorResponder(logger),
+		middleware.Recover(logger, app.reporter),
+	)
+	bot.AddHandler(interactionRouter.Handle)
+
+	if *dryRun {
+		logger.Warn("running in dry run mode, voice channels will not be joined")
+	}
+
+	playbackLease, err := app.getPlaybackLease()
+	if err != nil {
+		return fmt.Errorf("invalid PLAYBACK_LEASE_SCOPE: %w", err)
+	}
+
+	greeterOpts := []greeter.Option{greeter.WithDryRun(*dryRun)}
+
+	if playbackLease != nil {
+		greeterOpts = append(greeterOpts, greeter.WithPlaybackLease(playbackLease))
+
+		// Deferred before the bot is opened so leases are only released once it has disconnected and can't take them back
+		defer func() {
+			if err := playbackLease.ReleaseAll(context.Background()); err != nil {
+				logger.Warn("couldn't release playback leases", zap.Error(err))
+			}
+		}()
+	}
+
+	cogList, err := app.newCogs(greeterOpts...)
+	if err != nil {
+		return err
+	}
+
+	// Other processes like migrate and import write voicelines too, the cache drops them as they change
+	watchCtx, stopWatching := context.WithCancel(ctx)
+	defer stopWatching()
+
+	go app.documents.Watch(watchCtx, logger)
+
+	if err := app.jobs.Register(app.usage.FlushJob()); err != nil {
+		return fmt.Errorf("unable to schedule command usage flush: %w", err)
+	}
+
+	// Deferred before the bot is opened so the last commands it handles are flushed too
+	defer func() {
+		if err := app.usage.Flush(context.Background()); err != nil {
+			logger.Warn("couldn't flush command usage", zap.Error(err))
+		}
+	}()
+
+	// Ready fires again on every reconnect, cogs should only be set up once per process
+	var setupOnce sync.Once
+
+	bot.AddHandler(func(session *discordgo.Session, _ *discordgo.Ready) {
+		setupOnce.Do(func() {
+			changed, err := cogs.RegisterCommands(session, *devGuildID, cogList...)
+			if err != nil {
+				logger.Error("error unable to register commands", zap.Error(err))
+			} else {
+				logger.Info("application commands synced", zap.Bool("changed", changed), zap.String("guild_id", *devGuildID))
+			}
+
+			for _, cog := range cogList {
+				cog.RegisterHandlers(session, interactionRouter)
+			}
+		})
+
+		logger.Info("Bot has connected")
+	})
+
+	if err := bot.Open(); err != nil {
+		return fmt.Errorf("error opening connection: %w", err)
+	}
+
+	defer func() {
+		if err := bot.Close(); err != nil {
+			logger.Warn("couldn't close bot", zap.Error(err))
+		}
+	}()
+
+	// Temporary messages would otherwise outlive the timers that were going to delete them
+	defer func() {
+		logger.Info("deleted pending temporary messages", zap.Int("deleted", util.DefaultMessageDeleter.Flush()))
+	}()
+
+	// Queued voice events still need the session, so they're finished before it's closed
+	defer func() {
+		for _, cog := range cogList {
+			if stopper, ok := cog.(cogs.Stopper); ok {
+				stopper.Stop()
+			}
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	<-stop
+
+	if *devGuildID != "" {
+		if err := cogs.RemoveCommands(bot, *devGuildID); err != nil {
+			logger.Warn("couldn't clean up development guild commands", zap.Error(err), zap.String("guild_id", *devGuildID))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,269 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"salutations/internal/analytics"
+	"salutations/internal/cogs"
+	"salutations/internal/embeds"
+	"salutations/internal/middleware"
+	"salutations/internal/router"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// defaultUsageDays is how far back /admin usage looks when no days are picked
+const defaultUsageDays = 7
+
+type Reloader interface {
+	Reload(ctx context.Context) error
+}
+
+type CachePurger interface {
+	PurgeCache() int
+}
+
+// UsageSummarizer adds up the command usage every instance has recorded since a point in time.
+type UsageSummarizer interface {
+	Summarize(ctx context.Context, since time.Time) ([]analytics.CommandStats, error)
+}
+
+type adminRunner struct {
+	logger       *zap.Logger
+	logLevel     zap.AtomicLevel
+	ownerIDs     []string
+	mu           sync.RWMutex
+	reloaders    map[string]Reloader
+	cachePurgers map[string]CachePurger
+	usage        UsageSummarizer
+}
+
+var _ cogs.Cogs = (*adminRunner)(nil)
+
+func NewAdminRunner(logger *zap.Logger, logLevel zap.AtomicLevel, ownerIDs []string) (*adminRunner, error) {
+	if len(ownerIDs) == 0 {
+		logger.Warn("no owner ids configured, admin commands will be unavailable")
+	}
+
+	return &adminRunner{
+		logger:       logger,
+		logLevel:     logLevel,
+		ownerIDs:     ownerIDs,
+		reloaders:    make(map[string]Reloader),
+		cachePurgers: make(map[string]CachePurger),
+	}, nil
+}
+
+func (a *adminRunner) AddReloader(name string, reloader Reloader) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.reloaders[name] = reloader
+}
+
+func (a *adminRunner) AddCachePurger(name string, purger CachePurger) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.cachePurgers[name] = purger
+}
+
+// SetUsageSummarizer enables /admin usage, which reports there's no usage recorded until it's set.
+func (a *adminRunner) SetUsageSummarizer(usage UsageSummarizer) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.usage = usage
+}
+
+func (a *adminRunner) GetCommands() []*discordgo.ApplicationCommand {
+	var adminPermission int64 = discordgo.PermissionAdministrator
+
+	return []*discordgo.ApplicationCommand{
+		{
+			Name:                     "admin",
+			Description:              "Bot owner administrative commands",
+			DefaultMemberPermissions: &adminPermission,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "reload-settings",
+					Description: "Reload settings from storage",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+				},
+				{
+					Name:        "guilds",
+					Description: "List the guilds the bot is currently in",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+				},
+				{
+					Name:        "purge-cache",
+					Description: "Clear every in-memory cache held by the bot",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+				},
+				{
+					Name:        "usage",
+					Description: "See which commands are used the most across every guild",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "days",
+							Description: "How far back to look, a week when unset",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Choices: []*discordgo.ApplicationCommandOptionChoice{
+								{Name: "A day", Value: 1},
+								{Name: "A week", Value: 7},
+								{Name: "A month", Value: 30},
+								{Name: "Three months", Value: 90},
+							},
+						},
+					},
+				},
+				{
+					Name:        "loglevel",
+					Description: "View or change the log level at runtime",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "level",
+							Description: "The new log level",
+							Type:        discordgo.ApplicationCommandOptionString,
+							Choices: []*discordgo.ApplicationCommandOptionChoice{
+								{Name: "Debug", Value: zapcore.DebugLevel.String()},
+								{Name: "Info", Value: zapcore.InfoLevel.String()},
+								{Name: "Warn", Value: zapcore.WarnLevel.String()},
+								{Name: "Error", Value: zapcore.ErrorLevel.String()},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (a *adminRunner) RegisterHandlers(_ *discordgo.Session, r *router.Router) {
+	r.Command("admin", a.admin, middleware.RequireOwner(a.ownerIDs))
+}
+
+func (a *adminRunner) admin(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	options := interaction.ApplicationCommandData().Options
+	if len(options) == 0 {
+		return errors.New("admin command invoked without a subcommand")
+	}
+
+	subcommand := options[0]
+
+	var embed *discordgo.MessageEmbed
+
+	var err error
+
+	switch subcommand.Name {
+	case "reload-settings":
+		embed, err = a.reloadSettings()
+	case "guilds":
+		embed = embeds.AdminGuildsEmbed(session.State.Guilds)
+	case "purge-cache":
+		embed = a.purgeCache()
+	case "usage":
+		embed, err = a.commandUsage(subcommand.Options)
+	case "loglevel":
+		embed, err = a.setLogLevel(subcommand.Options)
+	default:
+		return fmt.Errorf("unknown admin subcommand: %s", subcommand.Name)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{embed},
+			Flags:  discordgo.MessageFlagsEphemeral,
+		},
+	})
+}
+
+func (a *adminRunner) reloadSettings() (*discordgo.MessageEmbed, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if len(a.reloaders) == 0 {
+		return embeds.AdminActionEmbed("Settings reloaded", "There are no reloadable settings registered"), nil
+	}
+
+	ctx := context.Background()
+	reloaded := make([]string, 0, len(a.reloaders))
+
+	for name, reloader := range a.reloaders {
+		if err := reloader.Reload(ctx); err != nil {
+			return nil, fmt.Errorf("error reloading %s settings: %w", name, err)
+		}
+
+		reloaded = append(reloaded, name)
+	}
+
+	a.logger.Info("settings reloaded by owner", zap.Strings("reloaded", reloaded))
+
+	return embeds.AdminActionEmbed("Settings reloaded", fmt.Sprintf("Reloaded: `%s`", strings.Join(reloaded, "`, `"))), nil
+}
+
+func (a *adminRunner) purgeCache() *discordgo.MessageEmbed {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	purged := 0
+	for _, purger := range a.cachePurgers {
+		purged += purger.PurgeCache()
+	}
+
+	a.logger.Info("caches purged by owner", zap.Int("entries_purged", purged))
+
+	return embeds.AdminActionEmbed("Cache purged", fmt.Sprintf("Removed **%d** cached entries", purged))
+}
+
+func (a *adminRunner) commandUsage(options []*discordgo.ApplicationCommandInteractionDataOption) (*discordgo.MessageEmbed, error) {
+	a.mu.RLock()
+	usage := a.usage
+	a.mu.RUnlock()
+
+	days := defaultUsageDays
+	if len(options) > 0 {
+		days = int(options[0].IntValue())
+	}
+
+	if usage == nil {
+		return embeds.AdminUsageEmbed(nil, days), nil
+	}
+
+	stats, err := usage.Summarize(context.Background(), time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		return nil, fmt.Errorf("error summarizing command usage: %w", err)
+	}
+
+	return embeds.AdminUsageEmbed(stats, days), nil
+}
+
+func (a *adminRunner) setLogLevel(options []*discordgo.ApplicationCommandInteractionDataOption) (*discordgo.MessageEmbed, error) {
+	if len(options) == 0 {
+		return embeds.AdminActionEmbed("Log level", fmt.Sprintf("The current log level is `%s`", a.logLevel.Level())), nil
+	}
+
+	level, err := zapcore.ParseLevel(options[0].StringValue())
+	if err != nil {
+		return nil, fmt.Errorf("error parsing log level: %w", err)
+	}
+
+	a.logLevel.SetLevel(level)
+	a.logger.Info("log level changed by owner", zap.String("level", level.String()))
+
+	return embeds.AdminActionEmbed("Log level updated", fmt.Sprintf("The log level is now `%s`", level)), nil
+}
@@ -0,0 +1,304 @@
+package analytics
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	firebaseAdapter "salutations/internal/firebase"
+	"salutations/internal/scheduler"
+	util "salutations/pkg/util"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// UsageCollection holds one document per guild per flush with the commands used there since the previous flush.
+// A firestore TTL policy on expires_at keeps the collection from growing.
+const UsageCollection = "commandUsage"
+
+const (
+	// FlushInterval is how often each instance writes the usage it has counted, batching keeps busy guilds from costing
+	// a write per command
+	FlushInterval = time.Hour
+	// usageRetention is how long flushed usage is kept before the TTL policy removes it
+	usageRetention = time.Hour * 24 * 90
+)
+
+// CommandStats are the invocations of one command, subcommands are counted apart from each other as "parent sub".
+type CommandStats struct {
+	Command      string        `json:"command"`
+	Calls        int64         `json:"calls"`
+	Errors       int64         `json:"errors"`
+	Guilds       int           `json:"guilds"`
+	TotalLatency time.Duration `json:"total_latency"`
+	MaxLatency   time.Duration `json:"max_latency"`
+}
+
+// AverageLatency is how long the command took on average, zero when it was never called.
+func (s CommandStats) AverageLatency() time.Duration {
+	if s.Calls == 0 {
+		return 0
+	}
+
+	return s.TotalLatency / time.Duration(s.Calls)
+}
+
+func (s *CommandStats) add(calls int64, errs int64, totalLatency time.Duration, maxLatency time.Duration) {
+	s.Calls += calls
+	s.Errors += errs
+	s.TotalLatency += totalLatency
+	s.MaxLatency = max(s.MaxLatency, maxLatency)
+}
+
+// commandUsage is a command's entry in a usage document, latencies are stored in milliseconds.
+type commandUsage struct {
+	Calls          int64 `firestore:"calls"`
+	Errors         int64 `firestore:"errors"`
+	TotalLatencyMS int64 `firestore:"total_latency_ms"`
+	MaxLatencyMS   int64 `firestore:"max_latency_ms"`
+}
+
+type usageRecord struct {
+	GuildID   string                  `firestore:"guild_id"`
+	FlushedAt time.Time               `firestore:"flushed_at"`
+	ExpiresAt time.Time               `firestore:"expires_at"`
+	Commands  map[string]commandUsage `firestore:"commands"`
+}
+
+type commandTotals struct {
+	stats  CommandStats
+	guilds map[string]bool
+}
+
+// Recorder counts command invocations per guild in memory and writes them to firestore in batches. Its totals since
+// the process started are kept apart from the batches so flushing never resets them.
+type Recorder struct {
+	logger          *zap.Logger
+	firebaseAdapter firebaseAdapter.Firebase
+	clock           util.Clock
+	mu              sync.Mutex
+	totals          map[string]*commandTotals
+	pending         map[string]map[string]*commandUsage
+}
+
+func NewRecorder(logger *zap.Logger, firebaseAdapter firebaseAdapter.Firebase, clock util.Clock) *Recorder {
+	return &Recorder{
+		logger:          logger,
+		firebaseAdapter: firebaseAdapter,
+		clock:           clock,
+		totals:          make(map[string]*commandTotals),
+		pending:         make(map[string]map[string]*commandUsage),
+	}
+}
+
+// Record counts one invocation of command in the guild, commands used in DMs are counted under an empty guild id.
+func (r *Recorder) Record(guildID string, command string, latency time.Duration, err error) {
+	var errs int64
+	if err != nil {
+		errs = 1
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	totals, ok := r.totals[command]
+	if !ok {
+		totals = &commandTotals{stats: CommandStats{Command: command}, guilds: make(map[string]bool)}
+		r.totals[command] = totals
+	}
+
+	totals.stats.add(1, errs, latency, latency)
+	totals.guilds[guildID] = true
+
+	commands, ok := r.pending[guildID]
+	if !ok {
+		commands = make(map[string]*commandUsage)
+		r.pending[guildID] = commands
+	}
+
+	usage, ok := commands[command]
+	if !ok {
+		usage = &commandUsage{}
+		commands[command] = usage
+	}
+
+	usage.Calls++
+	usage.Errors += errs
+	usage.TotalLatencyMS += latency.Milliseconds()
+	usage.MaxLatencyMS = max(usage.MaxLatencyMS, latency.Milliseconds())
+}
+
+// Stats returns every command used since the process started, the most called first.
+func (r *Recorder) Stats() []CommandStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := make([]CommandStats, 0, len(r.totals))
+	for _, totals := range r.totals {
+		command := totals.stats
+		command.Guilds = len(totals.guilds)
+		stats = append(stats, command)
+	}
+
+	sortStats(stats)
+
+	return stats
+}
+
+// Flush writes the usage counted since the last flush, one document per guild. Guilds whose document couldn't be
+// written are kept for the next flush so their usage isn't lost.
+func (r *Recorder) Flush(ctx context.Context) error {
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = make(map[string]map[string]*commandUsage)
+	r.mu.Unlock()
+
+	now := r.clock.Now()
+
+	var errs []error
+
+	for guildID, commands := range pending {
+		if err := r.writeUsage(ctx, guildID, commands, now); err != nil {
+			errs = append(errs, fmt.Errorf("guild %s: %w", guildID, err))
+			r.requeue(guildID, commands)
+		}
+	}
+
+	r.logger.Debug("command usage flushed", zap.Int("guilds", len(pending)-len(errs)))
+
+	return errors.Join(errs...)
+}
+
+func (r *Recorder) writeUsage(ctx context.Context, guildID string, commands map[string]*commandUsage, now time.Time) error {
+	recordID, err := uuid.NewV7()
+	if err != nil {
+		return fmt.Errorf("error generating usage id: %w", err)
+	}
+
+	record := usageRecord{
+		GuildID:   guildID,
+		FlushedAt: now,
+		ExpiresAt: now.Add(usageRetention),
+		Commands:  make(map[string]commandUsage, len(commands)),
+	}
+
+	for command, usage := range commands {
+		record.Commands[command] = *usage
+	}
+
+	return r.firebaseAdapter.CreateDocument(ctx, UsageCollection, recordID.String(), record)
+}
+
+// requeue merges usage that failed to flush back into what's pending.
+func (r *Recorder) requeue(guildID string, commands map[string]*commandUsage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pending, ok := r.pending[guildID]
+	if !ok {
+		r.pending[guildID] = commands
+		return
+	}
+
+	for command, usage := range commands {
+		merged, ok := pending[command]
+		if !ok {
+			pending[command] = usage
+			continue
+		}
+
+		merged.Calls += usage.Calls
+		merged.Errors += usage.Errors
+		merged.TotalLatencyMS += usage.TotalLatencyMS
+		merged.MaxLatencyMS = max(merged.MaxLatencyMS, usage.MaxLatencyMS)
+	}
+}
+
+// FlushJob flushes on every instance, each only holds the usage it counted itself.
+func (r *Recorder) FlushJob() scheduler.Job {
+	return scheduler.Job{
+		Name:     "command-usage-flush",
+		Interval: FlushInterval,
+		Jitter:   time.Minute * 5,
+		Run:      r.Flush,
+	}
+}
+
+// Summarize adds up the usage every instance flushed since the given time, the most called commands first.
+// Requires an index on flushed_at.
+func (r *Recorder) Summarize(ctx context.Context, since time.Time) ([]CommandStats, error) {
+	documents, err := r.firebaseAdapter.QueryDocuments(ctx, UsageCollection, firebaseAdapter.QueryFilter{Path: "flushed_at", Op: ">=", Value: since})
+	if err != nil {
+		return nil, fmt.Errorf("error querying command usage: %w", err)
+	}
+
+	totals := map[string]*commandTotals{}
+
+	for _, document := range documents {
+		guildID, _ := document["guild_id"].(string)
+
+		commands, ok := document["commands"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		for command, value := range commands {
+			usage, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			summed, ok := totals[command]
+			if !ok {
+				summed = &commandTotals{stats: CommandStats{Command: command}, guilds: make(map[string]bool)}
+				totals[command] = summed
+			}
+
+			summed.stats.add(intField(usage, "calls"), intField(usage, "errors"),
+				time.Duration(intField(usage, "total_latency_ms"))*time.Millisecond, time.Duration(intField(usage, "max_latency_ms"))*time.Millisecond)
+			summed.guilds[guildID] = true
+		}
+	}
+
+	stats := make([]CommandStats, 0, len(totals))
+	for _, command := range totals {
+		command.stats.Guilds = len(command.guilds)
+		stats = append(stats, command.stats)
+	}
+
+	sortStats(stats)
+
+	return stats, nil
+}
+
+func intField(document map[string]interface{}, key string) int64 {
+	value, _ := document[key].(int64)
+	return value
+}
+
+func sortStats(stats []CommandStats) {
+	slices.SortFunc(stats, func(a, b CommandStats) int {
+		return cmp.Or(cmp.Compare(b.Calls, a.Calls), cmp.Compare(a.Command, b.Command))
+	})
+}
+
+// StatsHandler serves the usage counted since the process started as json on GET /usage.
+func StatsHandler(r *Recorder) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /usage", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(w).Encode(r.Stats()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+
+	return mux
+}
@@ -0,0 +1,120 @@
+package botinfo
+
+import (
+	"runtime/debug"
+	"time"
+
+	"salutations/internal/cogs"
+	"salutations/internal/embeds"
+	"salutations/internal/middleware"
+	"salutations/internal/router"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+)
+
+// QueueReporter exposes how many items are waiting to be played, keyed by guild id.
+type QueueReporter interface {
+	QueueDepths() map[string]int
+}
+
+type botInfoRunner struct {
+	logger        *zap.Logger
+	startedAt     time.Time
+	version       string
+	queueReporter QueueReporter
+}
+
+var _ cogs.Cogs = (*botInfoRunner)(nil)
+
+// NewBotInfoRunner falls back to the vcs revision embedded by the go toolchain when version isn't set at build time.
+func NewBotInfoRunner(logger *zap.Logger, startedAt time.Time, version string, queueReporter QueueReporter) (*botInfoRunner, error) {
+	if version == "" || version == "dev" {
+		version = vcsRevision(version)
+	}
+
+	return &botInfoRunner{
+		logger:        logger,
+		startedAt:     startedAt,
+		version:       version,
+		queueReporter: queueReporter,
+	}, nil
+}
+
+func vcsRevision(fallback string) string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return fallback
+	}
+
+	revision, modified := "", false
+
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+
+	if revision == "" {
+		return fallback
+	}
+
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+
+	if modified {
+		revision += "-dirty"
+	}
+
+	return revision
+}
+
+func (b *botInfoRunner) GetCommands() []*discordgo.ApplicationCommand {
+	return []*discordgo.ApplicationCommand{
+		{
+			Name:        "botinfo",
+			Description: "Shows uptime, latency and other diagnostics about the bot",
+		},
+	}
+}
+
+func (b *botInfoRunner) RegisterHandlers(_ *discordgo.Session, r *router.Router) {
+	r.Command("botinfo", b.botInfo, middleware.RateLimit(middleware.NewRateLimiter(middleware.RateLimitConfig{Burst: 3, Refill: time.Second * 10})))
+}
+
+func (b *botInfoRunner) botInfo(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	queueDepths := b.queueReporter.QueueDepths()
+
+	totalQueued := 0
+	for _, depth := range queueDepths {
+		totalQueued += depth
+	}
+
+	session.RLock()
+	voiceConnections := len(session.VoiceConnections)
+	session.RUnlock()
+
+	return session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{
+				embeds.BotInfoEmbed(embeds.BotInfo{
+					Uptime:           time.Since(b.startedAt),
+					GatewayLatency:   session.HeartbeatLatency(),
+					ShardID:          session.ShardID,
+					ShardCount:       session.ShardCount,
+					Guilds:           len(session.State.Guilds),
+					VoiceConnections: voiceConnections,
+					GuildQueueDepth:  queueDepths[interaction.GuildID],
+					TotalQueueDepth:  totalQueued,
+					Version:          b.version,
+				}),
+			},
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+}
@@ -1,8 +1,17 @@
 package cogs
 
-import "github.com/bwmarrin/discordgo"
+import (
+	"salutations/internal/router"
+
+	"github.com/bwmarrin/discordgo"
+)
 
 type Cogs interface {
-	RegisterCommands(s *discordgo.Session) error
+	RegisterHandlers(s *discordgo.Session, r *router.Router)
 	GetCommands() []*discordgo.ApplicationCommand
 }
+
+// Stopper is implemented by cogs with background work that has to be finished before the session is closed.
+type Stopper interface {
+	Stop()
+}
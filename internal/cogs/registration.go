@@ -0,0 +1,119 @@
+package cogs
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// RegisterCommands syncs the combined commands of every cog, since a bulk overwrite replaces all existing commands.
+func RegisterCommands(session *discordgo.Session, guildID string, cogList ...Cogs) (bool, error) {
+	commands := []*discordgo.ApplicationCommand{}
+	for _, cog := range cogList {
+		commands = append(commands, cog.GetCommands()...)
+	}
+
+	return SyncCommands(session, guildID, commands)
+}
+
+// SyncCommands only overwrites the application commands registered for guildID (or globally when empty)
+// if they differ from the given definitions, avoiding needless writes on every reconnect.
+func SyncCommands(session *discordgo.Session, guildID string, commands []*discordgo.ApplicationCommand) (bool, error) {
+	appID := session.State.Application.ID
+
+	existing, err := session.ApplicationCommands(appID, guildID)
+	if err != nil {
+		return false, fmt.Errorf("error fetching existing application commands: %w", err)
+	}
+
+	changed, err := commandsChanged(existing, commands)
+	if err != nil {
+		return false, err
+	}
+
+	if !changed {
+		return false, nil
+	}
+
+	if _, err := session.ApplicationCommandBulkOverwrite(appID, guildID, commands); err != nil {
+		return false, fmt.Errorf("error overwriting application commands: %w", err)
+	}
+
+	return true, nil
+}
+
+func commandsChanged(existing []*discordgo.ApplicationCommand, desired []*discordgo.ApplicationCommand) (bool, error) {
+	if len(existing) != len(desired) {
+		return true, nil
+	}
+
+	existingSignatures := make(map[string]string, len(existing))
+
+	for _, command := range existing {
+		signature, err := commandSignature(command)
+		if err != nil {
+			return false, err
+		}
+
+		existingSignatures[command.Name] = signature
+	}
+
+	for _, command := range desired {
+		signature, err := commandSignature(command)
+		if err != nil {
+			return false, err
+		}
+
+		if existingSignatures[command.Name] != signature {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// commandSignature serializes only the user-defined parts of a command, filling in the defaults
+// Discord applies server side so that freshly fetched commands compare equal to local definitions.
+func commandSignature(command *discordgo.ApplicationCommand) (string, error) {
+	commandType := command.Type
+	if commandType == 0 {
+		commandType = discordgo.ChatApplicationCommand
+	}
+
+	dmPermission := true
+	if command.DMPermission != nil {
+		dmPermission = *command.DMPermission
+	}
+
+	nsfw := false
+	if command.NSFW != nil {
+		nsfw = *command.NSFW
+	}
+
+	normalized := &discordgo.ApplicationCommand{
+		Name:                     command.Name,
+		Description:              command.Description,
+		Type:                     commandType,
+		Options:                  command.Options,
+		DefaultMemberPermissions: command.DefaultMemberPermissions,
+		DMPermission:             &dmPermission,
+		NSFW:                     &nsfw,
+	}
+
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		return "", fmt.Errorf("error marshalling application command %s: %w", command.Name, err)
+	}
+
+	return string(data), nil
+}
+
+// RemoveCommands deletes every application command registered to the given guild.
+func RemoveCommands(session *discordgo.Session, guildID string) error {
+	if _, err := session.ApplicationCommandBulkOverwrite(session.State.Application.ID, guildID, []*discordgo.ApplicationCommand{}); err != nil {
+		return fmt.Errorf("error removing application commands: %w", err)
+	}
+
+	return nil
+}
@@ -2,10 +2,27 @@ package embeds
 
 import (
 	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"salutations/internal/analytics"
+	"salutations/internal/i18n"
+	util "salutations/pkg/util"
 
 	"github.com/bwmarrin/discordgo"
 )
 
+const (
+	PaginationComponentPrefix string = "pagination"
+	PaginationFirst           string = "first"
+	PaginationPrevious        string = "prev"
+	PaginationNext            string = "next"
+	PaginationLast            string = "last"
+)
+
 func ErrorMessageEmbed(msg string) *discordgo.MessageEmbed {
 	return &discordgo.MessageEmbed{
 		Title:       "❌ **Invalid usage**",
@@ -37,6 +54,55 @@ func SuccessfulAudioFileUploadEmbed(memberCreatedFor *discordgo.Member, memberCr
 	}
 }
 
+// WithSharedMembers notes on an upload embed who else the voicelines were given to, returning the same embed.
+func WithSharedMembers(embed *discordgo.MessageEmbed, memberIDs []string) *discordgo.MessageEmbed {
+	if len(memberIDs) == 0 {
+		return embed
+	}
+
+	mentions := make([]string, 0, len(memberIDs))
+	for _, memberID := range memberIDs {
+		mentions = append(mentions, fmt.Sprintf("<@%s>", memberID))
+	}
+
+	// Zip upload pages slice one shared list of fields, clipping keeps the append from writing into the next page
+	embed.Fields = append(slices.Clip(embed.Fields), &discordgo.MessageEmbedField{
+		Name:  "Also added for",
+		Value: strings.Join(mentions, " "),
+	})
+
+	return embed
+}
+
+// WithExpiry notes on an upload embed when the voicelines will be archived, returning the same embed.
+func WithExpiry(embed *discordgo.MessageEmbed, expiresAt time.Time) *discordgo.MessageEmbed {
+	if expiresAt.IsZero() {
+		return embed
+	}
+
+	embed.Fields = append(slices.Clip(embed.Fields), &discordgo.MessageEmbedField{
+		Name:  "Expires",
+		Value: util.RelativeTimestamp(expiresAt) + ", then it's archived",
+	})
+
+	return embed
+}
+
+// WithStorageUsage notes on an upload embed how much of the guild's storage quota is used, returning the same embed.
+// Nothing is noted when quota is zero.
+func WithStorageUsage(embed *discordgo.MessageEmbed, used int64, quota int64) *discordgo.MessageEmbed {
+	if quota == 0 {
+		return embed
+	}
+
+	embed.Fields = append(slices.Clip(embed.Fields), &discordgo.MessageEmbedField{
+		Name:  "Storage used",
+		Value: fmt.Sprintf("%s / %s", util.FormatBytes(used), util.FormatBytes(quota)),
+	})
+
+	return embed
+}
+
 func SuccessfulAudioZipUploadEmbeds(memberCreatedFor *discordgo.Member, memberCreatedBy *discordgo.Member, audioType string, urls []string) []*discordgo.MessageEmbed {
 	embedFields := []*discordgo.MessageEmbedField{}
 
@@ -68,9 +134,9 @@ func SuccessfulAudioZipUploadEmbeds(memberCreatedFor *discordgo.Member, memberCr
 	return embedList
 }
 
-func UnexpectedErrorEmbed() *discordgo.MessageEmbed {
+func UnexpectedErrorEmbed(language i18n.Language) *discordgo.MessageEmbed {
 	return &discordgo.MessageEmbed{
-		Title: "Oops something went wrong, please try again later!",
+		Title: i18n.T(language, i18n.UnexpectedError),
 		Color: 0x992D22,
 		Thumbnail: &discordgo.MessageEmbedThumbnail{
 			URL: "https://media.giphy.com/media/l3vR7SWnEv6mmhS0g/giphy.gif",
@@ -78,34 +144,26 @@ func UnexpectedErrorEmbed() *discordgo.MessageEmbed {
 	}
 }
 
-func GetPaginationComponent(disableStart bool, disablePrevious bool, disableNext bool, disableFinish bool) []discordgo.MessageComponent {
+// GetPaginationComponent builds the page buttons of a listing showing currentPage, every button carries the listing's
+// context from base along with its direction and the page it leads to.
+func GetPaginationComponent(base util.CustomID, currentPage int, totalPages int) []discordgo.MessageComponent {
+	button := func(label string, style discordgo.ButtonStyle, direction string, page int, disabled bool) discordgo.Button {
+		customID := base
+		customID.Action = PaginationComponentPrefix
+		customID.Args = []string{direction, strconv.Itoa(page)}
+
+		return discordgo.Button{Label: label, Style: style, CustomID: customID.Encode(), Disabled: disabled}
+	}
+
+	firstPage, lastPage := currentPage == 0, currentPage >= totalPages-1
+
 	return []discordgo.MessageComponent{
 		discordgo.ActionsRow{
 			Components: []discordgo.MessageComponent{
-				discordgo.Button{
-					Label:    "|<",
-					Style:    discordgo.SuccessButton,
-					CustomID: "first",
-					Disabled: disableStart,
-				},
-				discordgo.Button{
-					Label:    "<",
-					Style:    discordgo.PrimaryButton,
-					CustomID: "prev",
-					Disabled: disablePrevious,
-				},
-				discordgo.Button{
-					Label:    ">",
-					Style:    discordgo.PrimaryButton,
-					CustomID: "next",
-					Disabled: disableNext,
-				},
-				discordgo.Button{
-					Label:    ">|",
-					Style:    discordgo.SuccessButton,
-					CustomID: "last",
-					Disabled: disableFinish,
-				},
+				button("|<", discordgo.SuccessButton, PaginationFirst, 0, firstPage),
+				button("<", discordgo.PrimaryButton, PaginationPrevious, max(currentPage-1, 0), firstPage),
+				button(">", discordgo.PrimaryButton, PaginationNext, min(currentPage+1, totalPages-1), lastPage),
+				button(">|", discordgo.SuccessButton, PaginationLast, totalPages-1, lastPage),
 			},
 		},
 	}
@@ -127,28 +185,60 @@ func NoDataForMemberEmbed(audioType string, memberName string) *discordgo.Messag
 	}
 }
 
-func GetSuccessfulAudioRetrievalEmbeds(member *discordgo.Member, audioType string, urls []string) []*discordgo.MessageEmbed {
-	embedFields := []*discordgo.MessageEmbedField{}
+// maxTranscriptLength keeps a long clip's transcript from crowding out the rest of a listing
+const maxTranscriptLength = 200
 
-	for i, url := range urls {
-		embedFields = append(embedFields, &discordgo.MessageEmbedField{
-			Name:  "",
-			Value: fmt.Sprintf("`%d:` [%s #%d](%s)", i+1, member.User.Username, i+1, url),
-		})
+// transcriptText quotes a voiceline's transcript on its own line, empty for clips that were never transcribed.
+func transcriptText(transcript string) string {
+	if transcript == "" {
+		return ""
+	}
+
+	if runes := []rune(transcript); len(runes) > maxTranscriptLength {
+		transcript = string(runes[:maxTranscriptLength]) + "..."
 	}
 
+	return "\n> 💬 " + transcript
+}
+
+// ListedVoiceline is one of a member's tracks as shown by /voicelines.
+type ListedVoiceline struct {
+	URL        string
+	ShortID    string
+	Transcript string
+	// WaveformURL is the track's waveform thumbnail, empty when it doesn't have one
+	WaveformURL string
+}
+
+// GetSuccessfulAudioRetrievalEmbeds lists the member's voicelines four to a page. A page's image is the waveform of
+// its first voiceline that has one, which is marked in the list.
+func GetSuccessfulAudioRetrievalEmbeds(member *discordgo.Member, audioType string, voicelines []ListedVoiceline) []*discordgo.MessageEmbed {
 	embedList := []*discordgo.MessageEmbed{}
 
-	for i := 0; i < len(urls); i += 4 {
-		endBound := min(len(embedFields), i+4)
-		embedList = append(embedList, &discordgo.MessageEmbed{
+	for i := 0; i < len(voicelines); i += 4 {
+		embed := &discordgo.MessageEmbed{
 			Title: fmt.Sprintf("%s's Voiceline %ss", member.User.Username, audioType),
 			Color: 0x67e9ff,
 			Thumbnail: &discordgo.MessageEmbedThumbnail{
 				URL: member.AvatarURL(""),
 			},
-			Fields: embedFields[i:endBound],
-		})
+		}
+
+		for j, voiceline := range voicelines[i:min(len(voicelines), i+4)] {
+			value := fmt.Sprintf("`%d:` [%s #%d](%s) · `%s`", i+j+1, member.User.Username, i+j+1, voiceline.URL, voiceline.ShortID)
+
+			if embed.Image == nil && voiceline.WaveformURL != "" {
+				embed.Image = &discordgo.MessageEmbedImage{URL: voiceline.WaveformURL}
+				value += " · 〰️"
+			}
+
+			embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+				Name:  "",
+				Value: value + transcriptText(voiceline.Transcript),
+			})
+		}
+
+		embedList = append(embedList, embed)
 	}
 
 	return embedList
@@ -156,10 +246,16 @@ func GetSuccessfulAudioRetrievalEmbeds(member *discordgo.Member, audioType strin
 
 func HelpMenuEmbed() *discordgo.MessageEmbed {
 	commandsToDescription := map[string]string{
-		"📽️ Upload":    "Upload an outro/intro voiceline (.zip, .mp3, .m4a) for a given user",
-		"🎤 Voicelines": "View the intro/outro voicelines for a given user",
-		"🟩 Whitelist":  "Remove yourself from the blacklist",
-		"🚫 Blacklist":  "Adds you to the blacklist, preventing you from receiving voicelines",
+		"📽️ Upload":       "Upload an outro/intro voiceline (.zip, .mp3, .m4a) for a given user, attached or from a message link",
+		"🎤 Voicelines":    "View the intro/outro voicelines for a given user",
+		"🟩 Whitelist":     "Remove yourself from the blacklist",
+		"🚫 Blacklist":     "Adds you to the blacklist, preventing you from receiving voicelines",
+		"📦 Reclaim":       "Restore voicelines archived after you left a server",
+		"🎧 My Voicelines": "Listen to, weight, pin, reorder, delete or turn off your own voicelines",
+		"🎰 Roulette":      "Play the intro of a random member in your voice channel",
+		"📚 Library":       "Share your voicelines or import ones others have shared",
+		"🎶 Queue":         "See what is playing and what is waiting to play",
+		"✨ Effects":       "Make one of your voicelines play nightcore, slowed or robotic",
 	}
 
 	embed := &discordgo.MessageEmbed{
@@ -178,13 +274,25 @@ func HelpMenuEmbed() *discordgo.MessageEmbed {
 	return embed
 }
 
-func AlreadyOnBlacklistEmbed(member *discordgo.Member) *discordgo.MessageEmbed {
+// blacklistScopeText describes which voicelines the type option of /blacklist and /whitelist covers.
+func blacklistScopeText(language i18n.Language, audioType string) string {
+	switch audioType {
+	case "intro":
+		return i18n.T(language, i18n.BlacklistScopeIntros)
+	case "outro":
+		return i18n.T(language, i18n.BlacklistScopeOutros)
+	default:
+		return i18n.T(language, i18n.BlacklistScopeBoth)
+	}
+}
+
+func AlreadyOnBlacklistEmbed(language i18n.Language, member *discordgo.Member, audioType string) *discordgo.MessageEmbed {
 	return &discordgo.MessageEmbed{
-		Title: fmt.Sprintf("%s is already on the blacklist!", member.User.Username),
+		Title: i18n.T(language, i18n.AlreadyBlacklistedTitle, member.User.Username, blacklistScopeText(language, audioType)),
 		Color: 0x206694,
 		Fields: []*discordgo.MessageEmbedField{
 			{
-				Value: "To remove yourself, use `/whitelist`",
+				Value: i18n.T(language, i18n.AlreadyBlacklistedHint),
 			},
 		},
 		Thumbnail: &discordgo.MessageEmbedThumbnail{
@@ -193,13 +301,13 @@ func AlreadyOnBlacklistEmbed(member *discordgo.Member) *discordgo.MessageEmbed {
 	}
 }
 
-func AddedToBlacklistEmbed(member *discordgo.Member) *discordgo.MessageEmbed {
+func AddedToBlacklistEmbed(language i18n.Language, member *discordgo.Member, audioType string) *discordgo.MessageEmbed {
 	return &discordgo.MessageEmbed{
-		Title: fmt.Sprintf("%s has been added to the blacklist!", member.User.Username),
+		Title: i18n.T(language, i18n.BlacklistedTitle, member.User.Username, blacklistScopeText(language, audioType)),
 		Color: 0x67e9ff,
 		Fields: []*discordgo.MessageEmbedField{
 			{
-				Value: "You will no longer be greeted with a voiceline when joining a voice channel, if you'd like to undo this use `/whitelist`",
+				Value: i18n.T(language, i18n.BlacklistedHint, blacklistScopeText(language, audioType)),
 			},
 		},
 		Thumbnail: &discordgo.MessageEmbedThumbnail{
@@ -208,13 +316,13 @@ func AddedToBlacklistEmbed(member *discordgo.Member) *discordgo.MessageEmbed {
 	}
 }
 
-func NotOnBlacklistEmbed(member *discordgo.Member) *discordgo.MessageEmbed {
+func NotOnBlacklistEmbed(language i18n.Language, member *discordgo.Member, audioType string) *discordgo.MessageEmbed {
 	return &discordgo.MessageEmbed{
-		Title: fmt.Sprintf("%s is not on the blacklist", member.User.Username),
+		Title: i18n.T(language, i18n.NotBlacklistedTitle, member.User.Username, blacklistScopeText(language, audioType)),
 		Color: 0x206694,
 		Fields: []*discordgo.MessageEmbedField{
 			{
-				Value: "To add yourself to the blacklist, use `/blacklist`",
+				Value: i18n.T(language, i18n.NotBlacklistedHint),
 			},
 		},
 		Thumbnail: &discordgo.MessageEmbedThumbnail{
@@ -223,13 +331,13 @@ func NotOnBlacklistEmbed(member *discordgo.Member) *discordgo.MessageEmbed {
 	}
 }
 
-func RemovedFromBlacklistEmbed(member *discordgo.Member) *discordgo.MessageEmbed {
+func RemovedFromBlacklistEmbed(language i18n.Language, member *discordgo.Member, audioType string) *discordgo.MessageEmbed {
 	return &discordgo.MessageEmbed{
-		Title: fmt.Sprintf("%s has been removed from the blacklist", member.User.Username),
+		Title: i18n.T(language, i18n.WhitelistedTitle, member.User.Username, blacklistScopeText(language, audioType)),
 		Color: 0x67e9ff,
 		Fields: []*discordgo.MessageEmbedField{
 			{
-				Value: "You will now receive voicelines, if you'd like to undo this use `/blacklist`",
+				Value: i18n.T(language, i18n.WhitelistedHint, blacklistScopeText(language, audioType)),
 			},
 		},
 		Thumbnail: &discordgo.MessageEmbedThumbnail{
@@ -238,7 +346,7 @@ func RemovedFromBlacklistEmbed(member *discordgo.Member) *discordgo.MessageEmbed
 	}
 }
 
-func AddSelectMenu(components []discordgo.MessageComponent, userID string, collection string, optionValues map[string]string) ([]discordgo.MessageComponent, error) {
+func AddSelectMenu(components []discordgo.MessageComponent, customID string, optionValues map[string]string) ([]discordgo.MessageComponent, error) {
 	options := []discordgo.SelectMenuOption{}
 
 	for key, value := range optionValues {
@@ -248,7 +356,7 @@ func AddSelectMenu(components []discordgo.MessageComponent, userID string, colle
 	minValues := 1
 
 	selectMenu := &discordgo.SelectMenu{
-		CustomID:  fmt.Sprintf("%s|%s", userID, collection),
+		CustomID:  customID,
 		MenuType:  discordgo.StringSelectMenu,
 		Options:   options,
 		MaxValues: len(options),
@@ -269,6 +377,38 @@ func AddSelectMenu(components []discordgo.MessageComponent, userID string, colle
 	return messageComponent, nil
 }
 
+// DeleteMenuComponents pairs a delete select menu, which can be emptied to unpick a page, with the button that confirms
+// every pick so far.
+func DeleteMenuComponents(customID string, options []discordgo.SelectMenuOption, confirmID string, selected int) []discordgo.MessageComponent {
+	minValues := 0
+
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.SelectMenu{
+					CustomID:    customID,
+					MenuType:    discordgo.StringSelectMenu,
+					Placeholder: "Pick voicelines to delete",
+					Options:     options,
+					MinValues:   &minValues,
+					MaxValues:   len(options),
+				},
+			},
+		},
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    fmt.Sprintf("Delete %d selected", selected),
+					Style:    discordgo.DangerButton,
+					CustomID: confirmID,
+					Disabled: selected == 0,
+					Emoji:    &discordgo.ComponentEmoji{Name: "🗑️"},
+				},
+			},
+		},
+	}
+}
+
 func DeleteCompletedSuccessEmbed(amountDeleted int, member *discordgo.Member, memberRequester *discordgo.Member) *discordgo.MessageEmbed {
 	return &discordgo.MessageEmbed{
 		Title: fmt.Sprintf("%d Voicelines have been deleted for %s", amountDeleted, member.User.Username),
@@ -287,3 +427,1073 @@ func DeleteCompletedSuccessEmbed(amountDeleted int, member *discordgo.Member, me
 		},
 	}
 }
+
+func CooldownEmbed(commandName string, retryAfter time.Duration) *discordgo.MessageEmbed {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+
+	return &discordgo.MessageEmbed{
+		Title:       "⏳ Slow down a little!",
+		Description: fmt.Sprintf("You're using `/%s` a bit too quickly, please try again in **%d second(s)** 😊", commandName, seconds),
+		Color:       0x206694,
+	}
+}
+
+func AdminActionEmbed(title string, description string) *discordgo.MessageEmbed {
+	return &discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("🛠️ %s", title),
+		Description: description,
+		Color:       0x67e9ff,
+	}
+}
+
+func AdminGuildsEmbed(guilds []*discordgo.Guild) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title: fmt.Sprintf("🛠️ Connected to %d guilds", len(guilds)),
+		Color: 0x67e9ff,
+	}
+
+	// Discord only allows 25 fields per embed
+	for _, guild := range guilds[:min(len(guilds), 25)] {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   guild.Name,
+			Value:  fmt.Sprintf("`%s` • %d members", guild.ID, guild.MemberCount),
+			Inline: true,
+		})
+	}
+
+	if len(guilds) > 25 {
+		embed.Footer = &discordgo.MessageEmbedFooter{
+			Text: fmt.Sprintf("and %d more...", len(guilds)-25),
+		}
+	}
+
+	return embed
+}
+
+func AdminUsageEmbed(stats []analytics.CommandStats, days int) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title: fmt.Sprintf("🛠️ Command usage over the last %d days", days),
+		Color: 0x67e9ff,
+	}
+
+	if len(stats) == 0 {
+		embed.Description = "No commands have been used yet"
+		return embed
+	}
+
+	// Discord only allows 25 fields per embed
+	for _, command := range stats[:min(len(stats), 25)] {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   "/" + command.Command,
+			Value:  fmt.Sprintf("**%d** calls • %d guilds\n%s avg • %d errors", command.Calls, command.Guilds, command.AverageLatency().Round(time.Millisecond), command.Errors),
+			Inline: true,
+		})
+	}
+
+	if len(stats) > 25 {
+		embed.Footer = &discordgo.MessageEmbedFooter{
+			Text: fmt.Sprintf("and %d more...", len(stats)-25),
+		}
+	}
+
+	return embed
+}
+
+func GuildStatsEmbed(guild *discordgo.Guild, voicelines int, storageBytes int64, storageQuota int64, greetingsThisWeek int64, skippedThisWeek int64, topUploaderID string, topUploaderCount int, blacklisted int) *discordgo.MessageEmbed {
+	topUploader := "Nobody yet"
+	if topUploaderID != "" {
+		topUploader = fmt.Sprintf("<@%s> (%d uploads)", topUploaderID, topUploaderCount)
+	}
+
+	return &discordgo.MessageEmbed{
+		Title: fmt.Sprintf("📊 %s's Statistics", guild.Name),
+		Color: 0x67e9ff,
+		Thumbnail: &discordgo.MessageEmbedThumbnail{
+			URL: guild.IconURL(""),
+		},
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "🎤 Voicelines Stored", Value: fmt.Sprintf("%d", voicelines), Inline: true},
+			{Name: "💾 Storage Used", Value: fmt.Sprintf("%s / %s", util.FormatBytes(storageBytes), util.FormatBytes(storageQuota)), Inline: true},
+			{Name: "👋 Greetings This Week", Value: fmt.Sprintf("%d", greetingsThisWeek), Inline: true},
+			{Name: "🏆 Top Uploader", Value: topUploader, Inline: true},
+			{Name: "🚫 Blacklisted Members", Value: fmt.Sprintf("%d", blacklisted), Inline: true},
+			{Name: "🔇 Skipped By Caps This Week", Value: fmt.Sprintf("%d", skippedThisWeek), Inline: true},
+		},
+	}
+}
+
+type BotInfo struct {
+	Uptime           time.Duration
+	GatewayLatency   time.Duration
+	ShardID          int
+	ShardCount       int
+	Guilds           int
+	VoiceConnections int
+	GuildQueueDepth  int
+	TotalQueueDepth  int
+	Version          string
+}
+
+func BotInfoEmbed(info BotInfo) *discordgo.MessageEmbed {
+	shardCount := max(info.ShardCount, 1)
+
+	return &discordgo.MessageEmbed{
+		Title: "🤖 Melodic Salutation's Diagnostics",
+		Color: 0x67e9ff,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "⏱️ Uptime", Value: info.Uptime.Truncate(time.Second).String(), Inline: true},
+			{Name: "📶 Gateway Latency", Value: info.GatewayLatency.Truncate(time.Millisecond).String(), Inline: true},
+			{Name: "🧩 Shard", Value: fmt.Sprintf("%d / %d", info.ShardID, shardCount), Inline: true},
+			{Name: "🏠 Guilds", Value: fmt.Sprintf("%d", info.Guilds), Inline: true},
+			{Name: "🔊 Voice Connections", Value: fmt.Sprintf("%d", info.VoiceConnections), Inline: true},
+			{Name: "🎶 Queued Voicelines", Value: fmt.Sprintf("%d here • %d total", info.GuildQueueDepth, info.TotalQueueDepth), Inline: true},
+		},
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: fmt.Sprintf("Version %s", info.Version),
+		},
+	}
+}
+
+type VoiceDebug struct {
+	DryRun           bool
+	SessionChannelID string
+	SessionReady     bool
+	HasPlayer        bool
+	PlayerChannelID  string
+	VoiceState       string
+	Queue            []string
+	HasStream        bool
+	StreamFinished   bool
+	PlaybackPosition time.Duration
+	LastError        string
+	LastErrorAt      time.Time
+	// LastLatency is how long the last greeting took to start after the member joined or left, zero before any has
+	LastLatency time.Duration
+	// VoiceRegion is empty until Discord has said which voice server the connection is on
+	VoiceRegion   string
+	VoiceEndpoint string
+	// ProbeRTT and ProbeLoss are measured against the voice server over the last Probes probes
+	ProbeRTT  time.Duration
+	ProbeLoss float64
+	Probes    int
+	// PlaybackLag is how far behind real time the last clip finished
+	PlaybackLag     time.Duration
+	Reconnects      int
+	LastReconnectAt time.Time
+}
+
+func channelMentionOrNone(channelID string) string {
+	if channelID == "" {
+		return "None"
+	}
+
+	return fmt.Sprintf("<#%s>", channelID)
+}
+
+func VoiceDebugEmbed(debug VoiceDebug) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title: "🔧 Voice Debug",
+		Color: 0x67e9ff,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Voice Connection", Value: fmt.Sprintf("%s • ready: `%t`", channelMentionOrNone(debug.SessionChannelID), debug.SessionReady), Inline: true},
+			{Name: "Dry Run", Value: fmt.Sprintf("`%t`", debug.DryRun), Inline: true},
+		},
+	}
+
+	if !debug.HasPlayer {
+		embed.Description = "There is no player for this server, the bot will join on the next voice channel event"
+		return embed
+	}
+
+	queue := "Empty"
+	if len(debug.Queue) > 0 {
+		queue = ""
+		for i, item := range debug.Queue[:min(len(debug.Queue), 10)] {
+			queue += fmt.Sprintf("%d. `%s`\n", i+1, item)
+		}
+
+		if len(debug.Queue) > 10 {
+			queue += fmt.Sprintf("and %d more...", len(debug.Queue)-10)
+		}
+	}
+
+	stream := "None"
+	if debug.HasStream {
+		stream = fmt.Sprintf("position `%s` • finished: `%t`", debug.PlaybackPosition.Truncate(time.Millisecond), debug.StreamFinished)
+	}
+
+	latency := "None yet"
+	if debug.LastLatency > 0 {
+		latency = fmt.Sprintf("`%s`", debug.LastLatency.Truncate(time.Millisecond))
+	}
+
+	lastError := "None"
+	if debug.LastError != "" {
+		lastError = fmt.Sprintf("%s\n```%s```", util.RelativeTimestamp(debug.LastErrorAt), debug.LastError)
+	}
+
+	voiceServer := "Unknown"
+	if debug.VoiceRegion != "" {
+		voiceServer = fmt.Sprintf("`%s` (`%s`)", debug.VoiceRegion, debug.VoiceEndpoint)
+	}
+
+	quality := "Not probed yet"
+	if debug.Probes > 0 {
+		quality = fmt.Sprintf("rtt `%s` • loss `%.0f%%` over %d probes\nplayback lag `%s`", debug.ProbeRTT.Truncate(time.Millisecond), debug.ProbeLoss*100, debug.Probes, debug.PlaybackLag.Truncate(time.Millisecond))
+	}
+
+	reconnects := "None"
+	if debug.Reconnects > 0 {
+		reconnects = fmt.Sprintf("%d, last %s", debug.Reconnects, util.RelativeTimestamp(debug.LastReconnectAt))
+	}
+
+	embed.Fields = append(embed.Fields,
+		&discordgo.MessageEmbedField{Name: "Player Channel", Value: channelMentionOrNone(debug.PlayerChannelID), Inline: true},
+		&discordgo.MessageEmbedField{Name: "Voice Server", Value: voiceServer, Inline: true},
+		&discordgo.MessageEmbedField{Name: "Connection Quality", Value: quality, Inline: true},
+		&discordgo.MessageEmbedField{Name: "Quality Reconnects", Value: reconnects, Inline: true},
+		&discordgo.MessageEmbedField{Name: "Voice State", Value: fmt.Sprintf("`%s`", debug.VoiceState), Inline: true},
+		&discordgo.MessageEmbedField{Name: "Stream", Value: stream, Inline: true},
+		&discordgo.MessageEmbedField{Name: "Last Greeting Latency", Value: latency, Inline: true},
+		&discordgo.MessageEmbedField{Name: fmt.Sprintf("Queue (%d)", len(debug.Queue)), Value: queue},
+		&discordgo.MessageEmbedField{Name: "Last Error", Value: lastError},
+	)
+
+	// A player that thinks it's playing with nothing streaming is the usual cause of a silent bot
+	if debug.VoiceState == "PLAYING" && (!debug.HasStream || debug.StreamFinished) {
+		embed.Color = 0xff0000
+		embed.Footer = &discordgo.MessageEmbedFooter{Text: "⚠️ The player is marked as playing but no stream is active"}
+	}
+
+	return embed
+}
+
+func SetupEmbed() *discordgo.MessageEmbed {
+	return &discordgo.MessageEmbed{
+		Title:       "**👋 Thanks for adding Melodic Salutations!**",
+		Description: "I greet members with an intro when they join a voice channel and send them off with an outro when they leave",
+		Color:       0x67e9ff,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "**📽️ Get Started**", Value: "Use `/upload` to add an intro or outro voiceline (.zip, .mp3, .m4a) for a member"},
+			{Name: "**🚫 Opting Out**", Value: "Anyone can use `/blacklist` to stop receiving voicelines"},
+			{Name: "**🤖 Commands**", Value: "Use `/help` to see everything I can do"},
+		},
+	}
+}
+
+func DepartedMembersEmbed(entries []string) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title: "👋 Departed members",
+		Color: 0x206694,
+	}
+
+	if len(entries) == 0 {
+		embed.Description = "No members with voicelines have left this server"
+		return embed
+	}
+
+	embed.Description = strings.Join(entries[:min(len(entries), 25)], "\n")
+	embed.Footer = &discordgo.MessageEmbedFooter{
+		Text: "Use /departed archive or /departed purge to clean up their voicelines",
+	}
+
+	if len(entries) > 25 {
+		embed.Footer.Text = fmt.Sprintf("and %d more... %s", len(entries)-25, embed.Footer.Text)
+	}
+
+	return embed
+}
+
+func DepartedActionEmbed(action string, memberID string, count int) *discordgo.MessageEmbed {
+	description := fmt.Sprintf("Permanently deleted **%d** voiceline(s) belonging to <@%s>", count, memberID)
+	if action == "archive" {
+		description = fmt.Sprintf("Archived **%d** voiceline(s) belonging to <@%s>, they can restore them with `/reclaim` in any server we share", count, memberID)
+	}
+
+	return &discordgo.MessageEmbed{
+		Title:       "🗃️ Departed member cleaned up",
+		Description: description,
+		Color:       0x67e9ff,
+	}
+}
+
+func ReclaimedVoicelinesEmbed(member *discordgo.Member, count int) *discordgo.MessageEmbed {
+	if count == 0 {
+		return &discordgo.MessageEmbed{
+			Title:       "Nothing to reclaim",
+			Description: "You don't have any archived voicelines",
+			Color:       0x206694,
+		}
+	}
+
+	return &discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("🎉 Welcome back %s!", member.User.Username),
+		Description: fmt.Sprintf("Restored **%d** archived voiceline(s), use `/voicelines` to see them", count),
+		Color:       0x67e9ff,
+		Thumbnail: &discordgo.MessageEmbedThumbnail{
+			URL: member.AvatarURL(""),
+		},
+	}
+}
+
+// OwnVoiceline is one of the calling member's tracks as shown by /myvoicelines.
+type OwnVoiceline struct {
+	URL string
+	// ShortID names the voiceline the same way however the list is ordered
+	ShortID string
+	Weight  int64
+	Pinned  bool
+	// Enabled is false for a track the member has turned off, it stays stored but is never picked
+	Enabled bool
+	// ChainPosition is where the voiceline plays in the member's chain starting from 1, zero when it isn't chained
+	ChainPosition int
+	// ExpiresAt is when the voiceline is archived automatically, zero when it's kept
+	ExpiresAt  time.Time
+	Transcript string
+}
+
+func MyVoicelinesEmbed(member *discordgo.Member, audioType string, voicelines []OwnVoiceline, enabled bool) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title: fmt.Sprintf("🎧 Your %ss", audioType),
+		Color: 0x67e9ff,
+		Thumbnail: &discordgo.MessageEmbedThumbnail{
+			URL: member.AvatarURL(""),
+		},
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: "Use the buttons to turn single voicelines on or off, or /myvoicelines weight, pin, reorder, chain, delete or toggle to manage them",
+		},
+	}
+
+	if !enabled {
+		embed.Description = fmt.Sprintf("⏸️ Your %ss are turned off, use `/myvoicelines toggle` to turn them back on", audioType)
+		embed.Color = 0x206694
+	}
+
+	// Discord only allows 25 fields per embed
+	for i, voiceline := range voicelines[:min(len(voicelines), 25)] {
+		name := fmt.Sprintf("Voiceline %d · %s", i+1, voiceline.ShortID)
+		if voiceline.Pinned {
+			name += " 📌"
+		}
+
+		if voiceline.ChainPosition > 0 {
+			name += fmt.Sprintf(" ⛓️ %d", voiceline.ChainPosition)
+		}
+
+		value := fmt.Sprintf("[Listen](%s) • weight %d", voiceline.URL, voiceline.Weight)
+		if !voiceline.Enabled {
+			value = fmt.Sprintf("[Listen](%s) • ⏸️ off", voiceline.URL)
+		}
+
+		if !voiceline.ExpiresAt.IsZero() {
+			value += " • ⌛ " + util.RelativeTimestamp(voiceline.ExpiresAt)
+		}
+
+		value += transcriptText(voiceline.Transcript)
+
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   name,
+			Value:  value,
+			Inline: true,
+		})
+	}
+
+	return embed
+}
+
+// TrackToggleComponents adds a button per voiceline, customIDs holds each button's custom id in the order the
+// voicelines are listed and enabled whether each is on.
+func TrackToggleComponents(customIDs []string, enabled []bool) []discordgo.MessageComponent {
+	components := []discordgo.MessageComponent{}
+
+	// Discord allows 5 rows of 5 buttons, the same 25 voicelines the embed lists
+	for row := 0; row < min(len(customIDs), 25); row += 5 {
+		buttons := []discordgo.MessageComponent{}
+		for i := row; i < min(row+5, len(customIDs), 25); i++ {
+			style := discordgo.SuccessButton
+			if !enabled[i] {
+				style = discordgo.SecondaryButton
+			}
+
+			buttons = append(buttons, discordgo.Button{
+				Label:    fmt.Sprintf("%d", i+1),
+				Style:    style,
+				CustomID: customIDs[i],
+				Emoji:    &discordgo.ComponentEmoji{Name: "⏯️"},
+			})
+		}
+
+		components = append(components, discordgo.ActionsRow{Components: buttons})
+	}
+
+	return components
+}
+
+func MyVoicelinesUpdatedEmbed(description string) *discordgo.MessageEmbed {
+	return &discordgo.MessageEmbed{
+		Title:       "✅ Voicelines updated",
+		Description: description,
+		Color:       0x67e9ff,
+	}
+}
+
+func DoNotDisturbEmbed(language i18n.Language, enabled bool) *discordgo.MessageEmbed {
+	if enabled {
+		return &discordgo.MessageEmbed{
+			Title:       i18n.T(language, i18n.DoNotDisturbOnTitle),
+			Description: i18n.T(language, i18n.DoNotDisturbOnDescription),
+			Color:       0x67e9ff,
+		}
+	}
+
+	return &discordgo.MessageEmbed{
+		Title:       i18n.T(language, i18n.DoNotDisturbOffTitle),
+		Description: i18n.T(language, i18n.DoNotDisturbOffDescription),
+		Color:       0x67e9ff,
+	}
+}
+
+// LanguageEmbed confirms a /language change, it's written in the language the member will be answered in from now on.
+// automatic is set when they went back to following their Discord client's language.
+func LanguageEmbed(language i18n.Language, automatic bool) *discordgo.MessageEmbed {
+	description := i18n.T(language, i18n.LanguageSetDescription, language.Name())
+	if automatic {
+		description = i18n.T(language, i18n.LanguageAutoDescription)
+	}
+
+	return &discordgo.MessageEmbed{
+		Title:       i18n.T(language, i18n.LanguageUpdatedTitle),
+		Description: description,
+		Color:       0x67e9ff,
+	}
+}
+
+func SettingsUpdatedEmbed(description string) *discordgo.MessageEmbed {
+	return &discordgo.MessageEmbed{
+		Title:       "⚙️ Server settings updated",
+		Description: description,
+		Color:       0x67e9ff,
+	}
+}
+
+func EventModeEndedEmbed() *discordgo.MessageEmbed {
+	return &discordgo.MessageEmbed{
+		Title:       "🎉 The party's over",
+		Description: "Event mode has ended, cooldowns, caps and greetings are back to normal. Start another with `/eventmode on`",
+		Color:       0x67e9ff,
+	}
+}
+
+func RouletteEmbed(memberID string) *discordgo.MessageEmbed {
+	return &discordgo.MessageEmbed{
+		Title:       "🎰 Spinning the roulette...",
+		Description: fmt.Sprintf("and it landed on <@%s>! 🎉", memberID),
+		Color:       0x67e9ff,
+	}
+}
+
+// QueuedClip is a clip waiting in or playing from a guild's queue, MemberID is empty for the bot sound.
+type QueuedClip struct {
+	MemberID  string
+	AudioType string
+	Track     string
+	// Hidden clips are the answer to a /guess round, shown without who they belong to
+	Hidden bool
+}
+
+type GuildQueue struct {
+	NowPlaying *QueuedClip
+	// Remaining is only an estimate until the clip has finished encoding
+	Remaining    time.Duration
+	EncodingDone bool
+	Pending      []QueuedClip
+}
+
+func queuedClipText(clip QueuedClip) string {
+	if clip.Hidden {
+		return fmt.Sprintf("❓ a mystery intro `%s`", clip.Track)
+	}
+
+	if clip.MemberID == "" {
+		return fmt.Sprintf("🔔 %s", clip.Track)
+	}
+
+	return fmt.Sprintf("<@%s>'s %s `%s`", clip.MemberID, clip.AudioType, clip.Track)
+}
+
+func QueueEmbed(queue GuildQueue) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title: "🎶 Voiceline Queue",
+		Color: 0x67e9ff,
+	}
+
+	if queue.NowPlaying == nil && len(queue.Pending) == 0 {
+		embed.Description = "Nothing is playing right now"
+		return embed
+	}
+
+	nowPlaying := "Nothing"
+	if queue.NowPlaying != nil {
+		remaining := util.FormatDuration(queue.Remaining)
+		if !queue.EncodingDone {
+			remaining = "at least " + remaining
+		}
+
+		nowPlaying = fmt.Sprintf("%s • %s left", queuedClipText(*queue.NowPlaying), remaining)
+	}
+
+	pending := "Empty"
+	if len(queue.Pending) > 0 {
+		pending = ""
+		for i, clip := range queue.Pending[:min(len(queue.Pending), 10)] {
+			pending += fmt.Sprintf("%d. %s\n", i+1, queuedClipText(clip))
+		}
+
+		if len(queue.Pending) > 10 {
+			pending += fmt.Sprintf("and %d more...", len(queue.Pending)-10)
+		}
+	}
+
+	embed.Fields = []*discordgo.MessageEmbedField{
+		{Name: "Now Playing", Value: nowPlaying},
+		{Name: fmt.Sprintf("Up Next (%d)", len(queue.Pending)), Value: pending},
+	}
+
+	return embed
+}
+
+func GuessEmbed(endsAt time.Time) *discordgo.MessageEmbed {
+	return &discordgo.MessageEmbed{
+		Title:       "❓ Whose intro is this?",
+		Description: fmt.Sprintf("Listen closely and pick who you think it belongs to, guessing closes <t:%d:R>. Only your first pick counts", endsAt.Unix()),
+		Color:       0x67e9ff,
+	}
+}
+
+// GuessButtons has a button per member that could be the answer, labels are their display names.
+func GuessButtons(customIDs []string, labels []string) []discordgo.MessageComponent {
+	buttons := make([]discordgo.MessageComponent, 0, len(customIDs))
+	for i, customID := range customIDs {
+		buttons = append(buttons, discordgo.Button{
+			Label:    labels[i],
+			Style:    discordgo.PrimaryButton,
+			CustomID: customID,
+		})
+	}
+
+	return []discordgo.MessageComponent{discordgo.ActionsRow{Components: buttons}}
+}
+
+func GuessLockedInEmbed(memberID string) *discordgo.MessageEmbed {
+	return &discordgo.MessageEmbed{
+		Title:       "🔒 Guess locked in",
+		Description: fmt.Sprintf("You guessed <@%s>, the answer is revealed when guessing closes", memberID),
+		Color:       0x67e9ff,
+	}
+}
+
+func GuessResultEmbed(answerID string, winnerIDs []string, guesses int) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title:       "❓ Guessing closed",
+		Description: fmt.Sprintf("That was <@%s>'s intro!", answerID),
+		Color:       0x67e9ff,
+	}
+
+	switch {
+	case guesses == 0:
+		embed.Description += " Nobody guessed this time"
+	case len(winnerIDs) == 0:
+		embed.Description += fmt.Sprintf(" None of the %d guesses were right", guesses)
+	default:
+		mentions := make([]string, 0, len(winnerIDs))
+		for _, winnerID := range winnerIDs {
+			mentions = append(mentions, fmt.Sprintf("<@%s>", winnerID))
+		}
+
+		embed.Description += fmt.Sprintf(" A point each for %s, %d of %d guessed right", strings.Join(mentions, ", "), len(winnerIDs), guesses)
+	}
+
+	embed.Footer = &discordgo.MessageEmbedFooter{Text: "See who's ahead with /guess leaderboard"}
+
+	return embed
+}
+
+type GuessScore struct {
+	MemberID string
+	Points   int
+}
+
+func GuessLeaderboardEmbed(scores []GuessScore) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title: "🏆 Guessing leaderboard",
+		Color: 0x67e9ff,
+	}
+
+	if len(scores) == 0 {
+		embed.Description = "Nobody has guessed right yet, start a round with `/guess play`"
+		return embed
+	}
+
+	lines := make([]string, 0, len(scores))
+	for i, score := range scores {
+		lines = append(lines, fmt.Sprintf("%d. <@%s> • **%d** point(s)", i+1, score.MemberID, score.Points))
+	}
+
+	embed.Description = strings.Join(lines, "\n")
+
+	return embed
+}
+
+func QueueSkipComponent(customID string) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "Skip",
+					Style:    discordgo.SecondaryButton,
+					CustomID: customID,
+					Emoji:    &discordgo.ComponentEmoji{Name: "⏭️"},
+				},
+			},
+		},
+	}
+}
+
+// NowPlayingEmbed leaves the track number out when position is zero, the track was removed before it played.
+func NowPlayingEmbed(memberID string, audioType string, position int) *discordgo.MessageEmbed {
+	description := fmt.Sprintf("🎶 Played <@%s>'s %s", memberID, audioType)
+	if position > 0 {
+		description += fmt.Sprintf(" #%d", position)
+	}
+
+	return &discordgo.MessageEmbed{
+		Description: description,
+		Color:       0x67e9ff,
+	}
+}
+
+func ReportButtonComponent(customID string) []discordgo.MessageComponent {
+	return []discordgo.MessageComponent{
+		discordgo.ActionsRow{
+			Components: []discordgo.MessageComponent{
+				discordgo.Button{
+					Label:    "Report",
+					Style:    discordgo.DangerButton,
+					CustomID: customID,
+					Emoji:    &discordgo.ComponentEmoji{Name: "🚩"},
+				},
+			},
+		},
+	}
+}
+
+func ReportFiledEmbed(count int, alreadyReported int) *discordgo.MessageEmbed {
+	description := fmt.Sprintf("Thanks, %d voiceline(s) were sent to the moderators for review", count)
+	if count == 0 {
+		description = "You've already reported that voiceline, the moderators will get to it"
+	} else if alreadyReported > 0 {
+		description += fmt.Sprintf(", %d you'd already reported were skipped", alreadyReported)
+	}
+
+	return &discordgo.MessageEmbed{
+		Title:       "🚩 Report received",
+		Description: description,
+		Color:       0x67e9ff,
+	}
+}
+
+// ModLogReportEmbed links the reported track when a signed url could be generated for it.
+func ModLogReportEmbed(memberID string, audioType string, trackName string, trackURL string, reportedBy string) *discordgo.MessageEmbed {
+	track := fmt.Sprintf("`%s`", trackName)
+	if trackURL != "" {
+		track = fmt.Sprintf("[%s](%s)", trackName, trackURL)
+	}
+
+	return &discordgo.MessageEmbed{
+		Title: "🚩 Voiceline reported",
+		Color: 0xff0000,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Owner", Value: fmt.Sprintf("<@%s>'s %s", memberID, audioType), Inline: true},
+			{Name: "Reported By", Value: reportedBy, Inline: true},
+			{Name: "Track", Value: track},
+		},
+	}
+}
+
+// PreviewButtons is a row of buttons previewing each voiceline on a page of a listing, labelled from firstNumber.
+func PreviewButtons(customIDs []string, firstNumber int) discordgo.ActionsRow {
+	buttons := []discordgo.MessageComponent{}
+	for i, customID := range customIDs {
+		buttons = append(buttons, discordgo.Button{
+			Label:    fmt.Sprintf("Preview %d", firstNumber+i),
+			Style:    discordgo.SecondaryButton,
+			CustomID: customID,
+			Emoji:    &discordgo.ComponentEmoji{Name: "▶️"},
+		})
+	}
+
+	return discordgo.ActionsRow{Components: buttons}
+}
+
+func PreviewEmbed(channelID string) *discordgo.MessageEmbed {
+	return &discordgo.MessageEmbed{
+		Title:       "▶️ Previewing voiceline",
+		Description: fmt.Sprintf("Queued to play in <#%s>", channelID),
+		Color:       0x67e9ff,
+	}
+}
+
+func ExportEmbed(voicelines int, url string) *discordgo.MessageEmbed {
+	return &discordgo.MessageEmbed{
+		Title:       "📦 Voiceline export ready",
+		Description: fmt.Sprintf("[Download the zip](%s) of this server's %d voiceline(s), the link expires soon so grab it now", url, voicelines),
+		Color:       0x67e9ff,
+	}
+}
+
+type LibraryResult struct {
+	Title       string
+	PublisherID string
+	Imports     int64
+	URL         string
+}
+
+func LibrarySearchEmbed(query string, results []LibraryResult) *discordgo.MessageEmbed {
+	title := "📚 Most popular in the library"
+	if query != "" {
+		title = fmt.Sprintf("📚 Library results for \"%s\"", query)
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title: title,
+		Color: 0x67e9ff,
+	}
+
+	if len(results) == 0 {
+		embed.Description = "Nothing matched, try a different search or publish your own with `/library publish`"
+		return embed
+	}
+
+	for i, result := range results {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  fmt.Sprintf("%d. %s", i+1, result.Title),
+			Value: fmt.Sprintf("[Listen](%s) • by <@%s> • imported %d time(s)", result.URL, result.PublisherID, result.Imports),
+		})
+	}
+
+	embed.Footer = &discordgo.MessageEmbedFooter{Text: "Use the buttons to add a clip to your intros or outros, or report it"}
+
+	return embed
+}
+
+// LibraryResultComponents lays out a row of intro imports, outro imports and reports, one button per result in each.
+func LibraryResultComponents(introIDs []string, outroIDs []string, reportIDs []string) []discordgo.MessageComponent {
+	if len(introIDs) == 0 {
+		return nil
+	}
+
+	row := func(customIDs []string, label string, style discordgo.ButtonStyle) discordgo.ActionsRow {
+		buttons := []discordgo.MessageComponent{}
+		for i, customID := range customIDs {
+			buttons = append(buttons, discordgo.Button{Label: fmt.Sprintf("%s %d", label, i+1), Style: style, CustomID: customID})
+		}
+
+		return discordgo.ActionsRow{Components: buttons}
+	}
+
+	return []discordgo.MessageComponent{
+		row(introIDs, "📥 Intro", discordgo.PrimaryButton),
+		row(outroIDs, "📥 Outro", discordgo.PrimaryButton),
+		row(reportIDs, "🚩", discordgo.DangerButton),
+	}
+}
+
+func LibraryUpdatedEmbed(description string) *discordgo.MessageEmbed {
+	return &discordgo.MessageEmbed{
+		Title:       "📚 Library updated",
+		Description: description,
+		Color:       0x67e9ff,
+	}
+}
+
+type VoicePack struct {
+	Name        string
+	Description string
+	Intros      int
+	Outros      int
+	Installed   bool
+}
+
+func VoicePacksEmbed(packs []VoicePack) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title: "🎁 Voice packs",
+		Color: 0x67e9ff,
+	}
+
+	if len(packs) == 0 {
+		embed.Description = "There aren't any voice packs to install yet"
+		return embed
+	}
+
+	embed.Description = "Installed packs greet members who haven't uploaded their own voicelines, install one with `/voicepack install`"
+
+	for _, pack := range packs {
+		name := pack.Name
+		if pack.Installed {
+			name += " ✅"
+		}
+
+		value := fmt.Sprintf("%d intro(s) • %d outro(s)", pack.Intros, pack.Outros)
+		if pack.Description != "" {
+			value = fmt.Sprintf("%s\n%s", pack.Description, value)
+		}
+
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: name, Value: value})
+	}
+
+	return embed
+}
+
+type RoleStinger struct {
+	RoleID string
+	// Placement describes when it plays relative to the member's own intro
+	Placement string
+}
+
+// RoleStingersEmbed lists the guild's stingers, highest role first since that's the one a member with several hears.
+func RoleStingersEmbed(stingers []RoleStinger) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title: "🎺 Role stingers",
+		Color: 0x67e9ff,
+	}
+
+	if len(stingers) == 0 {
+		embed.Description = "No roles have a stinger yet, add one with `/stinger set`"
+		return embed
+	}
+
+	lines := make([]string, 0, len(stingers))
+	for _, stinger := range stingers {
+		lines = append(lines, fmt.Sprintf("<@&%s> • %s", stinger.RoleID, stinger.Placement))
+	}
+
+	embed.Description = strings.Join(lines, "\n")
+	embed.Footer = &discordgo.MessageEmbedFooter{Text: "Members with several of these roles hear the stinger of their highest one"}
+
+	return embed
+}
+
+func JoinFailureEmbed(channelID string, problem string) *discordgo.MessageEmbed {
+	return &discordgo.MessageEmbed{
+		Title:       "🔇 I couldn't join a voice channel",
+		Description: fmt.Sprintf("Someone in <#%s> wasn't greeted, %s.", channelID, problem),
+		Color:       0xff0000,
+		Footer:      &discordgo.MessageEmbedFooter{Text: "I'll let you know again in an hour if it keeps happening"},
+	}
+}
+
+type ChannelPermissionProblem struct {
+	ChannelID string
+	Missing   []string
+}
+
+// CheckPermsEmbeds pages the voice channels the bot can't greet in, checked is how many voice channels were looked at.
+func CheckPermsEmbeds(checked int, problems []ChannelPermissionProblem) []*discordgo.MessageEmbed {
+	if len(problems) == 0 {
+		return []*discordgo.MessageEmbed{{
+			Title:       "✅ Voice permissions look good",
+			Description: fmt.Sprintf("I can greet members in all %d voice channel(s)", checked),
+			Color:       0x67e9ff,
+		}}
+	}
+
+	embedList := []*discordgo.MessageEmbed{}
+
+	for i := 0; i < len(problems); i += 10 {
+		endBound := min(len(problems), i+10)
+
+		embed := &discordgo.MessageEmbed{
+			Title:       "🔇 Voice permission problems",
+			Description: fmt.Sprintf("I can't greet members in %d of %d voice channel(s)", len(problems), checked),
+			Color:       0xff0000,
+			Footer:      &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("Page %d of %d", i/10+1, (len(problems)+9)/10)},
+		}
+
+		for _, problem := range problems[i:endBound] {
+			embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+				Name:  "",
+				Value: fmt.Sprintf("<#%s> is missing **%s**", problem.ChannelID, strings.Join(problem.Missing, "**, **")),
+			})
+		}
+
+		embedList = append(embedList, embed)
+	}
+
+	return embedList
+}
+
+// ManifestProblem is a row of a manifest import that wasn't imported, Row is its position in the manifest.
+type ManifestProblem struct {
+	Row    int
+	Reason string
+}
+
+// ManifestImportEmbed reports a manifest import, only the first few problems are listed since the attached report
+// has every row.
+func ManifestImportEmbed(imported int, rows int, problems []ManifestProblem) *discordgo.MessageEmbed {
+	const maxListed = 10
+
+	embed := &discordgo.MessageEmbed{
+		Title:       "📥 Manifest imported",
+		Description: fmt.Sprintf("Imported %d of %d row(s), the attached report has the outcome of every row", imported, rows),
+		Color:       0x67e9ff,
+	}
+
+	if len(problems) == 0 {
+		return embed
+	}
+
+	if imported == 0 {
+		embed.Title = "📥 Nothing was imported"
+		embed.Color = 0x992D22
+	}
+
+	for _, problem := range problems[:min(len(problems), maxListed)] {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  "",
+			Value: fmt.Sprintf("Row %d: %s", problem.Row, problem.Reason),
+		})
+	}
+
+	if len(problems) > maxListed {
+		embed.Footer = &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("...and %d more problem(s)", len(problems)-maxListed)}
+	}
+
+	return embed
+}
+
+// ArchivedTrack is a track in a member's archive, AudioType is empty when what it was archived from wasn't recorded.
+type ArchivedTrack struct {
+	ShortID    string
+	AudioType  string
+	ArchivedAt time.Time
+	Size       int64
+}
+
+// ArchiveEmbed lists a page of a member's archived tracks numbered from firstNumber, newest first.
+func ArchiveEmbed(memberID string, tracks []ArchivedTrack, firstNumber int, page int, pages int) *discordgo.MessageEmbed {
+	if len(tracks) == 0 {
+		return &discordgo.MessageEmbed{
+			Title:       "🗄️ Archive",
+			Description: fmt.Sprintf("<@%s> doesn't have any archived voicelines", memberID),
+			Color:       0x67e9ff,
+		}
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       "🗄️ Archive",
+		Description: fmt.Sprintf("<@%s>'s archived voicelines, restore one to add it back to their intros or outros", memberID),
+		Color:       0x67e9ff,
+		Footer:      &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("Page %d of %d", page+1, pages)},
+	}
+
+	for i, track := range tracks {
+		kind := "voiceline"
+		if track.AudioType != "" {
+			kind = track.AudioType
+		}
+
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  "",
+			Value: fmt.Sprintf("`%d` %s `%s` • archived %s • %s", firstNumber+i, kind, track.ShortID, util.RelativeTimestamp(track.ArchivedAt), util.FormatBytes(track.Size)),
+		})
+	}
+
+	return embed
+}
+
+// ArchiveComponents lays out a row of intro restores, outro restores and permanent deletes, one button per track in
+// each, followed by the page buttons when there's more than one page. Deletes are left out when deleteIDs is empty.
+func ArchiveComponents(introIDs []string, outroIDs []string, deleteIDs []string, firstNumber int, previousID string, nextID string, page int, pages int) []discordgo.MessageComponent {
+	row := func(customIDs []string, label string, style discordgo.ButtonStyle) discordgo.ActionsRow {
+		buttons := []discordgo.MessageComponent{}
+		for i, customID := range customIDs {
+			buttons = append(buttons, discordgo.Button{Label: fmt.Sprintf("%s %d", label, firstNumber+i), Style: style, CustomID: customID})
+		}
+
+		return discordgo.ActionsRow{Components: buttons}
+	}
+
+	components := []discordgo.MessageComponent{}
+	if len(introIDs) > 0 {
+		components = append(components, row(introIDs, "♻️ Intro", discordgo.PrimaryButton), row(outroIDs, "♻️ Outro", discordgo.PrimaryButton))
+	}
+
+	if len(deleteIDs) > 0 {
+		components = append(components, row(deleteIDs, "🗑️", discordgo.DangerButton))
+	}
+
+	if pages <= 1 {
+		return components
+	}
+
+	return append(components, discordgo.ActionsRow{
+		Components: []discordgo.MessageComponent{
+			discordgo.Button{Label: "<", Style: discordgo.SecondaryButton, CustomID: previousID, Disabled: page == 0},
+			discordgo.Button{Label: ">", Style: discordgo.SecondaryButton, CustomID: nextID, Disabled: page >= pages-1},
+		},
+	})
+}
+
+// UnplayedVoiceline is a voiceline that hasn't greeted anyone in a while, LastPlayedAt is zero when it never has.
+type UnplayedVoiceline struct {
+	ShortID      string
+	AudioType    string
+	LastPlayedAt time.Time
+	UploadedAt   time.Time
+}
+
+// UnplayedVoicelinesEmbed suggests archiving the member's voicelines that haven't played in months.
+func UnplayedVoicelinesEmbed(memberID string, voicelines []UnplayedVoiceline, months int) *discordgo.MessageEmbed {
+	if len(voicelines) == 0 {
+		return &discordgo.MessageEmbed{
+			Title:       "🧹 All Tidied Up",
+			Description: fmt.Sprintf("<@%s> has no voicelines left that haven't played in a while, thanks!", memberID),
+			Color:       0x67e9ff,
+		}
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       "🧹 Voicelines Nobody's Heard In A While",
+		Description: fmt.Sprintf("<@%s>, these voicelines haven't played in over %d months. Archiving them keeps storage in check, they can be restored from `/archive` any time.", memberID, months),
+		Color:       0x67e9ff,
+	}
+
+	for i, voiceline := range voicelines {
+		played := "never played since it was uploaded " + util.RelativeTimestamp(voiceline.UploadedAt)
+		if !voiceline.LastPlayedAt.IsZero() {
+			played = "last played " + util.RelativeTimestamp(voiceline.LastPlayedAt)
+		}
+
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  "",
+			Value: fmt.Sprintf("`%d` %s `%s` • %s", i+1, voiceline.AudioType, voiceline.ShortID, played),
+		})
+	}
+
+	return embed
+}
+
+// UnplayedVoicelinesComponents is a row with an archive button for each voiceline UnplayedVoicelinesEmbed lists.
+func UnplayedVoicelinesComponents(archiveIDs []string) []discordgo.MessageComponent {
+	if len(archiveIDs) == 0 {
+		return []discordgo.MessageComponent{}
+	}
+
+	buttons := make([]discordgo.MessageComponent, 0, len(archiveIDs))
+	for i, customID := range archiveIDs {
+		buttons = append(buttons, discordgo.Button{Label: fmt.Sprintf("🗄️ Archive %d", i+1), Style: discordgo.SecondaryButton, CustomID: customID})
+	}
+
+	return []discordgo.MessageComponent{discordgo.ActionsRow{Components: buttons}}
+}
@@ -0,0 +1,113 @@
+package encodequeue
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+
+	util "salutations/pkg/util"
+)
+
+// Stats is what the queue has observed since the process started, waits are how long encodes queued for a slot.
+type Stats struct {
+	Limit     int           `json:"limit"`
+	Running   int           `json:"running"`
+	Waiting   int           `json:"waiting"`
+	Started   int64         `json:"started"`
+	Abandoned int64         `json:"abandoned"`
+	TotalWait time.Duration `json:"total_wait"`
+	MaxWait   time.Duration `json:"max_wait"`
+	LastWait  time.Duration `json:"last_wait"`
+}
+
+// Queue caps how many ffmpeg encodes run at once, so a wave of joins across guilds queues up instead of starting an
+// ffmpeg process per greeting and saturating the host. Encodes are let in in the order they arrived.
+type Queue struct {
+	clock util.Clock
+	slots chan struct{}
+	mu    sync.Mutex
+	stats Stats
+}
+
+// New creates a queue running up to limit encodes at once, a limit below one uses the number of CPUs.
+func New(limit int, clock util.Clock) *Queue {
+	if limit < 1 {
+		limit = runtime.NumCPU()
+	}
+
+	return &Queue{
+		clock: clock,
+		slots: make(chan struct{}, limit),
+		stats: Stats{Limit: limit},
+	}
+}
+
+// Acquire waits for a free slot, returning how long that took and a release func the caller must call once its
+// encode has finished. It only fails when ctx is done first.
+func (q *Queue) Acquire(ctx context.Context) (func(), time.Duration, error) {
+	queuedAt := q.clock.Now()
+	q.record(func(stats *Stats) { stats.Waiting++ })
+
+	select {
+	case q.slots <- struct{}{}:
+	case <-ctx.Done():
+		q.record(func(stats *Stats) {
+			stats.Waiting--
+			stats.Abandoned++
+		})
+
+		return nil, q.clock.Now().Sub(queuedAt), ctx.Err()
+	}
+
+	wait := q.clock.Now().Sub(queuedAt)
+	q.record(func(stats *Stats) {
+		stats.Waiting--
+		stats.Running++
+		stats.Started++
+		stats.TotalWait += wait
+		stats.MaxWait = max(stats.MaxWait, wait)
+		stats.LastWait = wait
+	})
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			q.record(func(stats *Stats) { stats.Running-- })
+			<-q.slots
+		})
+	}
+
+	return release, wait, nil
+}
+
+func (q *Queue) record(update func(stats *Stats)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	update(&q.stats)
+}
+
+// Stats returns a snapshot of the queue's stats.
+func (q *Queue) Stats() Stats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.stats
+}
+
+// StatsHandler serves the queue's stats as json on GET /encodes.
+func StatsHandler(q *Queue) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /encodes", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(w).Encode(q.Stats()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+
+	return mux
+}
@@ -0,0 +1,105 @@
+package eventqueue
+
+import (
+	"errors"
+	"hash/fnv"
+	"sync"
+)
+
+var (
+	ErrQueueFull    = errors.New("event queue is full")
+	ErrQueueStopped = errors.New("event queue is stopped")
+)
+
+// Queue hands events from gateway handlers over to workers, so handlers return straight away instead of waiting on
+// firestore or storage. Events published with the same key are handled one at a time in the order they were published.
+type Queue[T any] interface {
+	Publish(key string, event T) error
+	// Start runs handle for every event on the queue's workers, it must only be called once
+	Start(handle func(T))
+	// Stop lets the workers finish the events already queued and waits for them
+	Stop()
+	// Len is how many events are waiting to be handled
+	Len() int
+}
+
+// MemoryQueue is an in-process Queue with one worker per shard, events are sharded by key.
+type MemoryQueue[T any] struct {
+	mu      sync.RWMutex
+	shards  []chan T
+	stopped bool
+	workers sync.WaitGroup
+}
+
+var _ Queue[struct{}] = (*MemoryQueue[struct{}])(nil)
+
+// NewMemoryQueue creates a queue with the given number of workers, each buffering up to buffer events before
+// Publish starts returning ErrQueueFull rather than blocking the gateway.
+func NewMemoryQueue[T any](workers int, buffer int) *MemoryQueue[T] {
+	shards := make([]chan T, max(workers, 1))
+	for i := range shards {
+		shards[i] = make(chan T, buffer)
+	}
+
+	return &MemoryQueue[T]{shards: shards}
+}
+
+func (q *MemoryQueue[T]) shard(key string) chan T {
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+
+	return q.shards[hash.Sum32()%uint32(len(q.shards))]
+}
+
+func (q *MemoryQueue[T]) Publish(key string, event T) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.stopped {
+		return ErrQueueStopped
+	}
+
+	select {
+	case q.shard(key) <- event:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+func (q *MemoryQueue[T]) Start(handle func(T)) {
+	for _, shard := range q.shards {
+		q.workers.Add(1)
+
+		go func() {
+			defer q.workers.Done()
+
+			for event := range shard {
+				handle(event)
+			}
+		}()
+	}
+}
+
+func (q *MemoryQueue[T]) Stop() {
+	q.mu.Lock()
+	if !q.stopped {
+		q.stopped = true
+
+		for _, shard := range q.shards {
+			close(shard)
+		}
+	}
+	q.mu.Unlock()
+
+	q.workers.Wait()
+}
+
+func (q *MemoryQueue[T]) Len() int {
+	length := 0
+	for _, shard := range q.shards {
+		length += len(shard)
+	}
+
+	return length
+}
@@ -0,0 +1,226 @@
+package firebasehelper
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	util "salutations/pkg/util"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// documentWatchRetry is how long to wait before watching a collection again after its watch fails
+const documentWatchRetry = time.Second * 30
+
+type documentKey struct {
+	collection string
+	document   string
+}
+
+type cachedDocument struct {
+	// data is nil for documents that don't exist, so members without a document aren't looked up on every event either
+	data      map[string]interface{}
+	fetchedAt time.Time
+}
+
+// DocumentCache reads documents of the configured collections through an in-memory cache, everything else is passed
+// straight to the adapter it wraps. Writes made through the cache invalidate the document they touched, writes made
+// anywhere else are picked up by Watch, or once the cached copy is older than its collection's TTL when it isn't running.
+type DocumentCache struct {
+	Firebase
+	clock util.Clock
+	ttls  map[string]time.Duration
+	mu    sync.Mutex
+	cache map[documentKey]cachedDocument
+	// generation is bumped by every invalidation, reads that started before one aren't cached since they may predate the write
+	generation uint64
+}
+
+var _ Firebase = (*DocumentCache)(nil)
+
+// NewDocumentCache caches documents of each collection in ttls for its duration, collections without one aren't cached.
+func NewDocumentCache(adapter Firebase, clock util.Clock, ttls map[string]time.Duration) *DocumentCache {
+	return &DocumentCache{
+		Firebase: adapter,
+		clock:    clock,
+		ttls:     ttls,
+		cache:    make(map[documentKey]cachedDocument),
+	}
+}
+
+// GetDocumentFromCollection returns a copy of the cached document, so callers can change it as they would a fresh read.
+func (c *DocumentCache) GetDocumentFromCollection(ctx context.Context, collection string, document string) (map[string]interface{}, error) {
+	ttl, ok := c.ttls[collection]
+	if !ok {
+		return c.Firebase.GetDocumentFromCollection(ctx, collection, document)
+	}
+
+	key := documentKey{collection: collection, document: document}
+
+	c.mu.Lock()
+	cached, hit := c.cache[key]
+	generation := c.generation
+	c.mu.Unlock()
+
+	if hit && c.clock.Now().Sub(cached.fetchedAt) < ttl {
+		if cached.data == nil {
+			return nil, fmt.Errorf("error getting document from collection %w", status.Errorf(codes.NotFound, "document %s/%s not found", collection, document))
+		}
+
+		return cloneDocument(cached.data), nil
+	}
+
+	data, err := c.Firebase.GetDocumentFromCollection(ctx, collection, document)
+	if err != nil && status.Code(err) != codes.NotFound {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if generation == c.generation {
+		c.cache[key] = cachedDocument{data: cloneDocument(data), fetchedAt: c.clock.Now()}
+	}
+	c.mu.Unlock()
+
+	return data, err
+}
+
+func (c *DocumentCache) CreateDocument(ctx context.Context, collection string, document string, data interface{}) error {
+	defer c.Invalidate(collection, document)
+
+	return c.Firebase.CreateDocument(ctx, collection, document, data)
+}
+
+func (c *DocumentCache) UpdateDocument(ctx context.Context, collection string, document string, data map[string]interface{}) error {
+	defer c.Invalidate(collection, document)
+
+	return c.Firebase.UpdateDocument(ctx, collection, document, data)
+}
+
+func (c *DocumentCache) DeleteDocument(ctx context.Context, collection string, document string) error {
+	defer c.Invalidate(collection, document)
+
+	return c.Firebase.DeleteDocument(ctx, collection, document)
+}
+
+func (c *DocumentCache) AcquireLease(ctx context.Context, collection string, document string, holder string, now time.Time, expiresAt time.Time) (bool, error) {
+	defer c.Invalidate(collection, document)
+
+	return c.Firebase.AcquireLease(ctx, collection, document, holder, now, expiresAt)
+}
+
+func (c *DocumentCache) ReleaseLease(ctx context.Context, collection string, document string, holder string) error {
+	defer c.Invalidate(collection, document)
+
+	return c.Firebase.ReleaseLease(ctx, collection, document, holder)
+}
+
+func (c *DocumentCache) AddRef(ctx context.Context, collection string, document string, holder string, revive bool) error {
+	defer c.Invalidate(collection, document)
+
+	return c.Firebase.AddRef(ctx, collection, document, holder, revive)
+}
+
+func (c *DocumentCache) ReleaseRef(ctx context.Context, collection string, document string, holder string) (bool, error) {
+	defer c.Invalidate(collection, document)
+
+	return c.Firebase.ReleaseRef(ctx, collection, document, holder)
+}
+
+// Invalidate drops the cached copy of a document, for writes the cache didn't see.
+func (c *DocumentCache) Invalidate(collection string, document string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	delete(c.cache, documentKey{collection: collection, document: document})
+}
+
+// Watch invalidates documents of the cached collections as they change, so writes made by other processes are seen
+// straight away. It blocks until ctx is done, restarting the watch of a collection that fails.
+func (c *DocumentCache) Watch(ctx context.Context, logger *zap.Logger) {
+	var wg sync.WaitGroup
+
+	for collection := range c.ttls {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			c.watchCollection(ctx, logger, collection)
+		}()
+	}
+
+	wg.Wait()
+}
+
+func (c *DocumentCache) watchCollection(ctx context.Context, logger *zap.Logger, collection string) {
+	invalidate := func(document string) {
+		c.Invalidate(collection, document)
+	}
+
+	for {
+		// A restarted watch starts with every existing document, which drops whatever was missed while it was down
+		err := c.Firebase.WatchCollection(ctx, collection, invalidate)
+		if ctx.Err() != nil {
+			return
+		}
+
+		logger.Warn("document cache watch stopped, cached documents will expire on their own until it's restarted", zap.Error(err), zap.String("collection", collection))
+
+		retry := make(chan struct{})
+		c.clock.AfterFunc(documentWatchRetry, func() { close(retry) })
+
+		select {
+		case <-retry:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// PurgeCache drops every cached document, returning how many there were.
+func (c *DocumentCache) PurgeCache() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	purged := len(c.cache)
+	c.generation++
+	c.cache = make(map[documentKey]cachedDocument)
+
+	return purged
+}
+
+// cloneDocument deep copies the maps and slices of a document, the values inside them are left shared since
+// firestore only returns immutable ones.
+func cloneDocument(data map[string]interface{}) map[string]interface{} {
+	if data == nil {
+		return nil
+	}
+
+	return cloneValue(data).(map[string]interface{})
+}
+
+func cloneValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		clone := make(map[string]interface{}, len(value))
+		for key, elem := range value {
+			clone[key] = cloneValue(elem)
+		}
+
+		return clone
+	case []interface{}:
+		clone := make([]interface{}, len(value))
+		for i, elem := range value {
+			clone[i] = cloneValue(elem)
+		}
+
+		return clone
+	default:
+		return value
+	}
+}
@@ -1,82 +1,251 @@
 package firebasehelper
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
+	"slices"
+	"strings"
 	"time"
 
+	util "salutations/pkg/util"
+
 	fs "cloud.google.com/go/firestore"
+	"cloud.google.com/go/firestore/apiv1/firestorepb"
 	gs "cloud.google.com/go/storage"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type Firebase interface {
+	AcquireLease(ctx context.Context, collection string, document string, holder string, now time.Time, expiresAt time.Time) (bool, error)
+	ReleaseLease(ctx context.Context, collection string, document string, holder string) error
+	AddRef(ctx context.Context, collection string, document string, holder string, revive bool) error
+	ReleaseRef(ctx context.Context, collection string, document string, holder string) (bool, error)
+	ChargeStorage(ctx context.Context, usageCollection string, chargeCollection string, object string, charge StorageCharge, guildQuota int64, memberQuota int64) (StorageUsage, error)
+	RefundStorage(ctx context.Context, usageCollection string, chargeCollection string, object string) error
 	CreateDocument(ctx context.Context, collection string, document string, data interface{}) error
 	DeleteDocument(ctx context.Context, collection string, document string) error
 	CloneFileFromStorage(ctx context.Context, bucketName string, sourceObject string, destinationObject string) error
 	DeleteFileFromStorage(ctx context.Context, bucketName string, objectName string) error
 	DownloadFileBytes(ctx context.Context, bucketName string, objectName string) (io.Reader, error)
 	GetDocumentFromCollection(ctx context.Context, collection string, document string) (map[string]interface{}, error)
+	GetDocumentsFromCollection(ctx context.Context, collection string) (map[string]map[string]interface{}, error)
+	GetDocumentsByID(ctx context.Context, collection string, documents []string) (map[string]map[string]interface{}, error)
+	CountDocuments(ctx context.Context, collection string, filters ...QueryFilter) (int64, error)
+	QueryDocuments(ctx context.Context, collection string, filters ...QueryFilter) (map[string]map[string]interface{}, error)
+	GetFileSize(ctx context.Context, bucketName string, objectName string) (int64, error)
+	ListFilesInStorage(ctx context.Context, bucketName string, prefix string) ([]string, error)
+	ListObjects(ctx context.Context, bucketName string, prefix string) ([]ObjectInfo, error)
 	GenerateSignedURL(bucketName string, objectName string) (string, error)
+	GenerateSignedURLs(ctx context.Context, bucketName string, objectNames []string) ([]string, error)
 	UpdateDocument(ctx context.Context, collection string, document string, data map[string]interface{}) error
 	UploadFileToStorage(ctx context.Context, bucketName string, objectName string, file *os.File, fileName string) error
+	UploadReaderToStorage(ctx context.Context, bucketName string, objectName string, r io.Reader) error
+	WatchCollection(ctx context.Context, collection string, changed func(document string)) error
+}
+
+// lease is stored in a lease document, holder keeps the lease until expires_at unless they release it first.
+type lease struct {
+	Holder    string    `firestore:"holder"`
+	ExpiresAt time.Time `firestore:"expires_at"`
+}
+
+// ObjectInfo is a stored object as it was listed, Created is when it was written.
+type ObjectInfo struct {
+	Name    string
+	Size    int64
+	Created time.Time
+}
+
+// QueryFilter is a single where clause, Op is any operator firestore supports such as "==" or ">=".
+type QueryFilter struct {
+	Path  string
+	Op    string
+	Value interface{}
+}
+
+// signedURLConcurrency is how many urls GenerateSignedURLs signs at once, signing goes through the IAM api when the
+// credentials can't sign locally so it's worth overlapping
+const signedURLConcurrency = 10
+
+// storageRetryPolicy retries storage calls that failed for reasons that might not happen again
+var storageRetryPolicy = util.RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   time.Millisecond * 250,
+	MaxDelay:    time.Second * 2,
+	Jitter:      0.2,
+	Retryable:   retryableStorageError,
+}
+
+func retryableStorageError(err error) bool {
+	if errors.Is(err, gs.ErrObjectNotExist) || errors.Is(err, gs.ErrBucketNotExist) || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code >= http.StatusInternalServerError || apiErr.Code == http.StatusTooManyRequests
+	}
+
+	return true
+}
+
+// objectNotFoundError reports codes.NotFound for a missing object like firestore does for a missing document, so
+// callers check both the same way. The storage error stays matchable with errors.Is.
+type objectNotFoundError struct {
+	err error
+}
+
+func (e objectNotFoundError) Error() string {
+	return e.err.Error()
+}
+
+func (e objectNotFoundError) Unwrap() error {
+	return e.err
+}
+
+func (e objectNotFoundError) GRPCStatus() *status.Status {
+	return status.New(codes.NotFound, e.err.Error())
+}
+
+// storageError marks err as not found when storage couldn't find the object.
+func storageError(err error) error {
+	if errors.Is(err, gs.ErrObjectNotExist) {
+		return objectNotFoundError{err: err}
+	}
+
+	return err
 }
 
 type FirebaseAdapter struct {
 	firestoreClient    *fs.Client
 	cloudStorageClient *gs.Client
+	urlSigner          URLSigner
+	metrics            *Metrics
 	logger             *zap.Logger
 }
 
 var _ Firebase = (*FirebaseAdapter)(nil)
 
-func NewFirebaseHelper(firestoreClient *fs.Client, storageClient *gs.Client, logger *zap.Logger) *FirebaseAdapter {
+// NewFirebaseHelper creates the adapter, urlSigner may be nil to sign urls with the private key of the storage client credentials
+// and metrics may be nil to have the adapter keep its own with the default slow call threshold.
+func NewFirebaseHelper(firestoreClient *fs.Client, storageClient *gs.Client, urlSigner URLSigner, metrics *Metrics, logger *zap.Logger) *FirebaseAdapter {
+	if metrics == nil {
+		metrics = NewMetrics(logger, DefaultSlowCallThreshold)
+	}
+
 	return &FirebaseAdapter{
 		firestoreClient:    firestoreClient,
 		cloudStorageClient: storageClient,
+		urlSigner:          urlSigner,
+		metrics:            metrics,
 		logger:             logger,
 	}
 }
 
-func (f *FirebaseAdapter) CloneFileFromStorage(ctx context.Context, bucketName string, sourceObject string, destinationObject string) error {
+// Metrics are the stats of every call the adapter has made.
+func (f *FirebaseAdapter) Metrics() *Metrics {
+	return f.metrics
+}
+
+func (f *FirebaseAdapter) CloneFileFromStorage(ctx context.Context, bucketName string, sourceObject string, destinationObject string) (err error) {
+	defer f.metrics.observe("clone_object", bucketName, time.Now(), &err)
+
 	source := f.cloudStorageClient.Bucket(bucketName).Object(sourceObject)
 	if _, err := f.cloudStorageClient.Bucket(bucketName).Object(destinationObject).CopierFrom(source).Run(ctx); err != nil {
-		return fmt.Errorf("error cloning object to destination: %w", err)
+		return storageError(fmt.Errorf("error cloning object to destination: %w", err))
 	}
 
 	return nil
 }
 
-func (f *FirebaseAdapter) DeleteFileFromStorage(ctx context.Context, bucketName string, objectName string) error {
+func (f *FirebaseAdapter) DeleteFileFromStorage(ctx context.Context, bucketName string, objectName string) (err error) {
+	defer f.metrics.observe("delete_object", bucketName, time.Now(), &err)
+
 	bucket := f.cloudStorageClient.Bucket(bucketName).Object(objectName)
 	if err := bucket.Delete(ctx); err != nil {
-		return fmt.Errorf("error deleting object from bucket: %w", err)
+		return storageError(fmt.Errorf("error deleting object from bucket: %w", err))
 	}
 
 	return nil
 }
 
-func (f *FirebaseAdapter) UploadFileToStorage(ctx context.Context, bucketName string, objectName string, file *os.File, fileName string) error {
+// UploadFileToStorage uploads the file along with its CRC32C, so storage rejects the upload if it was corrupted on the way.
+func (f *FirebaseAdapter) UploadFileToStorage(ctx context.Context, bucketName string, objectName string, file *os.File, fileName string) (err error) {
+	defer f.metrics.observe("upload_object", bucketName, time.Now(), &err)
 	defer file.Close()
 
+	checksums, err := util.HashSeeker(file)
+	if err != nil {
+		return fmt.Errorf("error checksumming %s: %w", fileName, err)
+	}
+
+	head, err := util.SniffFile(file)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", fileName, err)
+	}
+
+	contentType := util.DetectContentType(head)
+
+	// The file can be read again from the start, so unlike streamed uploads a failed attempt can be retried
+	return util.Retry(ctx, storageRetryPolicy, func(ctx context.Context) error {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+
+		return f.upload(ctx, bucketName, objectName, file, contentType, &checksums.CRC32C)
+	})
+}
+
+// UploadReaderToStorage streams r into the object, for uploads that were never written to disk.
+func (f *FirebaseAdapter) UploadReaderToStorage(ctx context.Context, bucketName string, objectName string, r io.Reader) (err error) {
+	defer f.metrics.observe("upload_object", bucketName, time.Now(), &err)
+
+	// Peeking leaves the sniffed bytes to be uploaded with the rest
+	buffered := bufio.NewReader(r)
+	head, _ := buffered.Peek(512)
+
+	return f.upload(ctx, bucketName, objectName, buffered, util.DetectContentType(head), nil)
+}
+
+// upload writes r to the object under contentType, crc32c is sent for storage to verify when it's known up front.
+func (f *FirebaseAdapter) upload(ctx context.Context, bucketName string, objectName string, r io.Reader, contentType string, crc32c *uint32) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	bucket := f.cloudStorageClient.Bucket(bucketName)
 	wc := bucket.Object(objectName).NewWriter(ctx)
 	token, _ := uuid.NewV7()
 	metadata := map[string]string{"firebaseStorageDownloadTokens": token.String()}
 	wc.Metadata = metadata
-	wc.ContentType = "audio/mpeg"
+	wc.ContentType = contentType
+
+	if crc32c != nil {
+		wc.CRC32C = *crc32c
+		wc.SendCRC32C = true
+	}
 
-	if _, err := io.Copy(wc, file); err != nil {
+	// Returning before the writer is closed cancels its context, aborting the upload so a failed read doesn't leave a partial object
+	if _, err := io.Copy(wc, r); err != nil {
 		return err
 	}
 
 	return wc.Close()
 }
 
-func (f *FirebaseAdapter) GetDocumentFromCollection(ctx context.Context, collection string, document string) (map[string]interface{}, error) {
+func (f *FirebaseAdapter) GetDocumentFromCollection(ctx context.Context, collection string, document string) (_ map[string]interface{}, err error) {
+	defer f.metrics.observe("get_document", collection, time.Now(), &err)
+
 	fs, err := f.firestoreClient.Collection(collection).Doc(document).Get(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("error getting document from collection %w", err)
@@ -87,14 +256,173 @@ func (f *FirebaseAdapter) GetDocumentFromCollection(ctx context.Context, collect
 	return data, nil
 }
 
-func (f *FirebaseAdapter) CreateDocument(ctx context.Context, collection string, document string, data interface{}) error {
-	_, err := f.firestoreClient.Collection(collection).Doc(document).Create(ctx, data)
+func (f *FirebaseAdapter) GetDocumentsFromCollection(ctx context.Context, collection string) (_ map[string]map[string]interface{}, err error) {
+	defer f.metrics.observe("get_collection", collection, time.Now(), &err)
+
+	snapshots, err := f.firestoreClient.Collection(collection).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("error getting documents from collection %w", err)
+	}
+
+	documents := make(map[string]map[string]interface{}, len(snapshots))
+	for _, snapshot := range snapshots {
+		documents[snapshot.Ref.ID] = snapshot.Data()
+	}
+
+	return documents, nil
+}
+
+// GetDocumentsByID fetches the given documents in a single batch, documents that don't exist are left out of the result.
+func (f *FirebaseAdapter) GetDocumentsByID(ctx context.Context, collection string, documents []string) (_ map[string]map[string]interface{}, err error) {
+	defer f.metrics.observe("get_documents", collection, time.Now(), &err)
+
+	refs := make([]*fs.DocumentRef, 0, len(documents))
+	for _, document := range documents {
+		refs = append(refs, f.firestoreClient.Collection(collection).Doc(document))
+	}
+
+	snapshots, err := f.firestoreClient.GetAll(ctx, refs)
+	if err != nil {
+		return nil, fmt.Errorf("error getting documents by id %w", err)
+	}
+
+	found := make(map[string]map[string]interface{}, len(snapshots))
+	for _, snapshot := range snapshots {
+		if snapshot.Exists() {
+			found[snapshot.Ref.ID] = snapshot.Data()
+		}
+	}
+
+	return found, nil
+}
+
+func (f *FirebaseAdapter) QueryDocuments(ctx context.Context, collection string, filters ...QueryFilter) (_ map[string]map[string]interface{}, err error) {
+	defer f.metrics.observe("query_documents", collection, time.Now(), &err)
+
+	query := f.firestoreClient.Collection(collection).Query
+	for _, filter := range filters {
+		query = query.Where(filter.Path, filter.Op, filter.Value)
+	}
+
+	snapshots, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("error querying documents in collection %w", err)
+	}
+
+	documents := make(map[string]map[string]interface{}, len(snapshots))
+	for _, snapshot := range snapshots {
+		documents[snapshot.Ref.ID] = snapshot.Data()
+	}
+
+	return documents, nil
+}
+
+// CountDocuments runs a count aggregation server side so that matching documents are never downloaded.
+func (f *FirebaseAdapter) CountDocuments(ctx context.Context, collection string, filters ...QueryFilter) (_ int64, err error) {
+	defer f.metrics.observe("count_documents", collection, time.Now(), &err)
+
+	query := f.firestoreClient.Collection(collection).Query
+	for _, filter := range filters {
+		query = query.Where(filter.Path, filter.Op, filter.Value)
+	}
+
+	result, err := query.NewAggregationQuery().WithCount("count").Get(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error counting documents in collection %w", err)
+	}
+
+	count, ok := result["count"].(*firestorepb.Value)
+	if !ok {
+		return 0, errors.New("count aggregation returned no result")
+	}
+
+	return count.GetIntegerValue(), nil
+}
+
+func (f *FirebaseAdapter) CreateDocument(ctx context.Context, collection string, document string, data interface{}) (err error) {
+	defer f.metrics.observe("create_document", collection, time.Now(), &err)
+
+	_, err = f.firestoreClient.Collection(collection).Doc(document).Create(ctx, data)
 
 	return err
 }
 
-func (f *FirebaseAdapter) DeleteDocument(ctx context.Context, collection string, document string) error {
-	_, err := f.firestoreClient.Collection(collection).Doc(document).Delete(ctx)
+// AcquireLease takes the lease for holder until expiresAt if it's free, expired as of now or already theirs, reporting
+// whether holder has it. The read and write happen in one transaction so only one holder can win a free lease.
+func (f *FirebaseAdapter) AcquireLease(ctx context.Context, collection string, document string, holder string, now time.Time, expiresAt time.Time) (_ bool, err error) {
+	defer f.metrics.observe("acquire_lease", collection, time.Now(), &err)
+
+	ref := f.firestoreClient.Collection(collection).Doc(document)
+	acquired := false
+
+	err = f.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *fs.Transaction) error {
+		acquired = false
+
+		snapshot, err := tx.Get(ref)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+
+		if err == nil {
+			var current lease
+			if err := snapshot.DataTo(&current); err != nil {
+				return err
+			}
+
+			if current.Holder != holder && current.ExpiresAt.After(now) {
+				return nil
+			}
+		}
+
+		acquired = true
+
+		return tx.Set(ref, lease{Holder: holder, ExpiresAt: expiresAt})
+	})
+	if err != nil {
+		return false, fmt.Errorf("error acquiring lease %s/%s: %w", collection, document, err)
+	}
+
+	return acquired, nil
+}
+
+// ReleaseLease gives up the lease if holder still has it, so the next holder doesn't have to wait for it to expire.
+func (f *FirebaseAdapter) ReleaseLease(ctx context.Context, collection string, document string, holder string) (err error) {
+	defer f.metrics.observe("release_lease", collection, time.Now(), &err)
+
+	ref := f.firestoreClient.Collection(collection).Doc(document)
+
+	err = f.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *fs.Transaction) error {
+		snapshot, err := tx.Get(ref)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return nil
+			}
+
+			return err
+		}
+
+		var current lease
+		if err := snapshot.DataTo(&current); err != nil {
+			return err
+		}
+
+		if current.Holder != holder {
+			return nil
+		}
+
+		return tx.Delete(ref)
+	})
+	if err != nil {
+		return fmt.Errorf("error releasing lease %s/%s: %w", collection, document, err)
+	}
+
+	return nil
+}
+
+func (f *FirebaseAdapter) DeleteDocument(ctx context.Context, collection string, document string) (err error) {
+	defer f.metrics.observe("delete_document", collection, time.Now(), &err)
+
+	_, err = f.firestoreClient.Collection(collection).Doc(document).Delete(ctx)
 	if err != nil {
 		return fmt.Errorf("error deleting document from collection: %w", err)
 	}
@@ -102,7 +430,9 @@ func (f *FirebaseAdapter) DeleteDocument(ctx context.Context, collection string,
 	return err
 }
 
-func (f *FirebaseAdapter) UpdateDocument(ctx context.Context, collection string, document string, data map[string]interface{}) error {
+func (f *FirebaseAdapter) UpdateDocument(ctx context.Context, collection string, document string, data map[string]interface{}) (err error) {
+	defer f.metrics.observe("update_document", collection, time.Now(), &err)
+
 	updates := []fs.Update{}
 
 	for key, value := range data {
@@ -119,34 +449,193 @@ func (f *FirebaseAdapter) UpdateDocument(ctx context.Context, collection string,
 	return nil
 }
 
-func (f *FirebaseAdapter) GenerateSignedURL(bucketName string, objectName string) (string, error) {
-	bucket := f.cloudStorageClient.Bucket(bucketName)
-	object, err := bucket.SignedURL(objectName, &gs.SignedURLOptions{
+func (f *FirebaseAdapter) ListFilesInStorage(ctx context.Context, bucketName string, prefix string) (_ []string, err error) {
+	defer f.metrics.observe("list_objects", bucketName, time.Now(), &err)
+
+	objects := f.cloudStorageClient.Bucket(bucketName).Objects(ctx, &gs.Query{Prefix: prefix})
+	objectNames := []string{}
+
+	for {
+		attrs, err := objects.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("error listing objects in bucket: %w", err)
+		}
+
+		objectNames = append(objectNames, attrs.Name)
+	}
+
+	return objectNames, nil
+}
+
+// ListObjects is ListFilesInStorage with each object's size and creation time.
+func (f *FirebaseAdapter) ListObjects(ctx context.Context, bucketName string, prefix string) (_ []ObjectInfo, err error) {
+	defer f.metrics.observe("list_objects", bucketName, time.Now(), &err)
+
+	objects := f.cloudStorageClient.Bucket(bucketName).Objects(ctx, &gs.Query{Prefix: prefix})
+	infos := []ObjectInfo{}
+
+	for {
+		attrs, err := objects.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("error listing objects in bucket: %w", err)
+		}
+
+		infos = append(infos, ObjectInfo{Name: attrs.Name, Size: attrs.Size, Created: attrs.Created})
+	}
+
+	return infos, nil
+}
+
+func (f *FirebaseAdapter) GetFileSize(ctx context.Context, bucketName string, objectName string) (_ int64, err error) {
+	defer f.metrics.observe("get_object_size", bucketName, time.Now(), &err)
+
+	attrs, err := f.cloudStorageClient.Bucket(bucketName).Object(objectName).Attrs(ctx)
+	if err != nil {
+		return 0, storageError(fmt.Errorf("error getting object attributes: %w", err))
+	}
+
+	return attrs.Size, nil
+}
+
+func (f *FirebaseAdapter) GenerateSignedURL(bucketName string, objectName string) (_ string, err error) {
+	defer f.metrics.observe("sign_url", bucketName, time.Now(), &err)
+
+	return f.signURL(bucketName, objectName)
+}
+
+// GenerateSignedURLs signs a url for each object concurrently, returned in the same order as objectNames. It fails
+// with every object that couldn't be signed rather than returning the urls that could.
+func (f *FirebaseAdapter) GenerateSignedURLs(ctx context.Context, bucketName string, objectNames []string) (_ []string, err error) {
+	defer f.metrics.observe("sign_urls", bucketName, time.Now(), &err)
+
+	pool := util.NewPool[string](ctx, signedURLConcurrency)
+	for _, objectName := range objectNames {
+		pool.Submit(func(context.Context) (string, error) {
+			return f.signURL(bucketName, objectName)
+		})
+	}
+
+	results := pool.Wait()
+	if err := results.Err(); err != nil {
+		return nil, err
+	}
+
+	return results.Values(), nil
+}
+
+func (f *FirebaseAdapter) signURL(bucketName string, objectName string) (string, error) {
+	opts := &gs.SignedURLOptions{
 		Scheme:  gs.SigningSchemeV4,
 		Method:  "GET",
 		Expires: time.Now().Add(15 * time.Minute),
+	}
+
+	if f.urlSigner != nil {
+		opts.GoogleAccessID = f.urlSigner.GoogleAccessID()
+		opts.SignBytes = f.urlSigner.SignBytes
+	}
+
+	url, err := f.cloudStorageClient.Bucket(bucketName).SignedURL(objectName, opts)
+	if err != nil {
+		return "", fmt.Errorf("error signing url for %s: %w", objectName, err)
+	}
+
+	return url, nil
+}
+
+// DownloadFileBytes reads the whole object into memory, retrying transient storage errors.
+func (f *FirebaseAdapter) DownloadFileBytes(ctx context.Context, bucketName string, objectName string) (_ io.Reader, err error) {
+	defer f.metrics.observe("download_object", bucketName, time.Now(), &err)
+
+	object := f.cloudStorageClient.Bucket(bucketName).Object(objectName)
+
+	var contents []byte
+
+	err = util.Retry(ctx, storageRetryPolicy, func(ctx context.Context) error {
+		reader, err := object.NewReader(ctx)
+		if err != nil {
+			return err
+		}
+
+		defer func() {
+			if err := reader.Close(); err != nil {
+				f.logger.Error("error closing reader when downloading file bytes", zap.Error(err), zap.String("bucket_name", bucketName), zap.String("object_name", objectName))
+			}
+		}()
+
+		contents, err = io.ReadAll(reader)
+
+		return err
 	})
 	if err != nil {
-		return "", fmt.Errorf("error signing url: %w", err)
+		return nil, storageError(err)
 	}
 
-	return object, nil
+	return bytes.NewReader(contents), nil
 }
 
-func (f *FirebaseAdapter) DownloadFileBytes(ctx context.Context, bucketName string, objectName string) (io.Reader, error) {
-	bucket := f.cloudStorageClient.Bucket(bucketName)
-	object := bucket.Object(objectName)
+// WatchCollection calls changed with the id of each document in the collection as it's added, modified or removed,
+// starting with every document that already exists. It blocks until ctx is done or the watch fails.
+func (f *FirebaseAdapter) WatchCollection(ctx context.Context, collection string, changed func(document string)) error {
+	snapshots := f.firestoreClient.Collection(collection).Snapshots(ctx)
+	defer snapshots.Stop()
+
+	for {
+		snapshot, err := snapshots.Next()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			return fmt.Errorf("error watching collection %s: %w", collection, err)
+		}
+
+		for _, change := range snapshot.Changes {
+			changed(change.Doc.Ref.ID)
+		}
+	}
+}
 
-	reader, err := object.NewReader(ctx)
+// CheckFirestoreAccess performs a cheap read to confirm the credentials can reach firestore.
+func (f *FirebaseAdapter) CheckFirestoreAccess(ctx context.Context, collection string) (err error) {
+	defer f.metrics.observe("check_access", collection, time.Now(), &err)
+
+	_, err = f.firestoreClient.Collection(collection).Limit(1).Documents(ctx).Next()
+	if err != nil && !errors.Is(err, iterator.Done) {
+		return fmt.Errorf("error reading from firestore collection %s: %w", collection, err)
+	}
+
+	return nil
+}
+
+// CheckBucketAccess confirms the bucket exists and that the credentials hold every given permission on it.
+func (f *FirebaseAdapter) CheckBucketAccess(ctx context.Context, bucketName string, permissions []string) (err error) {
+	defer f.metrics.observe("check_access", bucketName, time.Now(), &err)
+
+	// TestPermissions requires no extra role and fails with not found when the bucket doesn't exist
+	granted, err := f.cloudStorageClient.Bucket(bucketName).IAM().TestPermissions(ctx, permissions)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("error testing permissions on bucket %s: %w", bucketName, err)
 	}
 
-	defer func() {
-		if err := reader.Close(); err != nil {
-			f.logger.Error("error closing reader when downloading file bytes", zap.Error(err), zap.String("bucket_name", bucketName), zap.String("object_name", objectName))
+	missing := []string{}
+	for _, permission := range permissions {
+		if !slices.Contains(granted, permission) {
+			missing = append(missing, permission)
 		}
-	}()
+	}
 
-	return reader, nil
+	if len(missing) > 0 {
+		return fmt.Errorf("missing permissions on bucket %s: %s", bucketName, strings.Join(missing, ", "))
+	}
+
+	return nil
 }
@@ -0,0 +1,725 @@
+// Package firebasetest provides an in-memory implementation of the firebase adapter for tests.
+package firebasetest
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	firebaseAdapter "salutations/internal/firebase"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	arrayUnionType  = reflect.TypeOf(firestore.ArrayUnion())
+	arrayRemoveType = reflect.TypeOf(firestore.ArrayRemove())
+	timeType        = reflect.TypeOf(time.Time{})
+)
+
+// Firebase stores documents and blobs in memory. Values are normalized the way firestore returns them,
+// so structs become map[string]interface{}, slices become []interface{} and integers become int64.
+type Firebase struct {
+	mu        sync.Mutex
+	documents map[string]map[string]map[string]interface{}
+	blobs     map[string]map[string][]byte
+	// created is when each blob was written, keyed like blobs
+	created map[string]map[string]time.Time
+	// watchers are called synchronously after each write to their collection, keyed by collection then watch id
+	watchers    map[string]map[int]func(document string)
+	nextWatcher int
+}
+
+var _ firebaseAdapter.Firebase = (*Firebase)(nil)
+
+func New() *Firebase {
+	return &Firebase{
+		documents: map[string]map[string]map[string]interface{}{},
+		blobs:     map[string]map[string][]byte{},
+		created:   map[string]map[string]time.Time{},
+		watchers:  map[string]map[int]func(document string){},
+	}
+}
+
+func notFound(format string, args ...interface{}) error {
+	return status.Errorf(codes.NotFound, format, args...)
+}
+
+func (f *Firebase) CreateDocument(_ context.Context, collection string, document string, data interface{}) error {
+	defer f.notify(collection, document)
+
+	fields, ok := normalize(reflect.ValueOf(data)).(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("document data must be a struct or map, got %T", data)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, exists := f.documents[collection][document]; exists {
+		return status.Errorf(codes.AlreadyExists, "document %s/%s already exists", collection, document)
+	}
+
+	if f.documents[collection] == nil {
+		f.documents[collection] = map[string]map[string]interface{}{}
+	}
+
+	f.documents[collection][document] = fields
+
+	return nil
+}
+
+func (f *Firebase) AcquireLease(_ context.Context, collection string, document string, holder string, now time.Time, expiresAt time.Time) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if current, exists := f.documents[collection][document]; exists {
+		currentExpiry, _ := current["expires_at"].(time.Time)
+		if current["holder"] != holder && currentExpiry.After(now) {
+			return false, nil
+		}
+	}
+
+	if f.documents[collection] == nil {
+		f.documents[collection] = map[string]map[string]interface{}{}
+	}
+
+	f.documents[collection][document] = map[string]interface{}{"holder": holder, "expires_at": expiresAt}
+
+	return true, nil
+}
+
+func (f *Firebase) ReleaseLease(_ context.Context, collection string, document string, holder string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if current, exists := f.documents[collection][document]; exists && current["holder"] == holder {
+		delete(f.documents[collection], document)
+	}
+
+	return nil
+}
+
+func (f *Firebase) AddRef(_ context.Context, collection string, document string, holder string, revive bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	current := f.documents[collection][document]
+	if released, _ := current["released"].(bool); released && !revive {
+		return fmt.Errorf("error adding ref to %s/%s: %w", collection, document, firebaseAdapter.ErrRefsReleased)
+	}
+
+	holders, _ := current["refs"].([]interface{})
+	if slices.Contains(holders, interface{}(holder)) {
+		return nil
+	}
+
+	f.setDocument(collection, document, map[string]interface{}{"refs": append(slices.Clone(holders), holder), "released": false})
+
+	return nil
+}
+
+func (f *Firebase) ReleaseRef(_ context.Context, collection string, document string, holder string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	current, exists := f.documents[collection][document]
+	if !exists {
+		return true, nil
+	}
+
+	holders, _ := current["refs"].([]interface{})
+	holders = slices.DeleteFunc(slices.Clone(holders), func(h interface{}) bool { return h == holder })
+	last := len(holders) == 0
+
+	f.setDocument(collection, document, map[string]interface{}{"refs": holders, "released": last})
+
+	return last, nil
+}
+
+func (f *Firebase) ChargeStorage(_ context.Context, usageCollection string, chargeCollection string, object string, charge firebaseAdapter.StorageCharge, guildQuota int64, memberQuota int64) (firebaseAdapter.StorageUsage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	usage := firebaseAdapter.StorageUsageFrom(f.documents[usageCollection][charge.GuildID])
+	if _, exists := f.documents[chargeCollection][object]; exists {
+		return usage, nil
+	}
+
+	if guildQuota > 0 && usage.Bytes+charge.Bytes > guildQuota {
+		return firebaseAdapter.StorageUsage{}, fmt.Errorf("error charging storage for %s: %w", object, firebaseAdapter.ErrGuildStorageQuota)
+	}
+
+	if memberQuota > 0 && usage.Members[charge.MemberID]+charge.Bytes > memberQuota {
+		return firebaseAdapter.StorageUsage{}, fmt.Errorf("error charging storage for %s: %w", object, firebaseAdapter.ErrMemberStorageQuota)
+	}
+
+	usage.Add(charge.MemberID, charge.Bytes)
+
+	f.setDocument(usageCollection, charge.GuildID, usage)
+	f.setDocument(chargeCollection, object, charge)
+
+	return usage, nil
+}
+
+func (f *Firebase) RefundStorage(_ context.Context, usageCollection string, chargeCollection string, object string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	chargeFields, exists := f.documents[chargeCollection][object]
+	if !exists {
+		return nil
+	}
+
+	guildID, _ := chargeFields["guild_id"].(string)
+	memberID, _ := chargeFields["member_id"].(string)
+	bytes, _ := chargeFields["bytes"].(int64)
+
+	if usageFields, exists := f.documents[usageCollection][guildID]; exists {
+		usage := firebaseAdapter.StorageUsageFrom(usageFields)
+		usage.Add(memberID, -bytes)
+		f.setDocument(usageCollection, guildID, usage)
+	}
+
+	delete(f.documents[chargeCollection], object)
+
+	return nil
+}
+
+// setDocument replaces a document with data, creating the collection if it's the first. f.mu must be held.
+func (f *Firebase) setDocument(collection string, document string, data interface{}) {
+	if f.documents[collection] == nil {
+		f.documents[collection] = map[string]map[string]interface{}{}
+	}
+
+	f.documents[collection][document] = normalize(reflect.ValueOf(data)).(map[string]interface{})
+}
+
+func (f *Firebase) DeleteDocument(_ context.Context, collection string, document string) error {
+	defer f.notify(collection, document)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.documents[collection], document)
+
+	return nil
+}
+
+func (f *Firebase) GetDocumentFromCollection(_ context.Context, collection string, document string) (map[string]interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fields, exists := f.documents[collection][document]
+	if !exists {
+		return nil, fmt.Errorf("error getting document from collection %w", notFound("document %s/%s not found", collection, document))
+	}
+
+	return normalize(reflect.ValueOf(fields)).(map[string]interface{}), nil
+}
+
+func (f *Firebase) GetDocumentsFromCollection(_ context.Context, collection string) (map[string]map[string]interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	documents := make(map[string]map[string]interface{}, len(f.documents[collection]))
+	for id, fields := range f.documents[collection] {
+		documents[id] = normalize(reflect.ValueOf(fields)).(map[string]interface{})
+	}
+
+	return documents, nil
+}
+
+func (f *Firebase) GetDocumentsByID(_ context.Context, collection string, documents []string) (map[string]map[string]interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	found := make(map[string]map[string]interface{}, len(documents))
+	for _, id := range documents {
+		if fields, exists := f.documents[collection][id]; exists {
+			found[id] = normalize(reflect.ValueOf(fields)).(map[string]interface{})
+		}
+	}
+
+	return found, nil
+}
+
+// QueryDocuments supports the comparison operators on strings, numbers and times.
+func (f *Firebase) QueryDocuments(_ context.Context, collection string, filters ...firebaseAdapter.QueryFilter) (map[string]map[string]interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	documents := map[string]map[string]interface{}{}
+
+	for id, fields := range f.documents[collection] {
+		matches := true
+
+		for _, filter := range filters {
+			ok, err := matchesFilter(fields, filter)
+			if err != nil {
+				return nil, err
+			}
+
+			matches = matches && ok
+		}
+
+		if matches {
+			documents[id] = normalize(reflect.ValueOf(fields)).(map[string]interface{})
+		}
+	}
+
+	return documents, nil
+}
+
+func (f *Firebase) CountDocuments(ctx context.Context, collection string, filters ...firebaseAdapter.QueryFilter) (int64, error) {
+	documents, err := f.QueryDocuments(ctx, collection, filters...)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(documents)), nil
+}
+
+// UpdateDocument applies updates like firestore does, including dotted field paths,
+// firestore.Delete, firestore.ServerTimestamp, firestore.ArrayUnion and firestore.ArrayRemove.
+func (f *Firebase) UpdateDocument(_ context.Context, collection string, document string, data map[string]interface{}) error {
+	defer f.notify(collection, document)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fields, exists := f.documents[collection][document]
+	if !exists {
+		return fmt.Errorf("error updating document: %w", notFound("document %s/%s not found", collection, document))
+	}
+
+	for path, value := range data {
+		keys := strings.Split(path, ".")
+		parent := fields
+
+		for _, key := range keys[:len(keys)-1] {
+			child, ok := parent[key].(map[string]interface{})
+			if !ok {
+				child = map[string]interface{}{}
+				parent[key] = child
+			}
+
+			parent = child
+		}
+
+		key := keys[len(keys)-1]
+
+		switch reflectValue := reflect.ValueOf(value); {
+		case value == nil:
+			parent[key] = nil
+		case value == firestore.Delete:
+			delete(parent, key)
+		case value == firestore.ServerTimestamp:
+			parent[key] = time.Now()
+		case reflectValue.Type() == arrayUnionType:
+			existing, _ := parent[key].([]interface{})
+			for _, elem := range sentinelElems(reflectValue) {
+				if !slices.ContainsFunc(existing, func(e interface{}) bool { return reflect.DeepEqual(e, elem) }) {
+					existing = append(existing, elem)
+				}
+			}
+
+			if existing == nil {
+				existing = []interface{}{}
+			}
+
+			parent[key] = existing
+		case reflectValue.Type() == arrayRemoveType:
+			existing, _ := parent[key].([]interface{})
+			elems := sentinelElems(reflectValue)
+			remaining := []interface{}{}
+
+			for _, e := range existing {
+				if !slices.ContainsFunc(elems, func(elem interface{}) bool { return reflect.DeepEqual(e, elem) }) {
+					remaining = append(remaining, e)
+				}
+			}
+
+			parent[key] = remaining
+		default:
+			parent[key] = normalize(reflectValue)
+		}
+	}
+
+	return nil
+}
+
+// WatchCollection calls changed after every document write to the collection until ctx is done, unlike firestore it
+// doesn't start by listing the documents that already exist.
+func (f *Firebase) WatchCollection(ctx context.Context, collection string, changed func(document string)) error {
+	f.mu.Lock()
+	id := f.nextWatcher
+	f.nextWatcher++
+
+	if f.watchers[collection] == nil {
+		f.watchers[collection] = map[int]func(document string){}
+	}
+
+	f.watchers[collection][id] = changed
+	f.mu.Unlock()
+
+	<-ctx.Done()
+
+	f.mu.Lock()
+	delete(f.watchers[collection], id)
+	f.mu.Unlock()
+
+	return ctx.Err()
+}
+
+// notify runs the collection's watchers once the write has released the lock, so they're free to read the fake.
+func (f *Firebase) notify(collection string, document string) {
+	f.mu.Lock()
+	watchers := slices.Collect(maps.Values(f.watchers[collection]))
+	f.mu.Unlock()
+
+	for _, changed := range watchers {
+		changed(document)
+	}
+}
+
+func (f *Firebase) UploadFileToStorage(ctx context.Context, bucketName string, objectName string, file *os.File, _ string) error {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("error seeking file: %w", err)
+	}
+
+	return f.UploadReaderToStorage(ctx, bucketName, objectName, file)
+}
+
+func (f *Firebase) UploadReaderToStorage(_ context.Context, bucketName string, objectName string, r io.Reader) error {
+	contents, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("error reading file: %w", err)
+	}
+
+	f.PutBlob(bucketName, objectName, contents)
+
+	return nil
+}
+
+func (f *Firebase) CloneFileFromStorage(_ context.Context, bucketName string, sourceObject string, destinationObject string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	contents, exists := f.blobs[bucketName][sourceObject]
+	if !exists {
+		return notFound("object %s/%s not found", bucketName, sourceObject)
+	}
+
+	f.blobs[bucketName][destinationObject] = slices.Clone(contents)
+	f.created[bucketName][destinationObject] = time.Now()
+
+	return nil
+}
+
+func (f *Firebase) DeleteFileFromStorage(_ context.Context, bucketName string, objectName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, exists := f.blobs[bucketName][objectName]; !exists {
+		return notFound("object %s/%s not found", bucketName, objectName)
+	}
+
+	delete(f.blobs[bucketName], objectName)
+	delete(f.created[bucketName], objectName)
+
+	return nil
+}
+
+func (f *Firebase) DownloadFileBytes(_ context.Context, bucketName string, objectName string) (io.Reader, error) {
+	contents, exists := f.Blob(bucketName, objectName)
+	if !exists {
+		return nil, notFound("object %s/%s not found", bucketName, objectName)
+	}
+
+	return bytes.NewReader(contents), nil
+}
+
+func (f *Firebase) ListFilesInStorage(_ context.Context, bucketName string, prefix string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	objectNames := []string{}
+
+	for objectName := range f.blobs[bucketName] {
+		if strings.HasPrefix(objectName, prefix) {
+			objectNames = append(objectNames, objectName)
+		}
+	}
+
+	slices.Sort(objectNames)
+
+	return objectNames, nil
+}
+
+func (f *Firebase) ListObjects(_ context.Context, bucketName string, prefix string) ([]firebaseAdapter.ObjectInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	objects := []firebaseAdapter.ObjectInfo{}
+
+	for objectName, contents := range f.blobs[bucketName] {
+		if strings.HasPrefix(objectName, prefix) {
+			objects = append(objects, firebaseAdapter.ObjectInfo{Name: objectName, Size: int64(len(contents)), Created: f.created[bucketName][objectName]})
+		}
+	}
+
+	slices.SortFunc(objects, func(a, b firebaseAdapter.ObjectInfo) int { return cmp.Compare(a.Name, b.Name) })
+
+	return objects, nil
+}
+
+func (f *Firebase) GetFileSize(_ context.Context, bucketName string, objectName string) (int64, error) {
+	contents, exists := f.Blob(bucketName, objectName)
+	if !exists {
+		return 0, notFound("object %s/%s not found", bucketName, objectName)
+	}
+
+	return int64(len(contents)), nil
+}
+
+func (f *Firebase) GenerateSignedURL(bucketName string, objectName string) (string, error) {
+	if _, exists := f.Blob(bucketName, objectName); !exists {
+		return "", notFound("object %s/%s not found", bucketName, objectName)
+	}
+
+	return fmt.Sprintf("https://storage.example.com/%s/%s?signed=true", bucketName, objectName), nil
+}
+
+func (f *Firebase) GenerateSignedURLs(_ context.Context, bucketName string, objectNames []string) ([]string, error) {
+	urls := make([]string, 0, len(objectNames))
+	for _, objectName := range objectNames {
+		url, err := f.GenerateSignedURL(bucketName, objectName)
+		if err != nil {
+			return nil, err
+		}
+
+		urls = append(urls, url)
+	}
+
+	return urls, nil
+}
+
+// PutBlob stores an object directly, for seeding tests.
+func (f *Firebase) PutBlob(bucketName string, objectName string, contents []byte) {
+	f.PutBlobAt(bucketName, objectName, contents, time.Now())
+}
+
+// PutBlobAt is PutBlob for an object written at a given time.
+func (f *Firebase) PutBlobAt(bucketName string, objectName string, contents []byte, created time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.blobs[bucketName] == nil {
+		f.blobs[bucketName] = map[string][]byte{}
+		f.created[bucketName] = map[string]time.Time{}
+	}
+
+	f.blobs[bucketName][objectName] = slices.Clone(contents)
+	f.created[bucketName][objectName] = created
+}
+
+func (f *Firebase) Blob(bucketName string, objectName string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	contents, exists := f.blobs[bucketName][objectName]
+
+	return slices.Clone(contents), exists
+}
+
+func matchesFilter(fields map[string]interface{}, filter firebaseAdapter.QueryFilter) (bool, error) {
+	var value interface{} = fields
+
+	for _, key := range strings.Split(filter.Path, ".") {
+		nested, ok := value.(map[string]interface{})
+		if !ok {
+			return false, nil
+		}
+
+		if value, ok = nested[key]; !ok {
+			return false, nil
+		}
+	}
+
+	var comparison int
+
+	switch want := normalize(reflect.ValueOf(filter.Value)).(type) {
+	case string:
+		got, ok := value.(string)
+		if !ok {
+			return false, nil
+		}
+
+		comparison = strings.Compare(got, want)
+	case int64:
+		got, ok := value.(int64)
+		if !ok {
+			return false, nil
+		}
+
+		comparison = cmp.Compare(got, want)
+	case float64:
+		got, ok := value.(float64)
+		if !ok {
+			return false, nil
+		}
+
+		comparison = cmp.Compare(got, want)
+	case time.Time:
+		got, ok := value.(time.Time)
+		if !ok {
+			return false, nil
+		}
+
+		comparison = got.Compare(want)
+	case bool:
+		got, ok := value.(bool)
+		if !ok || (filter.Op != "==" && filter.Op != "!=") {
+			return false, nil
+		}
+
+		if got != want {
+			comparison = 1
+		}
+	default:
+		return false, fmt.Errorf("unsupported filter value %T", filter.Value)
+	}
+
+	switch filter.Op {
+	case "==":
+		return comparison == 0, nil
+	case "!=":
+		return comparison != 0, nil
+	case "<":
+		return comparison < 0, nil
+	case "<=":
+		return comparison <= 0, nil
+	case ">":
+		return comparison > 0, nil
+	case ">=":
+		return comparison >= 0, nil
+	default:
+		return false, fmt.Errorf("unsupported filter operator %s", filter.Op)
+	}
+}
+
+// sentinelElems reads the elements out of a firestore.ArrayUnion or firestore.ArrayRemove value, which
+// firestore only exposes to its own request encoder.
+func sentinelElems(sentinel reflect.Value) []interface{} {
+	addressable := reflect.New(sentinel.Type()).Elem()
+	addressable.Set(sentinel)
+
+	field := addressable.Field(0)
+	elems := reflect.NewAt(field.Type(), unsafe.Pointer(field.UnsafeAddr())).Elem().Interface().([]interface{})
+
+	normalized := make([]interface{}, 0, len(elems))
+	for _, elem := range elems {
+		normalized = append(normalized, normalize(reflect.ValueOf(elem)))
+	}
+
+	return normalized
+}
+
+// normalize deep copies a value into the shape firestore returns it in when read back.
+func normalize(value reflect.Value) interface{} {
+	if !value.IsValid() {
+		return nil
+	}
+
+	if value.Type() == timeType {
+		return value.Interface().(time.Time)
+	}
+
+	switch value.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if value.IsNil() {
+			return nil
+		}
+
+		return normalize(value.Elem())
+	case reflect.Struct:
+		fields := map[string]interface{}{}
+
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+
+			name, options, _ := strings.Cut(field.Tag.Get("firestore"), ",")
+			if name == "-" {
+				continue
+			}
+
+			if name == "" {
+				name = field.Name
+			}
+
+			if strings.Contains(options, "omitempty") && value.Field(i).IsZero() {
+				continue
+			}
+
+			fields[name] = normalize(value.Field(i))
+		}
+
+		return fields
+	case reflect.Map:
+		if value.IsNil() {
+			return nil
+		}
+
+		fields := make(map[string]interface{}, value.Len())
+
+		iter := value.MapRange()
+		for iter.Next() {
+			fields[iter.Key().String()] = normalize(iter.Value())
+		}
+
+		return fields
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && value.IsNil() {
+			return nil
+		}
+
+		if value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.Uint8 {
+			return slices.Clone(value.Bytes())
+		}
+
+		elems := make([]interface{}, 0, value.Len())
+		for i := 0; i < value.Len(); i++ {
+			elems = append(elems, normalize(value.Index(i)))
+		}
+
+		return elems
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		return value.Float()
+	case reflect.String:
+		return value.String()
+	case reflect.Bool:
+		return value.Bool()
+	default:
+		return value.Interface()
+	}
+}
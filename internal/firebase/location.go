@@ -0,0 +1,24 @@
+package firebasehelper
+
+import "strings"
+
+// Location is a bucket along with the path prefix objects are kept under in it, the zero prefix is the bucket's root.
+type Location struct {
+	Bucket string
+	Prefix string
+}
+
+// NewLocation cleans up prefix so it can be joined onto object names, "guilds/acme" and "/guilds/acme/" are the same.
+func NewLocation(bucket string, prefix string) Location {
+	prefix = strings.Trim(prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	return Location{Bucket: bucket, Prefix: prefix}
+}
+
+// Object is where name is stored in the location.
+func (l Location) Object(name string) string {
+	return l.Prefix + name
+}
@@ -0,0 +1,126 @@
+package firebasehelper
+
+import (
+	"cmp"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultSlowCallThreshold is how long a call can take before it's logged as slow when no threshold is configured.
+const DefaultSlowCallThreshold = time.Millisecond * 500
+
+// OperationStats are the calls the adapter made for one operation against one collection, or bucket for storage calls.
+// Lookups of documents or objects that don't exist are counted as NotFound rather than as errors.
+type OperationStats struct {
+	Operation    string        `json:"operation"`
+	Collection   string        `json:"collection"`
+	Calls        int64         `json:"calls"`
+	Errors       int64         `json:"errors"`
+	NotFound     int64         `json:"not_found"`
+	Slow         int64         `json:"slow"`
+	TotalLatency time.Duration `json:"total_latency"`
+	MaxLatency   time.Duration `json:"max_latency"`
+}
+
+type operationKey struct {
+	operation  string
+	collection string
+}
+
+// Metrics counts the adapter's calls and how long they took, so hot collections such as the blacklist being read on
+// every voice event show up. Calls slower than the threshold are logged as they finish.
+type Metrics struct {
+	logger        *zap.Logger
+	slowThreshold time.Duration
+	mu            sync.Mutex
+	operations    map[operationKey]*OperationStats
+}
+
+// NewMetrics creates empty metrics, a threshold below one uses DefaultSlowCallThreshold.
+func NewMetrics(logger *zap.Logger, slowThreshold time.Duration) *Metrics {
+	if slowThreshold <= 0 {
+		slowThreshold = DefaultSlowCallThreshold
+	}
+
+	return &Metrics{
+		logger:        logger,
+		slowThreshold: slowThreshold,
+		operations:    make(map[operationKey]*OperationStats),
+	}
+}
+
+// observe records a call that started at startedAt, it's deferred at the top of each adapter method with a pointer to
+// the method's error so the outcome is read once the method returns.
+func (m *Metrics) observe(operation string, collection string, startedAt time.Time, err *error) {
+	latency := time.Since(startedAt)
+	slow := latency >= m.slowThreshold
+
+	m.mu.Lock()
+
+	key := operationKey{operation: operation, collection: collection}
+	stats, ok := m.operations[key]
+	if !ok {
+		stats = &OperationStats{Operation: operation, Collection: collection}
+		m.operations[key] = stats
+	}
+
+	stats.Calls++
+	stats.TotalLatency += latency
+	stats.MaxLatency = max(stats.MaxLatency, latency)
+
+	switch {
+	case *err == nil:
+	case status.Code(*err) == codes.NotFound:
+		stats.NotFound++
+	default:
+		stats.Errors++
+	}
+
+	if slow {
+		stats.Slow++
+	}
+
+	m.mu.Unlock()
+
+	if slow {
+		m.logger.Warn("slow firebase call", zap.String("operation", operation), zap.String("collection", collection), zap.Duration("latency", latency), zap.Duration("threshold", m.slowThreshold), zap.Error(*err))
+	}
+}
+
+// Stats returns a snapshot of every operation's stats, the ones that have spent the longest waiting first.
+func (m *Metrics) Stats() []OperationStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := make([]OperationStats, 0, len(m.operations))
+	for _, operation := range m.operations {
+		stats = append(stats, *operation)
+	}
+
+	slices.SortFunc(stats, func(a, b OperationStats) int {
+		return cmp.Or(cmp.Compare(b.TotalLatency, a.TotalLatency), cmp.Compare(a.Operation, b.Operation), cmp.Compare(a.Collection, b.Collection))
+	})
+
+	return stats
+}
+
+// MetricsHandler serves the adapter's stats as json on GET /firebase.
+func MetricsHandler(m *Metrics) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /firebase", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(w).Encode(m.Stats()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+
+	return mux
+}
@@ -0,0 +1,108 @@
+package firebasehelper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	fs "cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrRefsReleased is returned when adding a ref to a document whose last ref was already released, whatever the
+// document guards is being deleted.
+var ErrRefsReleased = errors.New("refs already released")
+
+// refs is stored in a refs document, whatever it guards is kept for as long as it has holders. Once the last holder
+// releases it the document is kept and marked released rather than deleted, so nobody can add a ref to something that
+// is being or has been deleted.
+type refs struct {
+	Holders  []string `firestore:"refs"`
+	Released bool     `firestore:"released"`
+}
+
+// AddRef adds holder to the refs document, creating it for the first holder. A released document fails with
+// ErrRefsReleased unless revive is set, for callers that have just stored the guarded thing again. The read and write
+// happen in one transaction so a concurrent release can't miss the new holder.
+func (f *FirebaseAdapter) AddRef(ctx context.Context, collection string, document string, holder string, revive bool) (err error) {
+	defer f.metrics.observe("add_ref", collection, time.Now(), &err)
+
+	ref := f.firestoreClient.Collection(collection).Doc(document)
+
+	err = f.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *fs.Transaction) error {
+		var current refs
+
+		snapshot, err := tx.Get(ref)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+
+		if err == nil {
+			if err := snapshot.DataTo(&current); err != nil {
+				return err
+			}
+		}
+
+		if current.Released && !revive {
+			return ErrRefsReleased
+		}
+
+		// A released document has no holders left
+		if slices.Contains(current.Holders, holder) {
+			return nil
+		}
+
+		current.Holders = append(current.Holders, holder)
+		current.Released = false
+
+		return tx.Set(ref, current)
+	})
+	if err != nil {
+		return fmt.Errorf("error adding ref to %s/%s: %w", collection, document, err)
+	}
+
+	return nil
+}
+
+// ReleaseRef removes holder from the refs document and reports whether no holders are left, marking the document
+// released when that's the case. A missing document has no holders. The read, count and write happen in one
+// transaction so only one of several concurrent releases sees the last ref go.
+func (f *FirebaseAdapter) ReleaseRef(ctx context.Context, collection string, document string, holder string) (_ bool, err error) {
+	defer f.metrics.observe("release_ref", collection, time.Now(), &err)
+
+	ref := f.firestoreClient.Collection(collection).Doc(document)
+	last := false
+
+	err = f.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *fs.Transaction) error {
+		last = false
+
+		snapshot, err := tx.Get(ref)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				last = true
+				return nil
+			}
+
+			return err
+		}
+
+		var current refs
+		if err := snapshot.DataTo(&current); err != nil {
+			return err
+		}
+
+		current.Holders = slices.DeleteFunc(current.Holders, func(h string) bool { return h == holder })
+		last = len(current.Holders) == 0
+		current.Released = last
+
+		return tx.Set(ref, current)
+	})
+	if err != nil {
+		return false, fmt.Errorf("error releasing ref to %s/%s: %w", collection, document, err)
+	}
+
+	return last, nil
+}
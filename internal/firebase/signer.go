@@ -0,0 +1,74 @@
+package firebasehelper
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	"cloud.google.com/go/compute/metadata"
+	"google.golang.org/api/iamcredentials/v1"
+	"google.golang.org/api/option"
+)
+
+// URLSigner signs storage urls on behalf of a service account without needing its private key.
+type URLSigner interface {
+	GoogleAccessID() string
+	SignBytes(payload []byte) ([]byte, error)
+}
+
+type IAMSigner struct {
+	service             *iamcredentials.Service
+	serviceAccountEmail string
+}
+
+var _ URLSigner = (*IAMSigner)(nil)
+
+// NewIAMSigner signs through the IAM Credentials SignBlob API, the caller needs the
+// Service Account Token Creator role on serviceAccountEmail. When serviceAccountEmail is empty
+// the service account attached to the GCE/Cloud Run metadata server is used.
+func NewIAMSigner(ctx context.Context, serviceAccountEmail string, opts ...option.ClientOption) (*IAMSigner, error) {
+	if serviceAccountEmail == "" {
+		if !metadata.OnGCE() {
+			return nil, fmt.Errorf("a signing service account must be provided when not running on google cloud")
+		}
+
+		email, err := metadata.EmailWithContext(ctx, "default")
+		if err != nil {
+			return nil, fmt.Errorf("error getting default service account email from metadata server: %w", err)
+		}
+
+		serviceAccountEmail = email
+	}
+
+	service, err := iamcredentials.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating iam credentials service: %w", err)
+	}
+
+	return &IAMSigner{
+		service:             service,
+		serviceAccountEmail: serviceAccountEmail,
+	}, nil
+}
+
+func (s *IAMSigner) GoogleAccessID() string {
+	return s.serviceAccountEmail
+}
+
+func (s *IAMSigner) SignBytes(payload []byte) ([]byte, error) {
+	name := fmt.Sprintf("projects/-/serviceAccounts/%s", s.serviceAccountEmail)
+
+	response, err := s.service.Projects.ServiceAccounts.SignBlob(name, &iamcredentials.SignBlobRequest{
+		Payload: base64.StdEncoding.EncodeToString(payload),
+	}).Do()
+	if err != nil {
+		return nil, fmt.Errorf("error signing blob through iam: %w", err)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(response.SignedBlob)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding signed blob: %w", err)
+	}
+
+	return signature, nil
+}
@@ -0,0 +1,162 @@
+package firebasehelper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	fs "cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrGuildStorageQuota and ErrMemberStorageQuota are returned when a charge would take the guild or the member
+	// past their storage quota, nothing is charged.
+	ErrGuildStorageQuota  = errors.New("guild storage quota exceeded")
+	ErrMemberStorageQuota = errors.New("member storage quota exceeded")
+)
+
+// StorageUsage is how many bytes a guild's uploads take up, in total and by the member they were uploaded for.
+type StorageUsage struct {
+	Bytes   int64            `firestore:"bytes"`
+	Members map[string]int64 `firestore:"members"`
+}
+
+// StorageUsageFrom reads a usage document, a missing or malformed one is no usage.
+func StorageUsageFrom(data map[string]interface{}) StorageUsage {
+	usage := StorageUsage{Members: map[string]int64{}}
+	usage.Bytes, _ = data["bytes"].(int64)
+
+	members, _ := data["members"].(map[string]interface{})
+	for memberID, bytes := range members {
+		if bytes, ok := bytes.(int64); ok {
+			usage.Members[memberID] = bytes
+		}
+	}
+
+	return usage
+}
+
+// Add adjusts the guild's and the member's bytes by delta, neither goes below zero.
+func (u *StorageUsage) Add(memberID string, delta int64) {
+	if u.Members == nil {
+		u.Members = map[string]int64{}
+	}
+
+	u.Bytes = max(u.Bytes+delta, 0)
+
+	if bytes := u.Members[memberID] + delta; bytes > 0 {
+		u.Members[memberID] = bytes
+	} else {
+		delete(u.Members, memberID)
+	}
+}
+
+// StorageCharge is what an object was charged to, kept so deleting the object refunds the same guild and member.
+type StorageCharge struct {
+	GuildID  string `firestore:"guild_id"`
+	MemberID string `firestore:"member_id"`
+	Bytes    int64  `firestore:"bytes"`
+}
+
+// ChargeStorage adds charge to the guild's usage document in usageCollection and records it under object in
+// chargeCollection, both in one transaction so concurrent uploads can't overshoot a quota. A quota of zero is no
+// limit. An object that was already charged isn't charged again, the usage is returned either way.
+func (f *FirebaseAdapter) ChargeStorage(ctx context.Context, usageCollection string, chargeCollection string, object string, charge StorageCharge, guildQuota int64, memberQuota int64) (_ StorageUsage, err error) {
+	defer f.metrics.observe("charge_storage", usageCollection, time.Now(), &err)
+
+	usageRef := f.firestoreClient.Collection(usageCollection).Doc(charge.GuildID)
+	chargeRef := f.firestoreClient.Collection(chargeCollection).Doc(object)
+
+	var usage StorageUsage
+
+	err = f.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *fs.Transaction) error {
+		usage = StorageUsage{}
+
+		snapshot, err := tx.Get(usageRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+
+		if err == nil {
+			usage = StorageUsageFrom(snapshot.Data())
+		}
+
+		if _, err := tx.Get(chargeRef); err == nil {
+			return nil
+		} else if status.Code(err) != codes.NotFound {
+			return err
+		}
+
+		if guildQuota > 0 && usage.Bytes+charge.Bytes > guildQuota {
+			return ErrGuildStorageQuota
+		}
+
+		if memberQuota > 0 && usage.Members[charge.MemberID]+charge.Bytes > memberQuota {
+			return ErrMemberStorageQuota
+		}
+
+		usage.Add(charge.MemberID, charge.Bytes)
+
+		if err := tx.Set(usageRef, usage); err != nil {
+			return err
+		}
+
+		return tx.Create(chargeRef, charge)
+	})
+	if err != nil {
+		return StorageUsage{}, fmt.Errorf("error charging storage for %s: %w", object, err)
+	}
+
+	return usage, nil
+}
+
+// RefundStorage takes the charge recorded under object back off the usage it was added to, doing nothing when the
+// object was never charged.
+func (f *FirebaseAdapter) RefundStorage(ctx context.Context, usageCollection string, chargeCollection string, object string) (err error) {
+	defer f.metrics.observe("refund_storage", usageCollection, time.Now(), &err)
+
+	chargeRef := f.firestoreClient.Collection(chargeCollection).Doc(object)
+
+	err = f.firestoreClient.RunTransaction(ctx, func(ctx context.Context, tx *fs.Transaction) error {
+		chargeSnapshot, err := tx.Get(chargeRef)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return nil
+			}
+
+			return err
+		}
+
+		var charge StorageCharge
+		if err := chargeSnapshot.DataTo(&charge); err != nil {
+			return err
+		}
+
+		usageRef := f.firestoreClient.Collection(usageCollection).Doc(charge.GuildID)
+
+		// A guild whose data was cleaned up has no usage left to refund
+		snapshot, err := tx.Get(usageRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+
+		if err == nil {
+			usage := StorageUsageFrom(snapshot.Data())
+			usage.Add(charge.MemberID, -charge.Bytes)
+
+			if err := tx.Set(usageRef, usage); err != nil {
+				return err
+			}
+		}
+
+		return tx.Delete(chargeRef)
+	})
+	if err != nil {
+		return fmt.Errorf("error refunding storage for %s: %w", object, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,352 @@
+package greeter
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"salutations/internal/embeds"
+	"salutations/internal/voicelines"
+	util "salutations/pkg/util"
+
+	"cloud.google.com/go/firestore"
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// archiveListPageSize is how many archived tracks a page of /archive shows, each gets a button in every row
+const archiveListPageSize = 4
+
+var errNotArchived = errors.New("voiceline isn't in the archive")
+
+// archivedTrack is an object under a member's archive/<member id>/ prefix. collection and record are only known for
+// tracks archived with a departed member's voicelines, whose archive document still holds their records.
+type archivedTrack struct {
+	trackName  string
+	archivedAt time.Time
+	size       int64
+	collection string
+	record     map[string]interface{}
+}
+
+func archivePrefix(memberID string) string {
+	return fmt.Sprintf("archive/%s/", memberID)
+}
+
+// archivedTracks lists the member's archive, the most recently archived first.
+func (g *greeterRunner) archivedTracks(ctx context.Context, memberID string) ([]archivedTrack, error) {
+	objects, err := g.firebaseAdapter.ListObjects(ctx, g.bucket, archivePrefix(memberID))
+	if err != nil {
+		return nil, fmt.Errorf("error listing archived voicelines: %w", err)
+	}
+
+	document, err := g.firebaseAdapter.GetDocumentFromCollection(ctx, ArchivedCollection, memberID)
+	if err != nil && status.Code(err) != codes.NotFound {
+		return nil, fmt.Errorf("error getting archive document: %w", err)
+	}
+
+	tracks := make([]archivedTrack, 0, len(objects))
+
+	for _, object := range objects {
+		trackName := strings.TrimPrefix(object.Name, archivePrefix(memberID))
+		if trackName == "" || strings.Contains(trackName, "/") {
+			continue
+		}
+
+		track := archivedTrack{trackName: trackName, archivedAt: object.Created, size: object.Size}
+
+		for _, collection := range []string{WelcomeCollection, OutroCollection} {
+			records, _ := document[voicelines.ArrayKey(collection)].([]interface{})
+			for _, record := range records {
+				if recordMap, ok := record.(map[string]interface{}); ok && recordMap["track_name"] == trackName {
+					track.collection, track.record = collection, recordMap
+				}
+			}
+		}
+
+		tracks = append(tracks, track)
+	}
+
+	slices.SortFunc(tracks, func(a, b archivedTrack) int {
+		return cmp.Or(b.archivedAt.Compare(a.archivedAt), cmp.Compare(a.trackName, b.trackName))
+	})
+
+	return tracks, nil
+}
+
+// findArchivedTrack is the track in the member's archive with the short id, failing with errNotArchived when it's no
+// longer there.
+func (g *greeterRunner) findArchivedTrack(ctx context.Context, memberID string, shortID string) (archivedTrack, error) {
+	tracks, err := g.archivedTracks(ctx, memberID)
+	if err != nil {
+		return archivedTrack{}, err
+	}
+
+	for _, track := range tracks {
+		if voicelines.ShortID(track.trackName) == shortID {
+			return track, nil
+		}
+	}
+
+	return archivedTrack{}, errNotArchived
+}
+
+// forgetArchivedRecord takes a track that left the archive off the departed member's archive document, so reclaiming
+// doesn't look for it.
+func (g *greeterRunner) forgetArchivedRecord(ctx context.Context, memberID string, track archivedTrack) error {
+	if track.record == nil {
+		return nil
+	}
+
+	data := map[string]interface{}{voicelines.ArrayKey(track.collection): firestore.ArrayRemove(track.record)}
+
+	return g.firebaseAdapter.UpdateDocument(ctx, ArchivedCollection, memberID, data)
+}
+
+// restoreArchivedTrack moves an archived track back into the member's voicelines in collection.
+func (g *greeterRunner) restoreArchivedTrack(ctx context.Context, memberID string, collection string, restoredBy string, track archivedTrack) error {
+	archiveObject := archivePrefix(memberID) + track.trackName
+
+	if err := g.voicelineService.EnsureDocument(ctx, collection, memberID); err != nil {
+		return err
+	}
+
+	if err := g.firebaseAdapter.CloneFileFromStorage(ctx, g.bucket, archiveObject, voicelines.Object(track.trackName)); err != nil {
+		return fmt.Errorf("error restoring archived voiceline %s: %w", track.trackName, err)
+	}
+
+	if err := g.voicelineService.RestoreRef(ctx, track.trackName, collection, memberID); err != nil {
+		return err
+	}
+
+	tracks, err := g.voicelineService.Tracks(ctx, collection, memberID)
+	if err != nil {
+		return err
+	}
+
+	// A restore that failed to clean up after itself has already added the track
+	restored := slices.ContainsFunc(tracks, func(record interface{}) bool {
+		recordMap, ok := record.(map[string]interface{})
+		return ok && recordMap["track_name"] == track.trackName
+	})
+
+	if !restored {
+		if err := g.voicelineService.AppendTrack(ctx, collection, memberID, restoredBy, track.trackName); err != nil {
+			return err
+		}
+	}
+
+	if err := g.forgetArchivedRecord(ctx, memberID, track); err != nil {
+		return err
+	}
+
+	if err := g.firebaseAdapter.DeleteFileFromStorage(ctx, g.bucket, archiveObject); err != nil {
+		g.logger.Warn("unable to delete restored archive object", zap.Error(err), zap.String("object", archiveObject))
+	}
+
+	return nil
+}
+
+// deleteArchivedTrack permanently deletes an archived track, it can't be restored afterwards.
+func (g *greeterRunner) deleteArchivedTrack(ctx context.Context, memberID string, track archivedTrack) error {
+	if err := g.firebaseAdapter.DeleteFileFromStorage(ctx, g.bucket, archivePrefix(memberID)+track.trackName); err != nil {
+		return fmt.Errorf("error deleting archived voiceline %s: %w", track.trackName, err)
+	}
+
+	return g.forgetArchivedRecord(ctx, memberID, track)
+}
+
+// canManageArchive is whether the invoker can browse and restore the member's archive, their own or anyone's when
+// they can manage the server.
+func canManageArchive(interaction *discordgo.InteractionCreate, memberID string) bool {
+	return interaction.Member.User.ID == memberID || interaction.Member.Permissions&discordgo.PermissionManageServer != 0
+}
+
+// archivePage renders a page of the member's archive, a page past the end shows the last one since restores and
+// deletes shorten the archive under the buttons.
+func (g *greeterRunner) archivePage(ctx context.Context, interaction *discordgo.InteractionCreate, memberID string, page int) (*discordgo.InteractionResponseData, error) {
+	tracks, err := g.archivedTracks(ctx, memberID)
+	if err != nil {
+		return nil, err
+	}
+
+	pages := max((len(tracks)+archiveListPageSize-1)/archiveListPageSize, 1)
+	page = min(max(page, 0), pages-1)
+	pageTracks := tracks[page*archiveListPageSize : min(len(tracks), (page+1)*archiveListPageSize)]
+
+	listed := make([]embeds.ArchivedTrack, 0, len(pageTracks))
+	introIDs, outroIDs, deleteIDs := []string{}, []string{}, []string{}
+	args := []string{strconv.Itoa(page)}
+
+	for _, track := range pageTracks {
+		shortID := voicelines.ShortID(track.trackName)
+
+		audioType := ""
+		if track.collection != "" {
+			audioType = voicelines.AudioTypeFor(track.collection)
+		}
+
+		listed = append(listed, embeds.ArchivedTrack{ShortID: shortID, AudioType: audioType, ArchivedAt: track.archivedAt, Size: track.size})
+
+		restoreID := util.CustomID{Action: archiveRestorePrefix, GuildID: interaction.GuildID, MemberID: memberID, Nonce: shortID, Args: args}
+		restoreID.Collection = WelcomeCollection
+		introIDs = append(introIDs, restoreID.Encode())
+		restoreID.Collection = OutroCollection
+		outroIDs = append(outroIDs, restoreID.Encode())
+
+		// Only moderators get to delete for good
+		if interaction.Member.Permissions&discordgo.PermissionManageServer != 0 {
+			deleteIDs = append(deleteIDs, util.CustomID{Action: archiveDeletePrefix, GuildID: interaction.GuildID, MemberID: memberID, Nonce: shortID, Args: args}.Encode())
+		}
+	}
+
+	pageID := func(page int) string {
+		return util.CustomID{Action: archivePagePrefix, GuildID: interaction.GuildID, MemberID: memberID, Args: []string{strconv.Itoa(page)}}.Encode()
+	}
+
+	firstNumber := page*archiveListPageSize + 1
+
+	return &discordgo.InteractionResponseData{
+		Embeds:     []*discordgo.MessageEmbed{embeds.ArchiveEmbed(memberID, listed, firstNumber, page, pages)},
+		Components: embeds.ArchiveComponents(introIDs, outroIDs, deleteIDs, firstNumber, pageID(max(page-1, 0)), pageID(min(page+1, pages-1)), page, pages),
+	}, nil
+}
+
+func (g *greeterRunner) archive(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	ctx := context.Background()
+
+	memberID := interaction.Member.User.ID
+	for _, option := range interaction.ApplicationCommandData().Options {
+		if option.Name == "member" {
+			memberID = option.UserValue(nil).ID
+		}
+	}
+
+	if !canManageArchive(interaction, memberID) {
+		_, err := util.SendFollowup(ctx, session, interaction.Interaction, &discordgo.WebhookParams{
+			Embeds: []*discordgo.MessageEmbed{embeds.ErrorMessageEmbed("You can only browse your own archive unless you can manage this server")},
+		})
+
+		return err
+	}
+
+	data, err := g.archivePage(ctx, interaction, memberID, 0)
+	if err != nil {
+		return err
+	}
+
+	_, err = util.SendFollowup(ctx, session, interaction.Interaction, &discordgo.WebhookParams{
+		Embeds:     data.Embeds,
+		Components: data.Components,
+	})
+
+	return err
+}
+
+// archiveComponentPage decodes an archive button, the returned page is the one it was pressed on or leads to.
+func archiveComponentPage(interaction *discordgo.InteractionCreate) (util.CustomID, int, error) {
+	customID, err := util.DecodeCustomID(interaction.MessageComponentData().CustomID)
+	if err != nil || customID.GuildID != interaction.GuildID || len(customID.Args) != 1 {
+		return util.CustomID{}, 0, fmt.Errorf("malformed archive custom id: %s", interaction.MessageComponentData().CustomID)
+	}
+
+	page, err := strconv.Atoi(customID.Args[0])
+	if err != nil {
+		return util.CustomID{}, 0, fmt.Errorf("malformed archive custom id: %s", interaction.MessageComponentData().CustomID)
+	}
+
+	return customID, page, nil
+}
+
+// updateArchivePage re-renders the archive message the button was pressed on.
+func (g *greeterRunner) updateArchivePage(ctx context.Context, session *discordgo.Session, interaction *discordgo.InteractionCreate, memberID string, page int) error {
+	data, err := g.archivePage(ctx, interaction, memberID, page)
+	if err != nil {
+		return err
+	}
+
+	return session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: data,
+	})
+}
+
+func (g *greeterRunner) archivePageTurn(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	customID, page, err := archiveComponentPage(interaction)
+	if err != nil {
+		return err
+	}
+
+	if !canManageArchive(interaction, customID.MemberID) {
+		return g.respondEphemeral(session, interaction, embeds.ErrorMessageEmbed("You can only browse your own archive unless you can manage this server"))
+	}
+
+	return g.updateArchivePage(context.Background(), session, interaction, customID.MemberID, page)
+}
+
+func (g *greeterRunner) archiveRestore(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	customID, page, err := archiveComponentPage(interaction)
+	if err != nil {
+		return err
+	}
+
+	if customID.Collection != WelcomeCollection && customID.Collection != OutroCollection {
+		return fmt.Errorf("archive restore custom id has unknown collection: %s", customID.Collection)
+	}
+
+	if !canManageArchive(interaction, customID.MemberID) {
+		return g.respondEphemeral(session, interaction, embeds.ErrorMessageEmbed("You can only restore your own voicelines unless you can manage this server"))
+	}
+
+	ctx := context.Background()
+
+	track, err := g.findArchivedTrack(ctx, customID.MemberID, customID.Nonce)
+	if errors.Is(err, errNotArchived) {
+		return g.respondEphemeral(session, interaction, embeds.ErrorMessageEmbed("That voiceline isn't in the archive anymore"))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := g.restoreArchivedTrack(ctx, customID.MemberID, customID.Collection, interaction.Member.User.ID, track); err != nil {
+		return err
+	}
+
+	g.logger.Info("archived voiceline restored", zap.String("guild_id", interaction.GuildID), zap.String("user_id", customID.MemberID), zap.String("track_name", track.trackName), zap.String("collection", customID.Collection), zap.String("restored_by", interaction.Member.User.ID))
+
+	return g.updateArchivePage(ctx, session, interaction, customID.MemberID, page)
+}
+
+func (g *greeterRunner) archiveDelete(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	customID, page, err := archiveComponentPage(interaction)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	track, err := g.findArchivedTrack(ctx, customID.MemberID, customID.Nonce)
+	if errors.Is(err, errNotArchived) {
+		return g.respondEphemeral(session, interaction, embeds.ErrorMessageEmbed("That voiceline isn't in the archive anymore"))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := g.deleteArchivedTrack(ctx, customID.MemberID, track); err != nil {
+		return err
+	}
+
+	g.logger.Info("archived voiceline deleted", zap.String("guild_id", interaction.GuildID), zap.String("user_id", customID.MemberID), zap.String("track_name", track.trackName), zap.String("deleted_by", interaction.Member.User.ID))
+
+	return g.updateArchivePage(ctx, session, interaction, customID.MemberID, page)
+}
@@ -0,0 +1,128 @@
+package greeter
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// blacklistCacheTTL bounds how stale a cached record can get while the blacklist watch is down
+	blacklistCacheTTL = time.Minute * 5
+	// blacklistWatchRetry is how long to wait before watching the blacklist again after the watch fails
+	blacklistWatchRetry = time.Second * 30
+)
+
+type cachedBlacklistRecord struct {
+	// data is nil for members without a record
+	data      map[string]interface{}
+	fetchedAt time.Time
+}
+
+// blacklistCache holds members' blacklist records so voice events don't read firestore each time. Invalidating
+// bumps the generation, a read that started before an invalidation isn't cached since it may be from before the change.
+type blacklistCache struct {
+	mu         sync.Mutex
+	records    map[string]cachedBlacklistRecord
+	generation uint64
+}
+
+func newBlacklistCache() *blacklistCache {
+	return &blacklistCache{records: make(map[string]cachedBlacklistRecord)}
+}
+
+func (c *blacklistCache) get(memberID string, now time.Time) (map[string]interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	record, ok := c.records[memberID]
+	if !ok || now.Sub(record.fetchedAt) >= blacklistCacheTTL {
+		return nil, false
+	}
+
+	return record.data, true
+}
+
+// begin returns the generation a read is starting at, to be handed to put.
+func (c *blacklistCache) begin() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.generation
+}
+
+func (c *blacklistCache) put(memberID string, data map[string]interface{}, generation uint64, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	c.records[memberID] = cachedBlacklistRecord{data: data, fetchedAt: now}
+}
+
+func (c *blacklistCache) invalidate(memberID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	delete(c.records, memberID)
+}
+
+// purge drops every cached record, returning how many there were.
+func (c *blacklistCache) purge() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	purged := len(c.records)
+	c.generation++
+	c.records = make(map[string]cachedBlacklistRecord)
+
+	return purged
+}
+
+// blacklistRecord reads the member's blacklist record through the cache, nil when they don't have one.
+func (g *greeterRunner) blacklistRecord(ctx context.Context, memberID string) (map[string]interface{}, error) {
+	if data, ok := g.blacklistCache.get(memberID, g.clock.Now()); ok {
+		return data, nil
+	}
+
+	generation := g.blacklistCache.begin()
+
+	data, err := g.voicelineService.BlacklistRecord(ctx, memberID)
+	if err != nil {
+		return nil, err
+	}
+
+	g.blacklistCache.put(memberID, data, generation, g.clock.Now())
+
+	return data, nil
+}
+
+// watchBlacklist drops cached records as blacklist documents change, so changes made by other instances or directly
+// in firestore apply straight away. The cache is purged whenever the watch (re)starts since changes may have been
+// missed while it was down.
+func (g *greeterRunner) watchBlacklist(ctx context.Context) {
+	for {
+		g.blacklistCache.purge()
+
+		err := g.firebaseAdapter.WatchCollection(ctx, BlacklistCollection, g.blacklistCache.invalidate)
+		if ctx.Err() != nil {
+			return
+		}
+
+		g.logger.Warn("blacklist watch stopped, cached records will expire on their own until it's restarted", zap.Error(err))
+
+		retry := make(chan struct{})
+		g.clock.AfterFunc(blacklistWatchRetry, func() { close(retry) })
+
+		select {
+		case <-retry:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
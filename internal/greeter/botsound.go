@@ -0,0 +1,167 @@
+package greeter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"salutations/internal/embeds"
+	firebaseAdapter "salutations/internal/firebase"
+	util "salutations/pkg/util"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// maxBotSoundBytes keeps the bot sound to a short stinger rather than a song
+const maxBotSoundBytes = 1 << 20
+
+// queueBotSound downloads the guild's bot sound so it plays ahead of the greeting that made the bot join, before the new player
+// is shared.
+func (g *greeterRunner) queueBotSound(ctx context.Context, logger *zap.Logger, guildPlayer *guildPlayer, location firebaseAdapter.Location, objectName string) {
+	if objectName == "" {
+		return
+	}
+
+	audioBytes, err := g.firebaseAdapter.DownloadFileBytes(ctx, location.Bucket, location.Object(objectName))
+	if err != nil {
+		logger.Warn("unable to download bot sound", zap.Error(err), zap.String("object", objectName))
+		return
+	}
+
+	file, err := util.DownloadFileToTempDirectory(audioBytes)
+	if err != nil {
+		logger.Warn("unable to save bot sound to temporary directory", zap.Error(err))
+		return
+	}
+
+	guildPlayer.queue = append(guildPlayer.queue, queuedClip{audioPath: file.Name(), trackName: "bot sound"})
+}
+
+func (g *greeterRunner) setBotSound(ctx context.Context, guildID string, attachment *discordgo.MessageAttachment) error {
+	objectName, err := g.uploadGuildAudio(ctx, "botsounds", guildID, attachment)
+	if err != nil {
+		return fmt.Errorf("error uploading bot sound: %w", err)
+	}
+
+	previous := g.guildSettings(ctx, guildID).BotSound
+
+	if err := g.settings.SetBotSound(ctx, guildID, objectName); err != nil {
+		return err
+	}
+
+	g.deleteGuildAudio(ctx, guildID, previous)
+
+	return nil
+}
+
+// uploadGuildAudio stores an attachment as <folder>/<guild id>/<uuid> in the guild's storage, returning the object name.
+// The name is relative to the guild's storage prefix.
+func (g *greeterRunner) uploadGuildAudio(ctx context.Context, folder string, guildID string, attachment *discordgo.MessageAttachment) (string, error) {
+	file, err := g.downloadAttachment(ctx, "", attachment.URL)
+	if err != nil {
+		return "", fmt.Errorf("error attempting to download discord file: %w", err)
+	}
+
+	defer func() {
+		// The upload closes whichever file it's given, the original is left open when it was transcoded
+		file.Close()
+
+		if err := util.DeleteFile(file.Name()); err != nil {
+			g.logger.Warn("error trying to delete file", zap.Error(err), zap.String("file_name", file.Name()))
+		}
+	}()
+
+	audio, err := g.canonicalizeUpload(ctx, "", file)
+	if err != nil {
+		return "", fmt.Errorf("error converting %s to mp3: %w", folder, err)
+	}
+
+	defer audio.cleanup(g.logger)
+
+	soundID, err := uuid.NewV7()
+	if err != nil {
+		return "", fmt.Errorf("error generating object name: %w", err)
+	}
+
+	location := g.guildStorage(ctx, guildID)
+
+	objectName := fmt.Sprintf("%s/%s/%s", folder, guildID, soundID.String())
+	if err := g.firebaseAdapter.UploadFileToStorage(ctx, location.Bucket, location.Object(objectName), audio.file, soundID.String()); err != nil {
+		return "", err
+	}
+
+	return objectName, nil
+}
+
+func (g *greeterRunner) deleteGuildAudio(ctx context.Context, guildID string, objectName string) {
+	if objectName == "" {
+		return
+	}
+
+	location := g.guildStorage(ctx, guildID)
+	if err := g.firebaseAdapter.DeleteFileFromStorage(ctx, location.Bucket, location.Object(objectName)); err != nil {
+		g.logger.Warn("unable to delete previous guild audio", zap.Error(err), zap.String("object", objectName))
+	}
+}
+
+func (g *greeterRunner) botSound(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	if g.settings == nil {
+		return errors.New("guild settings are not configured")
+	}
+
+	ctx := context.Background()
+	subcommand := interaction.ApplicationCommandData().Options[0]
+
+	var description string
+
+	switch subcommand.Name {
+	case "set":
+		attachmentID, _ := subcommand.Options[0].Value.(string)
+		attachment, ok := interaction.ApplicationCommandData().Resolved.Attachments[attachmentID]
+		if !ok {
+			return fmt.Errorf("attachment %s was not resolved", attachmentID)
+		}
+
+		if FileType(attachment.ContentType) != mp3 && FileType(attachment.ContentType) != mp4 {
+			_, err := util.SendFollowup(ctx, session, interaction.Interaction, &discordgo.WebhookParams{
+				Embeds: []*discordgo.MessageEmbed{embeds.ErrorMessageEmbed("The bot sound has to be an .mp3 or .m4a file")},
+			})
+
+			return err
+		}
+
+		if attachment.Size > maxBotSoundBytes {
+			_, err := util.SendFollowup(ctx, session, interaction.Interaction, &discordgo.WebhookParams{
+				Embeds: []*discordgo.MessageEmbed{embeds.ErrorMessageEmbed("The bot sound has to be a short clip under 1 MB")},
+			})
+
+			return err
+		}
+
+		if err := g.setBotSound(ctx, interaction.GuildID, attachment); err != nil {
+			return fmt.Errorf("error setting bot sound: %w", err)
+		}
+
+		description = "I'll play that sound whenever I join a voice channel in this server"
+	case "clear":
+		previous := g.guildSettings(ctx, interaction.GuildID).BotSound
+
+		if err := g.settings.SetBotSound(ctx, interaction.GuildID, ""); err != nil {
+			return fmt.Errorf("error clearing bot sound: %w", err)
+		}
+
+		g.deleteGuildAudio(ctx, interaction.GuildID, previous)
+
+		description = "I'll join voice channels quietly from now on"
+	default:
+		return fmt.Errorf("unknown botsound subcommand: %s", subcommand.Name)
+	}
+
+	_, err := util.SendFollowup(ctx, session, interaction.Interaction, &discordgo.WebhookParams{
+		Embeds: []*discordgo.MessageEmbed{embeds.SettingsUpdatedEmbed(description)},
+	})
+
+	return err
+}
@@ -0,0 +1,85 @@
+package greeter
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// greetingCaps remembers when greetings were played so guilds can cap them per channel each hour and per guild each day.
+// Only guilds with a cap configured are tracked.
+type greetingCaps struct {
+	mu       sync.Mutex
+	channels map[string][]time.Time
+	guilds   map[string][]time.Time
+}
+
+func newGreetingCaps() *greetingCaps {
+	return &greetingCaps{
+		channels: make(map[string][]time.Time),
+		guilds:   make(map[string][]time.Time),
+	}
+}
+
+// pruneBefore drops the plays older than cutoff, plays are appended in order so they're already sorted.
+func pruneBefore(plays []time.Time, cutoff time.Time) []time.Time {
+	for i, playedAt := range plays {
+		if playedAt.After(cutoff) {
+			return plays[i:]
+		}
+	}
+
+	return nil
+}
+
+// allow reports whether another greeting fits under the caps and records it if so, a cap of zero is unlimited.
+func (c *greetingCaps) allow(guildID string, channelID string, now time.Time, hourlyPerChannel int64, dailyPerGuild int64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	channelKey := guildID + "/" + channelID
+	channelPlays := pruneBefore(c.channels[channelKey], now.Add(-time.Hour))
+	guildPlays := pruneBefore(c.guilds[guildID], now.Add(-time.Hour*24))
+
+	allowed := (hourlyPerChannel == 0 || int64(len(channelPlays)) < hourlyPerChannel) && (dailyPerGuild == 0 || int64(len(guildPlays)) < dailyPerGuild)
+	if allowed {
+		channelPlays = append(channelPlays, now)
+		guildPlays = append(guildPlays, now)
+	}
+
+	if hourlyPerChannel > 0 {
+		c.channels[channelKey] = channelPlays
+	} else {
+		delete(c.channels, channelKey)
+	}
+
+	if dailyPerGuild > 0 {
+		c.guilds[guildID] = guildPlays
+	} else {
+		delete(c.guilds, guildID)
+	}
+
+	return allowed
+}
+
+// recordGreetingSkip keeps a record of greetings skipped by a cap so /guildstats can show how often caps kick in.
+func (g *greeterRunner) recordGreetingSkip(ctx context.Context, logger *zap.Logger, guildID string, userID string, collection string) {
+	recordID, err := uuid.NewV7()
+	if err != nil {
+		logger.Warn("unable to generate greeting skip id", zap.Error(err))
+		return
+	}
+
+	err = g.firebaseAdapter.CreateDocument(ctx, GreetingSkipsCollection, recordID.String(), greetingPlayRecord{
+		GuildID:    guildID,
+		UserID:     userID,
+		Collection: collection,
+		PlayedAt:   g.clock.Now(),
+	})
+	if err != nil {
+		logger.Warn("unable to record greeting skip", zap.Error(err))
+	}
+}
@@ -0,0 +1,79 @@
+package greeter
+
+import (
+	"fmt"
+	"time"
+
+	"salutations/internal/embeds"
+	util "salutations/pkg/util"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// voiceChannelProblems checks every voice and stage channel in the guild for the permissions the bot needs to greet,
+// returning how many channels were checked along with the ones missing something.
+func voiceChannelProblems(session *discordgo.Session, guildID string) (int, []embeds.ChannelPermissionProblem, error) {
+	guild, err := session.State.Guild(guildID)
+	if err != nil {
+		return 0, nil, fmt.Errorf("error getting guild: %w", err)
+	}
+
+	checked := 0
+	problems := []embeds.ChannelPermissionProblem{}
+
+	for _, channel := range guild.Channels {
+		if channel.Type != discordgo.ChannelTypeGuildVoice && channel.Type != discordgo.ChannelTypeGuildStageVoice {
+			continue
+		}
+
+		checked++
+
+		perms, err := session.UserChannelPermissions(session.State.Ready.User.ID, channel.ID)
+		if err != nil {
+			return 0, nil, fmt.Errorf("error getting permissions for channel %s: %w", channel.ID, err)
+		}
+
+		if missing := missingVoicePermissions(perms); len(missing) > 0 {
+			problems = append(problems, embeds.ChannelPermissionProblem{ChannelID: channel.ID, Missing: missing})
+		}
+	}
+
+	return checked, problems, nil
+}
+
+func (g *greeterRunner) checkPerms(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	checked, problems, err := voiceChannelProblems(session, interaction.GuildID)
+	if err != nil {
+		return err
+	}
+
+	pages := embeds.CheckPermsEmbeds(checked, problems)
+
+	data := &discordgo.InteractionResponseData{
+		Embeds: []*discordgo.MessageEmbed{pages[0]},
+	}
+
+	if len(pages) > 1 {
+		data.Components = embeds.GetPaginationComponent(util.CustomID{GuildID: interaction.GuildID}, 0, len(pages))
+	}
+
+	if err := session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: data,
+	}); err != nil {
+		return err
+	}
+
+	message, err := session.InteractionResponse(interaction.Interaction)
+	if err != nil {
+		return err
+	}
+
+	if len(pages) > 1 {
+		g.messageStore.put(message.ID, &paginationState{Pages: pages})
+	}
+
+	g.messageDeleter.DeleteAfter(session, interaction.ChannelID, message.ID, time.Minute*2)
+
+	return nil
+}
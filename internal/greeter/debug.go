@@ -0,0 +1,89 @@
+package greeter
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"salutations/internal/embeds"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// voiceDebugState snapshots the guild's player so it can be rendered without holding the lock.
+func (g *greeterRunner) voiceDebugState(session *discordgo.Session, guildID string) embeds.VoiceDebug {
+	debug := embeds.VoiceDebug{DryRun: g.dryRun}
+
+	session.RLock()
+	if connection, ok := session.VoiceConnections[guildID]; ok {
+		connection.RLock()
+		debug.SessionChannelID = connection.ChannelID
+		debug.SessionReady = connection.Ready
+		connection.RUnlock()
+	}
+	session.RUnlock()
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	player, ok := g.guildPlayerMappings[guildID]
+	if !ok {
+		return debug
+	}
+
+	debug.HasPlayer = true
+	debug.VoiceState = string(player.voiceState)
+
+	if player.voiceClient != nil {
+		debug.PlayerChannelID = player.voiceClient.ChannelID
+	}
+
+	for _, clip := range player.queue {
+		debug.Queue = append(debug.Queue, filepath.Base(clip.audioPath))
+	}
+
+	if player.stream != nil {
+		debug.HasStream = true
+		debug.PlaybackPosition = player.stream.PlaybackPosition()
+		debug.StreamFinished, _ = player.stream.Finished()
+	}
+
+	debug.LastLatency = player.lastLatency
+
+	if quality, ok := g.voiceQualities.snapshot(guildID); ok {
+		debug.VoiceRegion = voiceRegion(quality.endpoint)
+		debug.VoiceEndpoint = quality.endpoint
+		debug.ProbeRTT = quality.rtt()
+		debug.ProbeLoss = quality.loss()
+		debug.Probes = len(quality.probes)
+		debug.PlaybackLag = quality.playbackLag
+		debug.Reconnects = quality.reconnects
+		debug.LastReconnectAt = quality.lastReconnectAt
+	}
+
+	if player.lastError != nil {
+		debug.LastError = player.lastError.Error()
+		debug.LastErrorAt = player.lastErrorAt
+	}
+
+	return debug
+}
+
+func (g *greeterRunner) debug(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	options := interaction.ApplicationCommandData().Options
+	if len(options) == 0 {
+		return errors.New("debug command invoked without a subcommand")
+	}
+
+	if options[0].Name != "voice" {
+		return fmt.Errorf("unknown debug subcommand: %s", options[0].Name)
+	}
+
+	return session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{embeds.VoiceDebugEmbed(g.voiceDebugState(session, interaction.GuildID))},
+			Flags:  discordgo.MessageFlagsEphemeral,
+		},
+	})
+}
@@ -0,0 +1,166 @@
+package greeter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"salutations/internal/embeds"
+	firebaseAdapter "salutations/internal/firebase"
+	util "salutations/pkg/util"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+)
+
+// maxDefaultGreetingBytes keeps default greetings short, they play for everyone who hasn't uploaded their own
+const maxDefaultGreetingBytes = 5 << 20
+
+// defaultGreetingObject picks the storage object played for members without voicelines of their own and where it's
+// stored, the guild's uploaded default comes before its voice pack and an empty name means there is nothing to fall
+// back on. During an event the event pack comes before both.
+func (g *greeterRunner) defaultGreetingObject(ctx context.Context, guildID string, collection string) (firebaseAdapter.Location, string, error) {
+	guildSettings := g.guildSettings(ctx, guildID)
+
+	defaultGreeting := guildSettings.DefaultOutro
+	if collection == WelcomeCollection {
+		defaultGreeting = guildSettings.DefaultIntro
+	}
+
+	packID := guildSettings.VoicePack
+	if guildSettings.EventModeActive(g.clock.Now()) && guildSettings.EventPack != "" {
+		packID, defaultGreeting = guildSettings.EventPack, ""
+	}
+
+	if defaultGreeting != "" {
+		return guildSettings.Storage(g.bucket), defaultGreeting, nil
+	}
+
+	// Voice packs are shared by every guild, so they stay in the greeter's bucket
+	packStorage := firebaseAdapter.Location{Bucket: g.bucket}
+
+	if packID == "" {
+		return packStorage, "", nil
+	}
+
+	objectNames, err := g.packClips(ctx, packID, collection)
+	if err != nil || len(objectNames) == 0 {
+		return packStorage, "", err
+	}
+
+	return packStorage, objectNames[g.rand.Intn(len(objectNames))], nil
+}
+
+// downloadDefaultGreeting is downloadGreeting's fallback, default greetings aren't announced since they aren't the member's.
+func (g *greeterRunner) downloadDefaultGreeting(ctx context.Context, logger *zap.Logger, collection string, vc *discordgo.VoiceStateUpdate) ([]queuedClip, bool) {
+	location, objectName, err := g.defaultGreetingObject(ctx, vc.GuildID, collection)
+	if err != nil {
+		logger.Error("failed to pick default greeting", zap.Error(err))
+		return nil, false
+	}
+
+	if objectName == "" {
+		return nil, false
+	}
+
+	audioPath, err := g.downloadObject(ctx, location, objectName, vc)
+	if err != nil {
+		logger.Error("failed to download default greeting", zap.Error(err), zap.String("object", objectName))
+		return nil, false
+	}
+
+	logger.Debug("default greeting selected", zap.String("object", objectName), zap.String("collection", collection))
+
+	trackName := objectName[strings.LastIndex(objectName, "/")+1:]
+
+	return []queuedClip{{audioPath: audioPath, memberID: vc.UserID, trackName: trackName, collection: collection}}, true
+}
+
+func (g *greeterRunner) setDefaultGreeting(ctx context.Context, guildID string, audioType string, attachment *discordgo.MessageAttachment) error {
+	objectName := ""
+	if attachment != nil {
+		var err error
+		if objectName, err = g.uploadGuildAudio(ctx, "defaultgreetings", guildID, attachment); err != nil {
+			return fmt.Errorf("error uploading default greeting: %w", err)
+		}
+	}
+
+	guildSettings := g.guildSettings(ctx, guildID)
+	previous := guildSettings.DefaultOutro
+	if audioType == "intro" {
+		previous = guildSettings.DefaultIntro
+	}
+
+	if err := g.settings.SetDefaultGreeting(ctx, guildID, audioType, objectName); err != nil {
+		return err
+	}
+
+	g.deleteGuildAudio(ctx, guildID, previous)
+
+	return nil
+}
+
+// uploadDefault sets the guild's default intro or outro, leaving the file out clears it.
+func (g *greeterRunner) uploadDefault(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	ctx := context.Background()
+
+	if g.settings == nil {
+		return errors.New("guild settings are not configured")
+	}
+
+	data := interaction.ApplicationCommandData()
+
+	audioType := "intro"
+	var attachment *discordgo.MessageAttachment
+
+	for _, option := range data.Options {
+		switch option.Name {
+		case "type":
+			audioType = option.StringValue()
+		case "file":
+			attachmentID, _ := option.Value.(string)
+
+			resolved, ok := data.Resolved.Attachments[attachmentID]
+			if !ok {
+				return fmt.Errorf("attachment %s was not resolved", attachmentID)
+			}
+
+			attachment = resolved
+		}
+	}
+
+	if attachment != nil {
+		var problem string
+
+		switch {
+		case FileType(attachment.ContentType) != mp3 && FileType(attachment.ContentType) != mp4:
+			problem = "The default greeting has to be an .mp3 or .m4a file"
+		case attachment.Size > maxDefaultGreetingBytes:
+			problem = "The default greeting has to be a short clip under 5 MB"
+		}
+
+		if problem != "" {
+			_, err := util.SendFollowup(ctx, session, interaction.Interaction, &discordgo.WebhookParams{
+				Embeds: []*discordgo.MessageEmbed{embeds.ErrorMessageEmbed(problem)},
+			})
+
+			return err
+		}
+	}
+
+	if err := g.setDefaultGreeting(ctx, interaction.GuildID, audioType, attachment); err != nil {
+		return fmt.Errorf("error setting default greeting: %w", err)
+	}
+
+	description := fmt.Sprintf("Members without their own %s will hear that one instead", audioType)
+	if attachment == nil {
+		description = fmt.Sprintf("Removed the default %s, members without their own fall back to the voice pack if one is installed", audioType)
+	}
+
+	_, err := util.SendFollowup(ctx, session, interaction.Interaction, &discordgo.WebhookParams{
+		Embeds: []*discordgo.MessageEmbed{embeds.SettingsUpdatedEmbed(description)},
+	})
+
+	return err
+}
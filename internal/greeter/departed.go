@@ -0,0 +1,399 @@
+package greeter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"salutations/internal/embeds"
+	"salutations/internal/voicelines"
+	util "salutations/pkg/util"
+
+	"cloud.google.com/go/firestore"
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	firebaseAdapter "salutations/internal/firebase"
+)
+
+var errMemberStillShared = errors.New("member is still in another server with the bot")
+
+type departedRecord struct {
+	GuildID    string    `firestore:"guild_id"`
+	UserID     string    `firestore:"user_id"`
+	Username   string    `firestore:"username"`
+	DepartedAt time.Time `firestore:"departed_at"`
+}
+
+type archivedRecord struct {
+	Name         string                   `firestore:"name"`
+	ArchivedFrom string                   `firestore:"archived_from"`
+	IntroArray   []voicelines.TrackRecord `firestore:"intro_array"`
+	OutroArray   []voicelines.TrackRecord `firestore:"outro_array"`
+}
+
+func departedDocumentID(guildID string, userID string) string {
+	return guildID + "_" + userID
+}
+
+func (g *greeterRunner) memberRemove(_ *discordgo.Session, event *discordgo.GuildMemberRemove) {
+	if event.User == nil || event.User.Bot {
+		return
+	}
+
+	ctx := context.Background()
+	documentID := departedDocumentID(event.GuildID, event.User.ID)
+
+	// Members can leave, rejoin and leave again, only the latest departure is kept
+	if err := g.firebaseAdapter.DeleteDocument(ctx, DepartedCollection, documentID); err != nil {
+		g.logger.Warn("unable to clear previous departure", zap.Error(err), zap.String("guild_id", event.GuildID), zap.String("user_id", event.User.ID))
+	}
+
+	err := g.firebaseAdapter.CreateDocument(ctx, DepartedCollection, documentID, departedRecord{
+		GuildID:    event.GuildID,
+		UserID:     event.User.ID,
+		Username:   event.User.Username,
+		DepartedAt: g.clock.Now(),
+	})
+	if err != nil {
+		g.logger.Error("unable to record departed member", zap.Error(err), zap.String("guild_id", event.GuildID), zap.String("user_id", event.User.ID))
+	}
+}
+
+func (g *greeterRunner) memberAdd(_ *discordgo.Session, event *discordgo.GuildMemberAdd) {
+	if event.User == nil || event.User.Bot {
+		return
+	}
+
+	if err := g.firebaseAdapter.DeleteDocument(context.Background(), DepartedCollection, departedDocumentID(event.GuildID, event.User.ID)); err != nil {
+		g.logger.Warn("unable to clear departure for returning member", zap.Error(err), zap.String("guild_id", event.GuildID), zap.String("user_id", event.User.ID))
+	}
+}
+
+// sharesAnotherGuild reports whether the member is in any guild the bot is in other than guildID. Voicelines
+// belong to the member rather than a guild, so they are only touched once no other server would play them.
+func sharesAnotherGuild(session *discordgo.Session, guildID string, memberID string) bool {
+	session.State.RLock()
+	guildIDs := make([]string, 0, len(session.State.Guilds))
+	for _, guild := range session.State.Guilds {
+		guildIDs = append(guildIDs, guild.ID)
+	}
+	session.State.RUnlock()
+
+	for _, otherGuildID := range guildIDs {
+		if otherGuildID == guildID {
+			continue
+		}
+
+		if _, err := session.State.Member(otherGuildID, memberID); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (g *greeterRunner) departedMembers(ctx context.Context, guildID string) ([]departedRecord, error) {
+	documents, err := g.firebaseAdapter.QueryDocuments(ctx, DepartedCollection, firebaseAdapter.QueryFilter{Path: "guild_id", Op: "==", Value: guildID})
+	if err != nil {
+		return nil, fmt.Errorf("error querying departed members: %w", err)
+	}
+
+	departed := make([]departedRecord, 0, len(documents))
+	for _, document := range documents {
+		record := departedRecord{GuildID: guildID}
+		record.UserID, _ = document["user_id"].(string)
+		record.Username, _ = document["username"].(string)
+		record.DepartedAt, _ = document["departed_at"].(time.Time)
+		departed = append(departed, record)
+	}
+
+	slices.SortFunc(departed, func(a, b departedRecord) int { return b.DepartedAt.Compare(a.DepartedAt) })
+
+	return departed, nil
+}
+
+// archiveMemberVoicelines moves every voiceline the member has into the archive so that they can reclaim them later.
+func (g *greeterRunner) archiveMemberVoicelines(ctx context.Context, guildID string, memberID string) (int, error) {
+	archived := 0
+	records := map[string][]interface{}{}
+
+	for _, collection := range []string{WelcomeCollection, OutroCollection} {
+		tracks, err := g.voicelineService.Tracks(ctx, collection, memberID)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				continue
+			}
+
+			return archived, err
+		}
+
+		trackNames := []string{}
+		for _, track := range tracks {
+			if record, ok := track.(map[string]interface{}); ok {
+				if trackName, ok := record["track_name"].(string); ok {
+					trackNames = append(trackNames, trackName)
+				}
+			}
+		}
+
+		if err := g.removeVoicelines(ctx, collection, memberID, trackNames); err != nil {
+			return archived, err
+		}
+
+		audioListKey := OutroArrayKey
+		if collection == WelcomeCollection {
+			audioListKey = IntroArrayKey
+		}
+
+		records[audioListKey] = tracks
+		archived += len(trackNames)
+	}
+
+	if archived == 0 {
+		return 0, nil
+	}
+
+	err := g.firebaseAdapter.CreateDocument(ctx, ArchivedCollection, memberID, archivedRecord{
+		Name:         memberID,
+		ArchivedFrom: guildID,
+		IntroArray:   []voicelines.TrackRecord{},
+		OutroArray:   []voicelines.TrackRecord{},
+	})
+	if err != nil && status.Code(err) != codes.AlreadyExists {
+		return archived, fmt.Errorf("error creating archive document: %w", err)
+	}
+
+	data := map[string]interface{}{"archived_from": guildID}
+	for audioListKey, tracks := range records {
+		data[audioListKey] = firestore.ArrayUnion(tracks...)
+	}
+
+	if err := g.firebaseAdapter.UpdateDocument(ctx, ArchivedCollection, memberID, data); err != nil {
+		return archived, fmt.Errorf("error recording archived voicelines: %w", err)
+	}
+
+	return archived, nil
+}
+
+// purgeMemberVoicelines permanently deletes the member's voicelines, including any they have archived.
+func (g *greeterRunner) purgeMemberVoicelines(ctx context.Context, memberID string) (int, error) {
+	purged := 0
+
+	for _, collection := range []string{WelcomeCollection, OutroCollection} {
+		tracks, err := g.voicelineService.Tracks(ctx, collection, memberID)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return purged, err
+		}
+
+		for _, track := range tracks {
+			record, ok := track.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			trackName, _ := record["track_name"].(string)
+			if err := g.voicelineService.DeleteObject(ctx, trackName, collection, memberID); err != nil {
+				return purged, err
+			}
+
+			purged++
+		}
+
+		if err := g.firebaseAdapter.DeleteDocument(ctx, collection, memberID); err != nil {
+			return purged, err
+		}
+	}
+
+	archivedObjects, err := g.firebaseAdapter.ListFilesInStorage(ctx, g.bucket, fmt.Sprintf("archive/%s/", memberID))
+	if err != nil {
+		return purged, err
+	}
+
+	for _, object := range archivedObjects {
+		if err := g.firebaseAdapter.DeleteFileFromStorage(ctx, g.bucket, object); err != nil {
+			return purged, err
+		}
+	}
+
+	if err := g.firebaseAdapter.DeleteDocument(ctx, ArchivedCollection, memberID); err != nil {
+		return purged, err
+	}
+
+	return purged, nil
+}
+
+// reclaimVoicelines restores voicelines archived by archiveMemberVoicelines.
+func (g *greeterRunner) reclaimVoicelines(ctx context.Context, memberID string) (int, error) {
+	archive, err := g.firebaseAdapter.GetDocumentFromCollection(ctx, ArchivedCollection, memberID)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return 0, nil
+		}
+
+		return 0, err
+	}
+
+	reclaimed := 0
+
+	for collection, audioListKey := range map[string]string{WelcomeCollection: IntroArrayKey, OutroCollection: OutroArrayKey} {
+		tracks, _ := archive[audioListKey].([]interface{})
+		if len(tracks) == 0 {
+			continue
+		}
+
+		if err := g.voicelineService.EnsureDocument(ctx, collection, memberID); err != nil {
+			return reclaimed, err
+		}
+
+		for _, track := range tracks {
+			record, ok := track.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			trackName, _ := record["track_name"].(string)
+			archivePath := fmt.Sprintf("archive/%s/%s", memberID, trackName)
+
+			if err := g.firebaseAdapter.CloneFileFromStorage(ctx, g.bucket, archivePath, fmt.Sprintf("voicelines/%s", trackName)); err != nil {
+				return reclaimed, fmt.Errorf("error restoring archived voiceline %s: %w", trackName, err)
+			}
+
+			// Each track is moved out of the archive as it's restored so a failure part way through can be retried
+			data := map[string]interface{}{audioListKey: firestore.ArrayUnion(record)}
+			if err := g.firebaseAdapter.UpdateDocument(ctx, collection, memberID, data); err != nil {
+				return reclaimed, err
+			}
+
+			if err := g.voicelineService.RestoreRef(ctx, trackName, collection, memberID); err != nil {
+				return reclaimed, err
+			}
+
+			if err := g.firebaseAdapter.UpdateDocument(ctx, ArchivedCollection, memberID, map[string]interface{}{audioListKey: firestore.ArrayRemove(record)}); err != nil {
+				return reclaimed, err
+			}
+
+			if err := g.firebaseAdapter.DeleteFileFromStorage(ctx, g.bucket, archivePath); err != nil {
+				g.logger.Warn("unable to delete reclaimed archive object", zap.Error(err), zap.String("object", archivePath))
+			}
+
+			reclaimed++
+		}
+	}
+
+	if err := g.firebaseAdapter.DeleteDocument(ctx, ArchivedCollection, memberID); err != nil {
+		return reclaimed, err
+	}
+
+	return reclaimed, nil
+}
+
+func (g *greeterRunner) departed(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	ctx := context.Background()
+	subcommand := interaction.ApplicationCommandData().Options[0]
+
+	if subcommand.Name == "list" {
+		departed, err := g.departedMembers(ctx, interaction.GuildID)
+		if err != nil {
+			return err
+		}
+
+		entries := make([]string, 0, len(departed))
+		for _, record := range departed {
+			entries = append(entries, fmt.Sprintf("**%s** (`%s`) left %s", record.Username, record.UserID, util.RelativeTimestamp(record.DepartedAt)))
+		}
+
+		_, err = util.SendFollowup(ctx, session, interaction.Interaction, &discordgo.WebhookParams{
+			Embeds: []*discordgo.MessageEmbed{embeds.DepartedMembersEmbed(entries)},
+		})
+
+		return err
+	}
+
+	memberID := subcommand.Options[0].StringValue()
+
+	if sharesAnotherGuild(session, interaction.GuildID, memberID) {
+		_, err := util.SendFollowup(ctx, session, interaction.Interaction, &discordgo.WebhookParams{
+			Embeds: []*discordgo.MessageEmbed{embeds.ErrorMessageEmbed(errMemberStillShared.Error() + ", their voicelines can't be removed from here")},
+		})
+
+		return err
+	}
+
+	var count int
+
+	var err error
+
+	switch subcommand.Name {
+	case "archive":
+		count, err = g.archiveMemberVoicelines(ctx, interaction.GuildID, memberID)
+	case "purge":
+		count, err = g.purgeMemberVoicelines(ctx, memberID)
+	default:
+		return fmt.Errorf("unknown departed subcommand: %s", subcommand.Name)
+	}
+
+	if err != nil {
+		return fmt.Errorf("error attempting to %s voicelines for departed member: %w", subcommand.Name, err)
+	}
+
+	if err := g.firebaseAdapter.DeleteDocument(ctx, DepartedCollection, departedDocumentID(interaction.GuildID, memberID)); err != nil {
+		g.logger.Warn("unable to clear handled departure", zap.Error(err))
+	}
+
+	_, err = util.SendFollowup(ctx, session, interaction.Interaction, &discordgo.WebhookParams{
+		Embeds: []*discordgo.MessageEmbed{embeds.DepartedActionEmbed(subcommand.Name, memberID, count)},
+	})
+
+	return err
+}
+
+func (g *greeterRunner) departedAutocomplete(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	departed, err := g.departedMembers(context.Background(), interaction.GuildID)
+	if err != nil {
+		return err
+	}
+
+	focused := ""
+	for _, option := range interaction.ApplicationCommandData().Options[0].Options {
+		if option.Focused {
+			focused = strings.ToLower(option.StringValue())
+		}
+	}
+
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	for _, record := range departed {
+		if len(choices) == 25 {
+			break
+		}
+
+		if strings.Contains(strings.ToLower(record.Username), focused) || strings.HasPrefix(record.UserID, focused) {
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: record.Username, Value: record.UserID})
+		}
+	}
+
+	return session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{Choices: choices},
+	})
+}
+
+func (g *greeterRunner) reclaim(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	ctx := context.Background()
+
+	count, err := g.reclaimVoicelines(ctx, interaction.Member.User.ID)
+	if err != nil {
+		return fmt.Errorf("error reclaiming voicelines: %w", err)
+	}
+
+	_, err = util.SendFollowup(ctx, session, interaction.Interaction, &discordgo.WebhookParams{
+		Embeds: []*discordgo.MessageEmbed{embeds.ReclaimedVoicelinesEmbed(interaction.Member, count)},
+	})
+
+	return err
+}
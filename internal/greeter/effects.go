@@ -0,0 +1,223 @@
+package greeter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"salutations/internal/embeds"
+	"salutations/internal/voicelines"
+	util "salutations/pkg/util"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const effectNone = "none"
+
+// voiceEffects are the ffmpeg filter chains a member can put on one of their voicelines. Clips are resampled to a
+// known rate first so asetrate shifts speed and pitch by the same amount whatever rate they were uploaded at.
+var voiceEffects = map[string]string{
+	"nightcore": "aresample=44100,asetrate=44100*1.25,aresample=44100",
+	"slowed":    "aresample=44100,asetrate=44100*0.8,aresample=44100",
+	"robot":     "afftfilt=real='hypot(re,im)*sin(0)':imag='hypot(re,im)*cos(0)':win_size=512:overlap=0.75",
+}
+
+// greetingTrack is a track picked to greet with along with the effect it plays with, empty for none.
+type greetingTrack struct {
+	name   string
+	effect string
+}
+
+func greetingTrackNames(tracks []greetingTrack) []string {
+	names := make([]string, 0, len(tracks))
+	for _, track := range tracks {
+		names = append(names, track.name)
+	}
+
+	return names
+}
+
+// variantObjectName is where the track rendered with the effect is cached.
+func variantObjectName(effect string, trackName string) string {
+	return fmt.Sprintf("variants/%s/%s", effect, trackName)
+}
+
+// trackEffect is the effect on the named track, effects that have since been removed are treated as none.
+func trackEffect(data map[string]interface{}, audioListKey string, trackName string) string {
+	tracks, _ := data[audioListKey].([]interface{})
+	for _, track := range tracks {
+		if recordMap, ok := track.(map[string]interface{}); ok && recordMap["track_name"] == trackName {
+			effect, _ := recordMap["effect"].(string)
+			if _, ok := voiceEffects[effect]; ok {
+				return effect
+			}
+
+			return ""
+		}
+	}
+
+	return ""
+}
+
+// setTrackEffect puts the effect on the track, effectNone takes it back off.
+func (g *greeterRunner) setTrackEffect(ctx context.Context, collection string, memberID string, trackName string, effect string) error {
+	return g.updateTrackRecord(ctx, collection, memberID, trackName, func(record map[string]interface{}) {
+		if effect == effectNone {
+			delete(record, "effect")
+		} else {
+			record["effect"] = effect
+		}
+	})
+}
+
+// renderVariant applies the effect to the track and caches the result in storage, returning the rendered file's path
+// for the caller to play or delete. A variant that couldn't be cached is only rendered again the next time it's needed.
+func (g *greeterRunner) renderVariant(ctx context.Context, trackName string, effect string) (string, error) {
+	filter, ok := voiceEffects[effect]
+	if !ok {
+		return "", fmt.Errorf("unknown effect %q", effect)
+	}
+
+	original, err := g.firebaseAdapter.DownloadFileBytes(ctx, g.bucket, fmt.Sprintf("voicelines/%s", trackName))
+	if err != nil {
+		return "", fmt.Errorf("failed to get audio bytes from storage: %w", err)
+	}
+
+	file, err := util.DownloadFileToTempDirectory(original)
+	if err != nil {
+		return "", fmt.Errorf("failed to download audio bytes to temporary directory: %w", err)
+	}
+
+	defer func() {
+		file.Close()
+
+		if err := util.DeleteFile(file.Name()); err != nil {
+			g.logger.Warn("error trying to delete file", zap.Error(err), zap.String("file_name", file.Name()))
+		}
+	}()
+
+	rendered, err := util.ApplyAudioFilter(ctx, "", file.Name(), filter)
+	if err != nil {
+		return "", fmt.Errorf("error rendering %s effect: %w", effect, err)
+	}
+
+	renderedPath := rendered.Name()
+
+	if err := g.firebaseAdapter.UploadFileToStorage(ctx, g.bucket, variantObjectName(effect, trackName), rendered, trackName); err != nil {
+		g.logger.Warn("unable to cache voiceline variant", zap.Error(err), zap.String("track_name", trackName), zap.String("effect", effect))
+	}
+
+	return renderedPath, nil
+}
+
+// downloadGreetingTrack downloads the track with its effect applied, rendering and caching the variant the first
+// time it's needed.
+func (g *greeterRunner) downloadGreetingTrack(ctx context.Context, track greetingTrack, vc *discordgo.VoiceStateUpdate) (string, error) {
+	if track.effect == "" {
+		return g.downloadVoiceline(ctx, track.name, vc)
+	}
+
+	variant, err := g.firebaseAdapter.DownloadFileBytes(ctx, g.bucket, variantObjectName(track.effect, track.name))
+	if err != nil {
+		renderedPath, err := g.renderVariant(ctx, track.name, track.effect)
+		if err != nil {
+			// A greeting without its effect beats no greeting at all
+			g.logger.Warn("unable to render voiceline variant, playing it without the effect", zap.Error(err), zap.String("track_name", track.name), zap.String("effect", track.effect))
+			return g.downloadVoiceline(ctx, track.name, vc)
+		}
+
+		return renderedPath, nil
+	}
+
+	file, err := util.DownloadFileToTempDirectory(variant)
+	if err != nil {
+		return "", fmt.Errorf("failed to download audio bytes to temporary directory: %w", err)
+	}
+
+	defer file.Close()
+
+	return file.Name(), nil
+}
+
+// deleteVariants removes every cached variant of the track, variants that were never rendered are skipped.
+func (g *greeterRunner) deleteVariants(ctx context.Context, trackName string) error {
+	errs := []error{}
+	for effect := range voiceEffects {
+		if err := g.firebaseAdapter.DeleteFileFromStorage(ctx, g.bucket, variantObjectName(effect, trackName)); err != nil && status.Code(err) != codes.NotFound {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (g *greeterRunner) effects(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	ctx := context.Background()
+	memberID := interaction.Member.User.ID
+
+	audioType, trackName, effect := "intro", "", effectNone
+	for _, option := range interaction.ApplicationCommandData().Options {
+		switch option.Name {
+		case "type":
+			audioType = option.StringValue()
+		case "track":
+			trackName = option.StringValue()
+		case "effect":
+			effect = option.StringValue()
+		}
+	}
+
+	collection, _ := voicelines.CollectionFor(audioType)
+
+	if err := g.setTrackEffect(ctx, collection, memberID, trackName, effect); err != nil {
+		if errors.Is(err, errTrackNotFound) || status.Code(err) == codes.NotFound {
+			_, err := util.SendFollowup(ctx, session, interaction.Interaction, &discordgo.WebhookParams{
+				Embeds: []*discordgo.MessageEmbed{embeds.ErrorMessageEmbed("That voiceline couldn't be found, pick one from the list")},
+			})
+
+			return err
+		}
+
+		return fmt.Errorf("error setting track effect: %w", err)
+	}
+
+	description := fmt.Sprintf("That %s will play as it was uploaded", audioType)
+
+	if effect != effectNone {
+		// Rendered now so the first greeting with the effect doesn't wait on ffmpeg
+		renderedPath, err := g.renderVariant(ctx, trackName, effect)
+		if err != nil {
+			g.logger.Warn("unable to render voiceline variant ahead of time", zap.Error(err), zap.String("track_name", trackName), zap.String("effect", effect))
+		} else if err := util.DeleteFile(renderedPath); err != nil {
+			g.logger.Warn("error trying to delete file", zap.Error(err), zap.String("file_name", renderedPath))
+		}
+
+		description = fmt.Sprintf("That %s will now play with the **%s** effect", audioType, effect)
+	}
+
+	_, err := util.SendFollowup(ctx, session, interaction.Interaction, &discordgo.WebhookParams{
+		Embeds: []*discordgo.MessageEmbed{embeds.MyVoicelinesUpdatedEmbed(description)},
+	})
+
+	return err
+}
+
+func (g *greeterRunner) effectsAutocomplete(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	return g.trackAutocomplete(session, interaction, interaction.ApplicationCommandData().Options)
+}
+
+// effectChoices lists the effects for the /effects command, none first.
+func effectChoices() []*discordgo.ApplicationCommandOptionChoice {
+	choices := []*discordgo.ApplicationCommandOptionChoice{{Name: "None", Value: effectNone}}
+	for _, name := range slices.Sorted(maps.Keys(voiceEffects)) {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: strings.ToUpper(name[:1]) + name[1:], Value: name})
+	}
+
+	return choices
+}
@@ -0,0 +1,138 @@
+package greeter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"salutations/internal/embeds"
+	util "salutations/pkg/util"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultEventHours is how long an event lasts when /eventmode on isn't given hours, about a party's length
+	defaultEventHours = 4
+	maxEventHours     = 24
+	// eventModeExpiryInterval is how late an event's end can be announced, relaxing stops right on time regardless
+	eventModeExpiryInterval = time.Minute
+)
+
+// inEventMode is whether the interaction's guild is holding an event, so its cooldowns are relaxed.
+func (g *greeterRunner) inEventMode(interaction *discordgo.InteractionCreate) bool {
+	if interaction.GuildID == "" {
+		return false
+	}
+
+	return g.guildSettings(context.Background(), interaction.GuildID).EventModeActive(g.clock.Now())
+}
+
+// eventMode starts and ends the guild's event.
+func (g *greeterRunner) eventMode(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	if g.settings == nil {
+		return errors.New("guild settings are not configured")
+	}
+
+	ctx := context.Background()
+	subcommand := interaction.ApplicationCommandData().Options[0]
+
+	switch subcommand.Name {
+	case "on":
+		hours := int64(defaultEventHours)
+		packID := ""
+
+		for _, option := range subcommand.Options {
+			switch option.Name {
+			case "hours":
+				hours = option.IntValue()
+			case "pack":
+				packID = option.StringValue()
+			}
+		}
+
+		if packID == "" {
+			packID = g.guildSettings(ctx, interaction.GuildID).EventPack
+		}
+
+		packName := ""
+		if packID != "" {
+			pack, err := g.findVoicePack(ctx, packID)
+			if err != nil {
+				switch {
+				case errors.Is(err, errVoicePackNotFound):
+					return g.respondEphemeral(session, interaction, embeds.ErrorMessageEmbed("That voice pack couldn't be found, pick one from the list"))
+				case errors.Is(err, errVoicePackEmpty):
+					return g.respondEphemeral(session, interaction, embeds.ErrorMessageEmbed("That voice pack doesn't have any clips yet"))
+				}
+
+				return fmt.Errorf("error getting event pack: %w", err)
+			}
+
+			packName = pack.Name
+		}
+
+		until := g.clock.Now().Add(time.Duration(hours) * time.Hour)
+		if err := g.settings.StartEventMode(ctx, interaction.GuildID, until, interaction.ChannelID, packID); err != nil {
+			return fmt.Errorf("error starting event mode: %w", err)
+		}
+
+		g.logger.Info("event mode started", zap.String("guild_id", interaction.GuildID), zap.Time("until", until), zap.String("pack", packID))
+
+		description := fmt.Sprintf("Event mode is on until <t:%d:t>, cooldowns are looser and greeting caps are off", until.Unix())
+		if packName != "" {
+			description += fmt.Sprintf(", members without their own voicelines will hear **%s**", packName)
+		}
+
+		return g.respondEphemeral(session, interaction, embeds.SettingsUpdatedEmbed(description))
+	case "off":
+		if !g.guildSettings(ctx, interaction.GuildID).EventModeActive(g.clock.Now()) {
+			return g.respondEphemeral(session, interaction, embeds.ErrorMessageEmbed("There isn't an event going on"))
+		}
+
+		if err := g.settings.EndEventMode(ctx, interaction.GuildID); err != nil {
+			return fmt.Errorf("error ending event mode: %w", err)
+		}
+
+		return g.respondEphemeral(session, interaction, embeds.SettingsUpdatedEmbed("Event mode is off, cooldowns, caps and greetings are back to normal"))
+	default:
+		return fmt.Errorf("unknown eventmode subcommand: %s", subcommand.Name)
+	}
+}
+
+// endExpiredEventModes reverts the events that have run their course and lets the channel they were started in know.
+func (g *greeterRunner) endExpiredEventModes(ctx context.Context, session *discordgo.Session) error {
+	if g.settings == nil {
+		return nil
+	}
+
+	ended, err := g.settings.EventModesEndedBefore(ctx, g.clock.Now())
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+
+	for _, guildSettings := range ended {
+		if err := g.settings.EndEventMode(ctx, guildSettings.GuildID); err != nil {
+			errs = append(errs, fmt.Errorf("guild %s: %w", guildSettings.GuildID, err))
+			continue
+		}
+
+		g.logger.Info("event mode ended", zap.String("guild_id", guildSettings.GuildID))
+
+		if guildSettings.EventModeChannel == "" || !guildSettings.RemovedAt.IsZero() {
+			continue
+		}
+
+		if _, err := util.SendMessage(ctx, session, guildSettings.EventModeChannel, &discordgo.MessageSend{
+			Embeds: []*discordgo.MessageEmbed{embeds.EventModeEndedEmbed()},
+		}); err != nil {
+			g.logger.Warn("unable to announce end of event mode", zap.Error(err), zap.String("guild_id", guildSettings.GuildID), zap.String("channel_id", guildSettings.EventModeChannel))
+		}
+	}
+
+	return errors.Join(errs...)
+}
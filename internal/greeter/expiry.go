@@ -0,0 +1,123 @@
+package greeter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	firebaseAdapter "salutations/internal/firebase"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const expirySweepInterval = time.Hour
+
+// voicelineExpiry indexes a track that should be archived once ExpiresAt passes, firestore can't query inside the
+// track arrays so the sweeper looks these up instead.
+type voicelineExpiry struct {
+	Collection string    `firestore:"collection"`
+	MemberID   string    `firestore:"member_id"`
+	TrackName  string    `firestore:"track_name"`
+	ExpiresAt  time.Time `firestore:"expires_at"`
+}
+
+func expiryDocumentID(collection string, memberID string, trackName string) string {
+	return collection + "_" + memberID + "_" + trackName
+}
+
+// uploadExpiry is when the uploaded voicelines should be archived, the zero time when they're kept until deleted.
+func uploadExpiry(interaction *discordgo.InteractionCreate, now time.Time) time.Time {
+	for _, option := range interaction.ApplicationCommandData().Options {
+		if option.Name == "expires_in" {
+			return now.AddDate(0, 0, int(option.IntValue()))
+		}
+	}
+
+	return time.Time{}
+}
+
+// expireVoiceline schedules the track to be archived for each of the members at expiresAt, a zero time keeps it.
+func (g *greeterRunner) expireVoiceline(ctx context.Context, collection string, memberIDs []string, trackName string, expiresAt time.Time) error {
+	if expiresAt.IsZero() {
+		return nil
+	}
+
+	for _, memberID := range memberIDs {
+		err := g.updateTrackRecord(ctx, collection, memberID, trackName, func(record map[string]interface{}) {
+			record["expires_at"] = expiresAt
+		})
+		if err != nil {
+			return fmt.Errorf("error recording expiry of %s: %w", trackName, err)
+		}
+
+		documentID := expiryDocumentID(collection, memberID, trackName)
+		err = g.firebaseAdapter.CreateDocument(ctx, VoicelineExpiriesCollection, documentID, voicelineExpiry{
+			Collection: collection,
+			MemberID:   memberID,
+			TrackName:  trackName,
+			ExpiresAt:  expiresAt,
+		})
+		if err != nil {
+			return fmt.Errorf("error scheduling expiry of %s: %w", trackName, err)
+		}
+	}
+
+	return nil
+}
+
+func (g *greeterRunner) archiveExpiredVoicelines(ctx context.Context) error {
+	archived, err := g.sweepExpiredVoicelines(ctx)
+	if archived > 0 {
+		g.logger.Info("archived expired voicelines", zap.Int("archived", archived))
+	}
+
+	return err
+}
+
+// sweepExpiredVoicelines archives every track whose expiry has passed, the same way deleting it would. Tracks the
+// member already deleted by hand just have their expiry dropped.
+func (g *greeterRunner) sweepExpiredVoicelines(ctx context.Context) (int, error) {
+	expired, err := g.firebaseAdapter.QueryDocuments(ctx, VoicelineExpiriesCollection, firebaseAdapter.QueryFilter{Path: "expires_at", Op: "<=", Value: g.clock.Now()})
+	if err != nil {
+		return 0, fmt.Errorf("error getting expired voicelines: %w", err)
+	}
+
+	archived := 0
+	errs := []error{}
+
+	for documentID, data := range expired {
+		collection, _ := data["collection"].(string)
+		memberID, _ := data["member_id"].(string)
+		trackName, _ := data["track_name"].(string)
+
+		tracks, err := g.voicelineService.Tracks(ctx, collection, memberID)
+		if err != nil && status.Code(err) != codes.NotFound {
+			errs = append(errs, fmt.Errorf("expiry %s: %w", documentID, err))
+			continue
+		}
+
+		if slices.ContainsFunc(tracks, func(track interface{}) bool {
+			recordMap, ok := track.(map[string]interface{})
+			return ok && recordMap["track_name"] == trackName
+		}) {
+			if err := g.removeVoicelines(ctx, collection, memberID, []string{trackName}); err != nil {
+				errs = append(errs, fmt.Errorf("expiry %s: %w", documentID, err))
+				continue
+			}
+
+			archived++
+		}
+
+		// The expiry goes last so a failed archive is retried on the next sweep
+		if err := g.firebaseAdapter.DeleteDocument(ctx, VoicelineExpiriesCollection, documentID); err != nil {
+			errs = append(errs, fmt.Errorf("expiry %s: %w", documentID, err))
+		}
+	}
+
+	return archived, errors.Join(errs...)
+}
@@ -0,0 +1,162 @@
+package greeter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"salutations/internal/embeds"
+	"salutations/internal/voicelines"
+	util "salutations/pkg/util"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// maxExportBytes keeps an export small enough to download in one go, guilds over it are told to clean up first
+const maxExportBytes = 500 << 20
+
+var errExportTooLarge = errors.New("guild voicelines are too large to export")
+
+// ExportPrefix is where a guild's export is stored, only the latest one is kept.
+func ExportPrefix(guildID string) string {
+	return fmt.Sprintf("exports/%s/", guildID)
+}
+
+// exportGuildVoicelines zips every intro and outro of the given members as <member id>/<intro|outro>/<n>.mp3,
+// uploads it to the guild's storage and returns the object name along with how many voicelines it holds.
+func (g *greeterRunner) exportGuildVoicelines(ctx context.Context, guildID string, memberIDs []string) (string, int, error) {
+	workspace, err := util.NewWorkspace("export-")
+	if err != nil {
+		return "", 0, err
+	}
+
+	defer func() {
+		if err := workspace.Close(); err != nil {
+			g.logger.Warn("error trying to delete export workspace", zap.Error(err), zap.String("directory", workspace.Dir()))
+		}
+	}()
+
+	archive, err := workspace.CreateTemp("export-*.zip")
+	if err != nil {
+		return "", 0, fmt.Errorf("error creating export file: %w", err)
+	}
+
+	sources := []util.ZipSource{}
+
+	for _, audioType := range []string{"intro", "outro"} {
+		collection, audioListKey := voicelines.CollectionFor(audioType)
+
+		documents, err := g.getDocumentsInBatches(ctx, collection, memberIDs)
+		if err != nil {
+			return "", 0, fmt.Errorf("error getting voiceline documents: %w", err)
+		}
+
+		for memberID, document := range documents {
+			tracks, _ := document[audioListKey].([]interface{})
+			tracks = voicelines.Ordered(tracks)
+
+			for i, track := range tracks {
+				record, ok := track.(map[string]interface{})
+				if !ok {
+					continue
+				}
+
+				trackName, _ := record["track_name"].(string)
+
+				sources = append(sources, util.ZipSource{
+					Name: fmt.Sprintf("%s/%s/%d.mp3", memberID, audioType, i+1),
+					Open: func() (io.Reader, error) {
+						audio, err := g.firebaseAdapter.DownloadFileBytes(ctx, g.bucket, fmt.Sprintf("voicelines/%s", trackName))
+						if err != nil {
+							g.logger.Warn("skipping voiceline missing from storage in export", zap.Error(err), zap.String("track_name", trackName))
+							return nil, util.ErrSkipZipEntry
+						}
+
+						return audio, nil
+					},
+				})
+			}
+		}
+	}
+
+	exported, err := util.ZipReaders(archive, maxExportBytes, sources)
+	if errors.Is(err, util.ErrZipTooLarge) {
+		return "", 0, errExportTooLarge
+	}
+
+	if err != nil {
+		return "", 0, fmt.Errorf("error writing export zip: %w", err)
+	}
+
+	if _, err := archive.Seek(0, 0); err != nil {
+		return "", 0, fmt.Errorf("error rewinding export zip: %w", err)
+	}
+
+	location := g.guildStorage(ctx, guildID)
+
+	previous, err := g.firebaseAdapter.ListFilesInStorage(ctx, location.Bucket, location.Object(ExportPrefix(guildID)))
+	if err != nil {
+		return "", 0, fmt.Errorf("error listing previous exports: %w", err)
+	}
+
+	exportID, err := uuid.NewV7()
+	if err != nil {
+		return "", 0, fmt.Errorf("error generating export name: %w", err)
+	}
+
+	objectName := location.Object(ExportPrefix(guildID) + exportID.String() + ".zip")
+	if err := g.firebaseAdapter.UploadFileToStorage(ctx, location.Bucket, objectName, archive, exportID.String()+".zip"); err != nil {
+		return "", 0, fmt.Errorf("error uploading export: %w", err)
+	}
+
+	for _, previousExport := range previous {
+		if err := g.firebaseAdapter.DeleteFileFromStorage(ctx, location.Bucket, previousExport); err != nil {
+			g.logger.Warn("unable to delete previous export", zap.Error(err), zap.String("object", previousExport))
+		}
+	}
+
+	return objectName, exported, nil
+}
+
+func (g *greeterRunner) exportAll(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	guild, err := session.State.Guild(interaction.GuildID)
+	if err != nil {
+		return fmt.Errorf("error getting guild from state: %w", err)
+	}
+
+	memberIDs := make([]string, 0, len(guild.Members))
+	for _, member := range guild.Members {
+		if !member.User.Bot {
+			memberIDs = append(memberIDs, member.User.ID)
+		}
+	}
+
+	ctx := context.Background()
+
+	objectName, exported, err := g.exportGuildVoicelines(ctx, guild.ID, memberIDs)
+	if err != nil {
+		if errors.Is(err, errExportTooLarge) {
+			_, err := util.SendFollowup(ctx, session, interaction.Interaction, &discordgo.WebhookParams{
+				Embeds: []*discordgo.MessageEmbed{embeds.ErrorMessageEmbed("This server's voicelines are too large to export in one zip")},
+			})
+
+			return err
+		}
+
+		return fmt.Errorf("error exporting guild voicelines: %w", err)
+	}
+
+	signedURL, err := g.firebaseAdapter.GenerateSignedURL(g.guildStorage(ctx, guild.ID).Bucket, objectName)
+	if err != nil {
+		return fmt.Errorf("error generating signed url for export: %w", err)
+	}
+
+	_, err = util.SendFollowup(ctx, session, interaction.Interaction, &discordgo.WebhookParams{
+		Embeds: []*discordgo.MessageEmbed{embeds.ExportEmbed(exported, signedURL)},
+	})
+
+	return err
+}
@@ -0,0 +1,227 @@
+package greeter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"salutations/internal/embeds"
+	"salutations/internal/settings"
+	util "salutations/pkg/util"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// maxFirstJoinClipBytes keeps the welcome clip short, it plays ahead of the member's own intro
+	maxFirstJoinClipBytes = 5 << 20
+	// maxFirstJoinMessageLength leaves room in a Discord message for the member's mention
+	maxFirstJoinMessageLength = 1000
+	// firstJoinMemberPlaceholder is replaced with the member's mention in the welcome message
+	firstJoinMemberPlaceholder = "{member}"
+)
+
+type firstSeenRecord struct {
+	GuildID     string    `firestore:"guild_id"`
+	UserID      string    `firestore:"user_id"`
+	FirstSeenAt time.Time `firestore:"first_seen_at"`
+}
+
+func firstSeenDocumentID(guildID string, userID string) string {
+	return guildID + "_" + userID
+}
+
+// claimFirstJoin reports whether this is the member's first ever voice join in a guild that welcomes them, recording
+// it so no other join or instance welcomes them again. Members who were in the guild before welcomes were turned on
+// aren't new and are never recorded.
+func (g *greeterRunner) claimFirstJoin(ctx context.Context, logger *zap.Logger, session *discordgo.Session, vc *discordgo.VoiceStateUpdate, guildSettings settings.GuildSettings) bool {
+	if !guildSettings.FirstJoinsEnabled() {
+		return false
+	}
+
+	member := vc.Member
+	if member == nil {
+		var err error
+		if member, err = session.State.Member(vc.GuildID, vc.UserID); err != nil {
+			return false
+		}
+	}
+
+	if member.JoinedAt.Before(guildSettings.FirstJoinSince) {
+		return false
+	}
+
+	err := g.firebaseAdapter.CreateDocument(ctx, FirstSeenCollection, firstSeenDocumentID(vc.GuildID, vc.UserID), firstSeenRecord{
+		GuildID:     vc.GuildID,
+		UserID:      vc.UserID,
+		FirstSeenAt: g.clock.Now(),
+	})
+	if err != nil {
+		if status.Code(err) != codes.AlreadyExists {
+			logger.Warn("unable to record first voice join", zap.Error(err))
+		}
+
+		return false
+	}
+
+	logger.Info("member joined voice for the first time")
+
+	return true
+}
+
+// firstJoinMessage is the guild's welcome message for the member, with the placeholder filled in or their mention in
+// front of it when there's no placeholder.
+func firstJoinMessage(message string, memberID string) string {
+	mention := fmt.Sprintf("<@%s>", memberID)
+	if !strings.Contains(message, firstJoinMemberPlaceholder) {
+		return mention + " " + message
+	}
+
+	return strings.ReplaceAll(message, firstJoinMemberPlaceholder, mention)
+}
+
+// postFirstJoinMessage welcomes the member in the guild's welcome channel, or the chat of the voice channel they joined.
+func (g *greeterRunner) postFirstJoinMessage(ctx context.Context, logger *zap.Logger, session *discordgo.Session, vc *discordgo.VoiceStateUpdate, guildSettings settings.GuildSettings) {
+	if guildSettings.FirstJoinMessage == "" {
+		return
+	}
+
+	channelID := guildSettings.FirstJoinChannel
+	if channelID == "" {
+		channelID = vc.ChannelID
+	}
+
+	_, err := util.SendMessage(ctx, session, channelID, &discordgo.MessageSend{
+		Content:         firstJoinMessage(guildSettings.FirstJoinMessage, vc.UserID),
+		AllowedMentions: &discordgo.MessageAllowedMentions{Users: []string{vc.UserID}},
+	})
+	if err != nil {
+		logger.Warn("unable to post first join message", zap.Error(err), zap.String("message_channel_id", channelID))
+	}
+}
+
+// withFirstJoinClip puts the guild's welcome clip ahead of the member's greeting, which is left as it is when the
+// guild has no clip or it couldn't be downloaded.
+func (g *greeterRunner) withFirstJoinClip(ctx context.Context, logger *zap.Logger, vc *discordgo.VoiceStateUpdate, guildSettings settings.GuildSettings, clips []queuedClip) []queuedClip {
+	if guildSettings.FirstJoinClip == "" {
+		return clips
+	}
+
+	audioPath, err := g.downloadObject(ctx, guildSettings.Storage(g.bucket), guildSettings.FirstJoinClip, vc)
+	if err != nil {
+		logger.Error("failed to download first join clip", zap.Error(err), zap.String("object", guildSettings.FirstJoinClip))
+		return clips
+	}
+
+	trackName := guildSettings.FirstJoinClip[strings.LastIndex(guildSettings.FirstJoinClip, "/")+1:]
+
+	return append([]queuedClip{{audioPath: audioPath, memberID: vc.UserID, trackName: trackName, collection: WelcomeCollection}}, clips...)
+}
+
+// firstJoin sets the clip played and the message posted when a member joins voice in the guild for the first time.
+func (g *greeterRunner) firstJoin(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	if g.settings == nil {
+		return errors.New("guild settings are not configured")
+	}
+
+	ctx := context.Background()
+	data := interaction.ApplicationCommandData()
+	subcommand := data.Options[0]
+	guildSettings := g.guildSettings(ctx, interaction.GuildID)
+
+	var embed *discordgo.MessageEmbed
+
+	switch subcommand.Name {
+	case "clip":
+		var attachment *discordgo.MessageAttachment
+		if len(subcommand.Options) > 0 {
+			attachmentID, _ := subcommand.Options[0].Value.(string)
+
+			resolved, ok := data.Resolved.Attachments[attachmentID]
+			if !ok {
+				return fmt.Errorf("attachment %s was not resolved", attachmentID)
+			}
+
+			attachment = resolved
+		}
+
+		if attachment == nil {
+			if err := g.settings.SetFirstJoinClip(ctx, interaction.GuildID, ""); err != nil {
+				return fmt.Errorf("error clearing first join clip: %w", err)
+			}
+
+			g.deleteGuildAudio(ctx, interaction.GuildID, guildSettings.FirstJoinClip)
+
+			embed = embeds.SettingsUpdatedEmbed("New members will only hear their own intro the first time they join voice")
+			break
+		}
+
+		switch {
+		case FileType(attachment.ContentType) != mp3 && FileType(attachment.ContentType) != mp4:
+			embed = embeds.ErrorMessageEmbed("The welcome clip has to be an .mp3 or .m4a file")
+		case attachment.Size > maxFirstJoinClipBytes:
+			embed = embeds.ErrorMessageEmbed("The welcome clip has to be a short clip under 5 MB")
+		}
+
+		if embed != nil {
+			break
+		}
+
+		objectName, err := g.uploadGuildAudio(ctx, "firstjoin", interaction.GuildID, attachment)
+		if err != nil {
+			return fmt.Errorf("error uploading first join clip: %w", err)
+		}
+
+		if err := g.settings.SetFirstJoinClip(ctx, interaction.GuildID, objectName); err != nil {
+			g.deleteGuildAudio(ctx, interaction.GuildID, objectName)
+			return fmt.Errorf("error setting first join clip: %w", err)
+		}
+
+		g.deleteGuildAudio(ctx, interaction.GuildID, guildSettings.FirstJoinClip)
+
+		embed = embeds.SettingsUpdatedEmbed("New members will hear that clip ahead of their intro the first time they join voice")
+	case "message":
+		var text, channelID string
+		for _, option := range subcommand.Options {
+			switch option.Name {
+			case "text":
+				text = strings.TrimSpace(option.StringValue())
+			case "channel":
+				channelID = option.ChannelValue(nil).ID
+			}
+		}
+
+		if err := g.settings.SetFirstJoinMessage(ctx, interaction.GuildID, text, channelID); err != nil {
+			return fmt.Errorf("error setting first join message: %w", err)
+		}
+
+		switch {
+		case text == "":
+			embed = embeds.SettingsUpdatedEmbed("I'll stop posting a welcome when members join voice for the first time")
+		case channelID == "":
+			embed = embeds.SettingsUpdatedEmbed("I'll post a welcome in the chat of the voice channel new members first join")
+		default:
+			embed = embeds.SettingsUpdatedEmbed(fmt.Sprintf("I'll post a welcome in <#%s> when members join voice for the first time", channelID))
+		}
+	default:
+		return fmt.Errorf("unknown firstjoin subcommand: %s", subcommand.Name)
+	}
+
+	// Turning welcomes on starts counting who's new from now, everyone already in the guild has been around
+	if !guildSettings.FirstJoinsEnabled() && g.guildSettings(ctx, interaction.GuildID).FirstJoinsEnabled() {
+		if err := g.settings.StartFirstJoins(ctx, interaction.GuildID); err != nil {
+			return fmt.Errorf("error starting first join welcomes: %w", err)
+		}
+	}
+
+	_, err := util.SendFollowup(ctx, session, interaction.Interaction, &discordgo.WebhookParams{
+		Embeds: []*discordgo.MessageEmbed{embed},
+	})
+
+	return err
+}
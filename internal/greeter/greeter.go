@@ -1,39 +1,90 @@
 package greeter
 
 import (
+	"bufio"
 	"context"
 	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"salutations/internal/cogs"
 	"salutations/internal/embeds"
+	"salutations/internal/encodequeue"
+	"salutations/internal/eventqueue"
 	firebaseAdapter "salutations/internal/firebase"
+	"salutations/internal/lease"
+	"salutations/internal/logging"
+	"salutations/internal/middleware"
+	"salutations/internal/reporting"
+	"salutations/internal/router"
+	"salutations/internal/scheduler"
+	"salutations/internal/screening"
+	"salutations/internal/settings"
+	"salutations/internal/voicelines"
 	util "salutations/pkg/util"
 
-	"cloud.google.com/go/firestore"
 	"github.com/bwmarrin/discordgo"
-	"github.com/google/uuid"
 	"github.com/jonas747/dca"
 	"github.com/kkdai/youtube/v2"
 	"go.uber.org/zap"
-	"golang.org/x/exp/rand"
-	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/singleflight"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
 const (
-	WelcomeCollection   string = "welcomeIntros"
-	OutroCollection     string = "byeOutros"
-	BlacklistCollection string = "blacklist"
-	IntroArrayKey       string = "intro_array"
-	OutroArrayKey       string = "outro_array"
-	BucketName          string = "twitterbot-e7ab0.appspot.com"
+	WelcomeCollection   string = voicelines.WelcomeCollection
+	OutroCollection     string = voicelines.OutroCollection
+	BlacklistCollection string = voicelines.BlacklistCollection
+	// GreetingPlaysCollection holds one document per greeting played, used for guild statistics
+	GreetingPlaysCollection string = "greetingPlays"
+	// GreetingSkipsCollection holds one document per greeting skipped because of a guild's greeting caps
+	GreetingSkipsCollection string = "greetingSkips"
+	// DepartedCollection tracks members who left a guild, keyed by <guild id>_<user id>
+	DepartedCollection string = "departedMembers"
+	// ArchivedCollection holds the records of voicelines archived for departed members until they're reclaimed
+	ArchivedCollection string = "archivedVoicelines"
+	// MemberPreferencesCollection holds per member settings such as respecting do not disturb
+	MemberPreferencesCollection string = "memberPreferences"
+	// LibraryCollection holds the clips members have published for anyone to import
+	LibraryCollection string = "voicelineLibrary"
+	// VoicePacksCollection describes the curated voice packs a guild can install, their clips live under packs/ in storage
+	VoicePacksCollection string = "voicePacks"
+	// VoicelineRefsCollection records who holds each stored voiceline, keyed by track name
+	VoicelineRefsCollection string = voicelines.RefsCollection
+	// VoicelineExpiriesCollection indexes tracks uploaded with an expiry so the sweeper can find them
+	VoicelineExpiriesCollection string = "voicelineExpiries"
+	// ReportsCollection holds voicelines members flagged for moderators to look at
+	ReportsCollection string = "reports"
+	// FirstSeenCollection records the first voice join of members of guilds that welcome new members, keyed by <guild id>_<user id>
+	FirstSeenCollection string = "firstSeen"
+	// GuessScoresCollection holds one document per correct /guess, a member's score is how many they have in the guild
+	GuessScoresCollection string = "guessScores"
+	// StorageUsageCollection holds how many bytes each guild's uploads take up, keyed by guild id
+	StorageUsageCollection string = "storageUsage"
+	// StorageChargesCollection records the guild and member each uploaded voiceline was charged to, keyed by track name
+	StorageChargesCollection string = "storageCharges"
+	// TrackPlaysCollection records when each member's voiceline last played, keyed by <collection>_<member id>_<track name>
+	TrackPlaysCollection string = "trackPlays"
+	// UnplayedDigestsCollection records when each member was last sent their unplayed voicelines, keyed by member id
+	UnplayedDigestsCollection string = "unplayedDigests"
+	// PinnedTrackKey, ChainKey, EntranceDelayKey and DisabledKey live on a member's intro or outro document and are managed through /myvoicelines
+	PinnedTrackKey   string = voicelines.PinnedTrackKey
+	ChainKey         string = "chain"
+	EntranceDelayKey string = "entrance_delay"
+	DisabledKey      string = voicelines.DisabledKey
+	IntroArrayKey    string = voicelines.IntroArrayKey
+	OutroArrayKey    string = voicelines.OutroArrayKey
+	// BucketName is where voicelines are stored unless the greeter is given another bucket with WithBucket
+	BucketName string = "twitterbot-e7ab0.appspot.com"
 )
 
 type FileType string
@@ -51,19 +102,137 @@ const (
 	NotPlaying voiceState = "NOT_PLAYING"
 )
 
+const (
+	deleteSelectMenuPrefix = "delete"
+	deleteConfirmPrefix    = "deleteconfirm"
+	queueSkipPrefix        = "queueskip"
+	reportPrefix           = "report"
+	trackTogglePrefix      = "tracktoggle"
+	previewPrefix          = "preview"
+	libraryImportPrefix    = "libimport"
+	guessPrefix            = "guess"
+	archivePagePrefix      = "archivepage"
+	archiveRestorePrefix   = "archiverestore"
+	archiveDeletePrefix    = "archivedelete"
+	unplayedArchivePrefix  = "unplayedarchive"
+)
+
+const (
+	storageDownloadFailureKey string = "storage_download"
+	storageUploadFailureKey   string = "storage_upload"
+)
+
+var defaultRateLimit = middleware.RateLimitConfig{Burst: 5, Refill: time.Second * 5}
+
+// Commands that write to storage or generate signed urls are limited more aggressively
+var commandRateLimits = map[string]middleware.RateLimitConfig{
+	"upload":          {Burst: 3, Refill: time.Minute},
+	"voicelines":      {Burst: 3, Refill: time.Second * 20},
+	"delete":          {Burst: 3, Refill: time.Second * 20},
+	"guildstats":      {Burst: 2, Refill: time.Minute},
+	"reclaim":         {Burst: 2, Refill: time.Minute},
+	"botsound":        {Burst: 2, Refill: time.Minute},
+	"roulette":        {Burst: 2, Refill: time.Second * 30},
+	"guess":           {Burst: 2, Refill: time.Second * 30},
+	"queue":           {Burst: 3, Refill: time.Second * 15},
+	"export-all":      {Burst: 1, Refill: time.Minute * 10},
+	"library":         {Burst: 3, Refill: time.Second * 20},
+	"voicepack":       {Burst: 3, Refill: time.Second * 20},
+	"upload-default":  {Burst: 2, Refill: time.Minute},
+	"upload-manifest": {Burst: 1, Refill: time.Minute * 5},
+	"effects":         {Burst: 3, Refill: time.Minute},
+}
+
+const (
+	// voiceEventWorkers is how many guilds' voice events can be handled at once
+	voiceEventWorkers = 8
+	// voiceEventBuffer is how many voice events each worker holds before new ones are dropped
+	voiceEventBuffer = 64
+)
+
+// attachmentRetryPolicy retries attachment downloads that failed on discord's end rather than failing the upload
+var attachmentRetryPolicy = util.RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   time.Millisecond * 500,
+	MaxDelay:    time.Second * 4,
+	Jitter:      0.2,
+	Retryable:   util.RetryableHTTPError,
+}
+
+// zipUploadLimits keeps a zip upload to a reasonable number of greeting sized clips
+var zipUploadLimits = util.UnzipLimits{
+	MaxEntries:    50,
+	MaxFileBytes:  10 << 20,
+	MaxTotalBytes: 100 << 20,
+	MaxDepth:      2,
+	Extensions:    []string{".mp3", ".m4a", ".mp4"},
+}
+
+const (
+	// defaultUploadConcurrency is how many clips of a zip upload are screened and stored at once
+	defaultUploadConcurrency = 4
+	// attachmentDownloadTimeout bounds fetching an attachment from discord's cdn
+	attachmentDownloadTimeout = time.Minute
+)
+
+// selectMenuPageSize is how many voicelines each page of a listing shows, its select menu offers the same ones
+const selectMenuPageSize = 4
+
 type paginationState struct {
-	CurrentPage     int
-	Pages           []*discordgo.MessageEmbed
-	SelectMenuData  []string
-	SelectMenuBound int
+	CurrentPage    int
+	Pages          []*discordgo.MessageEmbed
+	SelectMenuData []string
+	// Selected accumulates what was picked in a delete menu across page turns until it's confirmed
+	Selected []string
+}
+
+// pageBounds is the range of SelectMenuData shown on the current page.
+func (s *paginationState) pageBounds() (int, int) {
+	minBound := min(s.CurrentPage*selectMenuPageSize, len(s.SelectMenuData))
+
+	return minBound, min(minBound+selectMenuPageSize, len(s.SelectMenuData))
+}
+
+// queuedClip is a downloaded clip waiting to be played, along with who and what it is for /queue.
+type queuedClip struct {
+	audioPath  string
+	memberID   string
+	trackName  string
+	collection string
+	// announce is set on the first clip of a greeting so chains only post one now playing notification
+	announce bool
+	// eventAt is when the voice event the clip answers happened, zero for clips that aren't greetings
+	eventAt time.Time
+	// prefetched clips were downloaded before the member joined or left
+	prefetched bool
+	// hidden clips are the answer to a /guess round
+	hidden bool
 }
 
 type guildPlayer struct {
 	guildID     string
+	session     *discordgo.Session
 	voiceClient *discordgo.VoiceConnection
-	queue       []string
+	queue       []queuedClip
 	voiceState  voiceState
+	// idleStart is set when clips are queued on an idle player, so the first of them waits for silence
+	idleStart   bool
 	stream      *dca.StreamingSession
+	encoding    *dca.EncodeSession
+	nowPlaying  *queuedClip
+	lastError   error
+	lastErrorAt time.Time
+	// lastLatency is how long the last greeting took to start after its voice event
+	lastLatency time.Duration
+	// waitForSilence is fixed when the player joins since the bot has to join undeafened to hear anyone talking
+	waitForSilence    bool
+	lastVoiceActivity time.Time
+	// musicBotAction is fixed when the player joins for the same reason, botSpeakers are the audio sources of other
+	// bots in the channel and lastBotAudio when one of them was last heard
+	musicBotAction string
+	botSpeakers    map[uint32]bool
+	lastBotAudio   time.Time
+	done           chan struct{}
 }
 
 type greeterRunner struct {
@@ -74,35 +243,161 @@ type greeterRunner struct {
 	songSignal          chan *guildPlayer
 	guildPlayerMappings map[string]*guildPlayer
 	mu                  sync.RWMutex
-	messageStore        map[string]*paginationState
+	messageStore        *paginationStore
+	storageFailures     *reporting.FailureTracker
+	clock               util.Clock
+	rand                *rand.Rand
+	dryRun              bool
+	settings            *settings.Store
+	caps                *greetingCaps
+	joinFailures        *joinFailureNotices
+	voiceQualities      *voiceQualities
+	voiceEventDedup     *voiceEventDedup
+	guessRounds         *guessRounds
+	// dialVoice probes a voice server endpoint, replaced in tests
+	dialVoice  func(ctx context.Context, endpoint string) (time.Duration, error)
+	prefetches *greetingPrefetches
+	screener   screening.Screener
+	// transcriber is nil when uploads aren't transcribed
+	transcriber screening.Transcriber
+	scheduler   *scheduler.Scheduler
+	leases      *lease.Manager
+	voiceEvents eventqueue.Queue[voiceEvent]
+	httpClient  *http.Client
+	// externalClient downloads from urls members gave the bot rather than from discord
+	externalClient    *http.Client
+	uploadConcurrency int
+	unplayedMonths    int
+	messageDeleter    *util.MessageDeleter
+	encodeQueue       *encodequeue.Queue
+	// bucket holds voicelines, voice packs and the objects of guilds that haven't configured storage of their own
+	bucket           string
+	blacklistCache   *blacklistCache
+	voicelineService *voicelines.Service
+	// voiceJoins makes concurrent ensureVoice calls for a guild share one join
+	voiceJoins singleflight.Group
+	// ownerIDs are the only ones allowed to change what every guild sees, like the status rotation
+	ownerIDs []string
+}
+
+type Option func(*greeterRunner)
+
+// WithDownloadClient downloads attachments with client rather than one with util.DefaultDownloadClientConfig.
+func WithDownloadClient(client *http.Client) Option {
+	return func(g *greeterRunner) {
+		g.httpClient = client
+	}
+}
+
+// WithDryRun makes the greeter select and download voicelines as usual but never join voice or play them.
+func WithDryRun(dryRun bool) Option {
+	return func(g *greeterRunner) {
+		g.dryRun = dryRun
+	}
+}
+
+func WithClock(clock util.Clock) Option {
+	return func(g *greeterRunner) {
+		g.clock = clock
+	}
+}
+
+// WithRand sets the source used for track selection, the rand must be safe for concurrent use (see util.NewRand).
+func WithRand(rand *rand.Rand) Option {
+	return func(g *greeterRunner) {
+		g.rand = rand
+	}
+}
+
+// WithGuildSettings lets per guild settings change how greetings are played, without it every guild uses the defaults.
+func WithGuildSettings(store *settings.Store) Option {
+	return func(g *greeterRunner) {
+		g.settings = store
+	}
+}
+
+// WithScreener sets how uploads are screened in guilds with strict mode on, without it every upload is allowed.
+func WithScreener(screener screening.Screener) Option {
+	return func(g *greeterRunner) {
+		g.screener = screener
+	}
+}
+
+// WithTranscriber transcribes every upload, storing the transcript on the track record and screening uploads from it
+// when the screener can. Without it uploads aren't transcribed.
+func WithTranscriber(transcriber screening.Transcriber) Option {
+	return func(g *greeterRunner) {
+		g.transcriber = transcriber
+	}
+}
+
+// WithScheduler runs the greeter's periodic jobs, such as archiving expired voicelines, on the given scheduler.
+func WithScheduler(jobs *scheduler.Scheduler) Option {
+	return func(g *greeterRunner) {
+		g.scheduler = jobs
+	}
+}
+
+// WithPlaybackLease only greets in guilds whose lease this instance holds, so that two instances running side by side
+// during a deploy don't both play every greeting. Without it every voice event is handled.
+func WithPlaybackLease(leases *lease.Manager) Option {
+	return func(g *greeterRunner) {
+		g.leases = leases
+	}
+}
+
+// WithUploadConcurrency sets how many clips of a zip upload are processed at once, values below one are ignored.
+func WithUploadConcurrency(concurrency int) Option {
+	return func(g *greeterRunner) {
+		if concurrency > 0 {
+			g.uploadConcurrency = concurrency
+		}
+	}
 }
 
-type trackRecord struct {
-	AddedBy   string    `firestore:"added_by"    mapstructure:"added_by"`
-	CreatedAt time.Time `firestore:"created_at"  mapstructure:"created_at"`
-	TrackName string    `firestore:"track_name"  mapstructure:"track_name"`
+// WithUnplayedMonths sets how many months a voiceline goes without playing before its member is asked to archive it,
+// values below one are ignored.
+func WithUnplayedMonths(months int) Option {
+	return func(g *greeterRunner) {
+		if months > 0 {
+			g.unplayedMonths = months
+		}
+	}
 }
 
-type trackData struct {
-	TrackName      string
-	TrackSignedURL string
+// WithEncodeQueue shares a queue capping concurrent encodes, without it the greeter gets its own sized to the CPUs.
+func WithEncodeQueue(queue *encodequeue.Queue) Option {
+	return func(g *greeterRunner) {
+		g.encodeQueue = queue
+	}
 }
 
-type blacklistRecord struct {
-	AddedOn time.Time `firestore:"added_on"`
+// WithBucket stores voicelines in bucket instead of BucketName, an empty bucket is ignored.
+func WithBucket(bucket string) Option {
+	return func(g *greeterRunner) {
+		if bucket != "" {
+			g.bucket = bucket
+		}
+	}
 }
 
-type firebaseIntroRecord struct {
-	Name       string        `firestore:"name"`
-	IntroArray []trackRecord `firestore:"intro_array"`
+// WithMessageDeleter sets what deletes the greeter's temporary messages, without it util.DefaultMessageDeleter is used.
+func WithMessageDeleter(deleter *util.MessageDeleter) Option {
+	return func(g *greeterRunner) {
+		g.messageDeleter = deleter
+	}
 }
 
-type firebaseOutroRecord struct {
-	Name       string        `firestore:"name"`
-	OutroArray []trackRecord `firestore:"outro_array"`
+// WithOwnerIDs sets the bot's owners, without any nobody can add a status to the rotation.
+func WithOwnerIDs(ownerIDs []string) Option {
+	return func(g *greeterRunner) {
+		g.ownerIDs = ownerIDs
+	}
 }
 
-func NewGreeterRunner(logger *zap.Logger, ytdlClient *youtube.Client, firebaseAdapter firebaseAdapter.Firebase) (*greeterRunner, error) {
+var _ cogs.Cogs = (*greeterRunner)(nil)
+
+func NewGreeterRunner(logger *zap.Logger, ytdlClient *youtube.Client, firebaseAdapter firebaseAdapter.Firebase, reporter reporting.Reporter, opts ...Option) (*greeterRunner, error) {
 	songSignals := make(chan *guildPlayer)
 	greeter := &greeterRunner{
 		firebaseAdapter:     firebaseAdapter,
@@ -111,20 +406,75 @@ func NewGreeterRunner(logger *zap.Logger, ytdlClient *youtube.Client, firebaseAd
 		ytdlClient:          ytdlClient,
 		songSignal:          songSignals,
 		guildPlayerMappings: make(map[string]*guildPlayer),
-		messageStore:        make(map[string]*paginationState),
+		messageStore:        newPaginationStore(),
+		clock:               util.RealClock,
+		rand:                util.NewRand(time.Now().UnixNano()),
+		caps:                newGreetingCaps(),
+		joinFailures:        newJoinFailureNotices(),
+		voiceQualities:      newVoiceQualities(),
+		voiceEventDedup:     newVoiceEventDedup(),
+		guessRounds:         newGuessRounds(),
+		dialVoice:           dialVoiceEndpoint,
+		prefetches:          newGreetingPrefetches(),
+		screener:            screening.NewNoopScreener(),
+		voiceEvents:         eventqueue.NewMemoryQueue[voiceEvent](voiceEventWorkers, voiceEventBuffer),
+		httpClient:          util.NewDownloadClient(),
+		externalClient:      util.NewExternalDownloadClient(),
+		uploadConcurrency:   defaultUploadConcurrency,
+		unplayedMonths:      defaultUnplayedMonths,
+		messageDeleter:      util.DefaultMessageDeleter,
+		encodeQueue:         encodequeue.New(0, util.RealClock),
+		bucket:              BucketName,
+		blacklistCache:      newBlacklistCache(),
 	}
 
+	for _, opt := range opts {
+		opt(greeter)
+	}
+
+	greeter.storageFailures = reporting.NewFailureTracker(reporter, 3, time.Minute*10, greeter.clock)
+	greeter.voicelineService = voicelines.NewService(greeter.firebaseAdapter, greeter.bucket,
+		voicelines.WithClock(greeter.clock),
+		voicelines.WithRand(greeter.rand),
+		voicelines.OnChange(greeter.invalidatePrefetch),
+		voicelines.OnObjectDeleted(greeter.objectDeleted),
+	)
+
 	go greeter.globalPlay()
 
 	return greeter, nil
 }
 
 func (g *greeterRunner) GetCommands() []*discordgo.ApplicationCommand {
+	var manageGuildPermission int64 = discordgo.PermissionManageServer
+	minTrackWeight := float64(voicelines.DefaultWeight)
+	minTrackPosition := float64(1)
+	minEntranceDelay := float64(0)
+	minGreetingCap := float64(0)
+	minLoudness := float64(minLoudnessLimit)
+	minEventHours := float64(1)
+
+	// The same upload can go to a few more members or a whole role, they all share one stored clip
+	uploadSharingOptions := make([]*discordgo.ApplicationCommandOption, 0, extraMemberOptions+1)
+	for i := range extraMemberOptions {
+		uploadSharingOptions = append(uploadSharingOptions, &discordgo.ApplicationCommandOption{
+			Name:        fmt.Sprintf("member_%d", i+2),
+			Description: "Another member to give the same voiceline to",
+			Type:        discordgo.ApplicationCommandOptionUser,
+		})
+	}
+
+	uploadSharingOptions = append(uploadSharingOptions, &discordgo.ApplicationCommandOption{
+		Name:        "role",
+		Description: "Also give the voiceline to everyone with this role",
+		Type:        discordgo.ApplicationCommandOptionRole,
+	})
+
 	return []*discordgo.ApplicationCommand{
 		{
 			Name:        "upload",
 			Description: "Upload a voiceline for a user from your server",
-			Options: []*discordgo.ApplicationCommandOption{
+			Options: append([]*discordgo.ApplicationCommandOption{
 				{
 					Name:        "member",
 					Description: "The member you wish to create a voiceline for",
@@ -150,9 +500,57 @@ func (g *greeterRunner) GetCommands() []*discordgo.ApplicationCommand {
 				{
 					Name:        "file",
 					Type:        discordgo.ApplicationCommandOptionAttachment,
-					Required:    true,
 					Description: "The audio files/zips you wish to upload",
 				},
+				{
+					Name:        "message_link",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Description: "A link to a message in this server whose attachments you wish to upload instead",
+				},
+				{
+					Name:        "expires_in",
+					Type:        discordgo.ApplicationCommandOptionInteger,
+					Description: "Archive the voicelines automatically after this long",
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "A day", Value: 1},
+						{Name: "A week", Value: 7},
+						{Name: "A month", Value: 30},
+						{Name: "Three months", Value: 90},
+					},
+				},
+				{
+					Name:        "preview_video",
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Description: "Reply with a video of the voiceline that plays right in chat",
+				},
+			}, uploadSharingOptions...),
+		},
+		{
+			Name:                     "upload-manifest",
+			Description:              "Import voicelines for many members from a JSON or CSV manifest of audio urls",
+			DefaultMemberPermissions: &manageGuildPermission,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "manifest",
+					Type:        discordgo.ApplicationCommandOptionAttachment,
+					Description: "A JSON or CSV file mapping member ids to audio urls",
+					Required:    true,
+				},
+				{
+					Name:        "type",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Description: "The type of voiceline rows that don't name one are imported as",
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{
+							Name:  "Intro",
+							Value: "intro",
+						},
+						{
+							Name:  "Outro",
+							Value: "outro",
+						},
+					},
+				},
 			},
 		},
 		{
@@ -218,168 +616,1447 @@ func (g *greeterRunner) GetCommands() []*discordgo.ApplicationCommand {
 		{
 			Name:        "blacklist",
 			Description: "Prevents bot from playing your intros and outros",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "type",
+					Description: "Only intros or only outros, both by default",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "Intros", Value: "intro"},
+						{Name: "Outros", Value: "outro"},
+						{Name: "Both", Value: "both"},
+					},
+				},
+			},
 		},
 		{
 			Name:        "whitelist",
 			Description: "This command removes you from the blacklist",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "type",
+					Description: "Only intros or only outros, both by default",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "Intros", Value: "intro"},
+						{Name: "Outros", Value: "outro"},
+						{Name: "Both", Value: "both"},
+					},
+				},
+			},
 		},
-	}
-}
-
-func (g *greeterRunner) RegisterCommands(session *discordgo.Session) error {
-	if _, err := session.ApplicationCommandBulkOverwrite(session.State.Application.ID, "", g.GetCommands()); err != nil {
-		return err
-	}
-
-	session.AddHandler(g.greeterHandler)
-	session.AddHandler(g.voiceUpdate)
-	session.AddHandler(g.messageComponentHandler)
-	return nil
-}
-
-func (g *greeterRunner) globalPlay() {
-	for gp := range g.songSignal {
-		go g.playAudio(gp)
-	}
-}
-
-func (g *greeterRunner) voiceUpdate(session *discordgo.Session, vc *discordgo.VoiceStateUpdate) {
-	hasJoined := vc.BeforeUpdate == nil && !vc.VoiceState.Member.User.Bot && vc.ChannelID != ""
-	hasLeft := vc.BeforeUpdate != nil && !vc.Member.User.Bot && vc.ChannelID == ""
-
-	g.logger.Info("voice state update", zap.String("user_id", vc.Member.User.ID), zap.Bool("is_bot", vc.Member.User.Bot), zap.Bool("has_joined", hasJoined), zap.Bool("has_left", hasLeft))
-
-	ctx := context.Background()
-	isInBlacklist, err := g.isInBlacklist(ctx, vc.VoiceState.Member.User.ID)
-	if err != nil {
-		g.logger.Warn("unable to check blacklist status for user", zap.Error(err), zap.String("user_id", vc.VoiceState.Member.User.ID))
-	}
-
-	if isInBlacklist {
-		return
-	}
-
-	if hasLeft {
-		g.mu.Lock()
-		perms, err := session.UserChannelPermissions(session.State.Ready.User.ID, vc.BeforeUpdate.ChannelID)
-		if err != nil {
-			g.logger.Error("unable to get permissions for channel", zap.Error(err), zap.String("channel_id", vc.BeforeUpdate.ChannelID))
-			g.mu.Unlock()
-			return
-		}
-
-		if perms&discordgo.PermissionVoiceConnect == 0 || perms&discordgo.PermissionVoiceSpeak == 0 {
-			g.logger.Info("Bot will not be joining voice channel because they do not have sufficient privileges", zap.String("channel_id", vc.BeforeUpdate.ChannelID))
-			g.mu.Unlock()
-			return
-		}
-
-		channelMemberCount, err := util.GetVoiceChannelMemberCount(session, vc.BeforeUpdate.GuildID, vc.BeforeUpdate.ChannelID)
-		if err != nil {
-			g.logger.Error("error getting channel member count", zap.Error(err), zap.String("channel_id", vc.BeforeUpdate.ChannelID), zap.String("guild_id", vc.BeforeUpdate.GuildID))
-			g.mu.Unlock()
-			return
-		}
-
-		if channelMemberCount <= 1 {
-			if botVoiceConnection, ok := session.VoiceConnections[vc.GuildID]; ok && botVoiceConnection.ChannelID == vc.BeforeUpdate.ChannelID {
-				if err := botVoiceConnection.Disconnect(); err != nil {
-					g.logger.Error("error disconnecting from channel", zap.Error(err), zap.String("channel_id", vc.BeforeUpdate.ChannelID))
-					g.mu.Unlock()
-					return
-				}
-
-				delete(g.guildPlayerMappings, vc.GuildID)
-			}
-			g.mu.Unlock()
-			return
-		}
-		g.mu.Unlock()
-	}
-
-	var COLLECTION string
-	if hasJoined {
-		COLLECTION = WelcomeCollection
-	} else {
-		COLLECTION = OutroCollection
-	}
-
-	if hasJoined || hasLeft {
-		var targetChannelID string
-		if hasLeft {
-			targetChannelID = vc.BeforeUpdate.ChannelID
-		} else if hasJoined {
-			targetChannelID = vc.ChannelID
-		}
-		g.mu.Lock()
-
-		if _, ok := g.guildPlayerMappings[vc.GuildID]; !ok {
-			perms, err := session.UserChannelPermissions(session.State.Ready.User.ID, targetChannelID)
-			if err != nil {
-				g.logger.Error("unable to get permissions for channel", zap.Error(err), zap.String("channel_id", targetChannelID))
-				g.mu.Unlock()
-				return
-			}
-
-			if perms&int64(discordgo.PermissionVoiceConnect) == 0 || perms&int64(discordgo.PermissionVoiceSpeak) == 0 {
-				g.logger.Info("Bot will not be joining voice channel because they do not have sufficient privileges", zap.String("channel_id", targetChannelID))
-				g.mu.Unlock()
-				return
-			}
-
-			channelVoiceConnection, err := session.ChannelVoiceJoin(vc.GuildID, targetChannelID, false, true)
-			if err != nil {
-				g.logger.Error("error unable to join voice channel", zap.String("channel_id", targetChannelID), zap.String("guild_id", vc.GuildID), zap.Error(err))
-				g.mu.Unlock()
-				return
-			}
-
-			g.guildPlayerMappings[vc.GuildID] = &guildPlayer{
-				guildID:     vc.GuildID,
-				voiceClient: channelVoiceConnection,
-				queue:       []string{},
-				voiceState:  NotPlaying,
-			}
-		}
-
-		randomAudioTrack, err := g.retrieveRandomAudioName(ctx, COLLECTION, vc.UserID)
-		if err != nil {
-			if status.Code(err) == codes.NotFound {
-				g.logger.Info("voiceline won't be played because user does not have intro/outro", zap.String("user_id", vc.UserID))
-			} else {
-				g.logger.Error("failed to get random audio track from firestore", zap.Error(err), zap.String("user_id", vc.UserID))
-			}
-			g.mu.Unlock()
-			return
-		}
-
-		audioBytes, err := g.firebaseAdapter.DownloadFileBytes(ctx, BucketName, fmt.Sprintf("voicelines/%s", randomAudioTrack))
-		if err != nil {
-			g.logger.Error("failed to get audio bytes from storage", zap.Error(err))
-			g.mu.Unlock()
-			return
-		}
-
-		file, err := util.DownloadFileToTempDirectory(audioBytes)
-		if err != nil {
-			g.logger.Error("failed to download audio bytes to temporary directory", zap.Error(err))
-			g.mu.Unlock()
-			return
-		}
-
-		g.guildPlayerMappings[vc.GuildID].queue = append(g.guildPlayerMappings[vc.GuildID].queue, file.Name())
-		g.mu.Unlock()
+		{
+			Name:                     "debug",
+			Description:              "Diagnostics for server administrators",
+			DefaultMemberPermissions: &manageGuildPermission,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "voice",
+					Description: "Shows the bot's voice player state for this server",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+				},
+			},
+		},
+		{
+			Name:                     "guildstats",
+			Description:              "Summarizes the voicelines and greetings of this server",
+			DefaultMemberPermissions: &manageGuildPermission,
+		},
+		{
+			Name:                     "departed",
+			Description:              "Manage the voicelines of members who have left this server",
+			DefaultMemberPermissions: &manageGuildPermission,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "list",
+					Description: "Lists members who left this server",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+				},
+				{
+					Name:        "archive",
+					Description: "Archives a departed member's voicelines so they can reclaim them later",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:         "member",
+							Description:  "Departed member",
+							Type:         discordgo.ApplicationCommandOptionString,
+							Required:     true,
+							Autocomplete: true,
+						},
+					},
+				},
+				{
+					Name:        "purge",
+					Description: "Permanently deletes a departed member's voicelines",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:         "member",
+							Description:  "Departed member",
+							Type:         discordgo.ApplicationCommandOptionString,
+							Required:     true,
+							Autocomplete: true,
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:        "myvoicelines",
+			Description: "Manage your own intros and outros",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "list",
+					Description: "Lists your voicelines",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "type",
+							Description: "Intro or outro",
+							Type:        discordgo.ApplicationCommandOptionString,
+							Required:    true,
+							Choices: []*discordgo.ApplicationCommandOptionChoice{
+								{Name: "Intro", Value: "intro"},
+								{Name: "Outro", Value: "outro"},
+							},
+						},
+					},
+				},
+				{
+					Name:        "weight",
+					Description: "Changes how often one of your voicelines is picked",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "type",
+							Description: "Intro or outro",
+							Type:        discordgo.ApplicationCommandOptionString,
+							Required:    true,
+							Choices: []*discordgo.ApplicationCommandOptionChoice{
+								{Name: "Intro", Value: "intro"},
+								{Name: "Outro", Value: "outro"},
+							},
+						},
+						{
+							Name:         "track",
+							Description:  "One of your voicelines",
+							Type:         discordgo.ApplicationCommandOptionString,
+							Required:     true,
+							Autocomplete: true,
+						},
+						{
+							Name:        "weight",
+							Description: "How likely it is to be picked compared to your others, 1 by default",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Required:    true,
+							MinValue:    &minTrackWeight,
+							MaxValue:    float64(maxTrackWeight),
+						},
+					},
+				},
+				{
+					Name:        "pin",
+					Description: "Pins a voiceline so it plays every time, or unpins it",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "type",
+							Description: "Intro or outro",
+							Type:        discordgo.ApplicationCommandOptionString,
+							Required:    true,
+							Choices: []*discordgo.ApplicationCommandOptionChoice{
+								{Name: "Intro", Value: "intro"},
+								{Name: "Outro", Value: "outro"},
+							},
+						},
+						{
+							Name:         "track",
+							Description:  "One of your voicelines",
+							Type:         discordgo.ApplicationCommandOptionString,
+							Required:     true,
+							Autocomplete: true,
+						},
+					},
+				},
+				{
+					Name:        "reorder",
+					Description: "Moves one of your voicelines to another spot in your list",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "type",
+							Description: "Intro or outro",
+							Type:        discordgo.ApplicationCommandOptionString,
+							Required:    true,
+							Choices: []*discordgo.ApplicationCommandOptionChoice{
+								{Name: "Intro", Value: "intro"},
+								{Name: "Outro", Value: "outro"},
+							},
+						},
+						{
+							Name:         "track",
+							Description:  "One of your voicelines",
+							Type:         discordgo.ApplicationCommandOptionString,
+							Required:     true,
+							Autocomplete: true,
+						},
+						{
+							Name:        "position",
+							Description: "Where it should go in your list, starting from 1",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Required:    true,
+							MinValue:    &minTrackPosition,
+						},
+					},
+				},
+				{
+					Name:        "delete",
+					Description: "Deletes one of your voicelines",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "type",
+							Description: "Intro or outro",
+							Type:        discordgo.ApplicationCommandOptionString,
+							Required:    true,
+							Choices: []*discordgo.ApplicationCommandOptionChoice{
+								{Name: "Intro", Value: "intro"},
+								{Name: "Outro", Value: "outro"},
+							},
+						},
+						{
+							Name:         "track",
+							Description:  "One of your voicelines",
+							Type:         discordgo.ApplicationCommandOptionString,
+							Required:     true,
+							Autocomplete: true,
+						},
+					},
+				},
+				{
+					Name:        "chain",
+					Description: "Plays 2 or 3 of your voicelines back to back as one greeting",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "type",
+							Description: "Intro or outro",
+							Type:        discordgo.ApplicationCommandOptionString,
+							Required:    true,
+							Choices: []*discordgo.ApplicationCommandOptionChoice{
+								{Name: "Intro", Value: "intro"},
+								{Name: "Outro", Value: "outro"},
+							},
+						},
+						{
+							Name:         "first",
+							Description:  "Plays first",
+							Type:         discordgo.ApplicationCommandOptionString,
+							Required:     true,
+							Autocomplete: true,
+						},
+						{
+							Name:         "second",
+							Description:  "Plays second",
+							Type:         discordgo.ApplicationCommandOptionString,
+							Required:     true,
+							Autocomplete: true,
+						},
+						{
+							Name:         "third",
+							Description:  "Plays last",
+							Type:         discordgo.ApplicationCommandOptionString,
+							Required:     false,
+							Autocomplete: true,
+						},
+					},
+				},
+				{
+					Name:        "unchain",
+					Description: "Goes back to playing one of your voicelines at a time",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "type",
+							Description: "Intro or outro",
+							Type:        discordgo.ApplicationCommandOptionString,
+							Required:    true,
+							Choices: []*discordgo.ApplicationCommandOptionChoice{
+								{Name: "Intro", Value: "intro"},
+								{Name: "Outro", Value: "outro"},
+							},
+						},
+					},
+				},
+				{
+					Name:        "delay",
+					Description: "Waits a few seconds after you join before playing your intro",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "seconds",
+							Description: "Between 0 and 10 seconds",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Required:    true,
+							MinValue:    &minEntranceDelay,
+							MaxValue:    maxEntranceDelay.Seconds(),
+						},
+					},
+				},
+				{
+					Name:        "toggle",
+					Description: "Turns your intros or outros off or back on",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "type",
+							Description: "Intro or outro",
+							Type:        discordgo.ApplicationCommandOptionString,
+							Required:    true,
+							Choices: []*discordgo.ApplicationCommandOptionChoice{
+								{Name: "Intro", Value: "intro"},
+								{Name: "Outro", Value: "outro"},
+							},
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:                     "rejoin",
+			Description:              "Reconnect to my voice channel, picking up changes to how I join",
+			DefaultMemberPermissions: &manageGuildPermission,
+		},
+		{
+			Name:                     "guildsettings",
+			Description:              "Configure how greetings behave in this server",
+			DefaultMemberPermissions: &manageGuildPermission,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "caps",
+					Description: "Limit how many greetings play so busy servers aren't a nonstop jingle machine",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "hourly",
+							Description: "Most greetings per voice channel each hour, 0 for unlimited",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Required:    true,
+							MinValue:    &minGreetingCap,
+						},
+						{
+							Name:        "daily",
+							Description: "Most greetings in this server each day, 0 for unlimited",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Required:    true,
+							MinValue:    &minGreetingCap,
+						},
+					},
+				},
+				{
+					Name:        "loudness",
+					Description: "Catch ear splitting uploads, leave the limit out to stop checking",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "limit",
+							Description: "The loudest an upload can be in LUFS, around -10 catches clips that are mostly noise",
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							MinValue:    &minLoudness,
+							MaxValue:    -1,
+						},
+						{
+							Name:        "action",
+							Description: "What to do with uploads over the limit, rejecting them by default",
+							Type:        discordgo.ApplicationCommandOptionString,
+							Choices: []*discordgo.ApplicationCommandOptionChoice{
+								{
+									Name:  "Reject",
+									Value: loudnessReject,
+								},
+								{
+									Name:  "Turn down",
+									Value: loudnessNormalize,
+								},
+							},
+						},
+					},
+				},
+				{
+					Name:        "strict",
+					Description: "Screen uploads for objectionable content before they're stored",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "enabled",
+							Description: "Whether uploads are screened",
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+							Required:    true,
+						},
+					},
+				},
+				{
+					Name:        "modlog",
+					Description: "Send voiceline reports and voice join problems to a moderator channel, leave the channel out to stop",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:         "channel",
+							Description:  "The text channel moderators read reports in",
+							Type:         discordgo.ApplicationCommandOptionChannel,
+							ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText},
+						},
+					},
+				},
+				{
+					Name:        "notifications",
+					Description: "Post a short lived message whenever a greeting plays, leave the channel out to stop",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:         "channel",
+							Description:  "The text channel to post notifications in",
+							Type:         discordgo.ApplicationCommandOptionChannel,
+							ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText},
+						},
+					},
+				},
+				{
+					Name:        "nickname",
+					Description: "Change what I'm called in this server, leave the name out to go back to my username",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "name",
+							Description: "My new nickname",
+							Type:        discordgo.ApplicationCommandOptionString,
+							MaxLength:   maxNicknameLength,
+						},
+					},
+				},
+				{
+					Name:        "status",
+					Description: "Add a status to the ones I rotate through, leave the text out to remove it (bot owners only)",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "text",
+							Description: "The status, shown in every server I'm in",
+							Type:        discordgo.ApplicationCommandOptionString,
+							MaxLength:   maxStatusLength,
+						},
+					},
+				},
+				{
+					Name:        "musicbots",
+					Description: "Choose what greetings do while another bot is playing music in the channel",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "action",
+							Description: "What greetings do over music",
+							Type:        discordgo.ApplicationCommandOptionString,
+							Required:    true,
+							Choices: []*discordgo.ApplicationCommandOptionChoice{
+								{
+									Name:  "Play over it",
+									Value: musicBotPlay,
+								},
+								{
+									Name:  "Skip the greeting",
+									Value: musicBotSkip,
+								},
+								{
+									Name:  "Wait for it to stop",
+									Value: musicBotDelay,
+								},
+								{
+									Name:  "Play quieter",
+									Value: musicBotDuck,
+								},
+							},
+						},
+					},
+				},
+				{
+					Name:        "voice",
+					Description: "Choose whether I join voice channels muted or deafened",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "muted",
+							Description: "Whether I join self muted, off by default",
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+							Required:    true,
+						},
+						{
+							Name:        "deafened",
+							Description: "Whether I join self deafened, on by default",
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+							Required:    true,
+						},
+					},
+				},
+				{
+					Name:        "silence",
+					Description: "Wait for a pause in conversation before playing greetings",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "enabled",
+							Description: "Whether greetings wait for silence",
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+							Required:    true,
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:                     "botsound",
+			Description:              "Configure the sound I play when joining a voice channel in this server",
+			DefaultMemberPermissions: &manageGuildPermission,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "set",
+					Description: "Uploads a short sound to play when I join a voice channel",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "file",
+							Description: "An .mp3 or .m4a file under 1 MB",
+							Type:        discordgo.ApplicationCommandOptionAttachment,
+							Required:    true,
+						},
+					},
+				},
+				{
+					Name:        "clear",
+					Description: "Stops playing a sound when I join a voice channel",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+				},
+			},
+		},
+		{
+			Name:                     "eventmode",
+			Description:              "Loosen cooldowns and greeting caps and play a party voice pack for a while",
+			DefaultMemberPermissions: &manageGuildPermission,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "on",
+					Description: "Starts an event, it ends on its own after the hours given",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:         "pack",
+							Description:  "The voice pack members without their own voicelines hear, the last one used when unset",
+							Type:         discordgo.ApplicationCommandOptionString,
+							Autocomplete: true,
+						},
+						{
+							Name:        "hours",
+							Description: fmt.Sprintf("How long the event lasts, %d hours when unset", defaultEventHours),
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							MinValue:    &minEventHours,
+							MaxValue:    maxEventHours,
+						},
+					},
+				},
+				{
+					Name:        "off",
+					Description: "Ends the event now",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+				},
+			},
+		},
+		{
+			Name:                     "firstjoin",
+			Description:              "Welcome members the first time they join voice in this server",
+			DefaultMemberPermissions: &manageGuildPermission,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "clip",
+					Description: "Sets the clip played ahead of a new member's intro, leave the file out to remove it",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "file",
+							Description: "An .mp3 or .m4a file under 5 MB",
+							Type:        discordgo.ApplicationCommandOptionAttachment,
+						},
+					},
+				},
+				{
+					Name:        "message",
+					Description: "Sets the welcome posted for new members, leave the text out to stop posting",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "text",
+							Description: "The welcome, {member} is replaced with a mention of the new member",
+							Type:        discordgo.ApplicationCommandOptionString,
+							MaxLength:   maxFirstJoinMessageLength,
+						},
+						{
+							Name:         "channel",
+							Description:  "Where to post it, the chat of the voice channel they joined when unset",
+							Type:         discordgo.ApplicationCommandOptionChannel,
+							ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText},
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:                     "stinger",
+			Description:              "Play a fanfare for members holding a role when they join voice",
+			DefaultMemberPermissions: &manageGuildPermission,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "set",
+					Description: "Sets the stinger of a role, replacing the one it had",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "role",
+							Description: "The role whose members hear the stinger",
+							Type:        discordgo.ApplicationCommandOptionRole,
+							Required:    true,
+						},
+						{
+							Name:        "file",
+							Description: "An .mp3 or .m4a file under 1 MB",
+							Type:        discordgo.ApplicationCommandOptionAttachment,
+							Required:    true,
+						},
+						{
+							Name:        "mode",
+							Description: "When the stinger plays, before the member's own intro by default",
+							Type:        discordgo.ApplicationCommandOptionString,
+							Choices: []*discordgo.ApplicationCommandOptionChoice{
+								{Name: "Before their intro", Value: stingerBefore},
+								{Name: "After their intro", Value: stingerAfter},
+								{Name: "Instead of their intro", Value: stingerInstead},
+							},
+						},
+					},
+				},
+				{
+					Name:        "clear",
+					Description: "Stops playing a role's stinger",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "role",
+							Description: "The role whose stinger to remove",
+							Type:        discordgo.ApplicationCommandOptionRole,
+							Required:    true,
+						},
+					},
+				},
+				{
+					Name:        "list",
+					Description: "Shows the roles that have a stinger",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+				},
+			},
+		},
+		{
+			Name:        "roulette",
+			Description: "Plays the intro of a random member in your voice channel",
+		},
+		{
+			Name:        "guess",
+			Description: "Guess whose intro is playing",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "play",
+					Description: "Plays a random intro of someone in your voice channel for everyone to guess",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+				},
+				{
+					Name:        "leaderboard",
+					Description: "Shows who has guessed the most intros right",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+				},
+			},
+		},
+		{
+			Name:        "archive",
+			Description: "Browse the voicelines archived for a member and restore them",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "member",
+					Type:        discordgo.ApplicationCommandOptionUser,
+					Description: "The member whose archive to browse, yourself if left out",
+				},
+			},
+		},
+		{
+			Name:                     "export-all",
+			Description:              "Download every voiceline of this server's members as one zip",
+			DefaultMemberPermissions: &manageGuildPermission,
+		},
+		{
+			Name:                     "checkperms",
+			Description:              "Lists the voice channels I can't greet members in and the permissions I'm missing there",
+			DefaultMemberPermissions: &manageGuildPermission,
+		},
+		{
+			Name:                     "upload-default",
+			Description:              "Set the greeting played for members who haven't uploaded their own",
+			DefaultMemberPermissions: &manageGuildPermission,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "type",
+					Description: "Intro or outro",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    true,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "Intro", Value: "intro"},
+						{Name: "Outro", Value: "outro"},
+					},
+				},
+				{
+					Name:        "file",
+					Description: "An .mp3 or .m4a file under 5 MB, leave it out to remove the default",
+					Type:        discordgo.ApplicationCommandOptionAttachment,
+				},
+			},
+		},
+		{
+			Name:                     "voicepack",
+			Description:              "Greet members who haven't uploaded their own voicelines with a curated pack",
+			DefaultMemberPermissions: &manageGuildPermission,
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "list",
+					Description: "Shows the voice packs that can be installed",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+				},
+				{
+					Name:        "install",
+					Description: "Installs a voice pack, replacing the one installed before",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:         "pack",
+							Description:  "The voice pack to install",
+							Type:         discordgo.ApplicationCommandOptionString,
+							Required:     true,
+							Autocomplete: true,
+						},
+					},
+				},
+				{
+					Name:        "uninstall",
+					Description: "Stops greeting members who don't have their own voicelines",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+				},
+			},
+		},
+		{
+			Name:        "library",
+			Description: "Share your voicelines with everyone or find ones others have shared",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "publish",
+					Description: "Publishes one of your voicelines to the shared library",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "type",
+							Description: "Intro or outro",
+							Type:        discordgo.ApplicationCommandOptionString,
+							Required:    true,
+							Choices: []*discordgo.ApplicationCommandOptionChoice{
+								{Name: "Intro", Value: "intro"},
+								{Name: "Outro", Value: "outro"},
+							},
+						},
+						{
+							Name:         "track",
+							Description:  "The voiceline to publish",
+							Type:         discordgo.ApplicationCommandOptionString,
+							Required:     true,
+							Autocomplete: true,
+						},
+						{
+							Name:        "title",
+							Description: "What others will find it by",
+							Type:        discordgo.ApplicationCommandOptionString,
+							Required:    true,
+							MaxLength:   maxLibraryTitle,
+						},
+					},
+				},
+				{
+					Name:        "search",
+					Description: "Finds clips in the shared library to import",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:        "query",
+							Description: "Words in the title, leave it out to see the most popular clips",
+							Type:        discordgo.ApplicationCommandOptionString,
+						},
+					},
+				},
+				{
+					Name:        "unpublish",
+					Description: "Removes a clip you published from the library",
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Name:         "entry",
+							Description:  "The clip to remove",
+							Type:         discordgo.ApplicationCommandOptionString,
+							Required:     true,
+							Autocomplete: true,
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:        "queue",
+			Description: "Shows the voiceline playing right now and the ones waiting to play",
+		},
+		{
+			Name:        "donotdisturb",
+			Description: "Skip your intros and outros while your status is do not disturb or invisible",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "enabled",
+					Description: "Whether to skip your voicelines while on do not disturb",
+					Type:        discordgo.ApplicationCommandOptionBoolean,
+					Required:    true,
+				},
+			},
+		},
+		{
+			Name:        "language",
+			Description: "Pick the language I answer you in, automatic follows your Discord client",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "language",
+					Description: "The language to answer you in",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    true,
+					Choices:     languageChoices(),
+				},
+			},
+		},
+		{
+			Name:        "reclaim",
+			Description: "Restores your voicelines archived after you left a server",
+		},
+		{
+			Name:        "effects",
+			Description: "Puts a fun effect on one of your voicelines, or takes it off",
+			Options: []*discordgo.ApplicationCommandOption{
+				{
+					Name:        "type",
+					Description: "Intro or outro",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    true,
+					Choices: []*discordgo.ApplicationCommandOptionChoice{
+						{Name: "Intro", Value: "intro"},
+						{Name: "Outro", Value: "outro"},
+					},
+				},
+				{
+					Name:         "track",
+					Description:  "One of your voicelines",
+					Type:         discordgo.ApplicationCommandOptionString,
+					Required:     true,
+					Autocomplete: true,
+				},
+				{
+					Name:        "effect",
+					Description: "How it should sound",
+					Type:        discordgo.ApplicationCommandOptionString,
+					Required:    true,
+					Choices:     effectChoices(),
+				},
+			},
+		},
+	}
+}
+
+// Stop waits for the voice events already queued to be handled, later ones are dropped.
+func (g *greeterRunner) Stop() {
+	g.voiceEvents.Stop()
+}
+
+func (g *greeterRunner) RegisterHandlers(session *discordgo.Session, r *router.Router) {
+	g.voiceEvents.Start(g.handleVoiceEvent)
+
+	session.AddHandler(g.voiceUpdate)
+	session.AddHandler(g.voiceServerUpdate)
+	session.AddHandler(g.presenceUpdate)
+	session.AddHandler(g.memberRemove)
+	session.AddHandler(g.memberAdd)
+
+	go g.watchBlacklist(context.Background())
+
+	if g.scheduler != nil {
+		err := g.scheduler.Register(scheduler.Job{
+			Name:      "voiceline-expiry",
+			Interval:  expirySweepInterval,
+			Jitter:    time.Minute * 5,
+			Exclusive: true,
+			Run:       g.archiveExpiredVoicelines,
+		})
+		if err != nil {
+			g.logger.Error("unable to schedule voiceline expiry", zap.Error(err))
+		}
+
+		err = g.scheduler.Register(scheduler.Job{
+			Name:      "unplayed-voicelines",
+			Interval:  unplayedDigestInterval,
+			Jitter:    time.Minute * 30,
+			Exclusive: true,
+			Run: func(ctx context.Context) error {
+				return g.suggestUnplayedCleanups(ctx, session)
+			},
+		})
+		if err != nil {
+			g.logger.Error("unable to schedule unplayed voiceline digests", zap.Error(err))
+		}
+
+		err = g.scheduler.Register(scheduler.Job{
+			Name:      "event-mode-expiry",
+			Interval:  eventModeExpiryInterval,
+			Exclusive: true,
+			Run: func(ctx context.Context) error {
+				return g.endExpiredEventModes(ctx, session)
+			},
+		})
+		if err != nil {
+			g.logger.Error("unable to schedule event mode expiry", zap.Error(err))
+		}
+
+		// Every instance probes the connections it holds itself
+		err = g.scheduler.Register(scheduler.Job{
+			Name:     "voice-quality-probe",
+			Interval: voiceProbeInterval,
+			Run:      g.probeVoiceServers,
+		})
+		if err != nil {
+			g.logger.Error("unable to schedule voice quality probes", zap.Error(err))
+		}
+	}
+
+	commandMiddlewares := func(command string, extra ...middleware.Middleware) []middleware.Middleware {
+		config, ok := commandRateLimits[command]
+		if !ok {
+			config = defaultRateLimit
+		}
+
+		config.Clock = g.clock
+		config.Relaxed = g.inEventMode
+
+		return slices.Concat([]middleware.Middleware{
+			middleware.RequireGuild(),
+			middleware.RateLimit(middleware.NewRateLimiter(config)),
+		}, extra)
+	}
+
+	r.Command("upload", g.upload, commandMiddlewares("upload", middleware.Defer(false))...)
+	r.Command("upload-manifest", g.uploadManifest, commandMiddlewares("upload-manifest", middleware.RequirePermissions(discordgo.PermissionManageServer), middleware.Defer(true))...)
+	r.Command("voicelines", g.voicelines, commandMiddlewares("voicelines", middleware.AutoDefer(middleware.DefaultAutoDeferAfter, false))...)
+	r.Command("help", g.help, commandMiddlewares("help")...)
+	r.Command("blacklist", g.blacklist, commandMiddlewares("blacklist")...)
+	r.Command("whitelist", g.whitelist, commandMiddlewares("whitelist")...)
+	r.Command("delete", g.delete, commandMiddlewares("delete", middleware.Defer(false))...)
+	r.Command("checkperms", g.checkPerms, commandMiddlewares("checkperms", middleware.RequirePermissions(discordgo.PermissionManageServer))...)
+	r.Command("debug", g.debug, commandMiddlewares("debug", middleware.RequirePermissions(discordgo.PermissionManageServer))...)
+	r.Command("guildstats", g.guildStats, commandMiddlewares("guildstats", middleware.RequirePermissions(discordgo.PermissionManageServer), middleware.Defer(true))...)
+	r.Command("departed", g.departed, commandMiddlewares("departed", middleware.RequirePermissions(discordgo.PermissionManageServer), middleware.Defer(true))...)
+	r.Command("reclaim", g.reclaim, commandMiddlewares("reclaim", middleware.Defer(true))...)
+	r.Command("myvoicelines", g.myVoicelines, commandMiddlewares("myvoicelines", middleware.AutoDefer(middleware.DefaultAutoDeferAfter, true))...)
+	r.Command("rejoin", g.rejoin, commandMiddlewares("rejoin", middleware.RequirePermissions(discordgo.PermissionManageServer))...)
+	r.Command("guildsettings", g.configureGuild, commandMiddlewares("guildsettings", middleware.RequirePermissions(discordgo.PermissionManageServer))...)
+	r.Command("eventmode", g.eventMode, commandMiddlewares("eventmode", middleware.RequirePermissions(discordgo.PermissionManageServer))...)
+	r.Command("firstjoin", g.firstJoin, commandMiddlewares("firstjoin", middleware.RequirePermissions(discordgo.PermissionManageServer), middleware.Defer(true))...)
+	r.Command("stinger", g.stinger, commandMiddlewares("stinger", middleware.RequirePermissions(discordgo.PermissionManageServer), middleware.Defer(true))...)
+	r.Command("botsound", g.botSound, commandMiddlewares("botsound", middleware.RequirePermissions(discordgo.PermissionManageServer), middleware.Defer(true))...)
+	r.Command("roulette", g.roulette, commandMiddlewares("roulette")...)
+	r.Command("guess", g.guessGame, commandMiddlewares("guess", middleware.Defer(false))...)
+	r.Command("archive", g.archive, commandMiddlewares("archive", middleware.Defer(true))...)
+	r.Command("queue", g.showQueue, commandMiddlewares("queue")...)
+	r.Command("library", g.library, commandMiddlewares("library", middleware.AutoDefer(middleware.DefaultAutoDeferAfter, true))...)
+	r.Command("upload-default", g.uploadDefault, commandMiddlewares("upload-default", middleware.RequirePermissions(discordgo.PermissionManageServer), middleware.Defer(true))...)
+	r.Command("voicepack", g.voicePacks, commandMiddlewares("voicepack", middleware.RequirePermissions(discordgo.PermissionManageServer))...)
+	r.Command("export-all", g.exportAll, commandMiddlewares("export-all", middleware.RequirePermissions(discordgo.PermissionManageServer), middleware.Defer(true))...)
+	r.Command("donotdisturb", g.doNotDisturb, commandMiddlewares("donotdisturb")...)
+	r.Command("language", g.setLanguage, commandMiddlewares("language")...)
+	r.Command("effects", g.effects, commandMiddlewares("effects", middleware.Defer(true))...)
+	r.Autocomplete("departed", g.departedAutocomplete)
+	r.Autocomplete("myvoicelines", g.myVoicelinesAutocomplete)
+	r.Autocomplete("library", g.libraryAutocomplete)
+	r.Autocomplete("voicepack", g.voicePackAutocomplete)
+	r.Autocomplete("eventmode", g.voicePackAutocomplete)
+	r.Autocomplete("effects", g.effectsAutocomplete)
+
+	r.Component(embeds.PaginationComponentPrefix, g.paginate)
+	r.Component(deleteSelectMenuPrefix, g.deleteSelected)
+	r.Component(deleteConfirmPrefix, g.deleteConfirmed)
+	r.Component(reportPrefix, g.report, middleware.RequireGuild())
+	r.Component(trackTogglePrefix, g.trackToggle, middleware.RequireGuild())
+	r.Component(previewPrefix, g.preview, middleware.RequireGuild())
+	r.Component(libraryImportPrefix, g.libraryImport, middleware.RequireGuild())
+	r.Component(guessPrefix, g.guess, middleware.RequireGuild())
+	r.Component(archivePagePrefix, g.archivePageTurn, middleware.RequireGuild())
+	r.Component(archiveRestorePrefix, g.archiveRestore, middleware.RequireGuild())
+	r.Component(unplayedArchivePrefix, g.unplayedArchive)
+	r.Component(archiveDeletePrefix, g.archiveDelete, middleware.RequireGuild(), middleware.RequirePermissions(discordgo.PermissionManageServer))
+	r.Component(queueSkipPrefix, g.skipClip, middleware.RequireGuild(), middleware.RequirePermissions(discordgo.PermissionVoiceMuteMembers))
+}
+
+// PurgeCache drops every stored pagination state and cached blacklist record, returning how many entries were removed.
+func (g *greeterRunner) PurgeCache() int {
+	return g.messageStore.purge() + g.blacklistCache.purge()
+}
+
+// QueueDepths reports how many voicelines are waiting to be played in each guild the bot is connected to.
+func (g *greeterRunner) QueueDepths() map[string]int {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	depths := make(map[string]int, len(g.guildPlayerMappings))
+	for guildID, player := range g.guildPlayerMappings {
+		depths[guildID] = len(player.queue)
+	}
+
+	return depths
+}
+
+func (g *greeterRunner) globalPlay() {
+	for gp := range g.songSignal {
+		go g.playAudio(gp)
+	}
+}
+
+// voiceEvent is a voice state update waiting on the voice event queue.
+type voiceEvent struct {
+	session    *discordgo.Session
+	update     *discordgo.VoiceStateUpdate
+	receivedAt time.Time
+}
+
+func voiceStateChange(vc *discordgo.VoiceStateUpdate) (bool, bool) {
+	hasJoined := vc.BeforeUpdate == nil && !vc.VoiceState.Member.User.Bot && vc.ChannelID != ""
+	hasLeft := vc.BeforeUpdate != nil && !vc.Member.User.Bot && vc.ChannelID == ""
+
+	return hasJoined, hasLeft
+}
+
+// voiceUpdate only queues joins and leaves, everything that waits on firestore or storage happens on the queue's
+// workers so the gateway handler is never held up. Events are sharded by guild so each guild's stay in order.
+func (g *greeterRunner) voiceUpdate(session *discordgo.Session, vc *discordgo.VoiceStateUpdate) {
+	hasJoined, hasLeft := voiceStateChange(vc)
+	logger := logging.WithVoiceState(g.logger, vc)
+
+	logger.Info("voice state update", zap.Bool("is_bot", vc.Member.User.Bot), zap.Bool("has_joined", hasJoined), zap.Bool("has_left", hasLeft))
+
+	if !hasJoined && !hasLeft {
+		return
+	}
+
+	if !g.voiceEventDedup.accept(vc.GuildID, vc.UserID, vc.SessionID, hasJoined, g.clock.Now()) {
+		logger.Info("dropping duplicate or out of order voice state update", zap.String("session_id", vc.SessionID))
+		return
+	}
+
+	if err := g.voiceEvents.Publish(vc.GuildID, voiceEvent{session: session, update: vc, receivedAt: g.clock.Now()}); err != nil {
+		logger.Warn("dropping voice state update", zap.Error(err), zap.Int("queued", g.voiceEvents.Len()))
+	}
+}
+
+func (g *greeterRunner) handleVoiceEvent(event voiceEvent) {
+	session, vc := event.session, event.update
+	hasJoined, hasLeft := voiceStateChange(vc)
+	logger := logging.WithVoiceState(g.logger, vc).With(zap.Duration("queued_for", g.clock.Now().Sub(event.receivedAt)))
+
+	ctx := context.Background()
+
+	if g.leases != nil && !g.leases.Active(ctx, vc.GuildID) {
+		logger.Debug("voice state update left to the instance holding the playback lease")
+		return
+	}
+
+	// Whoever joins will leave at some point and whoever leaves may come back, the next greeting is fetched ahead
+	if hasJoined {
+		go g.prefetchGreeting(context.Background(), OutroCollection, vc.GuildID, vc.UserID)
+	} else {
+		go g.prefetchGreeting(context.Background(), WelcomeCollection, vc.GuildID, vc.UserID)
+	}
+
+	var COLLECTION string
+	if hasJoined {
+		COLLECTION = WelcomeCollection
+	} else {
+		COLLECTION = OutroCollection
+	}
+
+	isInBlacklist, err := g.isInBlacklist(ctx, vc.VoiceState.Member.User.ID, COLLECTION)
+	if err != nil {
+		logger.Warn("unable to check blacklist status for user", zap.Error(err))
+	}
+
+	if isInBlacklist {
+		return
+	}
+
+	if hasLeft {
+		g.mu.Lock()
+		perms, err := session.UserChannelPermissions(session.State.Ready.User.ID, vc.BeforeUpdate.ChannelID)
+		if err != nil {
+			logger.Error("unable to get permissions for channel", zap.Error(err))
+			g.mu.Unlock()
+			return
+		}
+
+		if missing := missingVoicePermissions(perms); len(missing) > 0 {
+			logger.Info("Bot will not be joining voice channel because they do not have sufficient privileges", zap.Strings("missing", missing))
+			g.announceJoinFailure(session, vc.GuildID, vc.BeforeUpdate.ChannelID, missingPermissionsProblem(missing))
+			g.mu.Unlock()
+			return
+		}
+
+		channelMemberCount, err := util.GetVoiceChannelMemberCount(session, vc.BeforeUpdate.GuildID, vc.BeforeUpdate.ChannelID, false)
+		if err != nil {
+			logger.Error("error getting channel member count", zap.Error(err))
+			g.mu.Unlock()
+			return
+		}
+
+		if channelMemberCount <= 1 {
+			if botVoiceConnection, ok := session.VoiceConnections[vc.GuildID]; ok && botVoiceConnection.ChannelID == vc.BeforeUpdate.ChannelID {
+				if err := botVoiceConnection.Disconnect(); err != nil {
+					logger.Error("error disconnecting from channel", zap.Error(err))
+					g.mu.Unlock()
+					return
+				}
+
+				if player, ok := g.guildPlayerMappings[vc.GuildID]; ok {
+					close(player.done)
+				}
+
+				delete(g.guildPlayerMappings, vc.GuildID)
+			}
+			g.mu.Unlock()
+			return
+		}
+		g.mu.Unlock()
+	}
+
+	var targetChannelID string
+	if hasLeft {
+		targetChannelID = vc.BeforeUpdate.ChannelID
+	} else if hasJoined {
+		targetChannelID = vc.ChannelID
+	}
+
+	preferences, err := g.getMemberPreferences(ctx, vc.UserID)
+	if err != nil {
+		logger.Warn("unable to get member preferences", zap.Error(err))
+	}
+
+	if preferences.RespectDoNotDisturb && isDoNotDisturb(session, vc.GuildID, vc.UserID) {
+		logger.Info("voiceline won't be played because user is on do not disturb")
+		return
+	}
+
+	firstJoin := false
+	if hasJoined {
+		guildSettings := g.guildSettings(ctx, vc.GuildID)
+		if firstJoin = g.claimFirstJoin(ctx, logger, session, vc, guildSettings); firstJoin {
+			g.postFirstJoinMessage(ctx, logger, session, vc, guildSettings)
+		}
+
+		delay, err := g.entranceDelay(ctx, vc.UserID)
+		if err != nil {
+			logger.Warn("unable to get entrance delay", zap.Error(err))
+		}
+
+		if delay > 0 {
+			g.clock.AfterFunc(delay, func() {
+				// Members who have already moved on don't get greeted in a channel they're no longer in
+				if voiceState, err := session.State.VoiceState(vc.GuildID, vc.UserID); err != nil || voiceState.ChannelID != targetChannelID {
+					logger.Info("voiceline won't be played because user left before their entrance delay")
+					return
+				}
+
+				g.greet(context.Background(), session, logger, vc, COLLECTION, targetChannelID, g.clock.Now(), firstJoin)
+			})
+
+			return
+		}
+	}
+
+	g.greet(ctx, session, logger, vc, COLLECTION, targetChannelID, event.receivedAt, firstJoin)
+}
+
+// greet downloads the member's greeting and queues it on the guild's player, joining the channel if the bot isn't in one.
+// eventAt is when the member joined or left, the time it takes to start playing is measured from it. Members joining
+// voice in the guild for the first time hear its welcome clip ahead of their intro.
+func (g *greeterRunner) greet(ctx context.Context, session *discordgo.Session, logger *zap.Logger, vc *discordgo.VoiceStateUpdate, collection string, targetChannelID string, eventAt time.Time, firstJoin bool) {
+	guildSettings := g.guildSettings(ctx, vc.GuildID)
+	// Events are meant to be noisy, caps only apply outside of them
+	if !guildSettings.EventModeActive(g.clock.Now()) && !g.caps.allow(vc.GuildID, targetChannelID, g.clock.Now(), guildSettings.HourlyGreetingCap, guildSettings.DailyGreetingCap) {
+		logger.Info("voiceline won't be played because the guild's greeting cap was reached")
+		g.recordGreetingSkip(ctx, logger, vc.GuildID, vc.UserID, collection)
+		return
+	}
+
+	// Dry runs exercise selection and download against real data without ever joining the channel
+	if g.dryRun {
+		if clips, ok := g.downloadGreetingWithStinger(ctx, session, logger, collection, vc); ok {
+			logger.Info("dry run, voiceline would have been played", zap.String("target_channel_id", targetChannelID), zap.String("collection", collection), zap.Int("clips", len(clips)))
+			deleteClips(logger, clips)
+		}
+
+		return
+	}
+
+	// Downloads happen before g.mu is taken so a slow one doesn't hold up greetings in other guilds
+	clips, ok := g.downloadGreetingWithStinger(ctx, session, logger, collection, vc)
+	if firstJoin {
+		clips = g.withFirstJoinClip(ctx, logger, vc, guildSettings, clips)
+		ok = len(clips) > 0
+	}
+
+	if !ok {
+		return
+	}
+
+	for i := range clips {
+		clips[i].eventAt = eventAt
+	}
+
+	if !g.ensureVoice(ctx, session, logger, vc.GuildID, targetChannelID) {
+		deleteClips(logger, clips)
+		return
+	}
+
+	g.mu.Lock()
+	player, ok := g.guildPlayerMappings[vc.GuildID]
+	if !ok {
+		// The bot left the channel again while joining
+		g.mu.Unlock()
+		deleteClips(logger, clips)
+		return
+	}
+
+	// Chained clips are queued together so nothing can be played in between them
+	player.queue = append(player.queue, clips...)
+	idle := player.claimPlayback()
+	g.mu.Unlock()
+
+	g.recordGreetingPlay(ctx, logger, vc.GuildID, vc.UserID, collection)
+	g.recordTrackPlays(ctx, logger, vc.UserID, collection, clips)
+
+	if idle {
+		g.songSignal <- player
+	}
+}
+
+// ensureVoice makes sure the bot is in voice in the guild, joining targetChannelID when it isn't, false means it couldn't
+// join and the reason has been logged. g.mu is only taken to look up and add the player so joining one guild's channel
+// doesn't hold up greetings in the others, while concurrent callers for the same guild share a single join since the bot
+// only has one voice connection per guild and a second join would move it.
+func (g *greeterRunner) ensureVoice(ctx context.Context, session *discordgo.Session, logger *zap.Logger, guildID string, targetChannelID string) bool {
+	joined, _, _ := g.voiceJoins.Do(guildID, func() (interface{}, error) {
+		g.mu.RLock()
+		_, ok := g.guildPlayerMappings[guildID]
+		g.mu.RUnlock()
+
+		if ok {
+			return true, nil
+		}
+
+		player, ok := g.connectVoiceWithBotSound(ctx, session, logger, guildID, targetChannelID)
+		if !ok {
+			return false, nil
+		}
+
+		// Players are only created here and replaced by reconnectVoice, which needs one to exist, so nothing else can
+		// have added one while this was joining
+		g.mu.Lock()
+		g.guildPlayerMappings[guildID] = player
+		g.mu.Unlock()
+
+		return true, nil
+	})
+
+	return joined.(bool)
+}
+
+// connectVoiceWithBotSound is connectVoice with the guild's bot sound queued on the new player.
+func (g *greeterRunner) connectVoiceWithBotSound(ctx context.Context, session *discordgo.Session, logger *zap.Logger, guildID string, targetChannelID string) (*guildPlayer, bool) {
+	player, ok := g.connectVoice(ctx, session, logger, guildID, targetChannelID)
+	if !ok {
+		return nil, false
+	}
+
+	guildSettings := g.guildSettings(ctx, guildID)
+	g.queueBotSound(ctx, logger, player, guildSettings.Storage(g.bucket), guildSettings.BotSound)
+
+	return player, true
+}
+
+// connectVoice joins targetChannelID and creates a player for the guild, without the bot sound ensureVoice plays. The
+// player isn't added to guildPlayerMappings, that's left to the caller under g.mu.
+func (g *greeterRunner) connectVoice(ctx context.Context, session *discordgo.Session, logger *zap.Logger, guildID string, targetChannelID string) (*guildPlayer, bool) {
+	perms, err := session.UserChannelPermissions(session.State.Ready.User.ID, targetChannelID)
+	if err != nil {
+		logger.Error("unable to get permissions for channel", zap.Error(err))
+		return nil, false
+	}
+
+	if missing := missingVoicePermissions(perms); len(missing) > 0 {
+		logger.Info("Bot will not be joining voice channel because they do not have sufficient privileges", zap.Strings("missing", missing))
+		g.announceJoinFailure(session, guildID, targetChannelID, missingPermissionsProblem(missing))
+		return nil, false
+	}
+
+	if channelFull(session, guildID, targetChannelID, perms) {
+		logger.Info("Bot will not be joining voice channel because it is full")
+		g.announceJoinFailure(session, guildID, targetChannelID, "the channel was full, raising its user limit or giving me **Move Members** lets me in")
+		return nil, false
+	}
+
+	guildSettings := g.guildSettings(ctx, guildID)
+	waitForSilence := guildSettings.WaitForSilence
+	mute, deaf, listen := voiceJoinFlags(guildSettings)
+
+	channelVoiceConnection, err := session.ChannelVoiceJoin(guildID, targetChannelID, mute, deaf)
+	if err != nil {
+		logger.Error("error unable to join voice channel", zap.Error(err))
+		g.announceJoinFailure(session, guildID, targetChannelID, "Discord wouldn't let me connect, this is usually a voice region outage and changing the channel's region override can help")
+		return nil, false
+	}
+
+	player := &guildPlayer{
+		guildID:        guildID,
+		session:        session,
+		voiceClient:    channelVoiceConnection,
+		queue:          []queuedClip{},
+		voiceState:     NotPlaying,
+		waitForSilence: waitForSilence,
+		musicBotAction: guildSettings.MusicBotAction,
+		done:           make(chan struct{}),
+	}
+
+	if listen {
+		go g.trackVoiceActivity(player)
+	}
+
+	return player, true
+}
+
+// downloadGreeting picks the member's greeting, either their chain or one of their voicelines, and downloads each clip to
+// a temporary file in play order, logging and returning false when there is nothing to play. Members without voicelines
+// get the guild's default greeting if it has one.
+func (g *greeterRunner) downloadGreeting(ctx context.Context, logger *zap.Logger, collection string, vc *discordgo.VoiceStateUpdate) ([]queuedClip, bool) {
+	if clips, ok := g.prefetches.take(prefetchKey(collection, vc.UserID)); ok {
+		logger.Debug("using prefetched voiceline", zap.String("collection", collection))
+		return clips, true
+	}
+
+	tracks, err := g.retrieveGreeting(ctx, collection, vc.UserID)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			if clips, ok := g.downloadDefaultGreeting(ctx, logger, collection, vc); ok {
+				return clips, true
+			}
+
+			logger.Info("voiceline won't be played because user does not have intro/outro")
+		} else if errors.Is(err, voicelines.ErrDisabled) {
+			logger.Info("voiceline won't be played because user turned them off")
+		} else {
+			logger.Error("failed to get random audio track from firestore", zap.Error(err))
+		}
+		return nil, false
+	}
+
+	if len(tracks) == 0 {
+		if clips, ok := g.downloadDefaultGreeting(ctx, logger, collection, vc); ok {
+			return clips, true
+		}
+
+		logger.Info("voiceline won't be played because user has no tracks left")
+		return nil, false
+	}
+
+	clips := make([]queuedClip, 0, len(tracks))
+	for _, track := range tracks {
+		audioPath, err := g.downloadGreetingTrack(ctx, track, vc)
+		if err != nil {
+			logger.Error("failed to download voiceline", zap.Error(err), zap.String("track_name", track.name))
+
+			// A chain only plays whole, clips that did download are thrown away
+			for _, clip := range clips {
+				if err := util.DeleteFile(clip.audioPath); err != nil {
+					logger.Warn("error trying to delete file", zap.Error(err), zap.String("file_name", clip.audioPath))
+				}
+			}
+
+			return nil, false
+		}
+
+		clips = append(clips, queuedClip{audioPath: audioPath, memberID: vc.UserID, trackName: track.name, collection: collection, announce: len(clips) == 0})
+	}
+
+	logger.Debug("voiceline selected", zap.Strings("track_names", greetingTrackNames(tracks)), zap.String("collection", collection))
+
+	return clips, true
+}
+
+func (g *greeterRunner) downloadVoiceline(ctx context.Context, trackName string, vc *discordgo.VoiceStateUpdate) (string, error) {
+	return g.downloadObject(ctx, firebaseAdapter.Location{Bucket: g.bucket}, fmt.Sprintf("voicelines/%s", trackName), vc)
+}
+
+func (g *greeterRunner) downloadObject(ctx context.Context, location firebaseAdapter.Location, objectName string, vc *discordgo.VoiceStateUpdate) (string, error) {
+	audioBytes, err := g.firebaseAdapter.DownloadFileBytes(ctx, location.Bucket, location.Object(objectName))
+	if err != nil {
+		g.storageFailures.Failure(ctx, storageDownloadFailureKey, err, map[string]string{"guild_id": vc.GuildID, "user_id": vc.UserID})
+		return "", fmt.Errorf("failed to get audio bytes from storage: %w", err)
+	}
+
+	g.storageFailures.Success(storageDownloadFailureKey)
+
+	file, err := util.DownloadFileToTempDirectory(audioBytes)
+	if err != nil {
+		return "", fmt.Errorf("failed to download audio bytes to temporary directory: %w", err)
+	}
+
+	return file.Name(), nil
+}
 
-		if g.guildPlayerMappings[vc.GuildID].voiceState == NotPlaying {
-			g.songSignal <- g.guildPlayerMappings[vc.GuildID]
-		}
+// retrieveGreetingTracks returns the member's chain when they have a complete one, otherwise a single randomly picked track.
+func (g *greeterRunner) retrieveGreetingTracks(ctx context.Context, collection string, userId string) ([]string, error) {
+	tracks, err := g.retrieveGreeting(ctx, collection, userId)
+	if err != nil {
+		return nil, err
 	}
+
+	return greetingTrackNames(tracks), nil
 }
 
-func (g *greeterRunner) retrieveRandomAudioName(ctx context.Context, collection string, userId string) (string, error) {
+// retrieveGreeting is retrieveGreetingTracks along with the effect each track plays with.
+func (g *greeterRunner) retrieveGreeting(ctx context.Context, collection string, userId string) ([]greetingTrack, error) {
 	data, err := g.firebaseAdapter.GetDocumentFromCollection(ctx, collection, userId)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	if disabled, _ := data[DisabledKey].(bool); disabled {
+		return nil, voicelines.ErrDisabled
 	}
 
 	audioListKey := OutroArrayKey
@@ -387,47 +2064,133 @@ func (g *greeterRunner) retrieveRandomAudioName(ctx context.Context, collection
 		audioListKey = IntroArrayKey
 	}
 
-	if audioArray, ok := data[audioListKey]; ok {
-		if audioSlice, ok := audioArray.([]interface{}); ok {
-			randomIndex := rand.Intn(len(audioSlice))
-			if recordMap, ok := audioSlice[randomIndex].(map[string]interface{}); ok {
-				return recordMap["track_name"].(string), nil
-			}
+	trackNames := validChain(data, audioListKey)
+	if len(trackNames) == 0 {
+		if trackName := g.voicelineService.PickRandom(data, audioListKey); trackName != "" {
+			trackNames = []string{trackName}
 		}
 	}
 
-	return "", nil
+	tracks := make([]greetingTrack, 0, len(trackNames))
+	for _, trackName := range trackNames {
+		tracks = append(tracks, greetingTrack{name: trackName, effect: trackEffect(data, audioListKey, trackName)})
+	}
+
+	return tracks, nil
 }
 
-func (g *greeterRunner) retrieveTracks(ctx context.Context, collection string, userId string) ([]interface{}, error) {
-	data, err := g.firebaseAdapter.GetDocumentFromCollection(ctx, collection, userId)
+func (g *greeterRunner) retrieveRandomAudioName(ctx context.Context, collection string, userId string) (string, error) {
+	return g.voicelineService.Pick(ctx, collection, userId)
+}
+
+// addVoiceline uploads the file and appends it to the member's voicelines, returning the generated track name. It's
+// charged to the guild it was uploaded in. The member's document must already exist.
+func (g *greeterRunner) addVoiceline(ctx context.Context, guildID string, collection string, memberID string, addedBy string, file *os.File) (string, error) {
+	info, err := file.Stat()
 	if err != nil {
-		return nil, fmt.Errorf("error getting document from collection: %w", err)
+		return "", fmt.Errorf("error getting upload size: %w", err)
 	}
 
-	audioListKey := OutroArrayKey
-	if collection == WelcomeCollection {
-		audioListKey = IntroArrayKey
-	}
+	return g.storeVoiceline(ctx, guildID, collection, memberID, addedBy, func(objectName string, trackName string) (int64, error) {
+		return info.Size(), g.firebaseAdapter.UploadFileToStorage(ctx, g.bucket, objectName, file, trackName)
+	})
+}
+
+// addVoicelineReader is addVoiceline for clips that were never written to disk, such as entries streamed out of a zip.
+func (g *greeterRunner) addVoicelineReader(ctx context.Context, guildID string, collection string, memberID string, addedBy string, audio io.Reader) (string, error) {
+	return g.storeVoiceline(ctx, guildID, collection, memberID, addedBy, func(objectName string, _ string) (int64, error) {
+		counted := &countingReader{Reader: audio}
+		err := g.firebaseAdapter.UploadReaderToStorage(ctx, g.bucket, objectName, counted)
 
-	if audioArray, ok := data[audioListKey]; ok {
-		if audioSlice, ok := audioArray.([]interface{}); ok {
-			return audioSlice, nil
+		return counted.read, err
+	})
+}
+
+// storeVoiceline adds the voiceline through the voiceline service, reporting storage failures as they happen. upload
+// returns how many bytes it stored, which are charged to the guild once they're stored.
+func (g *greeterRunner) storeVoiceline(ctx context.Context, guildID string, collection string, memberID string, addedBy string, upload func(objectName string, trackName string) (int64, error)) (string, error) {
+	return g.voicelineService.Add(ctx, collection, memberID, addedBy, func(objectName string, trackName string) error {
+		bytes, err := upload(objectName, trackName)
+		if err != nil {
+			g.storageFailures.Failure(ctx, storageUploadFailureKey, err, map[string]string{"user_id": addedBy, "member_id": memberID})
+			return err
 		}
+
+		g.storageFailures.Success(storageUploadFailureKey)
+
+		return g.chargeStorage(ctx, guildID, memberID, trackName, bytes)
+	})
+}
+
+// removeVoicelines archives the given tracks under archive/<member id>/ and removes them from the member's voicelines.
+func (g *greeterRunner) removeVoicelines(ctx context.Context, collection string, memberID string, trackNames []string) error {
+	result, err := g.voicelineService.Delete(ctx, collection, memberID, trackNames)
+	if err != nil {
+		return err
 	}
 
-	return nil, fmt.Errorf("error key was not found: %w", err)
+	return result.Err()
 }
 
+// recordPlayerError keeps the most recent playback failure around for /debug voice.
+func (g *greeterRunner) recordPlayerError(guildPlayer *guildPlayer, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	guildPlayer.lastError = err
+	guildPlayer.lastErrorAt = g.clock.Now()
+}
+
+// claimPlayback marks an idle player as playing, true means the caller has to send it on songSignal once it's released
+// g.mu. Claiming under the same lock the clips were queued with means only one caller starts playAudio for a guild. The
+// caller holds g.mu.
+func (p *guildPlayer) claimPlayback() bool {
+	if p.voiceState != NotPlaying {
+		return false
+	}
+
+	p.voiceState = Playing
+	p.idleStart = true
+
+	return true
+}
+
+// playNext moves on once the current clip is done with, however it ended. The player stays claimed and is sent on
+// songSignal again while clips are queued, otherwise it goes idle. idle makes the next clip wait for silence as
+// though it had been queued on an idle player.
+func (g *greeterRunner) playNext(guildPlayer *guildPlayer, idle bool) {
+	g.mu.Lock()
+	guildPlayer.nowPlaying = nil
+	guildPlayer.encoding = nil
+
+	queued := len(guildPlayer.queue) > 0
+	if queued {
+		guildPlayer.idleStart = idle
+	} else {
+		guildPlayer.voiceState = NotPlaying
+	}
+	g.mu.Unlock()
+
+	if queued {
+		g.songSignal <- guildPlayer
+	}
+}
+
+// playAudio plays the first queued clip, it's only started for a player that was claimed with claimPlayback.
 func (g *greeterRunner) playAudio(guildPlayer *guildPlayer) {
+	g.mu.Lock()
 	if guildPlayer.voiceClient == nil || len(guildPlayer.queue) == 0 {
+		guildPlayer.voiceState = NotPlaying
+		g.mu.Unlock()
 		return
 	}
 
-	g.mu.Lock()
-	guildPlayer.voiceState = Playing
-	audioPath := guildPlayer.queue[0]
+	wasIdle := guildPlayer.idleStart
+	guildPlayer.idleStart = false
+	clip := guildPlayer.queue[0]
+	audioPath := clip.audioPath
 	guildPlayer.queue = guildPlayer.queue[1:]
+	guildPlayer.nowPlaying = &clip
 	g.mu.Unlock()
 
 	defer func() {
@@ -436,246 +2199,409 @@ func (g *greeterRunner) playAudio(guildPlayer *guildPlayer) {
 		}
 	}()
 
+	// Only the first clip waits, the rest of the queue (and any chain) plays straight after it
+	if wasIdle {
+		g.waitForSilence(guildPlayer)
+	}
+
+	// Every clip is checked since music can start partway through a chain
+	play, volume := g.yieldToMusicBots(guildPlayer)
+	if !play {
+		g.playNext(guildPlayer, true)
+		return
+	}
+
+	// ffmpeg keeps running while the clip plays, so the slot is held until the encode session is cleaned up
+	releaseEncode, encodeWait, err := g.encodeQueue.Acquire(context.Background())
+	if err != nil {
+		g.logger.Error("error waiting to encode file", zap.Error(err))
+		g.playNext(guildPlayer, false)
+
+		return
+	}
+
+	defer releaseEncode()
+
 	opts := dca.StdEncodeOptions
 	opts.RawOutput = true
 	opts.Bitrate = 128
+	opts.Volume = volume
 
 	es, err := dca.EncodeFile(audioPath, opts)
 	if err != nil {
 		g.logger.Error("error encoding file", zap.Error(err))
+		g.recordPlayerError(guildPlayer, fmt.Errorf("error encoding file: %w", err))
+		g.playNext(guildPlayer, false)
+
 		return
 	}
 
 	defer es.Cleanup()
 
 	doneChan := make(chan error)
-	guildPlayer.stream = dca.NewStream(es, guildPlayer.voiceClient, doneChan)
-	guildPlayer.voiceState = Playing
+	g.mu.Lock()
+	guildPlayer.encoding = es
+	stream := dca.NewStream(es, guildPlayer.voiceClient, doneChan)
+	guildPlayer.stream = stream
+	g.mu.Unlock()
 
-	for err := range doneChan {
-		if err != nil {
-			if errors.Is(err, io.EOF) {
-				if len(guildPlayer.queue) > 0 {
-					g.songSignal <- guildPlayer
-				} else {
-					guildPlayer.voiceState = NotPlaying
-				}
-			} else {
-				g.logger.Warn("error during audio stream", zap.Error(err))
-			}
+	streamStartedAt := g.clock.Now()
+
+	if !clip.eventAt.IsZero() {
+		latency := g.clock.Now().Sub(clip.eventAt)
+
+		g.mu.Lock()
+		guildPlayer.lastLatency = latency
+		g.mu.Unlock()
+
+		logger := g.logger.With(zap.String("guild_id", guildPlayer.guildID), zap.Duration("latency", latency), zap.Duration("encode_wait", encodeWait), zap.Bool("prefetched", clip.prefetched))
+		if latency > greetingLatencyBudget {
+			logger.Warn("greeting started later than its latency budget", zap.Duration("budget", greetingLatencyBudget))
 		} else {
-			g.logger.Warn("something went wrong during stream session", zap.Error(err))
+			logger.Debug("greeting started")
 		}
 	}
+
+	if clip.announce {
+		go g.announceNowPlaying(guildPlayer, clip)
+	}
+
+	// The stream sends once when it stops and never closes the channel
+	if err := <-doneChan; errors.Is(err, io.EOF) {
+		// Frames that went out late leave the stream behind real time, which members hear as robotic audio
+		g.voiceQualities.recordPlayback(guildPlayer.guildID, max(g.clock.Now().Sub(streamStartedAt)-stream.PlaybackPosition(), 0))
+	} else {
+		g.logger.Warn("error during audio stream", zap.Error(err))
+		g.recordPlayerError(guildPlayer, fmt.Errorf("error during audio stream: %w", err))
+	}
+
+	g.playNext(guildPlayer, false)
 }
 
-func (g *greeterRunner) upload(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
-	if err := session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
-		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
-	}); err != nil {
-		g.logger.Error("error attempting to defer message in upload command", zap.Error(err))
-		return err
+// skippedEntriesText lists the files of a zip upload that weren't extracted and why, only the first few are named.
+func skippedEntriesText(entryErrors []util.EntryError) string {
+	const maxListed = 10
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "%d file(s) in the zip were skipped:", len(entryErrors))
+
+	for _, entryError := range entryErrors[:min(len(entryErrors), maxListed)] {
+		fmt.Fprintf(&text, "\n`%s`: %v", entryError.Name, entryError.Err)
+	}
+
+	if len(entryErrors) > maxListed {
+		fmt.Fprintf(&text, "\n...and %d more", len(entryErrors)-maxListed)
+	}
+
+	return text.String()
+}
+
+// storedClip is an upload that was stored as a track along with what was derived from it on the way in, an empty
+// track name means it was rejected.
+type storedClip struct {
+	trackName  string
+	transcript string
+	// waveform is the object the clip's waveform thumbnail was stored in, empty when it doesn't have one
+	waveform string
+}
+
+// annotations are the fields the clip adds to its track records, empty when nothing was derived from it.
+func (c storedClip) annotations() map[string]interface{} {
+	fields := map[string]interface{}{}
+	if c.transcript != "" {
+		fields["transcript"] = c.transcript
+	}
+
+	if c.waveform != "" {
+		fields["waveform"] = c.waveform
+	}
+
+	return fields
+}
+
+// uploadZipEntry stores one clip of a zip upload. mp3 clips are streamed straight to storage unless the guild screens
+// uploads or limits their loudness or uploads are transcribed, those and clips that have to be transcoded need the
+// clip on disk in dir.
+func (g *greeterRunner) uploadZipEntry(ctx context.Context, dir string, guildID string, collection string, memberID string, addedBy string, entry util.ZipEntry) (storedClip, screening.Result, error) {
+	rc, err := entry.Open()
+	if err != nil {
+		return storedClip{}, screening.Result{}, fmt.Errorf("error opening zip entry %s: %w", entry.Name, err)
+	}
+
+	defer rc.Close()
+
+	// Peeking leaves the sniffed bytes in the reader for whichever path the clip takes
+	clip := bufio.NewReader(rc)
+	head, _ := clip.Peek(16)
+
+	guildSettings := g.guildSettings(ctx, guildID)
+	if util.DetectAudioFormat(head) == util.AudioFormatMP3 && !guildSettings.StrictScreening && guildSettings.MaxLoudness == 0 && g.transcriber == nil {
+		trackName, err := g.addVoicelineReader(ctx, guildID, collection, memberID, addedBy, clip)
+		return storedClip{trackName: trackName}, screening.Result{Verdict: screening.Allow}, err
+	}
+
+	file, err := util.DownloadFileToDirectory(dir, clip)
+	if err != nil {
+		return storedClip{}, screening.Result{}, fmt.Errorf("error extracting zip entry %s: %w", entry.Name, err)
+	}
+
+	defer func() {
+		// The upload closes the file, so only its removal is worth reporting
+		file.Close()
+
+		if err := util.DeleteFile(file.Name()); err != nil {
+			g.logger.Warn("error trying to delete file", zap.Error(err), zap.String("file_name", file.Name()))
+		}
+	}()
+
+	audio, err := g.canonicalizeUpload(ctx, dir, file)
+	if err != nil {
+		return storedClip{}, screening.Result{}, fmt.Errorf("error converting zip entry %s to mp3: %w", entry.Name, err)
+	}
+
+	defer audio.cleanup(g.logger)
+
+	transcript, err := g.transcribeUpload(ctx, audio.file)
+	if err != nil {
+		return storedClip{}, screening.Result{}, err
+	}
+
+	result, err := g.screenUpload(ctx, guildID, audio.file, transcript)
+	if err != nil || result.Verdict == screening.Reject {
+		return storedClip{}, result, err
+	}
+
+	loudness, err := g.enforceLoudness(ctx, guildID, audio.file)
+	if err != nil {
+		return storedClip{}, result, err
+	}
+
+	defer loudness.cleanup(g.logger)
+
+	if loudness.rejected {
+		return storedClip{}, result, nil
+	}
+
+	// The upload closes the file but leaves it on disk for the waveform to be rendered from
+	trackName, err := g.addVoiceline(ctx, guildID, collection, memberID, addedBy, loudness.file)
+	if err != nil {
+		return storedClip{}, result, err
 	}
 
+	return storedClip{trackName: trackName, transcript: transcript, waveform: g.storeWaveform(ctx, trackName, loudness.file.Name())}, result, nil
+}
+
+// downloadAttachment fetches a discord attachment into a new file in dir through the shared client, the system's temporary
+// directory is used when dir is empty. The caller deletes it.
+func (g *greeterRunner) downloadAttachment(ctx context.Context, dir string, url string) (*os.File, error) {
+	ctx, cancel := context.WithTimeout(ctx, attachmentDownloadTimeout)
+	defer cancel()
+
+	var file *os.File
+
+	err := util.Retry(ctx, attachmentRetryPolicy, func(ctx context.Context) (err error) {
+		file, err = util.DownloadURL(ctx, g.httpClient, dir, url)
+		return err
+	})
+
+	return file, err
+}
+
+func (g *greeterRunner) upload(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	ctx := context.Background()
+
 	options := interaction.ApplicationCommandData().Options
 	memberID, audioType := options[0].Value.(string), options[1].Value.(string)
 
-	member, err := session.State.Member(interaction.GuildID, memberID)
+	member, err := util.ResolveMember(ctx, session, interaction.GuildID, memberID)
 	if err != nil {
 		g.logger.Error("error getting member to create audio track for", zap.Error(err), zap.String("user_id", memberID))
 		return err
 	}
 
-	audioListKey := "outro_array"
 	collection := OutroCollection
-
 	if audioType == "intro" {
 		collection = WelcomeCollection
-		audioListKey = "intro_array"
 	}
 
-	fileAttachment := interaction.ApplicationCommandData().Resolved.Attachments
-	ctx := context.Background()
+	fileAttachment, problem, err := g.uploadAttachments(session, interaction)
+	if err != nil {
+		return err
+	}
+
+	sharedWith, targetProblem, err := uploadTargets(session, interaction, memberID)
+	if err != nil {
+		return err
+	}
+
+	if problem == "" {
+		problem = targetProblem
+	}
+
+	if problem != "" {
+		_, err := util.SendFollowup(ctx, session, interaction.Interaction, &discordgo.WebhookParams{
+			Embeds: []*discordgo.MessageEmbed{embeds.ErrorMessageEmbed(problem)},
+		})
+
+		return err
+	}
+
+	request := UploadRequest{
+		GuildID:      interaction.GuildID,
+		Collection:   collection,
+		MemberID:     memberID,
+		AddedBy:      interaction.Member.User.ID,
+		SharedWith:   sharedWith,
+		ExpiresAt:    uploadExpiry(interaction, g.clock.Now()),
+		PreviewVideo: uploadPreviewVideo(interaction),
+	}
+
+	// Everything the upload downloads or extracts goes in its workspace, which is removed however the upload ends
+	workspace, err := util.NewWorkspace("upload-")
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := workspace.Close(); err != nil {
+			g.logger.Warn("error trying to delete upload workspace", zap.Error(err), zap.String("directory", workspace.Dir()))
+		}
+	}()
 
 	for _, file := range fileAttachment {
 		switch FileType(file.ContentType) {
 		case mp3, mp4:
-			resp, err := http.Get(file.URL)
+			file, err := g.downloadAttachment(ctx, workspace.Dir(), file.URL)
 			if err != nil {
 				g.logger.Error("error attempting to download discord file", zap.Error(err))
 				return err
 			}
 
-			file, err := util.DownloadFileToTempDirectory(resp.Body)
-			defer func() {
-				if err := resp.Body.Close(); err != nil {
-					g.logger.Warn("error closing body", zap.Error(err))
-				}
-
-				if err := util.DeleteFile(file.Name()); err != nil {
-					g.logger.Warn("error trying to delete file", zap.Error(err), zap.String("file_name", file.Name()))
-				}
-			}()
+			defer file.Close()
 
+			result, err := g.UploadVoiceline(ctx, workspace.Dir(), request, file)
 			if err != nil {
-				g.logger.Error("error attempting to download temporary file", zap.Error(err))
+				g.logger.Error("error attempting to upload voiceline", zap.Error(err), zap.String("collection", collection), zap.String("user_id", memberID))
 				return err
 			}
 
-			uuid, _ := uuid.NewV7()
-			if err := g.firebaseAdapter.UploadFileToStorage(ctx, BucketName, fmt.Sprintf("voicelines/%s", uuid.String()), file, uuid.String()); err != nil {
-				g.logger.Error("error attempting to upload to firebase", zap.Error(err))
-				return err
-			}
+			g.flagUploads(ctx, session, request, result)
 
-			data := map[string]interface{}{
-				audioListKey: firestore.ArrayUnion(map[string]string{
-					"track_name": uuid.String(),
-					"created_at": time.Now().String(),
-					"added_by":   interaction.Member.User.ID,
-				}),
-				"name": memberID,
+			for _, rejection := range result.Rejected {
+				_, err := util.SendFollowup(ctx, session, interaction.Interaction, &discordgo.WebhookParams{
+					Embeds: []*discordgo.MessageEmbed{embeds.ErrorMessageEmbed(rejection.Reason)},
+				})
+				if err != nil {
+					return err
+				}
 			}
 
-			if _, err := g.firebaseAdapter.GetDocumentFromCollection(ctx, collection, memberID); err != nil {
-				if status.Code(err) == codes.NotFound {
-					var err error
-					if collection == WelcomeCollection {
-						err = g.firebaseAdapter.CreateDocument(ctx, collection, memberID, firebaseIntroRecord{Name: memberID, IntroArray: []trackRecord{}})
-					} else {
-						err = g.firebaseAdapter.CreateDocument(ctx, collection, memberID, firebaseOutroRecord{Name: memberID, OutroArray: []trackRecord{}})
-					}
+			used, quota := g.confirmedStorageUsage(ctx, interaction.GuildID)
 
-					if err != nil {
-						return fmt.Errorf("error creating firestore document: %w", err)
-					}
-				} else {
-					return err
+			for _, voiceline := range result.Created {
+				embed := embeds.WithExpiry(embeds.WithSharedMembers(embeds.SuccessfulAudioFileUploadEmbed(member, interaction.Member, audioType, voiceline.URL), sharedWith), request.ExpiresAt)
+				params := &discordgo.WebhookParams{
+					Embeds: []*discordgo.MessageEmbed{embeds.WithStorageUsage(embed, used, quota)},
 				}
-			}
 
-			if err := g.firebaseAdapter.UpdateDocument(ctx, collection, memberID, data); err != nil {
-				g.logger.Error("error updating document", zap.Error(err), zap.String("collection", collection), zap.String("user_id", memberID), zap.Any("data", data))
-				return err
-			}
+				if preview := g.openPreviewVideo(result.PreviewVideos, voiceline.TrackName); preview != nil {
+					defer preview.Close()
 
-			signedURL, err := g.firebaseAdapter.GenerateSignedURL(BucketName, fmt.Sprintf("voicelines/%s", uuid.String()))
-			if err != nil {
-				g.logger.Error("error generating signed url", zap.Error(err), zap.String("member_created_for", member.User.ID), zap.String("member_created_by", interaction.Member.User.ID))
-				return err
-			}
-			_, err = session.FollowupMessageCreate(interaction.Interaction, true, &discordgo.WebhookParams{
-				Embeds: []*discordgo.MessageEmbed{
-					embeds.SuccessfulAudioFileUploadEmbed(member, interaction.Member, audioType, signedURL),
-				},
-			})
-			if err != nil {
-				g.logger.Error("error unable to send follow up embed: %v", zap.Error(err))
-				return err
+					params.Files = []*discordgo.File{{Name: "preview.mp4", ContentType: "video/mp4", Reader: preview}}
+				}
+
+				_, err = util.SendFollowup(ctx, session, interaction.Interaction, params)
+				if err != nil {
+					g.logger.Error("error unable to send follow up embed: %v", zap.Error(err))
+					return err
+				}
 			}
 		case zip:
-			resp, err := http.Get(file.URL)
+			file, err := g.downloadAttachment(ctx, workspace.Dir(), file.URL)
 			if err != nil {
 				g.logger.Error("error attempting to download discord file", zap.Error(err))
 				return err
 			}
 
-			defer func() {
-				if err := resp.Body.Close(); err != nil {
-					g.logger.Warn("error closing body from request", zap.Error(err))
+			defer file.Close()
+
+			result, err := g.UploadVoicelineZip(ctx, workspace.Dir(), request, file.Name())
+			if errors.Is(err, util.ErrTooManyEntries) {
+				_, err := util.SendFollowup(ctx, session, interaction.Interaction, &discordgo.WebhookParams{
+					Embeds: []*discordgo.MessageEmbed{embeds.ErrorMessageEmbed(fmt.Sprintf("Zips can hold at most %d files", zipUploadLimits.MaxEntries))},
+				})
+				if err != nil {
+					return err
 				}
-			}()
 
-			file, err := util.DownloadFileToTempDirectory(resp.Body)
-			if err != nil {
-				g.logger.Error("error attempting to download temporary file", zap.Error(err))
-				return err
+				continue
 			}
 
-			fileList, err := util.Unzip(file.Name(), util.GetDirectoryFromFileName(file.Name()))
 			if err != nil {
-				g.logger.Error("error unzipping inputted zip", zap.Error(err))
+				g.logger.Error("error uploading inputted zip", zap.Error(err))
 				return err
 			}
 
-			if _, err := g.firebaseAdapter.GetDocumentFromCollection(ctx, collection, memberID); err != nil {
-				if status.Code(err) == codes.NotFound {
-					var err error
-					if collection == WelcomeCollection {
-						err = g.firebaseAdapter.CreateDocument(ctx, collection, memberID, firebaseIntroRecord{Name: memberID, IntroArray: []trackRecord{}})
-					} else {
-						err = g.firebaseAdapter.CreateDocument(ctx, collection, memberID, firebaseOutroRecord{Name: memberID, OutroArray: []trackRecord{}})
-					}
-
-					if err != nil {
-						g.logger.Error("error creating firestore document", zap.Error(err), zap.String("user_id", memberID), zap.String("collection", collection))
-						return err
-					}
-				} else {
+			if len(result.Skipped) > 0 {
+				_, err := util.SendFollowup(ctx, session, interaction.Interaction, &discordgo.WebhookParams{
+					Embeds: []*discordgo.MessageEmbed{embeds.ErrorMessageEmbed(skippedEntriesText(result.Skipped))},
+				})
+				if err != nil {
 					return err
 				}
 			}
 
-			urlsCreated := []string{}
-
-			eg, ctx := errgroup.WithContext(ctx)
-			for _, file := range fileList {
-				eg.Go(func() error {
-					f, err := os.Open(file.Name())
-					if err != nil {
-						return fmt.Errorf("error opening file: %w", err)
-					}
-
-					defer func() {
-						if err := f.Close(); err != nil {
-							g.logger.Warn("error closing file", zap.Error(err))
-						}
+			g.flagUploads(ctx, session, request, result)
 
-						if err := util.DeleteFile(f.Name()); err != nil {
-							g.logger.Warn("error trying to delete file", zap.Error(err), zap.String("file_name", f.Name()))
-						}
-					}()
-
-					uuid, _ := uuid.NewV7()
-					if err := g.firebaseAdapter.UploadFileToStorage(ctx, BucketName, fmt.Sprintf("voicelines/%s", uuid), file, uuid.String()); err != nil {
-						return fmt.Errorf("error uploading to file storage %w", err)
-					}
+			failed, rejected := len(result.Failed), len(result.Rejected)
+			if failed > 0 {
+				g.logger.Error("error creating or uploading files", zap.Error(result.Err()), zap.Int("failed", failed), zap.String("member_created_for", member.User.ID), zap.String("member_created_by", interaction.Member.User.ID))
+			}
 
-					data := map[string]interface{}{
-						audioListKey: firestore.ArrayUnion(trackRecord{
-							TrackName: uuid.String(),
-							CreatedAt: time.Now(),
-							AddedBy:   interaction.Member.User.ID,
-						}),
-					}
+			if len(result.Created) == 0 && rejected == 0 {
+				if failed > 0 {
+					return result.Err()
+				}
 
-					if err := g.firebaseAdapter.UpdateDocument(ctx, collection, memberID, data); err != nil {
-						return fmt.Errorf("error updating document %w", err)
-					}
+				continue
+			}
 
-					signedURL, err := g.firebaseAdapter.GenerateSignedURL(BucketName, fmt.Sprintf("voicelines/%s", uuid.String()))
-					if err != nil {
-						g.logger.Error("error generating signed url", zap.Error(err), zap.String("member_created_for", member.User.ID), zap.String("member_created_by", interaction.Member.User.ID))
-						return fmt.Errorf("error generating signed url %w", err)
-					}
+			if rejected > 0 || failed > 0 {
+				problems := []string{}
+				if rejected > 0 {
+					problems = append(problems, fmt.Sprintf("%d clip(s) were rejected by this server's content screening, loudness limit or storage quota", rejected))
+				}
 
-					g.mu.Lock()
-					urlsCreated = append(urlsCreated, signedURL)
-					g.mu.Unlock()
+				if failed > 0 {
+					problems = append(problems, fmt.Sprintf("%d clip(s) couldn't be uploaded, try uploading them again", failed))
+				}
 
-					return nil
+				_, err := util.SendFollowup(ctx, session, interaction.Interaction, &discordgo.WebhookParams{
+					Embeds: []*discordgo.MessageEmbed{embeds.ErrorMessageEmbed(strings.Join(problems, "\n"))},
 				})
+				if err != nil {
+					return err
+				}
+
+				if len(result.Created) == 0 {
+					continue
+				}
 			}
 
-			if err = eg.Wait(); err != nil || len(urlsCreated) == 0 {
-				g.logger.Error("error creating or uploading files", zap.Error(err), zap.String("member_created_for", member.User.ID), zap.String("member_created_by", interaction.Member.User.ID))
-				return err
+			urlsCreated := make([]string, 0, len(result.Created))
+			for _, voiceline := range result.Created {
+				urlsCreated = append(urlsCreated, voiceline.URL)
 			}
 
+			used, quota := g.confirmedStorageUsage(ctx, interaction.GuildID)
+
 			successfulUploadEmbeds := embeds.SuccessfulAudioZipUploadEmbeds(member, interaction.Member, audioType, urlsCreated)
+			for _, embed := range successfulUploadEmbeds {
+				embeds.WithStorageUsage(embeds.WithExpiry(embeds.WithSharedMembers(embed, sharedWith), request.ExpiresAt), used, quota)
+			}
 
 			if len(successfulUploadEmbeds) == 1 {
-				_, err = session.FollowupMessageCreate(interaction.Interaction, true, &discordgo.WebhookParams{
+				_, err = util.SendFollowup(ctx, session, interaction.Interaction, &discordgo.WebhookParams{
 					Embeds: []*discordgo.MessageEmbed{
 						successfulUploadEmbeds[0],
 					},
@@ -690,402 +2616,348 @@ func (g *greeterRunner) upload(session *discordgo.Session, interaction *discordg
 					return err
 				}
 
-				if err := util.DeleteMessageAfterTime(session, interaction.ChannelID, message.ID, time.Minute*2); err != nil {
-					g.logger.Warn("failed to delete message with delay", zap.Error(err), zap.String("message_id", message.ID))
-				}
+				g.messageDeleter.DeleteAfter(session, interaction.ChannelID, message.ID, time.Minute*2)
 			} else {
-				message, err := session.FollowupMessageCreate(interaction.Interaction, true, &discordgo.WebhookParams{
-					Components: embeds.GetPaginationComponent(true, true, false, false),
+				message, err := util.SendFollowup(ctx, session, interaction.Interaction, &discordgo.WebhookParams{
+					Components: embeds.GetPaginationComponent(util.CustomID{GuildID: interaction.GuildID, MemberID: memberID, Collection: collection}, 0, len(successfulUploadEmbeds)),
 					Embeds:     []*discordgo.MessageEmbed{successfulUploadEmbeds[0]},
 				})
 				if err != nil {
 					return fmt.Errorf("error sending pagination for upload command %w", err)
 				}
 
-				if err := util.DeleteMessageAfterTime(session, interaction.ChannelID, message.ID, time.Minute*2); err != nil {
-					g.logger.Warn("failed to delete message with delay", zap.Error(err), zap.String("message_id", message.ID))
-				}
+				g.messageDeleter.DeleteAfter(session, interaction.ChannelID, message.ID, time.Minute*2)
 
-				g.messageStore[message.ID] = &paginationState{
+				g.messageStore.put(message.ID, &paginationState{
 					Pages:       successfulUploadEmbeds,
 					CurrentPage: 0,
-				}
+				})
 			}
 
 		default:
-			message, err := session.FollowupMessageCreate(interaction.Interaction, true, &discordgo.WebhookParams{
+			message, err := util.SendFollowup(ctx, session, interaction.Interaction, &discordgo.WebhookParams{
 				Embeds: []*discordgo.MessageEmbed{
 					embeds.ErrorMessageEmbed("File must be an mp3 or m4a file!"),
 				},
 			})
-
-			if err := util.DeleteMessageAfterTime(session, interaction.ChannelID, message.ID, time.Second*10); err != nil {
-				g.logger.Warn("failed to delete message with delay", zap.Error(err), zap.String("message_id", message.ID))
-			}
-
 			if err != nil {
-				g.logger.Error("unable to send follow up embed", zap.Error(err))
-				return err
-			}
-		}
-	}
-
-	return nil
-}
-
-func (g *greeterRunner) extractAudioTracksForUser(ctx context.Context, data map[string]interface{}, audioKey string) ([]trackData, error) {
-	tracks := []trackData{}
-
-	if data, ok := data[audioKey].([]interface{}); ok {
-		eg, _ := errgroup.WithContext(ctx)
-		for _, trackRecord := range data {
-			if track, ok := trackRecord.(map[string]interface{}); ok {
-				eg.Go(func() error {
-					trackTitle := track["track_name"].(string)
-
-					g.mu.Lock()
-
-					urlData, err := g.firebaseAdapter.GenerateSignedURL(BucketName, fmt.Sprintf("voicelines/"+trackTitle))
-					if err != nil {
-						return err
-					}
-					tracks = append(tracks, trackData{
-						TrackName:      trackTitle,
-						TrackSignedURL: urlData,
-					})
-
-					g.mu.Unlock()
-					return nil
-				})
+				g.logger.Error("unable to send follow up embed", zap.Error(err))
+				return err
 			}
-		}
 
-		if err := eg.Wait(); err != nil {
-			return nil, fmt.Errorf("error retrieving generated signed urls %w", err)
+			g.messageDeleter.DeleteAfter(session, interaction.ChannelID, message.ID, time.Second*10)
 		}
-		return tracks, nil
 	}
 
-	return nil, errors.New("error could not cast record")
+	return nil
 }
 
 func (g *greeterRunner) voicelines(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
 	options := interaction.ApplicationCommandData().Options
 	memberID, audioType := options[0].Value.(string), options[1].Value.(string)
 
-	member, err := session.State.Member(interaction.GuildID, memberID)
+	member, err := util.ResolveMember(context.Background(), session, interaction.GuildID, memberID)
 	if err != nil {
 		g.logger.Error("error getting member to create audio track for", zap.Error(err), zap.String("user_id", memberID))
 		return err
 	}
 
-	collectionName := OutroCollection
-	audioListKey := OutroArrayKey
-
-	if audioType == "intro" {
-		audioListKey = IntroArrayKey
-		collectionName = WelcomeCollection
-	}
-
-	ctx := context.Background()
-
-	data, err := g.firebaseAdapter.GetDocumentFromCollection(ctx, collectionName, memberID)
-	if err != nil {
-		if status.Code(err) == codes.NotFound {
-			err := session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
-				Type: discordgo.InteractionResponseChannelMessageWithSource,
-				Data: &discordgo.InteractionResponseData{
-					Embeds: []*discordgo.MessageEmbed{embeds.NoDataForMemberEmbed(audioType, member.User.Username)},
-				},
-			})
-			if err != nil {
-				return err
-			}
-
-			message, err := session.InteractionResponse(interaction.Interaction)
-			if err != nil {
-				return err
-			}
-
-			if err := util.DeleteMessageAfterTime(session, interaction.ChannelID, message.ID, time.Second*10); err != nil {
-				g.logger.Warn("failed to delete message with delay", zap.Error(err), zap.String("message_id", message.ID))
-			}
+	collectionName, _ := voicelines.CollectionFor(audioType)
 
+	listing, err := g.ListVoicelines(context.Background(), collectionName, memberID)
+	if errors.Is(err, voicelines.ErrNoVoicelines) {
+		message, err := middleware.Respond(session, interaction, &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{embeds.NoDataForMemberEmbed(audioType, member.User.Username)},
+		})
+		if err != nil {
 			return err
 		}
 
-		g.logger.Error("error getting document from firestore", zap.Error(err), zap.String("member_id", memberID), zap.String("collection", collectionName))
-		return err
-	}
+		g.messageDeleter.DeleteAfter(session, interaction.ChannelID, message.ID, time.Second*10)
 
-	if _, ok := data[audioListKey]; !ok {
-		return errors.New("audio key not found in document")
+		return nil
 	}
 
-	trackData, err := g.extractAudioTracksForUser(ctx, data, audioListKey)
 	if err != nil {
-		return fmt.Errorf("unable to extract audio track for user: %v", err)
+		g.logger.Error("error listing voicelines", zap.Error(err), zap.String("member_id", memberID), zap.String("collection", collectionName))
+		return err
 	}
 
-	urls := make([]string, 0, len(trackData))
-	for _, data := range trackData {
-		urls = append(urls, data.TrackSignedURL)
+	trackNames := listing.TrackNames()
+
+	successEmbeds := embeds.GetSuccessfulAudioRetrievalEmbeds(member, audioType, listing.Listed())
+
+	menuOptions := make(map[string]string)
+	menuBound := min(len(trackNames), selectMenuPageSize)
+	for i, trackName := range trackNames[:menuBound] {
+		menuOptions["🚩 Report "+voicelineLabel(member.User.Username, i, trackName)] = trackName
 	}
 
-	successEmbeds := embeds.GetSuccessfulAudioRetrievalEmbeds(member, audioType, urls)
+	listingID := util.CustomID{GuildID: interaction.GuildID, MemberID: memberID, Collection: collectionName}
+
+	reportMenuID := listingID
+	reportMenuID.Action = reportPrefix
+
+	previewRow := previewButtons(memberID, collectionName, trackNames[:menuBound], 0)
+
 	if len(successEmbeds) == 1 {
-		err := session.InteractionRespond(interaction.Interaction,
-			&discordgo.InteractionResponse{
-				Type: discordgo.InteractionResponseChannelMessageWithSource,
-				Data: &discordgo.InteractionResponseData{
-					Embeds: []*discordgo.MessageEmbed{successEmbeds[0]},
-				},
-			})
+		components, err := embeds.AddSelectMenu([]discordgo.MessageComponent{}, reportMenuID.Encode(), menuOptions)
 		if err != nil {
-			return err
+			return fmt.Errorf("error adding report select menu: %w", err)
 		}
 
-		message, err := session.InteractionResponse(interaction.Interaction)
+		components = append(components, previewRow)
+
+		message, err := middleware.Respond(session, interaction, &discordgo.InteractionResponseData{
+			Embeds:     []*discordgo.MessageEmbed{successEmbeds[0]},
+			Components: components,
+		})
 		if err != nil {
 			return err
 		}
 
-		if err := util.DeleteMessageAfterTime(session, interaction.ChannelID, message.ID, time.Minute*2); err != nil {
-			g.logger.Warn("failed to delete message with delay", zap.Error(err), zap.String("message_id", message.ID))
-		}
+		g.messageDeleter.DeleteAfter(session, interaction.ChannelID, message.ID, time.Minute*2)
 	} else {
-		err := session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: &discordgo.InteractionResponseData{
-				Components: embeds.GetPaginationComponent(true, true, false, false),
-				Embeds:     []*discordgo.MessageEmbed{successEmbeds[0]},
-			},
-		})
+		components, err := embeds.AddSelectMenu(embeds.GetPaginationComponent(listingID, 0, len(successEmbeds)), reportMenuID.Encode(), menuOptions)
 		if err != nil {
-			return err
+			return fmt.Errorf("error adding report select menu: %w", err)
 		}
 
-		message, err := session.InteractionResponse(interaction.Interaction)
+		components = append(components, previewRow)
+
+		message, err := middleware.Respond(session, interaction, &discordgo.InteractionResponseData{
+			Components: components,
+			Embeds:     []*discordgo.MessageEmbed{successEmbeds[0]},
+		})
 		if err != nil {
 			return err
 		}
 
-		if err := util.DeleteMessageAfterTime(session, interaction.ChannelID, message.ID, time.Minute*2); err != nil {
-			g.logger.Warn("failed to delete message with delay", zap.Error(err), zap.String("message_id", message.ID))
-		}
+		g.messageDeleter.DeleteAfter(session, interaction.ChannelID, message.ID, time.Minute*2)
 
-		g.messageStore[message.ID] = &paginationState{
-			Pages:       successEmbeds,
-			CurrentPage: 0,
-		}
+		g.messageStore.put(message.ID, &paginationState{
+			Pages:          successEmbeds,
+			CurrentPage:    0,
+			SelectMenuData: trackNames,
+		})
 	}
 
 	return nil
 }
 
-func (g *greeterRunner) messageComponentHandler(session *discordgo.Session, interaction *discordgo.InteractionCreate) {
-	if interaction.Type != discordgo.InteractionMessageComponent {
-		return
+// deleteMenuComponents renders a delete menu on its current page, the select menu offers the page's voicelines and the
+// confirm button deletes everything picked so far on any page.
+func deleteMenuComponents(state *paginationState, memberID string, collection string, username string) []discordgo.MessageComponent {
+	listingID := util.CustomID{MemberID: memberID, Collection: collection}
+
+	components := []discordgo.MessageComponent{}
+	if len(state.Pages) > 1 {
+		components = embeds.GetPaginationComponent(listingID, state.CurrentPage, len(state.Pages))
 	}
 
-	ctx := context.Background()
+	minBound, maxBound := state.pageBounds()
+
+	options := make([]discordgo.SelectMenuOption, 0, maxBound-minBound)
+	for i := minBound; i < maxBound; i++ {
+		options = append(options, discordgo.SelectMenuOption{
+			Label:   voicelineLabel(username, i, state.SelectMenuData[i]),
+			Value:   state.SelectMenuData[i],
+			Default: slices.Contains(state.Selected, state.SelectMenuData[i]),
+		})
+	}
 
-	var forwardButtonPressed bool
+	selectID, confirmID := listingID, listingID
+	selectID.Action, confirmID.Action = deleteSelectMenuPrefix, deleteConfirmPrefix
 
-	var member *discordgo.Member
+	return append(components, embeds.DeleteMenuComponents(selectID.Encode(), options, confirmID.Encode(), len(state.Selected))...)
+}
 
-	var err error
+// deleteSelected records what's picked on the current page, replacing that page's earlier picks, without deleting anything yet.
+func (g *greeterRunner) deleteSelected(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	customID, err := util.DecodeCustomID(interaction.MessageComponentData().CustomID)
+	if err != nil {
+		return err
+	}
 
-	if state, exists := g.messageStore[interaction.Message.ID]; exists {
-		switch interaction.MessageComponentData().CustomID {
-		case "first":
-			state.CurrentPage = 0
-		case "last":
-			state.CurrentPage = len(state.Pages) - 1
-		case "prev":
-			state.CurrentPage--
-			if state.CurrentPage < 0 {
-				state.CurrentPage = len(state.Pages) - 1
-			}
-		case "next":
-			state.CurrentPage++
-			if state.CurrentPage >= len(state.Pages) {
-				state.CurrentPage = 0
-			}
+	memberID, collection := customID.MemberID, customID.Collection
+	member, err := util.ResolveMember(context.Background(), session, interaction.GuildID, memberID)
+	if err != nil {
+		return fmt.Errorf("unable to update select menu component, could not get guild member: %w", err)
+	}
 
-			forwardButtonPressed = true
-		default:
-			componentData := strings.Split(interaction.MessageComponentData().CustomID, "|")
-			memberID, collection := componentData[0], componentData[1]
-			member, err = session.GuildMember(interaction.GuildID, memberID)
-			if err != nil {
-				g.logger.Warn("unable to update select menu component, could not get guild member", zap.Error(err), zap.String("user_id", memberID))
-				return
-			}
+	state, exists := g.messageStore.update(interaction.Message.ID, func(state *paginationState) {
+		minBound, maxBound := state.pageBounds()
+		onPage := state.SelectMenuData[minBound:maxBound]
 
-			valuesSelected := interaction.MessageComponentData().Values
-			audioListKey := IntroArrayKey
-			if collection == OutroCollection {
-				audioListKey = OutroArrayKey
-			}
+		state.Selected = slices.DeleteFunc(state.Selected, func(trackName string) bool {
+			return slices.Contains(onPage, trackName)
+		})
 
-			eg, ctx := errgroup.WithContext(ctx)
-			tracks, err := g.retrieveTracks(ctx, collection, memberID)
-			if err != nil {
-				g.logger.Error("error retrieving users tracks", zap.Error(err), zap.String("user_id", memberID))
-				return
+		for _, trackName := range interaction.MessageComponentData().Values {
+			if slices.Contains(onPage, trackName) {
+				state.Selected = append(state.Selected, trackName)
 			}
+		}
+	})
+	if !exists {
+		return nil
+	}
 
-			for _, trackId := range valuesSelected {
-				eg.Go(func() error {
-					voicelineTrackPath := fmt.Sprintf("voicelines/%s", trackId)
-					archiveTrackPath := fmt.Sprintf("archive/%s/%s", memberID, trackId)
-					if err := g.firebaseAdapter.CloneFileFromStorage(ctx, BucketName, voicelineTrackPath, archiveTrackPath); err != nil {
-						return err
-					}
+	components := deleteMenuComponents(&state, memberID, collection, member.User.Username)
 
-					if err := g.firebaseAdapter.DeleteFileFromStorage(ctx, BucketName, voicelineTrackPath); err != nil {
-						return err
-					}
+	return session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{Components: components},
+	})
+}
 
-					trackRecordToBeRemoved := make(map[string]interface{}, 3)
-
-					for _, track := range tracks {
-						if recordMap, ok := track.(map[string]interface{}); ok {
-							if recordMap["track_name"].(string) == trackId {
-								trackRecordToBeRemoved["track_name"] = recordMap["track_name"].(string)
-								trackRecordToBeRemoved["added_by"] = recordMap["added_by"].(string)
-								if time, ok := recordMap["created_at"].(time.Time); ok {
-									trackRecordToBeRemoved["created_at"] = time
-								}
-								break
-							}
-						}
-					}
-					data := map[string]interface{}{
-						audioListKey: firestore.ArrayRemove(trackRecordToBeRemoved),
-					}
+func (g *greeterRunner) deleteConfirmed(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	// Taken so confirming twice before the first one finishes can't delete the same voicelines twice
+	state, exists := g.messageStore.take(interaction.Message.ID)
+	if !exists {
+		return nil
+	}
 
-					if err := g.firebaseAdapter.UpdateDocument(ctx, collection, memberID, data); err != nil {
-						return err
-					}
-					return nil
-				})
-			}
+	if len(state.Selected) == 0 {
+		g.messageStore.put(interaction.Message.ID, &state)
+		return nil
+	}
 
-			if err := eg.Wait(); err != nil {
-				g.logger.Error("error deleting voicelines for user", zap.Error(err), zap.String("collection", collection), zap.String("user_id", memberID))
-				return
-			}
+	ctx := context.Background()
 
-			message, err := session.ChannelMessageEditComplex(&discordgo.MessageEdit{
-				ID:         interaction.Message.ID,
-				Channel:    interaction.ChannelID,
-				Components: &[]discordgo.MessageComponent{},
-				Embeds:     &[]*discordgo.MessageEmbed{embeds.DeleteCompletedSuccessEmbed(len(valuesSelected), member, interaction.Member)},
-			})
-			if err != nil {
-				g.logger.Warn("error editing complex message", zap.Error(err))
-				return
-			}
+	customID, err := util.DecodeCustomID(interaction.MessageComponentData().CustomID)
+	if err != nil {
+		return err
+	}
 
-			if err := util.DeleteMessageAfterTime(session, interaction.ChannelID, message.ID, time.Second*30); err != nil {
-				g.logger.Warn("unable to delete message")
-			}
+	memberID, collection := customID.MemberID, customID.Collection
+	member, err := util.ResolveMember(context.Background(), session, interaction.GuildID, memberID)
+	if err != nil {
+		return fmt.Errorf("unable to confirm delete, could not get guild member: %w", err)
+	}
 
-			return
-		}
+	result, err := g.voicelineService.Delete(ctx, collection, memberID, state.Selected)
+	if err != nil {
+		g.messageStore.put(interaction.Message.ID, &state)
+		return fmt.Errorf("error deleting voicelines for user: %w", err)
+	}
 
-		message, err := session.ChannelMessage(interaction.ChannelID, interaction.Message.ID)
-		if err != nil {
-			g.logger.Warn("error retrieving channel message in component handler", zap.Error(err))
-			return
-		}
+	if len(result.Deleted) == 0 {
+		g.messageStore.put(interaction.Message.ID, &state)
+		return fmt.Errorf("error deleting voicelines for user: %w", result.Err())
+	}
 
-		buttonStatusMapping := map[int]bool{
-			0: state.CurrentPage == 0,
-			1: state.CurrentPage == 0,
-			2: state.CurrentPage == len(state.Pages)-1,
-			3: state.CurrentPage == len(state.Pages)-1,
-		}
+	if len(result.Failed) > 0 {
+		g.logger.Error("some voicelines couldn't be deleted", zap.Error(result.Err()), zap.Int("failed", len(result.Failed)), zap.String("member_id", memberID), zap.String("collection", collection))
+	}
 
-		if buttonsActionRow, ok := message.Components[0].(*discordgo.ActionsRow); ok {
-			for buttonIndex, buttonDisabled := range buttonStatusMapping {
-				if buttonData, ok := buttonsActionRow.Components[buttonIndex].(*discordgo.Button); ok {
-					buttonData.Disabled = buttonDisabled
-					buttonsActionRow.Components[buttonIndex] = buttonData
-				}
-			}
-			message.Components[0] = buttonsActionRow
-		}
+	if err := session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Components: []discordgo.MessageComponent{},
+			Embeds:     []*discordgo.MessageEmbed{embeds.DeleteCompletedSuccessEmbed(len(result.Deleted), member, interaction.Member)},
+		},
+	}); err != nil {
+		return fmt.Errorf("error responding with delete confirmation: %w", err)
+	}
 
-		if state.SelectMenuData != nil {
-			if selectMenuActionRow, ok := message.Components[1].(*discordgo.ActionsRow); ok {
-				if selectMenu, ok := selectMenuActionRow.Components[0].(*discordgo.SelectMenu); ok {
-					componentData := strings.Split(selectMenu.CustomID, "|")
-					memberID, _ := componentData[0], componentData[1]
-					member, err = session.GuildMember(interaction.GuildID, memberID)
-					if err != nil {
-						g.logger.Warn("unable to update select menu component, could not get guild member", zap.Error(err), zap.String("user_id", memberID))
-						return
-					}
-					options := []discordgo.SelectMenuOption{}
+	g.messageDeleter.DeleteAfter(session, interaction.ChannelID, interaction.Message.ID, time.Second*30)
+
+	return nil
+}
+
+func (g *greeterRunner) paginate(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	state, exists := g.messageStore.get(interaction.Message.ID)
+	if !exists {
+		return nil
+	}
 
-					var minBound, maxBound int
+	customID, err := util.DecodeCustomID(interaction.MessageComponentData().CustomID)
+	if err != nil || len(customID.Args) != 2 {
+		return fmt.Errorf("malformed pagination custom id: %s", interaction.MessageComponentData().CustomID)
+	}
 
-					totalItems := len(state.SelectMenuData)
-					itemsPerPage := 4
+	// Buttons carry the page they lead to, so pressing one twice before the edit lands can't skip past it
+	page, err := strconv.Atoi(customID.Args[1])
+	if err != nil || page < 0 || page >= len(state.Pages) {
+		return fmt.Errorf("pagination custom id %s is out of range", interaction.MessageComponentData().CustomID)
+	}
 
-					if state.CurrentPage == 0 {
+	state, exists = g.messageStore.update(interaction.Message.ID, func(state *paginationState) {
+		state.CurrentPage = page
+	})
+	if !exists {
+		return nil
+	}
 
-						minBound = 0
-						maxBound = min(itemsPerPage, totalItems)
-					} else if state.CurrentPage == len(state.Pages)-1 {
+	ctx := context.Background()
 
-						minBound = max(0, len(state.SelectMenuData)-len(state.Pages[state.CurrentPage].Fields))
-						maxBound = len(state.SelectMenuData)
-					} else if forwardButtonPressed {
+	message, err := util.GetMessage(ctx, session, interaction.ChannelID, interaction.Message.ID)
+	if err != nil {
+		return fmt.Errorf("error retrieving channel message in component handler: %w", err)
+	}
 
-						minBound = state.SelectMenuBound
-						maxBound = min(state.SelectMenuBound+itemsPerPage, totalItems)
-					} else {
-						fieldsInPageAfter := len(state.Pages[state.CurrentPage+1].Fields)
-						maxBound = state.SelectMenuBound - fieldsInPageAfter
-						minBound = maxBound - 4
-					}
+	customID.Args = nil
+	message.Components[0] = embeds.GetPaginationComponent(customID, state.CurrentPage, len(state.Pages))[0]
 
-					if maxBound > totalItems {
-						maxBound = totalItems
-					}
+	if state.SelectMenuData != nil {
+		if selectMenuActionRow, ok := message.Components[1].(*discordgo.ActionsRow); ok {
+			if selectMenu, ok := selectMenuActionRow.Components[0].(*discordgo.SelectMenu); ok {
+				menuID, err := util.DecodeCustomID(selectMenu.CustomID)
+				if err != nil {
+					return fmt.Errorf("malformed select menu custom id: %s", selectMenu.CustomID)
+				}
 
-					for i := minBound; i < maxBound; i++ {
-						options = append(options, discordgo.SelectMenuOption{Label: fmt.Sprintf("%s's Voiceline %d", member.User.Username, i+1), Value: state.SelectMenuData[i]})
+				menuPrefix, memberID := menuID.Action, menuID.MemberID
+				member, err := util.ResolveMember(context.Background(), session, interaction.GuildID, memberID)
+				if err != nil {
+					return fmt.Errorf("unable to update select menu component, could not get guild member: %w", err)
+				}
+				options := []discordgo.SelectMenuOption{}
+				minBound, maxBound := state.pageBounds()
+
+				for i := minBound; i < maxBound; i++ {
+					label := voicelineLabel(member.User.Username, i, state.SelectMenuData[i])
+					if menuPrefix == reportPrefix {
+						label = "🚩 Report " + label
 					}
-					selectMenu.MaxValues = len(options)
-					selectMenu.Options = options
-					state.SelectMenuBound = maxBound
-					selectMenuActionRow.Components[0] = selectMenu
+
+					// Delete menus keep what was picked on other pages, checking it again when its page comes back
+					options = append(options, discordgo.SelectMenuOption{Label: label, Value: state.SelectMenuData[i], Default: slices.Contains(state.Selected, state.SelectMenuData[i])})
+				}
+				selectMenu.MaxValues = len(options)
+				selectMenu.Options = options
+				selectMenuActionRow.Components[0] = selectMenu
+
+				// Listings with previews carry a row of preview buttons under the select menu that follows the page too
+				if menuPrefix == reportPrefix && len(message.Components) > 2 {
+					message.Components[2] = previewButtons(memberID, menuID.Collection, state.SelectMenuData[minBound:maxBound], minBound)
 				}
-				message.Components[1] = selectMenuActionRow
 			}
+			message.Components[1] = selectMenuActionRow
 		}
+	}
 
-		_, err = session.ChannelMessageEditComplex(&discordgo.MessageEdit{
-			ID:         interaction.Message.ID,
-			Channel:    interaction.ChannelID,
-			Embeds:     &[]*discordgo.MessageEmbed{state.Pages[state.CurrentPage]},
-			Components: &message.Components,
-		})
-		if err != nil {
-			g.logger.Warn("error editing complex message", zap.Error(err))
-		}
+	_, err = util.EditMessage(ctx, session, &discordgo.MessageEdit{
+		ID:         interaction.Message.ID,
+		Channel:    interaction.ChannelID,
+		Embeds:     &[]*discordgo.MessageEmbed{state.Pages[state.CurrentPage]},
+		Components: &message.Components,
+	})
+	if err != nil {
+		g.logger.Warn("error editing complex message", zap.Error(err))
+	}
 
-		if err := session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseUpdateMessage,
-		}); err != nil {
-			g.logger.Warn("error responding with update message response", zap.Error(err))
-		}
+	// Someone is still paging through the listing, so it's kept around for a while longer
+	g.messageDeleter.Extend(interaction.Message.ID, time.Minute*2)
+
+	if err := session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+	}); err != nil {
+		g.logger.Warn("error responding with update message response", zap.Error(err))
 	}
+
+	return nil
 }
 
 func (g *greeterRunner) help(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
@@ -1103,29 +2975,56 @@ func (g *greeterRunner) help(session *discordgo.Session, interaction *discordgo.
 	return nil
 }
 
-func (g *greeterRunner) isInBlacklist(ctx context.Context, memberId string) (bool, error) {
-	_, err := g.firebaseAdapter.GetDocumentFromCollection(ctx, BlacklistCollection, memberId)
+// isInBlacklist is checked on every voice event, so it reads through the blacklist cache.
+func (g *greeterRunner) isInBlacklist(ctx context.Context, memberId string, collection string) (bool, error) {
+	data, err := g.blacklistRecord(ctx, memberId)
 	if err != nil {
-		if status.Code(err) == codes.NotFound {
-			return false, nil
-		}
 		return false, err
 	}
-	return true, nil
+	return voicelines.BlacklistedFor(data, collection), nil
+}
+
+func (g *greeterRunner) addToBlacklist(ctx context.Context, memberId string, audioType string) error {
+	defer g.blacklistCache.invalidate(memberId)
+
+	return g.voicelineService.Blacklist(ctx, memberId, audioType)
+}
+
+func (g *greeterRunner) removeFromBlacklist(ctx context.Context, memberId string, audioType string) error {
+	defer g.blacklistCache.invalidate(memberId)
+
+	return g.voicelineService.Whitelist(ctx, memberId, audioType)
+}
+
+// blacklistAudioType reads the optional type option shared by /blacklist and /whitelist.
+func blacklistAudioType(interaction *discordgo.InteractionCreate) string {
+	if options := interaction.ApplicationCommandData().Options; len(options) > 0 {
+		return options[0].StringValue()
+	}
+
+	return "both"
 }
 
 func (g *greeterRunner) blacklist(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
 	ctx := context.Background()
-	isInBlacklist, err := g.isInBlacklist(ctx, interaction.Member.User.ID)
-	if err != nil {
-		return fmt.Errorf("error attempting to check if user is already in blacklist %w", err)
+	audioType := blacklistAudioType(interaction)
+	language := g.languageFor(ctx, interaction)
+
+	isInBlacklist := true
+	for _, collection := range voicelines.BlacklistCollections(audioType) {
+		blacklisted, err := g.isInBlacklist(ctx, interaction.Member.User.ID, collection)
+		if err != nil {
+			return fmt.Errorf("error attempting to check if user is already in blacklist %w", err)
+		}
+
+		isInBlacklist = isInBlacklist && blacklisted
 	}
 
 	if isInBlacklist {
-		err = session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
+		err := session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
 			Data: &discordgo.InteractionResponseData{
-				Embeds: []*discordgo.MessageEmbed{embeds.AlreadyOnBlacklistEmbed(interaction.Member)},
+				Embeds: []*discordgo.MessageEmbed{embeds.AlreadyOnBlacklistEmbed(language, interaction.Member, audioType)},
 				Flags:  discordgo.MessageFlagsEphemeral,
 			},
 		})
@@ -1135,17 +3034,14 @@ func (g *greeterRunner) blacklist(session *discordgo.Session, interaction *disco
 		return nil
 	}
 
-	err = g.firebaseAdapter.CreateDocument(ctx, BlacklistCollection, interaction.Member.User.ID, &blacklistRecord{
-		AddedOn: time.Now(),
-	})
-	if err != nil {
+	if err := g.addToBlacklist(ctx, interaction.Member.User.ID, audioType); err != nil {
 		return fmt.Errorf("error attempting to create firebase document containing blacklist information: %w", err)
 	}
 
-	err = session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
+	err := session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
-			Embeds: []*discordgo.MessageEmbed{embeds.AddedToBlacklistEmbed(interaction.Member)},
+			Embeds: []*discordgo.MessageEmbed{embeds.AddedToBlacklistEmbed(language, interaction.Member, audioType)},
 			Flags:  discordgo.MessageFlagsEphemeral,
 		},
 	})
@@ -1158,16 +3054,24 @@ func (g *greeterRunner) blacklist(session *discordgo.Session, interaction *disco
 
 func (g *greeterRunner) whitelist(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
 	ctx := context.Background()
-	isInBlacklist, err := g.isInBlacklist(ctx, interaction.Member.User.ID)
-	if err != nil {
-		return fmt.Errorf("error attempting to check if user is in blacklist: %w", err)
+	audioType := blacklistAudioType(interaction)
+	language := g.languageFor(ctx, interaction)
+
+	isInBlacklist := false
+	for _, collection := range voicelines.BlacklistCollections(audioType) {
+		blacklisted, err := g.isInBlacklist(ctx, interaction.Member.User.ID, collection)
+		if err != nil {
+			return fmt.Errorf("error attempting to check if user is in blacklist: %w", err)
+		}
+
+		isInBlacklist = isInBlacklist || blacklisted
 	}
 
 	if !isInBlacklist {
-		err = session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
+		err := session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
 			Data: &discordgo.InteractionResponseData{
-				Embeds: []*discordgo.MessageEmbed{embeds.NotOnBlacklistEmbed(interaction.Member)},
+				Embeds: []*discordgo.MessageEmbed{embeds.NotOnBlacklistEmbed(language, interaction.Member, audioType)},
 				Flags:  discordgo.MessageFlagsEphemeral,
 			},
 		})
@@ -1178,15 +3082,14 @@ func (g *greeterRunner) whitelist(session *discordgo.Session, interaction *disco
 		return nil
 	}
 
-	err = g.firebaseAdapter.DeleteDocument(ctx, BlacklistCollection, interaction.Member.User.ID)
-	if err != nil {
+	if err := g.removeFromBlacklist(ctx, interaction.Member.User.ID, audioType); err != nil {
 		return fmt.Errorf("error deleting document: %w", err)
 	}
 
-	err = session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
+	err := session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
-			Embeds: []*discordgo.MessageEmbed{embeds.RemovedFromBlacklistEmbed(interaction.Member)},
+			Embeds: []*discordgo.MessageEmbed{embeds.RemovedFromBlacklistEmbed(language, interaction.Member, audioType)},
 			Flags:  discordgo.MessageFlagsEphemeral,
 		},
 	})
@@ -1198,153 +3101,54 @@ func (g *greeterRunner) whitelist(session *discordgo.Session, interaction *disco
 }
 
 func (g *greeterRunner) delete(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
-	if err := session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
-		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
-	}); err != nil {
-		g.logger.Error("error attempting to defer message in upload command", zap.Error(err))
-		return err
-	}
+	ctx := context.Background()
 
 	options := interaction.ApplicationCommandData().Options
 	memberID, audioType := options[0].Value.(string), options[1].Value.(string)
 
-	member, err := session.State.Member(interaction.GuildID, memberID)
+	member, err := util.ResolveMember(ctx, session, interaction.GuildID, memberID)
 	if err != nil {
 		g.logger.Error("error getting member data", zap.Error(err), zap.String("user_id", memberID))
 		return err
 	}
 
-	ctx := context.Background()
-	collection := WelcomeCollection
-	audioKey := IntroArrayKey
-
-	if audioType == "outro" {
-		collection = OutroCollection
-		audioKey = OutroArrayKey
-	}
-
-	data, err := g.firebaseAdapter.GetDocumentFromCollection(ctx, collection, memberID)
-	if err != nil {
-		if status.Code(err) == codes.NotFound {
-			message, err := session.FollowupMessageCreate(interaction.Interaction, true, &discordgo.WebhookParams{
-				Embeds: []*discordgo.MessageEmbed{embeds.NoDataForMemberEmbed(audioType, member.User.Username)},
-			})
-			if err != nil {
-				return fmt.Errorf("error sending follow up message that no data exists for user: %w", err)
-			}
-
-			if err := util.DeleteMessageAfterTime(session, interaction.ChannelID, message.ID, time.Minute*1); err != nil {
-				g.logger.Warn("failed to delete message with delay", zap.Error(err))
-			}
+	collection, _ := voicelines.CollectionFor(audioType)
 
-			return nil
+	listing, err := g.ListVoicelines(ctx, collection, memberID)
+	if errors.Is(err, voicelines.ErrNoVoicelines) {
+		message, err := util.SendFollowup(ctx, session, interaction.Interaction, &discordgo.WebhookParams{
+			Embeds: []*discordgo.MessageEmbed{embeds.NoDataForMemberEmbed(audioType, member.User.Username)},
+		})
+		if err != nil {
+			return fmt.Errorf("error sending follow up message that no data exists for user: %w", err)
 		}
 
-		return fmt.Errorf("error unable to get document from collection: %w", err)
-	}
+		g.messageDeleter.DeleteAfter(session, interaction.ChannelID, message.ID, time.Minute*1)
 
-	trackData, err := g.extractAudioTracksForUser(ctx, data, audioKey)
-	if err != nil {
-		return fmt.Errorf("error extracting audio track for user: %w", err)
+		return nil
 	}
 
-	trackNames := make([]string, 0, len(trackData))
-	urls := make([]string, 0, len(trackData))
-	for _, data := range trackData {
-		trackNames = append(trackNames, data.TrackName)
-		urls = append(urls, data.TrackSignedURL)
+	if err != nil {
+		return fmt.Errorf("error listing voicelines for user: %w", err)
 	}
 
-	successEmbeds := embeds.GetSuccessfulAudioRetrievalEmbeds(member, audioType, urls)
-	paginationComponent := embeds.GetPaginationComponent(false, true, false, false)
+	trackNames := listing.TrackNames()
 
-	menuOptions := make(map[string]string)
-	menuBound := min(len(trackNames), 4)
-	for i, trackName := range trackNames[:menuBound] {
-		menuOptions[fmt.Sprintf("%s's voiceline %d", member.User.Username, i+1)] = trackName
+	state := &paginationState{
+		Pages:          embeds.GetSuccessfulAudioRetrievalEmbeds(member, audioType, listing.Listed()),
+		SelectMenuData: trackNames,
 	}
 
-	paginationComponent, err = embeds.AddSelectMenu(paginationComponent, memberID, collection, menuOptions)
+	message, err := util.SendFollowup(ctx, session, interaction.Interaction, &discordgo.WebhookParams{
+		Embeds:     []*discordgo.MessageEmbed{state.Pages[0]},
+		Components: deleteMenuComponents(state, memberID, collection, member.User.Username),
+	})
 	if err != nil {
-		return fmt.Errorf("error adding select menu: %w", err)
-	}
-
-	var message *discordgo.Message
-	if len(successEmbeds) == 1 {
-		components, err := embeds.AddSelectMenu([]discordgo.MessageComponent{}, memberID, collection, menuOptions)
-		if err != nil {
-			return fmt.Errorf("error adding select menu to single page delete menu: %w", err)
-		}
-
-		message, err = session.FollowupMessageCreate(interaction.Interaction, true, &discordgo.WebhookParams{
-			Embeds:     []*discordgo.MessageEmbed{successEmbeds[0]},
-			Components: components,
-		})
-		if err != nil {
-			return fmt.Errorf("error sending follow up delete message: %w", err)
-		}
-	} else {
-		message, err = session.FollowupMessageCreate(interaction.Interaction, true, &discordgo.WebhookParams{
-			Components: paginationComponent,
-			Embeds:     []*discordgo.MessageEmbed{successEmbeds[0]},
-		})
-		if err != nil {
-			return fmt.Errorf("error sending paginated delete menu: %w", err)
-		}
+		return fmt.Errorf("error sending delete menu: %w", err)
 	}
 
-	g.messageStore[message.ID] = &paginationState{
-		Pages:           successEmbeds,
-		CurrentPage:     0,
-		SelectMenuData:  trackNames,
-		SelectMenuBound: menuBound,
-	}
-	if err := util.DeleteMessageAfterTime(session, interaction.ChannelID, message.ID, time.Minute*2); err != nil {
-		g.logger.Warn("failed to delete message with delay", zap.Error(err), zap.String("message_id", message.ID))
-	}
+	g.messageStore.put(message.ID, state)
+	g.messageDeleter.DeleteAfter(session, interaction.ChannelID, message.ID, time.Minute*2)
 
 	return nil
 }
-
-func (g *greeterRunner) greeterHandler(session *discordgo.Session, interaction *discordgo.InteractionCreate) {
-	if interaction.Type != discordgo.InteractionApplicationCommand {
-		return
-	}
-
-	var err error
-
-	switch interaction.ApplicationCommandData().Name {
-	case "upload":
-		err = g.upload(session, interaction)
-	case "voicelines":
-		err = g.voicelines(session, interaction)
-	case "help":
-		err = g.help(session, interaction)
-	case "blacklist":
-		err = g.blacklist(session, interaction)
-	case "whitelist":
-		err = g.whitelist(session, interaction)
-	case "delete":
-		err = g.delete(session, interaction)
-	}
-
-	if err != nil {
-		g.logger.Error("An error occurred during when executing command", zap.Error(err), zap.String("command", interaction.ApplicationCommandData().Name))
-		_ = session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: &discordgo.InteractionResponseData{
-				Embeds: []*discordgo.MessageEmbed{
-					embeds.UnexpectedErrorEmbed(),
-				},
-			},
-		})
-
-		message, err := session.InteractionResponse(interaction.Interaction)
-		if err != nil {
-			g.logger.Error("An error attempting to retrieve interaction response", zap.Error(err))
-		} else if err := util.DeleteMessageAfterTime(session, interaction.ChannelID, message.ID, time.Second*30); err != nil {
-			g.logger.Warn("failed to delete message with delay", zap.Error(err), zap.String("message_id", message.ID))
-		}
-
-	}
-}
@@ -0,0 +1,2095 @@
+package greeter
+
+import (
+	ziparchive "archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"salutations/internal/embeds"
+	firebaseAdapter "salutations/internal/firebase"
+	"salutations/internal/firebase/firebasetest"
+	"salutations/internal/i18n"
+	"salutations/internal/reporting"
+	"salutations/internal/screening"
+	"salutations/internal/settings"
+	"salutations/internal/voicelines"
+	util "salutations/pkg/util"
+
+	"github.com/bwmarrin/discordgo"
+	youtube "github.com/kkdai/youtube/v2"
+	"go.uber.org/zap"
+)
+
+const testMemberID = "member"
+
+var testNow = time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestGreeter(t *testing.T, opts ...Option) (*greeterRunner, *firebasetest.Firebase) {
+	t.Helper()
+
+	fake := firebasetest.New()
+	opts = append([]Option{WithClock(util.NewFakeClock(testNow)), WithRand(util.NewRand(1))}, opts...)
+
+	g, err := NewGreeterRunner(zap.NewNop(), &youtube.Client{}, fake, reporting.NewNoopReporter(), opts...)
+	if err != nil {
+		t.Fatalf("NewGreeterRunner() error = %v", err)
+	}
+
+	return g, fake
+}
+
+func newTestFile(t *testing.T, contents string) *os.File {
+	t.Helper()
+
+	file, err := os.Create(filepath.Join(t.TempDir(), "voiceline.mp3"))
+	if err != nil {
+		t.Fatalf("os.Create() error = %v", err)
+	}
+
+	t.Cleanup(func() { file.Close() })
+
+	if _, err := file.WriteString(contents); err != nil {
+		t.Fatalf("WriteString() error = %v", err)
+	}
+
+	return file
+}
+
+func uploadTestVoiceline(t *testing.T, g *greeterRunner, collection string, contents string) string {
+	t.Helper()
+
+	ctx := context.Background()
+
+	if err := g.voicelineService.EnsureDocument(ctx, collection, testMemberID); err != nil {
+		t.Fatalf("EnsureDocument() error = %v", err)
+	}
+
+	trackName, err := g.addVoiceline(ctx, "guild", collection, testMemberID, "uploader", newTestFile(t, contents))
+	if err != nil {
+		t.Fatalf("addVoiceline() error = %v", err)
+	}
+
+	return trackName
+}
+
+func trackNames(t *testing.T, g *greeterRunner, collection string) []string {
+	t.Helper()
+
+	tracks, err := g.voicelineService.Tracks(context.Background(), collection, testMemberID)
+	if err != nil {
+		t.Fatalf("Tracks() error = %v", err)
+	}
+
+	names := []string{}
+	for _, track := range tracks {
+		names = append(names, track.(map[string]interface{})["track_name"].(string))
+	}
+
+	return names
+}
+
+func TestUploadStoresBlobAndRecord(t *testing.T) {
+	g, fake := newTestGreeter(t)
+
+	trackName := uploadTestVoiceline(t, g, WelcomeCollection, "hello")
+
+	contents, exists := fake.Blob(BucketName, "voicelines/"+trackName)
+	if !exists || string(contents) != "hello" {
+		t.Fatalf("stored blob = %q, %v; want %q, true", contents, exists, "hello")
+	}
+
+	if got := trackNames(t, g, WelcomeCollection); !slices.Equal(got, []string{trackName}) {
+		t.Fatalf("intro tracks = %v, want [%s]", got, trackName)
+	}
+
+	document, err := fake.GetDocumentFromCollection(context.Background(), WelcomeCollection, testMemberID)
+	if err != nil {
+		t.Fatalf("GetDocumentFromCollection() error = %v", err)
+	}
+
+	record := document[IntroArrayKey].([]interface{})[0].(map[string]interface{})
+	if record["added_by"] != "uploader" {
+		t.Errorf("added_by = %v, want uploader", record["added_by"])
+	}
+
+	if createdAt, _ := record["created_at"].(time.Time); !createdAt.Equal(testNow) {
+		t.Errorf("created_at = %v, want %v", record["created_at"], testNow)
+	}
+
+	if _, err := fake.GetDocumentFromCollection(context.Background(), OutroCollection, testMemberID); err == nil {
+		t.Errorf("outro document was created for an intro upload")
+	}
+}
+
+func TestUploadAppendsToExistingDocument(t *testing.T) {
+	g, _ := newTestGreeter(t)
+
+	first := uploadTestVoiceline(t, g, OutroCollection, "first")
+	second := uploadTestVoiceline(t, g, OutroCollection, "second")
+
+	if got := trackNames(t, g, OutroCollection); !slices.Equal(got, []string{first, second}) {
+		t.Fatalf("outro tracks = %v, want [%s %s]", got, first, second)
+	}
+}
+
+func TestRemoveVoicelinesArchivesSelectedTracks(t *testing.T) {
+	g, fake := newTestGreeter(t)
+	ctx := context.Background()
+
+	kept := uploadTestVoiceline(t, g, WelcomeCollection, "kept")
+	removed := uploadTestVoiceline(t, g, WelcomeCollection, "removed")
+
+	if err := g.removeVoicelines(ctx, WelcomeCollection, testMemberID, []string{removed}); err != nil {
+		t.Fatalf("removeVoicelines() error = %v", err)
+	}
+
+	if got := trackNames(t, g, WelcomeCollection); !slices.Equal(got, []string{kept}) {
+		t.Fatalf("intro tracks = %v, want [%s]", got, kept)
+	}
+
+	if _, exists := fake.Blob(BucketName, "voicelines/"+removed); exists {
+		t.Errorf("removed voiceline is still in storage")
+	}
+
+	if contents, exists := fake.Blob(BucketName, "archive/"+testMemberID+"/"+removed); !exists || string(contents) != "removed" {
+		t.Errorf("archived blob = %q, %v; want %q, true", contents, exists, "removed")
+	}
+}
+
+func TestDocumentCacheSeesGreeterWrites(t *testing.T) {
+	fake := firebasetest.New()
+	cache := firebaseAdapter.NewDocumentCache(fake, util.NewFakeClock(testNow), map[string]time.Duration{WelcomeCollection: time.Hour})
+
+	g, err := NewGreeterRunner(zap.NewNop(), &youtube.Client{}, cache, reporting.NewNoopReporter(), WithClock(util.NewFakeClock(testNow)), WithRand(util.NewRand(1)))
+	if err != nil {
+		t.Fatalf("NewGreeterRunner() error = %v", err)
+	}
+
+	kept := uploadTestVoiceline(t, g, WelcomeCollection, "kept")
+	removed := uploadTestVoiceline(t, g, WelcomeCollection, "removed")
+
+	if got := trackNames(t, g, WelcomeCollection); !slices.Equal(got, []string{kept, removed}) {
+		t.Fatalf("intro tracks = %v, want [%s %s]", got, kept, removed)
+	}
+
+	if err := g.removeVoicelines(context.Background(), WelcomeCollection, testMemberID, []string{removed}); err != nil {
+		t.Fatalf("removeVoicelines() error = %v", err)
+	}
+
+	if got := trackNames(t, g, WelcomeCollection); !slices.Equal(got, []string{kept}) {
+		t.Errorf("intro tracks after removing one = %v, want [%s]", got, kept)
+	}
+}
+
+func TestDocumentCacheWatchSeesOtherWrites(t *testing.T) {
+	fake := firebasetest.New()
+	cache := firebaseAdapter.NewDocumentCache(fake, util.NewFakeClock(testNow), map[string]time.Duration{MemberPreferencesCollection: time.Hour})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	watching := make(chan struct{})
+
+	go func() {
+		defer close(watching)
+		cache.Watch(ctx, zap.NewNop())
+	}()
+
+	defer func() {
+		cancel()
+		<-watching
+	}()
+
+	if _, err := cache.GetDocumentFromCollection(ctx, MemberPreferencesCollection, testMemberID); err == nil {
+		t.Fatal("GetDocumentFromCollection() before any write error = nil, want not found")
+	}
+
+	// Written behind the cache's back as migrate or import would, the TTL never passes so only the watch picks it up
+	if err := fake.CreateDocument(ctx, MemberPreferencesCollection, testMemberID, map[string]interface{}{"respect_do_not_disturb": true}); err != nil {
+		t.Fatalf("CreateDocument() error = %v", err)
+	}
+
+	// The watch starts in the background, so the write is repeated until it's been seen
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := cache.GetDocumentFromCollection(ctx, MemberPreferencesCollection, testMemberID); err == nil {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("cached document was never invalidated by the watch")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+
+		if err := fake.UpdateDocument(ctx, MemberPreferencesCollection, testMemberID, map[string]interface{}{"respect_do_not_disturb": true}); err != nil {
+			t.Fatalf("UpdateDocument() error = %v", err)
+		}
+	}
+}
+
+func TestRemoveVoicelinesMissingTrack(t *testing.T) {
+	g, _ := newTestGreeter(t)
+
+	uploadTestVoiceline(t, g, WelcomeCollection, "kept")
+
+	if err := g.removeVoicelines(context.Background(), WelcomeCollection, testMemberID, []string{"missing"}); err == nil {
+		t.Fatalf("removeVoicelines() of a missing track returned no error")
+	}
+}
+
+func TestArchiveAndReclaimDepartedMember(t *testing.T) {
+	g, fake := newTestGreeter(t)
+	ctx := context.Background()
+
+	intro := uploadTestVoiceline(t, g, WelcomeCollection, "intro")
+	outro := uploadTestVoiceline(t, g, OutroCollection, "outro")
+
+	archived, err := g.archiveMemberVoicelines(ctx, "guild", testMemberID)
+	if err != nil || archived != 2 {
+		t.Fatalf("archiveMemberVoicelines() = %d, %v; want 2, nil", archived, err)
+	}
+
+	if got := trackNames(t, g, WelcomeCollection); len(got) != 0 {
+		t.Fatalf("intro tracks after archiving = %v, want none", got)
+	}
+
+	reclaimed, err := g.reclaimVoicelines(ctx, testMemberID)
+	if err != nil || reclaimed != 2 {
+		t.Fatalf("reclaimVoicelines() = %d, %v; want 2, nil", reclaimed, err)
+	}
+
+	if got := trackNames(t, g, WelcomeCollection); !slices.Equal(got, []string{intro}) {
+		t.Errorf("intro tracks = %v, want [%s]", got, intro)
+	}
+
+	if got := trackNames(t, g, OutroCollection); !slices.Equal(got, []string{outro}) {
+		t.Errorf("outro tracks = %v, want [%s]", got, outro)
+	}
+
+	if contents, exists := fake.Blob(BucketName, "voicelines/"+intro); !exists || string(contents) != "intro" {
+		t.Errorf("restored blob = %q, %v; want %q, true", contents, exists, "intro")
+	}
+
+	if _, exists := fake.Blob(BucketName, "archive/"+testMemberID+"/"+intro); exists {
+		t.Errorf("reclaimed voiceline is still archived")
+	}
+
+	if _, err := fake.GetDocumentFromCollection(ctx, ArchivedCollection, testMemberID); err == nil {
+		t.Errorf("archive document still exists after reclaiming")
+	}
+}
+
+func TestBlacklist(t *testing.T) {
+	g, fake := newTestGreeter(t)
+	ctx := context.Background()
+
+	assertBlacklisted := func(wantIntros bool, wantOutros bool) {
+		t.Helper()
+
+		for collection, want := range map[string]bool{WelcomeCollection: wantIntros, OutroCollection: wantOutros} {
+			got, err := g.isInBlacklist(ctx, testMemberID, collection)
+			if err != nil {
+				t.Fatalf("isInBlacklist(%s) error = %v", collection, err)
+			}
+
+			if got != want {
+				t.Fatalf("isInBlacklist(%s) = %v, want %v", collection, got, want)
+			}
+		}
+	}
+
+	assertBlacklisted(false, false)
+
+	if err := g.addToBlacklist(ctx, testMemberID, "both"); err != nil {
+		t.Fatalf("addToBlacklist() error = %v", err)
+	}
+
+	assertBlacklisted(true, true)
+
+	if err := g.removeFromBlacklist(ctx, testMemberID, "intro"); err != nil {
+		t.Fatalf("removeFromBlacklist(intro) error = %v", err)
+	}
+
+	assertBlacklisted(false, true)
+
+	if err := g.removeFromBlacklist(ctx, testMemberID, "outro"); err != nil {
+		t.Fatalf("removeFromBlacklist(outro) error = %v", err)
+	}
+
+	assertBlacklisted(false, false)
+
+	if _, err := fake.GetDocumentFromCollection(ctx, BlacklistCollection, testMemberID); err == nil {
+		t.Errorf("blacklist record still exists with nothing blocked")
+	}
+
+	if err := g.addToBlacklist(ctx, testMemberID, "outro"); err != nil {
+		t.Fatalf("addToBlacklist(outro) error = %v", err)
+	}
+
+	assertBlacklisted(false, true)
+}
+
+func TestBlacklistCacheExpires(t *testing.T) {
+	clock := util.NewFakeClock(testNow)
+	g, fake := newTestGreeter(t, WithClock(clock))
+	ctx := context.Background()
+
+	if blacklisted, err := g.isInBlacklist(ctx, testMemberID, WelcomeCollection); err != nil || blacklisted {
+		t.Fatalf("isInBlacklist() = %v, %v; want false, nil", blacklisted, err)
+	}
+
+	// Written behind the greeter's back, so only the TTL picks it up
+	if err := fake.CreateDocument(ctx, BlacklistCollection, testMemberID, &voicelines.BlacklistRecord{AddedOn: testNow, Intros: true}); err != nil {
+		t.Fatalf("CreateDocument() error = %v", err)
+	}
+
+	if blacklisted, _ := g.isInBlacklist(ctx, testMemberID, WelcomeCollection); blacklisted {
+		t.Errorf("isInBlacklist() before the cached record expired = true; want the cached false")
+	}
+
+	clock.Advance(blacklistCacheTTL)
+
+	if blacklisted, err := g.isInBlacklist(ctx, testMemberID, WelcomeCollection); err != nil || !blacklisted {
+		t.Errorf("isInBlacklist() once the cached record expired = %v, %v; want true, nil", blacklisted, err)
+	}
+}
+
+func TestLegacyBlacklistRecordBlocksBoth(t *testing.T) {
+	g, fake := newTestGreeter(t)
+	ctx := context.Background()
+
+	if err := fake.CreateDocument(ctx, BlacklistCollection, testMemberID, map[string]interface{}{"added_on": testNow}); err != nil {
+		t.Fatalf("CreateDocument() error = %v", err)
+	}
+
+	for _, collection := range []string{WelcomeCollection, OutroCollection} {
+		if blacklisted, err := g.isInBlacklist(ctx, testMemberID, collection); err != nil || !blacklisted {
+			t.Errorf("isInBlacklist(%s) = %v, %v; want true, nil", collection, blacklisted, err)
+		}
+	}
+}
+
+func TestRetrieveRandomAudioName(t *testing.T) {
+	g, _ := newTestGreeter(t)
+	ctx := context.Background()
+
+	if _, err := g.retrieveRandomAudioName(ctx, WelcomeCollection, testMemberID); err == nil {
+		t.Fatalf("retrieveRandomAudioName() for a member without a document returned no error")
+	}
+
+	if err := g.voicelineService.EnsureDocument(ctx, WelcomeCollection, testMemberID); err != nil {
+		t.Fatalf("EnsureDocument() error = %v", err)
+	}
+
+	if name, err := g.retrieveRandomAudioName(ctx, WelcomeCollection, testMemberID); err != nil || name != "" {
+		t.Fatalf("retrieveRandomAudioName() with no tracks = %q, %v; want empty name", name, err)
+	}
+
+	uploaded := []string{
+		uploadTestVoiceline(t, g, WelcomeCollection, "one"),
+		uploadTestVoiceline(t, g, WelcomeCollection, "two"),
+		uploadTestVoiceline(t, g, WelcomeCollection, "three"),
+	}
+
+	for range 20 {
+		name, err := g.retrieveRandomAudioName(ctx, WelcomeCollection, testMemberID)
+		if err != nil {
+			t.Fatalf("retrieveRandomAudioName() error = %v", err)
+		}
+
+		if !slices.Contains(uploaded, name) {
+			t.Fatalf("retrieveRandomAudioName() = %q, not one of %v", name, uploaded)
+		}
+	}
+}
+
+func TestRetrieveRandomAudioNameIsReproducible(t *testing.T) {
+	ctx := context.Background()
+
+	selections := func() []string {
+		g, _ := newTestGreeter(t, WithRand(util.NewRand(42)))
+
+		for _, contents := range []string{"one", "two", "three", "four"} {
+			uploadTestVoiceline(t, g, OutroCollection, contents)
+		}
+
+		tracks := trackNames(t, g, OutroCollection)
+		selected := []string{}
+
+		for range 10 {
+			name, err := g.retrieveRandomAudioName(ctx, OutroCollection, testMemberID)
+			if err != nil {
+				t.Fatalf("retrieveRandomAudioName() error = %v", err)
+			}
+
+			selected = append(selected, strconv.Itoa(slices.Index(tracks, name)))
+		}
+
+		return selected
+	}
+
+	if first, second := selections(), selections(); !slices.Equal(first, second) {
+		t.Fatalf("selections with the same seed differ: %v and %v", first, second)
+	}
+}
+
+func TestCollectGuildStats(t *testing.T) {
+	clock := util.NewFakeClock(testNow)
+	g, _ := newTestGreeter(t, WithClock(clock))
+	ctx := context.Background()
+	logger := zap.NewNop()
+
+	uploadTestVoiceline(t, g, WelcomeCollection, "hello")
+	uploadTestVoiceline(t, g, OutroCollection, "goodbye")
+
+	if err := g.addToBlacklist(ctx, testMemberID, "both"); err != nil {
+		t.Fatalf("addToBlacklist() error = %v", err)
+	}
+
+	g.recordGreetingPlay(ctx, logger, "guild", testMemberID, WelcomeCollection)
+	clock.Advance(time.Hour * 24 * 8)
+	g.recordGreetingPlay(ctx, logger, "guild", testMemberID, WelcomeCollection)
+	g.recordGreetingPlay(ctx, logger, "other guild", testMemberID, WelcomeCollection)
+
+	stats, err := g.collectGuildStats(ctx, "guild", []string{testMemberID, "member without voicelines"})
+	if err != nil {
+		t.Fatalf("collectGuildStats() error = %v", err)
+	}
+
+	want := guildStats{
+		Voicelines:        2,
+		StorageBytes:      int64(len("hello") + len("goodbye")),
+		StorageQuota:      defaultGuildStorageQuota,
+		GreetingsThisWeek: 1,
+		TopUploaderID:     "uploader",
+		TopUploaderCount:  2,
+		Blacklisted:       1,
+	}
+
+	if *stats != want {
+		t.Fatalf("collectGuildStats() = %+v, want %+v", *stats, want)
+	}
+}
+
+func TestOwnVoicelineSelection(t *testing.T) {
+	g, _ := newTestGreeter(t)
+	ctx := context.Background()
+
+	light := uploadTestVoiceline(t, g, WelcomeCollection, "light")
+	heavy := uploadTestVoiceline(t, g, WelcomeCollection, "heavy")
+
+	if err := g.setTrackWeight(ctx, WelcomeCollection, testMemberID, heavy, maxTrackWeight); err != nil {
+		t.Fatalf("setTrackWeight() error = %v", err)
+	}
+
+	if err := g.setTrackWeight(ctx, WelcomeCollection, testMemberID, "missing", 2); !errors.Is(err, errTrackNotFound) {
+		t.Fatalf("setTrackWeight() of a missing track error = %v, want errTrackNotFound", err)
+	}
+
+	picks := map[string]int{}
+	for range 200 {
+		name, err := g.retrieveRandomAudioName(ctx, WelcomeCollection, testMemberID)
+		if err != nil {
+			t.Fatalf("retrieveRandomAudioName() error = %v", err)
+		}
+
+		picks[name]++
+	}
+
+	if picks[heavy] <= picks[light] {
+		t.Errorf("picks = %v, want %s picked more often than %s", picks, heavy, light)
+	}
+
+	if pinned, err := g.togglePinnedTrack(ctx, WelcomeCollection, testMemberID, light); err != nil || !pinned {
+		t.Fatalf("togglePinnedTrack() = %v, %v; want true, nil", pinned, err)
+	}
+
+	for range 20 {
+		if name, _ := g.retrieveRandomAudioName(ctx, WelcomeCollection, testMemberID); name != light {
+			t.Fatalf("retrieveRandomAudioName() with a pinned track = %q, want %q", name, light)
+		}
+	}
+
+	if enabled, err := g.toggleVoicelines(ctx, WelcomeCollection, testMemberID); err != nil || enabled {
+		t.Fatalf("toggleVoicelines() = %v, %v; want false, nil", enabled, err)
+	}
+
+	if _, err := g.retrieveRandomAudioName(ctx, WelcomeCollection, testMemberID); !errors.Is(err, voicelines.ErrDisabled) {
+		t.Fatalf("retrieveRandomAudioName() when turned off error = %v, want voicelines.ErrDisabled", err)
+	}
+}
+
+func TestToggleTrack(t *testing.T) {
+	g, _ := newTestGreeter(t)
+	ctx := context.Background()
+
+	kept := uploadTestVoiceline(t, g, WelcomeCollection, "kept")
+	muted := uploadTestVoiceline(t, g, WelcomeCollection, "muted")
+
+	if _, err := g.togglePinnedTrack(ctx, WelcomeCollection, testMemberID, muted); err != nil {
+		t.Fatalf("togglePinnedTrack() error = %v", err)
+	}
+
+	if enabled, err := g.toggleTrack(ctx, WelcomeCollection, testMemberID, muted); err != nil || enabled {
+		t.Fatalf("toggleTrack() = %v, %v; want false, nil", enabled, err)
+	}
+
+	for range 20 {
+		if name, _ := g.retrieveRandomAudioName(ctx, WelcomeCollection, testMemberID); name != kept {
+			t.Fatalf("retrieveRandomAudioName() with a pinned track turned off = %q, want %q", name, kept)
+		}
+	}
+
+	if enabled, err := g.toggleTrack(ctx, WelcomeCollection, testMemberID, muted); err != nil || !enabled {
+		t.Fatalf("toggleTrack() turning it back on = %v, %v; want true, nil", enabled, err)
+	}
+
+	if name, _ := g.retrieveRandomAudioName(ctx, WelcomeCollection, testMemberID); name != muted {
+		t.Errorf("retrieveRandomAudioName() after turning the pinned track back on = %q, want %q", name, muted)
+	}
+}
+
+func TestMemberPreferences(t *testing.T) {
+	g, _ := newTestGreeter(t)
+	ctx := context.Background()
+
+	for _, want := range []bool{true, false} {
+		if err := g.setMemberPreference(ctx, testMemberID, "respect_dnd", want); err != nil {
+			t.Fatalf("setMemberPreference() error = %v", err)
+		}
+
+		preferences, err := g.getMemberPreferences(ctx, testMemberID)
+		if err != nil {
+			t.Fatalf("getMemberPreferences() error = %v", err)
+		}
+
+		if preferences.RespectDoNotDisturb != want {
+			t.Errorf("RespectDoNotDisturb = %v, want %v", preferences.RespectDoNotDisturb, want)
+		}
+	}
+}
+
+func TestLanguageFor(t *testing.T) {
+	g, _ := newTestGreeter(t)
+	ctx := context.Background()
+
+	interaction := &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{
+		Locale: discordgo.SpanishES,
+		Member: &discordgo.Member{User: &discordgo.User{ID: testMemberID}},
+	}}
+
+	if language := g.languageFor(ctx, interaction); language != i18n.Spanish {
+		t.Errorf("languageFor() without a preference = %q, want the client's %q", language, i18n.Spanish)
+	}
+
+	if err := g.setMemberPreference(ctx, testMemberID, "language", string(i18n.German)); err != nil {
+		t.Fatalf("setMemberPreference() error = %v", err)
+	}
+
+	if language := g.languageFor(ctx, interaction); language != i18n.German {
+		t.Errorf("languageFor() with a preference = %q, want %q", language, i18n.German)
+	}
+
+	interaction.Locale = discordgo.Japanese
+	if err := g.setMemberPreference(ctx, testMemberID, "language", ""); err != nil {
+		t.Fatalf("setMemberPreference() error = %v", err)
+	}
+
+	if language := g.languageFor(ctx, interaction); language != i18n.English {
+		t.Errorf("languageFor() for an unsupported locale = %q, want %q", language, i18n.English)
+	}
+}
+
+func TestChainedGreeting(t *testing.T) {
+	g, _ := newTestGreeter(t)
+	ctx := context.Background()
+
+	airhorn := uploadTestVoiceline(t, g, WelcomeCollection, "airhorn")
+	catchphrase := uploadTestVoiceline(t, g, WelcomeCollection, "catchphrase")
+
+	if err := g.setChain(ctx, WelcomeCollection, testMemberID, []string{airhorn}); err == nil {
+		t.Fatalf("setChain() with a single clip returned no error")
+	}
+
+	if err := g.setChain(ctx, WelcomeCollection, testMemberID, []string{airhorn, catchphrase}); err != nil {
+		t.Fatalf("setChain() error = %v", err)
+	}
+
+	got, err := g.retrieveGreetingTracks(ctx, WelcomeCollection, testMemberID)
+	if err != nil || !slices.Equal(got, []string{airhorn, catchphrase}) {
+		t.Fatalf("retrieveGreetingTracks() = %v, %v; want [%s %s]", got, err, airhorn, catchphrase)
+	}
+
+	// Deleting a chained clip falls back to playing a single track
+	if err := g.removeVoicelines(ctx, WelcomeCollection, testMemberID, []string{airhorn}); err != nil {
+		t.Fatalf("removeVoicelines() error = %v", err)
+	}
+
+	got, err = g.retrieveGreetingTracks(ctx, WelcomeCollection, testMemberID)
+	if err != nil || !slices.Equal(got, []string{catchphrase}) {
+		t.Fatalf("retrieveGreetingTracks() after deleting a chained clip = %v, %v; want [%s]", got, err, catchphrase)
+	}
+}
+
+func TestTrackEffectPlaysCachedVariant(t *testing.T) {
+	g, fake := newTestGreeter(t)
+	ctx := context.Background()
+
+	trackName := uploadTestVoiceline(t, g, WelcomeCollection, "airhorn")
+
+	if err := g.setTrackEffect(ctx, WelcomeCollection, testMemberID, trackName, "nightcore"); err != nil {
+		t.Fatalf("setTrackEffect() error = %v", err)
+	}
+
+	tracks, err := g.retrieveGreeting(ctx, WelcomeCollection, testMemberID)
+	if err != nil || len(tracks) != 1 || tracks[0] != (greetingTrack{name: trackName, effect: "nightcore"}) {
+		t.Fatalf("retrieveGreeting() = %v, %v; want %s with nightcore", tracks, err, trackName)
+	}
+
+	// A variant already in storage is played as is rather than rendered again
+	fake.PutBlob(BucketName, variantObjectName("nightcore", trackName), []byte("sped up airhorn"))
+
+	vc := &discordgo.VoiceStateUpdate{VoiceState: &discordgo.VoiceState{GuildID: "guild", UserID: testMemberID}}
+
+	audioPath, err := g.downloadGreetingTrack(ctx, tracks[0], vc)
+	if err != nil {
+		t.Fatalf("downloadGreetingTrack() error = %v", err)
+	}
+
+	defer util.DeleteFile(audioPath)
+
+	if contents, _ := os.ReadFile(audioPath); string(contents) != "sped up airhorn" {
+		t.Errorf("downloaded clip = %q, want the cached variant", contents)
+	}
+
+	if err := g.removeVoicelines(ctx, WelcomeCollection, testMemberID, []string{trackName}); err != nil {
+		t.Fatalf("removeVoicelines() error = %v", err)
+	}
+
+	if objects, _ := fake.ListFilesInStorage(ctx, BucketName, "variants/"); len(objects) != 0 {
+		t.Errorf("stored variants = %v, want them deleted with the voiceline", objects)
+	}
+
+	if err := g.setTrackEffect(ctx, WelcomeCollection, testMemberID, "missing", "robot"); !errors.Is(err, errTrackNotFound) {
+		t.Errorf("setTrackEffect() on a missing track error = %v, want errTrackNotFound", err)
+	}
+}
+
+func TestEntranceDelay(t *testing.T) {
+	g, fake := newTestGreeter(t)
+	ctx := context.Background()
+
+	if delay, err := g.entranceDelay(ctx, testMemberID); err != nil || delay != 0 {
+		t.Fatalf("entranceDelay() without an intro document = %v, %v; want 0, nil", delay, err)
+	}
+
+	uploadTestVoiceline(t, g, WelcomeCollection, "hello")
+
+	for seconds, want := range map[int64]time.Duration{3: time.Second * 3, 30: maxEntranceDelay} {
+		if err := fake.UpdateDocument(ctx, WelcomeCollection, testMemberID, map[string]interface{}{EntranceDelayKey: seconds}); err != nil {
+			t.Fatalf("UpdateDocument() error = %v", err)
+		}
+
+		if delay, err := g.entranceDelay(ctx, testMemberID); err != nil || delay != want {
+			t.Errorf("entranceDelay() with %d seconds = %v, %v; want %v, nil", seconds, delay, err, want)
+		}
+	}
+}
+
+func TestGreetingCaps(t *testing.T) {
+	caps := newGreetingCaps()
+
+	for i := range 2 {
+		if !caps.allow("guild", "channel", testNow.Add(time.Minute*time.Duration(i)), 2, 0) {
+			t.Fatalf("allow() greeting %d under the hourly cap = false", i+1)
+		}
+	}
+
+	if caps.allow("guild", "channel", testNow.Add(time.Minute*2), 2, 0) {
+		t.Errorf("allow() over the hourly cap = true")
+	}
+
+	if !caps.allow("guild", "other channel", testNow.Add(time.Minute*2), 2, 0) {
+		t.Errorf("allow() in another channel = false, hourly caps are per channel")
+	}
+
+	if !caps.allow("guild", "channel", testNow.Add(time.Hour+time.Second), 2, 0) {
+		t.Errorf("allow() an hour later = false")
+	}
+
+	if !caps.allow("guild", "channel", testNow, 0, 1) || caps.allow("guild", "third channel", testNow, 0, 1) {
+		t.Errorf("daily cap of 1 didn't apply across the guild's channels")
+	}
+}
+
+func TestYieldToMusicBots(t *testing.T) {
+	clock := util.NewFakeClock(testNow)
+	g, _ := newTestGreeter(t, WithClock(clock))
+
+	player := &guildPlayer{guildID: "guild", musicBotAction: musicBotSkip, botSpeakers: map[uint32]bool{7: true}, done: make(chan struct{})}
+
+	if play, volume := g.yieldToMusicBots(player); !play || volume != normalVolume {
+		t.Fatalf("yieldToMusicBots() before any bot audio = %v, %d; want true, %d", play, volume, normalVolume)
+	}
+
+	g.markBotAudio(player, 3)
+
+	if play, _ := g.yieldToMusicBots(player); !play {
+		t.Errorf("yieldToMusicBots() after audio from a member = false, only bots count as music")
+	}
+
+	g.markBotAudio(player, 7)
+
+	if play, _ := g.yieldToMusicBots(player); play {
+		t.Errorf("yieldToMusicBots() while a bot plays with skip = true; want false")
+	}
+
+	player.musicBotAction = musicBotDuck
+
+	if play, volume := g.yieldToMusicBots(player); !play || volume != duckedVolume {
+		t.Errorf("yieldToMusicBots() while a bot plays with duck = %v, %d; want true, %d", play, volume, duckedVolume)
+	}
+
+	clock.Advance(musicBotWindow)
+
+	if play, volume := g.yieldToMusicBots(player); !play || volume != normalVolume {
+		t.Errorf("yieldToMusicBots() once the bot stopped = %v, %d; want true, %d", play, volume, normalVolume)
+	}
+}
+
+func TestPickRouletteMember(t *testing.T) {
+	g, _ := newTestGreeter(t)
+	ctx := context.Background()
+
+	uploadTestVoiceline(t, g, WelcomeCollection, "hello")
+
+	if err := g.addToBlacklist(ctx, "opted out", "intro"); err != nil {
+		t.Fatalf("addToBlacklist() error = %v", err)
+	}
+
+	for range 10 {
+		memberID, err := g.pickRouletteMember(ctx, []string{"no intro", "opted out", testMemberID})
+		if err != nil || memberID != testMemberID {
+			t.Fatalf("pickRouletteMember() = %q, %v; want %q, nil", memberID, err, testMemberID)
+		}
+	}
+
+	if memberID, err := g.pickRouletteMember(ctx, []string{"no intro"}); err != nil || memberID != "" {
+		t.Errorf("pickRouletteMember() without any intros = %q, %v; want empty", memberID, err)
+	}
+}
+
+func TestFileReportDeduplicatesPerReporter(t *testing.T) {
+	g, fake := newTestGreeter(t)
+	ctx := context.Background()
+
+	record := reportRecord{GuildID: "guild", MemberID: testMemberID, Collection: WelcomeCollection, TrackName: "track", ReportedBy: "reporter", ReportedAt: testNow, Status: reportStatusOpen}
+
+	if created, err := g.fileReport(ctx, record); err != nil || !created {
+		t.Fatalf("fileReport() = %t, %v; want true, nil", created, err)
+	}
+
+	if created, err := g.fileReport(ctx, record); err != nil || created {
+		t.Errorf("fileReport() for a repeat report = %t, %v; want false, nil", created, err)
+	}
+
+	record.ReportedBy = "someone else"
+	if created, err := g.fileReport(ctx, record); err != nil || !created {
+		t.Errorf("fileReport() from another reporter = %t, %v; want true, nil", created, err)
+	}
+
+	if reports, _ := fake.GetDocumentsFromCollection(ctx, ReportsCollection); len(reports) != 2 {
+		t.Errorf("reports stored = %d, want 2", len(reports))
+	}
+}
+
+type countingReporter struct{ reports int }
+
+func (r *countingReporter) Report(context.Context, error, map[string]string) { r.reports++ }
+func (r *countingReporter) Close() error                                     { return nil }
+
+func TestStorageFailuresWindowFollowsClock(t *testing.T) {
+	clock := util.NewFakeClock(testNow)
+	reporter := &countingReporter{}
+	failures := reporting.NewFailureTracker(reporter, 3, time.Minute*10, clock)
+	ctx := context.Background()
+
+	// Failures spread out past the window never add up to the threshold
+	for range 3 {
+		failures.Failure(ctx, "upload", errors.New("unavailable"), nil)
+		clock.Advance(time.Minute * 11)
+	}
+
+	if reporter.reports != 0 {
+		t.Fatalf("reports after failures outside the window = %d, want 0", reporter.reports)
+	}
+
+	for range 3 {
+		failures.Failure(ctx, "upload", errors.New("unavailable"), nil)
+		clock.Advance(time.Minute)
+	}
+
+	if reporter.reports != 1 {
+		t.Errorf("reports after three failures within the window = %d, want 1", reporter.reports)
+	}
+}
+
+type rejectingScreener struct{}
+
+func (rejectingScreener) Screen(context.Context, *os.File) (screening.Result, error) {
+	return screening.Result{Verdict: screening.Reject, Reason: "test"}, nil
+}
+
+func TestScreenUploadOnlyInStrictGuilds(t *testing.T) {
+	g, fake := newTestGreeter(t, WithScreener(rejectingScreener{}))
+	g.settings = settings.NewStore(fake, g.clock)
+	ctx := context.Background()
+
+	if _, err := g.settings.Create(ctx, "guild", "Guild"); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	file := newTestFile(t, "hello")
+
+	if result, err := g.screenUpload(ctx, "guild", file, ""); err != nil || result.Verdict != screening.Allow {
+		t.Errorf("screenUpload() without strict mode = %v, %v; want allow", result, err)
+	}
+
+	if err := g.settings.SetStrictScreening(ctx, "guild", true); err != nil {
+		t.Fatalf("SetStrictScreening() error = %v", err)
+	}
+
+	if result, err := g.screenUpload(ctx, "guild", file, ""); err != nil || result.Verdict != screening.Reject {
+		t.Errorf("screenUpload() with strict mode = %v, %v; want reject", result, err)
+	}
+}
+
+type stubTranscriber struct {
+	transcript string
+	err        error
+}
+
+func (s stubTranscriber) Transcribe(context.Context, *os.File) (string, error) {
+	return s.transcript, s.err
+}
+
+func TestUploadTranscripts(t *testing.T) {
+	// Transcribing again for screening would fail, so a reject can only come from the upload's transcript
+	screener := screening.NewWordlistScreener(stubTranscriber{err: errors.New("transcribed twice")}, []string{"rude"}, nil)
+
+	g, fake := newTestGreeter(t, WithTranscriber(stubTranscriber{transcript: "hello there"}), WithScreener(screener))
+	g.settings = settings.NewStore(fake, g.clock)
+	ctx := context.Background()
+
+	if _, err := g.settings.Create(ctx, "guild", "Guild"); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	if err := g.settings.SetStrictScreening(ctx, "guild", true); err != nil {
+		t.Fatalf("SetStrictScreening() error = %v", err)
+	}
+
+	if result, err := g.screenUpload(ctx, "guild", newTestFile(t, "hello"), "you're rude"); err != nil || result.Verdict != screening.Reject {
+		t.Errorf("screenUpload() with a transcript = %v, %v; want reject", result, err)
+	}
+
+	transcript, err := g.transcribeUpload(ctx, newTestFile(t, "hello"))
+	if err != nil || transcript != "hello there" {
+		t.Fatalf("transcribeUpload() = %q, %v; want %q", transcript, err, "hello there")
+	}
+
+	trackName := uploadTestVoiceline(t, g, WelcomeCollection, "hello")
+	g.annotateTrack(ctx, WelcomeCollection, []string{testMemberID}, storedClip{trackName: trackName, transcript: transcript})
+
+	listing, err := g.ListVoicelines(ctx, WelcomeCollection, testMemberID)
+	if err != nil {
+		t.Fatalf("ListVoicelines() error = %v", err)
+	}
+
+	if got := listing.Transcripts(); !slices.Equal(got, []string{"hello there"}) {
+		t.Errorf("Transcripts() = %q, want [hello there]", got)
+	}
+}
+
+func TestExportGuildVoicelines(t *testing.T) {
+	g, fake := newTestGreeter(t)
+	ctx := context.Background()
+
+	uploadTestVoiceline(t, g, WelcomeCollection, "hello")
+	uploadTestVoiceline(t, g, OutroCollection, "goodbye")
+
+	objectName, exported, err := g.exportGuildVoicelines(ctx, "guild", []string{testMemberID, "no voicelines"})
+	if err != nil || exported != 2 {
+		t.Fatalf("exportGuildVoicelines() = %d, %v; want 2, nil", exported, err)
+	}
+
+	contents, ok := fake.Blob(BucketName, objectName)
+	if !ok {
+		t.Fatalf("export %s wasn't uploaded", objectName)
+	}
+
+	archive, err := ziparchive.NewReader(bytes.NewReader(contents), int64(len(contents)))
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+
+	names := []string{}
+	for _, file := range archive.File {
+		names = append(names, file.Name)
+	}
+
+	// Entries are written in name order so the same voicelines always make the same zip
+	if want := []string{testMemberID + "/intro/1.mp3", testMemberID + "/outro/1.mp3"}; !slices.Equal(names, want) {
+		t.Errorf("export entries = %v, want %v", names, want)
+	}
+
+	// Exporting again replaces the previous export
+	if _, _, err := g.exportGuildVoicelines(ctx, "guild", []string{testMemberID}); err != nil {
+		t.Fatalf("exportGuildVoicelines() again error = %v", err)
+	}
+
+	if exports, _ := fake.ListFilesInStorage(ctx, BucketName, ExportPrefix("guild")); len(exports) != 1 {
+		t.Errorf("exports after exporting twice = %v, want just the latest", exports)
+	}
+}
+
+func TestDefaultGreetingFallback(t *testing.T) {
+	g, fake := newTestGreeter(t)
+	g.settings = settings.NewStore(fake, g.clock)
+	ctx := context.Background()
+
+	if _, err := g.settings.Create(ctx, "guild", "Guild"); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	if _, err := g.installVoicePack(ctx, "guild", "classics"); !errors.Is(err, errVoicePackNotFound) {
+		t.Errorf("installVoicePack() of a missing pack error = %v, want %v", err, errVoicePackNotFound)
+	}
+
+	if err := fake.CreateDocument(ctx, VoicePacksCollection, "classics", map[string]interface{}{"name": "Classics"}); err != nil {
+		t.Fatalf("CreateDocument() error = %v", err)
+	}
+
+	if _, err := g.installVoicePack(ctx, "guild", "classics"); !errors.Is(err, errVoicePackEmpty) {
+		t.Errorf("installVoicePack() of an empty pack error = %v, want %v", err, errVoicePackEmpty)
+	}
+
+	fake.PutBlob(BucketName, "packs/classics/intro/hello.mp3", []byte("hello"))
+
+	if _, err := g.installVoicePack(ctx, "guild", "classics"); err != nil {
+		t.Fatalf("installVoicePack() error = %v", err)
+	}
+
+	if _, objectName, err := g.defaultGreetingObject(ctx, "guild", WelcomeCollection); err != nil || objectName != "packs/classics/intro/hello.mp3" {
+		t.Errorf("defaultGreetingObject(intro) = %q, %v; want the pack's intro", objectName, err)
+	}
+
+	if _, objectName, err := g.defaultGreetingObject(ctx, "guild", OutroCollection); err != nil || objectName != "" {
+		t.Errorf("defaultGreetingObject(outro) = %q, %v; want nothing, the pack has no outros", objectName, err)
+	}
+
+	// An uploaded default takes precedence over the voice pack
+	if err := g.settings.SetDefaultGreeting(ctx, "guild", "intro", "defaultgreetings/guild/hello"); err != nil {
+		t.Fatalf("SetDefaultGreeting() error = %v", err)
+	}
+
+	if _, objectName, err := g.defaultGreetingObject(ctx, "guild", WelcomeCollection); err != nil || objectName != "defaultgreetings/guild/hello" {
+		t.Errorf("defaultGreetingObject(intro) = %q, %v; want the uploaded default", objectName, err)
+	}
+
+	// Guilds with storage of their own keep their uploads there, pack clips stay in the shared bucket
+	if err := fake.UpdateDocument(ctx, settings.Collection, "guild", map[string]interface{}{"storage_bucket": "acme", "storage_prefix": "/tenants/acme"}); err != nil {
+		t.Fatalf("UpdateDocument() error = %v", err)
+	}
+
+	if err := g.settings.Reload(ctx); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+
+	location, objectName, err := g.defaultGreetingObject(ctx, "guild", WelcomeCollection)
+	if err != nil || location.Bucket != "acme" || location.Object(objectName) != "tenants/acme/defaultgreetings/guild/hello" {
+		t.Errorf("defaultGreetingObject(intro) = %+v, %q, %v; want the default in the guild's bucket under its prefix", location, objectName, err)
+	}
+
+	if location, _, err := g.defaultGreetingObject(ctx, "guild", OutroCollection); err != nil || location.Bucket != BucketName || location.Prefix != "" {
+		t.Errorf("defaultGreetingObject(outro) location = %+v, %v; want the shared bucket for the pack", location, err)
+	}
+}
+
+func TestJoinFailureNotices(t *testing.T) {
+	perms := int64(discordgo.PermissionViewChannel | discordgo.PermissionVoiceConnect)
+	if missing := missingVoicePermissions(perms); !slices.Equal(missing, []string{"Speak"}) {
+		t.Errorf("missingVoicePermissions() = %v, want [Speak]", missing)
+	}
+
+	notices := newJoinFailureNotices()
+
+	if !notices.claim("guild/channel/full", testNow) {
+		t.Error("claim() of a new problem = false, want true")
+	}
+
+	if notices.claim("guild/channel/full", testNow.Add(time.Minute)) {
+		t.Error("claim() within the cooldown = true, want false")
+	}
+
+	if !notices.claim("guild/channel/full", testNow.Add(joinFailureCooldown)) {
+		t.Error("claim() after the cooldown = false, want true")
+	}
+}
+
+func TestPlayerClaimedOnce(t *testing.T) {
+	g, _ := newTestGreeter(t)
+	player := &guildPlayer{guildID: "guild", voiceState: NotPlaying}
+
+	var claims atomic.Int32
+	var wg sync.WaitGroup
+
+	for range 10 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			g.mu.Lock()
+			claimed := player.claimPlayback()
+			g.mu.Unlock()
+
+			if claimed {
+				claims.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := claims.Load(); got != 1 {
+		t.Fatalf("claimPlayback() succeeded %d times on an idle player, want once", got)
+	}
+
+	// Nothing left to play, so the player goes idle and the next greeting claims it again
+	g.playNext(player, false)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if player.voiceState != NotPlaying || !player.claimPlayback() {
+		t.Errorf("claimPlayback() after the queue ran out = false, want the player to be idle again")
+	}
+}
+
+func TestPaginationStoreConcurrentSelections(t *testing.T) {
+	store := newPaginationStore()
+	store.put("message", &paginationState{SelectMenuData: []string{"a", "b", "c", "d"}})
+
+	var wg sync.WaitGroup
+	for _, trackName := range []string{"a", "b", "c", "d"} {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			store.update("message", func(state *paginationState) {
+				state.Selected = append(state.Selected, trackName)
+			})
+		}()
+	}
+	wg.Wait()
+
+	state, ok := store.get("message")
+	if !ok || len(state.Selected) != 4 {
+		t.Fatalf("get() = %v, %t; want all 4 selections kept", state.Selected, ok)
+	}
+
+	// Copies handed out can't change what's stored
+	state.Selected[0] = "changed"
+	if stored, _ := store.get("message"); slices.Contains(stored.Selected, "changed") {
+		t.Error("changing a copy from get() changed the stored state")
+	}
+
+	if _, ok := store.take("message"); !ok {
+		t.Fatal("take() = false, want the stored state")
+	}
+
+	if _, ok := store.take("message"); ok {
+		t.Error("second take() = true, want the state to only be handed out once")
+	}
+}
+
+func TestDeleteMenuKeepsSelectionsAcrossPages(t *testing.T) {
+	state := &paginationState{
+		Pages:          make([]*discordgo.MessageEmbed, 2),
+		SelectMenuData: []string{"a", "b", "c", "d", "e"},
+		Selected:       []string{"b"},
+		CurrentPage:    1,
+	}
+
+	if minBound, maxBound := state.pageBounds(); minBound != 4 || maxBound != 5 {
+		t.Errorf("pageBounds() on the last page = %d, %d; want 4, 5", minBound, maxBound)
+	}
+
+	state.CurrentPage = 0
+	components := deleteMenuComponents(state, testMemberID, WelcomeCollection, "member")
+	if len(components) != 3 {
+		t.Fatalf("deleteMenuComponents() rows = %d, want pagination, select menu and confirm", len(components))
+	}
+
+	menu := components[1].(discordgo.ActionsRow).Components[0].(discordgo.SelectMenu)
+	for _, option := range menu.Options {
+		if option.Default != (option.Value == "b") {
+			t.Errorf("option %s checked = %t, want only the earlier pick checked", option.Value, option.Default)
+		}
+	}
+
+	confirm := components[2].(discordgo.ActionsRow).Components[0].(discordgo.Button)
+	if confirm.Label != "Delete 1 selected" || confirm.Disabled {
+		t.Errorf("confirm button = %q disabled %t, want it counting the pick", confirm.Label, confirm.Disabled)
+	}
+}
+
+func TestParseMessageLink(t *testing.T) {
+	guildID, channelID, messageID, err := parseMessageLink("https://ptb.discord.com/channels/1/2/3")
+	if err != nil || guildID != "1" || channelID != "2" || messageID != "3" {
+		t.Errorf("parseMessageLink() = %s, %s, %s, %v; want 1, 2, 3", guildID, channelID, messageID, err)
+	}
+
+	for _, link := range []string{"https://example.com/channels/1/2/3", "https://discord.com/channels/1/2", "not a link"} {
+		if _, _, _, err := parseMessageLink(link); !errors.Is(err, errInvalidMessageLink) {
+			t.Errorf("parseMessageLink(%q) error = %v, want %v", link, err, errInvalidMessageLink)
+		}
+	}
+}
+
+func TestShareVoicelineReusesObject(t *testing.T) {
+	g, fake := newTestGreeter(t)
+	ctx := context.Background()
+
+	trackName := uploadTestVoiceline(t, g, WelcomeCollection, "team sound")
+
+	if err := g.shareVoiceline(ctx, WelcomeCollection, []string{"teammate"}, "uploader", trackName); err != nil {
+		t.Fatalf("shareVoiceline() error = %v", err)
+	}
+
+	tracks, err := g.voicelineService.Tracks(ctx, WelcomeCollection, "teammate")
+	if err != nil || len(tracks) != 1 || tracks[0].(map[string]interface{})["track_name"] != trackName {
+		t.Fatalf("teammate's tracks = %v, %v; want the shared track", tracks, err)
+	}
+
+	if objects, _ := fake.ListFilesInStorage(ctx, BucketName, "voicelines/"); len(objects) != 1 {
+		t.Errorf("stored voicelines = %v, want one object shared by both members", objects)
+	}
+}
+
+func TestRemovingSharedVoicelineKeepsObjectForOthers(t *testing.T) {
+	g, fake := newTestGreeter(t)
+	ctx := context.Background()
+
+	trackName := uploadTestVoiceline(t, g, WelcomeCollection, "team sound")
+	if err := g.shareVoiceline(ctx, WelcomeCollection, []string{"teammate"}, "uploader", trackName); err != nil {
+		t.Fatalf("shareVoiceline() error = %v", err)
+	}
+
+	if err := g.removeVoicelines(ctx, WelcomeCollection, testMemberID, []string{trackName}); err != nil {
+		t.Fatalf("removeVoicelines() error = %v", err)
+	}
+
+	if objects, _ := fake.ListFilesInStorage(ctx, BucketName, "voicelines/"); len(objects) != 1 {
+		t.Fatalf("stored voicelines = %v, want the object kept for the teammate", objects)
+	}
+
+	if err := g.removeVoicelines(ctx, WelcomeCollection, "teammate", []string{trackName}); err != nil {
+		t.Fatalf("removeVoicelines() error = %v", err)
+	}
+
+	if objects, _ := fake.ListFilesInStorage(ctx, BucketName, "voicelines/"); len(objects) != 0 {
+		t.Errorf("stored voicelines = %v, want the object deleted with its last reference", objects)
+	}
+}
+
+func TestVoicelineRefsInterleaved(t *testing.T) {
+	ctx := context.Background()
+
+	for round := range 20 {
+		g, fake := newTestGreeter(t)
+		trackName := uploadTestVoiceline(t, g, WelcomeCollection, "team sound "+strconv.Itoa(round))
+
+		// Members pick up the track while the uploader removes it, each add either lands before the release and keeps
+		// the object or after it and fails
+		members := []string{"first", "second", "third", "fourth"}
+		added := make([]bool, len(members))
+
+		var wg sync.WaitGroup
+
+		for i, memberID := range members {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				err := g.voicelineService.AddRef(ctx, trackName, WelcomeCollection, memberID)
+				if err != nil && !errors.Is(err, firebaseAdapter.ErrRefsReleased) {
+					t.Errorf("AddRef(%s) error = %v", memberID, err)
+				}
+
+				added[i] = err == nil
+			}()
+		}
+
+		if err := g.voicelineService.DeleteObject(ctx, trackName, WelcomeCollection, testMemberID); err != nil {
+			t.Fatalf("DeleteObject() error = %v", err)
+		}
+
+		wg.Wait()
+
+		var holders []string
+
+		for i, memberID := range members {
+			if added[i] {
+				holders = append(holders, memberID)
+			}
+		}
+
+		_, stored := fake.Blob(BucketName, "voicelines/"+trackName)
+		if stored != (len(holders) > 0) {
+			t.Fatalf("round %d: object stored = %t with %d members holding it", round, stored, len(holders))
+		}
+
+		// The remaining holders release it at once, only the last release deletes the object
+		for _, memberID := range holders {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				if err := g.voicelineService.DeleteObject(ctx, trackName, WelcomeCollection, memberID); err != nil {
+					t.Errorf("DeleteObject(%s) error = %v", memberID, err)
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		if _, stored := fake.Blob(BucketName, "voicelines/"+trackName); stored {
+			t.Errorf("round %d: object kept after every member released it", round)
+		}
+
+		if err := g.voicelineService.AddRef(ctx, trackName, WelcomeCollection, "late"); !errors.Is(err, firebaseAdapter.ErrRefsReleased) {
+			t.Errorf("round %d: AddRef() after the object was deleted error = %v, want ErrRefsReleased", round, err)
+		}
+	}
+}
+
+func TestReorderTrackKeepsOrderAsTracksAreAdded(t *testing.T) {
+	g, _ := newTestGreeter(t)
+	ctx := context.Background()
+
+	first := uploadTestVoiceline(t, g, WelcomeCollection, "first")
+	second := uploadTestVoiceline(t, g, WelcomeCollection, "second")
+	third := uploadTestVoiceline(t, g, WelcomeCollection, "third")
+
+	if err := g.reorderTrack(ctx, WelcomeCollection, testMemberID, third, 1); err != nil {
+		t.Fatalf("reorderTrack() error = %v", err)
+	}
+
+	fourth := uploadTestVoiceline(t, g, WelcomeCollection, "fourth")
+
+	if got, want := trackNames(t, g, WelcomeCollection), []string{third, first, second, fourth}; !slices.Equal(got, want) {
+		t.Errorf("tracks = %v, want %v", got, want)
+	}
+
+	if err := g.reorderTrack(ctx, WelcomeCollection, testMemberID, "missing", 1); !errors.Is(err, errTrackNotFound) {
+		t.Errorf("reorderTrack() of a missing track error = %v, want errTrackNotFound", err)
+	}
+
+	if voicelines.ShortID(first) == voicelines.ShortID(second) || len(voicelines.ShortID(first)) != voicelines.ShortIDLength {
+		t.Errorf("short ids %q and %q should be distinct and %d characters", voicelines.ShortID(first), voicelines.ShortID(second), voicelines.ShortIDLength)
+	}
+}
+
+func TestListDocumentKeepsOrder(t *testing.T) {
+	g, _ := newTestGreeter(t)
+	ctx := context.Background()
+
+	first := uploadTestVoiceline(t, g, WelcomeCollection, "first")
+	second := uploadTestVoiceline(t, g, WelcomeCollection, "second")
+
+	if err := g.reorderTrack(ctx, WelcomeCollection, testMemberID, second, 1); err != nil {
+		t.Fatalf("reorderTrack() error = %v", err)
+	}
+
+	data, err := g.firebaseAdapter.GetDocumentFromCollection(ctx, WelcomeCollection, testMemberID)
+	if err != nil {
+		t.Fatalf("GetDocumentFromCollection() error = %v", err)
+	}
+
+	tracks, err := g.voicelineService.ListDocument(ctx, data, IntroArrayKey)
+	if err != nil {
+		t.Fatalf("ListDocument() error = %v", err)
+	}
+
+	if len(tracks) != 2 || tracks[0].TrackName != second || tracks[1].TrackName != first {
+		t.Fatalf("tracks = %+v, want %s then %s", tracks, second, first)
+	}
+
+	for _, track := range tracks {
+		if !strings.Contains(track.URL, track.TrackName) {
+			t.Errorf("signed url %q isn't for %s", track.URL, track.TrackName)
+		}
+	}
+}
+
+func TestListingSignsWaveforms(t *testing.T) {
+	g, fake := newTestGreeter(t)
+	ctx := context.Background()
+
+	plain := uploadTestVoiceline(t, g, WelcomeCollection, "plain")
+	drawn := uploadTestVoiceline(t, g, WelcomeCollection, "drawn")
+
+	fake.PutBlob(BucketName, waveformObjectName(drawn), []byte("png"))
+	g.annotateTrack(ctx, WelcomeCollection, []string{testMemberID}, storedClip{trackName: drawn, waveform: waveformObjectName(drawn)})
+
+	listing, err := g.ListVoicelines(ctx, WelcomeCollection, testMemberID)
+	if err != nil {
+		t.Fatalf("ListVoicelines() error = %v", err)
+	}
+
+	if got := listing.TrackNames(); !slices.Equal(got, []string{plain, drawn}) {
+		t.Fatalf("TrackNames() = %v, want [%s %s]", got, plain, drawn)
+	}
+
+	if listing.Voicelines[0].WaveformURL != "" || !strings.Contains(listing.Voicelines[1].WaveformURL, waveformObjectName(drawn)) {
+		t.Errorf("waveform urls = %q, %q; want none then %s", listing.Voicelines[0].WaveformURL, listing.Voicelines[1].WaveformURL, waveformObjectName(drawn))
+	}
+
+	if !strings.Contains(listing.Voicelines[1].URL, voicelines.Object(drawn)) {
+		t.Errorf("track url %q isn't for %s", listing.Voicelines[1].URL, drawn)
+	}
+
+	if err := g.removeVoicelines(ctx, WelcomeCollection, testMemberID, []string{drawn}); err != nil {
+		t.Fatalf("removeVoicelines() error = %v", err)
+	}
+
+	if _, exists := fake.Blob(BucketName, waveformObjectName(drawn)); exists {
+		t.Errorf("waveform of a deleted voiceline is still in storage")
+	}
+}
+
+func TestDeleteReportsEachTrack(t *testing.T) {
+	g, _ := newTestGreeter(t)
+
+	kept := uploadTestVoiceline(t, g, WelcomeCollection, "kept")
+	removed := uploadTestVoiceline(t, g, WelcomeCollection, "removed")
+
+	result, err := g.voicelineService.Delete(context.Background(), WelcomeCollection, testMemberID, []string{removed, "missing"})
+	if err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	if !slices.Equal(result.Deleted, []string{removed}) {
+		t.Errorf("deleted = %v, want [%s]", result.Deleted, removed)
+	}
+
+	if len(result.Failed) != 1 || result.Failed[0].Name != "missing" || result.Err() == nil {
+		t.Errorf("failed = %+v, want only the missing track", result.Failed)
+	}
+
+	if got := trackNames(t, g, WelcomeCollection); !slices.Equal(got, []string{kept}) {
+		t.Errorf("tracks = %v, want [%s]", got, kept)
+	}
+}
+
+func TestSweepArchivesExpiredVoicelines(t *testing.T) {
+	clock := util.NewFakeClock(testNow)
+	g, fake := newTestGreeter(t, WithClock(clock))
+	ctx := context.Background()
+
+	expiring := uploadTestVoiceline(t, g, WelcomeCollection, "funny for a week")
+	kept := uploadTestVoiceline(t, g, WelcomeCollection, "funny forever")
+
+	if err := g.expireVoiceline(ctx, WelcomeCollection, []string{testMemberID}, expiring, testNow.AddDate(0, 0, 7)); err != nil {
+		t.Fatalf("expireVoiceline() error = %v", err)
+	}
+
+	if archived, err := g.sweepExpiredVoicelines(ctx); err != nil || archived != 0 {
+		t.Fatalf("sweepExpiredVoicelines() before expiry = %d, %v; want 0, nil", archived, err)
+	}
+
+	clock.Advance(time.Hour * 24 * 7)
+
+	if archived, err := g.sweepExpiredVoicelines(ctx); err != nil || archived != 1 {
+		t.Fatalf("sweepExpiredVoicelines() after expiry = %d, %v; want 1, nil", archived, err)
+	}
+
+	if got := trackNames(t, g, WelcomeCollection); !slices.Equal(got, []string{kept}) {
+		t.Errorf("tracks after sweep = %v, want only %s", got, kept)
+	}
+
+	if _, exists := fake.Blob(BucketName, "archive/"+testMemberID+"/"+expiring); !exists {
+		t.Errorf("expired voiceline wasn't archived")
+	}
+
+	if archived, err := g.sweepExpiredVoicelines(ctx); err != nil || archived != 0 {
+		t.Errorf("sweepExpiredVoicelines() once swept = %d, %v; want 0, nil", archived, err)
+	}
+}
+
+func TestGreetingPrefetches(t *testing.T) {
+	clock := util.NewFakeClock(testNow)
+	prefetches := newGreetingPrefetches()
+	key := prefetchKey(WelcomeCollection, testMemberID)
+
+	token, ok := prefetches.begin(key)
+	if !ok {
+		t.Fatal("begin() of a new key = false, want true")
+	}
+
+	if _, ok := prefetches.begin(key); ok {
+		t.Error("begin() while downloading = true, want false")
+	}
+
+	clips := []queuedClip{{audioPath: newTestFile(t, "hello").Name(), trackName: "hello"}}
+	if !prefetches.finish(key, token, clips, clock, zap.NewNop()) {
+		t.Fatal("finish() = false, want true")
+	}
+
+	if got, ok := prefetches.take(key); !ok || len(got) != 1 || got[0].trackName != "hello" {
+		t.Fatalf("take() = %v, %v; want the prefetched clip", got, ok)
+	}
+
+	if _, ok := prefetches.take(key); ok {
+		t.Error("take() twice = true, want the greeting to only be played once")
+	}
+
+	// Voicelines changing mid download throw the download away
+	token, _ = prefetches.begin(key)
+	prefetches.invalidate(key, zap.NewNop())
+
+	if prefetches.finish(key, token, clips, clock, zap.NewNop()) {
+		t.Error("finish() after invalidate = true, want false")
+	}
+
+	expiring := []queuedClip{{audioPath: newTestFile(t, "bye").Name()}}
+	token, _ = prefetches.begin(key)
+	prefetches.finish(key, token, expiring, clock, zap.NewNop())
+	clock.Advance(prefetchTTL)
+
+	if _, ok := prefetches.take(key); ok {
+		t.Error("take() after the TTL = true, want the greeting thrown away")
+	}
+
+	if _, err := os.Stat(expiring[0].audioPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expired clip still on disk, stat error = %v", err)
+	}
+}
+
+// writeTestZip writes an archive holding the given files and returns its path.
+func writeTestZip(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	var archive bytes.Buffer
+	zipWriter := ziparchive.NewWriter(&archive)
+
+	for name, contents := range files {
+		entry, err := zipWriter.Create(name)
+		if err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+
+		if _, err := entry.Write([]byte(contents)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	if err := zipWriter.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	src := filepath.Join(t.TempDir(), "upload.zip")
+	if err := os.WriteFile(src, archive.Bytes(), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	return src
+}
+
+func TestZipUploadLimits(t *testing.T) {
+	src := writeTestZip(t, map[string]string{
+		"hello.mp3":         "hello",
+		"notes.txt":         "not audio",
+		"nested.zip":        "PK",
+		"a/b/c/deep.mp3":    "too deep",
+		"clips/goodbye.M4A": "goodbye",
+		"big.mp3":           string(make([]byte, zipUploadLimits.MaxFileBytes+1)),
+		"../../escape.mp3":  "zip slip",
+	})
+
+	files, entryErrors, err := util.Unzip(src, t.TempDir(), zipUploadLimits)
+	if err != nil {
+		t.Fatalf("Unzip() error = %v", err)
+	}
+
+	extracted := []string{}
+	for _, file := range files {
+		extracted = append(extracted, filepath.Base(file.Name()))
+		file.Close()
+	}
+
+	slices.Sort(extracted)
+	if !slices.Equal(extracted, []string{"goodbye.M4A", "hello.mp3"}) {
+		t.Errorf("extracted = %v, want [goodbye.M4A hello.mp3]", extracted)
+	}
+
+	wantErrors := map[string]error{
+		"notes.txt":        util.ErrUnsupportedFormat,
+		"nested.zip":       util.ErrNestedArchive,
+		"a/b/c/deep.mp3":   util.ErrEntryTooDeep,
+		"big.mp3":          util.ErrEntryTooLarge,
+		"../../escape.mp3": util.ErrIllegalPath,
+	}
+
+	if len(entryErrors) != len(wantErrors) {
+		t.Fatalf("entry errors = %v, want one for each of %d skipped files", entryErrors, len(wantErrors))
+	}
+
+	for _, entryError := range entryErrors {
+		if !errors.Is(entryError, wantErrors[entryError.Name]) {
+			t.Errorf("entry error for %s = %v, want %v", entryError.Name, entryError.Err, wantErrors[entryError.Name])
+		}
+	}
+}
+
+func TestUploadZipEntryStreamsToStorage(t *testing.T) {
+	g, fake := newTestGreeter(t)
+	ctx := context.Background()
+
+	archive, entryErrors, err := util.OpenZip(writeTestZip(t, map[string]string{"hello.mp3": "ID3hello", "readme.md": "hi"}), zipUploadLimits)
+	if err != nil {
+		t.Fatalf("OpenZip() error = %v", err)
+	}
+
+	defer archive.Close()
+
+	if len(entryErrors) != 1 || len(archive.Entries()) != 1 {
+		t.Fatalf("OpenZip() = %d entries, %v; want the mp3 and the readme skipped", len(archive.Entries()), entryErrors)
+	}
+
+	if err := g.voicelineService.EnsureDocument(ctx, WelcomeCollection, testMemberID); err != nil {
+		t.Fatalf("EnsureDocument() error = %v", err)
+	}
+
+	clip, result, err := g.uploadZipEntry(ctx, t.TempDir(), "guild", WelcomeCollection, testMemberID, "uploader", archive.Entries()[0])
+	if err != nil || clip.trackName == "" || result.Verdict != screening.Allow {
+		t.Fatalf("uploadZipEntry() = %q, %v, %v; want the clip stored", clip.trackName, result.Verdict, err)
+	}
+
+	trackName := clip.trackName
+
+	if contents, exists := fake.Blob(BucketName, "voicelines/"+trackName); !exists || string(contents) != "ID3hello" {
+		t.Errorf("stored blob = %q, %v; want %q, true", contents, exists, "ID3hello")
+	}
+
+	if got := trackNames(t, g, WelcomeCollection); !slices.Equal(got, []string{trackName}) {
+		t.Errorf("intro tracks = %v, want [%s]", got, trackName)
+	}
+}
+
+func TestUploadZipEntryOnlyStreamsMP3(t *testing.T) {
+	g, _ := newTestGreeter(t)
+	ctx := context.Background()
+
+	// An ftyp box is how m4a clips start, they have to go through ffmpeg rather than being stored as they are
+	archive, _, err := util.OpenZip(writeTestZip(t, map[string]string{"hello.m4a": "\x00\x00\x00\x18ftypM4A not really audio"}), zipUploadLimits)
+	if err != nil {
+		t.Fatalf("OpenZip() error = %v", err)
+	}
+
+	defer archive.Close()
+
+	if err := g.voicelineService.EnsureDocument(ctx, WelcomeCollection, testMemberID); err != nil {
+		t.Fatalf("EnsureDocument() error = %v", err)
+	}
+
+	if clip, _, err := g.uploadZipEntry(ctx, t.TempDir(), "guild", WelcomeCollection, testMemberID, "uploader", archive.Entries()[0]); err == nil {
+		t.Fatalf("uploadZipEntry() = %q, nil; want an error transcoding a clip that isn't audio", clip.trackName)
+	}
+
+	if got := trackNames(t, g, WelcomeCollection); len(got) != 0 {
+		t.Errorf("intro tracks = %v, want none", got)
+	}
+}
+
+func TestVoiceQualityReconnect(t *testing.T) {
+	for endpoint, want := range map[string]string{
+		"us-east1234.discord.media:443":  "us-east",
+		"c-atl06-2f9a.discord.media:443": "atl",
+		"rotterdam42.discord.media":      "rotterdam",
+	} {
+		if region := voiceRegion(endpoint); region != want {
+			t.Errorf("voiceRegion(%q) = %q, want %q", endpoint, region, want)
+		}
+	}
+
+	const guildID = "guild"
+
+	qualities := newVoiceQualities()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	qualities.setEndpoint(guildID, "us-east1234.discord.media:443")
+	qualities.recordProbes(guildID, []voiceProbe{{rtt: time.Millisecond * 40}, {lost: true}, {lost: true}})
+
+	if reason := qualities.claimReconnect(guildID, now); reason != "" {
+		t.Errorf("claimReconnect() after one round = %q, want too few probes to judge", reason)
+	}
+
+	qualities.recordProbes(guildID, []voiceProbe{{rtt: time.Millisecond * 40}, {rtt: time.Millisecond * 45}, {lost: true}, {rtt: time.Millisecond * 50}, {rtt: time.Millisecond * 40}, {rtt: time.Millisecond * 42}})
+
+	if reason := qualities.claimReconnect(guildID, now); reason == "" {
+		t.Fatalf("claimReconnect() with a third of probes lost returned no reason")
+	}
+
+	qualities.recordPlayback(guildID, time.Second*2)
+
+	if reason := qualities.claimReconnect(guildID, now.Add(time.Minute)); reason != "" {
+		t.Errorf("claimReconnect() during the cooldown = %q, want none", reason)
+	}
+
+	if reason := qualities.claimReconnect(guildID, now.Add(voiceReconnectCooldown)); reason == "" {
+		t.Errorf("claimReconnect() after the cooldown with a lagging clip returned no reason")
+	}
+
+	if quality, _ := qualities.snapshot(guildID); quality.reconnects != 2 || len(quality.probes) != 0 {
+		t.Errorf("snapshot() = %d reconnects and %d probes, want 2 and none", quality.reconnects, len(quality.probes))
+	}
+}
+
+func TestVoiceEventDedup(t *testing.T) {
+	dedup := newVoiceEventDedup()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	steps := []struct {
+		name      string
+		sessionID string
+		joined    bool
+		after     time.Duration
+		want      bool
+	}{
+		{name: "join", sessionID: "a", joined: true, want: true},
+		{name: "redelivered join", sessionID: "a", joined: true, after: time.Second, want: false},
+		{name: "leave", sessionID: "a", joined: false, after: time.Second * 2, want: true},
+		{name: "redelivered leave", sessionID: "a", joined: false, after: time.Second * 3, want: false},
+		{name: "join from a new session", sessionID: "b", joined: true, after: time.Second * 4, want: true},
+		{name: "late leave of the old session", sessionID: "a", joined: false, after: time.Second * 5, want: false},
+		{name: "leave", sessionID: "b", joined: false, after: time.Second * 6, want: true},
+		{name: "same session leaving again after the window", sessionID: "b", joined: false, after: time.Second*6 + voiceEventWindow, want: true},
+	}
+
+	for _, step := range steps {
+		if got := dedup.accept("guild", testMemberID, step.sessionID, step.joined, now.Add(step.after)); got != step.want {
+			t.Errorf("accept() for %s = %v, want %v", step.name, got, step.want)
+		}
+	}
+
+	if got := dedup.accept("other-guild", testMemberID, "b", false, now.Add(time.Second*7)); !got {
+		t.Errorf("accept() for a leave in another guild = false, want true")
+	}
+}
+
+func TestVoiceJoinFlags(t *testing.T) {
+	tests := []struct {
+		name          string
+		guildSettings settings.GuildSettings
+		wantMute      bool
+		wantDeaf      bool
+	}{
+		{name: "defaults", guildSettings: settings.GuildSettings{}, wantMute: false, wantDeaf: true},
+		{name: "muted", guildSettings: settings.GuildSettings{SelfMute: true}, wantMute: true, wantDeaf: true},
+		{name: "undeafened", guildSettings: settings.GuildSettings{Undeafened: true}, wantMute: false, wantDeaf: false},
+		{name: "waiting for silence", guildSettings: settings.GuildSettings{WaitForSilence: true}, wantMute: false, wantDeaf: false},
+		{name: "watching for music bots", guildSettings: settings.GuildSettings{SelfMute: true, MusicBotAction: musicBotDuck}, wantMute: true, wantDeaf: false},
+		{name: "playing over music bots", guildSettings: settings.GuildSettings{MusicBotAction: musicBotPlay}, wantMute: false, wantDeaf: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if mute, deaf, _ := voiceJoinFlags(tt.guildSettings); mute != tt.wantMute || deaf != tt.wantDeaf {
+				t.Errorf("voiceJoinFlags() = mute %v deaf %v, want mute %v deaf %v", mute, deaf, tt.wantMute, tt.wantDeaf)
+			}
+		})
+	}
+}
+
+func TestMemberStingerPicksHighestRole(t *testing.T) {
+	session := &discordgo.Session{State: discordgo.NewState()}
+	if err := session.State.GuildAdd(&discordgo.Guild{ID: "guild", Roles: []*discordgo.Role{
+		{ID: "vip", Position: 5},
+		{ID: "booster", Position: 2},
+		{ID: "regular", Position: 2},
+	}}); err != nil {
+		t.Fatalf("GuildAdd() error = %v", err)
+	}
+
+	stingers := map[string]settings.RoleStinger{
+		"vip":     {Object: "stingers/guild/vip", Mode: stingerInstead},
+		"booster": {Object: "stingers/guild/booster", Mode: stingerAfter},
+		"regular": {Object: "stingers/guild/regular", Mode: stingerBefore},
+	}
+
+	tests := []struct {
+		name    string
+		roleIDs []string
+		want    string
+	}{
+		{name: "no stinger roles", roleIDs: []string{"unrelated"}, want: ""},
+		{name: "highest role wins", roleIDs: []string{"booster", "vip"}, want: "stingers/guild/vip"},
+		{name: "tied roles are told apart by id", roleIDs: []string{"regular", "booster"}, want: "stingers/guild/booster"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stinger, ok := memberStinger(session, "guild", stingers, tt.roleIDs)
+			if ok != (tt.want != "") || stinger.Object != tt.want {
+				t.Errorf("memberStinger() = %q, %v, want %q", stinger.Object, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestClaimFirstJoinOnlyOnce(t *testing.T) {
+	g, _ := newTestGreeter(t)
+	ctx := context.Background()
+	logger := zap.NewNop()
+
+	guildSettings := settings.GuildSettings{GuildID: "guild", FirstJoinMessage: "Welcome {member}!", FirstJoinSince: testNow.Add(-time.Hour)}
+	joined := func(joinedAt time.Time) *discordgo.VoiceStateUpdate {
+		return &discordgo.VoiceStateUpdate{VoiceState: &discordgo.VoiceState{
+			GuildID: "guild",
+			UserID:  testMemberID,
+			Member:  &discordgo.Member{User: &discordgo.User{ID: testMemberID}, JoinedAt: joinedAt},
+		}}
+	}
+
+	if g.claimFirstJoin(ctx, logger, nil, joined(testNow), settings.GuildSettings{GuildID: "guild"}) {
+		t.Errorf("claimFirstJoin() in a guild without welcomes = true, want false")
+	}
+
+	if g.claimFirstJoin(ctx, logger, nil, joined(testNow.Add(-time.Hour*2)), guildSettings) {
+		t.Errorf("claimFirstJoin() for a member from before welcomes were turned on = true, want false")
+	}
+
+	if !g.claimFirstJoin(ctx, logger, nil, joined(testNow), guildSettings) {
+		t.Fatalf("claimFirstJoin() for a new member = false, want true")
+	}
+
+	if g.claimFirstJoin(ctx, logger, nil, joined(testNow), guildSettings) {
+		t.Errorf("claimFirstJoin() for the second join = true, want false")
+	}
+
+	if got, want := firstJoinMessage(guildSettings.FirstJoinMessage, testMemberID), "Welcome <@member>!"; got != want {
+		t.Errorf("firstJoinMessage() = %q, want %q", got, want)
+	}
+}
+
+func TestEventModeEndsOnItsOwn(t *testing.T) {
+	clock := util.NewFakeClock(testNow)
+	g, fake := newTestGreeter(t, WithClock(clock))
+	g.settings = settings.NewStore(fake, g.clock)
+	ctx := context.Background()
+
+	if _, err := g.settings.Create(ctx, "guild", "Guild"); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	if err := g.settings.StartEventMode(ctx, "guild", testNow.Add(time.Hour), "", "party"); err != nil {
+		t.Fatalf("StartEventMode() error = %v", err)
+	}
+
+	interaction := &discordgo.InteractionCreate{Interaction: &discordgo.Interaction{GuildID: "guild"}}
+	if !g.inEventMode(interaction) {
+		t.Fatalf("inEventMode() during the event = false, want true")
+	}
+
+	if err := g.endExpiredEventModes(ctx, nil); err != nil {
+		t.Fatalf("endExpiredEventModes() error = %v", err)
+	}
+
+	if !g.inEventMode(interaction) {
+		t.Errorf("inEventMode() after an early expiry sweep = false, want true")
+	}
+
+	clock.Advance(time.Hour)
+
+	if g.inEventMode(interaction) {
+		t.Errorf("inEventMode() once the event is over = true, want false")
+	}
+
+	if err := g.endExpiredEventModes(ctx, nil); err != nil {
+		t.Fatalf("endExpiredEventModes() error = %v", err)
+	}
+
+	guildSettings := g.guildSettings(ctx, "guild")
+	if !guildSettings.EventModeUntil.IsZero() || guildSettings.EventPack != "party" {
+		t.Errorf("settings after expiry = until %v pack %q, want no end and the pack kept", guildSettings.EventModeUntil, guildSettings.EventPack)
+	}
+}
+
+func TestGuessRoundScoresFirstPicks(t *testing.T) {
+	g, _ := newTestGreeter(t)
+	ctx := context.Background()
+
+	round := &guessRound{id: "round", answerID: testMemberID, options: []string{testMemberID, "other"}, guesses: map[string]string{}}
+	if !g.guessRounds.start("guild", round) {
+		t.Fatalf("start() = false, want true")
+	}
+
+	if g.guessRounds.start("guild", &guessRound{id: "second"}) {
+		t.Errorf("start() while a round is going = true, want false")
+	}
+
+	for _, guess := range []struct {
+		memberID string
+		pick     string
+		accepted bool
+	}{
+		{memberID: testMemberID, pick: testMemberID, accepted: false},
+		{memberID: "right", pick: testMemberID, accepted: true},
+		{memberID: "wrong", pick: "other", accepted: true},
+		{memberID: "wrong", pick: testMemberID, accepted: false},
+		{memberID: "outsider", pick: "stranger", accepted: false},
+	} {
+		if problem := g.guessRounds.guess("guild", "round", guess.memberID, guess.pick); (problem == "") != guess.accepted {
+			t.Errorf("guess(%q, %q) problem = %q, want accepted %v", guess.memberID, guess.pick, problem, guess.accepted)
+		}
+	}
+
+	finished, ok := g.guessRounds.finish("guild", "round")
+	if !ok {
+		t.Fatalf("finish() = false, want true")
+	}
+
+	if _, ok := g.guessRounds.finish("guild", "round"); ok {
+		t.Errorf("second finish() = true, want false")
+	}
+
+	if problem := g.guessRounds.guess("guild", "round", "late", testMemberID); problem == "" {
+		t.Errorf("guess() after the round finished was accepted")
+	}
+
+	winners := finished.winners()
+	if !slices.Equal(winners, []string{"right"}) {
+		t.Fatalf("winners() = %v, want [right]", winners)
+	}
+
+	for _, winnerID := range append(winners, "right", "wrong") {
+		if err := g.recordGuessScore(ctx, "guild", winnerID); err != nil {
+			t.Fatalf("recordGuessScore() error = %v", err)
+		}
+	}
+
+	scores, err := g.guessScores(ctx, "guild")
+	if err != nil {
+		t.Fatalf("guessScores() error = %v", err)
+	}
+
+	want := []embeds.GuessScore{{MemberID: "right", Points: 2}, {MemberID: "wrong", Points: 1}}
+	if !slices.Equal(scores, want) {
+		t.Errorf("guessScores() = %v, want %v", scores, want)
+	}
+}
+
+func TestParseManifest(t *testing.T) {
+	const memberID = "123456789012345678"
+
+	csvManifest := "member_id,url,type\n" +
+		memberID + ",https://cdn.example.com/a.mp3\n" +
+		memberID + ",https://cdn.example.com/b.mp3,outro\n" +
+		"someone,https://cdn.example.com/c.mp3\n" +
+		memberID + ",http://cdn.example.com/d.mp3\n"
+
+	rows, err := parseManifest("intros.csv", []byte(csvManifest), "intro")
+	if err != nil {
+		t.Fatalf("parseManifest() error = %v", err)
+	}
+
+	want := []manifestRow{
+		{row: 1, memberID: memberID, url: "https://cdn.example.com/a.mp3", audioType: "intro"},
+		{row: 2, memberID: memberID, url: "https://cdn.example.com/b.mp3", audioType: "outro"},
+		{row: 3, memberID: "someone", url: "https://cdn.example.com/c.mp3", audioType: "intro", problem: "the member id isn't a discord user id"},
+		{row: 4, memberID: memberID, url: "http://cdn.example.com/d.mp3", audioType: "intro", problem: "the url has to be a https link"},
+	}
+	if !slices.Equal(rows, want) {
+		t.Errorf("parseManifest(csv) = %+v, want %+v", rows, want)
+	}
+
+	jsonManifest := `{"` + memberID + `": ["https://cdn.example.com/a.mp3", "https://cdn.example.com/b.mp3"]}`
+
+	rows, err = parseManifest("intros.json", []byte(jsonManifest), "outro")
+	if err != nil {
+		t.Fatalf("parseManifest() error = %v", err)
+	}
+
+	if len(rows) != 2 || rows[1].url != "https://cdn.example.com/b.mp3" || rows[1].audioType != "outro" || rows[1].problem != "" {
+		t.Errorf("parseManifest(json) = %+v, want two outro rows", rows)
+	}
+
+	if _, err := parseManifest("intros.zip", []byte("PK"), "intro"); !errors.Is(err, errManifestFormat) {
+		t.Errorf("parseManifest(zip) error = %v, want %v", err, errManifestFormat)
+	}
+}
+
+func TestMigrationClips(t *testing.T) {
+	const memberID = "123456789012345678"
+
+	for _, test := range []struct {
+		name string
+		want MigrationClip
+		ok   bool
+	}{
+		{name: memberID + "/hello.mp3", want: MigrationClip{MemberID: memberID, AudioType: "intro", Source: memberID + "/hello.mp3"}, ok: true},
+		{name: "sounds/" + memberID + "/leave/bye.mp3", want: MigrationClip{MemberID: memberID, AudioType: "outro", Source: "sounds/" + memberID + "/leave/bye.mp3"}, ok: true},
+		{name: "Outros/" + memberID + "/bye.m4a", want: MigrationClip{MemberID: memberID, AudioType: "outro", Source: "Outros/" + memberID + "/bye.m4a"}, ok: true},
+		{name: "readme/hello.mp3", ok: false},
+	} {
+		clip, ok := folderZipClip(test.name, "intro")
+		if ok != test.ok || (ok && clip != test.want) {
+			t.Errorf("folderZipClip(%q) = %+v, %v, want %+v, %v", test.name, clip, ok, test.want, test.ok)
+		}
+	}
+
+	export := `{"users": [{"user_id": "` + memberID + `", "join_sound": "https://a.example/join.mp3", "leaveSounds": ["https://a.example/leave.mp3"], "volume": 50}]}`
+
+	clips, err := jsonExportClips([]byte(export), "intro")
+	if err != nil {
+		t.Fatalf("jsonExportClips() error = %v", err)
+	}
+
+	want := []MigrationClip{
+		{MemberID: memberID, AudioType: "intro", Source: "https://a.example/join.mp3"},
+		{MemberID: memberID, AudioType: "outro", Source: "https://a.example/leave.mp3"},
+	}
+	if !slices.Equal(clips, want) {
+		t.Errorf("jsonExportClips() = %+v, want %+v", clips, want)
+	}
+}
+
+func TestArchiveRestore(t *testing.T) {
+	g, fake := newTestGreeter(t)
+	ctx := context.Background()
+
+	fake.PutBlobAt(BucketName, "archive/"+testMemberID+"/older.mp3", []byte("older"), testNow.Add(-time.Hour*48))
+	fake.PutBlobAt(BucketName, "archive/"+testMemberID+"/newer.mp3", []byte("newer"), testNow.Add(-time.Hour))
+
+	tracks, err := g.archivedTracks(ctx, testMemberID)
+	if err != nil {
+		t.Fatalf("archivedTracks() error = %v", err)
+	}
+
+	if len(tracks) != 2 || tracks[0].trackName != "newer.mp3" || tracks[1].trackName != "older.mp3" {
+		t.Fatalf("archivedTracks() = %+v, want newer.mp3 then older.mp3", tracks)
+	}
+
+	if err := g.restoreArchivedTrack(ctx, testMemberID, OutroCollection, testMemberID, tracks[1]); err != nil {
+		t.Fatalf("restoreArchivedTrack() error = %v", err)
+	}
+
+	if contents, ok := fake.Blob(BucketName, voicelines.Object("older.mp3")); !ok || string(contents) != "older" {
+		t.Errorf("restored object = %q, %v, want the archived audio", contents, ok)
+	}
+
+	if _, ok := fake.Blob(BucketName, "archive/"+testMemberID+"/older.mp3"); ok {
+		t.Error("archive object still exists after restoring")
+	}
+
+	restored, err := g.voicelineService.Tracks(ctx, OutroCollection, testMemberID)
+	if err != nil || len(restored) != 1 || restored[0].(map[string]interface{})["track_name"] != "older.mp3" {
+		t.Errorf("Tracks(outro) = %+v, %v, want the restored track", restored, err)
+	}
+
+	tracks, err = g.archivedTracks(ctx, testMemberID)
+	if err != nil || len(tracks) != 1 {
+		t.Errorf("archivedTracks() after restore = %+v, %v, want only newer.mp3", tracks, err)
+	}
+}
+
+func TestStorageQuota(t *testing.T) {
+	g, fake := newTestGreeter(t)
+	g.settings = settings.NewStore(fake, g.clock)
+	ctx := context.Background()
+
+	if err := fake.CreateDocument(ctx, settings.Collection, "guild", map[string]interface{}{"guild_id": "guild", "storage_quota": int64(12), "member_storage_quota": int64(8)}); err != nil {
+		t.Fatalf("CreateDocument() error = %v", err)
+	}
+
+	hello := uploadTestVoiceline(t, g, WelcomeCollection, "hello")
+
+	usage, quota, err := g.storageUsage(ctx, "guild")
+	if err != nil || usage.Bytes != 5 || usage.Members[testMemberID] != 5 || quota != 12 {
+		t.Fatalf("storageUsage() = %+v, %d, %v, want 5 of 12 bytes used by the member", usage, quota, err)
+	}
+
+	// "goodbye" would take the member to 12 bytes, over their 8
+	trackName, err := g.addVoiceline(ctx, "guild", OutroCollection, testMemberID, "uploader", newTestFile(t, "goodbye"))
+	if !errors.Is(err, firebaseAdapter.ErrMemberStorageQuota) {
+		t.Fatalf("addVoiceline() = %q, %v, want %v", trackName, err, firebaseAdapter.ErrMemberStorageQuota)
+	}
+
+	if objects, _ := fake.ListFilesInStorage(ctx, BucketName, "voicelines/"); len(objects) != 1 {
+		t.Errorf("voiceline objects = %v, want only the first upload kept", objects)
+	}
+
+	if err := g.removeVoicelines(ctx, WelcomeCollection, testMemberID, []string{hello}); err != nil {
+		t.Fatalf("removeVoicelines() error = %v", err)
+	}
+
+	if usage, _, err := g.storageUsage(ctx, "guild"); err != nil || usage.Bytes != 0 || len(usage.Members) != 0 {
+		t.Errorf("storageUsage() after deleting = %+v, %v, want nothing used", usage, err)
+	}
+}
+
+func TestUnplayedVoicelines(t *testing.T) {
+	clock := util.NewFakeClock(testNow)
+	g, _ := newTestGreeter(t, WithClock(clock), WithUnplayedMonths(6))
+	ctx := context.Background()
+
+	played := uploadTestVoiceline(t, g, WelcomeCollection, "hello")
+	forgotten := uploadTestVoiceline(t, g, OutroCollection, "goodbye")
+
+	clock.Advance(time.Hour * 24 * 30 * 5)
+	g.recordTrackPlays(ctx, zap.NewNop(), testMemberID, WelcomeCollection, []queuedClip{
+		{memberID: testMemberID, trackName: played, collection: WelcomeCollection},
+		{memberID: testMemberID, trackName: "defaultgreetings/guild/intro", collection: WelcomeCollection},
+	})
+	clock.Advance(time.Hour * 24 * 30 * 2)
+
+	documents, err := g.memberVoicelineDocuments(ctx, testMemberID)
+	if err != nil {
+		t.Fatalf("memberVoicelineDocuments() error = %v", err)
+	}
+
+	unplayed, err := g.unplayedVoicelines(ctx, testMemberID, documents, g.unplayedCutoff())
+	if err != nil {
+		t.Fatalf("unplayedVoicelines() error = %v", err)
+	}
+
+	if len(unplayed) != 1 || unplayed[0].trackName != forgotten || !unplayed[0].lastPlayedAt.IsZero() {
+		t.Fatalf("unplayedVoicelines() = %+v, want only %s which never played", unplayed, forgotten)
+	}
+
+	if due, err := g.unplayedDigestDue(ctx, testMemberID); err != nil || !due {
+		t.Fatalf("unplayedDigestDue() = %v, %v, want true", due, err)
+	}
+
+	if err := g.recordUnplayedDigest(ctx, testMemberID); err != nil {
+		t.Fatalf("recordUnplayedDigest() error = %v", err)
+	}
+
+	if due, err := g.unplayedDigestDue(ctx, testMemberID); err != nil || due {
+		t.Errorf("unplayedDigestDue() right after sending = %v, %v, want false", due, err)
+	}
+}
@@ -0,0 +1,356 @@
+package greeter
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"salutations/internal/embeds"
+	firebaseAdapter "salutations/internal/firebase"
+	"salutations/internal/logging"
+	util "salutations/pkg/util"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	// guessTimeLimit is how long members have to guess once the round is posted, long enough for a short intro to play
+	guessTimeLimit = time.Second * 30
+	// maxGuessOptions is how many members a round has buttons for, the answer among them
+	maxGuessOptions = 4
+	// guessLeaderboardSize is how many members /guess leaderboard shows
+	guessLeaderboardSize = 10
+)
+
+type guessScoreRecord struct {
+	GuildID  string    `firestore:"guild_id"`
+	UserID   string    `firestore:"user_id"`
+	ScoredAt time.Time `firestore:"scored_at"`
+}
+
+// guessRound is a /guess in progress, guesses maps each member who guessed to who they picked.
+type guessRound struct {
+	id       string
+	answerID string
+	options  []string
+	guesses  map[string]string
+}
+
+// guessRounds holds the round going on in each guild, a guild plays one at a time so the clips don't overlap.
+type guessRounds struct {
+	mu     sync.Mutex
+	guilds map[string]*guessRound
+}
+
+func newGuessRounds() *guessRounds {
+	return &guessRounds{guilds: make(map[string]*guessRound)}
+}
+
+// start begins the round, false when the guild already has one going.
+func (r *guessRounds) start(guildID string, round *guessRound) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.guilds[guildID]; ok {
+		return false
+	}
+
+	r.guilds[guildID] = round
+
+	return true
+}
+
+// guess records the member's pick, the returned problem is shown to them when it couldn't be.
+func (r *guessRounds) guess(guildID string, roundID string, memberID string, pick string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	round, ok := r.guilds[guildID]
+	switch {
+	case !ok || round.id != roundID:
+		return "Guessing for that round has closed"
+	case round.answerID == memberID:
+		return "You should know this one, let the others guess"
+	case !slices.Contains(round.options, pick):
+		return "That isn't one of the choices"
+	}
+
+	if _, ok := round.guesses[memberID]; ok {
+		return "You've already guessed, only your first pick counts"
+	}
+
+	round.guesses[memberID] = pick
+
+	return ""
+}
+
+// finish closes the round and hands it over for scoring, false when it already closed.
+func (r *guessRounds) finish(guildID string, roundID string) (*guessRound, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	round, ok := r.guilds[guildID]
+	if !ok || round.id != roundID {
+		return nil, false
+	}
+
+	delete(r.guilds, guildID)
+
+	return round, true
+}
+
+// winners are the members who picked the answer, ordered so results read the same every time.
+func (round *guessRound) winners() []string {
+	winners := []string{}
+	for memberID, pick := range round.guesses {
+		if pick == round.answerID {
+			winners = append(winners, memberID)
+		}
+	}
+
+	slices.Sort(winners)
+
+	return winners
+}
+
+// guessOptions picks the members a round has buttons for, the answer and up to maxGuessOptions-1 others from the
+// channel in a random order.
+func (g *greeterRunner) guessOptions(answerID string, candidates []string) []string {
+	others := slices.DeleteFunc(slices.Clone(candidates), func(memberID string) bool { return memberID == answerID })
+	g.rand.Shuffle(len(others), func(i, j int) { others[i], others[j] = others[j], others[i] })
+
+	options := append([]string{answerID}, others[:min(len(others), maxGuessOptions-1)]...)
+	g.rand.Shuffle(len(options), func(i, j int) { options[i], options[j] = options[j], options[i] })
+
+	return options
+}
+
+// queueHiddenClip plays the clip in the member's channel without saying whose it is, false when the bot couldn't join
+// or is busy in another channel.
+func (g *greeterRunner) queueHiddenClip(ctx context.Context, session *discordgo.Session, logger *zap.Logger, guildID string, channelID string, clip queuedClip) bool {
+	if !g.ensureVoice(ctx, session, logger, guildID, channelID) {
+		return false
+	}
+
+	g.mu.Lock()
+
+	player, ok := g.guildPlayerMappings[guildID]
+	if !ok || player.voiceClient.ChannelID != channelID {
+		g.mu.Unlock()
+		return false
+	}
+
+	clip.hidden = true
+	player.queue = append(player.queue, clip)
+	idle := player.claimPlayback()
+	g.mu.Unlock()
+
+	if idle {
+		g.songSignal <- player
+	}
+
+	return true
+}
+
+func (g *greeterRunner) guessGame(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	subcommand := interaction.ApplicationCommandData().Options[0]
+
+	switch subcommand.Name {
+	case "play":
+		return g.playGuess(session, interaction)
+	case "leaderboard":
+		return g.guessLeaderboard(session, interaction)
+	default:
+		return fmt.Errorf("unknown guess subcommand: %s", subcommand.Name)
+	}
+}
+
+func (g *greeterRunner) followupEmbed(ctx context.Context, session *discordgo.Session, interaction *discordgo.InteractionCreate, embed *discordgo.MessageEmbed) error {
+	_, err := util.SendFollowup(ctx, session, interaction.Interaction, &discordgo.WebhookParams{
+		Embeds: []*discordgo.MessageEmbed{embed},
+	})
+
+	return err
+}
+
+// playGuess plays a random intro of someone in the invoker's voice channel and posts buttons to guess whose it is.
+func (g *greeterRunner) playGuess(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	ctx := context.Background()
+
+	voiceState, err := session.State.VoiceState(interaction.GuildID, interaction.Member.User.ID)
+	if err != nil || voiceState.ChannelID == "" {
+		return g.followupEmbed(ctx, session, interaction, embeds.ErrorMessageEmbed("Join a voice channel to play"))
+	}
+
+	candidates, err := voiceChannelMembers(session, interaction.GuildID, voiceState.ChannelID)
+	if err != nil {
+		return fmt.Errorf("error listing voice channel members: %w", err)
+	}
+
+	if len(candidates) < 2 {
+		return g.followupEmbed(ctx, session, interaction, embeds.ErrorMessageEmbed("Guessing needs at least two people in your voice channel"))
+	}
+
+	answerID, err := g.pickRouletteMember(ctx, candidates)
+	if err != nil {
+		return fmt.Errorf("error picking guess answer: %w", err)
+	}
+
+	if answerID == "" {
+		return g.followupEmbed(ctx, session, interaction, embeds.ErrorMessageEmbed("Nobody in your voice channel has an intro to guess"))
+	}
+
+	vc := &discordgo.VoiceStateUpdate{VoiceState: &discordgo.VoiceState{GuildID: interaction.GuildID, ChannelID: voiceState.ChannelID, UserID: answerID}}
+	logger := logging.WithVoiceState(g.logger, vc).With(zap.String("invoked_by", interaction.Member.User.ID))
+
+	tracks, err := g.retrieveGreeting(ctx, WelcomeCollection, answerID)
+	if err != nil || len(tracks) == 0 {
+		return fmt.Errorf("error retrieving guess answer's intro: %w", err)
+	}
+
+	// Chains would give the answer away with how long they are, only their first clip is played
+	audioPath, err := g.downloadGreetingTrack(ctx, tracks[0], vc)
+	if err != nil {
+		return fmt.Errorf("error downloading guess answer's intro: %w", err)
+	}
+
+	round := &guessRound{id: interaction.ID, answerID: answerID, options: g.guessOptions(answerID, candidates), guesses: map[string]string{}}
+	if !g.guessRounds.start(interaction.GuildID, round) {
+		deleteClips(logger, []queuedClip{{audioPath: audioPath}})
+		return g.followupEmbed(ctx, session, interaction, embeds.ErrorMessageEmbed("There's already a round going, guess that one first"))
+	}
+
+	clip := queuedClip{audioPath: audioPath, memberID: answerID, trackName: tracks[0].name, collection: WelcomeCollection}
+	if !g.queueHiddenClip(ctx, session, logger, interaction.GuildID, voiceState.ChannelID, clip) {
+		g.guessRounds.finish(interaction.GuildID, round.id)
+		deleteClips(logger, []queuedClip{clip})
+
+		return g.followupEmbed(ctx, session, interaction, embeds.ErrorMessageEmbed("I couldn't play in your voice channel, I might be busy in another one"))
+	}
+
+	customIDs := make([]string, 0, len(round.options))
+	labels := make([]string, 0, len(round.options))
+
+	for _, memberID := range round.options {
+		customIDs = append(customIDs, util.CustomID{Action: guessPrefix, GuildID: interaction.GuildID, MemberID: memberID, Nonce: round.id}.Encode())
+
+		label := memberID
+		if member, err := util.ResolveMember(ctx, session, interaction.GuildID, memberID); err == nil {
+			label = member.DisplayName()
+		}
+
+		labels = append(labels, label)
+	}
+
+	message, err := util.SendFollowup(ctx, session, interaction.Interaction, &discordgo.WebhookParams{
+		Embeds:     []*discordgo.MessageEmbed{embeds.GuessEmbed(g.clock.Now().Add(guessTimeLimit))},
+		Components: embeds.GuessButtons(customIDs, labels),
+	})
+	if err != nil {
+		g.guessRounds.finish(interaction.GuildID, round.id)
+		return err
+	}
+
+	logger.Info("guess round started", zap.Strings("options", round.options))
+
+	g.clock.AfterFunc(guessTimeLimit, func() {
+		g.endGuessRound(session, interaction, message.ID, round.id)
+	})
+
+	return nil
+}
+
+// endGuessRound reveals the answer, scores a point for each member who picked it and takes the buttons away.
+func (g *greeterRunner) endGuessRound(session *discordgo.Session, interaction *discordgo.InteractionCreate, messageID string, roundID string) {
+	ctx := context.Background()
+	logger := g.logger.With(zap.String("guild_id", interaction.GuildID))
+
+	round, ok := g.guessRounds.finish(interaction.GuildID, roundID)
+	if !ok {
+		return
+	}
+
+	winners := round.winners()
+	for _, winnerID := range winners {
+		if err := g.recordGuessScore(ctx, interaction.GuildID, winnerID); err != nil {
+			logger.Warn("unable to record guess score", zap.Error(err), zap.String("user_id", winnerID))
+		}
+	}
+
+	_, err := session.FollowupMessageEdit(interaction.Interaction, messageID, &discordgo.WebhookEdit{
+		Embeds:     &[]*discordgo.MessageEmbed{embeds.GuessResultEmbed(round.answerID, winners, len(round.guesses))},
+		Components: &[]discordgo.MessageComponent{},
+	})
+	if err != nil {
+		logger.Warn("unable to reveal guess answer", zap.Error(err))
+	}
+}
+
+func (g *greeterRunner) recordGuessScore(ctx context.Context, guildID string, userID string) error {
+	recordID, err := uuid.NewV7()
+	if err != nil {
+		return fmt.Errorf("error generating guess score id: %w", err)
+	}
+
+	return g.firebaseAdapter.CreateDocument(ctx, GuessScoresCollection, recordID.String(), guessScoreRecord{
+		GuildID:  guildID,
+		UserID:   userID,
+		ScoredAt: g.clock.Now(),
+	})
+}
+
+// guess records a member's pick from a round's buttons.
+func (g *greeterRunner) guess(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	customID, err := util.DecodeCustomID(interaction.MessageComponentData().CustomID)
+	if err != nil || customID.GuildID != interaction.GuildID {
+		return fmt.Errorf("malformed guess custom id: %s", interaction.MessageComponentData().CustomID)
+	}
+
+	if problem := g.guessRounds.guess(interaction.GuildID, customID.Nonce, interaction.Member.User.ID, customID.MemberID); problem != "" {
+		return g.respondEphemeral(session, interaction, embeds.ErrorMessageEmbed(problem))
+	}
+
+	return g.respondEphemeral(session, interaction, embeds.GuessLockedInEmbed(customID.MemberID))
+}
+
+// guessScores adds up the guild's correct guesses per member, the most first.
+func (g *greeterRunner) guessScores(ctx context.Context, guildID string) ([]embeds.GuessScore, error) {
+	documents, err := g.firebaseAdapter.QueryDocuments(ctx, GuessScoresCollection, firebaseAdapter.QueryFilter{Path: "guild_id", Op: "==", Value: guildID})
+	if err != nil {
+		return nil, fmt.Errorf("error querying guess scores: %w", err)
+	}
+
+	points := map[string]int{}
+	for _, document := range documents {
+		if userID, ok := document["user_id"].(string); ok {
+			points[userID]++
+		}
+	}
+
+	scores := make([]embeds.GuessScore, 0, len(points))
+	for memberID, memberPoints := range points {
+		scores = append(scores, embeds.GuessScore{MemberID: memberID, Points: memberPoints})
+	}
+
+	slices.SortFunc(scores, func(a, b embeds.GuessScore) int {
+		return cmp.Or(cmp.Compare(b.Points, a.Points), cmp.Compare(a.MemberID, b.MemberID))
+	})
+
+	return scores, nil
+}
+
+func (g *greeterRunner) guessLeaderboard(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	ctx := context.Background()
+
+	scores, err := g.guessScores(ctx, interaction.GuildID)
+	if err != nil {
+		return err
+	}
+
+	return g.followupEmbed(ctx, session, interaction, embeds.GuessLeaderboardEmbed(scores[:min(len(scores), guessLeaderboardSize)]))
+}
@@ -0,0 +1,216 @@
+package greeter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"salutations/internal/embeds"
+	"salutations/internal/middleware"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// maxNicknameLength is the longest nickname Discord allows
+	maxNicknameLength = 32
+	// maxStatusLength keeps guild statuses short enough to read at a glance in the member list
+	maxStatusLength = 64
+)
+
+func (g *greeterRunner) configureGuild(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	if g.settings == nil {
+		return errors.New("guild settings are not configured")
+	}
+
+	subcommand := interaction.ApplicationCommandData().Options[0]
+
+	var description string
+
+	switch subcommand.Name {
+	case "silence":
+		enabled := subcommand.Options[0].BoolValue()
+		if err := g.settings.SetWaitForSilence(context.Background(), interaction.GuildID, enabled); err != nil {
+			return fmt.Errorf("error updating wait for silence setting: %w", err)
+		}
+
+		description = "Greetings will play right away, even over conversations"
+		if enabled {
+			description = "Greetings will wait for a short pause in conversation before playing"
+		}
+
+		description += ", this takes effect the next time I join a voice channel"
+	case "voice":
+		muted, deafened := subcommand.Options[0].BoolValue(), subcommand.Options[1].BoolValue()
+		if err := g.settings.SetVoiceFlags(context.Background(), interaction.GuildID, muted, !deafened); err != nil {
+			return fmt.Errorf("error updating voice flags: %w", err)
+		}
+
+		guildSettings := g.guildSettings(context.Background(), interaction.GuildID)
+		mute, deaf, listen := voiceJoinFlags(guildSettings)
+
+		description = fmt.Sprintf("I'll join voice channels %s", voiceFlagsText(mute, deaf))
+		if deafened && listen {
+			description += ", I can't deafen while waiting for silence or watching for music bots since both need to hear the channel"
+		}
+
+		description += ", this takes effect the next time I join a voice channel or right away with `/rejoin`"
+	case "musicbots":
+		action := subcommand.Options[0].StringValue()
+		if err := g.settings.SetMusicBotAction(context.Background(), interaction.GuildID, action); err != nil {
+			return fmt.Errorf("error updating music bot setting: %w", err)
+		}
+
+		switch action {
+		case musicBotSkip:
+			description = "Greetings will be skipped while another bot is playing music"
+		case musicBotDelay:
+			description = fmt.Sprintf("Greetings will wait for another bot's music to stop, for up to %d seconds", int(maxMusicBotDelay.Seconds()))
+		case musicBotDuck:
+			description = "Greetings will play quieter while another bot is playing music"
+		default:
+			description = "Greetings will play over other bots' music"
+		}
+
+		description += ", this takes effect the next time I join a voice channel"
+	case "caps":
+		hourly, daily := subcommand.Options[0].IntValue(), subcommand.Options[1].IntValue()
+		if err := g.settings.SetGreetingCaps(context.Background(), interaction.GuildID, hourly, daily); err != nil {
+			return fmt.Errorf("error updating greeting caps: %w", err)
+		}
+
+		description = fmt.Sprintf("Greetings are now capped at %s per voice channel each hour and %s in this server each day", capText(hourly), capText(daily))
+	case "loudness":
+		var limit int64
+		action := loudnessReject
+
+		for _, option := range subcommand.Options {
+			switch option.Name {
+			case "limit":
+				limit = option.IntValue()
+			case "action":
+				action = option.StringValue()
+			}
+		}
+
+		if err := g.settings.SetLoudnessLimit(context.Background(), interaction.GuildID, limit, action); err != nil {
+			return fmt.Errorf("error updating loudness limit: %w", err)
+		}
+
+		switch {
+		case limit == 0:
+			description = "Uploads are no longer checked for loudness"
+		case action == loudnessNormalize:
+			description = fmt.Sprintf("Uploads louder than **%d LUFS** will be turned down before they're stored", limit)
+		default:
+			description = fmt.Sprintf("Uploads louder than **%d LUFS** will be rejected", limit)
+		}
+	case "strict":
+		enabled := subcommand.Options[0].BoolValue()
+		if err := g.settings.SetStrictScreening(context.Background(), interaction.GuildID, enabled); err != nil {
+			return fmt.Errorf("error updating strict screening setting: %w", err)
+		}
+
+		description = "Uploads will no longer be screened"
+		if enabled {
+			description = "Uploads will be screened, objectionable clips are rejected or sent to the mod log for review"
+		}
+	case "modlog":
+		var channelID string
+		if len(subcommand.Options) > 0 {
+			channelID = subcommand.Options[0].ChannelValue(nil).ID
+		}
+
+		if err := g.settings.SetModLogChannel(context.Background(), interaction.GuildID, channelID); err != nil {
+			return fmt.Errorf("error updating mod log channel: %w", err)
+		}
+
+		description = "Voiceline reports will only be kept for review, not posted anywhere"
+		if channelID != "" {
+			description = fmt.Sprintf("Voiceline reports and problems joining voice channels will be posted in <#%s>", channelID)
+		}
+	case "notifications":
+		var channelID string
+		if len(subcommand.Options) > 0 {
+			channelID = subcommand.Options[0].ChannelValue(nil).ID
+		}
+
+		if err := g.settings.SetNotificationChannel(context.Background(), interaction.GuildID, channelID); err != nil {
+			return fmt.Errorf("error updating notification channel: %w", err)
+		}
+
+		description = "I'll stop posting when greetings play"
+		if channelID != "" {
+			description = fmt.Sprintf("I'll post in <#%s> whenever a greeting plays", channelID)
+		}
+	case "nickname":
+		var nickname string
+		if len(subcommand.Options) > 0 {
+			nickname = strings.TrimSpace(subcommand.Options[0].StringValue())
+		}
+
+		if err := session.GuildMemberNickname(interaction.GuildID, "@me", nickname); err != nil {
+			var restErr *discordgo.RESTError
+			if errors.As(err, &restErr) && restErr.Response != nil && restErr.Response.StatusCode == http.StatusForbidden {
+				return g.respondEphemeral(session, interaction, embeds.ErrorMessageEmbed("I need the **Change Nickname** permission to rename myself"))
+			}
+
+			return fmt.Errorf("error changing nickname: %w", err)
+		}
+
+		// Saved so the nickname comes back if I'm removed and added again
+		if err := g.settings.SetNickname(context.Background(), interaction.GuildID, nickname); err != nil {
+			return fmt.Errorf("error updating nickname setting: %w", err)
+		}
+
+		description = "I'll go by my username in this server"
+		if nickname != "" {
+			description = fmt.Sprintf("I'll go by **%s** in this server", nickname)
+		}
+	case "status":
+		// Every server I'm in sees the status, so it's up to the bot's owners rather than any server's admins
+		return middleware.RequireOwner(g.ownerIDs)(g.setGuildStatus)(session, interaction)
+	default:
+		return fmt.Errorf("unknown guildsettings subcommand: %s", subcommand.Name)
+	}
+
+	return g.respondEphemeral(session, interaction, embeds.SettingsUpdatedEmbed(description))
+}
+
+// setGuildStatus is /guildsettings status, adding the guild's status to the rotation or taking it out.
+func (g *greeterRunner) setGuildStatus(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	subcommand := interaction.ApplicationCommandData().Options[0]
+
+	var status string
+	if len(subcommand.Options) > 0 {
+		// Statuses are a single line, whatever was pasted in
+		status = strings.Join(strings.Fields(subcommand.Options[0].StringValue()), " ")
+	}
+
+	// Discord enforces the option's max length too, this keeps anything that gets past it out of the rotation
+	if utf8.RuneCountInString(status) > maxStatusLength {
+		return g.respondEphemeral(session, interaction, embeds.ErrorMessageEmbed(fmt.Sprintf("Statuses can be at most %d characters", maxStatusLength)))
+	}
+
+	if err := g.settings.SetStatus(context.Background(), interaction.GuildID, status); err != nil {
+		return fmt.Errorf("error updating status setting: %w", err)
+	}
+
+	description := "This server's status has been taken out of my rotation"
+	if status != "" {
+		description = fmt.Sprintf("**%s** will be shown in my status rotation, every server I'm in will see it", status)
+	}
+
+	return g.respondEphemeral(session, interaction, embeds.SettingsUpdatedEmbed(description))
+}
+
+func capText(limit int64) string {
+	if limit == 0 {
+		return "**unlimited**"
+	}
+
+	return fmt.Sprintf("**%d**", limit)
+}
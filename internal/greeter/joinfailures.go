@@ -0,0 +1,107 @@
+package greeter
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"salutations/internal/embeds"
+	util "salutations/pkg/util"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+)
+
+// joinFailureCooldown keeps a problem nobody has fixed yet from being posted every time someone joins the channel
+const joinFailureCooldown = time.Hour
+
+// voicePermissions are what the bot needs in a voice channel to greet anyone in it
+var voicePermissions = []struct {
+	name       string
+	permission int64
+}{
+	{"View Channel", discordgo.PermissionViewChannel},
+	{"Connect", discordgo.PermissionVoiceConnect},
+	{"Speak", discordgo.PermissionVoiceSpeak},
+}
+
+// missingVoicePermissions names the voice permissions perms lacks, in the order Discord lists them.
+func missingVoicePermissions(perms int64) []string {
+	missing := []string{}
+	for _, required := range voicePermissions {
+		if perms&required.permission == 0 {
+			missing = append(missing, required.name)
+		}
+	}
+
+	return missing
+}
+
+// joinFailureNotices remembers when each guild was last told about a problem joining a channel.
+type joinFailureNotices struct {
+	mu   sync.Mutex
+	sent map[string]time.Time
+}
+
+func newJoinFailureNotices() *joinFailureNotices {
+	return &joinFailureNotices{sent: make(map[string]time.Time)}
+}
+
+// claim reports whether a notice for key is due and records it as sent if so.
+func (n *joinFailureNotices) claim(key string, now time.Time) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if sentAt, ok := n.sent[key]; ok && now.Sub(sentAt) < joinFailureCooldown {
+		return false
+	}
+
+	n.sent[key] = now
+
+	return true
+}
+
+// channelFull reports whether the channel's user limit keeps the bot out, bots with Move Members can join full channels.
+func channelFull(session *discordgo.Session, guildID string, channelID string, perms int64) bool {
+	if perms&discordgo.PermissionVoiceMoveMembers != 0 {
+		return false
+	}
+
+	channel, err := session.State.Channel(channelID)
+	if err != nil || channel.UserLimit == 0 {
+		return false
+	}
+
+	// Bots take up a slot in the channel like anyone else
+	memberCount, err := util.GetVoiceChannelMemberCount(session, guildID, channelID, true)
+	if err != nil {
+		return false
+	}
+
+	return memberCount >= channel.UserLimit
+}
+
+// announceJoinFailure tells the guild's mod log why the bot couldn't join channelID, at most once per joinFailureCooldown
+// for the same problem. It sends in the background since callers hold g.mu.
+func (g *greeterRunner) announceJoinFailure(session *discordgo.Session, guildID string, channelID string, problem string) {
+	if !g.joinFailures.claim(strings.Join([]string{guildID, channelID, problem}, "/"), g.clock.Now()) {
+		return
+	}
+
+	go func() {
+		modLogChannel := g.guildSettings(context.Background(), guildID).ModLogChannel
+		if modLogChannel == "" {
+			return
+		}
+
+		if _, err := session.ChannelMessageSendEmbed(modLogChannel, embeds.JoinFailureEmbed(channelID, problem)); err != nil {
+			g.logger.Warn("unable to post join failure to mod log", zap.Error(err), zap.String("guild_id", guildID), zap.String("channel_id", modLogChannel))
+		}
+	}()
+}
+
+func missingPermissionsProblem(missing []string) string {
+	return fmt.Sprintf("I'm missing the **%s** permission(s) there", strings.Join(missing, "**, **"))
+}
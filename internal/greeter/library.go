@@ -0,0 +1,325 @@
+package greeter
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"salutations/internal/embeds"
+	firebaseAdapter "salutations/internal/firebase"
+	"salutations/internal/middleware"
+	"salutations/internal/voicelines"
+	util "salutations/pkg/util"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	librarySearchLimit = 5
+	maxLibraryTitle    = 80
+)
+
+var (
+	errLibraryEntryNotFound = errors.New("library entry not found")
+	errNotPublisher         = errors.New("only the publisher can remove a library entry")
+)
+
+// libraryRecord is a clip published to the shared library, the audio is copied to library/<entry id> so it outlives
+// the publisher deleting their own voiceline.
+type libraryRecord struct {
+	Title       string    `firestore:"title"`
+	PublishedBy string    `firestore:"published_by"`
+	PublishedAt time.Time `firestore:"published_at"`
+	Imports     int64     `firestore:"imports"`
+}
+
+type libraryEntry struct {
+	ID     string
+	Record libraryRecord
+}
+
+func libraryObject(entryID string) string {
+	return fmt.Sprintf("library/%s", entryID)
+}
+
+func libraryRecordFrom(data map[string]interface{}) libraryRecord {
+	record := libraryRecord{}
+	record.Title, _ = data["title"].(string)
+	record.PublishedBy, _ = data["published_by"].(string)
+	record.PublishedAt, _ = data["published_at"].(time.Time)
+	record.Imports, _ = data["imports"].(int64)
+
+	return record
+}
+
+// publishToLibrary copies one of the member's own voicelines into the shared library under title.
+func (g *greeterRunner) publishToLibrary(ctx context.Context, collection string, memberID string, trackName string, title string) (string, error) {
+	tracks, err := g.voicelineService.Tracks(ctx, collection, memberID)
+	if err != nil {
+		return "", err
+	}
+
+	if !slices.ContainsFunc(tracks, func(track interface{}) bool {
+		recordMap, ok := track.(map[string]interface{})
+		return ok && recordMap["track_name"] == trackName
+	}) {
+		return "", errTrackNotFound
+	}
+
+	entryID, err := uuid.NewV7()
+	if err != nil {
+		return "", fmt.Errorf("error generating library entry id: %w", err)
+	}
+
+	if err := g.firebaseAdapter.CloneFileFromStorage(ctx, g.bucket, fmt.Sprintf("voicelines/%s", trackName), libraryObject(entryID.String())); err != nil {
+		return "", fmt.Errorf("error copying voiceline into the library: %w", err)
+	}
+
+	err = g.firebaseAdapter.CreateDocument(ctx, LibraryCollection, entryID.String(), libraryRecord{
+		Title:       title,
+		PublishedBy: memberID,
+		PublishedAt: g.clock.Now(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error creating library entry: %w", err)
+	}
+
+	return entryID.String(), nil
+}
+
+// searchLibrary matches query against entry titles, most imported first. Firestore has no text search so the
+// library is filtered in memory, which is fine at the size it's expected to grow to.
+func (g *greeterRunner) searchLibrary(ctx context.Context, query string) ([]libraryEntry, error) {
+	documents, err := g.firebaseAdapter.GetDocumentsFromCollection(ctx, LibraryCollection)
+	if err != nil {
+		return nil, fmt.Errorf("error getting library entries: %w", err)
+	}
+
+	query = strings.ToLower(query)
+	entries := []libraryEntry{}
+
+	for entryID, data := range documents {
+		record := libraryRecordFrom(data)
+		if strings.Contains(strings.ToLower(record.Title), query) {
+			entries = append(entries, libraryEntry{ID: entryID, Record: record})
+		}
+	}
+
+	slices.SortFunc(entries, func(a, b libraryEntry) int {
+		return cmp.Or(cmp.Compare(b.Record.Imports, a.Record.Imports), b.Record.PublishedAt.Compare(a.Record.PublishedAt))
+	})
+
+	return entries[:min(len(entries), librarySearchLimit)], nil
+}
+
+func (g *greeterRunner) getLibraryEntry(ctx context.Context, entryID string) (libraryRecord, error) {
+	data, err := g.firebaseAdapter.GetDocumentFromCollection(ctx, LibraryCollection, entryID)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return libraryRecord{}, errLibraryEntryNotFound
+		}
+
+		return libraryRecord{}, fmt.Errorf("error getting library entry: %w", err)
+	}
+
+	return libraryRecordFrom(data), nil
+}
+
+// importFromLibrary copies a library clip into the member's own voicelines, returning the new track name.
+func (g *greeterRunner) importFromLibrary(ctx context.Context, entryID string, collection string, memberID string) (string, error) {
+	record, err := g.getLibraryEntry(ctx, entryID)
+	if err != nil {
+		return "", err
+	}
+
+	trackID, err := uuid.NewV7()
+	if err != nil {
+		return "", fmt.Errorf("error generating track name: %w", err)
+	}
+
+	trackName := trackID.String()
+	if err := g.firebaseAdapter.CloneFileFromStorage(ctx, g.bucket, libraryObject(entryID), fmt.Sprintf("voicelines/%s", trackName)); err != nil {
+		return "", fmt.Errorf("error copying library clip: %w", err)
+	}
+
+	if err := g.voicelineService.EnsureDocument(ctx, collection, memberID); err != nil {
+		return "", err
+	}
+
+	if err := g.voicelineService.AppendTrack(ctx, collection, memberID, record.PublishedBy, trackName); err != nil {
+		return "", err
+	}
+
+	// The import count only orders search results so a lost update under concurrent imports doesn't matter
+	if err := g.firebaseAdapter.UpdateDocument(ctx, LibraryCollection, entryID, map[string]interface{}{"imports": record.Imports + 1}); err != nil {
+		g.logger.Warn("unable to count library import", zap.Error(err), zap.String("entry_id", entryID))
+	}
+
+	return trackName, nil
+}
+
+// unpublishFromLibrary removes the entry, voicelines already imported from it are kept.
+func (g *greeterRunner) unpublishFromLibrary(ctx context.Context, entryID string, memberID string) error {
+	record, err := g.getLibraryEntry(ctx, entryID)
+	if err != nil {
+		return err
+	}
+
+	if record.PublishedBy != memberID {
+		return errNotPublisher
+	}
+
+	if err := g.firebaseAdapter.DeleteDocument(ctx, LibraryCollection, entryID); err != nil {
+		return fmt.Errorf("error deleting library entry: %w", err)
+	}
+
+	if err := g.firebaseAdapter.DeleteFileFromStorage(ctx, g.bucket, libraryObject(entryID)); err != nil && status.Code(err) != codes.NotFound {
+		return fmt.Errorf("error deleting library clip: %w", err)
+	}
+
+	return nil
+}
+
+func (g *greeterRunner) library(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	ctx := context.Background()
+	memberID := interaction.Member.User.ID
+
+	subcommand := interaction.ApplicationCommandData().Options[0]
+	options := map[string]*discordgo.ApplicationCommandInteractionDataOption{}
+	for _, option := range subcommand.Options {
+		options[option.Name] = option
+	}
+
+	switch subcommand.Name {
+	case "publish":
+		collection, _ := voicelines.CollectionFor(options["type"].StringValue())
+		title := options["title"].StringValue()
+
+		if _, err := g.publishToLibrary(ctx, collection, memberID, options["track"].StringValue(), title); err != nil {
+			if errors.Is(err, errTrackNotFound) || status.Code(err) == codes.NotFound {
+				return g.respondEphemeral(session, interaction, embeds.ErrorMessageEmbed("That voiceline couldn't be found, pick one from the list"))
+			}
+
+			return fmt.Errorf("error publishing to library: %w", err)
+		}
+
+		return g.respondEphemeral(session, interaction, embeds.LibraryUpdatedEmbed(fmt.Sprintf("Published **%s** to the library for everyone to use", title)))
+	case "search":
+		query := ""
+		if option, ok := options["query"]; ok {
+			query = option.StringValue()
+		}
+
+		entries, err := g.searchLibrary(ctx, query)
+		if err != nil {
+			return err
+		}
+
+		results := make([]embeds.LibraryResult, 0, len(entries))
+		introIDs, outroIDs, reportIDs := []string{}, []string{}, []string{}
+
+		objectNames := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			objectNames = append(objectNames, libraryObject(entry.ID))
+		}
+
+		signedURLs, err := g.firebaseAdapter.GenerateSignedURLs(ctx, g.bucket, objectNames)
+		if err != nil {
+			return fmt.Errorf("error generating signed urls for library entries: %w", err)
+		}
+
+		for i, entry := range entries {
+			results = append(results, embeds.LibraryResult{Title: entry.Record.Title, PublisherID: entry.Record.PublishedBy, Imports: entry.Record.Imports, URL: signedURLs[i]})
+			introIDs = append(introIDs, util.CustomID{Action: libraryImportPrefix, Collection: WelcomeCollection, Args: []string{entry.ID}}.Encode())
+			outroIDs = append(outroIDs, util.CustomID{Action: libraryImportPrefix, Collection: OutroCollection, Args: []string{entry.ID}}.Encode())
+			reportIDs = append(reportIDs, util.CustomID{Action: reportPrefix, MemberID: entry.Record.PublishedBy, Collection: LibraryCollection, Args: []string{entry.ID}}.Encode())
+		}
+
+		_, err = middleware.Respond(session, interaction, &discordgo.InteractionResponseData{
+			Embeds:     []*discordgo.MessageEmbed{embeds.LibrarySearchEmbed(query, results)},
+			Components: embeds.LibraryResultComponents(introIDs, outroIDs, reportIDs),
+			Flags:      discordgo.MessageFlagsEphemeral,
+		})
+
+		return err
+	case "unpublish":
+		if err := g.unpublishFromLibrary(ctx, options["entry"].StringValue(), memberID); err != nil {
+			switch {
+			case errors.Is(err, errLibraryEntryNotFound):
+				return g.respondEphemeral(session, interaction, embeds.ErrorMessageEmbed("That library entry couldn't be found, pick one from the list"))
+			case errors.Is(err, errNotPublisher):
+				return g.respondEphemeral(session, interaction, embeds.ErrorMessageEmbed("You can only remove clips you published"))
+			}
+
+			return fmt.Errorf("error removing library entry: %w", err)
+		}
+
+		return g.respondEphemeral(session, interaction, embeds.LibraryUpdatedEmbed("Removed that clip from the library, anyone who imported it keeps their copy"))
+	default:
+		return fmt.Errorf("unknown library subcommand: %s", subcommand.Name)
+	}
+}
+
+// libraryImport handles the import buttons under search results.
+func (g *greeterRunner) libraryImport(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	customID, err := util.DecodeCustomID(interaction.MessageComponentData().CustomID)
+	if err != nil || len(customID.Args) != 1 {
+		return fmt.Errorf("malformed library import custom id: %s", interaction.MessageComponentData().CustomID)
+	}
+
+	entryID, collection := customID.Args[0], customID.Collection
+	audioType := voicelines.AudioTypeFor(collection)
+
+	if _, err := g.importFromLibrary(context.Background(), entryID, collection, interaction.Member.User.ID); err != nil {
+		if errors.Is(err, errLibraryEntryNotFound) || status.Code(err) == codes.NotFound {
+			return g.respondEphemeral(session, interaction, embeds.ErrorMessageEmbed("That clip has been removed from the library"))
+		}
+
+		return fmt.Errorf("error importing from library: %w", err)
+	}
+
+	return g.respondEphemeral(session, interaction, embeds.MyVoicelinesUpdatedEmbed(fmt.Sprintf("Added that clip to your %ss", audioType)))
+}
+
+// libraryAutocomplete completes the member's own voicelines when publishing and their published entries when removing one.
+func (g *greeterRunner) libraryAutocomplete(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	subcommand := interaction.ApplicationCommandData().Options[0]
+	if subcommand.Name != "unpublish" {
+		return g.myVoicelinesAutocomplete(session, interaction)
+	}
+
+	focused := ""
+	for _, option := range subcommand.Options {
+		if option.Focused {
+			focused = option.StringValue()
+		}
+	}
+
+	documents, err := g.firebaseAdapter.QueryDocuments(context.Background(), LibraryCollection, firebaseAdapter.QueryFilter{Path: "published_by", Op: "==", Value: interaction.Member.User.ID})
+	if err != nil {
+		return fmt.Errorf("error getting published library entries: %w", err)
+	}
+
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	for entryID, data := range documents {
+		title := libraryRecordFrom(data).Title
+		if len(choices) == 25 || !strings.Contains(strings.ToLower(title), strings.ToLower(focused)) {
+			continue
+		}
+
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: title, Value: entryID})
+	}
+
+	return session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{Choices: choices},
+	})
+}
@@ -0,0 +1,78 @@
+package greeter
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	util "salutations/pkg/util"
+
+	"go.uber.org/zap"
+)
+
+const (
+	loudnessReject    = "reject"
+	loudnessNormalize = "normalize"
+	// normalizedLoudness is what clips over a guild's limit are brought down to, about where speech sits in a voice channel
+	normalizedLoudness = -16.0
+	// minLoudnessLimit keeps guilds from setting a limit ordinary speech would trip
+	minLoudnessLimit = -30
+)
+
+type loudnessCheck struct {
+	// file is what should be uploaded, a normalized copy the caller has to delete when normalized is set
+	file       *os.File
+	normalized bool
+	rejected   bool
+	loudness   util.Loudness
+}
+
+// enforceLoudness holds uploads to the guild's loudness limit, rejecting or normalizing clips over it.
+// Clips that can't be measured are let through rather than blocking uploads on ffmpeg.
+func (g *greeterRunner) enforceLoudness(ctx context.Context, guildID string, file *os.File) (loudnessCheck, error) {
+	guildSettings := g.guildSettings(ctx, guildID)
+	if guildSettings.MaxLoudness == 0 {
+		return loudnessCheck{file: file}, nil
+	}
+
+	loudness, err := util.MeasureLoudness(ctx, file.Name())
+	if err != nil {
+		g.logger.Warn("unable to measure upload loudness", zap.Error(err), zap.String("guild_id", guildID))
+		return loudnessCheck{file: file}, nil
+	}
+
+	check := loudnessCheck{file: file, loudness: loudness}
+	if loudness.Integrated <= float64(guildSettings.MaxLoudness) {
+		return check, nil
+	}
+
+	if guildSettings.LoudnessAction != loudnessNormalize {
+		check.rejected = true
+		return check, nil
+	}
+
+	normalized, err := util.NormalizeLoudness(ctx, file.Name(), normalizedLoudness)
+	if err != nil {
+		return loudnessCheck{}, fmt.Errorf("error normalizing loud upload: %w", err)
+	}
+
+	check.file = normalized
+	check.normalized = true
+
+	return check, nil
+}
+
+// cleanup deletes the normalized copy, if one was made.
+func (c loudnessCheck) cleanup(logger *zap.Logger) {
+	if !c.normalized {
+		return
+	}
+
+	if err := util.DeleteFile(c.file.Name()); err != nil {
+		logger.Warn("error trying to delete file", zap.Error(err), zap.String("file_name", c.file.Name()))
+	}
+}
+
+func tooLoudText(loudness util.Loudness) string {
+	return fmt.Sprintf("That clip is too loud for this server (%.1f LUFS), try turning it down before uploading", loudness.Integrated)
+}
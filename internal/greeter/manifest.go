@@ -0,0 +1,412 @@
+package greeter
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"salutations/internal/embeds"
+	"salutations/internal/voicelines"
+	util "salutations/pkg/util"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxManifestBytes keeps the manifest itself to a size that's reasonable to hold in memory
+	maxManifestBytes = 256 << 10
+	// maxManifestRows bounds how long one import runs, larger migrations can be split across manifests
+	maxManifestRows = 100
+)
+
+var errManifestFormat = errors.New("manifest isn't a json or csv file")
+
+// manifestRow is one voiceline a manifest asks for, problem is why it can't be imported when that's clear before
+// anything is downloaded.
+type manifestRow struct {
+	row       int
+	memberID  string
+	url       string
+	audioType string
+	problem   string
+}
+
+type manifestEntry struct {
+	MemberID string `json:"member_id"`
+	URL      string `json:"url"`
+	Type     string `json:"type"`
+}
+
+// parseManifest reads a manifest of voicelines to import. JSON manifests are either a list of
+// {"member_id", "url", "type"} objects or an object mapping member ids to a url or a list of urls, CSV manifests have
+// member_id,url[,type] rows with an optional header. Rows without a type are imported as audioType.
+func parseManifest(name string, data []byte, audioType string) ([]manifestRow, error) {
+	var entries []manifestEntry
+	var err error
+
+	trimmed := bytes.TrimSpace(data)
+
+	switch ext := strings.ToLower(path.Ext(name)); {
+	case ext == ".json" || (ext != ".csv" && len(trimmed) > 0 && (trimmed[0] == '[' || trimmed[0] == '{')):
+		entries, err = parseJSONManifest(trimmed)
+	case ext == ".csv" || ext == ".txt" || ext == "":
+		entries, err = parseCSVManifest(trimmed)
+	default:
+		return nil, errManifestFormat
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entries) == 0 {
+		return nil, errors.New("manifest doesn't have any rows")
+	}
+
+	if len(entries) > maxManifestRows {
+		return nil, fmt.Errorf("manifest has %d rows, at most %d can be imported at once", len(entries), maxManifestRows)
+	}
+
+	rows := make([]manifestRow, 0, len(entries))
+	for i, entry := range entries {
+		row := manifestRow{row: i + 1, memberID: strings.TrimSpace(entry.MemberID), url: strings.TrimSpace(entry.URL), audioType: strings.ToLower(strings.TrimSpace(entry.Type))}
+		if row.audioType == "" {
+			row.audioType = audioType
+		}
+
+		row.problem = manifestRowProblem(row)
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+func parseJSONManifest(data []byte) ([]manifestEntry, error) {
+	var entries []manifestEntry
+	if data[0] == '[' {
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, fmt.Errorf("manifest rows should have a member_id, url and type: %w", err)
+		}
+
+		return entries, nil
+	}
+
+	var byMember map[string]json.RawMessage
+	if err := json.Unmarshal(data, &byMember); err != nil {
+		return nil, fmt.Errorf("manifest isn't valid json: %w", err)
+	}
+
+	// Maps have no order of their own, sorting keeps row numbers the same between imports of the same manifest
+	memberIDs := make([]string, 0, len(byMember))
+	for memberID := range byMember {
+		memberIDs = append(memberIDs, memberID)
+	}
+
+	slices.Sort(memberIDs)
+
+	for _, memberID := range memberIDs {
+		var urls []string
+		if err := json.Unmarshal(byMember[memberID], &urls); err != nil {
+			var single string
+			if err := json.Unmarshal(byMember[memberID], &single); err != nil {
+				return nil, fmt.Errorf("member %s should map to a url or a list of urls", memberID)
+			}
+
+			urls = []string{single}
+		}
+
+		for _, url := range urls {
+			entries = append(entries, manifestEntry{MemberID: memberID, URL: url})
+		}
+	}
+
+	return entries, nil
+}
+
+func parseCSVManifest(data []byte) ([]manifestEntry, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("manifest isn't valid csv: %w", err)
+	}
+
+	if len(records) > 0 && strings.EqualFold(strings.TrimSpace(records[0][0]), "member_id") {
+		records = records[1:]
+	}
+
+	entries := make([]manifestEntry, 0, len(records))
+	for _, record := range records {
+		entry := manifestEntry{MemberID: record[0]}
+		if len(record) > 1 {
+			entry.URL = record[1]
+		}
+
+		if len(record) > 2 {
+			entry.Type = record[2]
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// manifestRowProblem explains what's wrong with a row as written, empty when it's worth downloading.
+func manifestRowProblem(row manifestRow) string {
+	if !isSnowflake(row.memberID) {
+		return "the member id isn't a discord user id"
+	}
+
+	if row.audioType != "intro" && row.audioType != "outro" {
+		return "the type has to be intro or outro"
+	}
+
+	parsed, err := url.Parse(row.url)
+	if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+		return "the url has to be a https link"
+	}
+
+	return ""
+}
+
+// manifestOutcome is what became of a row, problem is set for rows that weren't imported.
+type manifestOutcome struct {
+	row     manifestRow
+	request UploadRequest
+	result  UploadResult
+	problem string
+}
+
+// status is the outcome as the report's status column words it.
+func (o manifestOutcome) status() string {
+	switch {
+	case len(o.result.Created) > 0:
+		return "imported"
+	case len(o.result.Rejected) > 0:
+		return "rejected"
+	default:
+		return "skipped"
+	}
+}
+
+// downloadProblem words why a row's url couldn't be downloaded for the report.
+func downloadProblem(err error) string {
+	var statusErr *util.HTTPStatusError
+
+	switch {
+	case errors.Is(err, util.ErrResponseTooLarge):
+		return fmt.Sprintf("the file is larger than %d MB", zipUploadLimits.MaxFileBytes>>20)
+	case errors.Is(err, util.ErrNonPublicAddress):
+		return "the url doesn't point to the public internet"
+	case errors.As(err, &statusErr):
+		return "the url answered with " + statusErr.Status
+	default:
+		return "the file couldn't be downloaded"
+	}
+}
+
+// importManifestRow downloads and uploads one row of a manifest. Anything wrong with the row is reported as its
+// problem, only failing to store a clip that was fine is an error.
+func (g *greeterRunner) importManifestRow(ctx context.Context, session *discordgo.Session, dir string, guildID string, addedBy string, row manifestRow) (manifestOutcome, error) {
+	outcome := manifestOutcome{row: row}
+	if row.problem != "" {
+		outcome.problem = row.problem
+		return outcome, nil
+	}
+
+	member, err := util.ResolveMember(ctx, session, guildID, row.memberID)
+	if err != nil {
+		outcome.problem = "the member isn't in this server"
+		return outcome, nil
+	}
+
+	if member.User.Bot {
+		outcome.problem = "bots can't have voicelines"
+		return outcome, nil
+	}
+
+	collection, _ := voicelines.CollectionFor(row.audioType)
+	outcome.request = UploadRequest{GuildID: guildID, Collection: collection, MemberID: row.memberID, AddedBy: addedBy}
+
+	downloadCtx, cancel := context.WithTimeout(ctx, attachmentDownloadTimeout)
+	defer cancel()
+
+	var file *os.File
+
+	err = util.Retry(downloadCtx, attachmentRetryPolicy, func(ctx context.Context) (err error) {
+		file, err = util.DownloadLimitedURL(ctx, g.externalClient, dir, row.url, zipUploadLimits.MaxFileBytes)
+		return err
+	})
+	if err != nil {
+		g.logger.Info("unable to download manifest row", zap.Error(err), zap.Int("row", row.row), zap.String("url", row.url))
+		outcome.problem = downloadProblem(err)
+
+		return outcome, nil
+	}
+
+	defer file.Close()
+
+	head := make([]byte, 16)
+	n, _ := io.ReadFull(file, head)
+	if util.DetectAudioFormat(head[:n]) == util.AudioFormatUnknown {
+		outcome.problem = "the url isn't an mp3 or m4a file"
+		return outcome, nil
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return outcome, err
+	}
+
+	result, err := g.UploadVoiceline(ctx, dir, outcome.request, file)
+	if err != nil {
+		return outcome, err
+	}
+
+	outcome.result = result
+	for _, rejection := range result.Rejected {
+		outcome.problem = rejection.Reason
+	}
+
+	return outcome, nil
+}
+
+// manifestReport is a csv with the outcome of every row of an import.
+func manifestReport(outcomes []manifestOutcome) []byte {
+	var report bytes.Buffer
+
+	writer := csv.NewWriter(&report)
+	_ = writer.Write([]string{"row", "member_id", "url", "type", "status", "detail"})
+
+	for _, outcome := range outcomes {
+		detail := outcome.problem
+		if len(outcome.result.Created) > 0 {
+			detail = outcome.result.Created[0].TrackName
+		}
+
+		_ = writer.Write([]string{strconv.Itoa(outcome.row.row), outcome.row.memberID, outcome.row.url, outcome.row.audioType, outcome.status(), detail})
+	}
+
+	writer.Flush()
+
+	return report.Bytes()
+}
+
+// uploadManifest bulk imports the voicelines a manifest lists, rows that can't be imported don't stop the others and
+// the invoker gets a report of every row.
+func (g *greeterRunner) uploadManifest(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	ctx := context.Background()
+
+	data := interaction.ApplicationCommandData()
+
+	var attachment *discordgo.MessageAttachment
+
+	audioType := "intro"
+
+	for _, option := range data.Options {
+		switch option.Name {
+		case "manifest":
+			if data.Resolved != nil {
+				attachment = data.Resolved.Attachments[option.Value.(string)]
+			}
+		case "type":
+			audioType = option.StringValue()
+		}
+	}
+
+	if attachment == nil {
+		return fmt.Errorf("manifest attachment was not resolved")
+	}
+
+	if attachment.Size > maxManifestBytes {
+		_, err := util.SendFollowup(ctx, session, interaction.Interaction, &discordgo.WebhookParams{
+			Embeds: []*discordgo.MessageEmbed{embeds.ErrorMessageEmbed(fmt.Sprintf("Manifests can be at most %d KB", maxManifestBytes>>10))},
+		})
+
+		return err
+	}
+
+	workspace, err := util.NewWorkspace("manifest-")
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := workspace.Close(); err != nil {
+			g.logger.Warn("error trying to delete manifest workspace", zap.Error(err), zap.String("directory", workspace.Dir()))
+		}
+	}()
+
+	file, err := g.downloadAttachment(ctx, workspace.Dir(), attachment.URL)
+	if err != nil {
+		return fmt.Errorf("error downloading manifest: %w", err)
+	}
+
+	defer file.Close()
+
+	manifest, err := io.ReadAll(io.LimitReader(file, maxManifestBytes))
+	if err != nil {
+		return fmt.Errorf("error reading manifest: %w", err)
+	}
+
+	rows, err := parseManifest(attachment.Filename, manifest, audioType)
+	if err != nil {
+		_, err := util.SendFollowup(ctx, session, interaction.Interaction, &discordgo.WebhookParams{
+			Embeds: []*discordgo.MessageEmbed{embeds.ErrorMessageEmbed(fmt.Sprintf("I couldn't read that manifest, %v", err))},
+		})
+
+		return err
+	}
+
+	pool := util.NewPool[manifestOutcome](ctx, g.uploadConcurrency)
+	for _, row := range rows {
+		pool.Submit(func(ctx context.Context) (manifestOutcome, error) {
+			return g.importManifestRow(ctx, session, workspace.Dir(), interaction.GuildID, interaction.Member.User.ID, row)
+		})
+	}
+
+	outcomes := make([]manifestOutcome, 0, len(rows))
+	problems := []embeds.ManifestProblem{}
+	imported := 0
+
+	for i, result := range pool.Wait() {
+		outcome := result.Value
+		outcome.row = rows[i]
+
+		if result.Err != nil {
+			g.logger.Error("error importing manifest row", zap.Error(result.Err), zap.Int("row", rows[i].row), zap.String("user_id", rows[i].memberID))
+			outcome.problem = "the clip couldn't be stored, try importing it again"
+		}
+
+		if len(outcome.result.Created) > 0 {
+			imported++
+			g.flagUploads(ctx, session, outcome.request, outcome.result)
+		} else {
+			problems = append(problems, embeds.ManifestProblem{Row: outcome.row.row, Reason: outcome.problem})
+		}
+
+		outcomes = append(outcomes, outcome)
+	}
+
+	g.logger.Info("manifest imported", zap.String("guild_id", interaction.GuildID), zap.String("invoked_by", interaction.Member.User.ID), zap.Int("rows", len(rows)), zap.Int("imported", imported))
+
+	_, err = util.SendFollowup(ctx, session, interaction.Interaction, &discordgo.WebhookParams{
+		Embeds: []*discordgo.MessageEmbed{embeds.ManifestImportEmbed(imported, len(rows), problems)},
+		Files:  []*discordgo.File{{Name: "manifest-report.csv", ContentType: "text/csv", Reader: bytes.NewReader(manifestReport(outcomes))}},
+	})
+
+	return err
+}
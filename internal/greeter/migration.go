@@ -0,0 +1,391 @@
+package greeter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"salutations/internal/screening"
+	"salutations/internal/voicelines"
+	util "salutations/pkg/util"
+)
+
+// MigrationFormat is a layout another greeter bot's sounds can be imported from.
+type MigrationFormat string
+
+const (
+	// FolderZipMigration is a zip with a folder per member named by their id. Clips in an intro or outro folder (join,
+	// leave, welcome and bye work too) anywhere in their path are imported as that type, any others as the default type
+	FolderZipMigration MigrationFormat = "folder-zip"
+	// JSONExportMigration is a JSON export listing each member's sound urls, see jsonExportClips for the shapes read
+	JSONExportMigration MigrationFormat = "json"
+)
+
+// migrationZipLimits are looser than an upload's since a migration brings over a whole server's sounds at once
+var migrationZipLimits = util.UnzipLimits{
+	MaxEntries:    5000,
+	MaxFileBytes:  zipUploadLimits.MaxFileBytes,
+	MaxTotalBytes: 2 << 30,
+	MaxDepth:      4,
+	Extensions:    zipUploadLimits.Extensions,
+}
+
+var (
+	errNoMemberFolder = errors.New("not in a folder named by a member id")
+	errNotHTTPS       = errors.New("not a https url")
+)
+
+// MigrationRequest is an export to import and how. Screening and loudness limits of GuildID apply to the clips as
+// they would to an upload there.
+type MigrationRequest struct {
+	GuildID string
+	AddedBy string
+	Format  MigrationFormat
+	// Path is the export on disk
+	Path string
+	// DefaultType is intro or outro, what clips the export doesn't say the type of are imported as
+	DefaultType string
+	// DryRun finds the clips without importing any
+	DryRun bool
+}
+
+// MigrationClip is a clip found in an export, Source is its path in the zip or its url.
+type MigrationClip struct {
+	MemberID  string
+	AudioType string
+	Source    string
+	// TrackName is what the clip was stored as, empty until it's imported
+	TrackName string
+}
+
+// MigrationResult is what an import found and what became of it. Skipped are the sources that weren't imported and
+// why, Failed the ones that couldn't be stored.
+type MigrationResult struct {
+	Found    []MigrationClip
+	Imported []MigrationClip
+	Skipped  []util.EntryError
+	Failed   []voicelines.TrackFailure
+	Flagged  map[string]string
+}
+
+// migrationTask stores one clip of an export for the member the request is for.
+type migrationTask struct {
+	clip   MigrationClip
+	upload func(ctx context.Context, request UploadRequest) (UploadResult, error)
+}
+
+func isSnowflake(id string) bool {
+	_, err := strconv.ParseUint(id, 10, 64)
+	return err == nil && len(id) >= 17
+}
+
+// migrationAudioType is the audio type a folder or field name stands for, empty when it doesn't name one.
+func migrationAudioType(name string) string {
+	normalized := strings.NewReplacer("_", "", "-", "", " ", "").Replace(strings.ToLower(name))
+
+	switch normalized {
+	case "intro", "intros", "join", "joins", "joinsound", "joinsounds", "welcome", "entrance", "entrancesound":
+		return "intro"
+	case "outro", "outros", "leave", "leaves", "leavesound", "leavesounds", "bye", "goodbye", "exit", "exitsound":
+		return "outro"
+	default:
+		return ""
+	}
+}
+
+// folderZipClip maps a zip entry to the member and type its folders say it's for, false when no folder is named by a
+// member id.
+func folderZipClip(name string, defaultType string) (MigrationClip, bool) {
+	clip := MigrationClip{AudioType: defaultType, Source: name}
+
+	for _, folder := range strings.Split(path.Dir(path.Clean(name)), "/") {
+		if isSnowflake(folder) {
+			clip.MemberID = folder
+		} else if audioType := migrationAudioType(folder); audioType != "" {
+			clip.AudioType = audioType
+		}
+	}
+
+	return clip, clip.MemberID != ""
+}
+
+// jsonExportClips reads the clips of a JSON export. Members are either an object keyed by member id or a list of
+// objects with a user_id, member_id or id, optionally wrapped in a top level users, members or sounds key. Each
+// member maps to a url or a list of urls of the default type, or to an object whose join, leave, intro, outro (and
+// similarly named) fields hold them.
+func jsonExportClips(data []byte, defaultType string) ([]MigrationClip, error) {
+	var root interface{}
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("export isn't valid json: %w", err)
+	}
+
+	if wrapper, ok := root.(map[string]interface{}); ok {
+		for _, key := range []string{"users", "members", "sounds"} {
+			if inner, ok := wrapper[key]; ok {
+				root = inner
+				break
+			}
+		}
+	}
+
+	clips := []MigrationClip{}
+
+	switch members := root.(type) {
+	case []interface{}:
+		for _, member := range members {
+			fields, ok := member.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			for _, key := range []string{"user_id", "userId", "member_id", "memberId", "id"} {
+				if memberID, ok := fields[key].(string); ok && isSnowflake(memberID) {
+					clips = append(clips, memberExportClips(memberID, fields, defaultType)...)
+					break
+				}
+			}
+		}
+	case map[string]interface{}:
+		// Maps have no order of their own, sorting keeps imports of the same export the same
+		memberIDs := make([]string, 0, len(members))
+		for memberID := range members {
+			if isSnowflake(memberID) {
+				memberIDs = append(memberIDs, memberID)
+			}
+		}
+
+		slices.Sort(memberIDs)
+
+		for _, memberID := range memberIDs {
+			if fields, ok := members[memberID].(map[string]interface{}); ok {
+				clips = append(clips, memberExportClips(memberID, fields, defaultType)...)
+				continue
+			}
+
+			for _, source := range exportURLs(members[memberID]) {
+				clips = append(clips, MigrationClip{MemberID: memberID, AudioType: defaultType, Source: source})
+			}
+		}
+	default:
+		return nil, errors.New("export should be an object or a list of members")
+	}
+
+	return clips, nil
+}
+
+// memberExportClips are the clips of one member's entry in a JSON export, fields named sound or url hold clips of the
+// default type.
+func memberExportClips(memberID string, fields map[string]interface{}, defaultType string) []MigrationClip {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+
+	clips := []MigrationClip{}
+
+	for _, key := range keys {
+		audioType := migrationAudioType(key)
+		if audioType == "" {
+			switch strings.ToLower(key) {
+			case "sound", "sounds", "url", "urls":
+				audioType = defaultType
+			default:
+				continue
+			}
+		}
+
+		for _, source := range exportURLs(fields[key]) {
+			clips = append(clips, MigrationClip{MemberID: memberID, AudioType: audioType, Source: source})
+		}
+	}
+
+	return clips
+}
+
+// exportURLs reads a url, a list of urls or a list of objects with a url field.
+func exportURLs(value interface{}) []string {
+	switch typed := value.(type) {
+	case string:
+		return []string{typed}
+	case map[string]interface{}:
+		if source, ok := typed["url"].(string); ok {
+			return []string{source}
+		}
+	case []interface{}:
+		urls := []string{}
+		for _, item := range typed {
+			urls = append(urls, exportURLs(item)...)
+		}
+
+		return urls
+	}
+
+	return nil
+}
+
+// Migrate imports another greeter bot's export into the members' voicelines, clips are screened and stored like
+// uploads. A clip that's turned away or fails doesn't stop the others, only an export that can't be read is an error.
+func (g *greeterRunner) Migrate(ctx context.Context, dir string, request MigrationRequest) (MigrationResult, error) {
+	if request.DefaultType != "intro" && request.DefaultType != "outro" {
+		return MigrationResult{}, fmt.Errorf("default type must be intro or outro, got %q", request.DefaultType)
+	}
+
+	switch request.Format {
+	case FolderZipMigration:
+		archive, entryErrors, err := util.OpenZip(request.Path, migrationZipLimits)
+		if err != nil {
+			return MigrationResult{}, err
+		}
+
+		defer archive.Close()
+
+		result := MigrationResult{Skipped: entryErrors}
+		tasks := []migrationTask{}
+
+		for _, entry := range archive.Entries() {
+			clip, ok := folderZipClip(entry.Name, request.DefaultType)
+			if !ok {
+				result.Skipped = append(result.Skipped, util.EntryError{Name: entry.Name, Err: errNoMemberFolder})
+				continue
+			}
+
+			tasks = append(tasks, migrationTask{clip: clip, upload: func(ctx context.Context, upload UploadRequest) (UploadResult, error) {
+				return g.migrateZipEntry(ctx, dir, upload, entry)
+			}})
+		}
+
+		return g.runMigration(ctx, request, result, tasks), nil
+	case JSONExportMigration:
+		data, err := os.ReadFile(request.Path)
+		if err != nil {
+			return MigrationResult{}, fmt.Errorf("error reading export: %w", err)
+		}
+
+		clips, err := jsonExportClips(data, request.DefaultType)
+		if err != nil {
+			return MigrationResult{}, err
+		}
+
+		result := MigrationResult{}
+		tasks := []migrationTask{}
+
+		for _, clip := range clips {
+			if parsed, err := url.Parse(clip.Source); err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+				result.Skipped = append(result.Skipped, util.EntryError{Name: clip.Source, Err: errNotHTTPS})
+				continue
+			}
+
+			tasks = append(tasks, migrationTask{clip: clip, upload: func(ctx context.Context, upload UploadRequest) (UploadResult, error) {
+				return g.migrateURL(ctx, dir, upload, clip.Source)
+			}})
+		}
+
+		return g.runMigration(ctx, request, result, tasks), nil
+	default:
+		return MigrationResult{}, fmt.Errorf("unknown migration format %q", request.Format)
+	}
+}
+
+// migrateZipEntry stores a clip of a folder zip, see UploadVoicelineZip.
+func (g *greeterRunner) migrateZipEntry(ctx context.Context, dir string, request UploadRequest, entry util.ZipEntry) (UploadResult, error) {
+	if err := g.voicelineService.EnsureDocument(ctx, request.Collection, request.MemberID); err != nil {
+		return UploadResult{}, fmt.Errorf("error creating firestore document: %w", err)
+	}
+
+	clip, screened, err := g.uploadZipEntry(ctx, dir, request.GuildID, request.Collection, request.MemberID, request.AddedBy, entry)
+	switch {
+	case err != nil:
+		return UploadResult{}, err
+	case screened.Verdict == screening.Reject:
+		return UploadResult{Rejected: []UploadRejection{{Name: entry.Name, Reason: "That clip was rejected by this server's content screening"}}}, nil
+	case clip.trackName == "":
+		return UploadResult{Rejected: []UploadRejection{{Name: entry.Name, Reason: zipRejectedText}}}, nil
+	}
+
+	voiceline, err := g.finishUpload(ctx, request, clip)
+	if err != nil {
+		return UploadResult{}, err
+	}
+
+	result := UploadResult{Created: []voicelines.Voiceline{voiceline}}
+	result.flag(voiceline.TrackName, screened)
+
+	return result, nil
+}
+
+// migrateURL downloads and stores a clip of a JSON export, a download that's refused is reported as a rejection.
+func (g *greeterRunner) migrateURL(ctx context.Context, dir string, request UploadRequest, source string) (UploadResult, error) {
+	downloadCtx, cancel := context.WithTimeout(ctx, attachmentDownloadTimeout)
+	defer cancel()
+
+	var file *os.File
+
+	err := util.Retry(downloadCtx, attachmentRetryPolicy, func(ctx context.Context) (err error) {
+		file, err = util.DownloadLimitedURL(ctx, g.externalClient, dir, source, migrationZipLimits.MaxFileBytes)
+		return err
+	})
+	if err != nil {
+		return UploadResult{Rejected: []UploadRejection{{Name: source, Reason: downloadProblem(err)}}}, nil
+	}
+
+	defer file.Close()
+
+	return g.UploadVoiceline(ctx, dir, request, file)
+}
+
+// runMigration stores the tasks' clips concurrently and adds what became of each to result.
+func (g *greeterRunner) runMigration(ctx context.Context, request MigrationRequest, result MigrationResult, tasks []migrationTask) MigrationResult {
+	for _, task := range tasks {
+		result.Found = append(result.Found, task.clip)
+	}
+
+	if request.DryRun {
+		return result
+	}
+
+	pool := util.NewPool[UploadResult](ctx, g.uploadConcurrency)
+
+	for _, task := range tasks {
+		collection, _ := voicelines.CollectionFor(task.clip.AudioType)
+		upload := UploadRequest{GuildID: request.GuildID, Collection: collection, MemberID: task.clip.MemberID, AddedBy: request.AddedBy}
+
+		pool.Submit(func(ctx context.Context) (UploadResult, error) {
+			return task.upload(ctx, upload)
+		})
+	}
+
+	for i, outcome := range pool.Wait() {
+		clip := tasks[i].clip
+
+		switch {
+		case outcome.Err != nil:
+			result.Failed = append(result.Failed, voicelines.TrackFailure{Name: clip.Source, Err: outcome.Err})
+		case len(outcome.Value.Created) > 0:
+			clip.TrackName = outcome.Value.Created[0].TrackName
+			result.Imported = append(result.Imported, clip)
+
+			for trackName, reason := range outcome.Value.Flagged {
+				if result.Flagged == nil {
+					result.Flagged = map[string]string{}
+				}
+
+				result.Flagged[trackName] = reason
+			}
+		default:
+			for _, rejection := range outcome.Value.Rejected {
+				result.Skipped = append(result.Skipped, util.EntryError{Name: clip.Source, Err: errors.New(rejection.Reason)})
+			}
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,114 @@
+package greeter
+
+import (
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+)
+
+const (
+	// musicBotPlay greets over music bots as if they weren't there, it's what guilds get until they pick something else
+	musicBotPlay  = "play"
+	musicBotSkip  = "skip"
+	musicBotDelay = "delay"
+	musicBotDuck  = "duck"
+	// musicBotWindow is how recently a bot has to have sent audio for it to count as playing music
+	musicBotWindow = time.Second * 2
+	// maxMusicBotDelay stops a long playlist from holding a greeting back forever
+	maxMusicBotDelay = time.Second * 30
+	// normalVolume is ffmpeg's unchanged volume and duckedVolume what greetings are turned down to over music
+	normalVolume = 256
+	duckedVolume = 96
+)
+
+// listensToChannel is whether the player has to join undeafened, either to hear conversation or music bots.
+func listensToChannel(waitForSilence bool, musicBotAction string) bool {
+	return waitForSilence || (musicBotAction != "" && musicBotAction != musicBotPlay)
+}
+
+// markBotSpeaker remembers the audio source of a bot that started speaking in the player's channel, so packets from
+// it can be told apart from members talking.
+func (g *greeterRunner) markBotSpeaker(guildPlayer *guildPlayer, update *discordgo.VoiceSpeakingUpdate) {
+	member, err := guildPlayer.session.State.Member(guildPlayer.guildID, update.UserID)
+	if err != nil || !member.User.Bot {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if guildPlayer.botSpeakers == nil {
+		guildPlayer.botSpeakers = map[uint32]bool{}
+	}
+
+	guildPlayer.botSpeakers[uint32(update.SSRC)] = true
+	guildPlayer.lastBotAudio = g.clock.Now()
+}
+
+// markBotAudio records packets received from a known bot.
+func (g *greeterRunner) markBotAudio(guildPlayer *guildPlayer, ssrc uint32) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if guildPlayer.botSpeakers[ssrc] {
+		guildPlayer.lastBotAudio = g.clock.Now()
+	}
+}
+
+// musicBotPlaying is whether another bot in the player's channel has sent audio within musicBotWindow.
+func (g *greeterRunner) musicBotPlaying(guildPlayer *guildPlayer) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return !guildPlayer.lastBotAudio.IsZero() && g.clock.Now().Sub(guildPlayer.lastBotAudio) < musicBotWindow
+}
+
+// yieldToMusicBots applies the guild's music bot setting to a clip about to play, returning false when it should be
+// skipped and otherwise the volume to encode it at.
+func (g *greeterRunner) yieldToMusicBots(guildPlayer *guildPlayer) (bool, int) {
+	if !g.musicBotPlaying(guildPlayer) {
+		return true, normalVolume
+	}
+
+	logger := g.logger.With(zap.String("guild_id", guildPlayer.guildID), zap.String("action", guildPlayer.musicBotAction))
+
+	switch guildPlayer.musicBotAction {
+	case musicBotSkip:
+		logger.Info("skipping greeting while a music bot is playing")
+		return false, normalVolume
+	case musicBotDelay:
+		logger.Debug("delaying greeting until a music bot stops playing")
+		g.waitForMusicBots(guildPlayer)
+		return true, normalVolume
+	case musicBotDuck:
+		return true, duckedVolume
+	default:
+		return true, normalVolume
+	}
+}
+
+// waitForMusicBots blocks until no bot has sent audio for musicBotWindow, giving up after maxMusicBotDelay.
+func (g *greeterRunner) waitForMusicBots(guildPlayer *guildPlayer) {
+	deadline := g.clock.Now().Add(maxMusicBotDelay)
+
+	for {
+		g.mu.RLock()
+		quietFor := g.clock.Now().Sub(guildPlayer.lastBotAudio)
+		g.mu.RUnlock()
+
+		remaining := deadline.Sub(g.clock.Now())
+		if quietFor >= musicBotWindow || remaining <= 0 {
+			return
+		}
+
+		wake := make(chan struct{})
+		g.clock.AfterFunc(min(musicBotWindow-quietFor, remaining), func() { close(wake) })
+
+		select {
+		case <-wake:
+		case <-guildPlayer.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,553 @@
+package greeter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"salutations/internal/embeds"
+	"salutations/internal/middleware"
+	"salutations/internal/voicelines"
+	util "salutations/pkg/util"
+
+	"cloud.google.com/go/firestore"
+	"github.com/bwmarrin/discordgo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	maxTrackWeight   int64 = 10
+	minChainLength         = 2
+	maxChainLength         = 3
+	maxEntranceDelay       = time.Second * 10
+)
+
+var errTrackNotFound = errors.New("track not found")
+
+// voicelineLabel names the member's track at index in select menus, the short id tells apart tracks whose numbers shifted.
+func voicelineLabel(username string, index int, trackName string) string {
+	return fmt.Sprintf("%s's Voiceline %d · %s", username, index+1, voicelines.ShortID(trackName))
+}
+
+// reorderTrack moves the track to position, counting from 1, and numbers every track so the order sticks as tracks
+// are added or removed. Positions past the end move the track last.
+func (g *greeterRunner) reorderTrack(ctx context.Context, collection string, memberID string, trackName string, position int) error {
+	audioListKey := OutroArrayKey
+	if collection == WelcomeCollection {
+		audioListKey = IntroArrayKey
+	}
+
+	tracks, err := g.voicelineService.Tracks(ctx, collection, memberID)
+	if err != nil {
+		return err
+	}
+
+	index := slices.IndexFunc(tracks, func(track interface{}) bool {
+		recordMap, ok := track.(map[string]interface{})
+		return ok && recordMap["track_name"] == trackName
+	})
+	if index == -1 {
+		return errTrackNotFound
+	}
+
+	track := tracks[index]
+	tracks = slices.Delete(tracks, index, index+1)
+	tracks = slices.Insert(tracks, min(max(position, 1), len(tracks)+1)-1, track)
+
+	updated := make([]interface{}, 0, len(tracks))
+	for i, track := range tracks {
+		if recordMap, ok := track.(map[string]interface{}); ok {
+			copied := maps.Clone(recordMap)
+			copied["position"] = int64(i + 1)
+			track = copied
+		}
+
+		updated = append(updated, track)
+	}
+
+	return g.firebaseAdapter.UpdateDocument(ctx, collection, memberID, map[string]interface{}{audioListKey: updated})
+}
+
+// updateTrackRecord rewrites the member's whole track array with update applied to a copy of the track's record,
+// firestore can't update a single element in place.
+func (g *greeterRunner) updateTrackRecord(ctx context.Context, collection string, memberID string, trackName string, update func(map[string]interface{})) error {
+	audioListKey := OutroArrayKey
+	if collection == WelcomeCollection {
+		audioListKey = IntroArrayKey
+	}
+
+	tracks, err := g.voicelineService.Tracks(ctx, collection, memberID)
+	if err != nil {
+		return err
+	}
+
+	updated := make([]interface{}, 0, len(tracks))
+	found := false
+
+	for _, track := range tracks {
+		if recordMap, ok := track.(map[string]interface{}); ok && recordMap["track_name"] == trackName {
+			copied := make(map[string]interface{}, len(recordMap)+1)
+			for key, value := range recordMap {
+				copied[key] = value
+			}
+
+			update(copied)
+			track = copied
+			found = true
+		}
+
+		updated = append(updated, track)
+	}
+
+	if !found {
+		return errTrackNotFound
+	}
+
+	g.invalidatePrefetch(collection, memberID)
+
+	return g.firebaseAdapter.UpdateDocument(ctx, collection, memberID, map[string]interface{}{audioListKey: updated})
+}
+
+func (g *greeterRunner) setTrackWeight(ctx context.Context, collection string, memberID string, trackName string, weight int64) error {
+	return g.updateTrackRecord(ctx, collection, memberID, trackName, func(record map[string]interface{}) {
+		record["weight"] = weight
+	})
+}
+
+// toggleTrack turns a single track off so it's never picked, or back on, returning whether it's now enabled.
+func (g *greeterRunner) toggleTrack(ctx context.Context, collection string, memberID string, trackName string) (bool, error) {
+	var enabled bool
+
+	err := g.updateTrackRecord(ctx, collection, memberID, trackName, func(record map[string]interface{}) {
+		enabled = !voicelines.Enabled(record)
+		if enabled {
+			delete(record, "enabled")
+		} else {
+			record["enabled"] = false
+		}
+	})
+
+	return enabled, err
+}
+
+// validChain returns the member's chain, or nil if they don't have one or a track in it has since been deleted.
+func validChain(data map[string]interface{}, audioListKey string) []string {
+	chain, _ := data[ChainKey].([]interface{})
+	if len(chain) < minChainLength {
+		return nil
+	}
+
+	tracks, _ := data[audioListKey].([]interface{})
+	trackNames := make([]string, 0, len(chain))
+
+	// A chain with a track that's been turned off falls back to picking one track, like one with a deleted track
+	for _, link := range chain {
+		trackName, _ := link.(string)
+		if !slices.ContainsFunc(tracks, func(track interface{}) bool {
+			recordMap, ok := track.(map[string]interface{})
+			return ok && recordMap["track_name"] == trackName && voicelines.Enabled(recordMap)
+		}) {
+			return nil
+		}
+
+		trackNames = append(trackNames, trackName)
+	}
+
+	return trackNames
+}
+
+// setChain makes the given tracks play back to back as the member's greeting, an empty chain goes back to picking one track.
+func (g *greeterRunner) setChain(ctx context.Context, collection string, memberID string, trackNames []string) error {
+	g.invalidatePrefetch(collection, memberID)
+
+	if len(trackNames) == 0 {
+		return g.firebaseAdapter.UpdateDocument(ctx, collection, memberID, map[string]interface{}{ChainKey: firestore.Delete})
+	}
+
+	if len(trackNames) < minChainLength || len(trackNames) > maxChainLength {
+		return fmt.Errorf("a chain must have between %d and %d clips, got %d", minChainLength, maxChainLength, len(trackNames))
+	}
+
+	tracks, err := g.voicelineService.Tracks(ctx, collection, memberID)
+	if err != nil {
+		return err
+	}
+
+	chain := make([]interface{}, 0, len(trackNames))
+	for _, trackName := range trackNames {
+		if !slices.ContainsFunc(tracks, func(track interface{}) bool {
+			recordMap, ok := track.(map[string]interface{})
+			return ok && recordMap["track_name"] == trackName
+		}) {
+			return errTrackNotFound
+		}
+
+		chain = append(chain, trackName)
+	}
+
+	return g.firebaseAdapter.UpdateDocument(ctx, collection, memberID, map[string]interface{}{ChainKey: chain})
+}
+
+// entranceDelay is how long the member wants to wait after joining before their intro plays, kept on their intro document.
+func (g *greeterRunner) entranceDelay(ctx context.Context, memberID string) (time.Duration, error) {
+	data, err := g.firebaseAdapter.GetDocumentFromCollection(ctx, WelcomeCollection, memberID)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return 0, nil
+		}
+
+		return 0, err
+	}
+
+	seconds, _ := data[EntranceDelayKey].(int64)
+
+	return min(time.Duration(seconds)*time.Second, maxEntranceDelay), nil
+}
+
+// togglePinnedTrack pins the track so it plays every time, or unpins it if it already was, returning whether it's now pinned.
+func (g *greeterRunner) togglePinnedTrack(ctx context.Context, collection string, memberID string, trackName string) (bool, error) {
+	g.invalidatePrefetch(collection, memberID)
+
+	data, err := g.firebaseAdapter.GetDocumentFromCollection(ctx, collection, memberID)
+	if err != nil {
+		return false, err
+	}
+
+	if pinned, _ := data[PinnedTrackKey].(string); pinned == trackName {
+		return false, g.firebaseAdapter.UpdateDocument(ctx, collection, memberID, map[string]interface{}{PinnedTrackKey: ""})
+	}
+
+	audioListKey := OutroArrayKey
+	if collection == WelcomeCollection {
+		audioListKey = IntroArrayKey
+	}
+
+	tracks, _ := data[audioListKey].([]interface{})
+
+	for _, track := range tracks {
+		if recordMap, ok := track.(map[string]interface{}); ok && recordMap["track_name"] == trackName {
+			return true, g.firebaseAdapter.UpdateDocument(ctx, collection, memberID, map[string]interface{}{PinnedTrackKey: trackName})
+		}
+	}
+
+	return false, errTrackNotFound
+}
+
+// toggleVoicelines turns the member's intros or outros off or back on, returning whether they're now enabled.
+func (g *greeterRunner) toggleVoicelines(ctx context.Context, collection string, memberID string) (bool, error) {
+	g.invalidatePrefetch(collection, memberID)
+
+	data, err := g.firebaseAdapter.GetDocumentFromCollection(ctx, collection, memberID)
+	if err != nil {
+		return false, err
+	}
+
+	disabled, _ := data[DisabledKey].(bool)
+
+	return disabled, g.firebaseAdapter.UpdateDocument(ctx, collection, memberID, map[string]interface{}{DisabledKey: !disabled})
+}
+
+func (g *greeterRunner) respondEphemeral(session *discordgo.Session, interaction *discordgo.InteractionCreate, embed *discordgo.MessageEmbed) error {
+	_, err := middleware.Respond(session, interaction, &discordgo.InteractionResponseData{
+		Embeds: []*discordgo.MessageEmbed{embed},
+		Flags:  discordgo.MessageFlagsEphemeral,
+	})
+
+	return err
+}
+
+// ownVoicelinesMessage renders the /myvoicelines list from the member's voiceline document, with a toggle button per track.
+func (g *greeterRunner) ownVoicelinesMessage(ctx context.Context, member *discordgo.Member, audioType string, data map[string]interface{}) (*discordgo.MessageEmbed, []discordgo.MessageComponent, error) {
+	collection, audioListKey := voicelines.CollectionFor(audioType)
+
+	tracks, _ := data[audioListKey].([]interface{})
+	pinned, _ := data[PinnedTrackKey].(string)
+	disabled, _ := data[DisabledKey].(bool)
+	chain := validChain(data, audioListKey)
+
+	entries := make([]embeds.OwnVoiceline, 0, len(tracks))
+	customIDs := make([]string, 0, len(tracks))
+	enabled := make([]bool, 0, len(tracks))
+
+	records := make([]map[string]interface{}, 0, len(tracks))
+	objectNames := make([]string, 0, len(tracks))
+	for _, track := range voicelines.Ordered(tracks) {
+		recordMap, ok := track.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		name, _ := recordMap["track_name"].(string)
+		records = append(records, recordMap)
+		objectNames = append(objectNames, fmt.Sprintf("voicelines/%s", name))
+	}
+
+	signedURLs, err := g.firebaseAdapter.GenerateSignedURLs(ctx, g.bucket, objectNames)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error generating signed urls: %w", err)
+	}
+
+	for i, recordMap := range records {
+		name, _ := recordMap["track_name"].(string)
+		expiresAt, _ := recordMap["expires_at"].(time.Time)
+		transcript, _ := recordMap["transcript"].(string)
+
+		entries = append(entries, embeds.OwnVoiceline{
+			URL:           signedURLs[i],
+			ShortID:       voicelines.ShortID(name),
+			Weight:        voicelines.Weight(recordMap),
+			Pinned:        name == pinned,
+			Enabled:       voicelines.Enabled(recordMap),
+			ChainPosition: slices.Index(chain, name) + 1,
+			ExpiresAt:     expiresAt,
+			Transcript:    transcript,
+		})
+		customIDs = append(customIDs, util.CustomID{Action: trackTogglePrefix, Collection: collection, Args: []string{name}}.Encode())
+		enabled = append(enabled, voicelines.Enabled(recordMap))
+	}
+
+	return embeds.MyVoicelinesEmbed(member, audioType, entries, !disabled), embeds.TrackToggleComponents(customIDs, enabled), nil
+}
+
+// trackToggle handles the buttons on the /myvoicelines list, only the member's own tracks can be toggled since
+// the list is ephemeral and the track is looked up under whoever pressed the button.
+func (g *greeterRunner) trackToggle(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	ctx := context.Background()
+	memberID := interaction.Member.User.ID
+
+	customID, err := util.DecodeCustomID(interaction.MessageComponentData().CustomID)
+	if err != nil || len(customID.Args) != 1 {
+		return fmt.Errorf("malformed track toggle custom id: %s", interaction.MessageComponentData().CustomID)
+	}
+
+	collection, trackName := customID.Collection, customID.Args[0]
+	audioType := voicelines.AudioTypeFor(collection)
+
+	if _, err := g.toggleTrack(ctx, collection, memberID, trackName); err != nil {
+		if errors.Is(err, errTrackNotFound) {
+			return g.respondEphemeral(session, interaction, embeds.ErrorMessageEmbed("That voiceline couldn't be found, it may have been deleted"))
+		}
+
+		return fmt.Errorf("error toggling track: %w", err)
+	}
+
+	data, err := g.firebaseAdapter.GetDocumentFromCollection(ctx, collection, memberID)
+	if err != nil {
+		return fmt.Errorf("error getting %s document: %w", audioType, err)
+	}
+
+	embed, components, err := g.ownVoicelinesMessage(ctx, interaction.Member, audioType, data)
+	if err != nil {
+		return err
+	}
+
+	return session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Embeds:     []*discordgo.MessageEmbed{embed},
+			Components: components,
+		},
+	})
+}
+
+// myVoicelines lets members manage their own voicelines no matter who uploaded them, every response is ephemeral.
+func (g *greeterRunner) myVoicelines(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	ctx := context.Background()
+	memberID := interaction.Member.User.ID
+
+	subcommand := interaction.ApplicationCommandData().Options[0]
+	options := map[string]*discordgo.ApplicationCommandInteractionDataOption{}
+	for _, option := range subcommand.Options {
+		options[option.Name] = option
+	}
+
+	// The entrance delay only applies to intros so its subcommand has no type
+	audioType := "intro"
+	if option, ok := options["type"]; ok {
+		audioType = option.StringValue()
+	}
+	collection, audioListKey := voicelines.CollectionFor(audioType)
+
+	data, err := g.firebaseAdapter.GetDocumentFromCollection(ctx, collection, memberID)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return g.respondEphemeral(session, interaction, embeds.NoDataForMemberEmbed(audioType, interaction.Member.User.Username))
+		}
+
+		return fmt.Errorf("error getting %s document: %w", audioType, err)
+	}
+
+	var trackName string
+	if option, ok := options["track"]; ok {
+		trackName = option.StringValue()
+	}
+
+	var description string
+
+	switch subcommand.Name {
+	case "list":
+		embed, components, err := g.ownVoicelinesMessage(ctx, interaction.Member, audioType, data)
+		if err != nil {
+			return err
+		}
+
+		_, err = middleware.Respond(session, interaction, &discordgo.InteractionResponseData{
+			Embeds:     []*discordgo.MessageEmbed{embed},
+			Components: components,
+			Flags:      discordgo.MessageFlagsEphemeral,
+		})
+
+		return err
+	case "weight":
+		weight := options["weight"].IntValue()
+		if err := g.setTrackWeight(ctx, collection, memberID, trackName, weight); err != nil {
+			if errors.Is(err, errTrackNotFound) {
+				return g.respondEphemeral(session, interaction, embeds.ErrorMessageEmbed("That voiceline couldn't be found, pick one from the list"))
+			}
+
+			return fmt.Errorf("error setting track weight: %w", err)
+		}
+
+		description = fmt.Sprintf("That %s will now be picked with a weight of **%d**", audioType, weight)
+	case "pin":
+		pinned, err := g.togglePinnedTrack(ctx, collection, memberID, trackName)
+		if err != nil {
+			if errors.Is(err, errTrackNotFound) {
+				return g.respondEphemeral(session, interaction, embeds.ErrorMessageEmbed("That voiceline couldn't be found, pick one from the list"))
+			}
+
+			return fmt.Errorf("error pinning track: %w", err)
+		}
+
+		description = fmt.Sprintf("Unpinned, your %ss will be picked at random again", audioType)
+		if pinned {
+			description = fmt.Sprintf("Pinned, that %s will play every time", audioType)
+		}
+	case "delete":
+		tracks, _ := data[audioListKey].([]interface{})
+		if !slices.ContainsFunc(tracks, func(track interface{}) bool {
+			recordMap, ok := track.(map[string]interface{})
+			return ok && recordMap["track_name"] == trackName
+		}) {
+			return g.respondEphemeral(session, interaction, embeds.ErrorMessageEmbed("That voiceline couldn't be found, pick one from the list"))
+		}
+
+		if err := g.removeVoicelines(ctx, collection, memberID, []string{trackName}); err != nil {
+			return fmt.Errorf("error deleting own voiceline: %w", err)
+		}
+
+		description = fmt.Sprintf("Deleted that %s", audioType)
+	case "reorder":
+		position := options["position"].IntValue()
+		if err := g.reorderTrack(ctx, collection, memberID, trackName, int(position)); err != nil {
+			if errors.Is(err, errTrackNotFound) {
+				return g.respondEphemeral(session, interaction, embeds.ErrorMessageEmbed("That voiceline couldn't be found, pick one from the list"))
+			}
+
+			return fmt.Errorf("error reordering track: %w", err)
+		}
+
+		description = fmt.Sprintf("Moved `%s` to spot **%d** in your %ss", voicelines.ShortID(trackName), position, audioType)
+	case "chain":
+		chain := []string{}
+		for _, key := range []string{"first", "second", "third"} {
+			if option, ok := options[key]; ok {
+				chain = append(chain, option.StringValue())
+			}
+		}
+
+		if err := g.setChain(ctx, collection, memberID, chain); err != nil {
+			if errors.Is(err, errTrackNotFound) {
+				return g.respondEphemeral(session, interaction, embeds.ErrorMessageEmbed("That voiceline couldn't be found, pick one from the list"))
+			}
+
+			return fmt.Errorf("error setting chain: %w", err)
+		}
+
+		description = fmt.Sprintf("Those %d clips will now play back to back as your %s", len(chain), audioType)
+	case "unchain":
+		if err := g.setChain(ctx, collection, memberID, nil); err != nil {
+			return fmt.Errorf("error clearing chain: %w", err)
+		}
+
+		description = fmt.Sprintf("Your %ss will be picked one at a time again", audioType)
+	case "delay":
+		seconds := options["seconds"].IntValue()
+		if err := g.firebaseAdapter.UpdateDocument(ctx, collection, memberID, map[string]interface{}{EntranceDelayKey: seconds}); err != nil {
+			return fmt.Errorf("error setting entrance delay: %w", err)
+		}
+
+		description = "Your intro will play as soon as you join"
+		if seconds > 0 {
+			description = fmt.Sprintf("Your intro will play **%d second(s)** after you join", seconds)
+		}
+	case "toggle":
+		enabled, err := g.toggleVoicelines(ctx, collection, memberID)
+		if err != nil {
+			return fmt.Errorf("error toggling voicelines: %w", err)
+		}
+
+		description = fmt.Sprintf("Your %ss are now turned **off**", audioType)
+		if enabled {
+			description = fmt.Sprintf("Your %ss are now turned **on**", audioType)
+		}
+	default:
+		return fmt.Errorf("unknown myvoicelines subcommand: %s", subcommand.Name)
+	}
+
+	return g.respondEphemeral(session, interaction, embeds.MyVoicelinesUpdatedEmbed(description))
+}
+
+func (g *greeterRunner) myVoicelinesAutocomplete(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	return g.trackAutocomplete(session, interaction, interaction.ApplicationCommandData().Options[0].Options)
+}
+
+// trackAutocomplete suggests the member's own voicelines of the type picked in options, matching what they've typed so far.
+func (g *greeterRunner) trackAutocomplete(session *discordgo.Session, interaction *discordgo.InteractionCreate, options []*discordgo.ApplicationCommandInteractionDataOption) error {
+	audioType, focused := "intro", ""
+	for _, option := range options {
+		switch {
+		case option.Focused:
+			focused = option.StringValue()
+		case option.Name == "type":
+			audioType = option.StringValue()
+		}
+	}
+
+	collection, _ := voicelines.CollectionFor(audioType)
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+
+	tracks, err := g.voicelineService.Tracks(context.Background(), collection, interaction.Member.User.ID)
+	if err != nil && status.Code(err) != codes.NotFound {
+		return err
+	}
+
+	for i, track := range tracks {
+		recordMap, ok := track.(map[string]interface{})
+		if !ok || len(choices) == 25 {
+			continue
+		}
+
+		trackName, _ := recordMap["track_name"].(string)
+
+		label := fmt.Sprintf("Voiceline %d · %s (weight %d)", i+1, voicelines.ShortID(trackName), voicelines.Weight(recordMap))
+		if !voicelines.Enabled(recordMap) {
+			label = fmt.Sprintf("Voiceline %d · %s (off)", i+1, voicelines.ShortID(trackName))
+		}
+		if !strings.Contains(strings.ToLower(label), strings.ToLower(focused)) {
+			continue
+		}
+
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: label, Value: trackName})
+	}
+
+	return session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{Choices: choices},
+	})
+}
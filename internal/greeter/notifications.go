@@ -0,0 +1,60 @@
+package greeter
+
+import (
+	"context"
+	"time"
+
+	"salutations/internal/embeds"
+	util "salutations/pkg/util"
+
+	"github.com/bwmarrin/discordgo"
+
+	"go.uber.org/zap"
+)
+
+// nowPlayingLifetime is how long a now playing notification stays up, they're only useful while the greeting is fresh
+const nowPlayingLifetime = time.Minute
+
+// trackPosition is the 1 based position of trackName in the member's voicelines, the number /voicelines shows it under.
+func (g *greeterRunner) trackPosition(ctx context.Context, collection string, memberID string, trackName string) int {
+	tracks, err := g.voicelineService.Tracks(ctx, collection, memberID)
+	if err != nil {
+		return 0
+	}
+
+	for i, track := range tracks {
+		if recordMap, ok := track.(map[string]interface{}); ok && recordMap["track_name"] == trackName {
+			return i + 1
+		}
+	}
+
+	return 0
+}
+
+// announceNowPlaying posts to the guild's notification channel, if it has one, and deletes the message after nowPlayingLifetime.
+func (g *greeterRunner) announceNowPlaying(guildPlayer *guildPlayer, clip queuedClip) {
+	ctx := context.Background()
+
+	channelID := g.guildSettings(ctx, guildPlayer.guildID).NotificationChannel
+	if channelID == "" || guildPlayer.session == nil {
+		return
+	}
+
+	audioType := clip.embed().AudioType
+	position := g.trackPosition(ctx, clip.collection, clip.memberID, clip.trackName)
+
+	message, err := util.SendMessage(ctx, guildPlayer.session, channelID, &discordgo.MessageSend{
+		Embeds:     []*discordgo.MessageEmbed{embeds.NowPlayingEmbed(clip.memberID, audioType, position)},
+		Components: embeds.ReportButtonComponent(util.CustomID{Action: reportPrefix, MemberID: clip.memberID, Collection: clip.collection, Args: []string{clip.trackName}}.Encode()),
+	})
+	if err != nil {
+		g.logger.Warn("unable to post now playing notification", zap.Error(err), zap.String("guild_id", guildPlayer.guildID), zap.String("channel_id", channelID))
+		return
+	}
+
+	g.clock.AfterFunc(nowPlayingLifetime, func() {
+		if err := util.DeleteMessage(ctx, guildPlayer.session, channelID, message.ID); err != nil {
+			g.logger.Warn("unable to delete now playing notification", zap.Error(err), zap.String("channel_id", channelID))
+		}
+	})
+}
@@ -0,0 +1,78 @@
+package greeter
+
+import (
+	"slices"
+	"sync"
+)
+
+// paginationStore holds the pagination state of messages by their id. Buttons and menus on the same message can be
+// used at once, so states are handed out as copies and only changed through update.
+type paginationStore struct {
+	mu     sync.Mutex
+	states map[string]*paginationState
+}
+
+func newPaginationStore() *paginationStore {
+	return &paginationStore{states: make(map[string]*paginationState)}
+}
+
+func (s *paginationStore) put(messageID string, state *paginationState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.states[messageID] = state
+}
+
+func (s *paginationStore) get(messageID string) (paginationState, bool) {
+	return s.update(messageID, func(*paginationState) {})
+}
+
+// update changes the message's state under the store's lock and returns a copy of the result, false when the message
+// has no state.
+func (s *paginationStore) update(messageID string, change func(state *paginationState)) (paginationState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.states[messageID]
+	if !ok {
+		return paginationState{}, false
+	}
+
+	change(state)
+
+	return state.clone(), true
+}
+
+// take removes the message's state and returns it, so only one of several concurrent callers gets it.
+func (s *paginationStore) take(messageID string) (paginationState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.states[messageID]
+	if !ok {
+		return paginationState{}, false
+	}
+
+	delete(s.states, messageID)
+
+	return *state, true
+}
+
+// purge drops every state, returning how many there were.
+func (s *paginationStore) purge() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purged := len(s.states)
+	s.states = make(map[string]*paginationState)
+
+	return purged
+}
+
+// clone copies the state, Pages and SelectMenuData are never changed once stored so they're shared.
+func (s *paginationState) clone() paginationState {
+	clone := *s
+	clone.Selected = slices.Clone(s.Selected)
+
+	return clone
+}
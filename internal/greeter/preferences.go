@@ -0,0 +1,130 @@
+package greeter
+
+import (
+	"context"
+	"fmt"
+
+	"salutations/internal/embeds"
+	"salutations/internal/i18n"
+	"salutations/internal/logging"
+	util "salutations/pkg/util"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// memberPreferences are per member settings that apply in every guild, members without a document get the zero value.
+type memberPreferences struct {
+	// RespectDoNotDisturb skips greetings while the member's status is do not disturb or invisible
+	RespectDoNotDisturb bool `firestore:"respect_dnd"`
+	// Language is what the member picked with /language, empty follows their Discord client's language
+	Language string `firestore:"language"`
+}
+
+func (g *greeterRunner) getMemberPreferences(ctx context.Context, memberID string) (memberPreferences, error) {
+	data, err := g.firebaseAdapter.GetDocumentFromCollection(ctx, MemberPreferencesCollection, memberID)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return memberPreferences{}, nil
+		}
+
+		return memberPreferences{}, fmt.Errorf("error getting member preferences: %w", err)
+	}
+
+	preferences := memberPreferences{}
+	preferences.RespectDoNotDisturb, _ = data["respect_dnd"].(bool)
+	preferences.Language, _ = data["language"].(string)
+
+	return preferences, nil
+}
+
+func (g *greeterRunner) setMemberPreference(ctx context.Context, memberID string, key string, value interface{}) error {
+	err := g.firebaseAdapter.UpdateDocument(ctx, MemberPreferencesCollection, memberID, map[string]interface{}{key: value})
+	if status.Code(err) != codes.NotFound {
+		return err
+	}
+
+	if err := g.firebaseAdapter.CreateDocument(ctx, MemberPreferencesCollection, memberID, map[string]interface{}{key: value}); err != nil {
+		if status.Code(err) == codes.AlreadyExists {
+			return g.firebaseAdapter.UpdateDocument(ctx, MemberPreferencesCollection, memberID, map[string]interface{}{key: value})
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// isDoNotDisturb reads the member's presence from state, invisible members show up as offline or without a presence at all.
+func isDoNotDisturb(session *discordgo.Session, guildID string, memberID string) bool {
+	presence, err := session.State.Presence(guildID, memberID)
+	if err != nil {
+		return true
+	}
+
+	switch presence.Status {
+	case discordgo.StatusDoNotDisturb, discordgo.StatusInvisible, discordgo.StatusOffline:
+		return true
+	default:
+		return false
+	}
+}
+
+func (g *greeterRunner) doNotDisturb(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	enabled := interaction.ApplicationCommandData().Options[0].BoolValue()
+
+	if err := g.setMemberPreference(context.Background(), interaction.Member.User.ID, "respect_dnd", enabled); err != nil {
+		return fmt.Errorf("error saving do not disturb preference: %w", err)
+	}
+
+	return g.respondEphemeral(session, interaction, embeds.DoNotDisturbEmbed(g.languageFor(context.Background(), interaction), enabled))
+}
+
+// languageFor is the language to answer the member behind interaction in, their /language pick if they made one
+// and otherwise their Discord client's language. Failing to read their preferences falls back to the client's.
+func (g *greeterRunner) languageFor(ctx context.Context, interaction *discordgo.InteractionCreate) i18n.Language {
+	preferences, err := g.getMemberPreferences(ctx, util.InteractionUserID(interaction))
+	if err != nil {
+		logging.WithInteraction(g.logger, interaction).Warn("unable to read member language, using their client's", zap.Error(err))
+		return i18n.FromLocale(interaction.Locale)
+	}
+
+	if language, ok := i18n.Parse(preferences.Language); ok {
+		return language
+	}
+
+	return i18n.FromLocale(interaction.Locale)
+}
+
+// languageChoices are the choices of /language, automatic first.
+func languageChoices() []*discordgo.ApplicationCommandOptionChoice {
+	choices := []*discordgo.ApplicationCommandOptionChoice{{Name: "Automatic", Value: "auto"}}
+	for _, language := range i18n.Languages {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: language.Name(), Value: string(language)})
+	}
+
+	return choices
+}
+
+// setLanguage saves the member's /language pick, "auto" clears it so they follow their Discord client again.
+func (g *greeterRunner) setLanguage(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	ctx := context.Background()
+	choice := interaction.ApplicationCommandData().Options[0].StringValue()
+
+	language, ok := i18n.Parse(choice)
+	if !ok {
+		choice = ""
+	}
+
+	if err := g.setMemberPreference(ctx, interaction.Member.User.ID, "language", choice); err != nil {
+		return fmt.Errorf("error saving language preference: %w", err)
+	}
+
+	if !ok {
+		language = i18n.FromLocale(interaction.Locale)
+	}
+
+	return g.respondEphemeral(session, interaction, embeds.LanguageEmbed(language, !ok))
+}
@@ -0,0 +1,207 @@
+package greeter
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	util "salutations/pkg/util"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+)
+
+const (
+	// greetingLatencyBudget is how long a greeting should take to start after the member joins or leaves
+	greetingLatencyBudget = time.Second
+	// prefetchTTL is how long a prefetched greeting is kept for before it's thrown away unplayed
+	prefetchTTL = time.Minute * 10
+	// maxPrefetched caps how many greetings are kept on disk, presence updates in big guilds would otherwise fill it
+	maxPrefetched = 200
+)
+
+func prefetchKey(collection string, memberID string) string {
+	return collection + "/" + memberID
+}
+
+type prefetchedGreeting struct {
+	clips  []queuedClip
+	expiry util.Timer
+}
+
+// greetingPrefetches holds members' next greetings, picked and downloaded before they join or leave so that
+// playing one doesn't wait on firestore and storage. Each is played at most once.
+type greetingPrefetches struct {
+	mu       sync.Mutex
+	greeting map[string]*prefetchedGreeting
+	// inFlight holds a token per key being downloaded, invalidating the key drops it so a stale download isn't kept
+	inFlight  map[string]uint64
+	nextToken uint64
+}
+
+func newGreetingPrefetches() *greetingPrefetches {
+	return &greetingPrefetches{
+		greeting: make(map[string]*prefetchedGreeting),
+		inFlight: make(map[string]uint64),
+	}
+}
+
+// begin reserves the key for a download, it returns false when the greeting is already prefetched or being
+// prefetched, or when there's no room for another.
+func (p *greetingPrefetches) begin(key string) (uint64, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.greeting[key]; ok {
+		return 0, false
+	}
+
+	if _, ok := p.inFlight[key]; ok || len(p.greeting)+len(p.inFlight) >= maxPrefetched {
+		return 0, false
+	}
+
+	p.nextToken++
+	p.inFlight[key] = p.nextToken
+
+	return p.nextToken, true
+}
+
+// finish keeps the downloaded clips until they're taken or expire, returning false if the key was invalidated
+// while they downloaded, in which case the caller still owns the clips.
+func (p *greetingPrefetches) finish(key string, token uint64, clips []queuedClip, clock util.Clock, logger *zap.Logger) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.inFlight[key] != token {
+		return false
+	}
+
+	delete(p.inFlight, key)
+
+	if clips == nil {
+		return true
+	}
+
+	prefetched := &prefetchedGreeting{clips: clips}
+	prefetched.expiry = clock.AfterFunc(prefetchTTL, func() {
+		p.mu.Lock()
+		current := p.greeting[key]
+		if current == prefetched {
+			delete(p.greeting, key)
+		}
+		p.mu.Unlock()
+
+		if current == prefetched {
+			deleteClips(logger, clips)
+		}
+	})
+
+	p.greeting[key] = prefetched
+
+	return true
+}
+
+// take hands the prefetched clips over to the caller, who is then responsible for deleting them.
+func (p *greetingPrefetches) take(key string) ([]queuedClip, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	prefetched, ok := p.greeting[key]
+	if !ok {
+		return nil, false
+	}
+
+	prefetched.expiry.Stop()
+	delete(p.greeting, key)
+
+	return prefetched.clips, true
+}
+
+// invalidate throws away the key's prefetched greeting and any download in progress, for when the member's
+// voicelines change and the picked clip might no longer be theirs to play.
+func (p *greetingPrefetches) invalidate(key string, logger *zap.Logger) {
+	p.mu.Lock()
+	delete(p.inFlight, key)
+	prefetched, ok := p.greeting[key]
+	delete(p.greeting, key)
+	p.mu.Unlock()
+
+	if ok {
+		prefetched.expiry.Stop()
+		deleteClips(logger, prefetched.clips)
+	}
+}
+
+func deleteClips(logger *zap.Logger, clips []queuedClip) {
+	for _, clip := range clips {
+		if err := util.DeleteFile(clip.audioPath); err != nil {
+			logger.Warn("error trying to delete file", zap.Error(err), zap.String("file_name", clip.audioPath))
+		}
+	}
+}
+
+func (g *greeterRunner) invalidatePrefetch(collection string, memberID string) {
+	g.prefetches.invalidate(prefetchKey(collection, memberID), g.logger)
+}
+
+// prefetchGreeting picks and downloads the member's next intro or outro ahead of time. Only the member's own
+// voicelines are prefetched, default greetings are left to be downloaded when they're needed.
+func (g *greeterRunner) prefetchGreeting(ctx context.Context, collection string, guildID string, memberID string) {
+	key := prefetchKey(collection, memberID)
+
+	token, ok := g.prefetches.begin(key)
+	if !ok {
+		return
+	}
+
+	logger := g.logger.With(zap.String("guild_id", guildID), zap.String("user_id", memberID), zap.String("collection", collection))
+
+	clips := []queuedClip{}
+	defer func() {
+		if !g.prefetches.finish(key, token, clips, g.clock, logger) {
+			deleteClips(logger, clips)
+		}
+	}()
+
+	tracks, err := g.retrieveGreeting(ctx, collection, memberID)
+	if err != nil || len(tracks) == 0 {
+		clips = nil
+		return
+	}
+
+	// downloadVoiceline only reads the guild and member off the update, to tag storage failures
+	vc := &discordgo.VoiceStateUpdate{VoiceState: &discordgo.VoiceState{GuildID: guildID, UserID: memberID}}
+
+	for _, track := range tracks {
+		audioPath, err := g.downloadGreetingTrack(ctx, track, vc)
+		if err != nil {
+			logger.Warn("unable to prefetch voiceline", zap.Error(err), zap.String("track_name", track.name))
+
+			deleteClips(logger, clips)
+			clips = nil
+
+			return
+		}
+
+		clips = append(clips, queuedClip{audioPath: audioPath, memberID: memberID, trackName: track.name, collection: collection, announce: len(clips) == 0, prefetched: true})
+	}
+
+	logger.Debug("prefetched voiceline", zap.Strings("track_names", greetingTrackNames(tracks)))
+}
+
+// presenceUpdate prefetches the intros of members who come online, so it's ready by the time they join voice.
+func (g *greeterRunner) presenceUpdate(session *discordgo.Session, presence *discordgo.PresenceUpdate) {
+	if presence.User == nil || presence.Status == discordgo.StatusOffline {
+		return
+	}
+
+	if member, err := session.State.Member(presence.GuildID, presence.User.ID); err != nil || member.User.Bot {
+		return
+	}
+
+	if _, err := session.State.VoiceState(presence.GuildID, presence.User.ID); err == nil {
+		return
+	}
+
+	go g.prefetchGreeting(context.Background(), WelcomeCollection, presence.GuildID, presence.User.ID)
+}
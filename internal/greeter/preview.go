@@ -0,0 +1,114 @@
+package greeter
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"salutations/internal/embeds"
+	"salutations/internal/logging"
+	util "salutations/pkg/util"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+)
+
+// previewButtons builds the preview row for the tracks on one page of a listing, start is the index of the first one.
+func previewButtons(memberID string, collection string, trackNames []string, start int) discordgo.ActionsRow {
+	customIDs := make([]string, 0, len(trackNames))
+	for _, trackName := range trackNames {
+		customIDs = append(customIDs, util.CustomID{Action: previewPrefix, MemberID: memberID, Collection: collection, Args: []string{trackName}}.Encode())
+	}
+
+	return embeds.PreviewButtons(customIDs, start+1)
+}
+
+// preview plays the track in the invoker's voice channel, or sends it back as an attachment when they aren't in one.
+func (g *greeterRunner) preview(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	ctx := context.Background()
+
+	customID, err := util.DecodeCustomID(interaction.MessageComponentData().CustomID)
+	if err != nil || len(customID.Args) != 1 {
+		return fmt.Errorf("malformed preview custom id: %s", interaction.MessageComponentData().CustomID)
+	}
+
+	memberID, collection, trackName := customID.MemberID, customID.Collection, customID.Args[0]
+
+	err = session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral},
+	})
+	if err != nil {
+		return err
+	}
+
+	vc := &discordgo.VoiceStateUpdate{VoiceState: &discordgo.VoiceState{GuildID: interaction.GuildID, UserID: memberID}}
+
+	voiceState, err := session.State.VoiceState(interaction.GuildID, interaction.Member.User.ID)
+	if err != nil || voiceState.ChannelID == "" || g.dryRun {
+		return g.previewAttachment(ctx, session, interaction, trackName, vc)
+	}
+
+	vc.ChannelID = voiceState.ChannelID
+	logger := logging.WithVoiceState(g.logger, vc).With(zap.String("invoked_by", interaction.Member.User.ID))
+
+	if !g.ensureVoice(ctx, session, logger, interaction.GuildID, voiceState.ChannelID) {
+		return g.previewAttachment(ctx, session, interaction, trackName, vc)
+	}
+
+	audioPath, err := g.downloadVoiceline(ctx, trackName, vc)
+	if err != nil {
+		return fmt.Errorf("error downloading preview: %w", err)
+	}
+
+	g.mu.Lock()
+	player, ok := g.guildPlayerMappings[interaction.GuildID]
+	if !ok {
+		// The bot left the channel again while the preview downloaded
+		g.mu.Unlock()
+		deleteClips(logger, []queuedClip{{audioPath: audioPath}})
+
+		return g.previewAttachment(ctx, session, interaction, trackName, vc)
+	}
+
+	player.queue = append(player.queue, queuedClip{audioPath: audioPath, memberID: memberID, trackName: trackName, collection: collection})
+	idle := player.claimPlayback()
+	g.mu.Unlock()
+
+	if idle {
+		g.songSignal <- player
+	}
+
+	_, err = util.SendFollowup(ctx, session, interaction.Interaction, &discordgo.WebhookParams{
+		Embeds: []*discordgo.MessageEmbed{embeds.PreviewEmbed(player.voiceClient.ChannelID)},
+	})
+
+	return err
+}
+
+func (g *greeterRunner) previewAttachment(ctx context.Context, session *discordgo.Session, interaction *discordgo.InteractionCreate, trackName string, vc *discordgo.VoiceStateUpdate) error {
+	audioPath, err := g.downloadVoiceline(ctx, trackName, vc)
+	if err != nil {
+		return fmt.Errorf("error downloading preview: %w", err)
+	}
+
+	defer func() {
+		if err := util.DeleteFile(audioPath); err != nil {
+			g.logger.Warn("error trying to delete file", zap.Error(err), zap.String("file_name", audioPath))
+		}
+	}()
+
+	file, err := os.Open(audioPath)
+	if err != nil {
+		return fmt.Errorf("error opening preview: %w", err)
+	}
+
+	defer file.Close()
+
+	_, err = util.SendFollowup(ctx, session, interaction.Interaction, &discordgo.WebhookParams{
+		Content: "Join a voice channel to hear previews through me, here's the clip in the meantime",
+		Files:   []*discordgo.File{{Name: "preview.mp3", ContentType: "audio/mpeg", Reader: file}},
+	})
+
+	return err
+}
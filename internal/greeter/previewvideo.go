@@ -0,0 +1,71 @@
+package greeter
+
+import (
+	"context"
+	"os"
+
+	util "salutations/pkg/util"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+)
+
+const (
+	previewVideoWidth  = 640
+	previewVideoHeight = 160
+	// maxPreviewVideoSize is the attachment limit of servers without boosts, larger previews would fail the whole message
+	maxPreviewVideoSize = 10 << 20
+)
+
+// uploadPreviewVideo is whether /upload was asked to reply with a playable preview of each created voiceline.
+func uploadPreviewVideo(interaction *discordgo.InteractionCreate) bool {
+	for _, option := range interaction.ApplicationCommandData().Options {
+		if option.Name == "preview_video" {
+			return option.BoolValue()
+		}
+	}
+
+	return false
+}
+
+// renderPreviewVideo renders the clip at filePath as an mp4 in dir and returns its path. A preview is only a convenience,
+// so one that couldn't be rendered or is too big to attach is logged and the path is empty.
+func (g *greeterRunner) renderPreviewVideo(ctx context.Context, dir string, trackName string, filePath string) string {
+	rendered, err := util.RenderPreviewVideo(ctx, dir, filePath, previewVideoWidth, previewVideoHeight, waveformColor)
+	if err != nil {
+		g.logger.Warn("unable to render preview video", zap.Error(err), zap.String("track_name", trackName))
+		return ""
+	}
+
+	defer rendered.Close()
+
+	info, err := rendered.Stat()
+	if err == nil && info.Size() <= maxPreviewVideoSize {
+		return rendered.Name()
+	}
+
+	g.logger.Warn("preview video too large to attach", zap.Error(err), zap.String("track_name", trackName))
+
+	if err := util.DeleteFile(rendered.Name()); err != nil {
+		g.logger.Warn("error trying to delete file", zap.Error(err), zap.String("file_name", rendered.Name()))
+	}
+
+	return ""
+}
+
+// openPreviewVideo opens the track's rendered preview for attaching, it's nil when the upload didn't ask for one or it
+// couldn't be rendered. The caller closes it once the message is sent.
+func (g *greeterRunner) openPreviewVideo(previews map[string]string, trackName string) *os.File {
+	path, ok := previews[trackName]
+	if !ok {
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		g.logger.Warn("unable to open preview video", zap.Error(err), zap.String("track_name", trackName))
+		return nil
+	}
+
+	return file
+}
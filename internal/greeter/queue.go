@@ -0,0 +1,102 @@
+package greeter
+
+import (
+	"fmt"
+	"strings"
+
+	"salutations/internal/embeds"
+	"salutations/internal/voicelines"
+	util "salutations/pkg/util"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/jonas747/dca"
+	"go.uber.org/zap"
+)
+
+func (clip queuedClip) embed() embeds.QueuedClip {
+	audioType := voicelines.AudioTypeFor(clip.collection)
+
+	// Track names are uuids, the first block is enough to tell clips apart
+	track, _, _ := strings.Cut(clip.trackName, "-")
+
+	// Whose it is would give a /guess round away
+	if clip.hidden {
+		return embeds.QueuedClip{AudioType: audioType, Track: track, Hidden: true}
+	}
+
+	return embeds.QueuedClip{MemberID: clip.memberID, AudioType: audioType, Track: track}
+}
+
+// guildQueue snapshots what the guild's player is doing so it can be rendered without holding the lock.
+func (g *greeterRunner) guildQueue(guildID string) embeds.GuildQueue {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	queue := embeds.GuildQueue{}
+
+	player, ok := g.guildPlayerMappings[guildID]
+	if !ok {
+		return queue
+	}
+
+	if player.nowPlaying != nil && player.encoding != nil && player.stream != nil {
+		nowPlaying := player.nowPlaying.embed()
+		queue.NowPlaying = &nowPlaying
+		queue.EncodingDone = !player.encoding.Running()
+		queue.Remaining = max(player.encoding.Stats().Duration-player.stream.PlaybackPosition(), 0)
+	}
+
+	for _, clip := range player.queue {
+		queue.Pending = append(queue.Pending, clip.embed())
+	}
+
+	return queue
+}
+
+func (g *greeterRunner) showQueue(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	queue := g.guildQueue(interaction.GuildID)
+
+	data := &discordgo.InteractionResponseData{
+		Embeds: []*discordgo.MessageEmbed{embeds.QueueEmbed(queue)},
+	}
+
+	if queue.NowPlaying != nil {
+		data.Components = embeds.QueueSkipComponent(util.CustomID{Action: queueSkipPrefix, GuildID: interaction.GuildID, Nonce: queue.NowPlaying.Track}.Encode())
+	}
+
+	return session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: data,
+	})
+}
+
+// skipClip cuts the current clip short, the stream ends the same way it does when a clip finishes so the next one plays.
+// The button only skips the clip it was shown for, pressing it after that clip finished just refreshes the queue.
+func (g *greeterRunner) skipClip(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	customID, err := util.DecodeCustomID(interaction.MessageComponentData().CustomID)
+	if err != nil || customID.GuildID != interaction.GuildID {
+		return fmt.Errorf("malformed queue skip custom id: %s", interaction.MessageComponentData().CustomID)
+	}
+
+	// Clearing the clip up front keeps the refreshed embed from showing what was just skipped
+	g.mu.Lock()
+	var encoding *dca.EncodeSession
+	if player, ok := g.guildPlayerMappings[interaction.GuildID]; ok && player.encoding != nil && player.nowPlaying != nil && player.nowPlaying.embed().Track == customID.Nonce {
+		encoding = player.encoding
+		player.nowPlaying = nil
+	}
+	g.mu.Unlock()
+
+	if encoding != nil {
+		g.logger.Info("skipping clip", zap.String("guild_id", interaction.GuildID), zap.String("skipped_by", interaction.Member.User.ID))
+		encoding.Truncate()
+	}
+
+	return session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Embeds:     []*discordgo.MessageEmbed{embeds.QueueEmbed(g.guildQueue(interaction.GuildID))},
+			Components: []discordgo.MessageComponent{},
+		},
+	})
+}
@@ -0,0 +1,94 @@
+package greeter
+
+import (
+	"context"
+	"fmt"
+
+	"salutations/internal/embeds"
+	"salutations/internal/settings"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+)
+
+// voiceJoinFlags are the self mute and self deaf flags the guild's player joins with, and whether it listens to the
+// channel. Features that have to hear the channel keep it undeafened whatever the guild picked.
+func voiceJoinFlags(guildSettings settings.GuildSettings) (mute bool, deaf bool, listen bool) {
+	listen = listensToChannel(guildSettings.WaitForSilence, guildSettings.MusicBotAction)
+
+	return guildSettings.SelfMute, !listen && !guildSettings.Undeafened, listen
+}
+
+// reconnectVoice replaces the player's voice connection with a new one to the same channel, joined with the guild's
+// current flags. The caller holds g.mu and has checked nothing is playing.
+func (g *greeterRunner) reconnectVoice(ctx context.Context, logger *zap.Logger, player *guildPlayer) bool {
+	channelID := player.voiceClient.ChannelID
+
+	if err := player.voiceClient.Disconnect(); err != nil {
+		logger.Error("error disconnecting from channel", zap.Error(err))
+		return false
+	}
+
+	close(player.done)
+	delete(g.guildPlayerMappings, player.guildID)
+
+	// The bot sound isn't played again, as far as members can tell the bot never left
+	reconnected, ok := g.connectVoice(ctx, player.session, logger, player.guildID, channelID)
+	if !ok {
+		return false
+	}
+
+	g.guildPlayerMappings[player.guildID] = reconnected
+
+	return true
+}
+
+// rejoin reconnects to the guild's voice channel so changed join flags take effect without waiting for the bot to
+// leave on its own.
+func (g *greeterRunner) rejoin(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	ctx := context.Background()
+	logger := g.logger.With(zap.String("guild_id", interaction.GuildID))
+
+	g.mu.Lock()
+	embed := g.rejoinVoice(ctx, logger, interaction.GuildID)
+	g.mu.Unlock()
+
+	return g.respondEphemeral(session, interaction, embed)
+}
+
+// rejoinVoice is /rejoin's reconnect, the caller holds g.mu.
+func (g *greeterRunner) rejoinVoice(ctx context.Context, logger *zap.Logger, guildID string) *discordgo.MessageEmbed {
+	player, ok := g.guildPlayerMappings[guildID]
+	if !ok {
+		return embeds.SettingsUpdatedEmbed("I'm not in a voice channel right now, I'll join with this server's settings next time I do")
+	}
+
+	if player.voiceState != NotPlaying || len(player.queue) > 0 {
+		return embeds.ErrorMessageEmbed("I'm in the middle of a greeting, try again once the queue is empty")
+	}
+
+	channelID := player.voiceClient.ChannelID
+	logger = logger.With(zap.String("channel_id", channelID))
+	logger.Info("rejoining voice channel on request")
+
+	if !g.reconnectVoice(ctx, logger, player) {
+		return embeds.ErrorMessageEmbed("I couldn't get back into the voice channel, I'll try again the next time someone joins")
+	}
+
+	mute, deaf, _ := voiceJoinFlags(g.guildSettings(ctx, guildID))
+
+	return embeds.SettingsUpdatedEmbed(fmt.Sprintf("Rejoined <#%s> %s", channelID, voiceFlagsText(mute, deaf)))
+}
+
+func voiceFlagsText(mute bool, deaf bool) string {
+	switch {
+	case mute && deaf:
+		return "muted and deafened"
+	case mute:
+		return "muted"
+	case deaf:
+		return "deafened"
+	default:
+		return "unmuted and undeafened"
+	}
+}
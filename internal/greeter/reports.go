@@ -0,0 +1,130 @@
+package greeter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"salutations/internal/embeds"
+	util "salutations/pkg/util"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const reportStatusOpen = "open"
+
+type reportRecord struct {
+	GuildID    string    `firestore:"guild_id"`
+	MemberID   string    `firestore:"member_id"`
+	Collection string    `firestore:"collection"`
+	TrackName  string    `firestore:"track_name"`
+	ReportedBy string    `firestore:"reported_by"`
+	ReportedAt time.Time `firestore:"reported_at"`
+	// Reason is only set for clips flagged by the content screener
+	Reason string `firestore:"reason,omitempty"`
+	Status string `firestore:"status"`
+}
+
+// reportID keys a report by guild, track and reporter so reporting the same track twice doesn't pile up duplicates.
+func reportID(guildID string, trackName string, reporterID string) string {
+	return fmt.Sprintf("%s_%s_%s", guildID, trackName, reporterID)
+}
+
+// fileReport returns false without an error when the reporter has already reported the track in this guild.
+func (g *greeterRunner) fileReport(ctx context.Context, record reportRecord) (bool, error) {
+	err := g.firebaseAdapter.CreateDocument(ctx, ReportsCollection, reportID(record.GuildID, record.TrackName, record.ReportedBy), record)
+	if err != nil {
+		if status.Code(err) == codes.AlreadyExists {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("error creating report: %w", err)
+	}
+
+	return true, nil
+}
+
+// notifyModLog posts the report to the guild's mod log channel, reports are still kept when the guild hasn't set one.
+func (g *greeterRunner) notifyModLog(ctx context.Context, session *discordgo.Session, record reportRecord) {
+	channelID := g.guildSettings(ctx, record.GuildID).ModLogChannel
+	if channelID == "" {
+		return
+	}
+
+	audioType := queuedClip{collection: record.Collection}.embed().AudioType
+	object := "voicelines/" + record.TrackName
+
+	// Library reports carry the entry id as the track and the publisher as the member
+	if record.Collection == LibraryCollection {
+		audioType = "library clip"
+		object = libraryObject(record.TrackName)
+	}
+
+	trackURL, err := g.firebaseAdapter.GenerateSignedURL(g.bucket, object)
+	if err != nil {
+		g.logger.Warn("unable to generate signed url for reported track", zap.Error(err), zap.String("track_name", record.TrackName))
+	}
+
+	reportedBy := fmt.Sprintf("<@%s>", record.ReportedBy)
+	if record.ReportedBy == screenerReporterID {
+		reportedBy = fmt.Sprintf("Content screening, %s", record.Reason)
+	}
+
+	if _, err := session.ChannelMessageSendEmbed(channelID, embeds.ModLogReportEmbed(record.MemberID, audioType, record.TrackName, trackURL, reportedBy)); err != nil {
+		g.logger.Warn("unable to post report to mod log", zap.Error(err), zap.String("guild_id", record.GuildID), zap.String("channel_id", channelID))
+	}
+}
+
+// report handles both the button on now playing notifications, which carries the track in its custom id,
+// and the select menu on voiceline listings.
+func (g *greeterRunner) report(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	ctx := context.Background()
+
+	customID, err := util.DecodeCustomID(interaction.MessageComponentData().CustomID)
+	if err != nil {
+		return err
+	}
+
+	var trackNames []string
+	switch len(customID.Args) {
+	case 1:
+		trackNames = customID.Args
+	case 0:
+		trackNames = interaction.MessageComponentData().Values
+	default:
+		return fmt.Errorf("malformed report custom id: %s", interaction.MessageComponentData().CustomID)
+	}
+
+	memberID, collection := customID.MemberID, customID.Collection
+
+	var filed, alreadyReported int
+	for _, trackName := range trackNames {
+		record := reportRecord{
+			GuildID:    interaction.GuildID,
+			MemberID:   memberID,
+			Collection: collection,
+			TrackName:  trackName,
+			ReportedBy: interaction.Member.User.ID,
+			ReportedAt: g.clock.Now(),
+			Status:     reportStatusOpen,
+		}
+
+		created, err := g.fileReport(ctx, record)
+		if err != nil {
+			return err
+		}
+
+		if !created {
+			alreadyReported++
+			continue
+		}
+
+		filed++
+		g.notifyModLog(ctx, session, record)
+	}
+
+	return g.respondEphemeral(session, interaction, embeds.ReportFiledEmbed(filed, alreadyReported))
+}
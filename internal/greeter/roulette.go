@@ -0,0 +1,106 @@
+package greeter
+
+import (
+	"context"
+	"fmt"
+
+	"salutations/internal/embeds"
+	"salutations/internal/logging"
+	util "salutations/pkg/util"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+)
+
+// voiceChannelMembers lists the users other than bots in the given voice channel.
+func voiceChannelMembers(session *discordgo.Session, guildID string, channelID string) ([]string, error) {
+	guild, err := session.State.Guild(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	session.State.RLock()
+	voiceStates := append([]*discordgo.VoiceState{}, guild.VoiceStates...)
+	session.State.RUnlock()
+
+	memberIDs := []string{}
+	for _, voiceState := range voiceStates {
+		if voiceState.ChannelID != channelID {
+			continue
+		}
+
+		if member, err := util.ResolveMember(context.Background(), session, guildID, voiceState.UserID); err == nil && member.User.Bot {
+			continue
+		}
+
+		memberIDs = append(memberIDs, voiceState.UserID)
+	}
+
+	return memberIDs, nil
+}
+
+// pickRouletteMember picks a random member out of candidates who has an intro to play and hasn't opted out of them.
+func (g *greeterRunner) pickRouletteMember(ctx context.Context, candidates []string) (string, error) {
+	shuffled := append([]string{}, candidates...)
+	g.rand.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+
+	for _, memberID := range shuffled {
+		blacklisted, err := g.isInBlacklist(ctx, memberID, WelcomeCollection)
+		if err != nil {
+			return "", err
+		}
+
+		if blacklisted {
+			continue
+		}
+
+		// Members without an intro document or with their intros turned off are passed over
+		trackNames, err := g.retrieveGreetingTracks(ctx, WelcomeCollection, memberID)
+		if err == nil && len(trackNames) > 0 {
+			return memberID, nil
+		}
+	}
+
+	return "", nil
+}
+
+func (g *greeterRunner) roulette(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	ctx := context.Background()
+
+	voiceState, err := session.State.VoiceState(interaction.GuildID, interaction.Member.User.ID)
+	if err != nil || voiceState.ChannelID == "" {
+		return g.respondEphemeral(session, interaction, embeds.ErrorMessageEmbed("Join a voice channel to spin the roulette"))
+	}
+
+	candidates, err := voiceChannelMembers(session, interaction.GuildID, voiceState.ChannelID)
+	if err != nil {
+		return fmt.Errorf("error listing voice channel members: %w", err)
+	}
+
+	memberID, err := g.pickRouletteMember(ctx, candidates)
+	if err != nil {
+		return fmt.Errorf("error picking roulette member: %w", err)
+	}
+
+	if memberID == "" {
+		return g.respondEphemeral(session, interaction, embeds.ErrorMessageEmbed("Nobody in your voice channel has an intro to play"))
+	}
+
+	err = session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{embeds.RouletteEmbed(memberID)},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	// The roulette plays through the same path as a real join so caps, chains and dry runs all apply
+	vc := &discordgo.VoiceStateUpdate{VoiceState: &discordgo.VoiceState{GuildID: interaction.GuildID, ChannelID: voiceState.ChannelID, UserID: memberID}}
+	logger := logging.WithVoiceState(g.logger, vc).With(zap.String("invoked_by", interaction.Member.User.ID))
+
+	go g.greet(ctx, session, logger, vc, WelcomeCollection, voiceState.ChannelID, g.clock.Now(), false)
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package greeter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"salutations/internal/screening"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+)
+
+// screenerReporterID marks reports filed by the content screener rather than a member.
+const screenerReporterID = "screening"
+
+// transcribeUpload transcribes the clip when uploads are transcribed and rewinds file for whatever reads it next. A clip
+// that can't be transcribed is stored without a transcript rather than losing the upload.
+func (g *greeterRunner) transcribeUpload(ctx context.Context, file *os.File) (string, error) {
+	if g.transcriber == nil {
+		return "", nil
+	}
+
+	transcript, err := g.transcriber.Transcribe(ctx, file)
+	if err != nil {
+		g.logger.Warn("unable to transcribe upload, storing it without a transcript", zap.Error(err))
+		transcript = ""
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("error rewinding transcribed file: %w", err)
+	}
+
+	return transcript, nil
+}
+
+// screenUpload runs the screener for guilds with strict mode on and rewinds file for the upload after it,
+// a screener that fails flags the clip for review rather than losing the upload. Screeners that can judge a
+// transcript are given the upload's transcript instead of the clip when there is one.
+func (g *greeterRunner) screenUpload(ctx context.Context, guildID string, file *os.File, transcript string) (screening.Result, error) {
+	if !g.guildSettings(ctx, guildID).StrictScreening {
+		return screening.Result{Verdict: screening.Allow}, nil
+	}
+
+	var result screening.Result
+	var err error
+
+	if transcriptScreener, ok := g.screener.(screening.TranscriptScreener); ok && transcript != "" {
+		result, err = transcriptScreener.ScreenTranscript(ctx, transcript)
+	} else {
+		result, err = g.screener.Screen(ctx, file)
+	}
+
+	if err != nil {
+		g.logger.Warn("unable to screen upload, flagging it for review", zap.Error(err), zap.String("guild_id", guildID))
+		result = screening.Result{Verdict: screening.Flag, Reason: "screening failed"}
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return screening.Result{}, fmt.Errorf("error rewinding screened file: %w", err)
+	}
+
+	return result, nil
+}
+
+// flagUpload files a flagged clip into the moderation queue the same way a member's report would be.
+func (g *greeterRunner) flagUpload(ctx context.Context, session *discordgo.Session, guildID string, memberID string, collection string, trackName string, reason string) {
+	record := reportRecord{
+		GuildID:    guildID,
+		MemberID:   memberID,
+		Collection: collection,
+		TrackName:  trackName,
+		ReportedBy: screenerReporterID,
+		ReportedAt: g.clock.Now(),
+		Reason:     reason,
+		Status:     reportStatusOpen,
+	}
+
+	if _, err := g.fileReport(ctx, record); err != nil {
+		g.logger.Warn("unable to file screening report", zap.Error(err), zap.String("track_name", trackName))
+		return
+	}
+
+	g.notifyModLog(ctx, session, record)
+}
+
+// flagUploads files every track of an upload that screening flagged.
+func (g *greeterRunner) flagUploads(ctx context.Context, session *discordgo.Session, request UploadRequest, result UploadResult) {
+	for trackName, reason := range result.Flagged {
+		g.flagUpload(ctx, session, request.GuildID, request.MemberID, request.Collection, trackName, reason)
+	}
+}
@@ -0,0 +1,307 @@
+package greeter
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"time"
+
+	"salutations/internal/embeds"
+	"salutations/internal/screening"
+	"salutations/internal/voicelines"
+	util "salutations/pkg/util"
+
+	"go.uber.org/zap"
+)
+
+// zipRejectedText is what a zip entry turned away by the loudness limit is reported as, the entry's loudness isn't
+// kept once it's been measured
+const zipRejectedText = "That clip is too loud for this server, try turning it down before uploading"
+
+// ListResult is every voiceline a member has in a collection, in the order they're played in.
+type ListResult struct {
+	MemberID   string
+	Collection string
+	Voicelines []voicelines.Voiceline
+}
+
+// TrackNames are the listed voicelines' track names, in the same order.
+func (r ListResult) TrackNames() []string {
+	names := make([]string, 0, len(r.Voicelines))
+	for _, voiceline := range r.Voicelines {
+		names = append(names, voiceline.TrackName)
+	}
+
+	return names
+}
+
+// URLs are the listed voicelines' signed urls, in the same order.
+func (r ListResult) URLs() []string {
+	urls := make([]string, 0, len(r.Voicelines))
+	for _, voiceline := range r.Voicelines {
+		urls = append(urls, voiceline.URL)
+	}
+
+	return urls
+}
+
+// ListVoicelines signs a url for each of the member's voicelines in collection, failing with
+// voicelines.ErrNoVoicelines when they've never had one.
+func (g *greeterRunner) ListVoicelines(ctx context.Context, collection string, memberID string) (ListResult, error) {
+	listed, err := g.voicelineService.List(ctx, collection, memberID)
+	if err != nil {
+		return ListResult{}, err
+	}
+
+	return ListResult{MemberID: memberID, Collection: collection, Voicelines: listed}, nil
+}
+
+// Transcripts are the listed voicelines' transcripts in the same order, empty for clips that were never transcribed.
+func (r ListResult) Transcripts() []string {
+	transcripts := make([]string, 0, len(r.Voicelines))
+	for _, voiceline := range r.Voicelines {
+		transcripts = append(transcripts, voiceline.Transcript)
+	}
+
+	return transcripts
+}
+
+// Listed is the listing as /voicelines shows it.
+func (r ListResult) Listed() []embeds.ListedVoiceline {
+	listed := make([]embeds.ListedVoiceline, 0, len(r.Voicelines))
+	for _, voiceline := range r.Voicelines {
+		listed = append(listed, embeds.ListedVoiceline{
+			URL:         voiceline.URL,
+			ShortID:     voicelines.ShortID(voiceline.TrackName),
+			Transcript:  voiceline.Transcript,
+			WaveformURL: voiceline.WaveformURL,
+		})
+	}
+
+	return listed
+}
+
+// UploadRequest is who an upload is for and what applies to every track it creates.
+type UploadRequest struct {
+	GuildID    string
+	Collection string
+	MemberID   string
+	AddedBy    string
+	// SharedWith are the other members the tracks are added for
+	SharedWith []string
+	// ExpiresAt is when the tracks are archived, zero keeps them until they're deleted
+	ExpiresAt time.Time
+	// PreviewVideo renders a playable video of each track, only single clip uploads are previewed
+	PreviewVideo bool
+}
+
+func (r UploadRequest) owners() []string {
+	return append([]string{r.MemberID}, r.SharedWith...)
+}
+
+// UploadRejection is a clip that was turned away by the guild's content screening or loudness limit.
+type UploadRejection struct {
+	Name string
+	// Reason is why, worded to be shown to whoever uploaded it
+	Reason string
+}
+
+// UploadResult is what an upload created. Tracks screening let through but wants a moderator to look at are in
+// both Created and Flagged, Flagged maps their track name to screening's reason.
+type UploadResult struct {
+	Created  []voicelines.Voiceline
+	Rejected []UploadRejection
+	Failed   []voicelines.TrackFailure
+	Flagged  map[string]string
+	// Skipped are zip entries that never made it to an upload since they weren't audio or broke the zip limits
+	Skipped []util.EntryError
+	// PreviewVideos maps track names to the path of their rendered preview video, which lives in the upload's dir
+	PreviewVideos map[string]string
+}
+
+// Err joins the errors of every clip that failed, nil when none did.
+func (r UploadResult) Err() error {
+	return voicelines.JoinFailures(r.Failed)
+}
+
+func (r *UploadResult) flag(trackName string, result screening.Result) {
+	if result.Verdict != screening.Flag {
+		return
+	}
+
+	if r.Flagged == nil {
+		r.Flagged = map[string]string{}
+	}
+
+	r.Flagged[trackName] = result.Reason
+}
+
+// annotateTrack records what was derived from the clip on the track of every member holding it, annotations that
+// can't be saved only leave the track without them.
+func (g *greeterRunner) annotateTrack(ctx context.Context, collection string, memberIDs []string, clip storedClip) {
+	fields := clip.annotations()
+	if len(fields) == 0 {
+		return
+	}
+
+	for _, memberID := range memberIDs {
+		err := g.updateTrackRecord(ctx, collection, memberID, clip.trackName, func(record map[string]interface{}) {
+			maps.Copy(record, fields)
+		})
+		if err != nil {
+			g.logger.Warn("unable to annotate track", zap.Error(err), zap.String("track_name", clip.trackName), zap.String("member_id", memberID))
+		}
+	}
+}
+
+// finishUpload shares and expires a freshly added track as the request asks, annotates it for everyone holding it
+// and signs a url for it.
+func (g *greeterRunner) finishUpload(ctx context.Context, request UploadRequest, clip storedClip) (voicelines.Voiceline, error) {
+	trackName := clip.trackName
+
+	if err := g.shareVoiceline(ctx, request.Collection, request.SharedWith, request.AddedBy, trackName); err != nil {
+		return voicelines.Voiceline{}, err
+	}
+
+	g.annotateTrack(ctx, request.Collection, request.owners(), clip)
+
+	if err := g.expireVoiceline(ctx, request.Collection, request.owners(), trackName, request.ExpiresAt); err != nil {
+		return voicelines.Voiceline{}, err
+	}
+
+	signedURL, err := g.firebaseAdapter.GenerateSignedURL(g.bucket, voicelines.Object(trackName))
+	if err != nil {
+		return voicelines.Voiceline{}, fmt.Errorf("error generating signed url %w", err)
+	}
+
+	return voicelines.Voiceline{TrackName: trackName, URL: signedURL, Transcript: clip.transcript}, nil
+}
+
+// UploadVoiceline converts, screens and stores a single audio file, any intermediate files are created in dir. A clip
+// that's turned away is reported in the result, only failing to store it is an error.
+func (g *greeterRunner) UploadVoiceline(ctx context.Context, dir string, request UploadRequest, file *os.File) (UploadResult, error) {
+	audio, err := g.canonicalizeUpload(ctx, dir, file)
+	if err != nil {
+		return UploadResult{}, fmt.Errorf("error converting upload to mp3: %w", err)
+	}
+
+	defer audio.cleanup(g.logger)
+
+	transcript, err := g.transcribeUpload(ctx, audio.file)
+	if err != nil {
+		return UploadResult{}, err
+	}
+
+	screened, err := g.screenUpload(ctx, request.GuildID, audio.file, transcript)
+	if err != nil {
+		return UploadResult{}, err
+	}
+
+	if screened.Verdict == screening.Reject {
+		return UploadResult{Rejected: []UploadRejection{{Name: file.Name(), Reason: "That clip was rejected by this server's content screening"}}}, nil
+	}
+
+	loudness, err := g.enforceLoudness(ctx, request.GuildID, audio.file)
+	if err != nil {
+		return UploadResult{}, err
+	}
+
+	defer loudness.cleanup(g.logger)
+
+	if loudness.rejected {
+		return UploadResult{Rejected: []UploadRejection{{Name: file.Name(), Reason: tooLoudText(loudness.loudness)}}}, nil
+	}
+
+	if err := g.voicelineService.EnsureDocument(ctx, request.Collection, request.MemberID); err != nil {
+		return UploadResult{}, fmt.Errorf("error creating firestore document: %w", err)
+	}
+
+	// The upload closes the file but leaves it on disk for the waveform to be rendered from
+	trackName, err := g.addVoiceline(ctx, request.GuildID, request.Collection, request.MemberID, request.AddedBy, loudness.file)
+	if text := storageQuotaText(err); text != "" {
+		return UploadResult{Rejected: []UploadRejection{{Name: file.Name(), Reason: text}}}, nil
+	}
+
+	if err != nil {
+		return UploadResult{}, fmt.Errorf("error attempting to add voiceline: %w", err)
+	}
+
+	clip := storedClip{trackName: trackName, transcript: transcript, waveform: g.storeWaveform(ctx, trackName, loudness.file.Name())}
+
+	voiceline, err := g.finishUpload(ctx, request, clip)
+	if err != nil {
+		return UploadResult{}, err
+	}
+
+	result := UploadResult{Created: []voicelines.Voiceline{voiceline}}
+	result.flag(trackName, screened)
+
+	if request.PreviewVideo {
+		if preview := g.renderPreviewVideo(ctx, dir, trackName, loudness.file.Name()); preview != "" {
+			result.PreviewVideos = map[string]string{trackName: preview}
+		}
+	}
+
+	return result, nil
+}
+
+// UploadVoicelineZip uploads every clip in the zip at path concurrently, one clip failing or being turned away doesn't
+// stop the others. It only fails outright when the zip can't be opened, util.ErrTooManyEntries among others.
+func (g *greeterRunner) UploadVoicelineZip(ctx context.Context, dir string, request UploadRequest, path string) (UploadResult, error) {
+	archive, entryErrors, err := util.OpenZip(path, zipUploadLimits)
+	if err != nil {
+		return UploadResult{}, err
+	}
+
+	defer archive.Close()
+
+	result := UploadResult{Skipped: entryErrors}
+	if len(archive.Entries()) == 0 {
+		return result, nil
+	}
+
+	if err := g.voicelineService.EnsureDocument(ctx, request.Collection, request.MemberID); err != nil {
+		return UploadResult{}, fmt.Errorf("error creating firestore document: %w", err)
+	}
+
+	type entryOutcome struct {
+		voiceline voicelines.Voiceline
+		screened  screening.Result
+	}
+
+	pool := util.NewPool[entryOutcome](ctx, g.uploadConcurrency)
+
+	for _, entry := range archive.Entries() {
+		pool.Submit(func(uploadCtx context.Context) (entryOutcome, error) {
+			clip, screened, err := g.uploadZipEntry(uploadCtx, dir, request.GuildID, request.Collection, request.MemberID, request.AddedBy, entry)
+			if err != nil || clip.trackName == "" {
+				return entryOutcome{screened: screened}, err
+			}
+
+			voiceline, err := g.finishUpload(uploadCtx, request, clip)
+
+			return entryOutcome{voiceline: voiceline, screened: screened}, err
+		})
+	}
+
+	for i, outcome := range pool.Wait() {
+		name := archive.Entries()[i].Name
+
+		switch {
+		case storageQuotaText(outcome.Err) != "":
+			result.Rejected = append(result.Rejected, UploadRejection{Name: name, Reason: storageQuotaText(outcome.Err)})
+		case outcome.Err != nil:
+			result.Failed = append(result.Failed, voicelines.TrackFailure{Name: name, Err: outcome.Err})
+		case outcome.Value.screened.Verdict == screening.Reject:
+			result.Rejected = append(result.Rejected, UploadRejection{Name: name, Reason: "That clip was rejected by this server's content screening"})
+		case outcome.Value.voiceline.TrackName == "":
+			result.Rejected = append(result.Rejected, UploadRejection{Name: name, Reason: zipRejectedText})
+		default:
+			result.Created = append(result.Created, outcome.Value.voiceline)
+			result.flag(outcome.Value.voiceline.TrackName, outcome.Value.screened)
+		}
+	}
+
+	return result, nil
+}
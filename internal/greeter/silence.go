@@ -0,0 +1,107 @@
+package greeter
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	firebaseAdapter "salutations/internal/firebase"
+	"salutations/internal/settings"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+)
+
+const (
+	// silenceGap is how long nobody has to have spoken before a greeting plays
+	silenceGap = time.Millisecond * 750
+	// maxSilenceWait stops a lively channel from holding a greeting back forever
+	maxSilenceWait = time.Second * 5
+)
+
+// guildSettings falls back to the defaults when settings aren't configured or can't be read, greetings shouldn't stop over it.
+func (g *greeterRunner) guildSettings(ctx context.Context, guildID string) settings.GuildSettings {
+	if g.settings == nil {
+		return settings.GuildSettings{GuildID: guildID}
+	}
+
+	guildSettings, err := g.settings.Get(ctx, guildID)
+	if err != nil {
+		if !errors.Is(err, settings.ErrNotFound) {
+			g.logger.Warn("unable to get guild settings, using defaults", zap.Error(err), zap.String("guild_id", guildID))
+		}
+
+		return settings.GuildSettings{GuildID: guildID}
+	}
+
+	return *guildSettings
+}
+
+// guildStorage is where the guild's own objects are kept, the greeter's bucket unless the guild has storage of its own.
+func (g *greeterRunner) guildStorage(ctx context.Context, guildID string) firebaseAdapter.Location {
+	return g.guildSettings(ctx, guildID).Storage(g.bucket)
+}
+
+// trackVoiceActivity records when anyone in the player's channel last spoke, from both received audio and speaking
+// events, and when a bot last sent audio.
+func (g *greeterRunner) trackVoiceActivity(guildPlayer *guildPlayer) {
+	markActivity := func() {
+		g.mu.Lock()
+		guildPlayer.lastVoiceActivity = g.clock.Now()
+		g.mu.Unlock()
+	}
+
+	guildPlayer.voiceClient.AddHandler(func(_ *discordgo.VoiceConnection, update *discordgo.VoiceSpeakingUpdate) {
+		if update.Speaking {
+			markActivity()
+			g.markBotSpeaker(guildPlayer, update)
+		}
+	})
+
+	guildPlayer.voiceClient.RLock()
+	packets := guildPlayer.voiceClient.OpusRecv
+	guildPlayer.voiceClient.RUnlock()
+
+	for {
+		select {
+		case packet, ok := <-packets:
+			if !ok {
+				return
+			}
+
+			markActivity()
+			g.markBotAudio(guildPlayer, packet.SSRC)
+		case <-guildPlayer.done:
+			return
+		}
+	}
+}
+
+// waitForSilence blocks until the channel has been quiet for silenceGap, giving up after maxSilenceWait.
+func (g *greeterRunner) waitForSilence(guildPlayer *guildPlayer) {
+	if !guildPlayer.waitForSilence {
+		return
+	}
+
+	deadline := g.clock.Now().Add(maxSilenceWait)
+
+	for {
+		g.mu.RLock()
+		quietFor := g.clock.Now().Sub(guildPlayer.lastVoiceActivity)
+		g.mu.RUnlock()
+
+		remaining := deadline.Sub(g.clock.Now())
+		if quietFor >= silenceGap || remaining <= 0 {
+			return
+		}
+
+		wake := make(chan struct{})
+		g.clock.AfterFunc(min(silenceGap-quietFor, remaining), func() { close(wake) })
+
+		select {
+		case <-wake:
+		case <-guildPlayer.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package greeter
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"salutations/internal/embeds"
+	firebaseAdapter "salutations/internal/firebase"
+	util "salutations/pkg/util"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Batch gets are kept small so a single request never carries an entire large guild
+const statsBatchSize = 100
+
+type greetingPlayRecord struct {
+	GuildID    string    `firestore:"guild_id"`
+	UserID     string    `firestore:"user_id"`
+	Collection string    `firestore:"collection"`
+	PlayedAt   time.Time `firestore:"played_at"`
+}
+
+type guildStats struct {
+	Voicelines        int
+	StorageBytes      int64
+	StorageQuota      int64
+	GreetingsThisWeek int64
+	SkippedThisWeek   int64
+	TopUploaderID     string
+	TopUploaderCount  int
+	Blacklisted       int
+}
+
+func (g *greeterRunner) recordGreetingPlay(ctx context.Context, logger *zap.Logger, guildID string, userID string, collection string) {
+	recordID, err := uuid.NewV7()
+	if err != nil {
+		logger.Warn("unable to generate greeting play id", zap.Error(err))
+		return
+	}
+
+	err = g.firebaseAdapter.CreateDocument(ctx, GreetingPlaysCollection, recordID.String(), greetingPlayRecord{
+		GuildID:    guildID,
+		UserID:     userID,
+		Collection: collection,
+		PlayedAt:   g.clock.Now(),
+	})
+	if err != nil {
+		logger.Warn("unable to record greeting play", zap.Error(err))
+	}
+}
+
+func (g *greeterRunner) getDocumentsInBatches(ctx context.Context, collection string, documents []string) (map[string]map[string]interface{}, error) {
+	found := map[string]map[string]interface{}{}
+
+	for batch := range slices.Chunk(documents, statsBatchSize) {
+		batchFound, err := g.firebaseAdapter.GetDocumentsByID(ctx, collection, batch)
+		if err != nil {
+			return nil, err
+		}
+
+		for id, document := range batchFound {
+			found[id] = document
+		}
+	}
+
+	return found, nil
+}
+
+// collectGuildStats aggregates the voicelines of every given member and the storage uploads in the guild take up, along
+// with the greetings played and skipped in the guild over the last week.
+func (g *greeterRunner) collectGuildStats(ctx context.Context, guildID string, memberIDs []string) (*guildStats, error) {
+	stats := &guildStats{}
+	uploads := map[string]int{}
+	trackNames := []string{}
+
+	for _, collection := range []string{WelcomeCollection, OutroCollection} {
+		audioListKey := OutroArrayKey
+		if collection == WelcomeCollection {
+			audioListKey = IntroArrayKey
+		}
+
+		documents, err := g.getDocumentsInBatches(ctx, collection, memberIDs)
+		if err != nil {
+			return nil, fmt.Errorf("error getting voiceline documents: %w", err)
+		}
+
+		for _, document := range documents {
+			tracks, ok := document[audioListKey].([]interface{})
+			if !ok {
+				continue
+			}
+
+			for _, track := range tracks {
+				record, ok := track.(map[string]interface{})
+				if !ok {
+					continue
+				}
+
+				if trackName, ok := record["track_name"].(string); ok {
+					trackNames = append(trackNames, trackName)
+				}
+
+				if addedBy, ok := record["added_by"].(string); ok {
+					uploads[addedBy]++
+				}
+			}
+		}
+	}
+
+	stats.Voicelines = len(trackNames)
+
+	for uploaderID, count := range uploads {
+		if count > stats.TopUploaderCount || (count == stats.TopUploaderCount && uploaderID < stats.TopUploaderID) {
+			stats.TopUploaderID, stats.TopUploaderCount = uploaderID, count
+		}
+	}
+
+	usage, quota, err := g.storageUsage(ctx, guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	stats.StorageBytes, stats.StorageQuota = usage.Bytes, quota
+
+	// Requires a composite index on guild_id and played_at
+	greetingsThisWeek, err := g.firebaseAdapter.CountDocuments(ctx, GreetingPlaysCollection,
+		firebaseAdapter.QueryFilter{Path: "guild_id", Op: "==", Value: guildID},
+		firebaseAdapter.QueryFilter{Path: "played_at", Op: ">=", Value: g.clock.Now().Add(-time.Hour * 24 * 7)},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error counting greetings played: %w", err)
+	}
+
+	stats.GreetingsThisWeek = greetingsThisWeek
+
+	skippedThisWeek, err := g.firebaseAdapter.CountDocuments(ctx, GreetingSkipsCollection,
+		firebaseAdapter.QueryFilter{Path: "guild_id", Op: "==", Value: guildID},
+		firebaseAdapter.QueryFilter{Path: "played_at", Op: ">=", Value: g.clock.Now().Add(-time.Hour * 24 * 7)},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error counting greetings skipped: %w", err)
+	}
+
+	stats.SkippedThisWeek = skippedThisWeek
+
+	blacklisted, err := g.getDocumentsInBatches(ctx, BlacklistCollection, memberIDs)
+	if err != nil {
+		return nil, fmt.Errorf("error getting blacklist documents: %w", err)
+	}
+
+	stats.Blacklisted = len(blacklisted)
+
+	return stats, nil
+}
+
+func (g *greeterRunner) guildStats(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	ctx := context.Background()
+
+	guild, err := session.State.Guild(interaction.GuildID)
+	if err != nil {
+		return fmt.Errorf("error getting guild from state: %w", err)
+	}
+
+	memberIDs := make([]string, 0, len(guild.Members))
+	for _, member := range guild.Members {
+		if !member.User.Bot {
+			memberIDs = append(memberIDs, member.User.ID)
+		}
+	}
+
+	stats, err := g.collectGuildStats(ctx, guild.ID, memberIDs)
+	if err != nil {
+		return err
+	}
+
+	_, err = util.SendFollowup(ctx, session, interaction.Interaction, &discordgo.WebhookParams{
+		Embeds: []*discordgo.MessageEmbed{
+			embeds.GuildStatsEmbed(guild, stats.Voicelines, stats.StorageBytes, stats.StorageQuota, stats.GreetingsThisWeek, stats.SkippedThisWeek, stats.TopUploaderID, stats.TopUploaderCount, stats.Blacklisted),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error sending guild stats embed: %w", err)
+	}
+
+	return nil
+}
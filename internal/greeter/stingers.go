@@ -0,0 +1,239 @@
+package greeter
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+
+	"salutations/internal/embeds"
+	"salutations/internal/settings"
+	util "salutations/pkg/util"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+)
+
+const (
+	// stingerBefore plays a role's stinger ahead of the member's own intro, it's what /stinger set picks by default
+	stingerBefore  = "before"
+	stingerAfter   = "after"
+	stingerInstead = "instead"
+	// maxStingerBytes keeps stingers to a fanfare, they play on top of the member's own intro
+	maxStingerBytes = 1 << 20
+	// maxRoleStingers keeps /stinger list readable and the settings document small
+	maxRoleStingers = 10
+)
+
+func stingerPlacement(mode string) string {
+	switch mode {
+	case stingerAfter:
+		return "plays after the member's intro"
+	case stingerInstead:
+		return "plays instead of the member's intro"
+	default:
+		return "plays before the member's intro"
+	}
+}
+
+// rolePosition is where the role sits in the guild's role list, roles missing from state sort below every other.
+func rolePosition(session *discordgo.Session, guildID string, roleID string) int {
+	role, err := session.State.Role(guildID, roleID)
+	if err != nil {
+		return -1
+	}
+
+	return role.Position
+}
+
+// memberStinger picks the stinger of the highest role the member holds that has one, false when none of their roles do.
+func memberStinger(session *discordgo.Session, guildID string, stingers map[string]settings.RoleStinger, roleIDs []string) (settings.RoleStinger, bool) {
+	var (
+		picked     settings.RoleStinger
+		pickedRole string
+		found      bool
+	)
+
+	for _, roleID := range roleIDs {
+		stinger, ok := stingers[roleID]
+		if !ok {
+			continue
+		}
+
+		// Roles at the same position are told apart by id so every instance picks the same one
+		if found && cmp.Or(cmp.Compare(rolePosition(session, guildID, roleID), rolePosition(session, guildID, pickedRole)), cmp.Compare(pickedRole, roleID)) <= 0 {
+			continue
+		}
+
+		picked, pickedRole, found = stinger, roleID, true
+	}
+
+	return picked, found
+}
+
+// memberRoles are the roles of the member the voice state is for, voice states from the gateway carry the member but
+// ones that don't are looked up in state.
+func memberRoles(session *discordgo.Session, vc *discordgo.VoiceStateUpdate) []string {
+	if vc.Member != nil {
+		return vc.Member.Roles
+	}
+
+	member, err := session.State.Member(vc.GuildID, vc.UserID)
+	if err != nil {
+		return nil
+	}
+
+	return member.Roles
+}
+
+// downloadGreetingWithStinger is downloadGreeting with the stinger of the member's roles played around or in place of
+// their intro. Outros don't have stingers, and a member whose stinger can't be downloaded still gets their intro.
+func (g *greeterRunner) downloadGreetingWithStinger(ctx context.Context, session *discordgo.Session, logger *zap.Logger, collection string, vc *discordgo.VoiceStateUpdate) ([]queuedClip, bool) {
+	if collection != WelcomeCollection {
+		return g.downloadGreeting(ctx, logger, collection, vc)
+	}
+
+	guildSettings := g.guildSettings(ctx, vc.GuildID)
+
+	stinger, ok := memberStinger(session, vc.GuildID, guildSettings.RoleStingers, memberRoles(session, vc))
+	if !ok {
+		return g.downloadGreeting(ctx, logger, collection, vc)
+	}
+
+	audioPath, err := g.downloadObject(ctx, guildSettings.Storage(g.bucket), stinger.Object, vc)
+	if err != nil {
+		logger.Error("failed to download role stinger", zap.Error(err), zap.String("object", stinger.Object))
+		return g.downloadGreeting(ctx, logger, collection, vc)
+	}
+
+	logger.Debug("role stinger selected", zap.String("object", stinger.Object), zap.String("mode", stinger.Mode))
+
+	// Stingers aren't announced since they're the role's rather than the member's
+	stingerClip := queuedClip{audioPath: audioPath, memberID: vc.UserID, trackName: path.Base(stinger.Object), collection: collection}
+
+	if stinger.Mode == stingerInstead {
+		return []queuedClip{stingerClip}, true
+	}
+
+	// Members without an intro of their own still get their role's fanfare
+	clips, ok := g.downloadGreeting(ctx, logger, collection, vc)
+	if !ok {
+		return []queuedClip{stingerClip}, true
+	}
+
+	if stinger.Mode == stingerAfter {
+		return append(clips, stingerClip), true
+	}
+
+	return append([]queuedClip{stingerClip}, clips...), true
+}
+
+// stinger sets, clears and lists the guild's role stingers.
+func (g *greeterRunner) stinger(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	if g.settings == nil {
+		return errors.New("guild settings are not configured")
+	}
+
+	ctx := context.Background()
+	data := interaction.ApplicationCommandData()
+	subcommand := data.Options[0]
+
+	var embed *discordgo.MessageEmbed
+
+	switch subcommand.Name {
+	case "set":
+		var (
+			roleID     string
+			attachment *discordgo.MessageAttachment
+		)
+
+		mode := stingerBefore
+
+		for _, option := range subcommand.Options {
+			switch option.Name {
+			case "role":
+				roleID, _ = option.Value.(string)
+			case "file":
+				attachmentID, _ := option.Value.(string)
+
+				resolved, ok := data.Resolved.Attachments[attachmentID]
+				if !ok {
+					return fmt.Errorf("attachment %s was not resolved", attachmentID)
+				}
+
+				attachment = resolved
+			case "mode":
+				mode = option.StringValue()
+			}
+		}
+
+		guildSettings := g.guildSettings(ctx, interaction.GuildID)
+		previous, replacing := guildSettings.RoleStingers[roleID]
+
+		switch {
+		case FileType(attachment.ContentType) != mp3 && FileType(attachment.ContentType) != mp4:
+			embed = embeds.ErrorMessageEmbed("The stinger has to be an .mp3 or .m4a file")
+		case attachment.Size > maxStingerBytes:
+			embed = embeds.ErrorMessageEmbed("The stinger has to be a short clip under 1 MB")
+		case !replacing && len(guildSettings.RoleStingers) >= maxRoleStingers:
+			embed = embeds.ErrorMessageEmbed(fmt.Sprintf("A server can have at most %d role stingers, clear one with `/stinger clear` first", maxRoleStingers))
+		}
+
+		if embed != nil {
+			break
+		}
+
+		objectName, err := g.uploadGuildAudio(ctx, "stingers", interaction.GuildID, attachment)
+		if err != nil {
+			return fmt.Errorf("error uploading stinger: %w", err)
+		}
+
+		if err := g.settings.SetRoleStinger(ctx, interaction.GuildID, roleID, settings.RoleStinger{Object: objectName, Mode: mode}); err != nil {
+			g.deleteGuildAudio(ctx, interaction.GuildID, objectName)
+			return fmt.Errorf("error setting role stinger: %w", err)
+		}
+
+		g.deleteGuildAudio(ctx, interaction.GuildID, previous.Object)
+
+		embed = embeds.SettingsUpdatedEmbed(fmt.Sprintf("Members with <@&%s> will hear that stinger when they join, it %s", roleID, stingerPlacement(mode)))
+	case "clear":
+		roleID, _ := subcommand.Options[0].Value.(string)
+
+		previous, ok := g.guildSettings(ctx, interaction.GuildID).RoleStingers[roleID]
+		if !ok {
+			embed = embeds.ErrorMessageEmbed(fmt.Sprintf("<@&%s> doesn't have a stinger", roleID))
+			break
+		}
+
+		if err := g.settings.RemoveRoleStinger(ctx, interaction.GuildID, roleID); err != nil {
+			return fmt.Errorf("error clearing role stinger: %w", err)
+		}
+
+		g.deleteGuildAudio(ctx, interaction.GuildID, previous.Object)
+
+		embed = embeds.SettingsUpdatedEmbed(fmt.Sprintf("Members with <@&%s> will only hear their own intro", roleID))
+	case "list":
+		guildSettings := g.guildSettings(ctx, interaction.GuildID)
+
+		stingers := make([]embeds.RoleStinger, 0, len(guildSettings.RoleStingers))
+		for roleID, stinger := range guildSettings.RoleStingers {
+			stingers = append(stingers, embeds.RoleStinger{RoleID: roleID, Placement: stingerPlacement(stinger.Mode)})
+		}
+
+		slices.SortFunc(stingers, func(a, b embeds.RoleStinger) int {
+			return cmp.Or(cmp.Compare(rolePosition(session, interaction.GuildID, b.RoleID), rolePosition(session, interaction.GuildID, a.RoleID)), cmp.Compare(a.RoleID, b.RoleID))
+		})
+
+		embed = embeds.RoleStingersEmbed(stingers)
+	default:
+		return fmt.Errorf("unknown stinger subcommand: %s", subcommand.Name)
+	}
+
+	_, err := util.SendFollowup(ctx, session, interaction.Interaction, &discordgo.WebhookParams{
+		Embeds: []*discordgo.MessageEmbed{embed},
+	})
+
+	return err
+}
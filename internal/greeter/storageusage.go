@@ -0,0 +1,107 @@
+package greeter
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	firebaseAdapter "salutations/internal/firebase"
+	"salutations/internal/settings"
+	"salutations/internal/voicelines"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Guilds an operator hasn't given quotas of their own get these
+const (
+	defaultGuildStorageQuota  int64 = 200 << 20
+	defaultMemberStorageQuota int64 = 25 << 20
+)
+
+// storageQuotas are how many bytes of voicelines can be uploaded in the guild, and for any one member in it.
+func storageQuotas(guildSettings settings.GuildSettings) (int64, int64) {
+	return cmp.Or(guildSettings.StorageQuota, defaultGuildStorageQuota), cmp.Or(guildSettings.MemberStorageQuota, defaultMemberStorageQuota)
+}
+
+// countingReader counts the bytes read through it, for uploads streamed without knowing their size up front.
+type countingReader struct {
+	io.Reader
+	read int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.read += int64(n)
+
+	return n, err
+}
+
+// chargeStorage charges a freshly stored voiceline to the guild it was uploaded in and the member it's for, deleting it
+// again when that would take either past their quota. Voicelines stored outside a guild aren't charged.
+func (g *greeterRunner) chargeStorage(ctx context.Context, guildID string, memberID string, trackName string, bytes int64) error {
+	if guildID == "" {
+		return nil
+	}
+
+	guildQuota, memberQuota := storageQuotas(g.guildSettings(ctx, guildID))
+	charge := firebaseAdapter.StorageCharge{GuildID: guildID, MemberID: memberID, Bytes: bytes}
+
+	_, err := g.firebaseAdapter.ChargeStorage(ctx, StorageUsageCollection, StorageChargesCollection, trackName, charge, guildQuota, memberQuota)
+	if err == nil {
+		return nil
+	}
+
+	if err := g.firebaseAdapter.DeleteFileFromStorage(ctx, g.bucket, voicelines.Object(trackName)); err != nil {
+		g.logger.Warn("unable to delete voiceline that couldn't be charged", zap.Error(err), zap.String("track_name", trackName))
+	}
+
+	return err
+}
+
+// objectDeleted refunds the storage a deleted voiceline was charged and deletes everything rendered from it.
+func (g *greeterRunner) objectDeleted(ctx context.Context, trackName string) error {
+	return errors.Join(
+		g.firebaseAdapter.RefundStorage(ctx, StorageUsageCollection, StorageChargesCollection, trackName),
+		g.deleteRenderedObjects(ctx, trackName),
+	)
+}
+
+// storageUsage is how much of the guild's storage quota its uploads take up, and the quota.
+func (g *greeterRunner) storageUsage(ctx context.Context, guildID string) (firebaseAdapter.StorageUsage, int64, error) {
+	guildQuota, _ := storageQuotas(g.guildSettings(ctx, guildID))
+
+	document, err := g.firebaseAdapter.GetDocumentFromCollection(ctx, StorageUsageCollection, guildID)
+	if err != nil && status.Code(err) != codes.NotFound {
+		return firebaseAdapter.StorageUsage{}, 0, fmt.Errorf("error getting storage usage: %w", err)
+	}
+
+	return firebaseAdapter.StorageUsageFrom(document), guildQuota, nil
+}
+
+// storageQuotaText is what an upload turned away by a storage quota is reported as, empty when err isn't one.
+func storageQuotaText(err error) string {
+	switch {
+	case errors.Is(err, firebaseAdapter.ErrGuildStorageQuota):
+		return "This server has used up its voiceline storage, delete some voicelines to make room"
+	case errors.Is(err, firebaseAdapter.ErrMemberStorageQuota):
+		return "That member has used up their voiceline storage in this server, delete some of their voicelines to make room"
+	default:
+		return ""
+	}
+}
+
+// confirmedStorageUsage is storageUsage for upload confirmations, which leave usage out rather than fail when it can't
+// be read.
+func (g *greeterRunner) confirmedStorageUsage(ctx context.Context, guildID string) (int64, int64) {
+	usage, quota, err := g.storageUsage(ctx, guildID)
+	if err != nil {
+		g.logger.Warn("unable to get storage usage", zap.Error(err), zap.String("guild_id", guildID))
+		return 0, 0
+	}
+
+	return usage.Bytes, quota
+}
@@ -0,0 +1,53 @@
+package greeter
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	util "salutations/pkg/util"
+
+	"go.uber.org/zap"
+)
+
+// canonicalAudio is an upload in the format voicelines are stored in. Playback, previews, screening and exports all
+// treat stored audio as mp3, so m4a clips are transcoded on the way in rather than taught to each of them.
+type canonicalAudio struct {
+	// file is what should be uploaded, a transcoded copy the caller has to delete when transcoded is set
+	file       *os.File
+	transcoded bool
+}
+
+// canonicalizeUpload transcodes the file to mp3 in dir unless it already is one, the original is left for whoever
+// downloaded it to delete.
+func (g *greeterRunner) canonicalizeUpload(ctx context.Context, dir string, file *os.File) (canonicalAudio, error) {
+	head, err := util.SniffFile(file)
+	if err != nil {
+		return canonicalAudio{}, fmt.Errorf("error reading upload: %w", err)
+	}
+
+	if util.DetectAudioFormat(head) == util.AudioFormatMP3 {
+		return canonicalAudio{file: file}, nil
+	}
+
+	transcoded, err := util.TranscodeToMP3(ctx, dir, file.Name())
+	if err != nil {
+		return canonicalAudio{}, err
+	}
+
+	return canonicalAudio{file: transcoded, transcoded: true}, nil
+}
+
+// cleanup deletes the transcoded copy, if one was made.
+func (c canonicalAudio) cleanup(logger *zap.Logger) {
+	if !c.transcoded {
+		return
+	}
+
+	// The upload closes the file, so only its removal is worth reporting
+	c.file.Close()
+
+	if err := util.DeleteFile(c.file.Name()); err != nil {
+		logger.Warn("error trying to delete file", zap.Error(err), zap.String("file_name", c.file.Name()))
+	}
+}
@@ -0,0 +1,389 @@
+package greeter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"salutations/internal/embeds"
+	"salutations/internal/voicelines"
+	util "salutations/pkg/util"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	unplayedDigestInterval = time.Hour * 24
+	// defaultUnplayedMonths is how long a voiceline goes without playing before its member is asked to archive it
+	defaultUnplayedMonths = 6
+	// unplayedDigestCooldown keeps a member who ignored their digest from getting another every day
+	unplayedDigestCooldown = time.Hour * 24 * 30
+	// unplayedDigestSize is how many voicelines a digest suggests at once, the longest unplayed first
+	unplayedDigestSize = 5
+)
+
+// trackPlay is when one of a member's voicelines last greeted anyone, keyed like voicelineExpiry.
+type trackPlay struct {
+	Collection   string    `firestore:"collection"`
+	MemberID     string    `firestore:"member_id"`
+	TrackName    string    `firestore:"track_name"`
+	LastPlayedAt time.Time `firestore:"last_played_at"`
+}
+
+// unplayedDigest records when a member was last sent a digest, keyed by member id.
+type unplayedDigest struct {
+	SentAt time.Time `firestore:"sent_at"`
+}
+
+// unplayedVoiceline is one of a member's voicelines that hasn't played since the cutoff it was looked up with.
+type unplayedVoiceline struct {
+	collection string
+	trackName  string
+	createdAt  time.Time
+	// lastPlayedAt is zero when it hasn't played since plays started being recorded
+	lastPlayedAt time.Time
+}
+
+// idleSince is when the voiceline was last heard, or uploaded when it never was.
+func (v unplayedVoiceline) idleSince() time.Time {
+	if v.lastPlayedAt.IsZero() {
+		return v.createdAt
+	}
+
+	return v.lastPlayedAt
+}
+
+// recordTrackPlays notes that the member's voicelines among the clips just greeted someone. Guild clips such as
+// default greetings are queued by their object name and aren't anyone's voicelines, so they're left out.
+func (g *greeterRunner) recordTrackPlays(ctx context.Context, logger *zap.Logger, memberID string, collection string, clips []queuedClip) {
+	for _, clip := range clips {
+		if clip.memberID != memberID || clip.collection != collection || strings.Contains(clip.trackName, "/") {
+			continue
+		}
+
+		if err := g.recordTrackPlay(ctx, collection, memberID, clip.trackName); err != nil {
+			logger.Warn("unable to record voiceline play", zap.Error(err), zap.String("track_name", clip.trackName))
+		}
+	}
+}
+
+func (g *greeterRunner) recordTrackPlay(ctx context.Context, collection string, memberID string, trackName string) error {
+	documentID := expiryDocumentID(collection, memberID, trackName)
+	now := g.clock.Now()
+
+	err := g.firebaseAdapter.UpdateDocument(ctx, TrackPlaysCollection, documentID, map[string]interface{}{"last_played_at": now})
+	if status.Code(err) != codes.NotFound {
+		return err
+	}
+
+	err = g.firebaseAdapter.CreateDocument(ctx, TrackPlaysCollection, documentID, trackPlay{
+		Collection:   collection,
+		MemberID:     memberID,
+		TrackName:    trackName,
+		LastPlayedAt: now,
+	})
+	// Another greeting of the same voiceline got there first, which is just as recent
+	if status.Code(err) == codes.AlreadyExists {
+		return nil
+	}
+
+	return err
+}
+
+// memberVoicelineDocuments reads the member's intro and outro documents keyed by collection, leaving out the ones they
+// don't have.
+func (g *greeterRunner) memberVoicelineDocuments(ctx context.Context, memberID string) (map[string]map[string]interface{}, error) {
+	documents := map[string]map[string]interface{}{}
+
+	for _, collection := range []string{WelcomeCollection, OutroCollection} {
+		document, err := g.firebaseAdapter.GetDocumentFromCollection(ctx, collection, memberID)
+		if status.Code(err) == codes.NotFound {
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("error getting %s document: %w", collection, err)
+		}
+
+		documents[collection] = document
+	}
+
+	return documents, nil
+}
+
+// unplayedVoicelines are the voicelines in the member's documents that haven't been played or uploaded since cutoff,
+// the longest unplayed first.
+func (g *greeterRunner) unplayedVoicelines(ctx context.Context, memberID string, documents map[string]map[string]interface{}, cutoff time.Time) ([]unplayedVoiceline, error) {
+	candidates := []unplayedVoiceline{}
+	documentIDs := []string{}
+
+	for _, collection := range []string{WelcomeCollection, OutroCollection} {
+		records, _ := documents[collection][voicelines.ArrayKey(collection)].([]interface{})
+		for _, record := range records {
+			recordMap, ok := record.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			trackName, _ := recordMap["track_name"].(string)
+			createdAt, _ := recordMap["created_at"].(time.Time)
+			if trackName == "" || createdAt.After(cutoff) {
+				continue
+			}
+
+			candidates = append(candidates, unplayedVoiceline{collection: collection, trackName: trackName, createdAt: createdAt})
+			documentIDs = append(documentIDs, expiryDocumentID(collection, memberID, trackName))
+		}
+	}
+
+	plays, err := g.getDocumentsInBatches(ctx, TrackPlaysCollection, documentIDs)
+	if err != nil {
+		return nil, fmt.Errorf("error getting voiceline plays: %w", err)
+	}
+
+	unplayed := []unplayedVoiceline{}
+	for i, candidate := range candidates {
+		candidate.lastPlayedAt, _ = plays[documentIDs[i]]["last_played_at"].(time.Time)
+		if candidate.lastPlayedAt.After(cutoff) {
+			continue
+		}
+
+		unplayed = append(unplayed, candidate)
+	}
+
+	slices.SortStableFunc(unplayed, func(a, b unplayedVoiceline) int {
+		return a.idleSince().Compare(b.idleSince())
+	})
+
+	return unplayed, nil
+}
+
+func (g *greeterRunner) unplayedCutoff() time.Time {
+	return g.clock.Now().AddDate(0, -g.unplayedMonths, 0)
+}
+
+// unplayedDigestMessage renders the member's digest, suggesting the first few of their unplayed voicelines.
+func (g *greeterRunner) unplayedDigestMessage(guildID string, memberID string, unplayed []unplayedVoiceline) (*discordgo.MessageEmbed, []discordgo.MessageComponent) {
+	unplayed = unplayed[:min(len(unplayed), unplayedDigestSize)]
+
+	listed := make([]embeds.UnplayedVoiceline, 0, len(unplayed))
+	archiveIDs := make([]string, 0, len(unplayed))
+
+	for _, voiceline := range unplayed {
+		shortID := voicelines.ShortID(voiceline.trackName)
+
+		listed = append(listed, embeds.UnplayedVoiceline{
+			ShortID:      shortID,
+			AudioType:    voicelines.AudioTypeFor(voiceline.collection),
+			LastPlayedAt: voiceline.lastPlayedAt,
+			UploadedAt:   voiceline.createdAt,
+		})
+
+		archiveIDs = append(archiveIDs, util.CustomID{Action: unplayedArchivePrefix, GuildID: guildID, MemberID: memberID, Collection: voiceline.collection, Nonce: shortID}.Encode())
+	}
+
+	return embeds.UnplayedVoicelinesEmbed(memberID, listed, g.unplayedMonths), embeds.UnplayedVoicelinesComponents(archiveIDs)
+}
+
+// unplayedDigestDue is whether the member hasn't been sent a digest recently.
+func (g *greeterRunner) unplayedDigestDue(ctx context.Context, memberID string) (bool, error) {
+	document, err := g.firebaseAdapter.GetDocumentFromCollection(ctx, UnplayedDigestsCollection, memberID)
+	if status.Code(err) == codes.NotFound {
+		return true, nil
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("error getting unplayed digest: %w", err)
+	}
+
+	sentAt, _ := document["sent_at"].(time.Time)
+
+	return g.clock.Now().Sub(sentAt) >= unplayedDigestCooldown, nil
+}
+
+func (g *greeterRunner) recordUnplayedDigest(ctx context.Context, memberID string) error {
+	err := g.firebaseAdapter.UpdateDocument(ctx, UnplayedDigestsCollection, memberID, map[string]interface{}{"sent_at": g.clock.Now()})
+	if status.Code(err) != codes.NotFound {
+		return err
+	}
+
+	return g.firebaseAdapter.CreateDocument(ctx, UnplayedDigestsCollection, memberID, unplayedDigest{SentAt: g.clock.Now()})
+}
+
+// sendUnplayedDigest DMs the member their digest. Members who don't take DMs from the bot get it in the log channel of
+// every server they share with it that has one instead.
+func (g *greeterRunner) sendUnplayedDigest(ctx context.Context, session *discordgo.Session, memberID string, unplayed []unplayedVoiceline) error {
+	embed, components := g.unplayedDigestMessage("", memberID, unplayed)
+
+	channel, dmErr := session.UserChannelCreate(memberID)
+	if dmErr == nil {
+		_, dmErr = session.ChannelMessageSendComplex(channel.ID, &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{embed}, Components: components})
+		if dmErr == nil {
+			return nil
+		}
+	}
+
+	posted := false
+
+	for _, guild := range session.State.Guilds {
+		if _, err := session.State.Member(guild.ID, memberID); err != nil {
+			continue
+		}
+
+		channelID := g.guildSettings(ctx, guild.ID).ModLogChannel
+		if channelID == "" {
+			continue
+		}
+
+		embed, components := g.unplayedDigestMessage(guild.ID, memberID, unplayed)
+
+		_, err := session.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{Embeds: []*discordgo.MessageEmbed{embed}, Components: components})
+		if err != nil {
+			g.logger.Warn("unable to post unplayed voicelines to the log channel", zap.Error(err), zap.String("guild_id", guild.ID), zap.String("channel_id", channelID))
+			continue
+		}
+
+		posted = true
+	}
+
+	if !posted {
+		return fmt.Errorf("unable to send unplayed voicelines to %s: %w", memberID, dmErr)
+	}
+
+	return nil
+}
+
+// suggestUnplayedCleanups sends every member with voicelines that haven't played in months a digest offering to
+// archive them, at most once per cooldown.
+func (g *greeterRunner) suggestUnplayedCleanups(ctx context.Context, session *discordgo.Session) error {
+	members := map[string]map[string]map[string]interface{}{}
+
+	for _, collection := range []string{WelcomeCollection, OutroCollection} {
+		documents, err := g.firebaseAdapter.GetDocumentsFromCollection(ctx, collection)
+		if err != nil {
+			return fmt.Errorf("error getting %s documents: %w", collection, err)
+		}
+
+		for memberID, document := range documents {
+			if members[memberID] == nil {
+				members[memberID] = map[string]map[string]interface{}{}
+			}
+
+			members[memberID][collection] = document
+		}
+	}
+
+	cutoff := g.unplayedCutoff()
+	sent := 0
+	errs := []error{}
+
+	for memberID, documents := range members {
+		due, err := g.unplayedDigestDue(ctx, memberID)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if !due {
+			continue
+		}
+
+		unplayed, err := g.unplayedVoicelines(ctx, memberID, documents, cutoff)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		if len(unplayed) == 0 {
+			continue
+		}
+
+		if err := g.sendUnplayedDigest(ctx, session, memberID, unplayed); err != nil {
+			g.logger.Warn("unable to send unplayed voicelines digest", zap.Error(err), zap.String("user_id", memberID))
+		}
+
+		// A member who can't be reached is tried again after the cooldown rather than every day
+		if err := g.recordUnplayedDigest(ctx, memberID); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		sent++
+	}
+
+	if sent > 0 {
+		g.logger.Info("sent unplayed voiceline digests", zap.Int("sent", sent))
+	}
+
+	return errors.Join(errs...)
+}
+
+// unplayedArchive archives a voiceline from a digest's button, then shows what's left to tidy up in its place. The
+// member can press it in their DMs, moderators in the log channel too.
+func (g *greeterRunner) unplayedArchive(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	customID, err := util.DecodeCustomID(interaction.MessageComponentData().CustomID)
+	if err != nil || (customID.Collection != WelcomeCollection && customID.Collection != OutroCollection) {
+		return fmt.Errorf("malformed unplayed archive custom id: %s", interaction.MessageComponentData().CustomID)
+	}
+
+	user, moderator := interaction.User, false
+	if interaction.Member != nil {
+		user, moderator = interaction.Member.User, interaction.Member.Permissions&discordgo.PermissionManageServer != 0
+	}
+
+	if user.ID != customID.MemberID && !moderator {
+		return g.respondEphemeral(session, interaction, embeds.ErrorMessageEmbed("Only the member these voicelines belong to or a moderator can archive them"))
+	}
+
+	ctx := context.Background()
+
+	tracks, err := g.voicelineService.Tracks(ctx, customID.Collection, customID.MemberID)
+	if err != nil && status.Code(err) != codes.NotFound {
+		return err
+	}
+
+	trackName := ""
+	for _, track := range tracks {
+		if recordMap, ok := track.(map[string]interface{}); ok {
+			if name, _ := recordMap["track_name"].(string); voicelines.ShortID(name) == customID.Nonce {
+				trackName = name
+			}
+		}
+	}
+
+	if trackName == "" {
+		return g.respondEphemeral(session, interaction, embeds.ErrorMessageEmbed("That voiceline isn't there anymore, it may already be archived"))
+	}
+
+	if err := g.removeVoicelines(ctx, customID.Collection, customID.MemberID, []string{trackName}); err != nil {
+		return err
+	}
+
+	g.logger.Info("unplayed voiceline archived", zap.String("user_id", customID.MemberID), zap.String("track_name", trackName), zap.String("collection", customID.Collection), zap.String("archived_by", user.ID))
+
+	documents, err := g.memberVoicelineDocuments(ctx, customID.MemberID)
+	if err != nil {
+		return err
+	}
+
+	unplayed, err := g.unplayedVoicelines(ctx, customID.MemberID, documents, g.unplayedCutoff())
+	if err != nil {
+		return err
+	}
+
+	embed, components := g.unplayedDigestMessage(customID.GuildID, customID.MemberID, unplayed)
+
+	return session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Embeds:     []*discordgo.MessageEmbed{embed},
+			Components: components,
+		},
+	})
+}
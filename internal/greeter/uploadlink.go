@@ -0,0 +1,92 @@
+package greeter
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+var errInvalidMessageLink = errors.New("invalid message link")
+
+// parseMessageLink splits a link copied with "Copy Message Link" into its guild, channel and message ids.
+func parseMessageLink(link string) (string, string, string, error) {
+	parsed, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return "", "", "", errInvalidMessageLink
+	}
+
+	host := strings.TrimPrefix(strings.TrimPrefix(parsed.Host, "ptb."), "canary.")
+	if host != "discord.com" && host != "discordapp.com" {
+		return "", "", "", errInvalidMessageLink
+	}
+
+	parts := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+	if len(parts) != 4 || parts[0] != "channels" || parts[1] == "" || parts[2] == "" || parts[3] == "" {
+		return "", "", "", errInvalidMessageLink
+	}
+
+	return parts[1], parts[2], parts[3], nil
+}
+
+// uploadAttachments collects what /upload should store, the attached file and the attachments of the linked message.
+// The returned problem is shown to the invoker when the link can't be used, rather than treated as an error.
+func (g *greeterRunner) uploadAttachments(session *discordgo.Session, interaction *discordgo.InteractionCreate) ([]*discordgo.MessageAttachment, string, error) {
+	data := interaction.ApplicationCommandData()
+
+	attachments := []*discordgo.MessageAttachment{}
+	link := ""
+
+	for _, option := range data.Options {
+		switch option.Name {
+		case "file":
+			attachmentID, _ := option.Value.(string)
+			if data.Resolved == nil {
+				return nil, "", fmt.Errorf("attachment %s was not resolved", attachmentID)
+			}
+
+			if attachment, ok := data.Resolved.Attachments[attachmentID]; ok {
+				attachments = append(attachments, attachment)
+			}
+		case "message_link":
+			link = option.StringValue()
+		}
+	}
+
+	if link != "" {
+		guildID, channelID, messageID, err := parseMessageLink(link)
+		if err != nil || guildID != interaction.GuildID {
+			return nil, "That isn't a link to a message in this server, use **Copy Message Link** on the message", nil
+		}
+
+		// The invoker has to be able to see the message themselves, the bot shouldn't leak attachments from hidden channels
+		perms, err := session.UserChannelPermissions(interaction.Member.User.ID, channelID)
+		if err != nil || perms&discordgo.PermissionViewChannel == 0 || perms&discordgo.PermissionReadMessageHistory == 0 {
+			return nil, "You can't read the channel that message is in", nil
+		}
+
+		message, err := session.ChannelMessage(channelID, messageID)
+		if err != nil {
+			var restErr *discordgo.RESTError
+			if errors.As(err, &restErr) && restErr.Response != nil && restErr.Response.StatusCode < 500 {
+				return nil, "I couldn't find that message, it may have been deleted or I can't read that channel", nil
+			}
+
+			return nil, "", fmt.Errorf("error getting linked message: %w", err)
+		}
+
+		if len(message.Attachments) == 0 {
+			return nil, "That message doesn't have any attachments", nil
+		}
+
+		attachments = append(attachments, message.Attachments...)
+	}
+
+	if len(attachments) == 0 {
+		return nil, "Attach a file or link a message that has one", nil
+	}
+
+	return attachments, "", nil
+}
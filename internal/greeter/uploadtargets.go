@@ -0,0 +1,73 @@
+package greeter
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+)
+
+const (
+	// extraMemberOptions is how many member options /upload has besides the required one
+	extraMemberOptions = 4
+	// maxUploadTargets caps how many members one upload can be shared with, a role can't fan out to a whole server
+	maxUploadTargets = 25
+)
+
+// uploadTargets lists who besides the required member an upload is for, from the extra member options and every
+// member with the role option. The returned problem is shown to the invoker rather than treated as an error.
+func uploadTargets(session *discordgo.Session, interaction *discordgo.InteractionCreate, memberID string) ([]string, string, error) {
+	targets := []string{}
+	add := func(targetID string) {
+		if targetID != memberID && !slices.Contains(targets, targetID) {
+			targets = append(targets, targetID)
+		}
+	}
+
+	for _, option := range interaction.ApplicationCommandData().Options {
+		switch option.Name {
+		case "role":
+			roleID, _ := option.Value.(string)
+
+			guild, err := session.State.Guild(interaction.GuildID)
+			if err != nil {
+				return nil, "", fmt.Errorf("error getting guild: %w", err)
+			}
+
+			for _, guildMember := range guild.Members {
+				if !guildMember.User.Bot && slices.Contains(guildMember.Roles, roleID) {
+					add(guildMember.User.ID)
+				}
+			}
+		default:
+			if option.Type == discordgo.ApplicationCommandOptionUser && option.Name != "member" {
+				targetID, _ := option.Value.(string)
+				add(targetID)
+			}
+		}
+	}
+
+	if len(targets)+1 > maxUploadTargets {
+		return nil, fmt.Sprintf("A voiceline can be shared with at most %d members at once, that would be %d", maxUploadTargets, len(targets)+1), nil
+	}
+
+	return targets, "", nil
+}
+
+// shareVoiceline adds an already stored track to more members, every record points at the same object in storage.
+func (g *greeterRunner) shareVoiceline(ctx context.Context, collection string, memberIDs []string, addedBy string, trackName string) error {
+	for _, memberID := range memberIDs {
+		if err := g.voicelineService.EnsureDocument(ctx, collection, memberID); err != nil {
+			return err
+		}
+
+		if err := g.voicelineService.AppendTrack(ctx, collection, memberID, addedBy, trackName); err != nil {
+			g.logger.Error("error sharing voiceline", zap.Error(err), zap.String("collection", collection), zap.String("user_id", memberID))
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package greeter
+
+import (
+	"sync"
+	"time"
+)
+
+// voiceEventWindow is how long after a member's join or leave a repeat of it is treated as the gateway redelivering
+// it, events further apart than this are always taken at face value.
+const voiceEventWindow = time.Second * 10
+
+// acceptedVoiceEvent is the last join or leave of a member that was queued.
+type acceptedVoiceEvent struct {
+	sessionID string
+	joined    bool
+	at        time.Time
+}
+
+// voiceEventDedup drops voice state updates Discord delivered twice or out of order, which would otherwise greet a
+// member twice or see them off after they've already come back.
+type voiceEventDedup struct {
+	mu        sync.Mutex
+	accepted  map[string]acceptedVoiceEvent
+	lastPrune time.Time
+}
+
+func newVoiceEventDedup() *voiceEventDedup {
+	return &voiceEventDedup{accepted: make(map[string]acceptedVoiceEvent)}
+}
+
+// accept reports whether a join or leave of the member's voice session should be acted on and records it if so. Within
+// the window a repeat of the last accepted event is a duplicate, and a leave from another session than the one that
+// last joined is a late delivery of an earlier leave.
+func (d *voiceEventDedup) accept(guildID string, userID string, sessionID string, joined bool, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.prune(now)
+
+	key := guildID + "_" + userID
+
+	if last, ok := d.accepted[key]; ok && now.Sub(last.at) < voiceEventWindow {
+		if last.joined == joined && last.sessionID == sessionID {
+			return false
+		}
+
+		if !joined && last.joined && last.sessionID != sessionID {
+			return false
+		}
+	}
+
+	d.accepted[key] = acceptedVoiceEvent{sessionID: sessionID, joined: joined, at: now}
+
+	return true
+}
+
+// prune forgets events too old to be redelivered, at most once a window so it stays cheap on busy gateways. The caller
+// holds mu.
+func (d *voiceEventDedup) prune(now time.Time) {
+	if now.Sub(d.lastPrune) < voiceEventWindow {
+		return
+	}
+
+	for key, event := range d.accepted {
+		if now.Sub(event.at) >= voiceEventWindow {
+			delete(d.accepted, key)
+		}
+	}
+
+	d.lastPrune = now
+}
@@ -0,0 +1,209 @@
+package greeter
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"salutations/internal/embeds"
+
+	"github.com/bwmarrin/discordgo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	errVoicePackNotFound = errors.New("voice pack not found")
+	errVoicePackEmpty    = errors.New("voice pack has no clips")
+)
+
+// voicePack is a curated set of generic greetings, described by a document in VoicePacksCollection with its clips
+// stored under packs/<pack id>/intro/ and packs/<pack id>/outro/.
+type voicePack struct {
+	ID          string
+	Name        string
+	Description string
+	Intros      int
+	Outros      int
+}
+
+func voicePackPrefix(packID string, collection string) string {
+	if collection == WelcomeCollection {
+		return fmt.Sprintf("packs/%s/intro/", packID)
+	}
+
+	return fmt.Sprintf("packs/%s/outro/", packID)
+}
+
+func (g *greeterRunner) packClips(ctx context.Context, packID string, collection string) ([]string, error) {
+	objectNames, err := g.firebaseAdapter.ListFilesInStorage(ctx, g.bucket, voicePackPrefix(packID, collection))
+	if err != nil {
+		return nil, fmt.Errorf("error listing clips of voice pack %s: %w", packID, err)
+	}
+
+	return objectNames, nil
+}
+
+func (g *greeterRunner) getVoicePack(ctx context.Context, packID string, data map[string]interface{}) (voicePack, error) {
+	pack := voicePack{ID: packID}
+	pack.Name, _ = data["name"].(string)
+	pack.Description, _ = data["description"].(string)
+
+	if pack.Name == "" {
+		pack.Name = packID
+	}
+
+	intros, err := g.packClips(ctx, packID, WelcomeCollection)
+	if err != nil {
+		return pack, err
+	}
+
+	outros, err := g.packClips(ctx, packID, OutroCollection)
+	if err != nil {
+		return pack, err
+	}
+
+	pack.Intros, pack.Outros = len(intros), len(outros)
+
+	return pack, nil
+}
+
+func (g *greeterRunner) listVoicePacks(ctx context.Context) ([]voicePack, error) {
+	documents, err := g.firebaseAdapter.GetDocumentsFromCollection(ctx, VoicePacksCollection)
+	if err != nil {
+		return nil, fmt.Errorf("error getting voice packs: %w", err)
+	}
+
+	packs := make([]voicePack, 0, len(documents))
+	for packID, data := range documents {
+		pack, err := g.getVoicePack(ctx, packID, data)
+		if err != nil {
+			return nil, err
+		}
+
+		packs = append(packs, pack)
+	}
+
+	slices.SortFunc(packs, func(a, b voicePack) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+
+	return packs, nil
+}
+
+// findVoicePack looks up a pack that has clips to play.
+func (g *greeterRunner) findVoicePack(ctx context.Context, packID string) (voicePack, error) {
+	data, err := g.firebaseAdapter.GetDocumentFromCollection(ctx, VoicePacksCollection, packID)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return voicePack{}, errVoicePackNotFound
+		}
+
+		return voicePack{}, fmt.Errorf("error getting voice pack %s: %w", packID, err)
+	}
+
+	pack, err := g.getVoicePack(ctx, packID, data)
+	if err != nil {
+		return pack, err
+	}
+
+	if pack.Intros == 0 && pack.Outros == 0 {
+		return pack, errVoicePackEmpty
+	}
+
+	return pack, nil
+}
+
+func (g *greeterRunner) installVoicePack(ctx context.Context, guildID string, packID string) (voicePack, error) {
+	pack, err := g.findVoicePack(ctx, packID)
+	if err != nil {
+		return pack, err
+	}
+
+	return pack, g.settings.SetVoicePack(ctx, guildID, packID)
+}
+
+func (g *greeterRunner) voicePacks(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	if g.settings == nil {
+		return errors.New("guild settings are not configured")
+	}
+
+	ctx := context.Background()
+	subcommand := interaction.ApplicationCommandData().Options[0]
+
+	switch subcommand.Name {
+	case "list":
+		packs, err := g.listVoicePacks(ctx)
+		if err != nil {
+			return err
+		}
+
+		installed := g.guildSettings(ctx, interaction.GuildID).VoicePack
+
+		listed := make([]embeds.VoicePack, 0, len(packs))
+		for _, pack := range packs {
+			listed = append(listed, embeds.VoicePack{Name: pack.Name, Description: pack.Description, Intros: pack.Intros, Outros: pack.Outros, Installed: pack.ID == installed})
+		}
+
+		return g.respondEphemeral(session, interaction, embeds.VoicePacksEmbed(listed))
+	case "install":
+		pack, err := g.installVoicePack(ctx, interaction.GuildID, subcommand.Options[0].StringValue())
+		if err != nil {
+			switch {
+			case errors.Is(err, errVoicePackNotFound):
+				return g.respondEphemeral(session, interaction, embeds.ErrorMessageEmbed("That voice pack couldn't be found, pick one from the list"))
+			case errors.Is(err, errVoicePackEmpty):
+				return g.respondEphemeral(session, interaction, embeds.ErrorMessageEmbed("That voice pack doesn't have any clips yet"))
+			}
+
+			return fmt.Errorf("error installing voice pack: %w", err)
+		}
+
+		return g.respondEphemeral(session, interaction, embeds.SettingsUpdatedEmbed(fmt.Sprintf("Installed **%s**, members without their own voicelines will be greeted with it", pack.Name)))
+	case "uninstall":
+		if err := g.settings.SetVoicePack(ctx, interaction.GuildID, ""); err != nil {
+			return fmt.Errorf("error uninstalling voice pack: %w", err)
+		}
+
+		return g.respondEphemeral(session, interaction, embeds.SettingsUpdatedEmbed("Members without their own voicelines won't be greeted anymore"))
+	default:
+		return fmt.Errorf("unknown voicepack subcommand: %s", subcommand.Name)
+	}
+}
+
+// voicePackAutocomplete completes the pack option of /voicepack install and /eventmode on.
+func (g *greeterRunner) voicePackAutocomplete(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+	focused := ""
+	for _, option := range interaction.ApplicationCommandData().Options[0].Options {
+		if option.Focused {
+			focused = strings.ToLower(option.StringValue())
+		}
+	}
+
+	documents, err := g.firebaseAdapter.GetDocumentsFromCollection(context.Background(), VoicePacksCollection)
+	if err != nil {
+		return fmt.Errorf("error getting voice packs: %w", err)
+	}
+
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	for packID, data := range documents {
+		name, _ := data["name"].(string)
+		if name == "" {
+			name = packID
+		}
+
+		if len(choices) == 25 || !strings.Contains(strings.ToLower(name), focused) {
+			continue
+		}
+
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: name, Value: packID})
+	}
+
+	return session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{Choices: choices},
+	})
+}
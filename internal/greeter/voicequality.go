@@ -0,0 +1,322 @@
+package greeter
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	util "salutations/pkg/util"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+)
+
+// discordgo keeps the voice UDP socket to itself, so round trips and loss are measured by probing the voice server's
+// endpoint alongside it. A server that's slow or dropping probes is slow or dropping audio too.
+const (
+	voiceProbeInterval  = time.Second * 30
+	voiceProbeTimeout   = time.Second * 2
+	voiceProbesPerRound = 3
+	// voiceProbeWindow is how many of the most recent probes quality is judged on
+	voiceProbeWindow = 30
+	// minJudgedProbes keeps a single bad round from reconnecting a connection that just started
+	minJudgedProbes = voiceProbesPerRound * 3
+
+	degradedProbeRTT  = time.Millisecond * 250
+	degradedProbeLoss = 0.2
+	// degradedPlaybackLag is how far behind real time a clip can finish before it was audibly stuttering
+	degradedPlaybackLag = time.Second
+	// voiceReconnectCooldown keeps a server that's bad for everyone from being reconnected to over and over
+	voiceReconnectCooldown = time.Minute * 10
+)
+
+type voiceProbe struct {
+	rtt  time.Duration
+	lost bool
+}
+
+// voiceQuality is what's known about the guild's voice connection, reset whenever Discord moves it to another server.
+type voiceQuality struct {
+	endpoint string
+	probes   []voiceProbe
+	// playbackLag is how far behind real time the last clip finished playing
+	playbackLag     time.Duration
+	reconnects      int
+	lastReconnectAt time.Time
+}
+
+// rtt is the average round trip of the probes that were answered, zero when none were.
+func (q *voiceQuality) rtt() time.Duration {
+	var total time.Duration
+
+	answered := 0
+	for _, probe := range q.probes {
+		if !probe.lost {
+			total += probe.rtt
+			answered++
+		}
+	}
+
+	if answered == 0 {
+		return 0
+	}
+
+	return total / time.Duration(answered)
+}
+
+// loss is the fraction of probes that went unanswered.
+func (q *voiceQuality) loss() float64 {
+	if len(q.probes) == 0 {
+		return 0
+	}
+
+	lost := 0
+	for _, probe := range q.probes {
+		if probe.lost {
+			lost++
+		}
+	}
+
+	return float64(lost) / float64(len(q.probes))
+}
+
+// degraded explains why the connection is bad enough to reconnect, empty when it's fine or there's too little to go on.
+func (q *voiceQuality) degraded() string {
+	if q.playbackLag >= degradedPlaybackLag {
+		return fmt.Sprintf("the last clip finished %s behind", q.playbackLag.Truncate(time.Millisecond))
+	}
+
+	if len(q.probes) < minJudgedProbes {
+		return ""
+	}
+
+	if loss := q.loss(); loss >= degradedProbeLoss {
+		return fmt.Sprintf("%.0f%% of probes were lost", loss*100)
+	}
+
+	if rtt := q.rtt(); rtt >= degradedProbeRTT {
+		return fmt.Sprintf("probes took %s on average", rtt.Truncate(time.Millisecond))
+	}
+
+	return ""
+}
+
+// voiceRegion is the region part of a voice server endpoint, such as us-east for us-east1234.discord.media:443 or
+// atl for c-atl06-2f9a.discord.media:443.
+func voiceRegion(endpoint string) string {
+	host, _, _ := strings.Cut(endpoint, ":")
+	label, _, _ := strings.Cut(host, ".")
+
+	if rest, ok := strings.CutPrefix(label, "c-"); ok {
+		label, _, _ = strings.Cut(rest, "-")
+	}
+
+	return strings.TrimRight(label, "0123456789")
+}
+
+// voiceQualities tracks each guild's voice connection quality, it has a lock of its own since voice server updates
+// arrive while the greeter's lock is held to join a channel.
+type voiceQualities struct {
+	mu     sync.Mutex
+	guilds map[string]*voiceQuality
+}
+
+func newVoiceQualities() *voiceQualities {
+	return &voiceQualities{guilds: make(map[string]*voiceQuality)}
+}
+
+// setEndpoint starts over for a guild whose voice connection moved to endpoint, reconnect history is kept.
+func (v *voiceQualities) setEndpoint(guildID string, endpoint string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	quality, ok := v.guilds[guildID]
+	if !ok {
+		v.guilds[guildID] = &voiceQuality{endpoint: endpoint}
+		return
+	}
+
+	quality.endpoint = endpoint
+	quality.probes = nil
+	quality.playbackLag = 0
+}
+
+func (v *voiceQualities) endpoint(guildID string) string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if quality, ok := v.guilds[guildID]; ok {
+		return quality.endpoint
+	}
+
+	return ""
+}
+
+func (v *voiceQualities) recordProbes(guildID string, probes []voiceProbe) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	quality, ok := v.guilds[guildID]
+	if !ok {
+		return
+	}
+
+	quality.probes = append(quality.probes, probes...)
+	if len(quality.probes) > voiceProbeWindow {
+		quality.probes = quality.probes[len(quality.probes)-voiceProbeWindow:]
+	}
+}
+
+func (v *voiceQualities) recordPlayback(guildID string, lag time.Duration) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if quality, ok := v.guilds[guildID]; ok {
+		quality.playbackLag = lag
+	}
+}
+
+// claimReconnect reports why the guild's connection should be reconnected and records the reconnect, empty when it
+// shouldn't be. Measurements start over since they were of the connection being replaced.
+func (v *voiceQualities) claimReconnect(guildID string, now time.Time) string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	quality, ok := v.guilds[guildID]
+	if !ok || now.Sub(quality.lastReconnectAt) < voiceReconnectCooldown {
+		return ""
+	}
+
+	reason := quality.degraded()
+	if reason == "" {
+		return ""
+	}
+
+	quality.reconnects++
+	quality.lastReconnectAt = now
+	quality.probes = nil
+	quality.playbackLag = 0
+
+	return reason
+}
+
+// snapshot copies the guild's quality for /debug voice, false when its voice server isn't known.
+func (v *voiceQualities) snapshot(guildID string) (voiceQuality, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	quality, ok := v.guilds[guildID]
+	if !ok {
+		return voiceQuality{}, false
+	}
+
+	copied := *quality
+	copied.probes = append([]voiceProbe(nil), quality.probes...)
+
+	return copied, true
+}
+
+// dialVoiceEndpoint times a connection to the voice server, the round trip of the handshake.
+func dialVoiceEndpoint(ctx context.Context, endpoint string) (time.Duration, error) {
+	if _, _, err := net.SplitHostPort(endpoint); err != nil {
+		endpoint = net.JoinHostPort(endpoint, "443")
+	}
+
+	dialer := net.Dialer{Timeout: voiceProbeTimeout}
+	startedAt := time.Now()
+
+	conn, err := dialer.DialContext(ctx, "tcp", endpoint)
+	if err != nil {
+		return 0, err
+	}
+
+	rtt := time.Since(startedAt)
+	_ = conn.Close()
+
+	return rtt, nil
+}
+
+// voiceServerUpdate records which voice server the guild's connection was given, Discord sends one on every join and
+// whenever it moves the connection.
+func (g *greeterRunner) voiceServerUpdate(_ *discordgo.Session, update *discordgo.VoiceServerUpdate) {
+	if update.Endpoint == "" {
+		return
+	}
+
+	g.voiceQualities.setEndpoint(update.GuildID, update.Endpoint)
+
+	g.logger.Info("voice server assigned", zap.String("guild_id", update.GuildID), zap.String("endpoint", update.Endpoint), zap.String("region", voiceRegion(update.Endpoint)))
+}
+
+// probeVoiceServers measures every connected guild's voice server and reconnects the ones that have degraded.
+func (g *greeterRunner) probeVoiceServers(ctx context.Context) error {
+	g.mu.RLock()
+	guildIDs := make([]string, 0, len(g.guildPlayerMappings))
+	for guildID := range g.guildPlayerMappings {
+		guildIDs = append(guildIDs, guildID)
+	}
+	g.mu.RUnlock()
+
+	pool := util.NewPool[[]voiceProbe](ctx, 10)
+
+	for _, guildID := range guildIDs {
+		endpoint := g.voiceQualities.endpoint(guildID)
+
+		pool.Submit(func(ctx context.Context) ([]voiceProbe, error) {
+			if endpoint == "" {
+				return nil, nil
+			}
+
+			probes := make([]voiceProbe, 0, voiceProbesPerRound)
+			for range voiceProbesPerRound {
+				rtt, err := g.dialVoice(ctx, endpoint)
+				probes = append(probes, voiceProbe{rtt: rtt, lost: err != nil})
+			}
+
+			return probes, nil
+		})
+	}
+
+	for i, outcome := range pool.Wait() {
+		guildID := guildIDs[i]
+		if len(outcome.Value) == 0 {
+			continue
+		}
+
+		g.voiceQualities.recordProbes(guildID, outcome.Value)
+
+		quality, _ := g.voiceQualities.snapshot(guildID)
+		g.logger.Debug("voice server probed", zap.String("guild_id", guildID), zap.String("region", voiceRegion(quality.endpoint)), zap.Duration("rtt", quality.rtt()), zap.Float64("loss", quality.loss()))
+
+		g.reconnectDegradedVoice(ctx, guildID)
+	}
+
+	return nil
+}
+
+// reconnectDegradedVoice replaces the guild's voice connection when its quality has degraded, a player in the middle
+// of a greeting is left alone until the next probe.
+func (g *greeterRunner) reconnectDegradedVoice(ctx context.Context, guildID string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	player, ok := g.guildPlayerMappings[guildID]
+	if !ok || player.voiceState != NotPlaying || len(player.queue) > 0 {
+		return
+	}
+
+	reason := g.voiceQualities.claimReconnect(guildID, g.clock.Now())
+	if reason == "" {
+		return
+	}
+
+	logger := g.logger.With(zap.String("guild_id", guildID), zap.String("channel_id", player.voiceClient.ChannelID))
+	logger.Warn("voice quality degraded, reconnecting", zap.String("reason", reason))
+
+	if !g.reconnectVoice(ctx, logger, player) {
+		logger.Warn("unable to rejoin voice channel after degrading, the next greeting will try again")
+	}
+}
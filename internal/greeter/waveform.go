@@ -0,0 +1,64 @@
+package greeter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	util "salutations/pkg/util"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	waveformWidth  = 400
+	waveformHeight = 80
+	// waveformColor matches the color of the listing embeds the waveforms are shown in
+	waveformColor = "0x67e9ff"
+)
+
+// waveformObjectName is where the track's waveform thumbnail is stored.
+func waveformObjectName(trackName string) string {
+	return fmt.Sprintf("waveforms/%s.png", trackName)
+}
+
+// storeWaveform renders the waveform of the clip at filePath and stores it for the track, returning the object it was
+// stored in. A waveform that couldn't be rendered or stored only leaves the track without a thumbnail, so the object
+// is empty then rather than failing the upload.
+func (g *greeterRunner) storeWaveform(ctx context.Context, trackName string, filePath string) string {
+	rendered, err := util.RenderWaveform(ctx, "", filePath, waveformWidth, waveformHeight, waveformColor)
+	if err != nil {
+		g.logger.Warn("unable to render waveform", zap.Error(err), zap.String("track_name", trackName))
+		return ""
+	}
+
+	defer func() {
+		// The upload closes the file, so only its removal is worth reporting
+		rendered.Close()
+
+		if err := util.DeleteFile(rendered.Name()); err != nil {
+			g.logger.Warn("error trying to delete file", zap.Error(err), zap.String("file_name", rendered.Name()))
+		}
+	}()
+
+	objectName := waveformObjectName(trackName)
+	if err := g.firebaseAdapter.UploadFileToStorage(ctx, g.bucket, objectName, rendered, trackName+".png"); err != nil {
+		g.logger.Warn("unable to store waveform", zap.Error(err), zap.String("track_name", trackName))
+		return ""
+	}
+
+	return objectName
+}
+
+// deleteRenderedObjects removes everything rendered from a track once its audio is deleted, the effect variants and
+// waveform it never had are skipped.
+func (g *greeterRunner) deleteRenderedObjects(ctx context.Context, trackName string) error {
+	err := g.firebaseAdapter.DeleteFileFromStorage(ctx, g.bucket, waveformObjectName(trackName))
+	if status.Code(err) == codes.NotFound {
+		err = nil
+	}
+
+	return errors.Join(g.deleteVariants(ctx, trackName), err)
+}
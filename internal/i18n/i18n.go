@@ -0,0 +1,218 @@
+package i18n
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Language is the base language of a Discord locale, regional variants such as es-ES and es-419 share one.
+type Language string
+
+const (
+	English Language = "en"
+	Spanish Language = "es"
+	French  Language = "fr"
+	German  Language = "de"
+)
+
+// Languages are every language there are strings for, in the order they're offered by /language.
+var Languages = []Language{English, Spanish, French, German}
+
+// Name is the language's name written in itself.
+func (l Language) Name() string {
+	switch l {
+	case Spanish:
+		return "Español"
+	case French:
+		return "Français"
+	case German:
+		return "Deutsch"
+	default:
+		return "English"
+	}
+}
+
+// Parse reads a language code as stored in member preferences, ok is false for languages there are no strings for.
+func Parse(code string) (Language, bool) {
+	for _, language := range Languages {
+		if string(language) == code {
+			return language, true
+		}
+	}
+
+	return English, false
+}
+
+// FromLocale is the language for a Discord client locale, falling back to English for locales there are no strings for.
+func FromLocale(locale discordgo.Locale) Language {
+	base, _, _ := strings.Cut(string(locale), "-")
+
+	language, _ := Parse(strings.ToLower(base))
+
+	return language
+}
+
+// Key names a string in the catalog.
+type Key string
+
+const (
+	UnexpectedError    Key = "unexpected_error"
+	GuildOnly          Key = "guild_only"
+	MissingPermissions Key = "missing_permissions"
+	OwnerOnly          Key = "owner_only"
+
+	DoNotDisturbOnTitle        Key = "dnd_on_title"
+	DoNotDisturbOnDescription  Key = "dnd_on_description"
+	DoNotDisturbOffTitle       Key = "dnd_off_title"
+	DoNotDisturbOffDescription Key = "dnd_off_description"
+
+	LanguageUpdatedTitle    Key = "language_updated_title"
+	LanguageSetDescription  Key = "language_set_description"
+	LanguageAutoDescription Key = "language_auto_description"
+
+	BlacklistScopeIntros Key = "blacklist_scope_intros"
+	BlacklistScopeOutros Key = "blacklist_scope_outros"
+	BlacklistScopeBoth   Key = "blacklist_scope_both"
+
+	AlreadyBlacklistedTitle Key = "already_blacklisted_title"
+	AlreadyBlacklistedHint  Key = "already_blacklisted_hint"
+	BlacklistedTitle        Key = "blacklisted_title"
+	BlacklistedHint         Key = "blacklisted_hint"
+	NotBlacklistedTitle     Key = "not_blacklisted_title"
+	NotBlacklistedHint      Key = "not_blacklisted_hint"
+	WhitelistedTitle        Key = "whitelisted_title"
+	WhitelistedHint         Key = "whitelisted_hint"
+)
+
+// catalog holds every string as a fmt format, English has every key and the other languages fall back to it for any
+// they're missing.
+var catalog = map[Language]map[Key]string{
+	English: {
+		UnexpectedError:    "Oops something went wrong, please try again later!",
+		GuildOnly:          "This command can only be used inside of a server!",
+		MissingPermissions: "You do not have the required permissions to use this command!",
+		OwnerOnly:          "Only the bot owner can use this command!",
+
+		DoNotDisturbOnTitle:        "🔕 Do not disturb respected",
+		DoNotDisturbOnDescription:  "Your voicelines won't play while your status is do not disturb or invisible",
+		DoNotDisturbOffTitle:       "🔔 Do not disturb ignored",
+		DoNotDisturbOffDescription: "Your voicelines will play no matter what your status is",
+
+		LanguageUpdatedTitle:    "🌐 Language updated",
+		LanguageSetDescription:  "I'll reply to you in %s from now on",
+		LanguageAutoDescription: "I'll reply to you in the language your Discord is set to",
+
+		BlacklistScopeIntros: "intros",
+		BlacklistScopeOutros: "outros",
+		BlacklistScopeBoth:   "intros and outros",
+
+		AlreadyBlacklistedTitle: "%s is already blacklisted from %s!",
+		AlreadyBlacklistedHint:  "To remove yourself, use `/whitelist`",
+		BlacklistedTitle:        "%s has been blacklisted from %s!",
+		BlacklistedHint:         "You will no longer hear your %s when joining or leaving a voice channel, if you'd like to undo this use `/whitelist`",
+		NotBlacklistedTitle:     "%s is not blacklisted from %s",
+		NotBlacklistedHint:      "To add yourself to the blacklist, use `/blacklist`",
+		WhitelistedTitle:        "%s's %s have been removed from the blacklist",
+		WhitelistedHint:         "You will now hear your %s again, if you'd like to undo this use `/blacklist`",
+	},
+	Spanish: {
+		UnexpectedError:    "¡Ups, algo salió mal, inténtalo de nuevo más tarde!",
+		GuildOnly:          "¡Este comando solo se puede usar dentro de un servidor!",
+		MissingPermissions: "¡No tienes los permisos necesarios para usar este comando!",
+		OwnerOnly:          "¡Solo el dueño del bot puede usar este comando!",
+
+		DoNotDisturbOnTitle:        "🔕 No molestar respetado",
+		DoNotDisturbOnDescription:  "Tus frases no sonarán mientras tu estado sea no molestar o invisible",
+		DoNotDisturbOffTitle:       "🔔 No molestar ignorado",
+		DoNotDisturbOffDescription: "Tus frases sonarán sin importar tu estado",
+
+		LanguageUpdatedTitle:    "🌐 Idioma actualizado",
+		LanguageSetDescription:  "A partir de ahora te responderé en %s",
+		LanguageAutoDescription: "Te responderé en el idioma que tengas configurado en Discord",
+
+		BlacklistScopeIntros: "intros",
+		BlacklistScopeOutros: "outros",
+		BlacklistScopeBoth:   "intros y outros",
+
+		AlreadyBlacklistedTitle: "¡%s ya está en la lista negra de %s!",
+		AlreadyBlacklistedHint:  "Para quitarte, usa `/whitelist`",
+		BlacklistedTitle:        "¡%s ha sido añadido a la lista negra de %s!",
+		BlacklistedHint:         "Ya no escucharás tus %s al entrar o salir de un canal de voz, si quieres deshacerlo usa `/whitelist`",
+		NotBlacklistedTitle:     "%s no está en la lista negra de %s",
+		NotBlacklistedHint:      "Para añadirte a la lista negra, usa `/blacklist`",
+		WhitelistedTitle:        "Las %[2]s de %[1]s se han quitado de la lista negra",
+		WhitelistedHint:         "Volverás a escuchar tus %s, si quieres deshacerlo usa `/blacklist`",
+	},
+	French: {
+		UnexpectedError:    "Oups, un problème est survenu, réessaie plus tard !",
+		GuildOnly:          "Cette commande ne peut être utilisée que dans un serveur !",
+		MissingPermissions: "Tu n'as pas les permissions nécessaires pour utiliser cette commande !",
+		OwnerOnly:          "Seul le propriétaire du bot peut utiliser cette commande !",
+
+		DoNotDisturbOnTitle:        "🔕 Ne pas déranger respecté",
+		DoNotDisturbOnDescription:  "Tes répliques ne seront pas jouées tant que ton statut est ne pas déranger ou invisible",
+		DoNotDisturbOffTitle:       "🔔 Ne pas déranger ignoré",
+		DoNotDisturbOffDescription: "Tes répliques seront jouées quel que soit ton statut",
+
+		LanguageUpdatedTitle:    "🌐 Langue mise à jour",
+		LanguageSetDescription:  "Je te répondrai désormais en %s",
+		LanguageAutoDescription: "Je te répondrai dans la langue de ton Discord",
+
+		BlacklistScopeIntros: "intros",
+		BlacklistScopeOutros: "outros",
+		BlacklistScopeBoth:   "intros et outros",
+
+		AlreadyBlacklistedTitle: "%s est déjà sur la liste noire des %s !",
+		AlreadyBlacklistedHint:  "Pour te retirer, utilise `/whitelist`",
+		BlacklistedTitle:        "%s a été ajouté à la liste noire des %s !",
+		BlacklistedHint:         "Tu n'entendras plus tes %s en rejoignant ou en quittant un salon vocal, pour annuler utilise `/whitelist`",
+		NotBlacklistedTitle:     "%s n'est pas sur la liste noire des %s",
+		NotBlacklistedHint:      "Pour t'ajouter à la liste noire, utilise `/blacklist`",
+		WhitelistedTitle:        "Les %[2]s de %[1]s ont été retirées de la liste noire",
+		WhitelistedHint:         "Tu entendras de nouveau tes %s, pour annuler utilise `/blacklist`",
+	},
+	German: {
+		UnexpectedError:    "Hoppla, etwas ist schiefgelaufen, bitte versuche es später noch einmal!",
+		GuildOnly:          "Dieser Befehl kann nur auf einem Server verwendet werden!",
+		MissingPermissions: "Dir fehlen die nötigen Berechtigungen für diesen Befehl!",
+		OwnerOnly:          "Nur der Besitzer des Bots kann diesen Befehl verwenden!",
+
+		DoNotDisturbOnTitle:        "🔕 Nicht stören wird beachtet",
+		DoNotDisturbOnDescription:  "Deine Voicelines werden nicht abgespielt, solange dein Status nicht stören oder unsichtbar ist",
+		DoNotDisturbOffTitle:       "🔔 Nicht stören wird ignoriert",
+		DoNotDisturbOffDescription: "Deine Voicelines werden unabhängig von deinem Status abgespielt",
+
+		LanguageUpdatedTitle:    "🌐 Sprache aktualisiert",
+		LanguageSetDescription:  "Ich antworte dir ab jetzt auf %s",
+		LanguageAutoDescription: "Ich antworte dir in der Sprache, auf die dein Discord eingestellt ist",
+
+		BlacklistScopeIntros: "Intros",
+		BlacklistScopeOutros: "Outros",
+		BlacklistScopeBoth:   "Intros und Outros",
+
+		AlreadyBlacklistedTitle: "%s steht bereits für %s auf der Blacklist!",
+		AlreadyBlacklistedHint:  "Um dich zu entfernen, nutze `/whitelist`",
+		BlacklistedTitle:        "%s steht jetzt für %s auf der Blacklist!",
+		BlacklistedHint:         "Du hörst deine %s nicht mehr beim Betreten oder Verlassen eines Sprachkanals, zum Rückgängigmachen nutze `/whitelist`",
+		NotBlacklistedTitle:     "%s steht für %s nicht auf der Blacklist",
+		NotBlacklistedHint:      "Um dich auf die Blacklist zu setzen, nutze `/blacklist`",
+		WhitelistedTitle:        "Die %[2]s von %[1]s wurden von der Blacklist entfernt",
+		WhitelistedHint:         "Du hörst deine %s wieder, zum Rückgängigmachen nutze `/blacklist`",
+	},
+}
+
+// T formats the string for key in language with args.
+func T(language Language, key Key, args ...any) string {
+	format, ok := catalog[language][key]
+	if !ok {
+		format = catalog[English][key]
+	}
+
+	if len(args) == 0 {
+		return format
+	}
+
+	return fmt.Sprintf(format, args...)
+}
@@ -0,0 +1,136 @@
+package lease
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	firebaseAdapter "salutations/internal/firebase"
+	util "salutations/pkg/util"
+
+	"go.uber.org/zap"
+)
+
+// LeasesCollection holds one document per lease naming the instance that holds it.
+const LeasesCollection = "leases"
+
+// Scope decides what a lease covers, one lease for every guild or one per guild so instances can split guilds between them.
+type Scope string
+
+const (
+	ScopeGlobal Scope = "global"
+	ScopeGuild  Scope = "guild"
+)
+
+func ParseScope(scope string) (Scope, error) {
+	switch Scope(scope) {
+	case ScopeGlobal, ScopeGuild:
+		return Scope(scope), nil
+	default:
+		return "", fmt.Errorf("unknown lease scope %q, expected %q or %q", scope, ScopeGlobal, ScopeGuild)
+	}
+}
+
+// Manager decides whether this instance is the active one for a guild. Leases are taken or extended lazily when asked
+// about, once less than half of their ttl is left, and kept until they expire or are released on shutdown.
+type Manager struct {
+	logger          *zap.Logger
+	firebaseAdapter firebaseAdapter.Firebase
+	clock           util.Clock
+	name            string
+	holder          string
+	ttl             time.Duration
+	scope           Scope
+	mu              sync.Mutex
+	// heldUntil is when each lease this instance took expires
+	heldUntil map[string]time.Time
+}
+
+func NewManager(logger *zap.Logger, firebaseAdapter firebaseAdapter.Firebase, clock util.Clock, name string, holder string, ttl time.Duration, scope Scope) (*Manager, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("lease ttl must be positive, got %s", ttl)
+	}
+
+	if holder == "" {
+		return nil, errors.New("lease holder must not be empty")
+	}
+
+	return &Manager{
+		logger:          logger,
+		firebaseAdapter: firebaseAdapter,
+		clock:           clock,
+		name:            name,
+		holder:          holder,
+		ttl:             ttl,
+		scope:           scope,
+		heldUntil:       make(map[string]time.Time),
+	}, nil
+}
+
+func (m *Manager) leaseID(guildID string) string {
+	if m.scope == ScopeGuild {
+		return m.name + "_" + guildID
+	}
+
+	return m.name
+}
+
+// Active reports whether this instance holds the lease covering the guild, taking it if it's free. When firestore
+// can't be reached the instance stays active only as long as the lease it already had.
+func (m *Manager) Active(ctx context.Context, guildID string) bool {
+	leaseID := m.leaseID(guildID)
+	now := m.clock.Now()
+
+	m.mu.Lock()
+	heldUntil := m.heldUntil[leaseID]
+	m.mu.Unlock()
+
+	if heldUntil.Sub(now) > m.ttl/2 {
+		return true
+	}
+
+	expiresAt := now.Add(m.ttl)
+
+	acquired, err := m.firebaseAdapter.AcquireLease(ctx, LeasesCollection, leaseID, m.holder, now, expiresAt)
+	if err != nil {
+		m.logger.Warn("unable to renew lease", zap.Error(err), zap.String("lease", leaseID))
+		return heldUntil.After(now)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !acquired {
+		delete(m.heldUntil, leaseID)
+		return false
+	}
+
+	if _, held := m.heldUntil[leaseID]; !held {
+		m.logger.Info("acquired lease", zap.String("lease", leaseID), zap.String("holder", m.holder))
+	}
+
+	m.heldUntil[leaseID] = expiresAt
+
+	return true
+}
+
+// ReleaseAll gives up every lease this instance holds so that another instance can take over straight away.
+func (m *Manager) ReleaseAll(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	errs := []error{}
+
+	for leaseID := range m.heldUntil {
+		if err := m.firebaseAdapter.ReleaseLease(ctx, LeasesCollection, leaseID, m.holder); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		delete(m.heldUntil, leaseID)
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,276 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"salutations/internal/cogs"
+	"salutations/internal/embeds"
+	firebaseAdapter "salutations/internal/firebase"
+	"salutations/internal/greeter"
+	"salutations/internal/router"
+	"salutations/internal/scheduler"
+	"salutations/internal/settings"
+	util "salutations/pkg/util"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+)
+
+const cleanupInterval = time.Hour
+
+type lifecycleRunner struct {
+	logger          *zap.Logger
+	firebaseAdapter firebaseAdapter.Firebase
+	settings        *settings.Store
+	clock           util.Clock
+	scheduler       *scheduler.Scheduler
+	// retention is how long a removed guild's data is kept in case the bot is added back, zero keeps it forever.
+	retention time.Duration
+	mu        sync.Mutex
+	// knownGuilds are the guilds listed in Ready, their GuildCreate events are replays rather than new joins.
+	knownGuilds map[string]bool
+	// bucket is where guilds without storage of their own keep their objects
+	bucket string
+}
+
+var _ cogs.Cogs = (*lifecycleRunner)(nil)
+
+func NewLifecycleRunner(logger *zap.Logger, firebaseAdapter firebaseAdapter.Firebase, settingsStore *settings.Store, bucket string, clock util.Clock, jobs *scheduler.Scheduler, retention time.Duration) (*lifecycleRunner, error) {
+	if retention < 0 {
+		return nil, fmt.Errorf("guild data retention must not be negative, got %s", retention)
+	}
+
+	return &lifecycleRunner{
+		logger:          logger,
+		firebaseAdapter: firebaseAdapter,
+		settings:        settingsStore,
+		bucket:          bucket,
+		clock:           clock,
+		scheduler:       jobs,
+		retention:       retention,
+		knownGuilds:     make(map[string]bool),
+	}, nil
+}
+
+func (l *lifecycleRunner) GetCommands() []*discordgo.ApplicationCommand {
+	return []*discordgo.ApplicationCommand{}
+}
+
+func (l *lifecycleRunner) RegisterHandlers(session *discordgo.Session, _ *router.Router) {
+	// Handlers are registered from within the first Ready, so its guilds have to be read from state
+	session.State.RLock()
+	l.mu.Lock()
+	for _, guild := range session.State.Guilds {
+		l.knownGuilds[guild.ID] = true
+	}
+	l.mu.Unlock()
+	session.State.RUnlock()
+
+	session.AddHandler(l.ready)
+	session.AddHandler(l.guildCreate)
+	session.AddHandler(l.guildDelete)
+
+	if l.retention > 0 {
+		err := l.scheduler.Register(scheduler.Job{
+			Name:      "guild-data-cleanup",
+			Interval:  cleanupInterval,
+			Jitter:    time.Minute * 5,
+			Exclusive: true,
+			Run:       l.cleanupRemovedGuilds,
+		})
+		if err != nil {
+			l.logger.Error("unable to schedule removed guild cleanup", zap.Error(err))
+		}
+	}
+}
+
+func (l *lifecycleRunner) ready(_ *discordgo.Session, event *discordgo.Ready) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, guild := range event.Guilds {
+		l.knownGuilds[guild.ID] = true
+	}
+}
+
+// guildCreate fires for every guild on startup as well as when the bot is added to one, only guilds
+// without settings or that were previously removed are treated as new.
+func (l *lifecycleRunner) guildCreate(session *discordgo.Session, event *discordgo.GuildCreate) {
+	ctx := context.Background()
+	logger := l.logger.With(zap.String("guild_id", event.ID), zap.String("guild_name", event.Name))
+
+	l.mu.Lock()
+	known := l.knownGuilds[event.ID]
+	l.knownGuilds[event.ID] = true
+	l.mu.Unlock()
+
+	guildSettings, err := l.settings.Get(ctx, event.ID)
+
+	switch {
+	case errors.Is(err, settings.ErrNotFound):
+		if _, err := l.settings.Create(ctx, event.ID, event.Name); err != nil {
+			logger.Error("unable to create guild settings", zap.Error(err))
+			return
+		}
+
+		// Guilds the bot was already in before settings existed are provisioned without announcing anything
+		if known {
+			logger.Info("provisioned settings for existing guild")
+			return
+		}
+
+		logger.Info("joined new guild")
+	case err != nil:
+		logger.Error("unable to get guild settings", zap.Error(err))
+		return
+	case !guildSettings.RemovedAt.IsZero():
+		if err := l.settings.MarkRejoined(ctx, event.ID, event.Name); err != nil {
+			logger.Error("unable to restore guild settings", zap.Error(err))
+			return
+		}
+
+		logger.Info("rejoined guild", zap.Time("removed_at", guildSettings.RemovedAt))
+
+		// Discord forgets the bot's nickname when it's removed
+		if guildSettings.Nickname != "" {
+			if err := session.GuildMemberNickname(event.ID, "@me", guildSettings.Nickname); err != nil {
+				logger.Warn("unable to restore nickname", zap.Error(err))
+			}
+		}
+	default:
+		return
+	}
+
+	l.sendSetupMessage(session, event.Guild, logger)
+}
+
+func (l *lifecycleRunner) guildDelete(_ *discordgo.Session, event *discordgo.GuildDelete) {
+	logger := l.logger.With(zap.String("guild_id", event.ID))
+
+	// Outages also emit GuildDelete, only an available guild means the bot was actually removed
+	if event.Unavailable {
+		logger.Warn("guild became unavailable")
+		return
+	}
+
+	l.mu.Lock()
+	delete(l.knownGuilds, event.ID)
+	l.mu.Unlock()
+
+	if err := l.settings.MarkRemoved(context.Background(), event.ID); err != nil && !errors.Is(err, settings.ErrNotFound) {
+		logger.Error("unable to mark guild as removed", zap.Error(err))
+		return
+	}
+
+	logger.Info("removed from guild", zap.Duration("retention", l.retention))
+}
+
+// sendSetupMessage posts to the system channel, or the first text channel the bot can talk in.
+func (l *lifecycleRunner) sendSetupMessage(session *discordgo.Session, guild *discordgo.Guild, logger *zap.Logger) {
+	canSend := func(channelID string) bool {
+		perms, err := session.UserChannelPermissions(session.State.User.ID, channelID)
+		return err == nil && perms&discordgo.PermissionSendMessages != 0 && perms&discordgo.PermissionEmbedLinks != 0
+	}
+
+	channelID := ""
+	if guild.SystemChannelID != "" && canSend(guild.SystemChannelID) {
+		channelID = guild.SystemChannelID
+	} else {
+		for _, channel := range guild.Channels {
+			if channel.Type == discordgo.ChannelTypeGuildText && canSend(channel.ID) {
+				channelID = channel.ID
+				break
+			}
+		}
+	}
+
+	if channelID == "" {
+		logger.Info("no channel available to send setup message in")
+		return
+	}
+
+	if _, err := session.ChannelMessageSendEmbed(channelID, embeds.SetupEmbed()); err != nil {
+		logger.Warn("unable to send setup message", zap.Error(err), zap.String("channel_id", channelID))
+	}
+}
+
+// cleanupRemovedGuilds deletes the settings, guild audio, greeting history, first joins and storage usage of guilds removed longer than the retention window ago.
+// Voicelines belong to members rather than guilds, so they are left in place.
+func (l *lifecycleRunner) cleanupRemovedGuilds(ctx context.Context) error {
+	guildIDs, err := l.settings.RemovedBefore(ctx, l.clock.Now().Add(-l.retention))
+	if err != nil {
+		return err
+	}
+
+	errs := []error{}
+
+	for _, guildID := range guildIDs {
+		if err := l.cleanupGuild(ctx, guildID); err != nil {
+			errs = append(errs, fmt.Errorf("guild %s: %w", guildID, err))
+			continue
+		}
+
+		l.logger.Info("cleaned up removed guild data", zap.String("guild_id", guildID))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (l *lifecycleRunner) cleanupGuild(ctx context.Context, guildID string) error {
+	for _, collection := range []string{greeter.GreetingPlaysCollection, greeter.GreetingSkipsCollection, greeter.FirstSeenCollection, greeter.GuessScoresCollection, greeter.StorageChargesCollection} {
+		records, err := l.firebaseAdapter.QueryDocuments(ctx, collection, firebaseAdapter.QueryFilter{Path: "guild_id", Op: "==", Value: guildID})
+		if err != nil {
+			return err
+		}
+
+		for recordID := range records {
+			if err := l.firebaseAdapter.DeleteDocument(ctx, collection, recordID); err != nil {
+				return err
+			}
+		}
+	}
+
+	location := firebaseAdapter.Location{Bucket: l.bucket}
+
+	if guildSettings, err := l.settings.Get(ctx, guildID); err == nil {
+		location = guildSettings.Storage(l.bucket)
+
+		objectNames := []string{guildSettings.BotSound, guildSettings.DefaultIntro, guildSettings.DefaultOutro, guildSettings.FirstJoinClip}
+		for _, stinger := range guildSettings.RoleStingers {
+			objectNames = append(objectNames, stinger.Object)
+		}
+
+		for _, objectName := range objectNames {
+			if objectName == "" {
+				continue
+			}
+
+			// A missing object shouldn't hold up the rest of the cleanup forever
+			if err := l.firebaseAdapter.DeleteFileFromStorage(ctx, location.Bucket, location.Object(objectName)); err != nil {
+				l.logger.Warn("unable to delete guild audio", zap.Error(err), zap.String("guild_id", guildID), zap.String("object", objectName))
+			}
+		}
+	}
+
+	exports, err := l.firebaseAdapter.ListFilesInStorage(ctx, location.Bucket, location.Object(greeter.ExportPrefix(guildID)))
+	if err != nil {
+		return err
+	}
+
+	for _, export := range exports {
+		if err := l.firebaseAdapter.DeleteFileFromStorage(ctx, location.Bucket, export); err != nil {
+			return err
+		}
+	}
+
+	if err := l.firebaseAdapter.DeleteDocument(ctx, greeter.StorageUsageCollection, guildID); err != nil {
+		return err
+	}
+
+	// Settings go last so a failed cleanup is retried on the next run
+	return l.settings.Delete(ctx, guildID)
+}
@@ -0,0 +1,89 @@
+package logging
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	util "salutations/pkg/util"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type Config struct {
+	// Level is any level understood by zapcore.ParseLevel, defaults to info.
+	Level string
+	// Format is either "json" or "console", defaults to json.
+	Format string
+}
+
+func NewLogger(config Config) (*zap.Logger, zap.AtomicLevel, error) {
+	level := zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	if config.Level != "" {
+		parsedLevel, err := zapcore.ParseLevel(config.Level)
+		if err != nil {
+			return nil, level, fmt.Errorf("error parsing log level: %w", err)
+		}
+
+		level.SetLevel(parsedLevel)
+	}
+
+	zapConfig := zap.NewProductionConfig()
+
+	switch strings.ToLower(config.Format) {
+	case "", "json":
+	case "console":
+		zapConfig = zap.NewDevelopmentConfig()
+	default:
+		return nil, level, fmt.Errorf("unknown log format: %s", config.Format)
+	}
+
+	zapConfig.Level = level
+
+	logger, err := zapConfig.Build()
+	if err != nil {
+		return nil, level, fmt.Errorf("error building logger: %w", err)
+	}
+
+	return logger, level, nil
+}
+
+// LevelHandler exposes the atomic level over HTTP, GET returns the current level and PUT changes it.
+func LevelHandler(level zap.AtomicLevel) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/loglevel", level)
+
+	return mux
+}
+
+func InteractionFields(interaction *discordgo.InteractionCreate) []zap.Field {
+	return []zap.Field{
+		zap.String("guild_id", interaction.GuildID),
+		zap.String("channel_id", interaction.ChannelID),
+		zap.String("user_id", util.InteractionUserID(interaction)),
+		zap.String("interaction", util.InteractionName(interaction)),
+		zap.String("interaction_type", interaction.Type.String()),
+	}
+}
+
+// WithInteraction returns a child logger carrying the guild, channel, user and command of the interaction.
+func WithInteraction(logger *zap.Logger, interaction *discordgo.InteractionCreate) *zap.Logger {
+	return logger.With(InteractionFields(interaction)...)
+}
+
+// WithVoiceState returns a child logger carrying the guild, channel and user of a voice state update.
+func WithVoiceState(logger *zap.Logger, voiceState *discordgo.VoiceStateUpdate) *zap.Logger {
+	fields := []zap.Field{
+		zap.String("guild_id", voiceState.GuildID),
+		zap.String("channel_id", voiceState.ChannelID),
+		zap.String("user_id", voiceState.UserID),
+	}
+
+	if voiceState.BeforeUpdate != nil {
+		fields = append(fields, zap.String("previous_channel_id", voiceState.BeforeUpdate.ChannelID))
+	}
+
+	return logger.With(fields...)
+}
@@ -0,0 +1,169 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"salutations/internal/embeds"
+	"salutations/internal/i18n"
+	"salutations/internal/logging"
+	"salutations/internal/reporting"
+	util "salutations/pkg/util"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+)
+
+type HandlerFunc func(session *discordgo.Session, interaction *discordgo.InteractionCreate) error
+
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// Chain wraps handler so that the first middleware given is the outermost one.
+func Chain(handler HandlerFunc, middlewares ...Middleware) HandlerFunc {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+
+	return handler
+}
+
+func Recover(logger *zap.Logger, reporter reporting.Reporter) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(session *discordgo.Session, interaction *discordgo.InteractionCreate) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					logging.WithInteraction(logger, interaction).Error("recovered from panic in interaction handler", zap.Any("panic", r), zap.Stack("stack"))
+					err = fmt.Errorf("panic in interaction handler: %v", r)
+					reporter.Report(context.Background(), err, map[string]string{
+						"guild_id":    interaction.GuildID,
+						"user_id":     util.InteractionUserID(interaction),
+						"interaction": util.InteractionName(interaction),
+					})
+				}
+			}()
+
+			return next(session, interaction)
+		}
+	}
+}
+
+func Logger(logger *zap.Logger) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+			start := time.Now()
+			err := next(session, interaction)
+
+			interactionLogger := logging.WithInteraction(logger, interaction)
+			if err != nil {
+				interactionLogger.Error("an error occurred when executing interaction", zap.Error(err), zap.Duration("latency", time.Since(start)))
+			} else {
+				interactionLogger.Info("interaction handled", zap.Duration("latency", time.Since(start)))
+			}
+
+			return err
+		}
+	}
+}
+
+// ErrorResponder lets the user know something went wrong whenever the wrapped handler fails,
+// falling back to a follow up message when the interaction has already been acknowledged. Like the other guards here
+// it answers in the language of the user's Discord client, a /language preference only applies inside handlers.
+func ErrorResponder(logger *zap.Logger) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+			err := next(session, interaction)
+			if err == nil {
+				return nil
+			}
+
+			message, respondErr := respondWithEmbed(session, interaction, embeds.UnexpectedErrorEmbed(i18n.FromLocale(interaction.Locale)), false)
+			if respondErr != nil {
+				logging.WithInteraction(logger, interaction).Error("unable to send unexpected error response", zap.Error(respondErr))
+				return err
+			}
+
+			util.DeleteMessageAfterTime(session, interaction.ChannelID, message.ID, time.Second*30)
+
+			return err
+		}
+	}
+}
+
+// Defer acknowledges the interaction up front for handlers that may take longer than Discord's response window.
+func Defer(ephemeral bool) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+			if err := deferResponse(session, interaction, ephemeral); err != nil {
+				return err
+			}
+
+			_, forget := track(interaction, deferred)
+			defer forget()
+
+			return next(session, interaction)
+		}
+	}
+}
+
+func RequireGuild() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+			if interaction.GuildID == "" || interaction.Member == nil {
+				_, err := respondWithEmbed(session, interaction, embeds.ErrorMessageEmbed(i18n.T(i18n.FromLocale(interaction.Locale), i18n.GuildOnly)), true)
+				return err
+			}
+
+			return next(session, interaction)
+		}
+	}
+}
+
+func RequirePermissions(permissions int64) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+			if interaction.Member == nil || interaction.Member.Permissions&permissions != permissions {
+				_, err := respondWithEmbed(session, interaction, embeds.ErrorMessageEmbed(i18n.T(i18n.FromLocale(interaction.Locale), i18n.MissingPermissions)), true)
+				return err
+			}
+
+			return next(session, interaction)
+		}
+	}
+}
+
+func RequireOwner(ownerIDs []string) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+			if !slices.Contains(ownerIDs, util.InteractionUserID(interaction)) {
+				_, err := respondWithEmbed(session, interaction, embeds.ErrorMessageEmbed(i18n.T(i18n.FromLocale(interaction.Locale), i18n.OwnerOnly)), true)
+				return err
+			}
+
+			return next(session, interaction)
+		}
+	}
+}
+
+func respondWithEmbed(session *discordgo.Session, interaction *discordgo.InteractionCreate, embed *discordgo.MessageEmbed, ephemeral bool) (*discordgo.Message, error) {
+	var flags discordgo.MessageFlags
+	if ephemeral {
+		flags = discordgo.MessageFlagsEphemeral
+	}
+
+	return Respond(session, interaction, &discordgo.InteractionResponseData{
+		Embeds: []*discordgo.MessageEmbed{embed},
+		Flags:  flags,
+	})
+}
+
+func isAlreadyAcknowledged(err error) bool {
+	var restErr *discordgo.RESTError
+	if !errors.As(err, &restErr) {
+		return false
+	}
+
+	return restErr.Message != nil && restErr.Message.Code == discordgo.ErrCodeInteractionHasAlreadyBeenAcknowledged
+}
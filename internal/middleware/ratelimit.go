@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"salutations/internal/embeds"
+	util "salutations/pkg/util"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+type RateLimitConfig struct {
+	// Burst is the amount of interactions a user can make back to back before being limited.
+	Burst int
+	// Refill is how long it takes for a single token to be returned to the bucket.
+	Refill time.Duration
+	// Clock defaults to util.RealClock when unset.
+	Clock util.Clock
+	// Relaxed reports whether the interaction gets relaxedRateLimitFactor times the burst and refill, such as
+	// during a guild's event. Nothing is relaxed when unset.
+	Relaxed func(interaction *discordgo.InteractionCreate) bool
+}
+
+// relaxedRateLimitFactor is how much looser relaxed interactions are limited
+const relaxedRateLimitFactor = 4
+
+type tokenBucket struct {
+	tokens     float64
+	lastRefill time.Time
+}
+
+type RateLimiter struct {
+	mu        sync.Mutex
+	config    RateLimitConfig
+	buckets   map[string]*tokenBucket
+	lastPrune time.Time
+	// relaxed limits the interactions config.Relaxed reports, nil when it's unset
+	relaxed *RateLimiter
+}
+
+func NewRateLimiter(config RateLimitConfig) *RateLimiter {
+	if config.Clock == nil {
+		config.Clock = util.RealClock
+	}
+
+	limiter := &RateLimiter{
+		config:    config,
+		buckets:   make(map[string]*tokenBucket),
+		lastPrune: config.Clock.Now(),
+	}
+
+	if config.Relaxed != nil {
+		limiter.relaxed = NewRateLimiter(RateLimitConfig{
+			Burst:  config.Burst * relaxedRateLimitFactor,
+			Refill: config.Refill / relaxedRateLimitFactor,
+			Clock:  config.Clock,
+		})
+	}
+
+	return limiter
+}
+
+// Allow consumes a token for key, returning how long the caller has to wait when none are available.
+func (r *RateLimiter) Allow(key string) (bool, time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.config.Clock.Now()
+	r.prune(now)
+
+	bucket, ok := r.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(r.config.Burst), lastRefill: now}
+		r.buckets[key] = bucket
+	}
+
+	r.refill(bucket, now)
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - bucket.tokens) * float64(r.config.Refill))
+
+	return false, wait
+}
+
+func (r *RateLimiter) refill(bucket *tokenBucket, now time.Time) {
+	elapsed := now.Sub(bucket.lastRefill)
+	bucket.tokens = math.Min(float64(r.config.Burst), bucket.tokens+float64(elapsed)/float64(r.config.Refill))
+	bucket.lastRefill = now
+}
+
+// prune drops buckets that have fully refilled so idle users don't accumulate in memory.
+func (r *RateLimiter) prune(now time.Time) {
+	window := r.config.Refill * time.Duration(r.config.Burst)
+	if now.Sub(r.lastPrune) < window {
+		return
+	}
+
+	for key, bucket := range r.buckets {
+		if now.Sub(bucket.lastRefill) >= window {
+			delete(r.buckets, key)
+		}
+	}
+
+	r.lastPrune = now
+}
+
+// RateLimit limits how often each user can run the wrapped interaction, keyed by user and interaction name.
+func RateLimit(limiter *RateLimiter) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+			key := util.InteractionUserID(interaction) + "|" + util.InteractionName(interaction)
+
+			bucketLimiter := limiter
+			if limiter.relaxed != nil && limiter.config.Relaxed(interaction) {
+				bucketLimiter = limiter.relaxed
+			}
+
+			if allowed, retryAfter := bucketLimiter.Allow(key); !allowed {
+				_, err := respondWithEmbed(session, interaction, embeds.CooldownEmbed(util.InteractionName(interaction), retryAfter), true)
+				return err
+			}
+
+			return next(session, interaction)
+		}
+	}
+}
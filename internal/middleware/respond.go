@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// DefaultAutoDeferAfter leaves a second of Discord's three second response window for the deferral itself to arrive.
+const DefaultAutoDeferAfter = time.Second * 2
+
+type acknowledgementState int
+
+const (
+	pending acknowledgementState = iota
+	deferred
+	responded
+)
+
+// acknowledgement is how an interaction handled by Defer or AutoDefer has been acknowledged so far. The mutex is held
+// for the whole request so a deferral and a response racing each other can't both be sent.
+type acknowledgement struct {
+	mu    sync.Mutex
+	state acknowledgementState
+}
+
+// acknowledgements are keyed by interaction ID and only live for as long as the handler is running.
+var acknowledgements sync.Map
+
+func track(interaction *discordgo.InteractionCreate, state acknowledgementState) (*acknowledgement, func()) {
+	ack := &acknowledgement{state: state}
+	acknowledgements.Store(interaction.ID, ack)
+
+	return ack, func() { acknowledgements.Delete(interaction.ID) }
+}
+
+// AutoDefer acknowledges the interaction only once the handler has run for longer than after without responding
+// through Respond, so quick responses aren't turned into a "thinking..." message first. Handlers behind it must
+// respond through Respond, which sends a follow up once the deferral has gone out.
+func AutoDefer(after time.Duration, ephemeral bool) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+			ack, forget := track(interaction, pending)
+			defer forget()
+
+			timer := time.AfterFunc(after, func() {
+				ack.mu.Lock()
+				defer ack.mu.Unlock()
+
+				if ack.state != pending {
+					return
+				}
+
+				if err := deferResponse(session, interaction, ephemeral); err == nil {
+					ack.state = deferred
+				}
+			})
+			defer timer.Stop()
+
+			return next(session, interaction)
+		}
+	}
+}
+
+func deferResponse(session *discordgo.Session, interaction *discordgo.InteractionCreate, ephemeral bool) error {
+	response := &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	}
+
+	if ephemeral {
+		response.Data = &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral}
+	}
+
+	if err := session.InteractionRespond(interaction.Interaction, response); err != nil {
+		return fmt.Errorf("error attempting to defer interaction response: %w", err)
+	}
+
+	return nil
+}
+
+// Respond sends data as the interaction's response and returns the message it created. Interactions that were already
+// deferred or responded to get a follow up instead, either because Defer or AutoDefer recorded it or because Discord
+// says so for handlers that aren't behind either.
+func Respond(session *discordgo.Session, interaction *discordgo.InteractionCreate, data *discordgo.InteractionResponseData) (*discordgo.Message, error) {
+	value, ok := acknowledgements.Load(interaction.ID)
+	if !ok {
+		err := respond(session, interaction, data)
+		if err == nil {
+			return session.InteractionResponse(interaction.Interaction)
+		}
+
+		if !isAlreadyAcknowledged(err) {
+			return nil, err
+		}
+
+		return followup(session, interaction, data)
+	}
+
+	ack := value.(*acknowledgement)
+
+	ack.mu.Lock()
+	defer ack.mu.Unlock()
+
+	if ack.state != pending {
+		return followup(session, interaction, data)
+	}
+
+	if err := respond(session, interaction, data); err != nil {
+		return nil, err
+	}
+
+	ack.state = responded
+
+	return session.InteractionResponse(interaction.Interaction)
+}
+
+func respond(session *discordgo.Session, interaction *discordgo.InteractionCreate, data *discordgo.InteractionResponseData) error {
+	return session.InteractionRespond(interaction.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: data,
+	})
+}
+
+func followup(session *discordgo.Session, interaction *discordgo.InteractionCreate, data *discordgo.InteractionResponseData) (*discordgo.Message, error) {
+	return session.FollowupMessageCreate(interaction.Interaction, true, &discordgo.WebhookParams{
+		Content:         data.Content,
+		Embeds:          data.Embeds,
+		Components:      data.Components,
+		Files:           data.Files,
+		AllowedMentions: data.AllowedMentions,
+		Flags:           data.Flags,
+	})
+}
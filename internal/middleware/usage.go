@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// UsageRecorder is told about every slash command once its handler returns.
+type UsageRecorder interface {
+	Record(guildID string, command string, latency time.Duration, err error)
+}
+
+// Usage records how often each slash command is used and how long it takes, components, autocomplete and modals are
+// part of the command that showed them so they aren't counted.
+func Usage(recorder UsageRecorder) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(session *discordgo.Session, interaction *discordgo.InteractionCreate) error {
+			if interaction.Type != discordgo.InteractionApplicationCommand {
+				return next(session, interaction)
+			}
+
+			start := time.Now()
+			err := next(session, interaction)
+
+			recorder.Record(interaction.GuildID, commandPath(interaction.ApplicationCommandData()), time.Since(start), err)
+
+			return err
+		}
+	}
+}
+
+// commandPath names the command along with the subcommand group and subcommand that were invoked, such as
+// "admin usage", so subcommands are told apart.
+func commandPath(data discordgo.ApplicationCommandInteractionData) string {
+	path := []string{data.Name}
+
+	options := data.Options
+	for len(options) > 0 {
+		option := options[0]
+		if option.Type != discordgo.ApplicationCommandOptionSubCommand && option.Type != discordgo.ApplicationCommandOptionSubCommandGroup {
+			break
+		}
+
+		path = append(path, option.Name)
+		options = option.Options
+	}
+
+	return strings.Join(path, " ")
+}
@@ -0,0 +1,155 @@
+package presence
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"salutations/internal/cogs"
+	"salutations/internal/router"
+	"salutations/internal/scheduler"
+	"salutations/internal/settings"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultRotation is how long each status is shown when no rotation is configured
+	DefaultRotation = time.Minute * 5
+	// minRotation keeps presence updates well under Discord's gateway rate limit
+	minRotation = time.Minute
+)
+
+// DefaultStatuses are shown when none are configured.
+var DefaultStatuses = []string{"/help"}
+
+// Config is the presence every guild sees, guilds can add a status of their own to the rotation with /guildsettings.
+type Config struct {
+	// Statuses are rotated through before the guilds' own, the first is shown as soon as the bot connects
+	Statuses []string
+	// Rotation is how long each status is shown
+	Rotation time.Duration
+}
+
+type presenceRunner struct {
+	logger    *zap.Logger
+	settings  *settings.Store
+	scheduler *scheduler.Scheduler
+	config    Config
+	mu        sync.Mutex
+	session   *discordgo.Session
+	// next is the position in the rotation of the status shown next, shown is the one showing now
+	next  int
+	shown string
+}
+
+var _ cogs.Cogs = (*presenceRunner)(nil)
+
+// withDefaults falls back to DefaultStatuses when there are no statuses and to DefaultRotation for a zero rotation.
+func (c Config) withDefaults() Config {
+	if len(c.Statuses) == 0 {
+		c.Statuses = DefaultStatuses
+	}
+
+	if c.Rotation == 0 {
+		c.Rotation = DefaultRotation
+	}
+
+	return c
+}
+
+// Identify is the presence the bot connects with, the first configured status.
+func Identify(config Config) discordgo.GatewayStatusUpdate {
+	return discordgo.GatewayStatusUpdate{
+		Game: discordgo.Activity{
+			Name: config.withDefaults().Statuses[0],
+			Type: discordgo.ActivityTypeGame,
+		},
+	}
+}
+
+func NewPresenceRunner(logger *zap.Logger, settingsStore *settings.Store, jobs *scheduler.Scheduler, config Config) (*presenceRunner, error) {
+	config = config.withDefaults()
+	if config.Rotation < minRotation {
+		return nil, fmt.Errorf("presence rotation must be at least %s, got %s", minRotation, config.Rotation)
+	}
+
+	return &presenceRunner{
+		logger:    logger,
+		settings:  settingsStore,
+		scheduler: jobs,
+		config:    config,
+		// The first status is already showing since the bot identifies with it
+		next:  1,
+		shown: config.Statuses[0],
+	}, nil
+}
+
+func (p *presenceRunner) GetCommands() []*discordgo.ApplicationCommand {
+	return []*discordgo.ApplicationCommand{}
+}
+
+func (p *presenceRunner) RegisterHandlers(session *discordgo.Session, _ *router.Router) {
+	p.mu.Lock()
+	p.session = session
+	p.mu.Unlock()
+
+	err := p.scheduler.Register(scheduler.Job{
+		Name:     "presence-rotation",
+		Interval: p.config.Rotation,
+		Run:      p.rotate,
+	})
+	if err != nil {
+		p.logger.Error("unable to schedule presence rotation", zap.Error(err))
+	}
+}
+
+// statuses are the configured statuses followed by the guilds' own, a status several guilds picked is shown once.
+func (p *presenceRunner) statuses(ctx context.Context) []string {
+	statuses := slices.Clone(p.config.Statuses)
+
+	guildStatuses, err := p.settings.GuildStatuses(ctx)
+	if err != nil {
+		// The configured statuses are still worth rotating through
+		p.logger.Warn("unable to get guild statuses", zap.Error(err))
+		return statuses
+	}
+
+	for _, status := range guildStatuses {
+		if !slices.Contains(statuses, status) {
+			statuses = append(statuses, status)
+		}
+	}
+
+	return statuses
+}
+
+// rotate shows the next status in the rotation, nothing is sent when it's the one already showing.
+func (p *presenceRunner) rotate(ctx context.Context) error {
+	statuses := p.statuses(ctx)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	status := statuses[p.next%len(statuses)]
+	p.next = (p.next + 1) % len(statuses)
+
+	if status == p.shown {
+		return nil
+	}
+
+	err := p.session.UpdateStatusComplex(discordgo.UpdateStatusData{
+		Activities: []*discordgo.Activity{{Name: status, Type: discordgo.ActivityTypeGame}},
+		Status:     string(discordgo.StatusOnline),
+	})
+	if err != nil {
+		return fmt.Errorf("error updating presence: %w", err)
+	}
+
+	p.shown = status
+
+	return nil
+}
@@ -0,0 +1,184 @@
+package reporting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	util "salutations/pkg/util"
+
+	"cloud.google.com/go/errorreporting"
+	"github.com/getsentry/sentry-go"
+	"go.uber.org/zap"
+	"google.golang.org/api/option"
+)
+
+// Reporter forwards errors to an external service so that they reach the operator instead of only the logs.
+type Reporter interface {
+	Report(ctx context.Context, err error, tags map[string]string)
+	Close() error
+}
+
+type noopReporter struct{}
+
+var _ Reporter = noopReporter{}
+
+func NewNoopReporter() Reporter {
+	return noopReporter{}
+}
+
+func (noopReporter) Report(context.Context, error, map[string]string) {}
+
+func (noopReporter) Close() error {
+	return nil
+}
+
+type SentryReporter struct {
+	hub *sentry.Hub
+}
+
+var _ Reporter = (*SentryReporter)(nil)
+
+func NewSentryReporter(dsn string, environment string) (*SentryReporter, error) {
+	client, err := sentry.NewClient(sentry.ClientOptions{
+		Dsn:         dsn,
+		Environment: environment,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating sentry client: %w", err)
+	}
+
+	return &SentryReporter{
+		hub: sentry.NewHub(client, sentry.NewScope()),
+	}, nil
+}
+
+func (s *SentryReporter) Report(_ context.Context, err error, tags map[string]string) {
+	s.hub.WithScope(func(scope *sentry.Scope) {
+		scope.SetTags(tags)
+		s.hub.CaptureException(err)
+	})
+}
+
+func (s *SentryReporter) Close() error {
+	if !s.hub.Flush(time.Second * 5) {
+		return errors.New("timed out flushing sentry events")
+	}
+
+	return nil
+}
+
+type GoogleReporter struct {
+	client *errorreporting.Client
+}
+
+var _ Reporter = (*GoogleReporter)(nil)
+
+func NewGoogleReporter(ctx context.Context, projectID string, serviceName string, logger *zap.Logger, opts ...option.ClientOption) (*GoogleReporter, error) {
+	client, err := errorreporting.NewClient(ctx, projectID, errorreporting.Config{
+		ServiceName: serviceName,
+		OnError: func(err error) {
+			logger.Warn("error reporting to google error reporting", zap.Error(err))
+		},
+	}, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating error reporting client: %w", err)
+	}
+
+	return &GoogleReporter{client: client}, nil
+}
+
+func (g *GoogleReporter) Report(_ context.Context, err error, tags map[string]string) {
+	g.client.Report(errorreporting.Entry{
+		Error: err,
+		User:  tags["user_id"],
+	})
+}
+
+func (g *GoogleReporter) Close() error {
+	return g.client.Close()
+}
+
+type multiReporter []Reporter
+
+// NewMultiReporter fans reports out to every given reporter.
+func NewMultiReporter(reporters ...Reporter) Reporter {
+	if len(reporters) == 0 {
+		return noopReporter{}
+	}
+
+	return multiReporter(reporters)
+}
+
+func (m multiReporter) Report(ctx context.Context, err error, tags map[string]string) {
+	for _, reporter := range m {
+		reporter.Report(ctx, err, tags)
+	}
+}
+
+func (m multiReporter) Close() error {
+	var errs []error
+	for _, reporter := range m {
+		errs = append(errs, reporter.Close())
+	}
+
+	return errors.Join(errs...)
+}
+
+// FailureTracker only reports once a key has failed threshold times in a row within window,
+// so that a single flaky request doesn't page anyone but a failing dependency does.
+type FailureTracker struct {
+	reporter  Reporter
+	threshold int
+	window    time.Duration
+	clock     util.Clock
+	mu        sync.Mutex
+	failures  map[string][]time.Time
+}
+
+func NewFailureTracker(reporter Reporter, threshold int, window time.Duration, clock util.Clock) *FailureTracker {
+	return &FailureTracker{
+		reporter:  reporter,
+		threshold: threshold,
+		window:    window,
+		clock:     clock,
+		failures:  make(map[string][]time.Time),
+	}
+}
+
+func (f *FailureTracker) Failure(ctx context.Context, key string, err error, tags map[string]string) {
+	f.mu.Lock()
+
+	now := f.clock.Now()
+	recent := []time.Time{}
+
+	for _, failedAt := range f.failures[key] {
+		if now.Sub(failedAt) < f.window {
+			recent = append(recent, failedAt)
+		}
+	}
+
+	recent = append(recent, now)
+	shouldReport := len(recent) >= f.threshold
+
+	if shouldReport {
+		delete(f.failures, key)
+	} else {
+		f.failures[key] = recent
+	}
+
+	f.mu.Unlock()
+
+	if shouldReport {
+		f.reporter.Report(ctx, fmt.Errorf("%s failed %d times within %s: %w", key, len(recent), f.window, err), tags)
+	}
+}
+
+func (f *FailureTracker) Success(key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.failures, key)
+}
@@ -0,0 +1,100 @@
+package router
+
+import (
+	"slices"
+	"sync"
+
+	"salutations/internal/middleware"
+	util "salutations/pkg/util"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+)
+
+type Router struct {
+	logger       *zap.Logger
+	middlewares  []middleware.Middleware
+	mu           sync.RWMutex
+	commands     map[string]middleware.HandlerFunc
+	components   map[string]middleware.HandlerFunc
+	autocomplete map[string]middleware.HandlerFunc
+	modals       map[string]middleware.HandlerFunc
+}
+
+// NewRouter creates a router that wraps every registered handler with the given middlewares.
+func NewRouter(logger *zap.Logger, middlewares ...middleware.Middleware) *Router {
+	return &Router{
+		logger:       logger,
+		middlewares:  middlewares,
+		commands:     make(map[string]middleware.HandlerFunc),
+		components:   make(map[string]middleware.HandlerFunc),
+		autocomplete: make(map[string]middleware.HandlerFunc),
+		modals:       make(map[string]middleware.HandlerFunc),
+	}
+}
+
+func (r *Router) wrap(handler middleware.HandlerFunc, middlewares []middleware.Middleware) middleware.HandlerFunc {
+	return middleware.Chain(handler, slices.Concat(r.middlewares, middlewares)...)
+}
+
+func (r *Router) register(routes map[string]middleware.HandlerFunc, key string, handler middleware.HandlerFunc, middlewares []middleware.Middleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := routes[key]; exists {
+		r.logger.Warn("overwriting previously registered interaction route", zap.String("route", key))
+	}
+
+	routes[key] = r.wrap(handler, middlewares)
+}
+
+func (r *Router) Command(name string, handler middleware.HandlerFunc, middlewares ...middleware.Middleware) {
+	r.register(r.commands, name, handler, middlewares)
+}
+
+// Component registers a handler for every message component whose custom ID starts with the given prefix.
+func (r *Router) Component(prefix string, handler middleware.HandlerFunc, middlewares ...middleware.Middleware) {
+	r.register(r.components, prefix, handler, middlewares)
+}
+
+func (r *Router) Autocomplete(name string, handler middleware.HandlerFunc, middlewares ...middleware.Middleware) {
+	r.register(r.autocomplete, name, handler, middlewares)
+}
+
+// Modal registers a handler for every modal submission whose custom ID starts with the given prefix.
+func (r *Router) Modal(prefix string, handler middleware.HandlerFunc, middlewares ...middleware.Middleware) {
+	r.register(r.modals, prefix, handler, middlewares)
+}
+
+func (r *Router) route(interaction *discordgo.InteractionCreate) (middleware.HandlerFunc, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var handler middleware.HandlerFunc
+
+	var ok bool
+
+	switch interaction.Type {
+	case discordgo.InteractionApplicationCommand:
+		handler, ok = r.commands[interaction.ApplicationCommandData().Name]
+	case discordgo.InteractionApplicationCommandAutocomplete:
+		handler, ok = r.autocomplete[interaction.ApplicationCommandData().Name]
+	case discordgo.InteractionMessageComponent:
+		handler, ok = r.components[util.CustomIDAction(interaction.MessageComponentData().CustomID)]
+	case discordgo.InteractionModalSubmit:
+		handler, ok = r.modals[util.CustomIDAction(interaction.ModalSubmitData().CustomID)]
+	}
+
+	return handler, ok
+}
+
+// Handle is the discordgo event handler that dispatches interactions to their registered routes.
+func (r *Router) Handle(session *discordgo.Session, interaction *discordgo.InteractionCreate) {
+	handler, ok := r.route(interaction)
+	if !ok {
+		r.logger.Debug("no handler registered for interaction", zap.String("interaction", util.InteractionName(interaction)), zap.String("interaction_type", interaction.Type.String()))
+		return
+	}
+
+	_ = handler(session, interaction)
+}
@@ -0,0 +1,269 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	firebaseAdapter "salutations/internal/firebase"
+	"salutations/internal/reporting"
+	util "salutations/pkg/util"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ClaimsCollection holds one document per run of an exclusive job, whichever instance creates it runs the job.
+// A firestore TTL policy on expires_at keeps the collection from growing.
+const ClaimsCollection = "schedulerClaims"
+
+var (
+	errInvalidJob   = errors.New("invalid job")
+	errDuplicateJob = errors.New("job is already registered")
+)
+
+// Job is periodic work run every Interval, aligned to multiples of Interval so that instances agree on when a run is due.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	// Jitter delays each run by up to this long so jobs sharing an interval don't all hit firestore at once
+	Jitter time.Duration
+	// Exclusive jobs only run on one instance per interval when several are deployed
+	Exclusive bool
+	Run       func(ctx context.Context) error
+}
+
+// JobStats is what the scheduler has observed about a job since the process started.
+type JobStats struct {
+	Runs         int64         `json:"runs"`
+	Failures     int64         `json:"failures"`
+	Skipped      int64         `json:"skipped"`
+	LastRunAt    time.Time     `json:"last_run_at"`
+	LastDuration time.Duration `json:"last_duration"`
+	LastError    string        `json:"last_error,omitempty"`
+	NextRunAt    time.Time     `json:"next_run_at"`
+}
+
+type claim struct {
+	Job       string    `firestore:"job"`
+	ClaimedBy string    `firestore:"claimed_by"`
+	ClaimedAt time.Time `firestore:"claimed_at"`
+	ExpiresAt time.Time `firestore:"expires_at"`
+}
+
+type scheduledJob struct {
+	job   Job
+	timer util.Timer
+	stats JobStats
+}
+
+type Scheduler struct {
+	logger          *zap.Logger
+	firebaseAdapter firebaseAdapter.Firebase
+	reporter        reporting.Reporter
+	clock           util.Clock
+	rand            *rand.Rand
+	instanceID      string
+	ctx             context.Context
+	cancel          context.CancelFunc
+	mu              sync.Mutex
+	jobs            map[string]*scheduledJob
+	running         sync.WaitGroup
+}
+
+func NewScheduler(logger *zap.Logger, firebaseAdapter firebaseAdapter.Firebase, reporter reporting.Reporter, clock util.Clock, rand *rand.Rand) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Scheduler{
+		logger:          logger,
+		firebaseAdapter: firebaseAdapter,
+		reporter:        reporter,
+		clock:           clock,
+		rand:            rand,
+		instanceID:      uuid.NewString(),
+		ctx:             ctx,
+		cancel:          cancel,
+		jobs:            make(map[string]*scheduledJob),
+	}
+}
+
+// Register schedules the job's first run, job names have to be unique since they key the exclusive claims.
+func (s *Scheduler) Register(job Job) error {
+	if job.Name == "" || job.Interval <= 0 || job.Jitter < 0 || job.Jitter >= job.Interval || job.Run == nil {
+		return fmt.Errorf("%w: %s needs a name, a positive interval, jitter shorter than the interval and a run func", errInvalidJob, job.Name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.jobs[job.Name]; exists {
+		return fmt.Errorf("%w: %s", errDuplicateJob, job.Name)
+	}
+
+	scheduled := &scheduledJob{job: job}
+	s.jobs[job.Name] = scheduled
+	s.schedule(scheduled)
+
+	return nil
+}
+
+// schedule arms the timer for the job's next run, it must be called with mu held.
+func (s *Scheduler) schedule(scheduled *scheduledJob) {
+	if s.ctx.Err() != nil {
+		return
+	}
+
+	now := s.clock.Now()
+	runAt := now.Truncate(scheduled.job.Interval).Add(scheduled.job.Interval)
+	if scheduled.job.Jitter > 0 {
+		runAt = runAt.Add(time.Duration(s.rand.Int63n(int64(scheduled.job.Jitter))))
+	}
+
+	scheduled.stats.NextRunAt = runAt
+	scheduled.timer = s.clock.AfterFunc(runAt.Sub(now), func() {
+		s.run(scheduled, runAt)
+	})
+}
+
+func (s *Scheduler) run(scheduled *scheduledJob, runAt time.Time) {
+	// Checking for Stop under the lock keeps a run from starting once Stop is waiting on the ones in progress
+	s.mu.Lock()
+	if s.ctx.Err() != nil {
+		s.mu.Unlock()
+		return
+	}
+
+	s.running.Add(1)
+	s.mu.Unlock()
+
+	defer s.running.Done()
+
+	job := scheduled.job
+	logger := s.logger.With(zap.String("job", job.Name))
+
+	defer func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.schedule(scheduled)
+	}()
+
+	if job.Exclusive {
+		claimed, err := s.claim(job, runAt)
+		if err != nil {
+			logger.Error("error claiming job run", zap.Error(err))
+			s.record(scheduled, func(stats *JobStats) { stats.Failures++; stats.LastError = err.Error() })
+
+			return
+		}
+
+		if !claimed {
+			logger.Debug("job run claimed by another instance")
+			s.record(scheduled, func(stats *JobStats) { stats.Skipped++ })
+
+			return
+		}
+	}
+
+	startedAt := s.clock.Now()
+	err := job.Run(s.ctx)
+	duration := s.clock.Now().Sub(startedAt)
+
+	s.record(scheduled, func(stats *JobStats) {
+		stats.Runs++
+		stats.LastRunAt = startedAt
+		stats.LastDuration = duration
+		stats.LastError = ""
+
+		if err != nil {
+			stats.Failures++
+			stats.LastError = err.Error()
+		}
+	})
+
+	if err != nil {
+		logger.Error("job failed", zap.Error(err), zap.Duration("duration", duration))
+		s.reporter.Report(s.ctx, err, map[string]string{"job": job.Name})
+
+		return
+	}
+
+	logger.Debug("job finished", zap.Duration("duration", duration))
+}
+
+// claim creates the document for this run of the job, firestore only lets one instance create it.
+func (s *Scheduler) claim(job Job, runAt time.Time) (bool, error) {
+	window := runAt.Truncate(job.Interval)
+	documentID := job.Name + "_" + strconv.FormatInt(window.Unix(), 10)
+
+	err := s.firebaseAdapter.CreateDocument(s.ctx, ClaimsCollection, documentID, claim{
+		Job:       job.Name,
+		ClaimedBy: s.instanceID,
+		ClaimedAt: s.clock.Now(),
+		ExpiresAt: window.Add(job.Interval * 2),
+	})
+	if err != nil {
+		if status.Code(err) == codes.AlreadyExists {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("error creating claim %s: %w", documentID, err)
+	}
+
+	return true, nil
+}
+
+func (s *Scheduler) record(scheduled *scheduledJob, update func(stats *JobStats)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	update(&scheduled.stats)
+}
+
+// Stats returns a snapshot of every registered job's stats keyed by job name.
+func (s *Scheduler) Stats() map[string]JobStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := make(map[string]JobStats, len(s.jobs))
+	for name, scheduled := range s.jobs {
+		stats[name] = scheduled.stats
+	}
+
+	return stats
+}
+
+// Stop cancels pending runs and waits for the ones in progress, whose context is cancelled, to return.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	s.cancel()
+
+	for _, scheduled := range s.jobs {
+		scheduled.timer.Stop()
+	}
+	s.mu.Unlock()
+
+	s.running.Wait()
+}
+
+// StatsHandler serves the scheduler's job stats as json on GET /jobs.
+func StatsHandler(s *Scheduler) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /jobs", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(w).Encode(s.Stats()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+
+	return mux
+}
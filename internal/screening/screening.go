@@ -0,0 +1,220 @@
+package screening
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+type Verdict string
+
+const (
+	Allow Verdict = "allow"
+	// Flag keeps the clip but files it for moderators to review
+	Flag   Verdict = "flag"
+	Reject Verdict = "reject"
+)
+
+type Result struct {
+	Verdict Verdict
+	Reason  string
+}
+
+// Screener checks an uploaded clip before it's stored, it's only consulted for guilds with strict mode on.
+// Implementations read file from its current offset and don't need to rewind it.
+type Screener interface {
+	Screen(ctx context.Context, file *os.File) (Result, error)
+}
+
+type noopScreener struct{}
+
+var _ Screener = noopScreener{}
+
+func NewNoopScreener() Screener {
+	return noopScreener{}
+}
+
+func (noopScreener) Screen(context.Context, *os.File) (Result, error) {
+	return Result{Verdict: Allow}, nil
+}
+
+// Transcriber turns a clip into text so it can be checked against a wordlist or shown alongside the clip.
+type Transcriber interface {
+	Transcribe(ctx context.Context, file *os.File) (string, error)
+}
+
+// TranscriptScreener is a Screener that can also judge a clip from a transcript that was already made, so clips
+// transcribed on upload aren't transcribed a second time for screening.
+type TranscriptScreener interface {
+	Screener
+	ScreenTranscript(ctx context.Context, transcript string) (Result, error)
+}
+
+// WordlistScreener rejects clips whose transcript contains a rejected word and flags those containing a flagged word.
+type WordlistScreener struct {
+	transcriber Transcriber
+	rejected    []string
+	flagged     []string
+}
+
+var _ TranscriptScreener = (*WordlistScreener)(nil)
+
+func NewWordlistScreener(transcriber Transcriber, rejected []string, flagged []string) *WordlistScreener {
+	return &WordlistScreener{
+		transcriber: transcriber,
+		rejected:    rejected,
+		flagged:     flagged,
+	}
+}
+
+func (w *WordlistScreener) Screen(ctx context.Context, file *os.File) (Result, error) {
+	transcript, err := w.transcriber.Transcribe(ctx, file)
+	if err != nil {
+		return Result{}, fmt.Errorf("error transcribing clip: %w", err)
+	}
+
+	return w.ScreenTranscript(ctx, transcript)
+}
+
+func (w *WordlistScreener) ScreenTranscript(_ context.Context, transcript string) (Result, error) {
+	words := strings.FieldsFunc(strings.ToLower(transcript), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '\'')
+	})
+
+	if word, ok := firstMatch(words, w.rejected); ok {
+		return Result{Verdict: Reject, Reason: fmt.Sprintf("contains %q", word)}, nil
+	}
+
+	if word, ok := firstMatch(words, w.flagged); ok {
+		return Result{Verdict: Flag, Reason: fmt.Sprintf("contains %q", word)}, nil
+	}
+
+	return Result{Verdict: Allow}, nil
+}
+
+func firstMatch(words []string, wordlist []string) (string, bool) {
+	for _, word := range words {
+		for _, listed := range wordlist {
+			if strings.EqualFold(word, listed) {
+				return word, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// APIScreener posts the clip to an external moderation service which answers with {"verdict": "...", "reason": "..."}.
+type APIScreener struct {
+	client   *http.Client
+	endpoint string
+	token    string
+}
+
+var _ Screener = (*APIScreener)(nil)
+
+// NewAPIScreener sends token as a bearer token when it's not empty.
+func NewAPIScreener(endpoint string, token string) *APIScreener {
+	return &APIScreener{
+		client:   &http.Client{Timeout: time.Second * 30},
+		endpoint: endpoint,
+		token:    token,
+	}
+}
+
+func (a *APIScreener) Screen(ctx context.Context, file *os.File) (Result, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.endpoint, file)
+	if err != nil {
+		return Result{}, fmt.Errorf("error creating moderation request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "audio/mpeg")
+	if a.token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.token)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return Result{}, fmt.Errorf("error calling moderation api: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return Result{}, fmt.Errorf("moderation api returned %s: %s", resp.Status, body)
+	}
+
+	var result struct {
+		Verdict string `json:"verdict"`
+		Reason  string `json:"reason"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return Result{}, fmt.Errorf("error decoding moderation response: %w", err)
+	}
+
+	switch verdict := Verdict(result.Verdict); verdict {
+	case Allow, Flag, Reject:
+		return Result{Verdict: verdict, Reason: result.Reason}, nil
+	default:
+		return Result{}, fmt.Errorf("moderation api returned unknown verdict %q", result.Verdict)
+	}
+}
+
+// APITranscriber posts the clip to an external speech to text service which answers with {"text": "..."}.
+type APITranscriber struct {
+	client   *http.Client
+	endpoint string
+	token    string
+}
+
+var _ Transcriber = (*APITranscriber)(nil)
+
+// NewAPITranscriber sends token as a bearer token when it's not empty.
+func NewAPITranscriber(endpoint string, token string) *APITranscriber {
+	return &APITranscriber{
+		client:   &http.Client{Timeout: time.Second * 30},
+		endpoint: endpoint,
+		token:    token,
+	}
+}
+
+func (a *APITranscriber) Transcribe(ctx context.Context, file *os.File) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.endpoint, file)
+	if err != nil {
+		return "", fmt.Errorf("error creating transcription request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "audio/mpeg")
+	if a.token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.token)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error calling transcription api: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("transcription api returned %s: %s", resp.Status, body)
+	}
+
+	var result struct {
+		Text string `json:"text"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("error decoding transcription response: %w", err)
+	}
+
+	return strings.TrimSpace(result.Text), nil
+}
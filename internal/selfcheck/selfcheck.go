@@ -0,0 +1,125 @@
+package selfcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	firebaseAdapter "salutations/internal/firebase"
+
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+)
+
+type Check struct {
+	Name string
+	// Hint tells the operator how to fix the problem when the check fails.
+	Hint string
+	Run  func(ctx context.Context) error
+}
+
+// Run executes every check, logging each result, and returns all failures joined together.
+func Run(ctx context.Context, logger *zap.Logger, timeout time.Duration, checks ...Check) error {
+	errs := []error{}
+
+	for _, check := range checks {
+		checkCtx, cancel := context.WithTimeout(ctx, timeout)
+		start := time.Now()
+		err := check.Run(checkCtx)
+
+		cancel()
+
+		if err != nil {
+			logger.Error("self check failed", zap.String("check", check.Name), zap.String("hint", check.Hint), zap.Error(err))
+			errs = append(errs, fmt.Errorf("%s: %w (%s)", check.Name, err, check.Hint))
+
+			continue
+		}
+
+		logger.Info("self check passed", zap.String("check", check.Name), zap.Duration("duration", time.Since(start)))
+	}
+
+	return errors.Join(errs...)
+}
+
+// RequiredValues fails when any of the resolved configuration values, keyed by their variable name, are empty.
+func RequiredValues(values map[string]string) Check {
+	return Check{
+		Name: "required configuration",
+		Hint: "set the missing variables in the environment, .env file or secret manager",
+		Run: func(context.Context) error {
+			missing := []string{}
+
+			for name, value := range values {
+				if value == "" {
+					missing = append(missing, name)
+				}
+			}
+
+			slices.Sort(missing)
+
+			if len(missing) > 0 {
+				return fmt.Errorf("missing: %s", strings.Join(missing, ", "))
+			}
+
+			return nil
+		},
+	}
+}
+
+func DiscordToken(session *discordgo.Session) Check {
+	return Check{
+		Name: "discord token",
+		Hint: "verify MELODY_DISCORD_TOKEN is a valid bot token from the discord developer portal",
+		Run: func(ctx context.Context) error {
+			if _, err := session.User("@me", discordgo.WithContext(ctx)); err != nil {
+				return fmt.Errorf("error authenticating with discord: %w", err)
+			}
+
+			return nil
+		},
+	}
+}
+
+func Firestore(adapter *firebaseAdapter.FirebaseAdapter, collection string) Check {
+	return Check{
+		Name: "firestore access",
+		Hint: "verify the gcp credentials belong to the right project and have the Cloud Datastore User role",
+		Run: func(ctx context.Context) error {
+			return adapter.CheckFirestoreAccess(ctx, collection)
+		},
+	}
+}
+
+func Bucket(adapter *firebaseAdapter.FirebaseAdapter, bucketName string) Check {
+	return Check{
+		Name: "storage bucket access",
+		Hint: "verify the bucket exists and the gcp credentials have the Storage Object Admin role on it",
+		Run: func(ctx context.Context) error {
+			return adapter.CheckBucketAccess(ctx, bucketName, []string{
+				"storage.objects.create",
+				"storage.objects.get",
+				"storage.objects.delete",
+			})
+		},
+	}
+}
+
+// FFmpeg verifies the binary dca shells out to for encoding audio is installed.
+func FFmpeg() Check {
+	return Check{
+		Name: "ffmpeg",
+		Hint: "install ffmpeg and make sure it is on the PATH",
+		Run: func(context.Context) error {
+			if _, err := exec.LookPath("ffmpeg"); err != nil {
+				return fmt.Errorf("ffmpeg not found: %w", err)
+			}
+
+			return nil
+		},
+	}
+}
@@ -0,0 +1,476 @@
+package settings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	firebaseAdapter "salutations/internal/firebase"
+	util "salutations/pkg/util"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const Collection string = "guildSettings"
+
+var ErrNotFound = errors.New("guild settings not found")
+
+// GuildSettings is stored as one document per guild, keyed by guild id.
+type GuildSettings struct {
+	GuildID  string    `firestore:"guild_id"`
+	Name     string    `firestore:"name"`
+	JoinedAt time.Time `firestore:"joined_at"`
+	// RemovedAt is set when the bot is removed from the guild and cleared if it's added back.
+	RemovedAt time.Time `firestore:"removed_at,omitempty"`
+	// WaitForSilence holds greetings back until nobody in the channel is talking.
+	WaitForSilence bool `firestore:"wait_for_silence,omitempty"`
+	// MusicBotAction is what greetings do while another bot is playing music in the channel, "skip", "delay" or "duck".
+	// Empty or "play" greets over it.
+	MusicBotAction string `firestore:"music_bot_action,omitempty"`
+	// BotSound is the storage object played when the bot joins a voice channel, empty when there isn't one.
+	BotSound string `firestore:"bot_sound,omitempty"`
+	// HourlyGreetingCap limits greetings per voice channel each hour and DailyGreetingCap per guild each day, zero is unlimited.
+	HourlyGreetingCap int64 `firestore:"hourly_greeting_cap,omitempty"`
+	DailyGreetingCap  int64 `firestore:"daily_greeting_cap,omitempty"`
+	// NotificationChannel is the text channel now playing notifications are posted to, empty when they're off.
+	NotificationChannel string `firestore:"notification_channel,omitempty"`
+	// ModLogChannel is the text channel voiceline reports and voice join problems are sent to, empty when there isn't one.
+	ModLogChannel string `firestore:"mod_log_channel,omitempty"`
+	// StrictScreening runs uploads through content screening before they're stored.
+	StrictScreening bool `firestore:"strict_screening,omitempty"`
+	// MaxLoudness is the loudest integrated loudness in LUFS an upload can have, zero is no limit.
+	// LoudnessAction is either "reject" or "normalize" for uploads over it.
+	MaxLoudness    int64  `firestore:"max_loudness,omitempty"`
+	LoudnessAction string `firestore:"loudness_action,omitempty"`
+	// VoicePack is the id of the installed voice pack greeting members without their own voicelines, empty when there isn't one.
+	VoicePack string `firestore:"voice_pack,omitempty"`
+	// DefaultIntro and DefaultOutro are storage objects played for members without their own, they take precedence over VoicePack.
+	DefaultIntro string `firestore:"default_intro,omitempty"`
+	DefaultOutro string `firestore:"default_outro,omitempty"`
+	// StorageBucket and StoragePrefix keep the guild's own objects, its bot sound, default greetings and exports, in a
+	// bucket or under a path of their own for deployments hosting guilds that bring their own storage. Operators set
+	// them in firestore directly, objects stored before they changed aren't moved.
+	StorageBucket string `firestore:"storage_bucket,omitempty"`
+	StoragePrefix string `firestore:"storage_prefix,omitempty"`
+	// StorageQuota is how many bytes of voicelines can be uploaded in the guild and MemberStorageQuota how many of
+	// them can be for any one member. Operators set them in firestore directly, zero uses the greeter's defaults.
+	StorageQuota       int64 `firestore:"storage_quota,omitempty"`
+	MemberStorageQuota int64 `firestore:"member_storage_quota,omitempty"`
+	// Nickname is the bot's nickname in the guild, restored when the bot is added back. Empty uses its username.
+	Nickname string `firestore:"nickname,omitempty"`
+	// Status is the guild's contribution to the bot's rotating status, empty when it hasn't made one.
+	Status string `firestore:"status,omitempty"`
+	// SelfMute and Undeafened are the flags the bot joins voice with, it joins unmuted and deafened by default. The bot
+	// joins undeafened regardless while waiting for silence or watching for music bots, both need to hear the channel.
+	SelfMute   bool `firestore:"self_mute,omitempty"`
+	Undeafened bool `firestore:"undeafened,omitempty"`
+	// RoleStingers are played when members holding the role join voice, keyed by role id.
+	RoleStingers map[string]RoleStinger `firestore:"role_stingers,omitempty"`
+	// FirstJoinClip is the storage object played and FirstJoinMessage what's posted the first time a member joins voice
+	// in the guild, empty when there isn't one. The message is posted in FirstJoinChannel, or the voice channel's chat
+	// when it's empty. Members who joined the guild before FirstJoinSince aren't welcomed, they aren't new.
+	FirstJoinClip    string    `firestore:"first_join_clip,omitempty"`
+	FirstJoinMessage string    `firestore:"first_join_message,omitempty"`
+	FirstJoinChannel string    `firestore:"first_join_channel,omitempty"`
+	FirstJoinSince   time.Time `firestore:"first_join_since,omitempty"`
+	// EventModeUntil is when the guild's event ends, cooldowns and greeting caps are relaxed and EventPack greets
+	// members without voicelines of their own until then. EventModeChannel is told when it's over.
+	EventModeUntil   time.Time `firestore:"event_mode_until,omitempty"`
+	EventModeChannel string    `firestore:"event_mode_channel,omitempty"`
+	// EventPack is the id of the voice pack played during events, kept between them so it only has to be picked once.
+	EventPack string `firestore:"event_pack,omitempty"`
+}
+
+// EventModeActive is whether the guild's event is still going at now.
+func (s GuildSettings) EventModeActive(now time.Time) bool {
+	return now.Before(s.EventModeUntil)
+}
+
+// FirstJoinsEnabled is whether members joining voice for the first time get a welcome.
+func (s GuildSettings) FirstJoinsEnabled() bool {
+	return s.FirstJoinClip != "" || s.FirstJoinMessage != ""
+}
+
+// RoleStinger is a clip played for members holding a role, a member with several gets the one of their highest role.
+type RoleStinger struct {
+	// Object is the storage object played, kept with the guild's other objects
+	Object string `firestore:"object"`
+	// Mode is "before" or "after" to play it alongside the member's own intro, or "instead" to play it in its place
+	Mode string `firestore:"mode"`
+}
+
+// Storage is where the guild's own objects are kept, the root of defaultBucket unless the guild has its own.
+func (s GuildSettings) Storage(defaultBucket string) firebaseAdapter.Location {
+	bucket := s.StorageBucket
+	if bucket == "" {
+		bucket = defaultBucket
+	}
+
+	return firebaseAdapter.NewLocation(bucket, s.StoragePrefix)
+}
+
+func fromDocument(data map[string]interface{}) *GuildSettings {
+	settings := &GuildSettings{}
+	settings.GuildID, _ = data["guild_id"].(string)
+	settings.Name, _ = data["name"].(string)
+	settings.JoinedAt, _ = data["joined_at"].(time.Time)
+	settings.RemovedAt, _ = data["removed_at"].(time.Time)
+	settings.WaitForSilence, _ = data["wait_for_silence"].(bool)
+	settings.MusicBotAction, _ = data["music_bot_action"].(string)
+	settings.BotSound, _ = data["bot_sound"].(string)
+	settings.HourlyGreetingCap, _ = data["hourly_greeting_cap"].(int64)
+	settings.DailyGreetingCap, _ = data["daily_greeting_cap"].(int64)
+	settings.NotificationChannel, _ = data["notification_channel"].(string)
+	settings.ModLogChannel, _ = data["mod_log_channel"].(string)
+	settings.StrictScreening, _ = data["strict_screening"].(bool)
+	settings.MaxLoudness, _ = data["max_loudness"].(int64)
+	settings.LoudnessAction, _ = data["loudness_action"].(string)
+	settings.VoicePack, _ = data["voice_pack"].(string)
+	settings.DefaultIntro, _ = data["default_intro"].(string)
+	settings.DefaultOutro, _ = data["default_outro"].(string)
+	settings.StorageBucket, _ = data["storage_bucket"].(string)
+	settings.StoragePrefix, _ = data["storage_prefix"].(string)
+	settings.StorageQuota, _ = data["storage_quota"].(int64)
+	settings.MemberStorageQuota, _ = data["member_storage_quota"].(int64)
+	settings.Nickname, _ = data["nickname"].(string)
+	settings.Status, _ = data["status"].(string)
+	settings.SelfMute, _ = data["self_mute"].(bool)
+	settings.Undeafened, _ = data["undeafened"].(bool)
+	settings.FirstJoinClip, _ = data["first_join_clip"].(string)
+	settings.FirstJoinMessage, _ = data["first_join_message"].(string)
+	settings.FirstJoinChannel, _ = data["first_join_channel"].(string)
+	settings.FirstJoinSince, _ = data["first_join_since"].(time.Time)
+	settings.EventModeUntil, _ = data["event_mode_until"].(time.Time)
+	settings.EventModeChannel, _ = data["event_mode_channel"].(string)
+	settings.EventPack, _ = data["event_pack"].(string)
+
+	if stingers, ok := data["role_stingers"].(map[string]interface{}); ok {
+		settings.RoleStingers = make(map[string]RoleStinger, len(stingers))
+		for roleID, value := range stingers {
+			stinger, _ := value.(map[string]interface{})
+			object, _ := stinger["object"].(string)
+			mode, _ := stinger["mode"].(string)
+
+			if object != "" {
+				settings.RoleStingers[roleID] = RoleStinger{Object: object, Mode: mode}
+			}
+		}
+	}
+
+	return settings
+}
+
+// Store reads guild settings through an in-memory cache, Reload drops the cache so edits made directly in firestore are picked up.
+type Store struct {
+	firebaseAdapter firebaseAdapter.Firebase
+	clock           util.Clock
+	mu              sync.RWMutex
+	cache           map[string]*GuildSettings
+}
+
+func NewStore(firebaseAdapter firebaseAdapter.Firebase, clock util.Clock) *Store {
+	return &Store{
+		firebaseAdapter: firebaseAdapter,
+		clock:           clock,
+		cache:           make(map[string]*GuildSettings),
+	}
+}
+
+// Get returns ErrNotFound when the guild has no settings document yet.
+func (s *Store) Get(ctx context.Context, guildID string) (*GuildSettings, error) {
+	s.mu.RLock()
+	cached, ok := s.cache[guildID]
+	s.mu.RUnlock()
+
+	if ok {
+		copied := *cached
+		return &copied, nil
+	}
+
+	data, err := s.firebaseAdapter.GetDocumentFromCollection(ctx, Collection, guildID)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, ErrNotFound
+		}
+
+		return nil, fmt.Errorf("error getting guild settings: %w", err)
+	}
+
+	settings := fromDocument(data)
+
+	s.mu.Lock()
+	s.cache[guildID] = settings
+	s.mu.Unlock()
+
+	copied := *settings
+
+	return &copied, nil
+}
+
+// Create writes the default settings for a guild the bot has just joined.
+func (s *Store) Create(ctx context.Context, guildID string, name string) (*GuildSettings, error) {
+	settings := &GuildSettings{
+		GuildID:  guildID,
+		Name:     name,
+		JoinedAt: s.clock.Now(),
+	}
+
+	if err := s.firebaseAdapter.CreateDocument(ctx, Collection, guildID, settings); err != nil {
+		return nil, fmt.Errorf("error creating guild settings: %w", err)
+	}
+
+	s.invalidate(guildID)
+
+	return settings, nil
+}
+
+func (s *Store) MarkRemoved(ctx context.Context, guildID string) error {
+	return s.update(ctx, guildID, map[string]interface{}{"removed_at": s.clock.Now()})
+}
+
+func (s *Store) MarkRejoined(ctx context.Context, guildID string, name string) error {
+	return s.update(ctx, guildID, map[string]interface{}{"removed_at": firestore.Delete, "name": name})
+}
+
+func (s *Store) SetWaitForSilence(ctx context.Context, guildID string, enabled bool) error {
+	return s.update(ctx, guildID, map[string]interface{}{"wait_for_silence": enabled})
+}
+
+func (s *Store) SetMusicBotAction(ctx context.Context, guildID string, action string) error {
+	return s.update(ctx, guildID, map[string]interface{}{"music_bot_action": action})
+}
+
+// SetBotSound clears the bot sound when objectName is empty.
+func (s *Store) SetBotSound(ctx context.Context, guildID string, objectName string) error {
+	if objectName == "" {
+		return s.update(ctx, guildID, map[string]interface{}{"bot_sound": firestore.Delete})
+	}
+
+	return s.update(ctx, guildID, map[string]interface{}{"bot_sound": objectName})
+}
+
+func (s *Store) SetGreetingCaps(ctx context.Context, guildID string, hourly int64, daily int64) error {
+	return s.update(ctx, guildID, map[string]interface{}{"hourly_greeting_cap": hourly, "daily_greeting_cap": daily})
+}
+
+// SetNotificationChannel turns now playing notifications off when channelID is empty.
+func (s *Store) SetNotificationChannel(ctx context.Context, guildID string, channelID string) error {
+	if channelID == "" {
+		return s.update(ctx, guildID, map[string]interface{}{"notification_channel": firestore.Delete})
+	}
+
+	return s.update(ctx, guildID, map[string]interface{}{"notification_channel": channelID})
+}
+
+func (s *Store) SetStrictScreening(ctx context.Context, guildID string, enabled bool) error {
+	return s.update(ctx, guildID, map[string]interface{}{"strict_screening": enabled})
+}
+
+// SetLoudnessLimit removes the limit when maxLoudness is zero.
+func (s *Store) SetLoudnessLimit(ctx context.Context, guildID string, maxLoudness int64, action string) error {
+	if maxLoudness == 0 {
+		return s.update(ctx, guildID, map[string]interface{}{"max_loudness": firestore.Delete, "loudness_action": firestore.Delete})
+	}
+
+	return s.update(ctx, guildID, map[string]interface{}{"max_loudness": maxLoudness, "loudness_action": action})
+}
+
+// SetModLogChannel stops sending reports to a channel when channelID is empty.
+func (s *Store) SetModLogChannel(ctx context.Context, guildID string, channelID string) error {
+	if channelID == "" {
+		return s.update(ctx, guildID, map[string]interface{}{"mod_log_channel": firestore.Delete})
+	}
+
+	return s.update(ctx, guildID, map[string]interface{}{"mod_log_channel": channelID})
+}
+
+// SetVoicePack uninstalls the guild's voice pack when packID is empty.
+func (s *Store) SetVoicePack(ctx context.Context, guildID string, packID string) error {
+	if packID == "" {
+		return s.update(ctx, guildID, map[string]interface{}{"voice_pack": firestore.Delete})
+	}
+
+	return s.update(ctx, guildID, map[string]interface{}{"voice_pack": packID})
+}
+
+// SetDefaultGreeting sets the default intro or outro depending on audioType, clearing it when objectName is empty.
+func (s *Store) SetDefaultGreeting(ctx context.Context, guildID string, audioType string, objectName string) error {
+	key := "default_outro"
+	if audioType == "intro" {
+		key = "default_intro"
+	}
+
+	if objectName == "" {
+		return s.update(ctx, guildID, map[string]interface{}{key: firestore.Delete})
+	}
+
+	return s.update(ctx, guildID, map[string]interface{}{key: objectName})
+}
+
+// SetNickname records the bot's nickname in the guild, clearing it when nickname is empty.
+func (s *Store) SetNickname(ctx context.Context, guildID string, nickname string) error {
+	if nickname == "" {
+		return s.update(ctx, guildID, map[string]interface{}{"nickname": firestore.Delete})
+	}
+
+	return s.update(ctx, guildID, map[string]interface{}{"nickname": nickname})
+}
+
+// SetStatus withdraws the guild's status from the rotation when status is empty.
+func (s *Store) SetStatus(ctx context.Context, guildID string, status string) error {
+	if status == "" {
+		return s.update(ctx, guildID, map[string]interface{}{"status": firestore.Delete})
+	}
+
+	return s.update(ctx, guildID, map[string]interface{}{"status": status})
+}
+
+func (s *Store) SetVoiceFlags(ctx context.Context, guildID string, selfMute bool, undeafened bool) error {
+	return s.update(ctx, guildID, map[string]interface{}{"self_mute": selfMute, "undeafened": undeafened})
+}
+
+func (s *Store) SetRoleStinger(ctx context.Context, guildID string, roleID string, stinger RoleStinger) error {
+	return s.update(ctx, guildID, map[string]interface{}{"role_stingers." + roleID: map[string]interface{}{"object": stinger.Object, "mode": stinger.Mode}})
+}
+
+func (s *Store) RemoveRoleStinger(ctx context.Context, guildID string, roleID string) error {
+	return s.update(ctx, guildID, map[string]interface{}{"role_stingers." + roleID: firestore.Delete})
+}
+
+// SetFirstJoinClip clears the clip when objectName is empty.
+func (s *Store) SetFirstJoinClip(ctx context.Context, guildID string, objectName string) error {
+	if objectName == "" {
+		return s.update(ctx, guildID, map[string]interface{}{"first_join_clip": firestore.Delete})
+	}
+
+	return s.update(ctx, guildID, map[string]interface{}{"first_join_clip": objectName})
+}
+
+// SetFirstJoinMessage stops posting when message is empty.
+func (s *Store) SetFirstJoinMessage(ctx context.Context, guildID string, message string, channelID string) error {
+	if message == "" {
+		return s.update(ctx, guildID, map[string]interface{}{"first_join_message": firestore.Delete, "first_join_channel": firestore.Delete})
+	}
+
+	if channelID == "" {
+		return s.update(ctx, guildID, map[string]interface{}{"first_join_message": message, "first_join_channel": firestore.Delete})
+	}
+
+	return s.update(ctx, guildID, map[string]interface{}{"first_join_message": message, "first_join_channel": channelID})
+}
+
+// StartFirstJoins records now as when the guild started welcoming members, for when a welcome is turned on.
+func (s *Store) StartFirstJoins(ctx context.Context, guildID string) error {
+	return s.update(ctx, guildID, map[string]interface{}{"first_join_since": s.clock.Now()})
+}
+
+// StartEventMode runs the guild's event until the given time, packID replaces the event pack unless it's empty.
+func (s *Store) StartEventMode(ctx context.Context, guildID string, until time.Time, channelID string, packID string) error {
+	data := map[string]interface{}{"event_mode_until": until, "event_mode_channel": channelID}
+	if packID != "" {
+		data["event_pack"] = packID
+	}
+
+	return s.update(ctx, guildID, data)
+}
+
+// EndEventMode ends the guild's event, the event pack is kept for the next one.
+func (s *Store) EndEventMode(ctx context.Context, guildID string) error {
+	return s.update(ctx, guildID, map[string]interface{}{"event_mode_until": firestore.Delete, "event_mode_channel": firestore.Delete})
+}
+
+// EventModesEndedBefore lists the guilds whose event ended at or before cutoff and haven't been reverted yet.
+func (s *Store) EventModesEndedBefore(ctx context.Context, cutoff time.Time) ([]*GuildSettings, error) {
+	documents, err := s.firebaseAdapter.QueryDocuments(ctx, Collection, firebaseAdapter.QueryFilter{Path: "event_mode_until", Op: "<=", Value: cutoff})
+	if err != nil {
+		return nil, fmt.Errorf("error querying ended event modes: %w", err)
+	}
+
+	ended := make([]*GuildSettings, 0, len(documents))
+	for _, document := range documents {
+		ended = append(ended, fromDocument(document))
+	}
+
+	return ended, nil
+}
+
+// GuildStatuses lists the statuses guilds the bot is still in have contributed, ordered by guild id so every instance
+// rotates through them the same way.
+func (s *Store) GuildStatuses(ctx context.Context) ([]string, error) {
+	documents, err := s.firebaseAdapter.QueryDocuments(ctx, Collection, firebaseAdapter.QueryFilter{Path: "status", Op: "!=", Value: ""})
+	if err != nil {
+		return nil, fmt.Errorf("error querying guild statuses: %w", err)
+	}
+
+	guildIDs := slices.Sorted(maps.Keys(documents))
+
+	statuses := make([]string, 0, len(guildIDs))
+	for _, guildID := range guildIDs {
+		if settings := fromDocument(documents[guildID]); settings.Status != "" && settings.RemovedAt.IsZero() {
+			statuses = append(statuses, settings.Status)
+		}
+	}
+
+	return statuses, nil
+}
+
+func (s *Store) Delete(ctx context.Context, guildID string) error {
+	defer s.invalidate(guildID)
+
+	if err := s.firebaseAdapter.DeleteDocument(ctx, Collection, guildID); err != nil {
+		return fmt.Errorf("error deleting guild settings: %w", err)
+	}
+
+	return nil
+}
+
+// RemovedBefore lists the guilds the bot was removed from at or before cutoff.
+func (s *Store) RemovedBefore(ctx context.Context, cutoff time.Time) ([]string, error) {
+	documents, err := s.firebaseAdapter.QueryDocuments(ctx, Collection, firebaseAdapter.QueryFilter{Path: "removed_at", Op: "<=", Value: cutoff})
+	if err != nil {
+		return nil, fmt.Errorf("error querying removed guilds: %w", err)
+	}
+
+	guildIDs := make([]string, 0, len(documents))
+	for guildID := range documents {
+		guildIDs = append(guildIDs, guildID)
+	}
+
+	return guildIDs, nil
+}
+
+func (s *Store) Reload(context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cache = make(map[string]*GuildSettings)
+
+	return nil
+}
+
+func (s *Store) update(ctx context.Context, guildID string, data map[string]interface{}) error {
+	defer s.invalidate(guildID)
+
+	if err := s.firebaseAdapter.UpdateDocument(ctx, Collection, guildID, data); err != nil {
+		if status.Code(err) == codes.NotFound {
+			return ErrNotFound
+		}
+
+		return fmt.Errorf("error updating guild settings: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Store) invalidate(guildID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.cache, guildID)
+}
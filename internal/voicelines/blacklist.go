@@ -0,0 +1,113 @@
+package voicelines
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// BlacklistRecord is a member's opt out of being greeted, with intros and outros blocked separately.
+type BlacklistRecord struct {
+	AddedOn time.Time `firestore:"added_on"`
+	Intros  bool      `firestore:"intros"`
+	Outros  bool      `firestore:"outros"`
+}
+
+// BlacklistCollections maps the optional type given to /blacklist and /whitelist to the collections it covers.
+func BlacklistCollections(audioType string) []string {
+	switch audioType {
+	case "intro":
+		return []string{WelcomeCollection}
+	case "outro":
+		return []string{OutroCollection}
+	default:
+		return []string{WelcomeCollection, OutroCollection}
+	}
+}
+
+// BlacklistedFor reads a blacklist record, records from before intros and outros could be opted out of separately
+// block both. A nil record blocks nothing.
+func BlacklistedFor(data map[string]interface{}, collection string) bool {
+	if data == nil {
+		return false
+	}
+
+	_, hasIntros := data["intros"]
+	_, hasOutros := data["outros"]
+
+	if !hasIntros && !hasOutros {
+		return true
+	}
+
+	if collection == WelcomeCollection {
+		blocked, _ := data["intros"].(bool)
+		return blocked
+	}
+
+	blocked, _ := data["outros"].(bool)
+
+	return blocked
+}
+
+// BlacklistRecord reads the member's blacklist record, nil when they don't have one.
+func (s *Service) BlacklistRecord(ctx context.Context, memberID string) (map[string]interface{}, error) {
+	data, err := s.firebaseAdapter.GetDocumentFromCollection(ctx, BlacklistCollection, memberID)
+	if err != nil {
+		if status.Code(err) != codes.NotFound {
+			return nil, err
+		}
+
+		return nil, nil
+	}
+
+	return data, nil
+}
+
+// Blacklist stops the member being greeted with the audio type's voicelines, on top of whatever they'd already blocked.
+func (s *Service) Blacklist(ctx context.Context, memberID string, audioType string) error {
+	collections := BlacklistCollections(audioType)
+
+	data, err := s.BlacklistRecord(ctx, memberID)
+	if err != nil {
+		return err
+	}
+
+	if data == nil {
+		return s.firebaseAdapter.CreateDocument(ctx, BlacklistCollection, memberID, &BlacklistRecord{
+			AddedOn: s.clock.Now(),
+			Intros:  slices.Contains(collections, WelcomeCollection),
+			Outros:  slices.Contains(collections, OutroCollection),
+		})
+	}
+
+	return s.firebaseAdapter.UpdateDocument(ctx, BlacklistCollection, memberID, map[string]interface{}{
+		"intros": BlacklistedFor(data, WelcomeCollection) || slices.Contains(collections, WelcomeCollection),
+		"outros": BlacklistedFor(data, OutroCollection) || slices.Contains(collections, OutroCollection),
+	})
+}
+
+// Whitelist lets the member be greeted with the audio type's voicelines again, the record is deleted once neither
+// intros nor outros are blocked anymore.
+func (s *Service) Whitelist(ctx context.Context, memberID string, audioType string) error {
+	collections := BlacklistCollections(audioType)
+
+	data, err := s.BlacklistRecord(ctx, memberID)
+	if err != nil || data == nil {
+		return err
+	}
+
+	intros := BlacklistedFor(data, WelcomeCollection) && !slices.Contains(collections, WelcomeCollection)
+	outros := BlacklistedFor(data, OutroCollection) && !slices.Contains(collections, OutroCollection)
+
+	if !intros && !outros {
+		return s.firebaseAdapter.DeleteDocument(ctx, BlacklistCollection, memberID)
+	}
+
+	return s.firebaseAdapter.UpdateDocument(ctx, BlacklistCollection, memberID, map[string]interface{}{
+		"intros": intros,
+		"outros": outros,
+	})
+}
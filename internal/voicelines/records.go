@@ -0,0 +1,135 @@
+package voicelines
+
+import (
+	"cmp"
+	"hash/fnv"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	WelcomeCollection   string = "welcomeIntros"
+	OutroCollection     string = "byeOutros"
+	BlacklistCollection string = "blacklist"
+	// RefsCollection records who holds each stored voiceline, keyed by track name
+	RefsCollection string = "voicelineRefs"
+	// PinnedTrackKey and DisabledKey live on a member's intro or outro document alongside their track array
+	PinnedTrackKey string = "pinned_track"
+	DisabledKey    string = "disabled"
+	IntroArrayKey  string = "intro_array"
+	OutroArrayKey  string = "outro_array"
+)
+
+const (
+	// DefaultWeight is the weight of tracks the member never weighted
+	DefaultWeight int64 = 1
+	// ShortIDLength is how many characters a track's short id has
+	ShortIDLength = 6
+)
+
+// TrackRecord is one element of a member's intro or outro array.
+type TrackRecord struct {
+	AddedBy   string    `firestore:"added_by"    mapstructure:"added_by"`
+	CreatedAt time.Time `firestore:"created_at"  mapstructure:"created_at"`
+	TrackName string    `firestore:"track_name"  mapstructure:"track_name"`
+	// Weight biases random selection, records without one are weighted as DefaultWeight
+	Weight int64 `firestore:"weight,omitempty" mapstructure:"weight"`
+	// ShortID names the track in chat and menus, it's derived from the track name so it never changes
+	ShortID string `firestore:"short_id,omitempty" mapstructure:"short_id"`
+	// Position is where the member placed the track with /myvoicelines reorder, zero until they first reorder
+	Position int64 `firestore:"position,omitempty" mapstructure:"position"`
+	// ExpiresAt is when the sweeper archives the track, unset for tracks kept until they're deleted
+	ExpiresAt *time.Time `firestore:"expires_at,omitempty" mapstructure:"expires_at"`
+	// Effect is the /effects filter the track plays with, unset for none
+	Effect string `firestore:"effect,omitempty" mapstructure:"effect"`
+	// Transcript is what speech to text heard in the clip, unset when uploads aren't transcribed
+	Transcript string `firestore:"transcript,omitempty" mapstructure:"transcript"`
+	// Waveform is the object the track's waveform thumbnail is stored in, unset for tracks uploaded without one
+	Waveform string `firestore:"waveform,omitempty" mapstructure:"waveform"`
+}
+
+type introDocument struct {
+	Name       string        `firestore:"name"`
+	IntroArray []TrackRecord `firestore:"intro_array"`
+}
+
+type outroDocument struct {
+	Name       string        `firestore:"name"`
+	OutroArray []TrackRecord `firestore:"outro_array"`
+}
+
+// CollectionFor maps an audio type to its collection and the key of the track array in its documents.
+func CollectionFor(audioType string) (string, string) {
+	if audioType == "intro" {
+		return WelcomeCollection, IntroArrayKey
+	}
+
+	return OutroCollection, OutroArrayKey
+}
+
+// AudioTypeFor is the audio type a collection holds.
+func AudioTypeFor(collection string) string {
+	if collection == WelcomeCollection {
+		return "intro"
+	}
+
+	return "outro"
+}
+
+// ArrayKey is the key of the track array in the collection's documents.
+func ArrayKey(collection string) string {
+	_, key := CollectionFor(AudioTypeFor(collection))
+	return key
+}
+
+func Weight(record map[string]interface{}) int64 {
+	if weight, ok := record["weight"].(int64); ok && weight > 0 {
+		return weight
+	}
+
+	return DefaultWeight
+}
+
+// Enabled treats records from before tracks could be turned off as on.
+func Enabled(record map[string]interface{}) bool {
+	enabled, ok := record["enabled"].(bool)
+	return !ok || enabled
+}
+
+// ShortID is a short name for the track that stays the same however the member's list changes, so a
+// voiceline mentioned in chat or picked from a menu is always the one meant.
+func ShortID(trackName string) string {
+	hash := fnv.New32a()
+	hash.Write([]byte(trackName))
+
+	id := strconv.FormatUint(uint64(hash.Sum32()), 36)
+	if len(id) < ShortIDLength {
+		id = strings.Repeat("0", ShortIDLength-len(id)) + id
+	}
+
+	return id[:ShortIDLength]
+}
+
+// Position is where the member placed the track, tracks they never placed sort after every placed one.
+func Position(track interface{}) int64 {
+	if recordMap, ok := track.(map[string]interface{}); ok {
+		if position, ok := recordMap["position"].(int64); ok && position > 0 {
+			return position
+		}
+	}
+
+	return math.MaxInt64
+}
+
+// Ordered returns the member's tracks in the order they placed them, unplaced tracks keep the order they were added in.
+func Ordered(tracks []interface{}) []interface{} {
+	ordered := slices.Clone(tracks)
+	slices.SortStableFunc(ordered, func(a, b interface{}) int {
+		return cmp.Compare(Position(a), Position(b))
+	})
+
+	return ordered
+}
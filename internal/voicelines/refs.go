@@ -0,0 +1,57 @@
+package voicelines
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func trackRefOwner(collection string, memberID string) string {
+	return collection + "/" + memberID
+}
+
+// AddRef records that the member holds the track, whoever holds it keeps its audio from being deleted. One object can
+// back the records of several members when an upload was shared, adding a ref to a track whose audio was deleted fails.
+func (s *Service) AddRef(ctx context.Context, trackName string, collection string, memberID string) error {
+	if err := s.firebaseAdapter.AddRef(ctx, RefsCollection, trackName, trackRefOwner(collection, memberID), false); err != nil {
+		return fmt.Errorf("error adding voiceline ref: %w", err)
+	}
+
+	return nil
+}
+
+// RestoreRef records that the member holds a track whose audio was just stored again, even if it had been deleted.
+func (s *Service) RestoreRef(ctx context.Context, trackName string, collection string, memberID string) error {
+	if err := s.firebaseAdapter.AddRef(ctx, RefsCollection, trackName, trackRefOwner(collection, memberID), true); err != nil {
+		return fmt.Errorf("error restoring voiceline ref: %w", err)
+	}
+
+	return nil
+}
+
+// releaseRef drops the member's reference and reports whether it was the last one, meaning the object can go.
+// Voicelines stored before references were tracked have no refs document and are treated as the member's alone.
+func (s *Service) releaseRef(ctx context.Context, trackName string, collection string, memberID string) (bool, error) {
+	last, err := s.firebaseAdapter.ReleaseRef(ctx, RefsCollection, trackName, trackRefOwner(collection, memberID))
+	if err != nil {
+		return false, fmt.Errorf("error releasing voiceline ref: %w", err)
+	}
+
+	return last, nil
+}
+
+// DeleteObject releases the member's reference and deletes the stored object if nobody else holds it.
+func (s *Service) DeleteObject(ctx context.Context, trackName string, collection string, memberID string) error {
+	last, err := s.releaseRef(ctx, trackName, collection, memberID)
+	if err != nil || !last {
+		return err
+	}
+
+	if err := s.firebaseAdapter.DeleteFileFromStorage(ctx, s.bucket, Object(trackName)); err != nil && status.Code(err) != codes.NotFound {
+		return err
+	}
+
+	return s.objectDeleted(ctx, trackName)
+}
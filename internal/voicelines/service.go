@@ -0,0 +1,381 @@
+package voicelines
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"math/rand"
+	"slices"
+	"time"
+
+	firebaseAdapter "salutations/internal/firebase"
+	util "salutations/pkg/util"
+
+	"cloud.google.com/go/firestore"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// deleteConcurrency is how many voicelines a bulk delete archives at once
+const deleteConcurrency = 4
+
+var (
+	// ErrNoVoicelines is returned when listing the voicelines of a member who has never had one in the collection.
+	ErrNoVoicelines = errors.New("member has no voicelines")
+	// ErrDisabled is returned when picking from a member who has turned off their voicelines in the collection.
+	ErrDisabled = errors.New("member has turned off these voicelines")
+)
+
+// Service is what members' voicelines are stored as, their records in firestore and their audio under voicelines/ in
+// storage. It knows nothing about discord so the cog, the admin api and tests share the same rules.
+type Service struct {
+	firebaseAdapter firebaseAdapter.Firebase
+	bucket          string
+	clock           util.Clock
+	rand            *rand.Rand
+	// changed is called after a member's track array is written, objectDeleted after a track's audio is deleted
+	changed       func(collection string, memberID string)
+	objectDeleted func(ctx context.Context, trackName string) error
+}
+
+type Option func(*Service)
+
+func WithClock(clock util.Clock) Option {
+	return func(s *Service) {
+		s.clock = clock
+	}
+}
+
+// WithRand sets the source used by PickRandom, it must be safe for concurrent use (see util.NewRand).
+func WithRand(rand *rand.Rand) Option {
+	return func(s *Service) {
+		s.rand = rand
+	}
+}
+
+// OnChange is called whenever a member's tracks are added or removed, for anything derived from them such as
+// prefetched greetings.
+func OnChange(changed func(collection string, memberID string)) Option {
+	return func(s *Service) {
+		s.changed = changed
+	}
+}
+
+// OnObjectDeleted is called once a track's audio is deleted from storage, for objects rendered from it.
+func OnObjectDeleted(objectDeleted func(ctx context.Context, trackName string) error) Option {
+	return func(s *Service) {
+		s.objectDeleted = objectDeleted
+	}
+}
+
+// NewService stores voicelines in bucket.
+func NewService(adapter firebaseAdapter.Firebase, bucket string, opts ...Option) *Service {
+	service := &Service{
+		firebaseAdapter: adapter,
+		bucket:          bucket,
+		clock:           util.RealClock,
+		rand:            util.NewRand(time.Now().UnixNano()),
+		changed:         func(string, string) {},
+		objectDeleted:   func(context.Context, string) error { return nil },
+	}
+
+	for _, opt := range opts {
+		opt(service)
+	}
+
+	return service
+}
+
+// Object is the storage object a track's audio is kept in.
+func Object(trackName string) string {
+	return fmt.Sprintf("voicelines/%s", trackName)
+}
+
+// EnsureDocument creates the member's intro or outro document if they don't have one yet.
+func (s *Service) EnsureDocument(ctx context.Context, collection string, memberID string) error {
+	_, err := s.firebaseAdapter.GetDocumentFromCollection(ctx, collection, memberID)
+	if err == nil {
+		return nil
+	}
+
+	if status.Code(err) != codes.NotFound {
+		return err
+	}
+
+	if collection == WelcomeCollection {
+		err = s.firebaseAdapter.CreateDocument(ctx, collection, memberID, introDocument{Name: memberID, IntroArray: []TrackRecord{}})
+	} else {
+		err = s.firebaseAdapter.CreateDocument(ctx, collection, memberID, outroDocument{Name: memberID, OutroArray: []TrackRecord{}})
+	}
+
+	if err != nil && status.Code(err) != codes.AlreadyExists {
+		return fmt.Errorf("error creating firestore document: %w", err)
+	}
+
+	return nil
+}
+
+// Tracks returns the member's track records in the order they placed them.
+func (s *Service) Tracks(ctx context.Context, collection string, memberID string) ([]interface{}, error) {
+	data, err := s.firebaseAdapter.GetDocumentFromCollection(ctx, collection, memberID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting document from collection: %w", err)
+	}
+
+	if audioSlice, ok := data[ArrayKey(collection)].([]interface{}); ok {
+		return Ordered(audioSlice), nil
+	}
+
+	return nil, errors.New("error key was not found")
+}
+
+// Add stores a new track through upload and appends it to the member's voicelines, returning the generated track
+// name. upload is handed the object to write the audio to. The member's document must already exist.
+func (s *Service) Add(ctx context.Context, collection string, memberID string, addedBy string, upload func(objectName string, trackName string) error) (string, error) {
+	trackID, err := uuid.NewV7()
+	if err != nil {
+		return "", fmt.Errorf("error generating track name: %w", err)
+	}
+
+	trackName := trackID.String()
+
+	if err := upload(Object(trackName), trackName); err != nil {
+		return "", fmt.Errorf("error uploading to file storage %w", err)
+	}
+
+	if err := s.AppendTrack(ctx, collection, memberID, addedBy, trackName); err != nil {
+		return "", err
+	}
+
+	return trackName, nil
+}
+
+// AppendTrack adds an already stored voicelines/<trackName> object to the member's voicelines.
+func (s *Service) AppendTrack(ctx context.Context, collection string, memberID string, addedBy string, trackName string) error {
+	data := map[string]interface{}{
+		ArrayKey(collection): firestore.ArrayUnion(TrackRecord{
+			TrackName: trackName,
+			CreatedAt: s.clock.Now(),
+			AddedBy:   addedBy,
+			ShortID:   ShortID(trackName),
+		}),
+	}
+
+	if err := s.firebaseAdapter.UpdateDocument(ctx, collection, memberID, data); err != nil {
+		return fmt.Errorf("error updating document %w", err)
+	}
+
+	s.changed(collection, memberID)
+
+	return s.AddRef(ctx, trackName, collection, memberID)
+}
+
+// Voiceline is one of a member's tracks along with a signed url to listen to it.
+type Voiceline struct {
+	TrackName  string
+	URL        string
+	Transcript string
+	// WaveformURL is a signed url to the track's waveform thumbnail, empty when it doesn't have one
+	WaveformURL string
+}
+
+// List signs a url for each of the member's voicelines in collection, in the order they're played in. It fails with
+// ErrNoVoicelines when they've never had one.
+func (s *Service) List(ctx context.Context, collection string, memberID string) ([]Voiceline, error) {
+	data, err := s.firebaseAdapter.GetDocumentFromCollection(ctx, collection, memberID)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return nil, ErrNoVoicelines
+		}
+
+		return nil, fmt.Errorf("error getting %s document: %w", collection, err)
+	}
+
+	return s.ListDocument(ctx, data, ArrayKey(collection))
+}
+
+// ListDocument is List for a member document that was already read.
+func (s *Service) ListDocument(ctx context.Context, data map[string]interface{}, audioListKey string) ([]Voiceline, error) {
+	tracks, ok := data[audioListKey].([]interface{})
+	if !ok {
+		return nil, errors.New("audio key not found in document")
+	}
+
+	voicelines := []Voiceline{}
+	objectNames := []string{}
+	// waveforms maps the index of each listed voiceline with a waveform to its object
+	waveforms := map[int]string{}
+	for _, trackRecord := range Ordered(tracks) {
+		if track, ok := trackRecord.(map[string]interface{}); ok {
+			trackName, _ := track["track_name"].(string)
+			transcript, _ := track["transcript"].(string)
+			if waveform, _ := track["waveform"].(string); waveform != "" {
+				waveforms[len(voicelines)] = waveform
+			}
+
+			voicelines = append(voicelines, Voiceline{TrackName: trackName, Transcript: transcript})
+			objectNames = append(objectNames, Object(trackName))
+		}
+	}
+
+	// Waveforms are signed in the same batch after the tracks, in the order the tracks are listed in
+	waveformIndexes := slices.Sorted(maps.Keys(waveforms))
+	for _, i := range waveformIndexes {
+		objectNames = append(objectNames, waveforms[i])
+	}
+
+	// Signed urls come back in the order they were asked for so the tracks keep the member's order
+	urls, err := s.firebaseAdapter.GenerateSignedURLs(ctx, s.bucket, objectNames)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving generated signed urls %w", err)
+	}
+
+	for i := range voicelines {
+		voicelines[i].URL = urls[i]
+	}
+
+	for n, i := range waveformIndexes {
+		voicelines[i].WaveformURL = urls[len(voicelines)+n]
+	}
+
+	return voicelines, nil
+}
+
+// TrackFailure is a track, or a file that would have become one, that an operation couldn't complete for.
+type TrackFailure struct {
+	Name string
+	Err  error
+}
+
+// JoinFailures joins the errors of every failure into one naming each track, nil when there are none.
+func JoinFailures(failures []TrackFailure) error {
+	errs := make([]error, 0, len(failures))
+	for _, failure := range failures {
+		errs = append(errs, fmt.Errorf("%s: %w", failure.Name, failure.Err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// DeleteResult is which of the tracks asked for were archived and removed and which couldn't be.
+type DeleteResult struct {
+	Deleted []string
+	Failed  []TrackFailure
+}
+
+// Err joins the errors of every track that couldn't be deleted, nil when none failed.
+func (r DeleteResult) Err() error {
+	return JoinFailures(r.Failed)
+}
+
+// Delete archives the member's tracks under archive/<member id>/ and removes them from their voicelines, a track
+// that fails is left in place without holding back the others.
+func (s *Service) Delete(ctx context.Context, collection string, memberID string, trackNames []string) (DeleteResult, error) {
+	tracks, err := s.Tracks(ctx, collection, memberID)
+	if err != nil {
+		return DeleteResult{}, fmt.Errorf("error retrieving users tracks: %w", err)
+	}
+
+	s.changed(collection, memberID)
+
+	pool := util.NewPool[struct{}](ctx, deleteConcurrency)
+
+	for _, trackName := range trackNames {
+		pool.Submit(func(ctx context.Context) (struct{}, error) {
+			return struct{}{}, s.delete(ctx, collection, memberID, tracks, trackName)
+		})
+	}
+
+	result := DeleteResult{}
+	for i, outcome := range pool.Wait() {
+		if outcome.Err != nil {
+			result.Failed = append(result.Failed, TrackFailure{Name: trackNames[i], Err: outcome.Err})
+			continue
+		}
+
+		result.Deleted = append(result.Deleted, trackNames[i])
+	}
+
+	return result, nil
+}
+
+// delete archives a track and takes it off the member's document, tracks is the member's track array read before
+// any of a batch's deletes started.
+func (s *Service) delete(ctx context.Context, collection string, memberID string, tracks []interface{}, trackName string) error {
+	archiveTrackPath := fmt.Sprintf("archive/%s/%s", memberID, trackName)
+	if err := s.firebaseAdapter.CloneFileFromStorage(ctx, s.bucket, Object(trackName), archiveTrackPath); err != nil {
+		return err
+	}
+
+	// Shared voicelines stay in storage for the other members holding them
+	if err := s.DeleteObject(ctx, trackName, collection, memberID); err != nil {
+		return err
+	}
+
+	for _, track := range tracks {
+		if recordMap, ok := track.(map[string]interface{}); ok && recordMap["track_name"] == trackName {
+			// Firestore only removes array elements that are exactly equal, so the stored record is passed back as is
+			data := map[string]interface{}{
+				ArrayKey(collection): firestore.ArrayRemove(recordMap),
+			}
+
+			return s.firebaseAdapter.UpdateDocument(ctx, collection, memberID, data)
+		}
+	}
+
+	return nil
+}
+
+// Pick returns the track to greet the member with, as PickRandom would from their document. It fails with
+// ErrDisabled when they've turned the collection's voicelines off.
+func (s *Service) Pick(ctx context.Context, collection string, memberID string) (string, error) {
+	data, err := s.firebaseAdapter.GetDocumentFromCollection(ctx, collection, memberID)
+	if err != nil {
+		return "", err
+	}
+
+	if disabled, _ := data[DisabledKey].(bool); disabled {
+		return "", ErrDisabled
+	}
+
+	return s.PickRandom(data, ArrayKey(collection)), nil
+}
+
+// PickRandom returns the member's pinned track if they have one, otherwise a random track picked by weight. It's
+// empty when the member has no enabled tracks.
+func (s *Service) PickRandom(data map[string]interface{}, audioListKey string) string {
+	audioSlice, _ := data[audioListKey].([]interface{})
+	records := make([]map[string]interface{}, 0, len(audioSlice))
+	totalWeight := int64(0)
+
+	pinnedTrack, _ := data[PinnedTrackKey].(string)
+
+	for _, audio := range audioSlice {
+		// Tracks the member turned off are skipped, even when pinned
+		if recordMap, ok := audio.(map[string]interface{}); ok && Enabled(recordMap) {
+			if pinnedTrack != "" && recordMap["track_name"] == pinnedTrack {
+				return pinnedTrack
+			}
+
+			records = append(records, recordMap)
+			totalWeight += Weight(recordMap)
+		}
+	}
+
+	if len(records) == 0 {
+		return ""
+	}
+
+	roll := s.rand.Int63n(totalWeight)
+	for _, recordMap := range records {
+		roll -= Weight(recordMap)
+		if roll < 0 {
+			trackName, _ := recordMap["track_name"].(string)
+			return trackName
+		}
+	}
+
+	return ""
+}
@@ -1,12 +1,29 @@
 package gcp
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
+
+	"golang.org/x/oauth2/google"
+)
+
+type CredentialSource string
+
+const (
+	SourceExplicit    CredentialSource = "explicit"
+	SourceEnvironment CredentialSource = "environment"
+	SourceKeyFile     CredentialSource = "key_file"
+	SourceDefault     CredentialSource = "application_default"
 )
 
+var Scopes = []string{"https://www.googleapis.com/auth/cloud-platform"}
+
+var serviceAccountEnvVars = []string{"GCP_CLIENT_EMAIL", "GCP_CLIENT_ID", "GCP_PRIVATE_KEY_ID", "GCP_PRIVATE_KEY", "GCP_PROJECT_ID"}
+
 type Credentials struct {
 	ClientEmail  string `json:"client_email"   mapstructure:"clientEmail"   structs:"ClientEmail"`
 	ClientID     string `json:"client_id"      mapstructure:"clientID"      structs:"ClientID"`
@@ -36,3 +53,80 @@ func GetCredentials() ([]byte, error) {
 
 	return data, nil
 }
+
+// hasServiceAccountEnv reports whether any of the GCP_* variables are set, erroring when only some of them are.
+func hasServiceAccountEnv() (bool, error) {
+	missing := []string{}
+
+	for _, envVar := range serviceAccountEnvVars {
+		if os.Getenv(envVar) == "" {
+			missing = append(missing, envVar)
+		}
+	}
+
+	switch len(missing) {
+	case 0:
+		return true, nil
+	case len(serviceAccountEnvVars):
+		return false, nil
+	default:
+		return false, fmt.Errorf("service account environment is incomplete, missing: %s", strings.Join(missing, ", "))
+	}
+}
+
+// FindCredentials selects credentials in order of precedence: explicit JSON (e.g. from a secret store),
+// the GCP_* environment variables, a GOOGLE_APPLICATION_CREDENTIALS key file, and finally Application
+// Default Credentials which cover the metadata server on GCE/Cloud Run and workload identity federation.
+func FindCredentials(ctx context.Context, credentialsJSON []byte) (*google.Credentials, CredentialSource, error) {
+	if len(credentialsJSON) > 0 {
+		creds, err := google.CredentialsFromJSON(ctx, credentialsJSON, Scopes...)
+		if err != nil {
+			return nil, SourceExplicit, fmt.Errorf("error parsing provided credentials json: %w", err)
+		}
+
+		return creds, SourceExplicit, nil
+	}
+
+	hasEnv, err := hasServiceAccountEnv()
+	if err != nil {
+		return nil, SourceEnvironment, err
+	}
+
+	if hasEnv {
+		data, err := GetCredentials()
+		if err != nil {
+			return nil, SourceEnvironment, err
+		}
+
+		creds, err := google.CredentialsFromJSON(ctx, data, Scopes...)
+		if err != nil {
+			return nil, SourceEnvironment, fmt.Errorf("error parsing service account environment variables: %w", err)
+		}
+
+		return creds, SourceEnvironment, nil
+	}
+
+	if keyFile := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); keyFile != "" {
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, SourceKeyFile, fmt.Errorf("error reading GOOGLE_APPLICATION_CREDENTIALS file %s: %w", keyFile, err)
+		}
+
+		creds, err := google.CredentialsFromJSON(ctx, data, Scopes...)
+		if err != nil {
+			return nil, SourceKeyFile, fmt.Errorf("error parsing GOOGLE_APPLICATION_CREDENTIALS file %s: %w", keyFile, err)
+		}
+
+		return creds, SourceKeyFile, nil
+	}
+
+	creds, err := google.FindDefaultCredentials(ctx, Scopes...)
+	if err != nil {
+		return nil, SourceDefault, errors.Join(
+			errors.New("no gcp credentials found, set the GCP_* variables, GOOGLE_APPLICATION_CREDENTIALS, or run with a service account attached"),
+			err,
+		)
+	}
+
+	return creds, SourceDefault, nil
+}
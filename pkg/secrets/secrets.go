@@ -0,0 +1,153 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var ErrSecretNotFound = errors.New("secret not found")
+
+type Provider interface {
+	Get(ctx context.Context, name string) (string, error)
+}
+
+type EnvProvider struct{}
+
+var _ Provider = EnvProvider{}
+
+func (EnvProvider) Get(_ context.Context, name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return "", fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+	}
+
+	return value, nil
+}
+
+type GoogleSecretManagerProvider struct {
+	client    *secretmanager.Client
+	projectID string
+}
+
+var _ Provider = (*GoogleSecretManagerProvider)(nil)
+
+func NewGoogleSecretManagerProvider(ctx context.Context, projectID string, opts ...option.ClientOption) (*GoogleSecretManagerProvider, error) {
+	client, err := secretmanager.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating secret manager client: %w", err)
+	}
+
+	return &GoogleSecretManagerProvider{
+		client:    client,
+		projectID: projectID,
+	}, nil
+}
+
+// Get always resolves the latest version of the secret so that rotated values are picked up.
+func (g *GoogleSecretManagerProvider) Get(ctx context.Context, name string) (string, error) {
+	result, err := g.client.AccessSecretVersion(ctx, &secretmanagerpb.AccessSecretVersionRequest{
+		Name: fmt.Sprintf("projects/%s/secrets/%s/versions/latest", g.projectID, name),
+	})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return "", fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+		}
+
+		return "", fmt.Errorf("error accessing secret version: %w", err)
+	}
+
+	return string(result.Payload.Data), nil
+}
+
+func (g *GoogleSecretManagerProvider) Close() error {
+	return g.client.Close()
+}
+
+type cachedSecret struct {
+	value     string
+	fetchedAt time.Time
+}
+
+// CachingProvider memoizes secrets for ttl, after which they are fetched again to support rotation.
+type CachingProvider struct {
+	provider Provider
+	ttl      time.Duration
+	mu       sync.Mutex
+	cache    map[string]cachedSecret
+}
+
+var _ Provider = (*CachingProvider)(nil)
+
+func NewCachingProvider(provider Provider, ttl time.Duration) *CachingProvider {
+	return &CachingProvider{
+		provider: provider,
+		ttl:      ttl,
+		cache:    make(map[string]cachedSecret),
+	}
+}
+
+func (c *CachingProvider) Get(ctx context.Context, name string) (string, error) {
+	c.mu.Lock()
+	cached, ok := c.cache[name]
+	c.mu.Unlock()
+
+	if ok && time.Since(cached.fetchedAt) < c.ttl {
+		return cached.value, nil
+	}
+
+	value, err := c.provider.Get(ctx, name)
+	if err != nil {
+		// Keep serving the stale value if the backing store is temporarily unavailable
+		if ok && !errors.Is(err, ErrSecretNotFound) {
+			return cached.value, nil
+		}
+
+		return "", err
+	}
+
+	c.mu.Lock()
+	c.cache[name] = cachedSecret{value: value, fetchedAt: time.Now()}
+	c.mu.Unlock()
+
+	return value, nil
+}
+
+// Invalidate forces the next Get for name to hit the backing provider.
+func (c *CachingProvider) Invalidate(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.cache, name)
+}
+
+type fallbackProvider []Provider
+
+// NewFallbackProvider tries each provider in order, moving on only when a secret is not found.
+func NewFallbackProvider(providers ...Provider) Provider {
+	return fallbackProvider(providers)
+}
+
+func (f fallbackProvider) Get(ctx context.Context, name string) (string, error) {
+	for _, provider := range f {
+		value, err := provider.Get(ctx, name)
+		if err == nil {
+			return value, nil
+		}
+
+		if !errors.Is(err, ErrSecretNotFound) {
+			return "", err
+		}
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+}
@@ -0,0 +1,216 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// Loudness is in LUFS for Integrated and dBTP for TruePeak, both are 0 or below with 0 being as loud as audio gets.
+type Loudness struct {
+	Integrated float64
+	TruePeak   float64
+}
+
+// MeasureLoudness runs ffmpeg's loudnorm filter in analysis mode over the file.
+func MeasureLoudness(ctx context.Context, filePath string) (Loudness, error) {
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-hide_banner", "-nostats", "-i", filePath, "-af", "loudnorm=print_format=json", "-f", "null", "-")
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return Loudness{}, fmt.Errorf("error measuring loudness: %w", err)
+	}
+
+	// loudnorm prints its json block last, after the rest of ffmpeg's output
+	output := stderr.Bytes()
+	start := bytes.LastIndexByte(output, '{')
+	if start == -1 {
+		return Loudness{}, errors.New("ffmpeg didn't print loudness measurements")
+	}
+
+	var measured struct {
+		InputI  string `json:"input_i"`
+		InputTP string `json:"input_tp"`
+	}
+
+	if err := json.Unmarshal(output[start:], &measured); err != nil {
+		return Loudness{}, fmt.Errorf("error decoding loudness measurements: %w", err)
+	}
+
+	integrated, err := strconv.ParseFloat(measured.InputI, 64)
+	if err != nil {
+		return Loudness{}, fmt.Errorf("error parsing integrated loudness %q: %w", measured.InputI, err)
+	}
+
+	truePeak, err := strconv.ParseFloat(measured.InputTP, 64)
+	if err != nil {
+		return Loudness{}, fmt.Errorf("error parsing true peak %q: %w", measured.InputTP, err)
+	}
+
+	return Loudness{Integrated: integrated, TruePeak: truePeak}, nil
+}
+
+// NormalizeLoudness writes an mp3 of the file brought to targetLUFS into the temporary directory, the caller deletes it.
+func NormalizeLoudness(ctx context.Context, filePath string, targetLUFS float64) (*os.File, error) {
+	output, err := ApplyAudioFilter(ctx, "", filePath, fmt.Sprintf("loudnorm=I=%.1f:TP=-1.5:LRA=11", targetLUFS))
+	if err != nil {
+		return nil, fmt.Errorf("error normalizing loudness: %w", err)
+	}
+
+	return output, nil
+}
+
+// ApplyAudioFilter writes an mp3 of the file run through an ffmpeg audio filter chain into dir, or the temporary
+// directory when dir is empty. The caller deletes it.
+func ApplyAudioFilter(ctx context.Context, dir string, filePath string, filter string) (*os.File, error) {
+	output, err := os.CreateTemp(dir, "filtered-*.mp3")
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-hide_banner", "-nostats", "-y", "-i", filePath, "-af", filter, "-f", "mp3", output.Name())
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		_ = output.Close()
+		_ = DeleteFile(output.Name())
+
+		return nil, fmt.Errorf("error running ffmpeg filter %q: %w: %s", filter, err, out)
+	}
+
+	return output, nil
+}
+
+// AudioFormat is the container an audio file is stored in, told apart by its first bytes rather than its name or the
+// content type it was uploaded with.
+type AudioFormat string
+
+const (
+	AudioFormatMP3     AudioFormat = "mp3"
+	AudioFormatMP4     AudioFormat = "mp4"
+	AudioFormatUnknown AudioFormat = ""
+)
+
+// sniffLength is how much of a file DetectContentType looks at, the same as net/http's sniffing
+const sniffLength = 512
+
+// ContentType is the mime type the format is served with.
+func (f AudioFormat) ContentType() string {
+	switch f {
+	case AudioFormatMP3:
+		return "audio/mpeg"
+	case AudioFormatMP4:
+		return "audio/mp4"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// DetectAudioFormat tells mp3 from mp4 (m4a) audio by the start of the file. mp3s either open with an ID3 tag or
+// straight into a frame sync, mp4s name their brand in an ftyp box right after its size. Raw AAC shares the frame
+// sync but leaves the layer bits empty, so it isn't mistaken for an mp3.
+func DetectAudioFormat(head []byte) AudioFormat {
+	switch {
+	case bytes.HasPrefix(head, []byte("ID3")):
+		return AudioFormatMP3
+	case len(head) >= 8 && string(head[4:8]) == "ftyp":
+		return AudioFormatMP4
+	case len(head) >= 2 && head[0] == 0xff && head[1]&0xe0 == 0xe0 && head[1]&0x06 != 0:
+		return AudioFormatMP3
+	default:
+		return AudioFormatUnknown
+	}
+}
+
+// DetectContentType is the content type to store data under given its first bytes, audio formats are recognized
+// by DetectAudioFormat and anything else falls back to net/http's sniffing.
+func DetectContentType(head []byte) string {
+	if format := DetectAudioFormat(head); format != AudioFormatUnknown {
+		return format.ContentType()
+	}
+
+	return http.DetectContentType(head)
+}
+
+// SniffFile reads the start of the file for DetectAudioFormat or DetectContentType without moving its offset.
+func SniffFile(file *os.File) ([]byte, error) {
+	head := make([]byte, sniffLength)
+
+	n, err := file.ReadAt(head, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	return head[:n], nil
+}
+
+// TranscodeToMP3 writes an mp3 copy of the file into dir, or the temporary directory when dir is empty, the caller
+// deletes it. mp4 input has to be a file since its index can sit at the very end.
+func TranscodeToMP3(ctx context.Context, dir string, filePath string) (*os.File, error) {
+	output, err := os.CreateTemp(dir, "transcoded-*.mp3")
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-hide_banner", "-nostats", "-y", "-i", filePath, "-vn", "-f", "mp3", output.Name())
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		_ = output.Close()
+		_ = DeleteFile(output.Name())
+
+		return nil, fmt.Errorf("error transcoding to mp3: %w: %s", err, out)
+	}
+
+	return output, nil
+}
+
+// RenderWaveform writes a width by height png of the file's waveform drawn in color, a hex rgb such as 0x67e9ff, into
+// dir, or the temporary directory when dir is empty. The caller deletes it.
+func RenderWaveform(ctx context.Context, dir string, filePath string, width int, height int, color string) (*os.File, error) {
+	output, err := os.CreateTemp(dir, "waveform-*.png")
+	if err != nil {
+		return nil, err
+	}
+
+	filter := fmt.Sprintf("showwavespic=s=%dx%d:split_channels=0:colors=%s", width, height, color)
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-hide_banner", "-nostats", "-y", "-i", filePath, "-filter_complex", filter, "-frames:v", "1", "-f", "image2", output.Name())
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		_ = output.Close()
+		_ = DeleteFile(output.Name())
+
+		return nil, fmt.Errorf("error rendering waveform: %w: %s", err, out)
+	}
+
+	return output, nil
+}
+
+// RenderPreviewVideo renders the audio at filePath into an mp4 in dir that plays it over its animated waveform, a
+// format chat clients play inline. The caller closes and deletes the returned file.
+func RenderPreviewVideo(ctx context.Context, dir string, filePath string, width int, height int, color string) (*os.File, error) {
+	output, err := os.CreateTemp(dir, "preview-*.mp4")
+	if err != nil {
+		return nil, err
+	}
+
+	filter := fmt.Sprintf("[0:a]showwaves=s=%dx%d:mode=cline:colors=%s,format=yuv420p[v]", width, height, color)
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-hide_banner", "-nostats", "-y", "-i", filePath, "-filter_complex", filter,
+		"-map", "[v]", "-map", "0:a", "-c:v", "libx264", "-c:a", "aac", "-movflags", "+faststart", "-shortest", "-f", "mp4", output.Name())
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		_ = output.Close()
+		_ = DeleteFile(output.Name())
+
+		return nil, fmt.Errorf("error rendering preview video: %w: %s", err, out)
+	}
+
+	return output, nil
+}
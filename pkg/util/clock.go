@@ -0,0 +1,136 @@
+package util
+
+import (
+	"math/rand"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Clock abstracts time so that cooldowns, timestamps and delayed work can be controlled in tests.
+type Clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+type Timer interface {
+	Stop() bool
+}
+
+type realClock struct{}
+
+var RealClock Clock = realClock{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// FakeClock only moves when Advance is called, running any timers that fall due.
+type FakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock  *FakeClock
+	fireAt time.Time
+	f      func()
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	timer := &fakeTimer{clock: c, fireAt: c.now.Add(d), f: f}
+	c.timers = append(c.timers, timer)
+
+	return timer
+}
+
+// Advance moves the clock forward and synchronously runs the timers that are now due, in order.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+
+	c.now = c.now.Add(d)
+	due := []*fakeTimer{}
+	pending := []*fakeTimer{}
+
+	for _, timer := range c.timers {
+		if !timer.fireAt.After(c.now) {
+			due = append(due, timer)
+		} else {
+			pending = append(pending, timer)
+		}
+	}
+
+	c.timers = pending
+
+	c.mu.Unlock()
+
+	slices.SortStableFunc(due, func(a, b *fakeTimer) int { return a.fireAt.Compare(b.fireAt) })
+
+	for _, timer := range due {
+		timer.f()
+	}
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	index := slices.Index(t.clock.timers, t)
+	if index == -1 {
+		return false
+	}
+
+	t.clock.timers = slices.Delete(t.clock.timers, index, index+1)
+
+	return true
+}
+
+type lockedSource struct {
+	mu     sync.Mutex
+	source rand.Source64
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.source.Int63()
+}
+
+func (s *lockedSource) Uint64() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.source.Uint64()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.source.Seed(seed)
+}
+
+// NewRand returns a *rand.Rand that is safe for concurrent use, seeded so that tests can reproduce its sequence.
+func NewRand(seed int64) *rand.Rand {
+	return rand.New(&lockedSource{source: rand.NewSource(seed).(rand.Source64)})
+}
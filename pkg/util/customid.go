@@ -0,0 +1,91 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MaxCustomIDLength is the longest custom id Discord accepts on a message component.
+const MaxCustomIDLength = 100
+
+const (
+	customIDSeparator = ":"
+	customIDFieldSep  = "|"
+	// customIDFields counts the fixed fields after the action, guild, member, collection and nonce
+	customIDFields = 4
+)
+
+var ErrMalformedCustomID = errors.New("malformed custom id")
+
+var (
+	customIDEscaper   = strings.NewReplacer("%", "%25", customIDFieldSep, "%7C")
+	customIDUnescaper = strings.NewReplacer("%7C", customIDFieldSep, "%25", "%")
+)
+
+// CustomID is the context a message component carries, handlers read what they act on from it rather than from memory
+// so components keep working after the bot restarts. Fields that don't apply to a component are left empty.
+type CustomID struct {
+	// Action routes the interaction to its handler.
+	Action     string
+	GuildID    string
+	MemberID   string
+	Collection string
+	// Nonce ties a component to the one thing it was made for, such as the clip a skip button skips.
+	Nonce string
+	// Args holds anything else the handler needs, in the order it expects.
+	Args []string
+}
+
+// Encode lays the fields out as action:guild|member|collection|nonce|args..., escaping separators inside them.
+// A component with nothing but an action encodes to just the action.
+func (c CustomID) Encode() string {
+	fields := append([]string{c.GuildID, c.MemberID, c.Collection, c.Nonce}, c.Args...)
+	if strings.Join(fields, "") == "" {
+		return c.Action
+	}
+
+	for i, field := range fields {
+		fields[i] = customIDEscaper.Replace(field)
+	}
+
+	return c.Action + customIDSeparator + strings.Join(fields, customIDFieldSep)
+}
+
+// CustomIDAction is the action of an encoded custom id, enough to route it without decoding the rest.
+func CustomIDAction(customID string) string {
+	action, _, _ := strings.Cut(customID, customIDSeparator)
+
+	return action
+}
+
+// DecodeCustomID reverses Encode, handlers check Args holds what they expect.
+func DecodeCustomID(customID string) (CustomID, error) {
+	action, rawFields, found := strings.Cut(customID, customIDSeparator)
+	if !found {
+		return CustomID{Action: action}, nil
+	}
+
+	fields := strings.Split(rawFields, customIDFieldSep)
+	if len(fields) < customIDFields {
+		return CustomID{}, fmt.Errorf("%w: %s", ErrMalformedCustomID, customID)
+	}
+
+	for i, field := range fields {
+		fields[i] = customIDUnescaper.Replace(field)
+	}
+
+	decoded := CustomID{
+		Action:     action,
+		GuildID:    fields[0],
+		MemberID:   fields[1],
+		Collection: fields[2],
+		Nonce:      fields[3],
+	}
+
+	if len(fields) > customIDFields {
+		decoded.Args = fields[customIDFields:]
+	}
+
+	return decoded, nil
+}
@@ -0,0 +1,137 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+const (
+	// restRateLimitRetries is how many times a rate limited call is retried before its error is returned
+	restRateLimitRetries = 3
+	// restRetryBackoff is the least a retry waits, doubling with every attempt in case retry_after was too optimistic
+	restRetryBackoff = time.Millisecond * 250
+)
+
+// The helpers below wrap the REST calls the bot makes most often. Rather than letting discordgo sleep through every
+// 429 with no way to give up, they wait out the retry_after discord sends back, backing off further on repeated
+// limits, and stop once ctx is done or the call has been limited too many times.
+
+// EditMessage edits a message, see discordgo.Session.ChannelMessageEditComplex.
+func EditMessage(ctx context.Context, session *discordgo.Session, edit *discordgo.MessageEdit) (*discordgo.Message, error) {
+	var message *discordgo.Message
+
+	err := withRateLimitRetries(ctx, func(options ...discordgo.RequestOption) (err error) {
+		message, err = session.ChannelMessageEditComplex(edit, options...)
+		return err
+	})
+
+	return message, err
+}
+
+// EditMessages applies the edits one after another so a listing made of several messages is paged as a batch, all
+// of them are attempted and their errors joined.
+func EditMessages(ctx context.Context, session *discordgo.Session, edits []*discordgo.MessageEdit) error {
+	errs := []error{}
+
+	for _, edit := range edits {
+		if _, err := EditMessage(ctx, session, edit); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// GetMessage fetches a message, see discordgo.Session.ChannelMessage.
+func GetMessage(ctx context.Context, session *discordgo.Session, channelID string, messageID string) (*discordgo.Message, error) {
+	var message *discordgo.Message
+
+	err := withRateLimitRetries(ctx, func(options ...discordgo.RequestOption) (err error) {
+		message, err = session.ChannelMessage(channelID, messageID, options...)
+		return err
+	})
+
+	return message, err
+}
+
+// SendMessage sends a message to a channel, see discordgo.Session.ChannelMessageSendComplex.
+func SendMessage(ctx context.Context, session *discordgo.Session, channelID string, send *discordgo.MessageSend) (*discordgo.Message, error) {
+	var message *discordgo.Message
+
+	err := withRateLimitRetries(ctx, func(options ...discordgo.RequestOption) (err error) {
+		message, err = session.ChannelMessageSendComplex(channelID, send, options...)
+		return err
+	})
+
+	return message, err
+}
+
+// SendFollowup sends a follow up message to an interaction, see discordgo.Session.FollowupMessageCreate.
+func SendFollowup(ctx context.Context, session *discordgo.Session, interaction *discordgo.Interaction, params *discordgo.WebhookParams) (*discordgo.Message, error) {
+	var message *discordgo.Message
+
+	err := withRateLimitRetries(ctx, func(options ...discordgo.RequestOption) (err error) {
+		message, err = session.FollowupMessageCreate(interaction, true, params, options...)
+		return err
+	})
+
+	return message, err
+}
+
+// DeleteMessage deletes a message, see discordgo.Session.ChannelMessageDelete.
+func DeleteMessage(ctx context.Context, session *discordgo.Session, channelID string, messageID string) error {
+	return withRateLimitRetries(ctx, func(options ...discordgo.RequestOption) error {
+		return session.ChannelMessageDelete(channelID, messageID, options...)
+	})
+}
+
+// restRetryPolicy only retries rate limits, discordgo already retries the server errors worth retrying
+var restRetryPolicy = RetryPolicy{
+	MaxAttempts: restRateLimitRetries + 1,
+	BaseDelay:   restRetryBackoff,
+	Retryable: func(err error) bool {
+		var rateLimited *discordgo.RateLimitError
+		return errors.As(err, &rateLimited)
+	},
+	MinDelay: func(err error) time.Duration {
+		var rateLimited *discordgo.RateLimitError
+		if errors.As(err, &rateLimited) {
+			return rateLimited.RetryAfter
+		}
+
+		return 0
+	},
+}
+
+func withRateLimitRetries(ctx context.Context, call func(options ...discordgo.RequestOption) error) error {
+	return Retry(ctx, restRetryPolicy, func(ctx context.Context) error {
+		return call(discordgo.WithContext(ctx), discordgo.WithRetryOnRatelimit(false))
+	})
+}
+
+// ResolveMember looks the member up in the state cache, falling back to the API for members that aren't cached, as
+// happens in large guilds, and caching what it finds so the next lookup doesn't go to the API again.
+func ResolveMember(ctx context.Context, session *discordgo.Session, guildID string, userID string) (*discordgo.Member, error) {
+	if member, err := session.State.Member(guildID, userID); err == nil {
+		return member, nil
+	}
+
+	var member *discordgo.Member
+
+	err := withRateLimitRetries(ctx, func(options ...discordgo.RequestOption) (err error) {
+		member, err = session.GuildMember(guildID, userID, options...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The state files members by guild, which the API leaves out of the member it returns
+	member.GuildID = guildID
+	_ = session.State.MemberAdd(member)
+
+	return member, nil
+}
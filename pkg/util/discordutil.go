@@ -1,39 +1,211 @@
 package util
 
 import (
+	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
 )
 
-func DeleteMessageAfterTime(session *discordgo.Session, channelID string, messageID string, timeDelay time.Duration) error {
-	message, err := session.ChannelMessage(channelID, messageID)
-	if err != nil {
-		return err
+// DefaultMessageDeleter is the deleter behind DeleteMessageAfterTime, it should be flushed on shutdown.
+var DefaultMessageDeleter = NewMessageDeleter(RealClock)
+
+// DeleteMessageAfterTime deletes the message once timeDelay has passed, see MessageDeleter.DeleteAfter.
+func DeleteMessageAfterTime(session *discordgo.Session, channelID string, messageID string, timeDelay time.Duration) *PendingDeletion {
+	return DefaultMessageDeleter.DeleteAfter(session, channelID, messageID, timeDelay)
+}
+
+// MessageDeleter deletes messages after a delay, keeping track of the deletions still pending so they can be
+// cancelled or pushed back, and flushed when the bot shuts down.
+type MessageDeleter struct {
+	clock   Clock
+	mu      sync.Mutex
+	pending map[string]*PendingDeletion
+}
+
+// PendingDeletion is a message waiting to be deleted.
+type PendingDeletion struct {
+	deleter   *MessageDeleter
+	session   *discordgo.Session
+	channelID string
+	messageID string
+	timer     Timer
+}
+
+func NewMessageDeleter(clock Clock) *MessageDeleter {
+	return &MessageDeleter{
+		clock:   clock,
+		pending: make(map[string]*PendingDeletion),
+	}
+}
+
+// DeleteAfter deletes the message once delay has passed, replacing any deletion already pending for it.
+func (d *MessageDeleter) DeleteAfter(session *discordgo.Session, channelID string, messageID string, delay time.Duration) *PendingDeletion {
+	deletion := &PendingDeletion{deleter: d, session: session, channelID: channelID, messageID: messageID}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if previous, ok := d.pending[messageID]; ok {
+		previous.timer.Stop()
 	}
 
-	time.AfterFunc(timeDelay, func() {
-		_ = session.ChannelMessageDelete(channelID, message.ID)
+	deletion.timer = d.clock.AfterFunc(delay, func() {
+		if d.claim(deletion) {
+			_ = DeleteMessage(context.Background(), session, channelID, messageID)
+		}
 	})
 
-	return nil
+	d.pending[messageID] = deletion
+
+	return deletion
+}
+
+// Cancel keeps the message, returning false if it wasn't waiting to be deleted.
+func (d *MessageDeleter) Cancel(messageID string) bool {
+	d.mu.Lock()
+	deletion, ok := d.pending[messageID]
+	d.mu.Unlock()
+
+	return ok && deletion.Cancel()
+}
+
+// Extend pushes back the message's pending deletion so it's deleted delay from now, returning false if it wasn't
+// waiting to be deleted.
+func (d *MessageDeleter) Extend(messageID string, delay time.Duration) bool {
+	d.mu.Lock()
+	deletion, ok := d.pending[messageID]
+	d.mu.Unlock()
+
+	if !ok || !deletion.Cancel() {
+		return false
+	}
+
+	d.DeleteAfter(deletion.session, deletion.channelID, deletion.messageID, delay)
+
+	return true
 }
 
-func GetVoiceChannelMemberCount(session *discordgo.Session, guildID, channelID string) (int, error) {
+// Pending is how many messages are waiting to be deleted.
+func (d *MessageDeleter) Pending() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return len(d.pending)
+}
+
+// Flush deletes every pending message right away rather than leaving them behind when the bot shuts down, returning
+// how many were deleted.
+func (d *MessageDeleter) Flush() int {
+	d.mu.Lock()
+	pending := d.pending
+	d.pending = make(map[string]*PendingDeletion)
+	d.mu.Unlock()
+
+	deleted := 0
+
+	for _, deletion := range pending {
+		deletion.timer.Stop()
+
+		if err := DeleteMessage(context.Background(), deletion.session, deletion.channelID, deletion.messageID); err == nil {
+			deleted++
+		}
+	}
+
+	return deleted
+}
+
+// claim removes the deletion from the pending ones, returning false if it was cancelled or replaced in the meantime.
+func (d *MessageDeleter) claim(deletion *PendingDeletion) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.pending[deletion.messageID] != deletion {
+		return false
+	}
+
+	delete(d.pending, deletion.messageID)
+
+	return true
+}
+
+// Cancel keeps the message, returning false if it was already deleted or its deletion was replaced.
+func (p *PendingDeletion) Cancel() bool {
+	if !p.deleter.claim(p) {
+		return false
+	}
+
+	p.timer.Stop()
+
+	return true
+}
+
+// GetVoiceChannelMemberCount counts who is in the voice channel. The bot itself is always counted but other bots only are
+// when includeBots is set, so that bots idling in a channel don't keep it looking occupied. Voice states without a
+// cached member are resolved with ResolveMember to tell whether they're a bot.
+func GetVoiceChannelMemberCount(session *discordgo.Session, guildID, channelID string, includeBots bool) (int, error) {
 	guild, err := session.State.Guild(guildID)
 	if err != nil {
 		return 0, fmt.Errorf("getting guild: %w", err)
 	}
 
+	session.State.RLock()
+	voiceStates := append([]*discordgo.VoiceState{}, guild.VoiceStates...)
+	session.State.RUnlock()
+
 	memberCount := 0
 
 	// Loop through VoiceStates to find all members in the specific voice channel
-	for _, vs := range guild.VoiceStates {
-		if vs.ChannelID == channelID && (!vs.Member.User.Bot || vs.UserID == session.State.User.ID) {
+	for _, vs := range voiceStates {
+		if vs.ChannelID != channelID {
+			continue
+		}
+
+		if includeBots || vs.UserID == session.State.User.ID {
+			memberCount++
+			continue
+		}
+
+		member := vs.Member
+		if member == nil {
+			if member, err = ResolveMember(context.Background(), session, guildID, vs.UserID); err != nil {
+				// Counting someone who can't be resolved keeps the bot from leaving a channel that might not be empty
+				memberCount++
+				continue
+			}
+		}
+
+		if !member.User.Bot {
 			memberCount++
 		}
 	}
 
 	return memberCount, nil
 }
+
+func InteractionName(interaction *discordgo.InteractionCreate) string {
+	switch interaction.Type {
+	case discordgo.InteractionApplicationCommand, discordgo.InteractionApplicationCommandAutocomplete:
+		return interaction.ApplicationCommandData().Name
+	case discordgo.InteractionMessageComponent:
+		return interaction.MessageComponentData().CustomID
+	case discordgo.InteractionModalSubmit:
+		return interaction.ModalSubmitData().CustomID
+	default:
+		return interaction.Type.String()
+	}
+}
+
+func InteractionUserID(interaction *discordgo.InteractionCreate) string {
+	if interaction.Member != nil && interaction.Member.User != nil {
+		return interaction.Member.User.ID
+	}
+
+	if interaction.User != nil {
+		return interaction.User.ID
+	}
+
+	return ""
+}
@@ -0,0 +1,45 @@
+package util
+
+import (
+	"fmt"
+	"time"
+)
+
+// FormatDuration formats d the way a media player shows it, "0:07" or "1:02:03" once it passes an hour. Partial
+// seconds are dropped and negative durations are shown as zero.
+func FormatDuration(d time.Duration) string {
+	seconds := int64(max(d, 0) / time.Second)
+	hours, minutes := seconds/3600, seconds/60%60
+	seconds %= 60
+
+	if hours > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", hours, minutes, seconds)
+	}
+
+	return fmt.Sprintf("%d:%02d", minutes, seconds)
+}
+
+// FormatBytes formats a size in 1024 based units with one decimal place, "1.2 MB", sizes under a kilobyte are
+// shown in whole bytes.
+func FormatBytes(bytes int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	size := float64(bytes)
+	unit := 0
+
+	for size >= 1024 && unit < len(units)-1 {
+		size /= 1024
+		unit++
+	}
+
+	if unit == 0 {
+		return fmt.Sprintf("%d %s", bytes, units[unit])
+	}
+
+	return fmt.Sprintf("%.1f %s", size, units[unit])
+}
+
+// RelativeTimestamp is a Discord timestamp for t that each client renders relative to its own clock, "in 3 days"
+// or "2 hours ago".
+func RelativeTimestamp(t time.Time) string {
+	return fmt.Sprintf("<t:%d:R>", t.Unix())
+}
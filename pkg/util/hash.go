@@ -0,0 +1,63 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// crc32cTable is the Castagnoli table cloud storage uses for its object checksums
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Checksums identify some contents, SHA256 for telling clips apart and CRC32C for checking transfers with cloud storage.
+type Checksums struct {
+	SHA256 string
+	CRC32C uint32
+	Size   int64
+}
+
+// HashReader reads r to the end, checksumming everything read.
+func HashReader(r io.Reader) (Checksums, error) {
+	sha := sha256.New()
+	crc := crc32.New(crc32cTable)
+
+	size, err := io.Copy(io.MultiWriter(sha, crc), r)
+	if err != nil {
+		return Checksums{}, fmt.Errorf("error hashing contents: %w", err)
+	}
+
+	return Checksums{SHA256: hex.EncodeToString(sha.Sum(nil)), CRC32C: crc.Sum32(), Size: size}, nil
+}
+
+// HashFile checksums the file at filePath.
+func HashFile(filePath string) (Checksums, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return Checksums{}, err
+	}
+
+	defer file.Close()
+
+	return HashReader(file)
+}
+
+// HashSeeker checksums r from its start and rewinds it again, so an open file can still be read afterwards.
+func HashSeeker(r io.ReadSeeker) (Checksums, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return Checksums{}, err
+	}
+
+	checksums, err := HashReader(r)
+	if err != nil {
+		return Checksums{}, err
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return Checksums{}, err
+	}
+
+	return checksums, nil
+}
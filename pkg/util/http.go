@@ -0,0 +1,200 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrNonPublicAddress is returned for requests an external download client would send somewhere other than the
+	// public internet
+	ErrNonPublicAddress = errors.New("address is not public")
+	// ErrResponseTooLarge is returned when a download is larger than it's allowed to be
+	ErrResponseTooLarge = errors.New("response is too large")
+)
+
+// HTTPStatusError is a response that came back with a status other than 200 OK.
+type HTTPStatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("unexpected status downloading file: %s", e.Status)
+}
+
+// RetryableHTTPError reports whether a failed request is worth trying again, which is the case for server errors, rate
+// limits and requests that never got a response but not for anything the caller cancelled or a download refused.
+func RetryableHTTPError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, ErrNonPublicAddress) || errors.Is(err, ErrResponseTooLarge) {
+		return false
+	}
+
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= http.StatusInternalServerError || statusErr.StatusCode == http.StatusTooManyRequests
+	}
+
+	return true
+}
+
+// HTTPClientConfig tunes an http client's timeouts, connection pooling and proxy. Zero values leave Go's defaults.
+type HTTPClientConfig struct {
+	// Timeout bounds a whole request including reading the body, zero leaves it unbounded
+	Timeout time.Duration
+	// ResponseHeaderTimeout bounds the wait for a response once the request is sent, catching hung endpoints even
+	// when Timeout has to be long enough for large bodies
+	ResponseHeaderTimeout time.Duration
+	MaxIdleConns          int
+	MaxIdleConnsPerHost   int
+	IdleConnTimeout       time.Duration
+	// Proxy routes every request through this url, nil uses the HTTP_PROXY and HTTPS_PROXY environment variables
+	Proxy *url.URL
+}
+
+var (
+	// DefaultAPIClientConfig suits REST calls, which are small apart from the odd file upload
+	DefaultAPIClientConfig = HTTPClientConfig{
+		Timeout:               time.Minute,
+		ResponseHeaderTimeout: time.Second * 20,
+	}
+	// DefaultDownloadClientConfig suits cdn downloads, which can be large so only the wait for headers is bounded
+	DefaultDownloadClientConfig = HTTPClientConfig{
+		ResponseHeaderTimeout: time.Second * 15,
+		MaxIdleConns:          32,
+		MaxIdleConnsPerHost:   16,
+	}
+)
+
+// NewHTTPClient returns an http client configured by config, it should be shared so connections are reused.
+func NewHTTPClient(config HTTPClientConfig) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if config.ResponseHeaderTimeout > 0 {
+		transport.ResponseHeaderTimeout = config.ResponseHeaderTimeout
+	}
+
+	if config.MaxIdleConns > 0 {
+		transport.MaxIdleConns = config.MaxIdleConns
+	}
+
+	if config.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = config.MaxIdleConnsPerHost
+	}
+
+	if config.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = config.IdleConnTimeout
+	}
+
+	if config.Proxy != nil {
+		transport.Proxy = http.ProxyURL(config.Proxy)
+	}
+
+	return &http.Client{Transport: transport, Timeout: config.Timeout}
+}
+
+// NewDownloadClient returns an http client for fetching attachments with DefaultDownloadClientConfig, it should be
+// shared so connections to the cdn are reused across downloads.
+func NewDownloadClient() *http.Client {
+	return NewHTTPClient(DefaultDownloadClientConfig)
+}
+
+// NewExternalDownloadClient returns a download client for urls members gave the bot. It only connects to public
+// addresses, checked when dialing so redirects and dns answers can't point it at the host's network, and ignores proxy
+// settings since a proxy would dial on its behalf.
+func NewExternalDownloadClient() *http.Client {
+	client := NewDownloadClient()
+	transport := client.Transport.(*http.Transport)
+	transport.Proxy = nil
+
+	dialer := &net.Dialer{
+		Timeout: time.Second * 30,
+		Control: func(_ string, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			ip := net.ParseIP(host)
+			if ip == nil || !ip.IsGlobalUnicast() || ip.IsPrivate() {
+				return fmt.Errorf("%s: %w", host, ErrNonPublicAddress)
+			}
+
+			return nil
+		},
+	}
+	transport.DialContext = dialer.DialContext
+
+	return client
+}
+
+// DownloadURL fetches url into a new file in dir, see DownloadFileToDirectory. The caller is responsible for deleting it.
+func DownloadURL(ctx context.Context, client *http.Client, dir string, url string) (*os.File, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error building request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &HTTPStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	return DownloadFileToDirectory(dir, resp.Body)
+}
+
+// DownloadLimitedURL is DownloadURL for responses of at most limit bytes, larger ones fail with ErrResponseTooLarge
+// without being kept.
+func DownloadLimitedURL(ctx context.Context, client *http.Client, dir string, url string, limit int64) (*os.File, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error building request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &HTTPStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	if resp.ContentLength > limit {
+		return nil, ErrResponseTooLarge
+	}
+
+	file, err := DownloadFileToDirectory(dir, io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if info, err := file.Stat(); err != nil || info.Size() > limit {
+		file.Close()
+		os.Remove(file.Name())
+
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, ErrResponseTooLarge
+	}
+
+	return file, nil
+}
@@ -0,0 +1,78 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SafeJoin joins name onto root, refusing names that would end up outside of it such as absolute paths or ones
+// climbing out with "..". Names may use either slash, zip entries always use forward slashes.
+func SafeJoin(root string, name string) (string, error) {
+	local := filepath.FromSlash(strings.ReplaceAll(name, `\`, "/"))
+	if !filepath.IsLocal(local) {
+		return "", fmt.Errorf("%s: %w", name, ErrIllegalPath)
+	}
+
+	return filepath.Join(root, local), nil
+}
+
+// SanitizeFileName makes name safe to use as a single file name on any platform, dropping directories, control
+// characters and the characters windows reserves. It never returns an empty name.
+func SanitizeFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, `\`, "/"))
+
+	sanitized := strings.Map(func(r rune) rune {
+		switch {
+		case r < 0x20 || r == 0x7f:
+			return -1
+		case strings.ContainsRune(`<>:"/\|?*`, r):
+			return '_'
+		default:
+			return r
+		}
+	}, name)
+
+	sanitized = strings.Trim(sanitized, " .")
+	if sanitized == "" {
+		return "file"
+	}
+
+	return sanitized
+}
+
+// Workspace is a temporary directory for a single operation such as an upload or an export. Everything it hands out
+// lives inside it, so closing it cleans up whatever the operation left behind, even on error paths.
+type Workspace struct {
+	dir string
+}
+
+// NewWorkspace creates a workspace under the system's temporary directory, prefix helps tell them apart.
+func NewWorkspace(prefix string) (*Workspace, error) {
+	dir, err := os.MkdirTemp("", prefix)
+	if err != nil {
+		return nil, fmt.Errorf("error creating workspace: %w", err)
+	}
+
+	return &Workspace{dir: dir}, nil
+}
+
+func (w *Workspace) Dir() string {
+	return w.dir
+}
+
+// Path is where name lives in the workspace, see SafeJoin.
+func (w *Workspace) Path(name string) (string, error) {
+	return SafeJoin(w.dir, name)
+}
+
+// CreateTemp creates a new file in the workspace, see os.CreateTemp.
+func (w *Workspace) CreateTemp(pattern string) (*os.File, error) {
+	return os.CreateTemp(w.dir, pattern)
+}
+
+// Close removes the workspace and everything in it.
+func (w *Workspace) Close() error {
+	return os.RemoveAll(w.dir)
+}
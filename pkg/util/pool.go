@@ -0,0 +1,121 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// PoolResult is the outcome of one task run by a Pool, Index is the order the task was submitted in.
+type PoolResult[T any] struct {
+	Index int
+	Value T
+	Err   error
+}
+
+// PoolResults are the results of every task a Pool ran, in the order the tasks were submitted.
+type PoolResults[T any] []PoolResult[T]
+
+// Err joins the errors of every task that failed, nil when they all succeeded.
+func (r PoolResults[T]) Err() error {
+	errs := []error{}
+	for _, result := range r {
+		if result.Err != nil {
+			errs = append(errs, result.Err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Failed is how many tasks returned an error.
+func (r PoolResults[T]) Failed() int {
+	failed := 0
+	for _, result := range r {
+		if result.Err != nil {
+			failed++
+		}
+	}
+
+	return failed
+}
+
+// Values are the values of the tasks that succeeded, in submission order.
+func (r PoolResults[T]) Values() []T {
+	values := []T{}
+	for _, result := range r {
+		if result.Err == nil {
+			values = append(values, result.Value)
+		}
+	}
+
+	return values
+}
+
+// Pool runs tasks with at most a fixed number of them at once. Unlike an errgroup one task failing doesn't cancel
+// the others, every submitted task gets its own result so callers decide what a partial failure means. Tasks that
+// haven't started by the time ctx is done aren't run and fail with the context's error.
+type Pool[T any] struct {
+	ctx     context.Context
+	sem     chan struct{}
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	results PoolResults[T]
+}
+
+// NewPool creates a pool running up to limit tasks at once, a limit below 1 runs them one at a time.
+func NewPool[T any](ctx context.Context, limit int) *Pool[T] {
+	return &Pool[T]{
+		ctx: ctx,
+		sem: make(chan struct{}, max(limit, 1)),
+	}
+}
+
+// Submit runs task once the pool has room for it, blocking until it does.
+func (p *Pool[T]) Submit(task func(ctx context.Context) (T, error)) {
+	p.mu.Lock()
+	index := len(p.results)
+	p.results = append(p.results, PoolResult[T]{Index: index})
+	p.mu.Unlock()
+
+	if err := p.ctx.Err(); err != nil {
+		p.record(index, *new(T), err)
+		return
+	}
+
+	select {
+	case p.sem <- struct{}{}:
+	case <-p.ctx.Done():
+		p.record(index, *new(T), p.ctx.Err())
+		return
+	}
+
+	p.wg.Add(1)
+
+	go func() {
+		defer func() {
+			<-p.sem
+			p.wg.Done()
+		}()
+
+		value, err := task(p.ctx)
+		p.record(index, value, err)
+	}()
+}
+
+func (p *Pool[T]) record(index int, value T, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.results[index].Value, p.results[index].Err = value, err
+}
+
+// Wait waits for every submitted task to finish and returns their results, no more tasks may be submitted after.
+func (p *Pool[T]) Wait() PoolResults[T] {
+	p.wg.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.results
+}
@@ -0,0 +1,143 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoolResultsInSubmissionOrder(t *testing.T) {
+	pool := NewPool[int](context.Background(), 4)
+
+	// Later tasks finish first, results still come back in the order they were submitted
+	for i := range 4 {
+		pool.Submit(func(context.Context) (int, error) {
+			time.Sleep(time.Millisecond * time.Duration(20*(4-i)))
+
+			if i == 2 {
+				return 0, errTemporary
+			}
+
+			return i, nil
+		})
+	}
+
+	results := pool.Wait()
+
+	for i, result := range results {
+		if result.Index != i {
+			t.Errorf("results[%d].Index = %d, want %d", i, result.Index, i)
+		}
+	}
+
+	if values := results.Values(); !slices.Equal(values, []int{0, 1, 3}) {
+		t.Errorf("Values() = %v, want [0 1 3]", values)
+	}
+
+	if results.Failed() != 1 || !errors.Is(results.Err(), errTemporary) || results[2].Err == nil {
+		t.Errorf("Failed() = %d, Err() = %v; want only the third task failing", results.Failed(), results.Err())
+	}
+}
+
+func TestPoolConcurrencyLimit(t *testing.T) {
+	tests := []struct {
+		limit int
+		want  int32
+	}{
+		{limit: 1, want: 1},
+		{limit: 3, want: 3},
+		{limit: 0, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("limit %d", tt.limit), func(t *testing.T) {
+			pool := NewPool[struct{}](context.Background(), tt.limit)
+
+			var running, peak atomic.Int32
+
+			for range 10 {
+				pool.Submit(func(context.Context) (struct{}, error) {
+					now := running.Add(1)
+					defer running.Add(-1)
+
+					for {
+						seen := peak.Load()
+						if now <= seen || peak.CompareAndSwap(seen, now) {
+							break
+						}
+					}
+
+					time.Sleep(time.Millisecond * 20)
+
+					return struct{}{}, nil
+				})
+			}
+
+			if results := pool.Wait(); len(results) != 10 || results.Err() != nil {
+				t.Fatalf("Wait() = %d results, error %v; want 10, nil", len(results), results.Err())
+			}
+
+			if got := peak.Load(); got != tt.want {
+				t.Errorf("most tasks running at once = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPoolCancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	pool := NewPool[int](ctx, 1)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	pool.Submit(func(ctx context.Context) (int, error) {
+		close(started)
+		<-release
+
+		return 1, nil
+	})
+
+	<-started
+
+	// The pool is full, so this waits for room until ctx is cancelled and never runs
+	submitted := make(chan struct{})
+
+	go func() {
+		defer close(submitted)
+
+		pool.Submit(func(context.Context) (int, error) {
+			t.Error("task waiting for room ran after ctx was cancelled")
+			return 2, nil
+		})
+	}()
+
+	cancel()
+	<-submitted
+
+	pool.Submit(func(context.Context) (int, error) {
+		t.Error("task submitted after ctx was cancelled ran")
+		return 3, nil
+	})
+
+	close(release)
+
+	results := pool.Wait()
+	if len(results) != 3 {
+		t.Fatalf("Wait() = %d results, want 3", len(results))
+	}
+
+	if results[0].Err != nil || results[0].Value != 1 {
+		t.Errorf("results[0] = %d, %v; want the running task to finish with 1, nil", results[0].Value, results[0].Err)
+	}
+
+	for _, result := range results[1:] {
+		if !errors.Is(result.Err, context.Canceled) {
+			t.Errorf("results[%d].Err = %v, want context.Canceled", result.Index, result.Err)
+		}
+	}
+}
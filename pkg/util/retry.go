@@ -0,0 +1,76 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// RetryPolicy says how many times Retry tries and how long it waits in between.
+type RetryPolicy struct {
+	// MaxAttempts includes the first attempt, anything below one is treated as one
+	MaxAttempts int
+	// BaseDelay is the wait before the second attempt, doubling after every attempt up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Jitter is the fraction of each wait that's randomized, so callers that failed together don't retry together
+	Jitter float64
+	// Retryable decides whether an error is worth another attempt, every error is when it's nil
+	Retryable func(err error) bool
+	// MinDelay is the least to wait after err, for errors that say when to come back such as rate limits
+	MinDelay func(err error) time.Duration
+}
+
+// DefaultRetryPolicy suits quick network calls, a few attempts within a couple of seconds.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   time.Millisecond * 250,
+	MaxDelay:    time.Second * 2,
+	Jitter:      0.2,
+}
+
+var retryRand = NewRand(time.Now().UnixNano())
+
+// Retry calls fn until it succeeds, fails with an error the policy doesn't retry or runs out of attempts, returning
+// fn's last error. It stops waiting as soon as ctx is done.
+func Retry(ctx context.Context, policy RetryPolicy, fn func(ctx context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || attempt >= policy.MaxAttempts || (policy.Retryable != nil && !policy.Retryable(err)) {
+			return err
+		}
+
+		if ctx.Err() != nil {
+			return errors.Join(err, ctx.Err())
+		}
+
+		wait := policy.delay(attempt, err)
+		timer := time.NewTimer(wait)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// delay is how long to wait after the given attempt failed with err.
+func (p RetryPolicy) delay(attempt int, err error) time.Duration {
+	wait := p.BaseDelay << (attempt - 1)
+	if p.MaxDelay > 0 && (wait > p.MaxDelay || wait <= 0) {
+		wait = p.MaxDelay
+	}
+
+	if p.Jitter > 0 {
+		spread := float64(wait) * min(p.Jitter, 1)
+		wait = time.Duration(float64(wait) - spread + retryRand.Float64()*spread*2)
+	}
+
+	if p.MinDelay != nil {
+		wait = max(wait, p.MinDelay(err))
+	}
+
+	return max(wait, 0)
+}
@@ -0,0 +1,129 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var (
+	errTemporary = errors.New("temporary")
+	errPermanent = errors.New("permanent")
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	rateLimited := func(err error) time.Duration {
+		if errors.Is(err, errTemporary) {
+			return time.Second * 5
+		}
+
+		return 0
+	}
+
+	tests := []struct {
+		name    string
+		policy  RetryPolicy
+		attempt int
+		err     error
+		want    time.Duration
+	}{
+		{name: "first wait is the base delay", policy: RetryPolicy{BaseDelay: time.Millisecond * 100}, attempt: 1, want: time.Millisecond * 100},
+		{name: "doubles after every attempt", policy: RetryPolicy{BaseDelay: time.Millisecond * 100}, attempt: 4, want: time.Millisecond * 800},
+		{name: "capped at the max delay", policy: RetryPolicy{BaseDelay: time.Millisecond * 100, MaxDelay: time.Millisecond * 300}, attempt: 4, want: time.Millisecond * 300},
+		{name: "overflow falls back to the max delay", policy: RetryPolicy{BaseDelay: time.Second, MaxDelay: time.Minute}, attempt: 80, want: time.Minute},
+		{name: "min delay raises the wait", policy: RetryPolicy{BaseDelay: time.Millisecond * 100, MinDelay: rateLimited}, attempt: 1, err: errTemporary, want: time.Second * 5},
+		{name: "min delay never lowers it", policy: RetryPolicy{BaseDelay: time.Millisecond * 100, MinDelay: rateLimited}, attempt: 1, err: errPermanent, want: time.Millisecond * 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.delay(tt.attempt, tt.err); got != tt.want {
+				t.Errorf("delay(%d) = %v, want %v", tt.attempt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDelayJitter(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: time.Second, Jitter: 0.2}
+
+	for range 100 {
+		if got := policy.delay(1, nil); got < time.Millisecond*800 || got > time.Millisecond*1200 {
+			t.Fatalf("delay() with 20%% jitter = %v, want within 800ms and 1.2s", got)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		policy       RetryPolicy
+		errs         []error
+		wantAttempts int
+		wantErr      error
+	}{
+		{name: "succeeds first time", policy: RetryPolicy{MaxAttempts: 3}, errs: []error{nil}, wantAttempts: 1},
+		{name: "succeeds after failures", policy: RetryPolicy{MaxAttempts: 3}, errs: []error{errTemporary, errTemporary, nil}, wantAttempts: 3},
+		{name: "stops at max attempts", policy: RetryPolicy{MaxAttempts: 3}, errs: []error{errTemporary, errTemporary, errTemporary, nil}, wantAttempts: 3, wantErr: errTemporary},
+		{name: "zero max attempts tries once", policy: RetryPolicy{}, errs: []error{errTemporary, nil}, wantAttempts: 1, wantErr: errTemporary},
+		{
+			name:         "unretryable error stops early",
+			policy:       RetryPolicy{MaxAttempts: 5, Retryable: func(err error) bool { return errors.Is(err, errTemporary) }},
+			errs:         []error{errTemporary, errPermanent, nil},
+			wantAttempts: 2,
+			wantErr:      errPermanent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.policy.BaseDelay = time.Millisecond
+
+			attempts := 0
+			err := Retry(context.Background(), tt.policy, func(context.Context) error {
+				attempts++
+				return tt.errs[attempts-1]
+			})
+
+			if attempts != tt.wantAttempts {
+				t.Errorf("Retry() attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Errorf("Retry() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRetryStopsWaitingWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Hour}
+
+	attempts := 0
+	done := make(chan error)
+
+	go func() {
+		done <- Retry(ctx, policy, func(context.Context) error {
+			attempts++
+			return errTemporary
+		})
+	}()
+
+	// The first attempt has failed and Retry is waiting out the hour long delay when this lands
+	time.AfterFunc(time.Millisecond*20, cancel)
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, errTemporary) || !errors.Is(err, context.Canceled) {
+			t.Errorf("Retry() error = %v, want the last error joined with context.Canceled", err)
+		}
+
+		if attempts != 1 {
+			t.Errorf("Retry() attempts = %d, want 1", attempts)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("Retry() kept waiting after ctx was cancelled")
+	}
+}
@@ -0,0 +1,353 @@
+package util
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+var ErrZipTooLarge = errors.New("zip is over its size limit")
+
+// ZipWriter writes a zip to w, refusing entries once the uncompressed contents would go over maxBytes.
+type ZipWriter struct {
+	writer   *zip.Writer
+	maxBytes int64
+	written  int64
+}
+
+func NewZipWriter(w io.Writer, maxBytes int64) *ZipWriter {
+	return &ZipWriter{
+		writer:   zip.NewWriter(w),
+		maxBytes: maxBytes,
+	}
+}
+
+// Add copies r into a new entry called name, returning ErrZipTooLarge if that puts the zip over its limit.
+// The zip is left holding a truncated entry in that case so it should be thrown away.
+func (z *ZipWriter) Add(name string, r io.Reader) error {
+	entry, err := z.writer.Create(name)
+	if err != nil {
+		return fmt.Errorf("error creating zip entry %s: %w", name, err)
+	}
+
+	remaining := z.maxBytes - z.written
+	written, err := io.Copy(entry, io.LimitReader(r, remaining+1))
+	z.written += written
+	if err != nil {
+		return fmt.Errorf("error writing zip entry %s: %w", name, err)
+	}
+
+	if written > remaining {
+		return ErrZipTooLarge
+	}
+
+	return nil
+}
+
+// Written is the uncompressed size of everything added so far.
+func (z *ZipWriter) Written() int64 {
+	return z.written
+}
+
+func (z *ZipWriter) Close() error {
+	return z.writer.Close()
+}
+
+// ErrSkipZipEntry is returned by a ZipSource's Open to leave the entry out of the zip rather than failing it.
+var ErrSkipZipEntry = errors.New("skip zip entry")
+
+// ZipSource is an entry for ZipReaders, Open is only called when the entry is written so sources can be fetched lazily.
+// Readers that are also io.Closers are closed once written.
+type ZipSource struct {
+	Name string
+	Open func() (io.Reader, error)
+}
+
+// ZipReaders writes the sources to w in name order so the same sources always make the same zip, returning how many
+// entries were written. It fails with ErrZipTooLarge once the uncompressed contents would go over maxBytes.
+func ZipReaders(w io.Writer, maxBytes int64, sources []ZipSource) (int, error) {
+	sources = slices.Clone(sources)
+	slices.SortStableFunc(sources, func(a, b ZipSource) int { return strings.Compare(a.Name, b.Name) })
+
+	zipWriter := NewZipWriter(w, maxBytes)
+	written := 0
+
+	for _, source := range sources {
+		r, err := source.Open()
+		if errors.Is(err, ErrSkipZipEntry) {
+			continue
+		}
+
+		if err != nil {
+			return written, fmt.Errorf("error opening zip entry %s: %w", source.Name, err)
+		}
+
+		err = zipWriter.Add(source.Name, r)
+
+		if closer, ok := r.(io.Closer); ok {
+			closer.Close()
+		}
+
+		if err != nil {
+			return written, err
+		}
+
+		written++
+	}
+
+	return written, zipWriter.Close()
+}
+
+// ZipFiles zips the files at paths, naming each entry after its path relative to root.
+func ZipFiles(w io.Writer, maxBytes int64, root string, paths []string) (int, error) {
+	sources := make([]ZipSource, 0, len(paths))
+
+	for _, filePath := range paths {
+		name, err := filepath.Rel(root, filePath)
+		if err != nil || !filepath.IsLocal(name) {
+			return 0, fmt.Errorf("%s isn't under %s: %w", filePath, root, ErrIllegalPath)
+		}
+
+		sources = append(sources, ZipSource{
+			Name: filepath.ToSlash(name),
+			Open: func() (io.Reader, error) { return os.Open(filePath) },
+		})
+	}
+
+	return ZipReaders(w, maxBytes, sources)
+}
+
+var (
+	ErrTooManyEntries    = errors.New("zip has too many files")
+	ErrEntryTooLarge     = errors.New("file is over the size limit")
+	ErrEntryTooDeep      = errors.New("file is nested in too many folders")
+	ErrNestedArchive     = errors.New("zips inside zips aren't supported")
+	ErrSymlink           = errors.New("symlinks aren't supported")
+	ErrUnsupportedFormat = errors.New("not a supported audio file")
+	ErrIllegalPath       = errors.New("illegal file path")
+)
+
+// UnzipLimits bounds what Unzip extracts from an archive, zero values aren't limited.
+type UnzipLimits struct {
+	MaxEntries int
+	// MaxFileBytes and MaxTotalBytes are uncompressed sizes, they're enforced on what's read rather than what the zip claims
+	MaxFileBytes  int64
+	MaxTotalBytes int64
+	// MaxDepth is how many folders deep a file can be
+	MaxDepth int
+	// Extensions are the lower case extensions extracted, including the dot. Every other file is reported as unsupported
+	Extensions []string
+}
+
+// EntryError is a file in an archive that wasn't extracted and why.
+type EntryError struct {
+	Name string
+	Err  error
+}
+
+func (e EntryError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Name, e.Err)
+}
+
+func (e EntryError) Unwrap() error {
+	return e.Err
+}
+
+func (l UnzipLimits) checkEntry(file *zip.File) error {
+	name := path.Clean(file.Name)
+
+	switch {
+	case file.Mode()&os.ModeSymlink != 0:
+		return ErrSymlink
+	case l.MaxDepth > 0 && strings.Count(name, "/") > l.MaxDepth:
+		return ErrEntryTooDeep
+	case strings.EqualFold(path.Ext(name), ".zip"):
+		return ErrNestedArchive
+	case len(l.Extensions) > 0 && !slices.Contains(l.Extensions, strings.ToLower(path.Ext(name))):
+		return ErrUnsupportedFormat
+	case l.MaxFileBytes > 0 && file.UncompressedSize64 > uint64(l.MaxFileBytes):
+		return ErrEntryTooLarge
+	}
+
+	return nil
+}
+
+// ZipArchive is an archive opened for streaming by OpenZip, its entries are read straight out of the zip without
+// being extracted to disk first.
+type ZipArchive struct {
+	reader  *zip.ReadCloser
+	entries []ZipEntry
+	limits  UnzipLimits
+	mu      sync.Mutex
+	total   int64
+}
+
+// ZipEntry is a file in a ZipArchive that passed the limits it was opened with.
+type ZipEntry struct {
+	Name    string
+	file    *zip.File
+	archive *ZipArchive
+}
+
+// OpenZip opens the archive for streaming, the files that break the limits are returned as entry errors and left out of
+// its entries. Like Unzip only an archive with too many files or one that can't be read at all returns an error.
+func OpenZip(src string, limits UnzipLimits) (*ZipArchive, []EntryError, error) {
+	zipReader, err := zip.OpenReader(src)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening zip reader %w", err)
+	}
+
+	if limits.MaxEntries > 0 && len(zipReader.File) > limits.MaxEntries {
+		zipReader.Close()
+		return nil, nil, ErrTooManyEntries
+	}
+
+	archive := &ZipArchive{reader: zipReader, limits: limits}
+	entryErrors := []EntryError{}
+
+	for _, f := range zipReader.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		if err := limits.checkEntry(f); err != nil {
+			entryErrors = append(entryErrors, EntryError{Name: f.Name, Err: err})
+			continue
+		}
+
+		archive.entries = append(archive.entries, ZipEntry{Name: f.Name, file: f, archive: archive})
+	}
+
+	return archive, entryErrors, nil
+}
+
+// Entries are the archive's files in the order they're stored, they can be opened concurrently.
+func (a *ZipArchive) Entries() []ZipEntry {
+	return a.entries
+}
+
+func (a *ZipArchive) Close() error {
+	return a.reader.Close()
+}
+
+// reserve counts n more bytes read out of the archive, returning false once that's over its total limit.
+func (a *ZipArchive) reserve(n int64) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.total += n
+
+	return a.limits.MaxTotalBytes <= 0 || a.total <= a.limits.MaxTotalBytes
+}
+
+// Open streams the entry's uncompressed contents, reads fail with ErrEntryTooLarge or ErrZipTooLarge once the entry or
+// the archive as a whole goes over its limit.
+func (e ZipEntry) Open() (io.ReadCloser, error) {
+	rc, err := e.file.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	return &zipEntryReader{rc: rc, entry: e}, nil
+}
+
+type zipEntryReader struct {
+	rc    io.ReadCloser
+	entry ZipEntry
+	read  int64
+}
+
+func (r *zipEntryReader) Read(p []byte) (int, error) {
+	n, err := r.rc.Read(p)
+	r.read += int64(n)
+
+	if maxBytes := r.entry.archive.limits.MaxFileBytes; maxBytes > 0 && r.read > maxBytes {
+		return n, ErrEntryTooLarge
+	}
+
+	if !r.entry.archive.reserve(int64(n)) {
+		return n, ErrZipTooLarge
+	}
+
+	return n, err
+}
+
+func (r *zipEntryReader) Close() error {
+	return r.rc.Close()
+}
+
+// Unzip extracts the archive's files into dest, returning them opened at the start. Files that break the limits or can't
+// be extracted are returned as entry errors rather than failing the whole archive, only an archive with too many files
+// or one that can't be read at all returns an error.
+func Unzip(src string, dest string, limits UnzipLimits) ([]*os.File, []EntryError, error) {
+	archive, entryErrors, err := OpenZip(src, limits)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer archive.Close()
+
+	if err := os.MkdirAll(dest, 0o755); err != nil {
+		return nil, nil, err
+	}
+
+	// Closure to address file descriptors issue with all the deferred .Close() methods
+	extractAndWriteFile := func(entry ZipEntry) (*os.File, error) {
+		// Check for ZipSlip (Directory traversal)
+		filePath, err := SafeJoin(dest, entry.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		rc, err := entry.Open()
+		if err != nil {
+			return nil, err
+		}
+
+		defer rc.Close()
+
+		if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+			return nil, err
+		}
+
+		extracted, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = io.Copy(extracted, rc)
+		if err == nil {
+			_, err = extracted.Seek(0, 0)
+		}
+
+		if err != nil {
+			extracted.Close()
+			os.Remove(filePath)
+
+			return nil, err
+		}
+
+		return extracted, nil
+	}
+
+	resultList := []*os.File{}
+
+	for _, entry := range archive.Entries() {
+		file, err := extractAndWriteFile(entry)
+		if err != nil {
+			entryErrors = append(entryErrors, EntryError{Name: entry.Name, Err: err})
+			continue
+		}
+
+		resultList = append(resultList, file)
+	}
+
+	return resultList, entryErrors, nil
+}